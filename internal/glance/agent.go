@@ -0,0 +1,135 @@
+package glance
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glanceapp/glance/pkg/sysinfo"
+)
+
+const agentDefaultPort = 27973
+
+// Lets Glance run on other machines as an agent which only reports the stats
+// of the machine, so that they can be shown by the server-stats widget
+type agentOptions struct {
+	host       string
+	port       uint16
+	token      string
+	sysinfoReq sysinfo.SystemInfoRequest
+}
+
+func parseAgentOptions(args []string) (*agentOptions, error) {
+	flags := flag.NewFlagSet("agent", flag.ExitOnError)
+	host := flags.String("host", "", "Address to listen on")
+	port := flags.Uint("port", agentDefaultPort, "Port to listen on")
+	token := flags.String("token", os.Getenv("GLANCE_AGENT_TOKEN"), "Token that requests must include, defaults to $GLANCE_AGENT_TOKEN")
+	cpuTempSensor := flags.String("cpu-temp-sensor", "", "Sensor to use for the CPU temperature")
+	tempSensors := flags.String("temp-sensors", "", "Comma separated list of other temperature sensors to report")
+	mountpoints := flags.String("mountpoints", "", "Comma separated list of mountpoints to report, all are reported when empty")
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unknown arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	if *token == "" {
+		return nil, errors.New("the agent requires a token, set it through --token or the GLANCE_AGENT_TOKEN environment variable")
+	}
+
+	if *port == 0 || *port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", *port)
+	}
+
+	options := &agentOptions{
+		host:  *host,
+		port:  uint16(*port),
+		token: *token,
+		sysinfoReq: sysinfo.SystemInfoRequest{
+			CPUTempSensor: *cpuTempSensor,
+		},
+	}
+
+	for _, key := range splitAgentListOption(*tempSensors) {
+		if options.sysinfoReq.TempSensors == nil {
+			options.sysinfoReq.TempSensors = make(map[string]sysinfo.SensorRequest)
+		}
+
+		options.sysinfoReq.TempSensors[key] = sysinfo.SensorRequest{}
+	}
+
+	if paths := splitAgentListOption(*mountpoints); len(paths) > 0 {
+		options.sysinfoReq.HideMountpointsByDefault = true
+		options.sysinfoReq.Mountpoints = make(map[string]sysinfo.MointpointRequest, len(paths))
+		shown := false
+
+		for _, path := range paths {
+			options.sysinfoReq.Mountpoints[path] = sysinfo.MointpointRequest{Hide: &shown}
+		}
+	}
+
+	return options, nil
+}
+
+func splitAgentListOption(value string) []string {
+	items := make([]string, 0)
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func (options *agentOptions) handleSysinfoRequest(w http.ResponseWriter, r *http.Request) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || subtle.ConstantTimeCompare([]byte(token), []byte(options.token)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	info, errs := sysinfo.Collect(&options.sysinfoReq)
+	for i := range errs {
+		slog.Warn("Getting system info: " + errs[i].Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+func cliAgent(options *agentOptions) int {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/sysinfo/all", options.handleSysinfoRequest)
+	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := &http.Server{
+		Addr:              options.host + ":" + strconv.Itoa(int(options.port)),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	log.Printf("Starting agent on %s\n", server.Addr)
+
+	if err := server.ListenAndServe(); err != nil {
+		fmt.Printf("Agent stopped: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
@@ -13,6 +13,8 @@ import (
 	"log"
 	mathrand "math/rand/v2"
 	"net/http"
+	"net/netip"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -252,39 +254,253 @@ func (a *application) isAuthorized(w http.ResponseWriter, r *http.Request) bool
 		return true
 	}
 
+	username, shouldRegenerate, ok := a.sessionFromRequest(r)
+	if !ok {
+		return false
+	}
+
+	if shouldRegenerate {
+		newToken, err := generateSessionToken(username, a.authSecretKey, time.Now())
+		if err != nil {
+			log.Printf("Could not compute session token during regeneration: %v", err)
+			return false
+		}
+
+		a.setAuthSessionCookie(w, r, newToken, time.Now().Add(AUTH_TOKEN_VALID_PERIOD))
+	}
+
+	return true
+}
+
+// Returns the username of the user the request was made by, if they're logged in
+func (a *application) sessionFromRequest(r *http.Request) (string, bool, bool) {
+	if !a.RequiresAuth {
+		return "", false, false
+	}
+
+	if username, ok := a.usernameFromTrustedHeader(r); ok {
+		return username, false, true
+	}
+
 	token, err := r.Cookie(AUTH_SESSION_COOKIE_NAME)
 	if err != nil || token.Value == "" {
-		return false
+		return "", false, false
 	}
 
 	usernameHash, shouldRegenerate, err := verifySessionToken(token.Value, a.authSecretKey, time.Now())
 	if err != nil {
-		return false
+		return "", false, false
 	}
 
 	username, exists := a.usernameHashToUsername[string(usernameHash)]
 	if !exists {
-		return false
+		return "", false, false
 	}
 
 	_, exists = a.Config.Auth.Users[username]
 	if !exists {
-		return false
+		return "", false, false
 	}
 
-	if shouldRegenerate {
-		newToken, err := generateSessionToken(username, a.authSecretKey, time.Now())
+	return username, shouldRegenerate, true
+}
+
+// When Glance sits behind an authenticating proxy, the proxy tells us who the
+// user is through a header, which is only trusted when the request came
+// directly from one of the configured proxies
+func (a *application) usernameFromTrustedHeader(r *http.Request) (string, bool) {
+	if a.Config.Auth.TrustedHeader == "" {
+		return "", false
+	}
+
+	username := r.Header.Get(a.Config.Auth.TrustedHeader)
+	if username == "" {
+		return "", false
+	}
+
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return "", false
+	}
+
+	addr := addrPort.Addr().Unmap()
+	if !slices.ContainsFunc(a.authTrustedProxies, func(p netip.Prefix) bool { return p.Contains(addr) }) {
+		return "", false
+	}
+
+	if _, exists := a.Config.Auth.Users[username]; !exists {
+		return "", false
+	}
+
+	return username, true
+}
+
+func parseIPOrPrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		return prefix.Masked(), err
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Limits a page or widget to some of the users and/or to the requests which
+// come from some of the networks, when both are set both have to match. Left
+// empty, they're accessible to everyone who can access Glance.
+type accessRules struct {
+	Users           []string       `yaml:"users"`
+	AllowedNetworks []string       `yaml:"allowed-networks"`
+	allowedPrefixes []netip.Prefix `yaml:"-"`
+}
+
+func (rules *accessRules) isRestricted() bool {
+	return len(rules.Users) > 0 || len(rules.AllowedNetworks) > 0
+}
+
+func (rules *accessRules) init(users map[string]*user) error {
+	for _, username := range rules.Users {
+		if _, exists := users[username]; !exists {
+			return fmt.Errorf("user %s does not exist", username)
+		}
+	}
+
+	rules.allowedPrefixes = make([]netip.Prefix, 0, len(rules.AllowedNetworks))
+
+	for _, network := range rules.AllowedNetworks {
+		prefix, err := parseIPOrPrefix(network)
 		if err != nil {
-			log.Printf("Could not compute session token during regeneration: %v", err)
+			return fmt.Errorf("invalid network %q: %v", network, err)
+		}
+
+		rules.allowedPrefixes = append(rules.allowedPrefixes, prefix)
+	}
+
+	return nil
+}
+
+// Uses the address of the client rather than the one of the proxy when
+// server.proxied is set
+func (a *application) allowsRequest(r *http.Request, rules *accessRules) bool {
+	if len(rules.Users) > 0 {
+		username, _, ok := a.sessionFromRequest(r)
+		if !ok || !slices.Contains(rules.Users, username) {
 			return false
 		}
+	}
 
-		a.setAuthSessionCookie(w, r, newToken, time.Now().Add(AUTH_TOKEN_VALID_PERIOD))
+	if len(rules.allowedPrefixes) > 0 {
+		addr, err := netip.ParseAddr(strings.Trim(strings.TrimSpace(a.addressOfRequest(r)), "[]"))
+		if err != nil {
+			return false
+		}
+
+		addr = addr.WithZone("").Unmap()
+		if !slices.ContainsFunc(rules.allowedPrefixes, func(p netip.Prefix) bool { return p.Contains(addr) }) {
+			return false
+		}
 	}
 
 	return true
 }
 
+// Only the widgets placed directly on the page can be restricted, the ones
+// within other widgets get rendered as part of them
+func initWidgetAccessRules(page *page, users map[string]*user) error {
+	topLevel := make(map[widget]bool)
+	forEachTopLevelPageWidget(page, func(w widget) {
+		topLevel[w] = true
+	})
+
+	var err error
+	forEachPageWidget(page, func(w widget) bool {
+		base := w.base()
+		if !base.isRestricted() {
+			return true
+		}
+
+		if !topLevel[w] {
+			err = fmt.Errorf("line %d: users and allowed-networks can't be set on widgets within other widgets", base.configLine)
+			return false
+		}
+
+		if initErr := base.accessRules.init(users); initErr != nil {
+			err = fmt.Errorf("line %d: %v", base.configLine, initErr)
+			return false
+		}
+
+		return true
+	})
+
+	return err
+}
+
+func (a *application) canAccessPage(r *http.Request, page *page) bool {
+	return page == nil || a.allowsRequest(r, &page.accessRules)
+}
+
+// Widgets within other widgets follow the rules of the widget they're in, on
+// top of the ones of their page
+func (a *application) canAccessWidget(r *http.Request, id uint64) bool {
+	if !a.canAccessPage(r, a.widgetPage[id]) {
+		return false
+	}
+
+	rules, restricted := a.widgetAccessRules[id]
+	return !restricted || a.allowsRequest(r, rules)
+}
+
+func (a *application) accessibleWidgets(r *http.Request, list widgets) widgets {
+	accessible := make(widgets, 0, len(list))
+
+	for i := range list {
+		if a.canAccessWidget(r, list[i].GetID()) {
+			accessible = append(accessible, list[i])
+		}
+	}
+
+	return accessible
+}
+
+func (a *application) accessiblePages(r *http.Request) []*page {
+	pages := make([]*page, 0, len(a.Config.Pages))
+
+	for i := range a.Config.Pages {
+		if a.canAccessPage(r, &a.Config.Pages[i]) {
+			pages = append(pages, &a.Config.Pages[i])
+		}
+	}
+
+	return pages
+}
+
+// Pages which the user can't access are treated as if they didn't exist, other
+// than the home page which becomes the first page that they can access
+func (a *application) pageFromRequest(r *http.Request) (*page, bool) {
+	slug := r.PathValue("page")
+
+	page, exists := a.slugToPage[slug]
+	if !exists {
+		return nil, false
+	}
+
+	if a.canAccessPage(r, page) {
+		return page, true
+	}
+
+	if slug == "" {
+		if pages := a.accessiblePages(r); len(pages) > 0 {
+			return pages[0], true
+		}
+	}
+
+	return nil, false
+}
+
 // Handles sending the appropriate response for an unauthorized request and returns true if the request was unauthorized
 func (a *application) handleUnauthorizedResponse(w http.ResponseWriter, r *http.Request, fallback doWhenUnauthorized) bool {
 	if a.isAuthorized(w, r) {
@@ -313,8 +529,8 @@ func (a *application) setAuthSessionCookie(w http.ResponseWriter, r *http.Reques
 		Name:     AUTH_SESSION_COOKIE_NAME,
 		Value:    token,
 		Expires:  expires,
-		Secure:   strings.ToLower(r.Header.Get("X-Forwarded-Proto")) == "https",
-		Path:     a.Config.Server.BaseURL + "/",
+		Secure:   r.TLS != nil || strings.ToLower(r.Header.Get("X-Forwarded-Proto")) == "https",
+		Path:     a.Config.Server.basePath + "/",
 		SameSite: http.SameSiteLaxMode,
 		HttpOnly: true,
 	})
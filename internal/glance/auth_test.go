@@ -3,6 +3,8 @@ package glance
 import (
 	"bytes"
 	"encoding/base64"
+	"net/http/httptest"
+	"net/netip"
 	"testing"
 	"time"
 )
@@ -83,3 +85,43 @@ func TestAuthTokenGenerationAndVerification(t *testing.T) {
 		}
 	}
 }
+
+func TestAddressOfRequest(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("fd00::/8")}
+
+	tests := []struct {
+		name         string
+		proxied      bool
+		trusted      []netip.Prefix
+		forwardedFor []string
+		expected     string
+	}{
+		{name: "not proxied", forwardedFor: []string{"203.0.113.7"}, expected: "192.0.2.1"},
+		{name: "no header", proxied: true, expected: "192.0.2.1"},
+		{name: "single address", proxied: true, forwardedFor: []string{"203.0.113.7"}, expected: "203.0.113.7"},
+		{name: "spoofed entries on the left", proxied: true, forwardedFor: []string{"10.1.1.1, 203.0.113.7"}, expected: "203.0.113.7"},
+		{name: "trusted proxies get skipped", proxied: true, trusted: trusted, forwardedFor: []string{"10.1.1.1, 203.0.113.7, 10.0.0.2"}, expected: "203.0.113.7"},
+		{name: "header sent more than once", proxied: true, trusted: trusted, forwardedFor: []string{"198.51.100.4", "203.0.113.7, 10.0.0.2"}, expected: "203.0.113.7"},
+		{name: "ipv6", proxied: true, trusted: trusted, forwardedFor: []string{"2001:db8::1, fd00::2"}, expected: "2001:db8::1"},
+		{name: "only trusted proxies", proxied: true, trusted: trusted, forwardedFor: []string{"10.0.0.3, 10.0.0.2"}, expected: "10.0.0.3"},
+		{name: "invalid entry stops the walk", proxied: true, trusted: trusted, forwardedFor: []string{"203.0.113.7, unknown, 10.0.0.2"}, expected: "unknown"},
+		{name: "empty entries", proxied: true, forwardedFor: []string{" , "}, expected: "192.0.2.1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := &application{authTrustedProxies: test.trusted}
+			app.Config.Server.Proxied = test.proxied
+
+			request := httptest.NewRequest("GET", "/", nil)
+			request.RemoteAddr = "192.0.2.1:51234"
+			for _, value := range test.forwardedFor {
+				request.Header.Add("X-Forwarded-For", value)
+			}
+
+			if got := app.addressOfRequest(request); got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
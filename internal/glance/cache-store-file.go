@@ -0,0 +1,369 @@
+package glance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kept in the directory of the store, maps the keys to the content type of
+// what's stored under them, which the names of the files are derived from
+const fileCacheStoreIndexFileName = "index.json"
+
+// How long changes to the index are batched up for before it gets written
+const fileCacheStoreIndexSaveDelay = time.Second
+
+// The extension which entries are saved with on the filesystem
+func fileCacheStoreExtension(contentType string) string {
+	if extension, ok := imageCacheExtensions[contentType]; ok {
+		return extension
+	}
+
+	if contentType == "application/json" {
+		return "json"
+	}
+
+	return "bin"
+}
+
+// Every entry is a file named after its key and the extension of its content
+// type, so that the directory stays easy to look through. The index is only
+// a hint, files which are missing from it get added back when the store is
+// opened, and the ones it has which no longer exist get dropped.
+type fileCacheStore struct {
+	dir        string
+	mu         sync.RWMutex
+	types      map[string]string
+	saveMu     sync.Mutex
+	saveQueued bool
+}
+
+var (
+	fileCacheStoresMu sync.Mutex
+	fileCacheStores   = make(map[string]*fileCacheStore)
+)
+
+// Config reloads reuse the store of a directory rather than going through
+// its files again
+func openFileCacheStore(dir string) *fileCacheStore {
+	fileCacheStoresMu.Lock()
+	defer fileCacheStoresMu.Unlock()
+
+	if store, exists := fileCacheStores[dir]; exists {
+		return store
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		slog.Error("Failed to create cache directory", "dir", dir, "error", err)
+	}
+
+	store := &fileCacheStore{dir: dir, types: make(map[string]string)}
+	store.loadIndex()
+	store.reconcile()
+
+	fileCacheStores[dir] = store
+	return store
+}
+
+func (s *fileCacheStore) fileName(key, contentType string) string {
+	return key + "." + fileCacheStoreExtension(contentType)
+}
+
+func (s *fileCacheStore) get(key string) ([]byte, cacheEntry, error) {
+	entry, err := s.stat(key)
+	if err != nil {
+		return nil, entry, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, s.fileName(key, entry.contentType)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, entry, errCacheEntryNotFound
+		}
+		return nil, entry, err
+	}
+
+	entry.size = int64(len(data))
+	return data, entry, nil
+}
+
+func (s *fileCacheStore) stat(key string) (cacheEntry, error) {
+	s.mu.RLock()
+	contentType, exists := s.types[key]
+	s.mu.RUnlock()
+
+	if !exists {
+		return cacheEntry{}, errCacheEntryNotFound
+	}
+
+	info, err := os.Stat(filepath.Join(s.dir, s.fileName(key, contentType)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cacheEntry{}, errCacheEntryNotFound
+		}
+		return cacheEntry{}, err
+	}
+
+	return cacheEntry{
+		key:         key,
+		size:        info.Size(),
+		modTime:     info.ModTime(),
+		contentType: contentType,
+	}, nil
+}
+
+func (s *fileCacheStore) put(key string, data []byte, contentType string) error {
+	if !isValidCacheKey(key) || s.fileName(key, contentType) == fileCacheStoreIndexFileName {
+		return fmt.Errorf("invalid cache key %q", key)
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("creating directory: %v", err)
+	}
+
+	path := filepath.Join(s.dir, s.fileName(key, contentType))
+
+	// written to a temporary file first so that partially written files
+	// never get read
+	tempPath := filepath.Join(s.dir, key+".tmp")
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("writing file: %v", err)
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("replacing file: %v", err)
+	}
+
+	s.mu.Lock()
+	previous, existed := s.types[key]
+	s.types[key] = contentType
+	s.mu.Unlock()
+
+	if existed && previous != contentType {
+		os.Remove(filepath.Join(s.dir, s.fileName(key, previous)))
+	}
+
+	if !existed || previous != contentType {
+		s.queueIndexSave()
+	}
+
+	return nil
+}
+
+func (s *fileCacheStore) remove(key string) error {
+	s.mu.Lock()
+	contentType, exists := s.types[key]
+	delete(s.types, key)
+	s.mu.Unlock()
+
+	if !exists {
+		return nil
+	}
+
+	s.queueIndexSave()
+
+	err := os.Remove(filepath.Join(s.dir, s.fileName(key, contentType)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *fileCacheStore) list() ([]cacheEntry, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make([]cacheEntry, 0, len(s.types))
+
+	for _, file := range files {
+		key, extension, _ := strings.Cut(file.Name(), ".")
+		contentType, exists := s.types[key]
+		if !exists || file.IsDir() || fileCacheStoreExtension(contentType) != extension {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, cacheEntry{
+			key:         key,
+			size:        info.Size(),
+			modTime:     info.ModTime(),
+			contentType: contentType,
+		})
+	}
+
+	return entries, nil
+}
+
+func (s *fileCacheStore) loadIndex() {
+	data, err := os.ReadFile(filepath.Join(s.dir, fileCacheStoreIndexFileName))
+	if err != nil {
+		return
+	}
+
+	types := make(map[string]string)
+	if err := json.Unmarshal(data, &types); err != nil {
+		slog.Warn("Ignoring invalid cache index", "dir", s.dir, "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	s.types = types
+	s.mu.Unlock()
+}
+
+// Changes made in quick succession, such as when the cache gets cleaned up,
+// end up being written at once
+func (s *fileCacheStore) queueIndexSave() {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	if s.saveQueued {
+		return
+	}
+
+	s.saveQueued = true
+	time.AfterFunc(fileCacheStoreIndexSaveDelay, s.saveIndex)
+}
+
+func (s *fileCacheStore) saveIndex() {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	s.saveQueued = false
+
+	s.mu.RLock()
+	data, err := json.Marshal(s.types)
+	s.mu.RUnlock()
+	if err != nil {
+		return
+	}
+
+	path := filepath.Join(s.dir, fileCacheStoreIndexFileName)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		slog.Error("Failed to write cache index", "dir", s.dir, "error", err)
+		return
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		slog.Error("Failed to write cache index", "dir", s.dir, "error", err)
+	}
+}
+
+// Brings the index in line with the files in the directory. Files which are
+// missing from it, such as images cached by versions of Glance which named
+// them after a guess made from their URL, are checked and renamed to match
+// their content, while the ones which turn out not to be images are removed.
+func (s *fileCacheStore) reconcile() {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+
+	var added, removed int
+	present := make(map[string]bool, len(files))
+
+	for _, file := range files {
+		name := file.Name()
+		key, extension, _ := strings.Cut(name, ".")
+
+		if file.IsDir() || name == fileCacheStoreIndexFileName || !isValidCacheKey(key) {
+			continue
+		}
+
+		s.mu.RLock()
+		contentType, indexed := s.types[key]
+		s.mu.RUnlock()
+
+		if indexed && fileCacheStoreExtension(contentType) == extension {
+			present[key] = true
+			continue
+		}
+
+		path := filepath.Join(s.dir, name)
+
+		switch extension {
+		case "tmp":
+			os.Remove(path)
+			continue
+		case "json":
+			contentType = "application/json"
+		default:
+			if !slices.Contains(slices.Collect(maps.Values(imageCacheExtensions)), extension) {
+				continue
+			}
+
+			// SVGs can only have been named as such after being detected already
+			contentType = detectImageContentType(readFileHead(path), ternary(extension == "svg", "image/svg+xml", ""))
+			if contentType == "" {
+				if os.Remove(path) == nil {
+					removed++
+				}
+				continue
+			}
+		}
+
+		if correctName := s.fileName(key, contentType); correctName != name {
+			if err := os.Rename(path, filepath.Join(s.dir, correctName)); err != nil {
+				continue
+			}
+		}
+
+		s.mu.Lock()
+		s.types[key] = contentType
+		s.mu.Unlock()
+
+		present[key] = true
+		added++
+	}
+
+	s.mu.Lock()
+	for key := range s.types {
+		if !present[key] {
+			delete(s.types, key)
+		}
+	}
+	s.mu.Unlock()
+
+	s.saveIndex()
+
+	if added > 0 || removed > 0 {
+		slog.Info("Indexed cache files", "dir", s.dir, "files_indexed", added, "non_images_removed", removed)
+	}
+}
+
+func readFileHead(path string) []byte {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var head bytes.Buffer
+	io.CopyN(&head, file, 512)
+
+	return head.Bytes()
+}
@@ -0,0 +1,346 @@
+package glance
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const redisMaxIdleConnections = 4
+
+// Just enough of the Redis protocol for storing the cache, talking to the
+// server directly saves depending on a client library
+type redisClient struct {
+	address  string
+	username string
+	password string
+	database int
+	useTLS   bool
+	idle     chan *redisConn
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// An error reply from the server, unlike other errors the connection can
+// still be used after one
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func newRedisClient(config *cacheStoreConfig) *redisClient {
+	return &redisClient{
+		address:  withDefaultPort(config.Address, "6379"),
+		username: config.Username,
+		password: config.Password,
+		database: config.Database,
+		useTLS:   config.TLS,
+		idle:     make(chan *redisConn, redisMaxIdleConnections),
+	}
+}
+
+func (c *redisClient) dial() (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: cacheStoreTimeout}
+
+	var conn net.Conn
+	var err error
+
+	if c.useTLS {
+		host, _, _ := net.SplitHostPort(c.address)
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.address, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", c.address)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &redisConn{conn: conn, reader: bufio.NewReader(conn), writer: bufio.NewWriter(conn)}
+
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+
+		if _, err := rc.do(args...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("authenticating: %w", err)
+		}
+	}
+
+	if c.database != 0 {
+		if _, err := rc.do("SELECT", strconv.Itoa(c.database)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("selecting database: %w", err)
+		}
+	}
+
+	return rc, nil
+}
+
+func (c *redisClient) do(args ...string) (any, error) {
+	var conn *redisConn
+
+	select {
+	case conn = <-c.idle:
+	default:
+		var err error
+		if conn, err = c.dial(); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := conn.do(args...)
+
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		conn.conn.Close()
+		return nil, err
+	}
+
+	select {
+	case c.idle <- conn:
+	default:
+		conn.conn.Close()
+	}
+
+	return reply, err
+}
+
+func (c *redisConn) do(args ...string) (any, error) {
+	c.conn.SetDeadline(time.Now().Add(cacheStoreTimeout))
+
+	fmt.Fprintf(c.writer, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.writer, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if err := c.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	return c.readReply()
+}
+
+// Returns strings for simple strings, errors as redisError, int64 for
+// integers, []byte for bulk strings, []any for arrays and nil for nulls
+func (c *redisConn) readReply() (any, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line)
+		}
+
+		if length < 0 {
+			return nil, nil
+		}
+
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+
+		return data[:length], nil
+	case '*':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length %q", line)
+		}
+
+		if length < 0 {
+			return nil, nil
+		}
+
+		items := make([]any, length)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				var replyErr redisError
+				if !errors.As(err, &replyErr) {
+					return nil, err
+				}
+			}
+		}
+
+		return items, nil
+	}
+
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+// Each entry is a hash with its data and what's needed to describe it without
+// having to fetch the data
+type redisCacheStore struct {
+	client *redisClient
+	prefix string
+}
+
+func newRedisCacheStore(client *redisClient, prefix string) *redisCacheStore {
+	return &redisCacheStore{client: client, prefix: prefix}
+}
+
+func (s *redisCacheStore) entryFromFields(key string, fields []any) (cacheEntry, bool) {
+	if len(fields) != 3 || fields[0] == nil {
+		return cacheEntry{}, false
+	}
+
+	size, _ := strconv.ParseInt(redisString(fields[0]), 10, 64)
+	modified, _ := strconv.ParseInt(redisString(fields[2]), 10, 64)
+
+	return cacheEntry{
+		key:         key,
+		size:        size,
+		modTime:     time.UnixMilli(modified),
+		contentType: redisString(fields[1]),
+	}, true
+}
+
+func (s *redisCacheStore) get(key string) ([]byte, cacheEntry, error) {
+	reply, err := s.client.do("HMGET", s.prefix+key, "size", "type", "modified", "data")
+	if err != nil {
+		return nil, cacheEntry{}, err
+	}
+
+	fields, _ := reply.([]any)
+	if len(fields) != 4 || fields[3] == nil {
+		return nil, cacheEntry{}, errCacheEntryNotFound
+	}
+
+	entry, ok := s.entryFromFields(key, fields[:3])
+	if !ok {
+		return nil, cacheEntry{}, errCacheEntryNotFound
+	}
+
+	data, _ := fields[3].([]byte)
+	return data, entry, nil
+}
+
+func (s *redisCacheStore) stat(key string) (cacheEntry, error) {
+	reply, err := s.client.do("HMGET", s.prefix+key, "size", "type", "modified")
+	if err != nil {
+		return cacheEntry{}, err
+	}
+
+	fields, _ := reply.([]any)
+	entry, ok := s.entryFromFields(key, fields)
+	if !ok {
+		return cacheEntry{}, errCacheEntryNotFound
+	}
+
+	return entry, nil
+}
+
+func (s *redisCacheStore) put(key string, data []byte, contentType string) error {
+	if !isValidCacheKey(key) {
+		return fmt.Errorf("invalid cache key %q", key)
+	}
+
+	_, err := s.client.do(
+		"HSET", s.prefix+key,
+		"data", string(data),
+		"size", strconv.Itoa(len(data)),
+		"type", contentType,
+		"modified", strconv.FormatInt(time.Now().UnixMilli(), 10),
+	)
+
+	return err
+}
+
+func (s *redisCacheStore) remove(key string) error {
+	_, err := s.client.do("DEL", s.prefix+key)
+	return err
+}
+
+func (s *redisCacheStore) list() ([]cacheEntry, error) {
+	var entries []cacheEntry
+	pattern := redisEscapePattern(s.prefix) + "*"
+	cursor := "0"
+
+	for {
+		reply, err := s.client.do("SCAN", cursor, "MATCH", pattern, "COUNT", "500")
+		if err != nil {
+			return nil, err
+		}
+
+		items, _ := reply.([]any)
+		if len(items) != 2 {
+			return nil, errors.New("redis: unexpected reply to SCAN")
+		}
+
+		cursor = redisString(items[0])
+		keys, _ := items[1].([]any)
+
+		for _, key := range keys {
+			key := strings.TrimPrefix(redisString(key), s.prefix)
+
+			entry, err := s.stat(key)
+			if err != nil {
+				if errors.Is(err, errCacheEntryNotFound) {
+					continue
+				}
+				return nil, err
+			}
+
+			entries = append(entries, entry)
+		}
+
+		if cursor == "0" {
+			return entries, nil
+		}
+	}
+}
+
+func redisString(value any) string {
+	switch value := value.(type) {
+	case []byte:
+		return string(value)
+	case string:
+		return value
+	case int64:
+		return strconv.FormatInt(value, 10)
+	}
+
+	return ""
+}
+
+func redisEscapePattern(value string) string {
+	var escaped strings.Builder
+
+	for _, c := range value {
+		if strings.ContainsRune(`*?[]\`, c) {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteRune(c)
+	}
+
+	return escaped.String()
+}
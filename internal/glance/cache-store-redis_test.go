@@ -0,0 +1,89 @@
+package glance
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedisReadReply(t *testing.T) {
+	tests := []struct {
+		name     string
+		reply    string
+		expected any
+		err      error
+	}{
+		{name: "simple string", reply: "+OK\r\n", expected: "OK"},
+		{name: "error", reply: "-WRONGTYPE wrong kind of value\r\n", err: redisError("WRONGTYPE wrong kind of value")},
+		{name: "integer", reply: ":-42\r\n", expected: int64(-42)},
+		{name: "bulk string", reply: "$5\r\nhe\r\no\r\n", expected: []byte("he\r\no")},
+		{name: "empty bulk string", reply: "$0\r\n\r\n", expected: []byte{}},
+		{name: "null bulk string", reply: "$-1\r\n", expected: nil},
+		{name: "null array", reply: "*-1\r\n", expected: nil},
+		{
+			name:     "nested array",
+			reply:    "*3\r\n$1\r\na\r\n*2\r\n:1\r\n$-1\r\n+b\r\n",
+			expected: []any{[]byte("a"), []any{int64(1), nil}, "b"},
+		},
+		{name: "error within an array", reply: "*2\r\n-ERR bad\r\n:1\r\n", expected: []any{nil, int64(1)}},
+		{name: "truncated bulk string", reply: "$10\r\nshort\r\n", err: io.ErrUnexpectedEOF},
+		{name: "unknown type", reply: "!oops\r\n", err: errors.New(`redis: unexpected reply "!oops"`)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := &redisConn{reader: bufio.NewReader(strings.NewReader(test.reply))}
+			reply, err := conn.readReply()
+
+			if test.err != nil {
+				if err == nil || err.Error() != test.err.Error() {
+					t.Errorf("expected the error %v, got %v", test.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(reply, test.expected) {
+				t.Errorf("expected %#v, got %#v", test.expected, reply)
+			}
+		})
+	}
+}
+
+func TestRedisCommandEncoding(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	server.SetDeadline(time.Now().Add(5 * time.Second))
+
+	received := make(chan string, 1)
+	go func() {
+		expected := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$6\r\na\r\nb c\r\n"
+		command := make([]byte, len(expected))
+		if _, err := io.ReadFull(server, command); err != nil {
+			received <- err.Error()
+			return
+		}
+
+		received <- string(command)
+		server.Write([]byte("+OK\r\n"))
+	}()
+
+	conn := &redisConn{conn: client, reader: bufio.NewReader(client), writer: bufio.NewWriter(client)}
+	reply, err := conn.do("SET", "key", "a\r\nb c")
+	if err != nil || reply != "OK" {
+		t.Errorf("expected OK, got %#v, %v", reply, err)
+	}
+
+	if command := <-received; command != "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$6\r\na\r\nb c\r\n" {
+		t.Errorf("unexpected command %q", command)
+	}
+}
@@ -0,0 +1,320 @@
+package glance
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signs its requests with AWS Signature Version 4, which MinIO and the other
+// services compatible with S3 accept as well
+type s3Client struct {
+	scheme    string
+	host      string
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	client    *http.Client
+}
+
+type s3ErrorResponse struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type s3ListResponse struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func newS3Client(config *cacheStoreConfig) *s3Client {
+	// validated when the config gets parsed
+	endpoint, _ := url.Parse(config.Endpoint)
+
+	return &s3Client{
+		scheme:    endpoint.Scheme,
+		host:      endpoint.Host,
+		bucket:    config.Bucket,
+		region:    config.Region,
+		accessKey: config.AccessKey,
+		secretKey: config.SecretKey,
+		pathStyle: config.PathStyle,
+		client: &http.Client{
+			Timeout: cacheStoreTimeout,
+			Transport: &http.Transport{
+				Proxy:             http.ProxyFromEnvironment,
+				MaxIdleConns:      10,
+				IdleConnTimeout:   30 * time.Second,
+				ForceAttemptHTTP2: true,
+			},
+		},
+	}
+}
+
+// An empty key addresses the bucket itself
+func (c *s3Client) do(method, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	host, path := c.host, "/"+key
+	if c.pathStyle {
+		path = "/" + c.bucket + path
+	} else {
+		host = c.bucket + "." + host
+	}
+
+	canonicalPath := s3EscapePath(path)
+	canonicalQuery := s3CanonicalQuery(query)
+
+	requestURL := c.scheme + "://" + host + canonicalPath
+	if canonicalQuery != "" {
+		requestURL += "?" + canonicalQuery
+	}
+
+	request, err := http.NewRequest(method, requestURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range header {
+		request.Header[name] = values
+	}
+
+	payloadHash := sha256.Sum256(body)
+	c.sign(request, canonicalPath, canonicalQuery, hex.EncodeToString(payloadHash[:]), time.Now().UTC())
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotFound && key != "" {
+		response.Body.Close()
+		return nil, errCacheEntryNotFound
+	}
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		defer response.Body.Close()
+
+		var s3Error s3ErrorResponse
+		contents, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		if xml.Unmarshal(contents, &s3Error) == nil && s3Error.Code != "" {
+			return nil, fmt.Errorf("s3: %s: %s", s3Error.Code, s3Error.Message)
+		}
+
+		return nil, fmt.Errorf("s3: unexpected status code %d", response.StatusCode)
+	}
+
+	return response, nil
+}
+
+func (c *s3Client) sign(request *http.Request, canonicalPath, canonicalQuery, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		canonicalPath,
+		canonicalQuery,
+		"host:" + request.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		"host;x-amz-content-sha256;x-amz-date",
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalRequestHash[:])
+
+	signingKey := s3HMAC([]byte("AWS4"+c.secretKey), date)
+	signingKey = s3HMAC(signingKey, c.region)
+	signingKey = s3HMAC(signingKey, "s3")
+	signingKey = s3HMAC(signingKey, "aws4_request")
+
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=%s",
+		c.accessKey, scope, hex.EncodeToString(s3HMAC(signingKey, stringToSign)),
+	))
+}
+
+func s3HMAC(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// Escapes everything apart from the characters which SigV4 leaves as they
+// are, which is stricter than what url.PathEscape does
+func s3Escape(value string, escapeSlash bool) string {
+	var escaped strings.Builder
+
+	for _, c := range []byte(value) {
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !escapeSlash) {
+			escaped.WriteByte(c)
+			continue
+		}
+
+		fmt.Fprintf(&escaped, "%%%02X", c)
+	}
+
+	return escaped.String()
+}
+
+func s3EscapePath(path string) string {
+	return s3Escape(path, false)
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// Entries are objects under the prefix, with their content type kept as the
+// Content-Type of the object
+type s3CacheStore struct {
+	client *s3Client
+	prefix string
+}
+
+func newS3CacheStore(client *s3Client, prefix string) *s3CacheStore {
+	return &s3CacheStore{client: client, prefix: prefix}
+}
+
+func (s *s3CacheStore) entryFromResponse(key string, response *http.Response) cacheEntry {
+	size, _ := strconv.ParseInt(response.Header.Get("Content-Length"), 10, 64)
+	modTime, _ := http.ParseTime(response.Header.Get("Last-Modified"))
+
+	return cacheEntry{
+		key:         key,
+		size:        size,
+		modTime:     modTime,
+		contentType: response.Header.Get("Content-Type"),
+	}
+}
+
+func (s *s3CacheStore) get(key string) ([]byte, cacheEntry, error) {
+	response, err := s.client.do(http.MethodGet, s.prefix+key, nil, nil, nil)
+	if err != nil {
+		return nil, cacheEntry{}, err
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, cacheEntry{}, err
+	}
+
+	entry := s.entryFromResponse(key, response)
+	entry.size = int64(len(data))
+
+	return data, entry, nil
+}
+
+func (s *s3CacheStore) stat(key string) (cacheEntry, error) {
+	response, err := s.client.do(http.MethodHead, s.prefix+key, nil, nil, nil)
+	if err != nil {
+		return cacheEntry{}, err
+	}
+	response.Body.Close()
+
+	return s.entryFromResponse(key, response), nil
+}
+
+func (s *s3CacheStore) put(key string, data []byte, contentType string) error {
+	if !isValidCacheKey(key) {
+		return fmt.Errorf("invalid cache key %q", key)
+	}
+
+	response, err := s.client.do(http.MethodPut, s.prefix+key, nil, data, http.Header{
+		"Content-Type": {contentType},
+	})
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	return nil
+}
+
+func (s *s3CacheStore) remove(key string) error {
+	response, err := s.client.do(http.MethodDelete, s.prefix+key, nil, nil, nil)
+	if err != nil {
+		if errors.Is(err, errCacheEntryNotFound) {
+			return nil
+		}
+		return err
+	}
+	response.Body.Close()
+
+	return nil
+}
+
+func (s *s3CacheStore) list() ([]cacheEntry, error) {
+	var entries []cacheEntry
+	query := url.Values{"list-type": {"2"}, "prefix": {s.prefix}}
+
+	for {
+		response, err := s.client.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var list s3ListResponse
+		err = xml.NewDecoder(response.Body).Decode(&list)
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3: parsing list of objects: %v", err)
+		}
+
+		for _, object := range list.Contents {
+			key := strings.TrimPrefix(object.Key, s.prefix)
+			if !isValidCacheKey(key) {
+				continue
+			}
+
+			entries = append(entries, cacheEntry{
+				key:     key,
+				size:    object.Size,
+				modTime: object.LastModified,
+			})
+		}
+
+		if !list.IsTruncated || list.NextContinuationToken == "" {
+			return entries, nil
+		}
+
+		query.Set("continuation-token", list.NextContinuationToken)
+	}
+}
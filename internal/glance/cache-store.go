@@ -0,0 +1,149 @@
+package glance
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	cacheStoreTypeFilesystem = "filesystem"
+	cacheStoreTypeRedis      = "redis"
+	cacheStoreTypeS3         = "s3"
+	cacheStoreTimeout        = 10 * time.Second
+)
+
+var errCacheEntryNotFound = errors.New("cache entry not found")
+
+type cacheEntry struct {
+	key         string
+	size        int64
+	modTime     time.Time
+	contentType string
+}
+
+// Where the image cache and the content of widgets get kept. Apart from the
+// filesystem, the stores can be shared by multiple instances of Glance, so
+// that they don't each have to download the same images and fetch the same
+// content after a restart. Keys are made up of letters, digits and dashes.
+type cacheStore interface {
+	// Returns errCacheEntryNotFound when there's nothing stored under the key
+	get(key string) ([]byte, cacheEntry, error)
+	stat(key string) (cacheEntry, error)
+	// Replaces the entry if one already exists under the key
+	put(key string, data []byte, contentType string) error
+	remove(key string) error
+	// The entries may lack their content type, depending on the store
+	list() ([]cacheEntry, error)
+}
+
+type cacheStoreConfig struct {
+	Type string `yaml:"type"`
+	// Redis
+	Address  string `yaml:"address"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Database int    `yaml:"database"`
+	TLS      bool   `yaml:"tls"`
+	// S3 and compatible services such as MinIO
+	Endpoint  string `yaml:"endpoint"`
+	Bucket    string `yaml:"bucket"`
+	Region    string `yaml:"region"`
+	AccessKey string `yaml:"access-key"`
+	SecretKey string `yaml:"secret-key"`
+	PathStyle bool   `yaml:"path-style"`
+	// Prepended to the keys, for sharing a database or bucket with other things
+	Prefix string `yaml:"prefix"`
+}
+
+func (c *cacheStoreConfig) UnmarshalYAML(node *yaml.Node) error {
+	type cacheStoreConfigAlias cacheStoreConfig
+
+	if err := node.Decode((*cacheStoreConfigAlias)(c)); err != nil {
+		return err
+	}
+
+	switch c.Type {
+	case "", cacheStoreTypeFilesystem:
+		c.Type = cacheStoreTypeFilesystem
+	case cacheStoreTypeRedis:
+		if c.Address == "" {
+			return fmt.Errorf("line %d: redis cache store needs an address", node.Line)
+		}
+	case cacheStoreTypeS3:
+		if c.Endpoint == "" || c.Bucket == "" {
+			return fmt.Errorf("line %d: s3 cache store needs an endpoint and a bucket", node.Line)
+		}
+
+		parsedURL, err := url.Parse(c.Endpoint)
+		if err != nil || parsedURL.Host == "" || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+			return fmt.Errorf("line %d: invalid s3 endpoint %q", node.Line, c.Endpoint)
+		}
+
+		if c.AccessKey == "" || c.SecretKey == "" {
+			return fmt.Errorf("line %d: s3 cache store needs an access-key and a secret-key", node.Line)
+		}
+
+		if c.Region == "" {
+			c.Region = "us-east-1"
+		}
+	default:
+		return fmt.Errorf("line %d: unsupported cache store type %q, must be one of filesystem, redis or s3", node.Line, c.Type)
+	}
+
+	return nil
+}
+
+// Returns the stores for the image cache and the content of widgets. On the
+// filesystem the content of widgets is only kept when there's a data path,
+// the returned store for it is nil otherwise, same as the one for images when
+// the image cache is disabled.
+func newCacheStores(config *config) (cacheStore, cacheStore) {
+	storeConfig := &config.CacheStore
+
+	switch storeConfig.Type {
+	case cacheStoreTypeRedis:
+		client := newRedisClient(storeConfig)
+		return newRedisCacheStore(client, storeConfig.Prefix+"images:"),
+			newRedisCacheStore(client, storeConfig.Prefix+"widgets:")
+	case cacheStoreTypeS3:
+		client := newS3Client(storeConfig)
+		return newS3CacheStore(client, storeConfig.Prefix+"images/"),
+			newS3CacheStore(client, storeConfig.Prefix+"widgets/")
+	}
+
+	var imageStore, contentStore cacheStore
+
+	if enabled := config.ImageCache.Enabled; enabled == nil || *enabled {
+		imagePath := config.ImageCache.Path
+		if imagePath == "" {
+			imagePath = defaultImageCachePath(config.Server.DataPath)
+		}
+
+		imageStore = openFileCacheStore(imagePath)
+	}
+
+	if config.Server.DataPath != "" {
+		contentStore = openFileCacheStore(filepath.Join(config.Server.DataPath, widgetContentCacheDirName))
+	}
+
+	return imageStore, contentStore
+}
+
+func isValidCacheKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,13 +1,21 @@
 package glance
 
 import (
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/shirou/gopsutil/v4/disk"
 	"github.com/shirou/gopsutil/v4/sensors"
+	"gopkg.in/yaml.v3"
 )
 
 type cliIntent uint8
@@ -22,12 +30,16 @@ const (
 	cliIntentMountpointInfo
 	cliIntentSecretMake
 	cliIntentPasswordHash
+	cliIntentHealthcheck
+	cliIntentMigrate
+	cliIntentAgent
 )
 
 type cliOptions struct {
 	intent     cliIntent
 	configPath string
 	args       []string
+	agent      *agentOptions
 }
 
 func parseCliOptions() (*cliOptions, error) {
@@ -55,6 +67,11 @@ func parseCliOptions() (*cliOptions, error) {
 		fmt.Println("  sensors:print         List all sensors")
 		fmt.Println("  mountpoint:info       Print information about a given mountpoint path")
 		fmt.Println("  diagnose              Run diagnostic checks")
+		fmt.Println("  healthcheck           Check whether the local server is healthy")
+		fmt.Println("  migrate --from <source> <file>")
+		fmt.Println("                        Convert a homepage, homer or dashy config into a Glance config")
+		fmt.Println("  agent [options]       Report the stats of this machine to the server-stats widget of")
+		fmt.Println("                        another Glance instance, run `glance agent -h` for the options")
 	}
 
 	configPath := flags.String("config", "glance.yml", "Set config path")
@@ -67,6 +84,37 @@ func parseCliOptions() (*cliOptions, error) {
 	args = flags.Args()
 	unknownCommandErr := fmt.Errorf("unknown command: %s", strings.Join(args, " "))
 
+	if len(args) > 0 && args[0] == "migrate" {
+		migrateFlags := flag.NewFlagSet("migrate", flag.ExitOnError)
+		source := migrateFlags.String("from", "", "Dashboard to migrate from ("+strings.Join(migrateSources, ", ")+")")
+		if err := migrateFlags.Parse(args[1:]); err != nil {
+			return nil, err
+		}
+
+		if *source == "" || migrateFlags.NArg() != 1 {
+			return nil, errors.New("usage: glance migrate --from <source> <file>")
+		}
+
+		return &cliOptions{
+			intent:     cliIntentMigrate,
+			configPath: *configPath,
+			args:       []string{*source, migrateFlags.Arg(0)},
+		}, nil
+	}
+
+	if len(args) > 0 && args[0] == "agent" {
+		agent, err := parseAgentOptions(args[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		return &cliOptions{
+			intent:     cliIntentAgent,
+			configPath: *configPath,
+			agent:      agent,
+		}, nil
+	}
+
 	if len(args) == 0 {
 		intent = cliIntentServe
 	} else if len(args) == 1 {
@@ -80,6 +128,8 @@ func parseCliOptions() (*cliOptions, error) {
 			intent = cliIntentDiagnose
 		} else if args[0] == "secret:make" {
 			intent = cliIntentSecretMake
+		} else if args[0] == "healthcheck" {
+			intent = cliIntentHealthcheck
 		} else {
 			return nil, unknownCommandErr
 		}
@@ -153,3 +203,65 @@ func cliMountpointInfo(requestedPath string) int {
 
 	return 0
 }
+
+func cliHealthcheck(configPath string) int {
+	host, port, scheme, basePath := "127.0.0.1", uint16(8080), "http", ""
+
+	// Only the server section is needed, avoid fully parsing the config so that
+	// the check doesn't fail because of unrelated widget configuration
+	contents, _, err := parseYAMLIncludes(configPath)
+	if err == nil {
+		contents, err = parseConfigVariables(contents)
+	}
+
+	if err == nil {
+		var partial struct {
+			Server struct {
+				Host    string     `yaml:"host"`
+				Port    uint16     `yaml:"port"`
+				BaseURL string     `yaml:"base-url"`
+				TLS     *yaml.Node `yaml:"tls"`
+			} `yaml:"server"`
+		}
+
+		if err := yaml.Unmarshal(contents, &partial); err == nil {
+			if partial.Server.Host != "" && partial.Server.Host != "0.0.0.0" && partial.Server.Host != "::" {
+				host = partial.Server.Host
+			}
+
+			if partial.Server.Port != 0 {
+				port = partial.Server.Port
+			}
+
+			if partial.Server.TLS != nil {
+				scheme = "https"
+			}
+
+			// only the path matters since the request goes straight to the server
+			if parsed, err := url.Parse(partial.Server.BaseURL); err == nil {
+				basePath = strings.TrimRight(parsed.Path, "/")
+			}
+		}
+	}
+
+	healthURL := scheme + "://" + net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(int(port))) + basePath + "/api/healthz"
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		// The certificate is for the domain rather than the address being checked
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+
+	response, err := client.Get(healthURL)
+	if err != nil {
+		fmt.Printf("Healthcheck failed: %v\n", err)
+		return 1
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		fmt.Printf("Healthcheck failed: unexpected status code %d from %s\n", response.StatusCode, healthURL)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,184 @@
+package glance
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Responses smaller than this aren't worth compressing since the gzip header
+// and footer alone take up a good chunk of what would be saved
+const compressionMinSize = 1024
+
+var gzipWriterPool = sync.Pool{
+	New: func() any {
+		writer, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return writer
+	},
+}
+
+var compressibleContentTypes = map[string]bool{
+	"application/javascript":    true,
+	"application/json":          true,
+	"application/manifest+json": true,
+	"application/xml":           true,
+	"image/svg+xml":             true,
+	"text/css":                  true,
+	"text/html":                 true,
+	"text/javascript":           true,
+	"text/plain":                true,
+	"text/xml":                  true,
+}
+
+func isCompressibleContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return compressibleContentTypes[mediaType]
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			continue
+		}
+
+		// gzip;q=0 means that it's explicitly not accepted
+		q, found := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if value, err := strconv.ParseFloat(q, 64); found && err == nil && value == 0 {
+			return false
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// Whether a response gets compressed is only decided once its headers are
+// written, so that handlers don't have to know about it. Images, which are
+// most of the bytes of a page, are already compressed and get passed through
+// as they are, as do streamed responses such as server-sent events. Only gzip
+// is supported since it's the one encoding in the standard library, Brotli is
+// left to a reverse proxy in front of Glance for those who want it.
+func withCompression(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || !acceptsGzip(r) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		writer := &compressedResponseWriter{ResponseWriter: w, request: r}
+		defer writer.close()
+
+		handler.ServeHTTP(writer, r)
+	})
+}
+
+type compressedResponseWriter struct {
+	http.ResponseWriter
+	request     *http.Request
+	gzip        *gzip.Writer
+	status      int
+	wroteHeader bool
+}
+
+// Writing the status is held off until the first write, since handlers mostly
+// write their whole response at once its size is a good enough guess of
+// whether it's worth compressing when there's no Content-Length
+func (w *compressedResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *compressedResponseWriter) writeHeader(size int) {
+	if w.wroteHeader {
+		return
+	}
+
+	w.wroteHeader = true
+	header := w.Header()
+
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	// partial content refers to ranges of the uncompressed response
+	compress := w.status == http.StatusOK &&
+		w.request.Header.Get("Range") == "" &&
+		header.Get("Content-Encoding") == "" &&
+		isCompressibleContentType(header.Get("Content-Type"))
+
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil {
+		size = length
+	}
+
+	if compress && size >= compressionMinSize {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+
+		// the bytes no longer match those the ETag was made for, a weak one
+		// still lets conditional requests through the handlers match it
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+
+		w.gzip = gzipWriterPool.Get().(*gzip.Writer)
+		w.gzip.Reset(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *compressedResponseWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(data))
+		}
+
+		w.writeHeader(len(data))
+	}
+
+	if w.gzip != nil {
+		return w.gzip.Write(data)
+	}
+
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressedResponseWriter) Flush() {
+	w.writeHeader(0)
+
+	if w.gzip != nil {
+		w.gzip.Flush()
+	}
+
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Lets http.ResponseController reach the underlying writer
+func (w *compressedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressedResponseWriter) close() {
+	// for handlers which only set a status
+	w.writeHeader(0)
+
+	if w.gzip == nil {
+		return
+	}
+
+	w.gzip.Close()
+	gzipWriterPool.Put(w.gzip)
+	w.gzip = nil
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"html/template"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
@@ -129,6 +130,316 @@ func (d *durationField) UnmarshalYAML(node *yaml.Node) error {
 	return nil
 }
 
+const (
+	timeFormatRelative = "relative"
+	timeFormatAbsolute = "absolute"
+	timeFormatBoth     = "both"
+	// Uses Go's format, the same as parseTime in the custom-api widget
+	timeFormatDefaultLayout = "2006-01-02 15:04"
+)
+
+// How the times shown by a widget get displayed, either as how long ago they
+// were, as the date and time, or as how long ago with the date and time shown
+// on hover. Either just the style or a mapping with the style and the layout.
+type timeFormatField struct {
+	Style  string `yaml:"style"`
+	Layout string `yaml:"layout"`
+}
+
+func (f *timeFormatField) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		if err := node.Decode(&f.Style); err != nil {
+			return err
+		}
+	} else {
+		type timeFormatFieldAlias timeFormatField
+		if err := node.Decode((*timeFormatFieldAlias)(f)); err != nil {
+			return err
+		}
+	}
+
+	switch f.Style {
+	case timeFormatRelative, timeFormatAbsolute, timeFormatBoth:
+	default:
+		return fmt.Errorf("line %d: invalid time format \"%s\", must be one of relative, absolute or both", node.Line, f.Style)
+	}
+
+	if f.Layout == "" {
+		f.Layout = timeFormatDefaultLayout
+	}
+
+	return nil
+}
+
+// Read by the script which fills in the times from the attributes given by
+// dynamicRelativeTimeAttrs, so that it applies to every widget
+func (f *timeFormatField) Attrs() template.HTMLAttr {
+	// left out when not set so that the widget uses the one of the group or
+	// split-column that it's in
+	if f.Style == "" {
+		return ""
+	}
+
+	return template.HTMLAttr(fmt.Sprintf(
+		`data-time-format="%s" data-time-layout="%s"`,
+		f.Style,
+		template.HTMLEscapeString(f.Layout),
+	))
+}
+
+var byteSizeFieldPattern = regexp.MustCompile(`(?i)^(\d+)\s*(b|kb|mb|gb|tb)?$`)
+
+// A size in bytes which can be specified with a unit, such as 500MB or 2GB,
+// where each unit is 1024 of the one before it
+type byteSizeField int64
+
+func (b *byteSizeField) UnmarshalYAML(node *yaml.Node) error {
+	var value string
+
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+
+	matches := byteSizeFieldPattern.FindStringSubmatch(strings.TrimSpace(value))
+
+	if len(matches) != 3 {
+		return fmt.Errorf("invalid size format: %s", value)
+	}
+
+	size, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(matches[2]) {
+	case "kb":
+		size <<= 10
+	case "mb":
+		size <<= 20
+	case "gb":
+		size <<= 30
+	case "tb":
+		size <<= 40
+	}
+
+	*b = byteSizeField(size)
+
+	return nil
+}
+
+var cronScheduleFieldMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// A standard five field cron expression, "minute hour day-of-month month
+// day-of-week", where each field accepts *, lists, ranges and steps such as
+// "*/15", "8-23" or "1,15". Evaluated in the local timezone.
+type cronScheduleField struct {
+	expression string
+	minutes    uint64
+	hours      uint64
+	days       uint64
+	months     uint64
+	weekdays   uint64
+	// when both are restricted, matching either one is enough
+	daysRestricted     bool
+	weekdaysRestricted bool
+}
+
+func (c *cronScheduleField) UnmarshalYAML(node *yaml.Node) error {
+	var value string
+
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+
+	parsed, err := parseCronSchedule(value)
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q: %v", value, err)
+	}
+
+	*c = *parsed
+
+	return nil
+}
+
+func parseCronSchedule(value string) (*cronScheduleField, error) {
+	expression := strings.TrimSpace(value)
+	if macro, ok := cronScheduleFieldMacros[expression]; ok {
+		expression = macro
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+
+	c := &cronScheduleField{expression: value}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	targets := [5]*uint64{&c.minutes, &c.hours, &c.days, &c.months, &c.weekdays}
+
+	for i := range fields {
+		bits, err := parseCronScheduleField(fields[i], bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, err
+		}
+
+		*targets[i] = bits
+	}
+
+	// both 0 and 7 are Sunday
+	if c.weekdays&(1<<7) != 0 {
+		c.weekdays |= 1
+	}
+
+	c.daysRestricted = fields[2] != "*"
+	c.weekdaysRestricted = fields[4] != "*"
+
+	if c.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("never matches")
+	}
+
+	return c, nil
+}
+
+func parseCronScheduleField(field string, low, high int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		start, end := low, high
+
+		if rangePart != "*" {
+			startPart, endPart, isRange := strings.Cut(rangePart, "-")
+
+			var err error
+			if start, err = strconv.Atoi(startPart); err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+
+			if isRange {
+				if end, err = strconv.Atoi(endPart); err != nil {
+					return 0, fmt.Errorf("invalid value in %q", part)
+				}
+			} else if !hasStep {
+				end = start
+			}
+		}
+
+		if start < low || end > high || start > end {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, low, high)
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << i
+		}
+	}
+
+	return bits, nil
+}
+
+func (c *cronScheduleField) matchesDay(t time.Time) bool {
+	dayMatches := c.days&(1<<t.Day()) != 0
+	weekdayMatches := c.weekdays&(1<<int(t.Weekday())) != 0
+
+	if c.daysRestricted && c.weekdaysRestricted {
+		return dayMatches || weekdayMatches
+	}
+
+	return dayMatches && weekdayMatches
+}
+
+const cronScheduleEveryHour = 1<<24 - 1
+
+// Returns the first time after t which matches the schedule, or the zero
+// time if there isn't one within the next few years. Works the same way as
+// cron when the clocks change, times within the hour that gets skipped run
+// once it's been skipped and the hour that gets repeated only runs schedules
+// which run every hour.
+func (c *cronScheduleField) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	// moving by wall clock can end up going backwards around the changes
+	advanceTo := func(next time.Time) time.Time {
+		if next.After(t) {
+			return next
+		}
+
+		return t.Add(time.Minute)
+	}
+
+	for t.Before(limit) {
+		if c.months&(1<<int(t.Month())) == 0 {
+			t = advanceTo(time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+
+		if !c.matchesDay(t) {
+			t = advanceTo(time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+
+		if c.matchesSkippedTime(t) {
+			return t
+		}
+
+		repeated := c.hours != cronScheduleEveryHour && isRepeatedHour(t)
+		if repeated || c.hours&(1<<t.Hour()) == 0 {
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+
+		if c.minutes&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// Whether the clocks went forward right before t, past a time which matches
+// the schedule
+func (c *cronScheduleField) matchesSkippedTime(t time.Time) bool {
+	previous := t.Add(-time.Minute)
+	if previous.Day() != t.Day() {
+		return false
+	}
+
+	for minute := previous.Hour()*60 + previous.Minute() + 1; minute < t.Hour()*60+t.Minute(); minute++ {
+		if c.hours&(1<<(minute/60)) != 0 && c.minutes&(1<<(minute%60)) != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether t is within the second occurrence of an hour after the clocks went back
+func isRepeatedHour(t time.Time) bool {
+	previous := t.Add(-time.Hour)
+	return previous.Hour() == t.Hour() && previous.Day() == t.Day()
+}
+
 type customIconField struct {
 	URL        template.URL
 	AutoInvert bool
@@ -188,10 +499,10 @@ func (i *customIconField) UnmarshalYAML(node *yaml.Node) error {
 }
 
 type proxyOptionsField struct {
-	URL           string        `yaml:"url"`
-	AllowInsecure bool          `yaml:"allow-insecure"`
-	Timeout       durationField `yaml:"timeout"`
-	client        *http.Client  `yaml:"-"`
+	URL           string         `yaml:"url"`
+	AllowInsecure bool           `yaml:"allow-insecure"`
+	Timeout       durationField  `yaml:"timeout"`
+	client        *requestClient `yaml:"-"`
 }
 
 func (p *proxyOptionsField) UnmarshalYAML(node *yaml.Node) error {
@@ -218,22 +529,125 @@ func (p *proxyOptionsField) UnmarshalYAML(node *yaml.Node) error {
 		return fmt.Errorf("parsing proxy URL: %v", err)
 	}
 
-	var timeout = defaultClientTimeout
-	if p.Timeout > 0 {
-		timeout = time.Duration(p.Timeout)
+	p.client = &requestClient{
+		Client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyURL(parsedUrl),
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: p.AllowInsecure},
+				DialContext:     dialOutbound,
+			},
+		},
+		options: &requestOptions{Timeout: p.Timeout},
 	}
 
-	p.client = &http.Client{
-		Timeout: timeout,
-		Transport: &http.Transport{
-			Proxy:           http.ProxyURL(parsedUrl),
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: p.AllowInsecure},
-		},
+	return nil
+}
+
+// Routes the requests to some hosts through a proxy, set url to "direct" to
+// skip the proxy from the environment for them instead
+type hostProxyRule struct {
+	Hosts    []string `yaml:"hosts"`
+	URL      string   `yaml:"url"`
+	proxyURL *url.URL `yaml:"-"`
+}
+
+func (r *hostProxyRule) UnmarshalYAML(node *yaml.Node) error {
+	type hostProxyRuleAlias hostProxyRule
+
+	if err := node.Decode((*hostProxyRuleAlias)(r)); err != nil {
+		return err
+	}
+
+	if len(r.Hosts) == 0 {
+		return fmt.Errorf("line %d: proxy needs at least one host", node.Line)
+	}
+
+	if r.URL == "" {
+		return fmt.Errorf("line %d: proxy url is required, use \"direct\" to not use a proxy", node.Line)
+	}
+
+	if r.URL == "direct" {
+		return nil
+	}
+
+	parsedURL, err := url.Parse(r.URL)
+	if err != nil {
+		return fmt.Errorf("line %d: parsing proxy URL: %v", node.Line, err)
+	}
+
+	switch parsedURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("line %d: unsupported proxy scheme %q", node.Line, parsedURL.Scheme)
+	}
+
+	r.proxyURL = parsedURL
+
+	return nil
+}
+
+// The DNS server used for the requests of widgets instead of the system's, one
+// of host[:port], udp://, tcp://, tls:// or a DNS-over-HTTPS URL
+type dnsServerField struct {
+	// empty when the system's resolver is used
+	network string
+	// host:port for plain DNS and DNS-over-TLS, the full URL for DNS-over-HTTPS
+	address string
+}
+
+func (d *dnsServerField) UnmarshalYAML(node *yaml.Node) error {
+	var value string
+
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	scheme, address, found := strings.Cut(value, "://")
+	if !found {
+		scheme, address = "udp", value
 	}
 
+	switch scheme {
+	case "https":
+		parsedURL, err := url.Parse(value)
+		if err != nil || parsedURL.Host == "" {
+			return fmt.Errorf("line %d: invalid DNS-over-HTTPS URL %q", node.Line, value)
+		}
+
+		address = value
+	case "udp", "tcp":
+		address = withDefaultPort(address, "53")
+	case "tls":
+		address = withDefaultPort(address, "853")
+	default:
+		return fmt.Errorf("line %d: unsupported DNS scheme %q, must be one of udp, tcp, tls or https", node.Line, scheme)
+	}
+
+	if scheme != "https" {
+		if host, _, err := net.SplitHostPort(address); err != nil || host == "" {
+			return fmt.Errorf("line %d: invalid DNS server %q", node.Line, value)
+		}
+	}
+
+	d.network = scheme
+	d.address = address
+
 	return nil
 }
 
+func withDefaultPort(address, port string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+
+	return net.JoinHostPort(strings.Trim(address, "[]"), port)
+}
+
 type queryParametersField map[string][]string
 
 func (q *queryParametersField) UnmarshalYAML(node *yaml.Node) error {
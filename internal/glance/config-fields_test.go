@@ -0,0 +1,174 @@
+package glance
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data is not available: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		schedule string
+		after    time.Time
+		expected time.Time
+	}{
+		{
+			name:     "step",
+			schedule: "*/15 * * * *",
+			after:    time.Date(2026, 10, 15, 10, 7, 30, 0, time.UTC),
+			expected: time.Date(2026, 10, 15, 10, 15, 0, 0, time.UTC),
+		},
+		{
+			name:     "matching time is skipped",
+			schedule: "*/15 * * * *",
+			after:    time.Date(2026, 10, 15, 10, 15, 0, 0, time.UTC),
+			expected: time.Date(2026, 10, 15, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekdays over a weekend",
+			schedule: "0 9,18 * * 1-5",
+			after:    time.Date(2026, 10, 16, 19, 0, 0, 0, time.UTC),
+			expected: time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "day of month or day of week, the day of week comes first",
+			schedule: "0 0 13 * 5",
+			after:    time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "day of month or day of week, the day of month comes first",
+			schedule: "0 0 13 * 5",
+			after:    time.Date(2026, 10, 9, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2026, 10, 13, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "only day of month",
+			schedule: "0 0 13 * *",
+			after:    time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2026, 10, 13, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "sunday as 7",
+			schedule: "0 12 * * 7",
+			after:    time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "yearly",
+			schedule: "@yearly",
+			after:    time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "leap day",
+			schedule: "0 0 29 2 *",
+			after:    time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "time skipped when the clocks go forward runs after they have",
+			schedule: "30 2 * * *",
+			after:    time.Date(2026, 3, 7, 23, 0, 0, 0, newYork),
+			expected: time.Date(2026, 3, 8, 3, 0, 0, 0, newYork),
+		},
+		{
+			name:     "day after the clocks go forward",
+			schedule: "30 2 * * *",
+			after:    time.Date(2026, 3, 8, 3, 0, 0, 0, newYork),
+			expected: time.Date(2026, 3, 9, 2, 30, 0, 0, newYork),
+		},
+		{
+			name:     "time repeated when the clocks go back runs the first time",
+			schedule: "30 1 * * *",
+			after:    time.Date(2026, 10, 31, 23, 0, 0, 0, newYork),
+			expected: time.Date(2026, 11, 1, 1, 30, 0, 0, newYork),
+		},
+		{
+			name:     "time repeated when the clocks go back doesn't run twice",
+			schedule: "30 1 * * *",
+			after:    time.Date(2026, 11, 1, 1, 30, 0, 0, newYork),
+			expected: time.Date(2026, 11, 2, 1, 30, 0, 0, newYork),
+		},
+		{
+			name:     "every hour also runs in the repeated hour",
+			schedule: "*/30 * * * *",
+			after:    time.Date(2026, 11, 1, 1, 45, 0, 0, newYork),
+			expected: time.Date(2026, 11, 1, 1, 45, 0, 0, newYork).Add(15 * time.Minute),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := parseCronSchedule(test.schedule)
+			if err != nil {
+				t.Fatalf("parsing %q: %v", test.schedule, err)
+			}
+
+			if got := schedule.next(test.after); !got.Equal(test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseCronScheduleErrors(t *testing.T) {
+	invalid := []string{
+		"61 * * * *",
+		"* * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"0 0 30 2 *",
+		"0 0 * 13 *",
+		"@sometimes",
+	}
+
+	for _, schedule := range invalid {
+		if _, err := parseCronSchedule(schedule); err == nil {
+			t.Errorf("expected %q to be invalid", schedule)
+		}
+	}
+}
+
+func TestDNSServerField(t *testing.T) {
+	tests := []struct {
+		value   string
+		network string
+		address string
+		fails   bool
+	}{
+		{value: "1.1.1.1", network: "udp", address: "1.1.1.1:53"},
+		{value: "udp://192.168.1.1:5353", network: "udp", address: "192.168.1.1:5353"},
+		{value: "tcp://[2606:4700:4700::1111]", network: "tcp", address: "[2606:4700:4700::1111]:53"},
+		{value: "tls://dns.quad9.net", network: "tls", address: "dns.quad9.net:853"},
+		{value: "https://cloudflare-dns.com/dns-query", network: "https", address: "https://cloudflare-dns.com/dns-query"},
+		{value: "", network: "", address: ""},
+		{value: "quic://dns.adguard.com", fails: true},
+		{value: "https:///dns-query", fails: true},
+		{value: "tcp://:53", fails: true},
+	}
+
+	for _, test := range tests {
+		var field dnsServerField
+		err := yaml.Unmarshal([]byte(strconv.Quote(test.value)), &field)
+
+		if test.fails {
+			if err == nil {
+				t.Errorf("expected %q to be invalid", test.value)
+			}
+			continue
+		}
+
+		if err != nil || field.network != test.network || field.address != test.address {
+			t.Errorf("expected %q to give %q %q, got %q %q, %v", test.value, test.network, test.address, field.network, field.address, err)
+		}
+	}
+}
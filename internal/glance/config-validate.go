@@ -0,0 +1,292 @@
+package glance
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	yamlUnmarshalerType = reflect.TypeFor[yaml.Unmarshaler]()
+	widgetsType         = reflect.TypeFor[widgets]()
+)
+
+type configDiagnostic struct {
+	line    int
+	message string
+}
+
+func (d configDiagnostic) String() string {
+	if d.line > 0 {
+		return fmt.Sprintf("line %d: %s", d.line, d.message)
+	}
+
+	return d.message
+}
+
+// Runs the checks which go beyond what's needed for the config to load, the
+// ones which newConfigFromYAML does are included as well
+func validateConfigContents(contents []byte) []configDiagnostic {
+	var root yaml.Node
+
+	parsed, err := parseConfigVariables(contents)
+	if err == nil {
+		err = yaml.Unmarshal(parsed, &root)
+	}
+
+	if err == nil {
+		err = expandWidgetPresets(&root)
+	}
+
+	if err != nil {
+		return []configDiagnostic{{message: err.Error()}}
+	}
+
+	diagnostics := findUnknownConfigKeys(&root)
+
+	config, err := newConfigFromYAML(contents)
+	if err != nil {
+		return append(diagnostics, configDiagnostic{message: err.Error()})
+	}
+
+	return append(diagnostics, findDuplicatePageSlugs(config, &root)...)
+}
+
+// Options which don't exist get silently ignored when the config is parsed,
+// which makes a typo in the name of one easy to miss
+func findUnknownConfigKeys(root *yaml.Node) []configDiagnostic {
+	diagnostics := make([]configDiagnostic, 0)
+	checkConfigNodeKeys(root, reflect.TypeFor[config](), "", &diagnostics)
+
+	// anchors which are merged in several places get checked once for each
+	seen := make(map[configDiagnostic]bool, len(diagnostics))
+	return slices.DeleteFunc(diagnostics, func(d configDiagnostic) bool {
+		if seen[d] {
+			return true
+		}
+
+		seen[d] = true
+		return false
+	})
+}
+
+func checkConfigNodeKeys(node *yaml.Node, t reflect.Type, context string, diagnostics *[]configDiagnostic) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	if node.Kind == yaml.DocumentNode {
+		for _, child := range node.Content {
+			checkConfigNodeKeys(child, t, context, diagnostics)
+		}
+		return
+	}
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == widgetsType {
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+
+		for _, item := range node.Content {
+			widgetType := yamlMappingValue(item, "type")
+			if widgetType == nil {
+				continue
+			}
+
+			// unknown widget types get reported when the config is loaded
+			w, err := newWidget(widgetType.Value)
+			if err != nil {
+				continue
+			}
+
+			checkConfigNodeKeys(item, reflect.TypeOf(w), widgetType.Value+" widget", diagnostics)
+		}
+		return
+	}
+
+	// fields which decode themselves can accept anything
+	if reflect.PointerTo(t).Implements(yamlUnmarshalerType) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+
+		fields, acceptsAny := yamlStructFields(t)
+		if acceptsAny {
+			return
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+
+			// merged mappings are checked as if their keys were here
+			if key.Tag == "!!merge" {
+				for _, merged := range yamlMergedMappings(value) {
+					checkConfigNodeKeys(merged, t, context, diagnostics)
+				}
+				continue
+			}
+
+			// a conventional place to put anchors which get merged elsewhere
+			if key.Value == "define" {
+				continue
+			}
+
+			fieldType, exists := fields[key.Value]
+			if !exists {
+				message := fmt.Sprintf("unknown option %q", key.Value)
+				if context != "" {
+					message += " in " + context
+				}
+
+				*diagnostics = append(*diagnostics, configDiagnostic{line: key.Line, message: message})
+				continue
+			}
+
+			// widgets keep being the context of their nested options
+			childContext := ternary(strings.HasSuffix(context, " widget"), context, key.Value)
+			checkConfigNodeKeys(value, fieldType, childContext, diagnostics)
+		}
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+
+		for _, item := range node.Content {
+			checkConfigNodeKeys(item, t.Elem(), context, diagnostics)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+
+		for i := 1; i < len(node.Content); i += 2 {
+			checkConfigNodeKeys(node.Content[i], t.Elem(), context, diagnostics)
+		}
+	}
+}
+
+// Returns the keys of a struct the way that yaml.v3 names them, the bool is
+// true when an inlined map makes it accept any key
+func yamlStructFields(t reflect.Type) (map[string]reflect.Type, bool) {
+	fields := make(map[string]reflect.Type)
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+
+		if slices.Contains(strings.Split(options, ","), "inline") {
+			fieldType := field.Type
+			for fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+
+			if fieldType.Kind() != reflect.Struct {
+				return nil, true
+			}
+
+			inlined, acceptsAny := yamlStructFields(fieldType)
+			if acceptsAny {
+				return nil, true
+			}
+
+			for key, value := range inlined {
+				fields[key] = value
+			}
+			continue
+		}
+
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+
+		fields[ternary(name == "", strings.ToLower(field.Name), name)] = field.Type
+	}
+
+	return fields, false
+}
+
+func yamlMappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Tag != "!!merge" {
+			continue
+		}
+
+		for _, merged := range yamlMergedMappings(node.Content[i+1]) {
+			if value := yamlMappingValue(merged, key); value != nil {
+				return value
+			}
+		}
+	}
+
+	return nil
+}
+
+// The value of a merge key is either a single alias or a list of them
+func yamlMergedMappings(node *yaml.Node) []*yaml.Node {
+	if node.Kind == yaml.SequenceNode {
+		return node.Content
+	}
+
+	return []*yaml.Node{node}
+}
+
+// Pages with the same slug are otherwise loaded without any complaints, with
+// all but the last one of them being impossible to open
+func findDuplicatePageSlugs(config *config, root *yaml.Node) []configDiagnostic {
+	var pageNodes []*yaml.Node
+	if len(root.Content) > 0 {
+		if pages := yamlMappingValue(root.Content[0], "pages"); pages != nil && pages.Kind == yaml.SequenceNode {
+			pageNodes = pages.Content
+		}
+	}
+
+	diagnostics := make([]configDiagnostic, 0)
+	seen := make(map[string]int, len(config.Pages))
+
+	for i := range config.Pages {
+		page := &config.Pages[i]
+		slug := ternary(page.Slug == "", titleToSlug(page.Title), page.Slug)
+		line := 0
+		if i < len(pageNodes) {
+			line = pageNodes[i].Line
+		}
+
+		if first, exists := seen[slug]; exists {
+			diagnostics = append(diagnostics, configDiagnostic{
+				line:    line,
+				message: fmt.Sprintf("page %d has the same slug %q as page %d", i+1, slug, first+1),
+			})
+			continue
+		}
+
+		seen[slug] = i
+	}
+
+	return diagnostics
+}
@@ -8,9 +8,11 @@ import (
 	"iter"
 	"log"
 	"maps"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -25,6 +27,7 @@ const (
 	configVarTypeEnv         = "env"
 	configVarTypeSecret      = "secret"
 	configVarTypeFileFromEnv = "readFileFromEnv"
+	configVarTypeFile        = "file"
 )
 
 type config struct {
@@ -34,23 +37,43 @@ type config struct {
 		Proxied    bool   `yaml:"proxied"`
 		AssetsPath string `yaml:"assets-path"`
 		BaseURL    string `yaml:"base-url"`
+		DataPath   string `yaml:"data-path"`
+		// The path of the base-url, used when it's a full URL
+		basePath string `yaml:"-"`
+		// Used for the requests made by widgets instead of the system's DNS
+		DNS dnsServerField `yaml:"dns"`
+		// Commands which the shell-command widget is allowed to run, widgets
+		// with any other command fail to load
+		AllowedCommands []string   `yaml:"allowed-commands"`
+		TLS             *tlsConfig `yaml:"tls"`
 	} `yaml:"server"`
 
 	Auth struct {
-		SecretKey string           `yaml:"secret-key"`
-		Users     map[string]*user `yaml:"users"`
+		SecretKey      string           `yaml:"secret-key"`
+		Users          map[string]*user `yaml:"users"`
+		TrustedHeader  string           `yaml:"trusted-header"`
+		TrustedProxies []string         `yaml:"trusted-proxies"`
 	} `yaml:"auth"`
 
+	LayoutEditing struct {
+		Enabled bool `yaml:"enabled"`
+		// Everyone who can log in can edit the layout when empty
+		Users []string `yaml:"users"`
+	} `yaml:"layout-editing"`
+
 	Document struct {
 		Head template.HTML `yaml:"head"`
 	} `yaml:"document"`
 
+	Language string `yaml:"language"`
+
 	Theme struct {
 		themeProperties `yaml:",inline"`
 		CustomCSSFile   string `yaml:"custom-css-file"`
 
 		DisablePicker bool                                     `yaml:"disable-picker"`
 		Presets       orderedYAMLMap[string, *themeProperties] `yaml:"presets"`
+		Auto          themeAutoField                           `yaml:"auto"`
 	} `yaml:"theme"`
 
 	Branding struct {
@@ -65,6 +88,42 @@ type config struct {
 		AppBackgroundColor string        `yaml:"app-background-color"`
 	} `yaml:"branding"`
 
+	Metrics struct {
+		Enabled bool   `yaml:"enabled"`
+		Token   string `yaml:"token"`
+	} `yaml:"metrics"`
+
+	ContentSearch struct {
+		Enabled bool `yaml:"enabled"`
+		Limit   int  `yaml:"limit"`
+	} `yaml:"content-search"`
+
+	ImageCache struct {
+		Enabled         *bool         `yaml:"enabled"`
+		Path            string        `yaml:"path"`
+		Duration        durationField `yaml:"duration"`
+		MaxSize         byteSizeField `yaml:"max-size"`
+		CleanupInterval durationField `yaml:"cleanup-interval"`
+		Resize          bool          `yaml:"resize"`
+	} `yaml:"image-cache"`
+
+	CacheStore cacheStoreConfig `yaml:"cache-store"`
+
+	ImageProxy struct {
+		Rules []imageProxyRule `yaml:"rules"`
+	} `yaml:"image-proxy"`
+
+	Proxies []hostProxyRule `yaml:"proxies"`
+
+	RateLimits rateLimitsConfig `yaml:"rate-limits"`
+
+	Requests requestOptions `yaml:"requests"`
+
+	Notifications []notificationTarget `yaml:"notifications"`
+
+	// Only used by expandWidgetPresets before the rest of the config gets decoded
+	WidgetPresets map[string]any `yaml:"widget-presets"`
+
 	Pages []page `yaml:"pages"`
 }
 
@@ -75,6 +134,8 @@ type user struct {
 }
 
 type page struct {
+	accessRules `yaml:",inline"`
+
 	Title                  string  `yaml:"name"`
 	Slug                   string  `yaml:"slug"`
 	Width                  string  `yaml:"width"`
@@ -82,13 +143,27 @@ type page struct {
 	ShowMobileHeader       bool    `yaml:"show-mobile-header"`
 	HideDesktopNavigation  bool    `yaml:"hide-desktop-navigation"`
 	CenterVertically       bool    `yaml:"center-vertically"`
+	Theme                  string  `yaml:"theme"`
 	HeadWidgets            widgets `yaml:"head-widgets"`
 	Columns                []struct {
 		Size    string  `yaml:"size"`
 		Widgets widgets `yaml:"widgets"`
+		Mobile  struct {
+			// Where the column goes when columns are stacked, defaults to its position
+			Order *int `yaml:"order"`
+		} `yaml:"mobile"`
 	} `yaml:"columns"`
-	PrimaryColumnIndex int8       `yaml:"-"`
-	mu                 sync.Mutex `yaml:"-"`
+	Mobile struct {
+		StackColumns bool `yaml:"stack-columns"`
+		Swipe        bool `yaml:"swipe"`
+		ScrollGrids  bool `yaml:"scroll-grids"`
+	} `yaml:"mobile"`
+	PrimaryColumnIndex int8             `yaml:"-"`
+	ThemeProperties    *themeProperties `yaml:"-"`
+	// The widgets of each column in the order they're configured in, before
+	// any layout saved from the browser gets applied
+	configLayout []widgets  `yaml:"-"`
+	mu           sync.Mutex `yaml:"-"`
 }
 
 func newConfigFromYAML(contents []byte) (*config, error) {
@@ -100,15 +175,29 @@ func newConfigFromYAML(contents []byte) (*config, error) {
 	config := &config{}
 	config.Server.Port = 8080
 
-	err = yaml.Unmarshal(contents, config)
-	if err != nil {
+	var root yaml.Node
+	if err = yaml.Unmarshal(contents, &root); err != nil {
 		return nil, err
 	}
 
+	if err = expandWidgetPresets(&root); err != nil {
+		return nil, err
+	}
+
+	if root.Kind != 0 {
+		if err = root.Decode(config); err != nil {
+			return nil, err
+		}
+	}
+
 	if err = isConfigStateValid(config); err != nil {
 		return nil, err
 	}
 
+	// set before the widgets get initialized since some of them render their
+	// content right away
+	configureLanguage(config.Language)
+
 	for p := range config.Pages {
 		for w := range config.Pages[p].HeadWidgets {
 			if err := config.Pages[p].HeadWidgets[w].initialize(); err != nil {
@@ -129,13 +218,14 @@ func newConfigFromYAML(contents []byte) (*config, error) {
 }
 
 var envVariableNamePattern = regexp.MustCompile(`^[A-Z0-9_]+$`)
-var configVariablePattern = regexp.MustCompile(`(^|.)\$\{(?:([a-zA-Z]+):)?([a-zA-Z0-9_-]+)\}`)
+var configVariablePattern = regexp.MustCompile(`(^|.)\$\{(?:([a-zA-Z]+):)?([a-zA-Z0-9_-]+|/[^}\s]+)\}`)
 
 // Parses variables defined in the config such as:
 // ${API_KEY} 				            - gets replaced with the value of the API_KEY environment variable
 // \${API_KEY} 					        - escaped, gets used as is without the \ in the config
 // ${secret:api_key} 			        - value gets loaded from /run/secrets/api_key
 // ${readFileFromEnv:PATH_TO_SECRET}    - value gets loaded from the file path specified in the environment variable PATH_TO_SECRET
+// ${file:/path/to/secret}              - value gets loaded from /path/to/secret
 //
 // TODO: don't match against commented out sections, not sure exactly how since
 // variables can be placed anywhere and used to modify the YAML structure itself
@@ -186,6 +276,120 @@ func parseConfigVariables(contents []byte) ([]byte, error) {
 	return replaced, nil
 }
 
+const widgetPresetsRecursionDepthLimit = 10
+
+// Widgets which set `preset: name` start off with the options of the preset by
+// that name from `widget-presets`, with the options of the widget itself taking
+// precedence. Unlike YAML anchors, presets can be defined in one included file
+// and used in another regardless of the order in which they're included
+func expandWidgetPresets(root *yaml.Node) error {
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nil
+	}
+
+	presets := make(map[string]*yaml.Node)
+	if node := yamlMappingValue(root.Content[0], "widget-presets"); node != nil {
+		if node.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %d: widget-presets must be a map of preset names to widget options", node.Line)
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			preset := node.Content[i+1]
+			if preset.Kind == yaml.AliasNode {
+				preset = preset.Alias
+			}
+
+			if preset.Kind != yaml.MappingNode {
+				return fmt.Errorf("line %d: preset %s must be a map of widget options", preset.Line, node.Content[i].Value)
+			}
+
+			presets[node.Content[i].Value] = preset
+		}
+	}
+
+	var expand func(node *yaml.Node) error
+	expand = func(node *yaml.Node) error {
+		switch node.Kind {
+		case yaml.DocumentNode, yaml.SequenceNode:
+			for _, child := range node.Content {
+				if err := expand(child); err != nil {
+					return err
+				}
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i].Value, node.Content[i+1]
+				if key == "widget-presets" {
+					continue
+				}
+
+				if (key == "widgets" || key == "head-widgets") && value.Kind == yaml.SequenceNode {
+					for _, widget := range value.Content {
+						if err := applyWidgetPreset(widget, presets, 0); err != nil {
+							return err
+						}
+					}
+				}
+
+				if err := expand(value); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	return expand(root)
+}
+
+func applyWidgetPreset(widget *yaml.Node, presets map[string]*yaml.Node, depth int) error {
+	if widget.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	presetIndex := -1
+	for i := 0; i+1 < len(widget.Content); i += 2 {
+		if widget.Content[i].Value == "preset" {
+			presetIndex = i
+			break
+		}
+	}
+
+	if presetIndex == -1 {
+		return nil
+	}
+
+	nameNode := widget.Content[presetIndex+1]
+	preset, exists := presets[nameNode.Value]
+	if !exists {
+		return fmt.Errorf("line %d: preset %q does not exist", nameNode.Line, nameNode.Value)
+	}
+
+	if depth >= widgetPresetsRecursionDepthLimit {
+		return fmt.Errorf("line %d: presets are nested too deeply, there's likely a preset which uses itself", nameNode.Line)
+	}
+
+	// presets can themselves be based on another preset
+	resolved := &yaml.Node{Kind: yaml.MappingNode, Content: append([]*yaml.Node{}, preset.Content...)}
+	if err := applyWidgetPreset(resolved, presets, depth+1); err != nil {
+		return err
+	}
+
+	content := make([]*yaml.Node, 0, len(widget.Content)+len(resolved.Content))
+	content = append(content, widget.Content[:presetIndex]...)
+	content = append(content, widget.Content[presetIndex+2:]...)
+
+	for i := 0; i+1 < len(resolved.Content); i += 2 {
+		if yamlMappingValue(&yaml.Node{Kind: yaml.MappingNode, Content: content}, resolved.Content[i].Value) == nil {
+			content = append(content, resolved.Content[i], resolved.Content[i+1])
+		}
+	}
+
+	widget.Content = content
+	return nil
+}
+
 // When the bool return value is true, it indicates that the caller should use the original value
 func parseConfigVariableOfType(variableType, variableName string) (string, bool, error) {
 	switch variableType {
@@ -201,6 +405,10 @@ func parseConfigVariableOfType(variableType, variableName string) (string, bool,
 
 		return v, false, nil
 	case configVarTypeSecret:
+		if strings.HasPrefix(variableName, "/") {
+			return "", true, nil
+		}
+
 		secretPath := filepath.Join("/run/secrets", variableName)
 		secret, err := os.ReadFile(secretPath)
 		if err != nil {
@@ -227,6 +435,17 @@ func parseConfigVariableOfType(variableType, variableName string) (string, bool,
 			return "", false, fmt.Errorf("readFileFromEnv: reading file from %s: %v", variableName, err)
 		}
 
+		return strings.TrimSpace(string(fileContents)), false, nil
+	case configVarTypeFile:
+		if !filepath.IsAbs(variableName) {
+			return "", false, fmt.Errorf("file: path %s is not absolute", variableName)
+		}
+
+		fileContents, err := os.ReadFile(variableName)
+		if err != nil {
+			return "", false, fmt.Errorf("file: %v", err)
+		}
+
 		return strings.TrimSpace(string(fileContents)), false, nil
 	default:
 		return "", true, nil
@@ -234,6 +453,10 @@ func parseConfigVariableOfType(variableType, variableName string) (string, bool,
 }
 
 func formatWidgetInitError(err error, w widget) error {
+	if line := w.base().configLine; line > 0 {
+		return fmt.Errorf("%s widget on line %d: %v", w.GetType(), line, err)
+	}
+
 	return fmt.Errorf("%s widget: %v", w.GetType(), err)
 }
 
@@ -453,6 +676,10 @@ func isConfigStateValid(config *config) error {
 		return fmt.Errorf("no pages configured")
 	}
 
+	if config.Language != "" && localeByLanguage(config.Language) == nil {
+		return fmt.Errorf("unsupported language \"%s\", must be one of %s", config.Language, strings.Join(availableLanguages(), ", "))
+	}
+
 	if len(config.Auth.Users) > 0 && config.Auth.SecretKey == "" {
 		return fmt.Errorf("secret-key must be set when users are configured")
 	}
@@ -469,7 +696,8 @@ func isConfigStateValid(config *config) error {
 		user := config.Auth.Users[username]
 
 		if user.Password == "" {
-			if user.PasswordHashString == "" {
+			// users can be left without a password when they only sign in through the proxy
+			if user.PasswordHashString == "" && config.Auth.TrustedHeader == "" {
 				return fmt.Errorf("user %s must have a password or a password-hash set", username)
 			}
 		} else if len(user.Password) < 6 {
@@ -477,6 +705,56 @@ func isConfigStateValid(config *config) error {
 		}
 	}
 
+	if config.Auth.TrustedHeader != "" {
+		if len(config.Auth.Users) == 0 {
+			return errors.New("trusted-header requires users to be configured")
+		}
+
+		if len(config.Auth.TrustedProxies) == 0 {
+			return errors.New("trusted-proxies must be set when using trusted-header")
+		}
+	}
+
+	if config.LayoutEditing.Enabled && len(config.Auth.Users) == 0 {
+		return errors.New("layout-editing requires users to be configured")
+	}
+
+	for _, username := range config.LayoutEditing.Users {
+		if _, exists := config.Auth.Users[username]; !exists {
+			return fmt.Errorf("layout-editing: user %s does not exist", username)
+		}
+	}
+
+	notificationTargets := make(map[string]bool, len(config.Notifications))
+	for i := range config.Notifications {
+		name := config.Notifications[i].Name
+		if name == "" {
+			return fmt.Errorf("notification %d has no name", i+1)
+		}
+
+		if notificationTargets[name] {
+			return fmt.Errorf("notification %d has the same name %s as a previous one", i+1, name)
+		}
+
+		notificationTargets[name] = true
+	}
+
+	if baseURL := strings.TrimRight(config.Server.BaseURL, "/"); baseURL != "" {
+		if strings.HasPrefix(baseURL, "/") {
+			config.Server.basePath = baseURL
+		} else if parsed, err := url.Parse(baseURL); err == nil && parsed.Scheme != "" && parsed.Host != "" {
+			config.Server.basePath = strings.TrimRight(parsed.Path, "/")
+		} else {
+			return fmt.Errorf("base-url must either start with / or be a full URL, got %s", config.Server.BaseURL)
+		}
+	}
+
+	if config.Server.TLS != nil && config.Server.TLS.ACME != nil {
+		if config.Server.TLS.ACME.CachePath == "" && config.Server.DataPath == "" {
+			return errors.New("acme requires either cache-path or the data-path of the server to be set")
+		}
+	}
+
 	if config.Server.AssetsPath != "" {
 		if _, err := os.Stat(config.Server.AssetsPath); os.IsNotExist(err) {
 			return fmt.Errorf("assets directory does not exist: %s", config.Server.AssetsPath)
@@ -504,6 +782,54 @@ func isConfigStateValid(config *config) error {
 			return fmt.Errorf("page %d has no columns", i+1)
 		}
 
+		if err := page.accessRules.init(config.Auth.Users); err != nil {
+			return fmt.Errorf("page %d: %v", i+1, err)
+		}
+
+		if err := initWidgetAccessRules(page, config.Auth.Users); err != nil {
+			return fmt.Errorf("page %d: %v", i+1, err)
+		}
+
+		var commandErr error
+		forEachPageWidget(page, func(widget widget) bool {
+			if shell, ok := widget.(*shellCommandWidget); ok && !slices.Contains(config.Server.AllowedCommands, shell.Command) {
+				commandErr = fmt.Errorf("page %d: the command %q must be added to allowed-commands in the server config", i+1, shell.Command)
+				return false
+			}
+
+			return true
+		})
+
+		if commandErr != nil {
+			return commandErr
+		}
+
+		var notifyErr error
+		forEachPageWidget(page, func(widget widget) bool {
+			base := widget.base()
+			if len(base.Notify) == 0 {
+				return true
+			}
+
+			if _, ok := widget.(notifyingWidget); !ok {
+				notifyErr = fmt.Errorf("page %d: %s widget does not support notifications", i+1, base.Type)
+				return false
+			}
+
+			for _, name := range base.Notify {
+				if !notificationTargets[name] {
+					notifyErr = fmt.Errorf("page %d: %s widget uses notification %s which does not exist", i+1, base.Type, name)
+					return false
+				}
+			}
+
+			return true
+		})
+
+		if notifyErr != nil {
+			return notifyErr
+		}
+
 		if page.Width == "slim" {
 			if len(page.Columns) > 2 {
 				return fmt.Errorf("page %d is slim and cannot have more than 2 columns", i+1)
@@ -0,0 +1,210 @@
+package glance
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	contentSearchDefaultLimit  = 30
+	contentSearchMinQueryRunes = 2
+)
+
+// Widgets that want their content to be searchable from the content search
+// need to implement this, returning the items they currently have cached
+type searchableWidget interface {
+	searchItems() []contentSearchItem
+}
+
+type contentSearchItem struct {
+	Title string
+	URL   string
+}
+
+type contentSearchResult struct {
+	PageTitle   string `json:"page_title"`
+	PageSlug    string `json:"page_slug"`
+	WidgetID    uint64 `json:"widget_id"`
+	WidgetTitle string `json:"widget_title"`
+	WidgetType  string `json:"widget_type"`
+	Title       string `json:"title"`
+	URL         string `json:"url,omitempty"`
+}
+
+func (a *application) handleContentSearchRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	query := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	results := make([]contentSearchResult, 0)
+
+	if utf8.RuneCountInString(query) >= contentSearchMinQueryRunes {
+		results = a.searchContent(r, a.accessiblePages(r), query, ternary(
+			a.Config.ContentSearch.Limit > 0,
+			a.Config.ContentSearch.Limit,
+			contentSearchDefaultLimit,
+		))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// Only looks through what the widgets already have, searching never triggers an update
+func (a *application) searchContent(r *http.Request, pages []*page, query string, limit int) []contentSearchResult {
+	results := make([]contentSearchResult, 0, limit)
+
+	for _, page := range pages {
+
+		page.mu.Lock()
+		forEachPageWidget(page, func(widget widget) bool {
+			base := widget.base()
+			if !a.canAccessWidget(r, base.ID) {
+				return true
+			}
+
+			if strings.Contains(strings.ToLower(base.Title), query) {
+				results = append(results, contentSearchResult{
+					PageTitle:   page.Title,
+					PageSlug:    page.Slug,
+					WidgetID:    base.ID,
+					WidgetTitle: base.Title,
+					WidgetType:  base.Type,
+					Title:       base.Title,
+				})
+			}
+
+			searchable, ok := widget.(searchableWidget)
+			if !ok {
+				return len(results) < limit
+			}
+
+			for _, item := range searchable.searchItems() {
+				if len(results) >= limit {
+					break
+				}
+
+				if !strings.Contains(strings.ToLower(item.Title), query) {
+					continue
+				}
+
+				results = append(results, contentSearchResult{
+					PageTitle:   page.Title,
+					PageSlug:    page.Slug,
+					WidgetID:    base.ID,
+					WidgetTitle: base.Title,
+					WidgetType:  base.Type,
+					Title:       item.Title,
+					URL:         item.URL,
+				})
+			}
+
+			return len(results) < limit
+		})
+		page.mu.Unlock()
+
+		if len(results) >= limit {
+			return results[:limit]
+		}
+	}
+
+	return results
+}
+
+func (widget *bookmarksWidget) searchItems() []contentSearchItem {
+	items := make([]contentSearchItem, 0)
+
+	for g := range widget.Groups {
+		for _, link := range widget.Groups[g].Links {
+			items = append(items, contentSearchItem{Title: link.Title, URL: link.URL})
+		}
+	}
+
+	return items
+}
+
+func (widget *rssWidget) searchItems() []contentSearchItem {
+	items := make([]contentSearchItem, len(widget.Items))
+
+	for i := range widget.Items {
+		items[i] = contentSearchItem{Title: widget.Items[i].Title, URL: widget.Items[i].Link}
+	}
+
+	return items
+}
+
+func (widget *videosWidget) searchItems() []contentSearchItem {
+	items := make([]contentSearchItem, len(widget.Videos))
+
+	for i := range widget.Videos {
+		items[i] = contentSearchItem{Title: widget.Videos[i].Title, URL: widget.Videos[i].Url}
+	}
+
+	return items
+}
+
+func (widget *dockerContainersWidget) searchItems() []contentSearchItem {
+	items := make([]contentSearchItem, 0, len(widget.Containers))
+
+	var add func(containers dockerContainerList)
+	add = func(containers dockerContainerList) {
+		for i := range containers {
+			items = append(items, contentSearchItem{Title: containers[i].Name, URL: containers[i].URL})
+			add(containers[i].Children)
+		}
+	}
+	add(widget.Containers)
+
+	return items
+}
+
+func (widget *releasesWidget) searchItems() []contentSearchItem {
+	items := make([]contentSearchItem, len(widget.Releases))
+
+	for i := range widget.Releases {
+		release := &widget.Releases[i]
+		items[i] = contentSearchItem{Title: release.Name + " " + release.Version, URL: release.NotesUrl}
+	}
+
+	return items
+}
+
+func (widget *socialTimelineWidget) searchItems() []contentSearchItem {
+	items := make([]contentSearchItem, len(widget.Posts))
+
+	for i := range widget.Posts {
+		post := &widget.Posts[i]
+		text, _ := limitStringLength(post.Text, 100)
+		items[i] = contentSearchItem{Title: post.AuthorName + ": " + text, URL: post.Url}
+	}
+
+	return items
+}
+
+func forumPostsSearchItems(posts forumPostList) []contentSearchItem {
+	items := make([]contentSearchItem, len(posts))
+
+	for i := range posts {
+		items[i] = contentSearchItem{
+			Title: posts[i].Title,
+			URL:   ternary(posts[i].TargetUrl != "", posts[i].TargetUrl, posts[i].DiscussionUrl),
+		}
+	}
+
+	return items
+}
+
+func (widget *redditWidget) searchItems() []contentSearchItem {
+	return forumPostsSearchItems(widget.Posts)
+}
+
+func (widget *hackerNewsWidget) searchItems() []contentSearchItem {
+	return forumPostsSearchItems(widget.Posts)
+}
+
+func (widget *lobstersWidget) searchItems() []contentSearchItem {
+	return forumPostsSearchItems(widget.Posts)
+}
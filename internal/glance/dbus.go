@@ -0,0 +1,537 @@
+package glance
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A minimal D-Bus client which only supports what's needed to query systemd:
+// method calls with string arguments and replies with basic types
+
+const (
+	dbusMessageMethodCall   = 1
+	dbusMessageMethodReturn = 2
+	dbusMessageError        = 3
+
+	dbusFieldPath        = 1
+	dbusFieldInterface   = 2
+	dbusFieldMember      = 3
+	dbusFieldErrorName   = 4
+	dbusFieldReplySerial = 5
+	dbusFieldDestination = 6
+	dbusFieldSignature   = 8
+
+	dbusMaxMessageSize = 1 << 24
+)
+
+type dbusConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	serial uint32
+}
+
+type dbusError struct {
+	Name    string
+	Message string
+}
+
+func (e *dbusError) Error() string {
+	if e.Message == "" {
+		return e.Name
+	}
+
+	return e.Name + ": " + e.Message
+}
+
+func dialDBus(ctx context.Context, socketPath string) (*dbusConn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+	}
+
+	c := &dbusConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	if err := c.authenticate(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("authenticating: %v", err)
+	}
+
+	if _, err := c.call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello"); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("saying hello: %v", err)
+	}
+
+	return c, nil
+}
+
+func (c *dbusConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *dbusConn) authenticate() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+
+	if _, err := c.conn.Write([]byte("\x00AUTH EXTERNAL " + uid + "\r\n")); err != nil {
+		return err
+	}
+
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("server rejected authentication: %s", strings.TrimSpace(line))
+	}
+
+	_, err = c.conn.Write([]byte("BEGIN\r\n"))
+	return err
+}
+
+// Returns the values of the reply's body
+func (c *dbusConn) call(destination, path, iface, member string, args ...string) ([]any, error) {
+	c.serial++
+	serial := c.serial
+
+	body := &dbusEncoder{}
+	for _, arg := range args {
+		body.string(arg)
+	}
+
+	header := &dbusEncoder{}
+	header.bytes('l', dbusMessageMethodCall, 0, 1)
+	header.uint32(uint32(len(body.buf)))
+	header.uint32(serial)
+
+	header.array(func() {
+		header.field(dbusFieldPath, "o", path)
+		header.field(dbusFieldDestination, "s", destination)
+		header.field(dbusFieldInterface, "s", iface)
+		header.field(dbusFieldMember, "s", member)
+		if len(args) > 0 {
+			header.field(dbusFieldSignature, "g", strings.Repeat("s", len(args)))
+		}
+	})
+	header.align(8)
+
+	if _, err := c.conn.Write(append(header.buf, body.buf...)); err != nil {
+		return nil, err
+	}
+
+	for {
+		message, err := c.readMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		// signals such as NameAcquired can arrive in between
+		if message.replySerial != serial {
+			continue
+		}
+
+		if message.kind == dbusMessageError {
+			dbusErr := &dbusError{Name: message.errorName}
+			if len(message.body) > 0 {
+				dbusErr.Message, _ = message.body[0].(string)
+			}
+			return nil, dbusErr
+		}
+
+		if message.kind != dbusMessageMethodReturn {
+			return nil, fmt.Errorf("unexpected message type %d", message.kind)
+		}
+
+		return message.body, nil
+	}
+}
+
+// Returns the value of a single property
+func (c *dbusConn) getProperty(destination, path, iface, property string) (any, error) {
+	body, err := c.call(destination, path, "org.freedesktop.DBus.Properties", "Get", iface, property)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) == 0 {
+		return nil, errors.New("empty reply")
+	}
+
+	return body[0], nil
+}
+
+type dbusMessage struct {
+	kind        byte
+	replySerial uint32
+	errorName   string
+	body        []any
+}
+
+func (c *dbusConn) readMessage() (*dbusMessage, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(c.reader, fixed); err != nil {
+		return nil, err
+	}
+
+	var order binary.ByteOrder
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid endianness %q", fixed[0])
+	}
+
+	bodyLength := order.Uint32(fixed[4:8])
+	fieldsLength := order.Uint32(fixed[12:16])
+	headerLength := 16 + fieldsLength
+	headerLength += (8 - headerLength%8) % 8
+
+	if bodyLength > dbusMaxMessageSize || fieldsLength > dbusMaxMessageSize {
+		return nil, errors.New("message is too large")
+	}
+
+	rest := make([]byte, int(headerLength-16)+int(bodyLength))
+	if _, err := io.ReadFull(c.reader, rest); err != nil {
+		return nil, err
+	}
+
+	message := &dbusMessage{kind: fixed[1]}
+	header := &dbusDecoder{order: order, buf: append(fixed, rest[:headerLength-16]...), pos: 12}
+	signature := ""
+
+	fields, err := header.value("a(yv)")
+	if err != nil {
+		return nil, fmt.Errorf("decoding header: %v", err)
+	}
+
+	for _, f := range fields.([]any) {
+		field, ok := f.([]any)
+		if !ok || len(field) != 2 {
+			continue
+		}
+
+		code, _ := field[0].(byte)
+		switch code {
+		case dbusFieldReplySerial:
+			message.replySerial, _ = field[1].(uint32)
+		case dbusFieldErrorName:
+			message.errorName, _ = field[1].(string)
+		case dbusFieldSignature:
+			signature, _ = field[1].(string)
+		}
+	}
+
+	body := &dbusDecoder{order: order, buf: rest[headerLength-16:]}
+	for len(signature) > 0 {
+		single, remaining, err := splitDBusSignature(signature)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := body.value(single)
+		if err != nil {
+			return nil, fmt.Errorf("decoding body: %v", err)
+		}
+
+		message.body = append(message.body, value)
+		signature = remaining
+	}
+
+	return message, nil
+}
+
+// Messages are always sent as little endian
+type dbusEncoder struct {
+	buf []byte
+}
+
+func (e *dbusEncoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *dbusEncoder) bytes(b ...byte) {
+	e.buf = append(e.buf, b...)
+}
+
+func (e *dbusEncoder) uint32(v uint32) {
+	e.align(4)
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+func (e *dbusEncoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+func (e *dbusEncoder) signature(s string) {
+	e.buf = append(e.buf, byte(len(s)))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+// Writes an array of structs, the length doesn't include the padding before
+// the first element
+func (e *dbusEncoder) array(elements func()) {
+	e.align(4)
+	lengthPos := len(e.buf)
+	e.buf = append(e.buf, 0, 0, 0, 0)
+	e.align(8)
+	start := len(e.buf)
+	elements()
+	binary.LittleEndian.PutUint32(e.buf[lengthPos:], uint32(len(e.buf)-start))
+}
+
+func (e *dbusEncoder) field(code byte, signature string, value string) {
+	e.align(8)
+	e.bytes(code)
+	e.signature(signature)
+
+	if signature == "g" {
+		e.signature(value)
+	} else {
+		e.string(value)
+	}
+}
+
+type dbusDecoder struct {
+	order binary.ByteOrder
+	buf   []byte
+	pos   int
+}
+
+var errDBusShortBuffer = errors.New("unexpected end of message")
+
+func (d *dbusDecoder) align(n int) error {
+	for d.pos%n != 0 {
+		d.pos++
+	}
+
+	if d.pos > len(d.buf) {
+		return errDBusShortBuffer
+	}
+
+	return nil
+}
+
+func (d *dbusDecoder) next(n int) ([]byte, error) {
+	if d.pos+n > len(d.buf) {
+		return nil, errDBusShortBuffer
+	}
+
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *dbusDecoder) value(signature string) (any, error) {
+	switch signature[0] {
+	case 'y':
+		b, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'b', 'u', 'i', 'h':
+		if err := d.align(4); err != nil {
+			return nil, err
+		}
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		v := d.order.Uint32(b)
+		switch signature[0] {
+		case 'b':
+			return v != 0, nil
+		case 'i':
+			return int32(v), nil
+		}
+		return v, nil
+	case 'n', 'q':
+		if err := d.align(2); err != nil {
+			return nil, err
+		}
+		b, err := d.next(2)
+		if err != nil {
+			return nil, err
+		}
+		if signature[0] == 'n' {
+			return int16(d.order.Uint16(b)), nil
+		}
+		return d.order.Uint16(b), nil
+	case 't', 'x', 'd':
+		if err := d.align(8); err != nil {
+			return nil, err
+		}
+		b, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		if signature[0] == 'x' {
+			return int64(d.order.Uint64(b)), nil
+		}
+		// doubles aren't needed, returned as their bits
+		return d.order.Uint64(b), nil
+	case 's', 'o':
+		if err := d.align(4); err != nil {
+			return nil, err
+		}
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.next(int(d.order.Uint32(b)) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return string(s[:len(s)-1]), nil
+	case 'g':
+		b, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.next(int(b[0]) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return string(s[:len(s)-1]), nil
+	case 'v':
+		sig, err := d.value("g")
+		if err != nil {
+			return nil, err
+		}
+		if sig.(string) == "" {
+			return nil, errors.New("empty variant signature")
+		}
+		return d.value(sig.(string))
+	case 'a':
+		if err := d.align(4); err != nil {
+			return nil, err
+		}
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		length := int(d.order.Uint32(b))
+		if err := d.align(dbusAlignment(signature[1])); err != nil {
+			return nil, err
+		}
+		end := d.pos + length
+		if end > len(d.buf) {
+			return nil, errDBusShortBuffer
+		}
+		elements := make([]any, 0)
+		for d.pos < end {
+			element, err := d.value(signature[1:])
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, element)
+		}
+		return elements, nil
+	case '(', '{':
+		if err := d.align(8); err != nil {
+			return nil, err
+		}
+		inner := signature[1:]
+		fields := make([]any, 0)
+		for len(inner) > 0 && inner[0] != ')' && inner[0] != '}' {
+			single, remaining, err := splitDBusSignature(inner)
+			if err != nil {
+				return nil, err
+			}
+			field, err := d.value(single)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field)
+			inner = remaining
+		}
+		return fields, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %q", signature[0])
+}
+
+func dbusAlignment(t byte) int {
+	switch t {
+	case 'n', 'q':
+		return 2
+	case 'b', 'u', 'i', 'h', 's', 'o', 'a':
+		return 4
+	case 't', 'x', 'd', '(', '{':
+		return 8
+	}
+
+	return 1
+}
+
+// Splits off the first complete type of a signature
+func splitDBusSignature(signature string) (string, string, error) {
+	if signature == "" {
+		return "", "", errors.New("empty signature")
+	}
+
+	switch signature[0] {
+	case 'a':
+		element, rest, err := splitDBusSignature(signature[1:])
+		if err != nil {
+			return "", "", err
+		}
+		return "a" + element, rest, nil
+	case '(', '{':
+		depth := 0
+		for i := 0; i < len(signature); i++ {
+			switch signature[i] {
+			case '(', '{':
+				depth++
+			case ')', '}':
+				depth--
+				if depth == 0 {
+					return signature[:i+1], signature[i+1:], nil
+				}
+			}
+		}
+		return "", "", fmt.Errorf("unbalanced signature %q", signature)
+	}
+
+	return signature[:1], signature[1:], nil
+}
+
+// Escapes a string so that it can be used as an element of an object path,
+// the same way systemd does for the paths of units
+func dbusEscapePathElement(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+	}
+
+	return b.String()
+}
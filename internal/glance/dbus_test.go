@@ -0,0 +1,192 @@
+package glance
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitDBusSignature(t *testing.T) {
+	tests := []struct {
+		signature string
+		first     string
+		rest      string
+		fails     bool
+	}{
+		{signature: "s", first: "s", rest: ""},
+		{signature: "sv", first: "s", rest: "v"},
+		{signature: "a(yv)u", first: "a(yv)", rest: "u"},
+		{signature: "a{sv}", first: "a{sv}", rest: ""},
+		{signature: "(s(uu))s", first: "(s(uu))", rest: "s"},
+		{signature: "aas", first: "aas", rest: ""},
+		{signature: "(su", fails: true},
+		{signature: "", fails: true},
+	}
+
+	for _, test := range tests {
+		first, rest, err := splitDBusSignature(test.signature)
+		if test.fails {
+			if err == nil {
+				t.Errorf("expected %q to fail", test.signature)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", test.signature, err)
+			continue
+		}
+
+		if first != test.first || rest != test.rest {
+			t.Errorf("expected %q to split into %q and %q, got %q and %q", test.signature, test.first, test.rest, first, rest)
+		}
+	}
+}
+
+func TestDBusEscapePathElement(t *testing.T) {
+	tests := map[string]string{
+		"nginx.service":     "nginx_2eservice",
+		"systemd-journald":  "systemd_2djournald",
+		"getty@tty1":        "getty_40tty1",
+		"1password.service": "_31password_2eservice",
+	}
+
+	for input, expected := range tests {
+		if got := dbusEscapePathElement(input); got != expected {
+			t.Errorf("expected %q to be escaped as %q, got %q", input, expected, got)
+		}
+	}
+}
+
+func TestDBusDecoderValues(t *testing.T) {
+	body := &dbusEncoder{}
+	body.bytes(7)
+	body.string("hello")
+	body.uint32(42)
+	// a{su}
+	body.array(func() {
+		body.align(8)
+		body.string("a")
+		body.uint32(1)
+		body.align(8)
+		body.string("bc")
+		body.uint32(2)
+	})
+	// v containing a string
+	body.signature("s")
+	body.string("variant")
+
+	decoder := &dbusDecoder{order: binary.LittleEndian, buf: body.buf}
+	expected := []any{
+		byte(7),
+		"hello",
+		uint32(42),
+		[]any{[]any{"a", uint32(1)}, []any{"bc", uint32(2)}},
+		"variant",
+	}
+
+	signature := "ysua{su}v"
+	for i := range expected {
+		single, rest, err := splitDBusSignature(signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = rest
+
+		value, err := decoder.value(single)
+		if err != nil {
+			t.Fatalf("decoding %q: %v", single, err)
+		}
+
+		if !reflect.DeepEqual(value, expected[i]) {
+			t.Errorf("expected %q to decode to %#v, got %#v", single, expected[i], value)
+		}
+	}
+
+	truncated := &dbusDecoder{order: binary.LittleEndian, buf: body.buf[:6]}
+	truncated.value("y")
+	if _, err := truncated.value("s"); !errors.Is(err, errDBusShortBuffer) {
+		t.Errorf("expected a short buffer error, got %v", err)
+	}
+}
+
+func TestDBusCallRoundTrip(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	server.SetDeadline(time.Now().Add(5 * time.Second))
+
+	conn := &dbusConn{conn: client, reader: bufio.NewReader(client)}
+	bus := &dbusConn{conn: server, reader: bufio.NewReader(server)}
+
+	reply := func(kind byte, serial uint32, errorName string, bodySignature string, writeBody func(*dbusEncoder)) {
+		body := &dbusEncoder{}
+		if writeBody != nil {
+			writeBody(body)
+		}
+
+		header := &dbusEncoder{}
+		header.bytes('l', kind, 0, 1)
+		header.uint32(uint32(len(body.buf)))
+		header.uint32(100 + serial)
+		header.array(func() {
+			header.align(8)
+			header.bytes(dbusFieldReplySerial)
+			header.signature("u")
+			header.uint32(serial)
+			if errorName != "" {
+				header.field(dbusFieldErrorName, "s", errorName)
+			}
+			if bodySignature != "" {
+				header.field(dbusFieldSignature, "g", bodySignature)
+			}
+		})
+		header.align(8)
+
+		server.Write(append(header.buf, body.buf...))
+	}
+
+	go func() {
+		call, err := bus.readMessage()
+		if err != nil || call.kind != dbusMessageMethodCall || len(call.body) != 2 {
+			reply(dbusMessageError, 1, "test.BadCall", "", nil)
+			return
+		}
+
+		// a signal which isn't a reply to the call comes first
+		reply(4, 0, "", "s", func(e *dbusEncoder) { e.string("NameAcquired") })
+
+		reply(dbusMessageMethodReturn, 1, "", "v", func(e *dbusEncoder) {
+			e.signature("s")
+			e.string(call.body[0].(string) + "/" + call.body[1].(string))
+		})
+
+		if _, err := bus.readMessage(); err != nil {
+			return
+		}
+
+		reply(dbusMessageError, 2, "org.freedesktop.systemd1.NoSuchUnit", "s", func(e *dbusEncoder) {
+			e.string("Unit missing.service not loaded.")
+		})
+	}()
+
+	value, err := conn.getProperty("org.freedesktop.systemd1", "/org/freedesktop/systemd1/unit/nginx_2eservice", "org.freedesktop.systemd1.Unit", "ActiveState")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if value != "org.freedesktop.systemd1.Unit/ActiveState" {
+		t.Errorf("unexpected property value %#v", value)
+	}
+
+	_, err = conn.call("org.freedesktop.systemd1", "/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager", "GetUnit", "missing.service")
+	var dbusErr *dbusError
+	if !errors.As(err, &dbusErr) || dbusErr.Name != "org.freedesktop.systemd1.NoSuchUnit" || dbusErr.Message != "Unit missing.service not loaded." {
+		t.Errorf("expected a NoSuchUnit error, got %v", err)
+	}
+}
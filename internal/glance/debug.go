@@ -0,0 +1,153 @@
+package glance
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+)
+
+var debugWidgetsTemplate = mustParseTemplate("debug-widgets.html", "document.html", "footer.html")
+
+type debugWidgetInfo struct {
+	ID                 uint64
+	Type               string
+	Title              string
+	Depth              int
+	Static             bool
+	Updating           bool
+	ContentAvailable   bool
+	LastUpdated        time.Time
+	LastUpdateDuration time.Duration
+	NextUpdate         time.Time
+	Error              string
+	Notice             string
+	LastError          string
+	LastErrorAt        time.Time
+}
+
+type debugPageInfo struct {
+	Title   string
+	Slug    string
+	Widgets []debugWidgetInfo
+}
+
+type debugWidgetsTemplateData struct {
+	templateData
+	Now   time.Time
+	Pages []debugPageInfo
+}
+
+func newDebugWidgetInfo(w widget, depth int) debugWidgetInfo {
+	base := w.base()
+
+	info := debugWidgetInfo{
+		ID:                 base.ID,
+		Type:               base.Type,
+		Title:              base.Title,
+		Depth:              depth,
+		Static:             base.cacheType == cacheTypeInfinite,
+		ContentAvailable:   base.ContentAvailable,
+		LastUpdated:        base.lastUpdated,
+		LastUpdateDuration: base.lastUpdateDuration,
+		NextUpdate:         base.nextUpdate,
+		LastErrorAt:        base.lastErrorAt,
+	}
+
+	if base.Error != nil {
+		info.Error = base.Error.Error()
+	}
+
+	if base.Notice != nil {
+		info.Notice = base.Notice.Error()
+	}
+
+	if base.lastError != nil {
+		info.LastError = base.lastError.Error()
+	}
+
+	return info
+}
+
+func (i *debugWidgetInfo) UpdateDurationText() string {
+	return i.LastUpdateDuration.Round(time.Millisecond).String()
+}
+
+// Widgets only get updated when their page is requested, so a widget whose
+// cache has expired will keep showing as such until someone opens the page
+func (i *debugWidgetInfo) NextUpdateText(now time.Time) string {
+	if i.Static {
+		return "never"
+	}
+
+	if i.Updating {
+		return "now"
+	}
+
+	if i.NextUpdate.IsZero() {
+		return "on next page load"
+	}
+
+	if !i.NextUpdate.After(now) {
+		return "expired, updates on next page load"
+	}
+
+	return "in " + i.NextUpdate.Sub(now).Round(time.Second).String()
+}
+
+// Widgets which are being updated in the background can't be read until
+// they're done, so only what comes from the config is shown for them
+func collectDebugWidgetInfo(list widgets, depth int, into *[]debugWidgetInfo) {
+	for i := range list {
+		if base := list[i].base(); base.updateDone != nil {
+			*into = append(*into, debugWidgetInfo{
+				ID:       base.ID,
+				Type:     base.Type,
+				Title:    base.Title,
+				Depth:    depth,
+				Updating: true,
+			})
+			continue
+		}
+
+		*into = append(*into, newDebugWidgetInfo(list[i], depth))
+
+		if container, ok := list[i].(containerWidget); ok {
+			collectDebugWidgetInfo(container.containedWidgets(), depth+1, into)
+		}
+	}
+}
+
+func (a *application) handleDebugWidgetsRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, redirectToLogin) {
+		return
+	}
+
+	data := debugWidgetsTemplateData{
+		templateData: templateData{App: a},
+		Now:          time.Now(),
+		Pages:        make([]debugPageInfo, 0, len(a.Config.Pages)),
+	}
+	a.populateTemplateRequestData(&data.Request, r)
+
+	for _, page := range data.Request.Pages {
+		info := debugPageInfo{Title: page.Title, Slug: page.Slug}
+
+		page.mu.Lock()
+		collectDebugWidgetInfo(a.accessibleWidgets(r, page.HeadWidgets), 0, &info.Widgets)
+		for c := range page.Columns {
+			collectDebugWidgetInfo(a.accessibleWidgets(r, page.Columns[c].Widgets), 0, &info.Widgets)
+		}
+		page.mu.Unlock()
+
+		data.Pages = append(data.Pages, info)
+	}
+
+	var responseBytes bytes.Buffer
+	if err := debugWidgetsTemplate.Execute(&responseBytes, data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Write(responseBytes.Bytes())
+}
@@ -0,0 +1,37 @@
+package glance
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCollectDebugWidgetInfoSkipsUpdatingWidgets(t *testing.T) {
+	idle := &htmlWidget{}
+	idle.ID, idle.Type = 1, "html"
+	idle.Error = errors.New("failed")
+
+	child := &htmlWidget{}
+	child.ID, child.Type = 3, "html"
+
+	updating := &groupWidget{}
+	updating.ID, updating.Type, updating.Title = 2, "group", "Group"
+	updating.Widgets = widgets{child}
+	updating.updateDone = make(chan struct{})
+	// written by the update, which mustn't be read until it's done
+	updating.Error = errors.New("failed")
+
+	var info []debugWidgetInfo
+	collectDebugWidgetInfo(widgets{idle, updating}, 0, &info)
+
+	if len(info) != 2 {
+		t.Fatalf("expected the widgets within the updating one to be skipped, got %d widgets", len(info))
+	}
+
+	if info[0].Updating || info[0].Error != "failed" {
+		t.Errorf("unexpected info for the idle widget %+v", info[0])
+	}
+
+	if !info[1].Updating || info[1].Title != "Group" || info[1].Error != "" {
+		t.Errorf("unexpected info for the updating widget %+v", info[1])
+	}
+}
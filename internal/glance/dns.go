@@ -0,0 +1,189 @@
+package glance
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const dnsRequestTimeout = 5 * time.Second
+
+// Set from the dns option of the server once the application replaces the
+// previous one, nil when the system's resolver is used
+var outboundDialer atomic.Pointer[net.Dialer]
+
+func configureDNSServer(server dnsServerField) {
+	if server.network == "" {
+		outboundDialer.Store(nil)
+		return
+	}
+
+	outboundDialer.Store(&net.Dialer{
+		Resolver: &net.Resolver{
+			// the resolver only uses the Dial function when it's the Go one
+			PreferGo: true,
+			Dial:     server.dial,
+		},
+	})
+}
+
+// Used by the transports of the clients which make the requests for widgets so
+// that the hosts get resolved through the DNS server from the config
+func dialOutbound(ctx context.Context, network, address string) (net.Conn, error) {
+	if dialer := outboundDialer.Load(); dialer != nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, address)
+}
+
+// The address of the system's DNS server which the resolver asks for is
+// ignored and the configured server is used instead
+func (d dnsServerField) dial(ctx context.Context, network, _ string) (net.Conn, error) {
+	var dialer net.Dialer
+
+	switch d.network {
+	case "udp":
+		// the resolver switches to TCP for responses which don't fit in a packet
+		return dialer.DialContext(ctx, network, d.address)
+	case "tcp":
+		return dialer.DialContext(ctx, "tcp", d.address)
+	case "tls":
+		host, _, _ := net.SplitHostPort(d.address)
+		tlsDialer := tls.Dialer{NetDialer: &dialer, Config: &tls.Config{ServerName: host}}
+		return tlsDialer.DialContext(ctx, "tcp", d.address)
+	}
+
+	return &dohConn{ctx: ctx, url: d.address}, nil
+}
+
+// Goes through the proxies from the config but not through dialOutbound, since
+// the host of the DNS-over-HTTPS server can't be resolved through itself
+var dohHTTPClient = &http.Client{
+	Timeout: dnsRequestTimeout,
+	Transport: &http.Transport{
+		Proxy:               proxyForRequest,
+		MaxIdleConnsPerHost: 2,
+	},
+}
+
+// Lets the resolver talk to a DNS-over-HTTPS server. Since this isn't a
+// PacketConn, the resolver writes its queries and expects the responses the
+// same way as over TCP, prefixed with their length, and each query gets sent
+// as a request of its own once the resolver starts reading the response.
+type dohConn struct {
+	ctx      context.Context
+	url      string
+	deadline time.Time
+	query    bytes.Buffer
+	response bytes.Reader
+}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	return c.query.Write(b)
+}
+
+func (c *dohConn) Read(b []byte) (int, error) {
+	if c.response.Len() == 0 {
+		if c.query.Len() == 0 {
+			return 0, io.EOF
+		}
+
+		if err := c.exchange(); err != nil {
+			return 0, err
+		}
+	}
+
+	return c.response.Read(b)
+}
+
+func (c *dohConn) exchange() error {
+	if c.query.Len() < 2 {
+		return errors.New("incomplete DNS query")
+	}
+
+	length := int(binary.BigEndian.Uint16(c.query.Bytes()))
+	if c.query.Len() < 2+length {
+		return errors.New("incomplete DNS query")
+	}
+
+	c.query.Next(2)
+	message := c.query.Next(length)
+
+	ctx := c.ctx
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(message))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/dns-message")
+	request.Header.Set("Accept", "application/dns-message")
+
+	response, err := dohHTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d from DNS-over-HTTPS server", response.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 65535))
+	if err != nil {
+		return err
+	}
+
+	framed := make([]byte, 2+len(body))
+	binary.BigEndian.PutUint16(framed, uint16(len(body)))
+	copy(framed[2:], body)
+	c.response.Reset(framed)
+
+	return nil
+}
+
+func (c *dohConn) Close() error {
+	return nil
+}
+
+func (c *dohConn) LocalAddr() net.Addr {
+	return dohAddr("")
+}
+
+func (c *dohConn) RemoteAddr() net.Addr {
+	return dohAddr(c.url)
+}
+
+func (c *dohConn) SetDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+func (c *dohConn) SetReadDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+func (c *dohConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type dohAddr string
+
+func (a dohAddr) Network() string { return "https" }
+func (a dohAddr) String() string  { return string(a) }
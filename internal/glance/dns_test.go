@@ -0,0 +1,96 @@
+package glance
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestDNSOverHTTPSResolver(t *testing.T) {
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		var query dnsmessage.Message
+		if err := query.Unpack(body); err != nil || len(query.Questions) != 1 {
+			http.Error(w, "invalid query", http.StatusBadRequest)
+			return
+		}
+
+		question := query.Questions[0]
+		response := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionDesired: true, RecursionAvailable: true},
+			Questions: query.Questions,
+		}
+
+		if question.Name.String() == "glance.test." && question.Type == dnsmessage.TypeA {
+			response.Answers = append(response.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 10}},
+			})
+		} else if question.Name.String() != "glance.test." {
+			response.RCode = dnsmessage.RCodeNameError
+		}
+
+		packed, _ := response.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(packed)
+	}))
+	defer server.Close()
+
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial:     dnsServerField{network: "https", address: server.URL}.dial,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addresses, err := resolver.LookupHost(ctx, "glance.test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !slices.Equal(addresses, []string{"192.0.2.10"}) {
+		t.Errorf("expected 192.0.2.10, got %v", addresses)
+	}
+
+	// a query for A and one for AAAA
+	if got := requests.Load(); got < 2 {
+		t.Errorf("expected the queries to be sent to the server, got %d requests", got)
+	}
+
+	_, err = resolver.LookupHost(ctx, "missing.glance.test")
+	if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
+
+func TestDOHConnRejectsIncompleteQueries(t *testing.T) {
+	conn := &dohConn{ctx: context.Background(), url: "http://127.0.0.1:1"}
+	conn.Write([]byte{0, 10, 1, 2})
+
+	if _, err := conn.Read(make([]byte, 512)); err == nil {
+		t.Error("expected an incomplete query to fail")
+	}
+
+	empty := &dohConn{ctx: context.Background(), url: "http://127.0.0.1:1"}
+	if _, err := empty.Read(make([]byte, 512)); err != io.EOF {
+		t.Errorf("expected EOF without a query, got %v", err)
+	}
+}
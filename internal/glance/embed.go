@@ -23,8 +23,12 @@ var _staticFS embed.FS
 //go:embed templates
 var _templateFS embed.FS
 
+//go:embed locales
+var _localesFS embed.FS
+
 var staticFS, _ = fs.Sub(_staticFS, "static")
 var templateFS, _ = fs.Sub(_templateFS, "templates")
+var localesFS, _ = fs.Sub(_localesFS, "locales")
 
 func readAllFromStaticFS(path string) ([]byte, error) {
 	// For some reason fs.FS only works with forward slashes, so in case we're
@@ -80,6 +84,8 @@ func computeFSHash(files fs.FS) (string, error) {
 	return hex.EncodeToString(hash.Sum(nil))[:10], nil
 }
 
+var serviceWorkerContents, _ = readAllFromStaticFS("js/service-worker.js")
+
 var cssImportPattern = regexp.MustCompile(`(?m)^@import "(.*?)";$`)
 var cssSingleLineCommentPattern = regexp.MustCompile(`(?m)^\s*\/\*.*?\*\/$`)
 
@@ -0,0 +1,273 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// How often the widgets of pages which are open get checked for updates
+	widgetEventsCheckInterval = 10 * time.Second
+	// Widgets which change on their own, such as when receiving messages, can
+	// change many times in quick succession so their pushes get batched
+	widgetEventsChangeDelay = 500 * time.Millisecond
+	widgetEventsKeepAlive   = 30 * time.Second
+)
+
+// Pushes the re-rendered HTML of widgets to the pages that are open in a
+// browser, so that widgets which change server-side show up without having to
+// reload the page
+type widgetEvents struct {
+	mu          sync.Mutex
+	subscribers map[*page]map[chan widgetEvent]struct{}
+	// When each widget was last updated at the time its content was last sent,
+	// used for finding the widgets that have been updated since
+	pushedUpdates map[uint64]time.Time
+	changed       map[uint64]struct{}
+	changedTimer  *time.Timer
+}
+
+type widgetEvent struct {
+	ID   uint64 `json:"id"`
+	HTML string `json:"html"`
+}
+
+func newWidgetEvents() *widgetEvents {
+	return &widgetEvents{
+		subscribers:   make(map[*page]map[chan widgetEvent]struct{}),
+		pushedUpdates: make(map[uint64]time.Time),
+		changed:       make(map[uint64]struct{}),
+	}
+}
+
+func (e *widgetEvents) subscribe(page *page) chan widgetEvent {
+	events := make(chan widgetEvent, 16)
+
+	// whoever subscribes has just loaded the page, so its current content is
+	// what they're already seeing
+	page.mu.Lock()
+	e.mu.Lock()
+	forEachTopLevelPageWidget(page, func(w widget) {
+		if _, exists := e.pushedUpdates[w.GetID()]; !exists {
+			e.pushedUpdates[w.GetID()] = w.base().lastUpdated
+		}
+	})
+
+	if e.subscribers[page] == nil {
+		e.subscribers[page] = make(map[chan widgetEvent]struct{})
+	}
+	e.subscribers[page][events] = struct{}{}
+	e.mu.Unlock()
+	page.mu.Unlock()
+
+	return events
+}
+
+func (e *widgetEvents) unsubscribe(page *page, events chan widgetEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.subscribers[page], events)
+	if len(e.subscribers[page]) == 0 {
+		delete(e.subscribers, page)
+	}
+}
+
+func (e *widgetEvents) pagesWithSubscribers() []*page {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	pages := make([]*page, 0, len(e.subscribers))
+	for page := range e.subscribers {
+		pages = append(pages, page)
+	}
+
+	return pages
+}
+
+func (e *widgetEvents) send(page *page, event widgetEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for subscriber := range e.subscribers[page] {
+		// a page which can't keep up will get the widget's next update instead
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// Updates the outdated widgets of pages that are open the same way loading the
+// page would and pushes the ones which have been updated since they were last
+// pushed, regardless of what caused the update
+func (a *application) runWidgetEvents(ctx context.Context) {
+	ticker := time.NewTicker(widgetEventsCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, page := range a.events.pagesWithSubscribers() {
+			a.pushUpdatedWidgets(page)
+		}
+	}
+}
+
+func (a *application) pushUpdatedWidgets(page *page) {
+	var events []widgetEvent
+
+	// widgets which don't finish updating right away get pushed by
+	// startWidgetUpdate once they're done
+	startStaleUpdates := page.updateOutdatedWidgets(0)
+
+	page.mu.Lock()
+	startStaleUpdates()
+
+	forEachTopLevelPageWidget(page, func(w widget) {
+		if w.base().updateDone != nil {
+			return
+		}
+
+		lastUpdated := w.base().lastUpdated
+
+		a.events.mu.Lock()
+		pushed := a.events.pushedUpdates[w.GetID()]
+		a.events.pushedUpdates[w.GetID()] = lastUpdated
+		a.events.mu.Unlock()
+
+		if lastUpdated.Equal(pushed) {
+			return
+		}
+
+		events = append(events, widgetEvent{ID: w.GetID(), HTML: string(w.Render())})
+	})
+	page.mu.Unlock()
+
+	for i := range events {
+		a.events.send(page, events[i])
+	}
+}
+
+// Called by widgets which change outside of their regular updates
+func (a *application) widgetChanged(id uint64) {
+	a.events.mu.Lock()
+	defer a.events.mu.Unlock()
+
+	a.events.changed[id] = struct{}{}
+
+	if a.events.changedTimer == nil {
+		a.events.changedTimer = time.AfterFunc(widgetEventsChangeDelay, a.pushChangedWidgets)
+	}
+}
+
+func (a *application) pushChangedWidgets() {
+	a.events.mu.Lock()
+	changed := a.events.changed
+	a.events.changed = make(map[uint64]struct{})
+	a.events.changedTimer = nil
+	a.events.mu.Unlock()
+
+	for id := range changed {
+		widget, exists := a.widgetByID[id]
+		if !exists {
+			continue
+		}
+
+		page := a.widgetPage[id]
+
+		a.events.mu.Lock()
+		hasSubscribers := len(a.events.subscribers[page]) > 0
+		a.events.mu.Unlock()
+
+		if !hasSubscribers {
+			continue
+		}
+
+		page.mu.Lock()
+		base := widget.base()
+		if base.updateDone != nil {
+			// will be pushed again once the update is done
+			page.mu.Unlock()
+			continue
+		}
+
+		html := string(widget.Render())
+		a.events.mu.Lock()
+		a.events.pushedUpdates[id] = base.lastUpdated
+		a.events.mu.Unlock()
+		page.mu.Unlock()
+
+		a.events.send(page, widgetEvent{ID: id, HTML: html})
+	}
+}
+
+func (a *application) handleEventsRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	r.SetPathValue("page", r.URL.Query().Get("page"))
+	page, exists := a.pageFromRequest(r)
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	events := a.events.subscribe(page)
+	defer a.events.unsubscribe(page, events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	controller := http.NewResponseController(w)
+	controller.Flush()
+
+	keepAlive := time.NewTicker(widgetEventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event := <-events:
+			// everyone who can see the page gets the updates of its widgets
+			if !a.canAccessWidget(r, event.ID) {
+				continue
+			}
+
+			data, _ := json.Marshal(event)
+			if _, err := fmt.Fprintf(w, "event: widget\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		}
+
+		controller.Flush()
+	}
+}
+
+func forEachTopLevelPageWidget(page *page, fn func(widget)) {
+	for i := range page.HeadWidgets {
+		fn(page.HeadWidgets[i])
+	}
+
+	for c := range page.Columns {
+		for i := range page.Columns[c].Widgets {
+			fn(page.Columns[c].Widgets[i])
+		}
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"html/template"
 	"log"
 	"net/http"
+	"net/netip"
 	"path/filepath"
 	"slices"
 	"strconv"
@@ -23,7 +26,14 @@ var (
 	manifestTemplate    = mustParseTemplate("manifest.json")
 )
 
-const STATIC_ASSETS_CACHE_DURATION = 24 * time.Hour
+// The paths of static assets contain the hash of their contents, so a new
+// version of them always gets a new URL
+const STATIC_ASSETS_CACHE_DURATION = 365 * 24 * time.Hour
+
+// How long the page waits for its outdated widgets before rendering the ones
+// that are still updating as placeholders, short enough to not hold up the
+// page while avoiding placeholders flashing in for widgets which update quickly
+const pageContentUpdateWait = 750 * time.Millisecond
 
 var reservedPageSlugs = []string{"login", "logout"}
 
@@ -36,9 +46,27 @@ type application struct {
 
 	slugToPage map[string]*page
 	widgetByID map[uint64]widget
+	// The page which each widget is on, for checking whether a user can access it
+	widgetPage map[uint64]*page
+	// Only has the widgets which are restricted on top of their page
+	widgetAccessRules map[uint64]*accessRules
+
+	wakeOnLANTargets map[string]*wakeOnLANField
+	backgroundTasks  []backgroundWidget
+	// Top level widgets which have, or contain ones which have, a refresh-schedule
+	scheduledWidgets []scheduledWidget
+	store            *stateStore
+	imageCache       *ImageCache
+	events           *widgetEvents
+	// Only set when the server is configured to use TLS
+	tls *tlsServer
+
+	// The same machine can be in several widgets
+	wakeOnLANTargetWidgets map[string][]uint64
 
 	RequiresAuth           bool
 	authSecretKey          []byte
+	authTrustedProxies     []netip.Prefix
 	usernameHashToUsername map[string]string
 	authAttemptsMu         sync.Mutex
 	failedAuthAttempts     map[string]*failedAuthAttempt
@@ -51,6 +79,12 @@ func newApplication(c *config) (*application, error) {
 		Config:     *c,
 		slugToPage: make(map[string]*page),
 		widgetByID: make(map[uint64]widget),
+		widgetPage: make(map[uint64]*page),
+		events:     newWidgetEvents(),
+
+		widgetAccessRules:      make(map[uint64]*accessRules),
+		wakeOnLANTargets:       make(map[string]*wakeOnLANField),
+		wakeOnLANTargetWidgets: make(map[string][]uint64),
 	}
 	config := &app.Config
 
@@ -83,7 +117,7 @@ func newApplication(c *config) (*application, error) {
 			if user.PasswordHashString != "" {
 				user.PasswordHash = []byte(user.PasswordHashString)
 				user.PasswordHashString = ""
-			} else {
+			} else if user.Password != "" {
 				hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 				if err != nil {
 					return nil, fmt.Errorf("hashing password for user %s: %v", username, err)
@@ -97,11 +131,22 @@ func newApplication(c *config) (*application, error) {
 		app.authSecretKey = secretBytes
 	}
 
+	// also used for finding the address of the client when server.proxied is
+	// set, which doesn't need authentication to be enabled
+	for _, proxy := range config.Auth.TrustedProxies {
+		prefix, err := parseIPOrPrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("parsing trusted proxy %s: %v", proxy, err)
+		}
+		app.authTrustedProxies = append(app.authTrustedProxies, prefix)
+	}
+
 	//
 	// Init themes
 	//
 
-	if !config.Theme.DisablePicker {
+	// the automatic theme uses the built-in presets unless told otherwise
+	if !config.Theme.DisablePicker || config.Theme.Auto.Enabled {
 		themeKeys := make([]string, 0, 2)
 		themeProps := make([]*themeProperties, 0, 2)
 
@@ -126,12 +171,13 @@ func newApplication(c *config) (*application, error) {
 			return nil, fmt.Errorf("creating theme presets: %v", err)
 		}
 		config.Theme.Presets = *themePresets.Merge(&config.Theme.Presets)
+	}
 
-		for key, properties := range config.Theme.Presets.Items() {
-			properties.Key = key
-			if err := properties.init(); err != nil {
-				return nil, fmt.Errorf("initializing preset theme %s: %v", key, err)
-			}
+	// presets get used by pages with their own theme even when the picker is disabled
+	for key, properties := range config.Theme.Presets.Items() {
+		properties.Key = key
+		if err := properties.init(); err != nil {
+			return nil, fmt.Errorf("initializing preset theme %s: %v", key, err)
 		}
 	}
 
@@ -140,14 +186,70 @@ func newApplication(c *config) (*application, error) {
 		return nil, fmt.Errorf("initializing default theme: %v", err)
 	}
 
+	if config.Theme.Auto.Enabled {
+		autoTheme, err := config.Theme.Auto.init(&config.Theme.themeProperties, &config.Theme.Presets)
+		if err != nil {
+			return nil, fmt.Errorf("initializing automatic theme: %v", err)
+		}
+
+		autoPreset, _ := newOrderedYAMLMap([]string{themeAutoKey}, []*themeProperties{autoTheme})
+		config.Theme.Presets = *autoPreset.Merge(&config.Theme.Presets)
+	}
+
 	//
 	// Init pages
 	//
 
 	app.slugToPage[""] = &config.Pages[0]
 
+	store, err := openStateStore(config.Server.DataPath)
+	if err != nil {
+		return nil, fmt.Errorf("opening state store: %v", err)
+	}
+	app.store = store
+
+	config.Server.BaseURL = strings.TrimRight(config.Server.BaseURL, "/")
+
+	if config.Server.TLS != nil {
+		tlsServer, err := newTLSServer(config)
+		if err != nil {
+			return nil, fmt.Errorf("initializing TLS: %v", err)
+		}
+		app.tls = tlsServer
+	}
+
+	imageStore, contentStore := newCacheStores(config)
+	app.imageCache = newImageCacheFromConfig(config, imageStore)
+
 	providers := &widgetProviders{
 		assetResolver: app.StaticAssetPath,
+		baseURL:       config.Server.BaseURL,
+		store:         store,
+		contentCache:  contentStore,
+	}
+
+	if len(config.Notifications) > 0 {
+		providers.notificationTargets = make(map[string]*notificationTarget, len(config.Notifications))
+
+		for i := range config.Notifications {
+			target := &config.Notifications[i]
+			if err := target.init(); err != nil {
+				return nil, fmt.Errorf("initializing notification %s: %v", target.Name, err)
+			}
+
+			providers.notificationTargets[target.Name] = target
+		}
+	}
+
+	providers.ownerKeyFromRequest = app.ownerKeyFromRequest
+	providers.ownerKeyForWriting = app.ownerKeyForWriting
+	providers.widgetChanged = app.widgetChanged
+
+	if app.RequiresAuth {
+		providers.usernameFromRequest = func(r *http.Request) (string, bool) {
+			username, _, ok := app.sessionFromRequest(r)
+			return username, ok
+		}
 	}
 
 	for p := range config.Pages {
@@ -164,6 +266,30 @@ func newApplication(c *config) (*application, error) {
 
 		app.slugToPage[page.Slug] = page
 
+		page.configLayout = make([]widgets, len(page.Columns))
+		for c := range page.Columns {
+			page.configLayout[c] = page.Columns[c].Widgets
+		}
+
+		if config.LayoutEditing.Enabled {
+			if layout, exists := app.loadPageLayout(page.Slug); exists {
+				page.applyLayout(layout.Columns)
+			}
+		}
+
+		switch page.Theme {
+		case "":
+		case "default":
+			page.ThemeProperties = &config.Theme.themeProperties
+		default:
+			preset, exists := config.Theme.Presets.Get(page.Theme)
+			if !exists {
+				return nil, fmt.Errorf("page %s: theme preset \"%s\" does not exist", page.Slug, page.Theme)
+			}
+
+			page.ThemeProperties = preset
+		}
+
 		if page.Width == "default" {
 			page.Width = ""
 		}
@@ -172,10 +298,48 @@ func newApplication(c *config) (*application, error) {
 			page.DesktopNavigationWidth = page.Width
 		}
 
-		for i := range page.HeadWidgets {
-			widget := page.HeadWidgets[i]
+		forEachPageWidget(page, func(widget widget) bool {
 			app.widgetByID[widget.GetID()] = widget
-			widget.setProviders(providers)
+			app.widgetPage[widget.GetID()] = page
+
+			if capable, ok := widget.(wakeOnLANCapableWidget); ok {
+				for _, target := range capable.wakeOnLANTargets() {
+					app.wakeOnLANTargets[target.Key] = target
+					app.wakeOnLANTargetWidgets[target.Key] = append(app.wakeOnLANTargetWidgets[target.Key], widget.GetID())
+				}
+			}
+
+			if background, ok := widget.(backgroundWidget); ok {
+				app.backgroundTasks = append(app.backgroundTasks, background)
+			}
+
+			return true
+		})
+
+		forEachTopLevelPageWidget(page, func(scheduled widget) {
+			hasSchedule := !walkWidgets(widgets{scheduled}, func(widget widget) bool {
+				return widget.base().RefreshSchedule == nil
+			})
+
+			if hasSchedule {
+				app.scheduledWidgets = append(app.scheduledWidgets, scheduledWidget{page: page, widget: scheduled})
+			}
+		})
+
+		forEachTopLevelPageWidget(page, func(restricted widget) {
+			rules := &restricted.base().accessRules
+			if !rules.isRestricted() {
+				return
+			}
+
+			walkWidgets(widgets{restricted}, func(widget widget) bool {
+				app.widgetAccessRules[widget.GetID()] = rules
+				return true
+			})
+		})
+
+		for i := range page.HeadWidgets {
+			page.HeadWidgets[i].setProviders(providers)
 		}
 
 		for c := range page.Columns {
@@ -185,15 +349,22 @@ func newApplication(c *config) (*application, error) {
 				page.PrimaryColumnIndex = int8(c)
 			}
 
+			if column.Mobile.Order == nil {
+				column.Mobile.Order = new(int)
+				*column.Mobile.Order = c + 1
+			}
+
 			for w := range column.Widgets {
-				widget := column.Widgets[w]
-				app.widgetByID[widget.GetID()] = widget
-				widget.setProviders(providers)
+				column.Widgets[w].setProviders(providers)
 			}
 		}
+
+		forEachPageWidget(page, func(widget widget) bool {
+			restoreWidgetContent(widget)
+			return true
+		})
 	}
 
-	config.Server.BaseURL = strings.TrimRight(config.Server.BaseURL, "/")
 	config.Theme.CustomCSSFile = app.resolveUserDefinedAssetPath(config.Theme.CustomCSSFile)
 	config.Branding.LogoURL = app.resolveUserDefinedAssetPath(config.Branding.LogoURL)
 
@@ -230,43 +401,155 @@ func newApplication(c *config) (*application, error) {
 	return app, nil
 }
 
-func (p *page) updateOutdatedWidgets() {
+// Settings which are shared by the whole process rather than kept in the
+// application. They only get applied once the application has replaced the
+// previous one, so that a config which fails to load on a reload doesn't
+// change how the application that keeps running behaves.
+func (a *application) applyGlobalSettings() {
+	config := &a.Config
+
+	configureHostProxies(config.Proxies)
+	configureDNSServer(config.Server.DNS)
+	configureRateLimits(&config.RateLimits)
+	configureRequestDefaults(config.Requests)
+	configureImageProxy(config.Server.BaseURL, config.ImageProxy.Rules)
+	globalImageCache = a.imageCache
+}
+
+// Starts updating the widget in the background without holding the page's
+// lock, so that the page and its other widgets can be rendered in the meantime.
+// The returned channel gets closed once the widget is up to date. Until then
+// nothing else should touch the widget, it gets rendered as a placeholder.
+// Must be called with the page's lock held.
+func (p *page) startWidgetUpdate(w widget, force bool) <-chan struct{} {
+	base := w.base()
+
+	if base.updateDone != nil {
+		return base.updateDone
+	}
+
 	now := time.Now()
+	if !force && !w.requiresUpdate(&now) {
+		return closedChannel
+	}
 
-	var wg sync.WaitGroup
-	context := context.Background()
+	done := make(chan struct{})
+	base.updateDone = done
 
-	for w := range p.HeadWidgets {
-		widget := p.HeadWidgets[w]
+	go func() {
+		if force {
+			refreshWidget(context.Background(), w)
+		} else {
+			updateWidget(context.Background(), w)
+		}
 
-		if !widget.requiresUpdate(&now) {
-			continue
+		p.mu.Lock()
+		base.updateDone = nil
+		base.revalidating = false
+		p.mu.Unlock()
+
+		close(done)
+		base.notifyChanged()
+	}()
+
+	return done
+}
+
+type scheduledWidget struct {
+	page   *page
+	widget widget
+}
+
+// Widgets with a refresh-schedule get updated at the scheduled times even when
+// nobody has their page open, rather than only once it gets loaded. Pages which
+// are open get the new content pushed to them once the update is done.
+func (a *application) runScheduledUpdates(ctx context.Context) {
+	if len(a.scheduledWidgets) == 0 {
+		return
+	}
+
+	for {
+		// checked shortly after the start of every minute, which is the
+		// smallest unit that schedules have
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute + time.Second).Sub(now))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
 		}
 
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			widget.update(context)
-		}()
+		for _, scheduled := range a.scheduledWidgets {
+			scheduled.page.mu.Lock()
+			scheduled.page.startWidgetUpdate(scheduled.widget, false)
+			scheduled.page.mu.Unlock()
+		}
 	}
+}
 
-	for c := range p.Columns {
-		for w := range p.Columns[c].Widgets {
-			widget := p.Columns[c].Widgets[w]
+var closedChannel = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// Starts updating the outdated widgets of the page and waits for them for up
+// to the given duration. Widgets which can show their previous content while
+// they update only get updated after the page has been rendered, which is
+// what the returned function does. Must be called without the page's lock held.
+func (p *page) updateOutdatedWidgets(wait time.Duration) (startStaleUpdates func()) {
+	var pending []<-chan struct{}
+	var stale []widget
+
+	p.mu.Lock()
+	now := time.Now()
 
-			if !widget.requiresUpdate(&now) {
-				continue
-			}
+	forEachTopLevelPageWidget(p, func(w widget) {
+		if w.base().updateDone != nil || !w.requiresUpdate(&now) {
+			return
+		}
 
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				widget.update(context)
-			}()
+		if w.base().canServeStale(now) {
+			w.base().revalidating = true
+			stale = append(stale, w)
+			return
+		}
+
+		pending = append(pending, p.startWidgetUpdate(w, false))
+	})
+	p.mu.Unlock()
+
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+waiting:
+	for i := range pending {
+		select {
+		case <-pending[i]:
+		case <-timeout.C:
+			// the rest get rendered as placeholders and load on their own
+			break waiting
 		}
 	}
 
-	wg.Wait()
+	return func() {
+		for i := range stale {
+			p.startWidgetUpdate(stale[i], false)
+		}
+	}
+}
+
+// Widgets which are still being updated get rendered as placeholders which
+// load their content separately, so that a slow widget doesn't hold up the
+// whole page. Must be called with the page's lock held.
+func (p *page) RenderWidget(w widget) template.HTML {
+	if w.base().updateDone != nil {
+		return renderWidgetPlaceholder(w, false)
+	}
+
+	return w.Render()
 }
 
 func (a *application) resolveUserDefinedAssetPath(path string) string {
@@ -278,7 +561,22 @@ func (a *application) resolveUserDefinedAssetPath(path string) string {
 }
 
 type templateRequestData struct {
-	Theme *themeProperties
+	Theme       *themeProperties
+	Preferences *userPreferences
+	// Whether the user can rearrange the widgets of pages
+	CanEditLayout bool
+	// The pages which the user can access, in the order they're configured in
+	Pages []*page
+	// Leaves out the widgets which the user can't access
+	accessibleWidgets func(widgets) widgets
+}
+
+func (d templateRequestData) AccessibleWidgets(list widgets) widgets {
+	if d.accessibleWidgets == nil {
+		return list
+	}
+
+	return d.accessibleWidgets(list)
 }
 
 type templateData struct {
@@ -289,28 +587,44 @@ type templateData struct {
 
 func (a *application) populateTemplateRequestData(data *templateRequestData, r *http.Request) {
 	theme := &a.Config.Theme.themeProperties
+	preferences := a.preferencesFromRequest(r)
+
+	if a.Config.Theme.Auto.Enabled {
+		theme, _ = a.Config.Theme.Presets.Get(themeAutoKey)
+	}
 
 	if !a.Config.Theme.DisablePicker {
-		selectedTheme, err := r.Cookie("theme")
-		if err == nil {
-			preset, exists := a.Config.Theme.Presets.Get(selectedTheme.Value)
-			if exists {
-				theme = preset
+		// the stored preference wins over the cookie so that the theme follows the user across browsers
+		selectedTheme := preferences.Theme
+		if selectedTheme == "" {
+			if cookie, err := r.Cookie("theme"); err == nil {
+				selectedTheme = cookie.Value
 			}
 		}
+
+		preset, exists := a.Config.Theme.Presets.Get(selectedTheme)
+		if exists {
+			theme = preset
+		}
 	}
 
 	data.Theme = theme
+	data.Preferences = preferences
+	data.Pages = a.accessiblePages(r)
+	data.CanEditLayout = a.canEditLayout(r)
+	data.accessibleWidgets = func(list widgets) widgets {
+		return a.accessibleWidgets(r, list)
+	}
 }
 
 func (a *application) handlePageRequest(w http.ResponseWriter, r *http.Request) {
-	page, exists := a.slugToPage[r.PathValue("page")]
-	if !exists {
-		a.handleNotFound(w, r)
+	if a.handleUnauthorizedResponse(w, r, redirectToLogin) {
 		return
 	}
 
-	if a.handleUnauthorizedResponse(w, r, redirectToLogin) {
+	page, exists := a.pageFromRequest(r)
+	if !exists {
+		a.handleNotFound(w, r)
 		return
 	}
 
@@ -320,6 +634,10 @@ func (a *application) handlePageRequest(w http.ResponseWriter, r *http.Request)
 	}
 	a.populateTemplateRequestData(&data.Request, r)
 
+	if page.ThemeProperties != nil {
+		data.Request.Theme = page.ThemeProperties
+	}
+
 	var responseBytes bytes.Buffer
 	err := pageTemplate.Execute(&responseBytes, data)
 	if err != nil {
@@ -332,31 +650,41 @@ func (a *application) handlePageRequest(w http.ResponseWriter, r *http.Request)
 }
 
 func (a *application) handlePageContentRequest(w http.ResponseWriter, r *http.Request) {
-	page, exists := a.slugToPage[r.PathValue("page")]
-	if !exists {
-		a.handleNotFound(w, r)
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
 		return
 	}
 
-	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+	page, exists := a.pageFromRequest(r)
+	if !exists {
+		a.handleNotFound(w, r)
 		return
 	}
 
 	pageData := templateData{
 		Page: page,
+		Request: templateRequestData{
+			accessibleWidgets: func(list widgets) widgets {
+				return a.accessibleWidgets(r, list)
+			},
+		},
 	}
 
 	var err error
 	var responseBytes bytes.Buffer
 
+	started := time.Now()
+	startStaleUpdates := page.updateOutdatedWidgets(pageContentUpdateWait)
+
 	func() {
 		page.mu.Lock()
 		defer page.mu.Unlock()
 
-		page.updateOutdatedWidgets()
 		err = pageContentTemplate.Execute(&responseBytes, pageData)
+		startStaleUpdates()
 	}()
 
+	recordPageRenderMetrics(page.Slug, time.Since(started))
+
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(err.Error()))
@@ -366,6 +694,10 @@ func (a *application) handlePageContentRequest(w http.ResponseWriter, r *http.Re
 	w.Write(responseBytes.Bytes())
 }
 
+// Proxies append the address they got the request from to X-Forwarded-For,
+// so only the entries on the right can be trusted, anything to their left
+// could have been sent by the client. With a chain of proxies, the ones in
+// auth.trusted-proxies get skipped over to find the address of the client.
 func (a *application) addressOfRequest(r *http.Request) string {
 	remoteAddrWithoutPort := func() string {
 		for i := len(r.RemoteAddr) - 1; i >= 0; i-- {
@@ -381,18 +713,35 @@ func (a *application) addressOfRequest(r *http.Request) string {
 		return remoteAddrWithoutPort()
 	}
 
-	// This should probably be configurable or look for multiple headers, not just this one
-	forwardedFor := r.Header.Get("X-Forwarded-For")
-	if forwardedFor == "" {
-		return remoteAddrWithoutPort()
+	// the header can be sent more than once, which is the same as one with
+	// all of the values separated by commas
+	ips := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+
+	var address string
+	for i := len(ips) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(ips[i])
+		if ip == "" {
+			continue
+		}
+
+		address = ip
+
+		addr, err := netip.ParseAddr(strings.Trim(ip, "[]"))
+		if err != nil {
+			break
+		}
+
+		addr = addr.WithZone("").Unmap()
+		if !slices.ContainsFunc(a.authTrustedProxies, func(p netip.Prefix) bool { return p.Contains(addr) }) {
+			break
+		}
 	}
 
-	ips := strings.Split(forwardedFor, ",")
-	if len(ips) == 0 || ips[0] == "" {
+	if address == "" {
 		return remoteAddrWithoutPort()
 	}
 
-	return ips[0]
+	return address
 }
 
 func (a *application) handleNotFound(w http.ResponseWriter, _ *http.Request) {
@@ -401,27 +750,37 @@ func (a *application) handleNotFound(w http.ResponseWriter, _ *http.Request) {
 	w.Write([]byte("Page not found"))
 }
 
+// Widgets are responsible for their own locking when handling requests, the
+// page lock is only held while widgets are being updated and rendered
 func (a *application) handleWidgetRequest(w http.ResponseWriter, r *http.Request) {
-	// TODO: this requires a rework of the widget update logic so that rather
-	// than locking the entire page we lock individual widgets
-	w.WriteHeader(http.StatusNotImplemented)
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	widget, exists := a.widgetFromRequest(r)
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
 
-	// widgetValue := r.PathValue("widget")
+	widget.handleRequest(w, r)
+}
 
-	// widgetID, err := strconv.ParseUint(widgetValue, 10, 64)
-	// if err != nil {
-	// 	a.handleNotFound(w, r)
-	// 	return
-	// }
+func (a *application) handleCachedImageRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
 
-	// widget, exists := a.widgetByID[widgetID]
+	a.imageCache.serveImage(w, r, r.PathValue("name"))
+}
 
-	// if !exists {
-	// 	a.handleNotFound(w, r)
-	// 	return
-	// }
+func (a *application) handleImageCacheStatsRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
 
-	// widget.handleRequest(w, r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.imageCache.stats())
 }
 
 func (a *application) StaticAssetPath(asset string) string {
@@ -429,10 +788,42 @@ func (a *application) StaticAssetPath(asset string) string {
 }
 
 func (a *application) VersionedAssetPath(asset string) string {
-	return a.Config.Server.BaseURL + asset +
+	return a.Config.Server.BaseURL + "/" + strings.TrimPrefix(asset, "/") +
 		"?v=" + strconv.FormatInt(a.CreatedAt.Unix(), 10)
 }
 
+// Requests are accepted both with and without the base path so that it works
+// regardless of whether the reverse proxy strips it before forwarding them
+func (a *application) withBasePath(handler http.Handler) http.Handler {
+	basePath := a.Config.Server.basePath
+	if basePath == "" {
+		return handler
+	}
+
+	stripped := http.StripPrefix(basePath, handler)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, basePath+"/") {
+			stripped.ServeHTTP(w, r)
+			return
+		}
+
+		// a page could have the same slug as the base path, in which case
+		// it's assumed that the prefix was stripped
+		if _, isPage := a.slugToPage[strings.TrimPrefix(r.URL.Path, "/")]; r.URL.Path == basePath && !isPage {
+			target := basePath + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
 func (a *application) server() (func() error, func() error) {
 	mux := http.NewServeMux()
 
@@ -440,15 +831,45 @@ func (a *application) server() (func() error, func() error) {
 	mux.HandleFunc("GET /{page}", a.handlePageRequest)
 
 	mux.HandleFunc("GET /api/pages/{page}/content/{$}", a.handlePageContentRequest)
+	mux.HandleFunc("GET /api/pages/{page}/widgets/{widget}/content", a.handleWidgetContentRequest)
+
+	if a.Config.LayoutEditing.Enabled {
+		mux.HandleFunc("PUT /api/pages/{page}/layout", a.handleUpdatePageLayoutRequest)
+		mux.HandleFunc("DELETE /api/pages/{page}/layout", a.handleDeletePageLayoutRequest)
+	}
 
 	if !a.Config.Theme.DisablePicker {
 		mux.HandleFunc("POST /api/set-theme/{key}", a.handleThemeChangeRequest)
 	}
 
+	if a.Config.ContentSearch.Enabled {
+		mux.HandleFunc("GET /api/search", a.handleContentSearchRequest)
+	}
+
+	mux.HandleFunc("GET /api/preferences", a.handleGetPreferencesRequest)
+	mux.HandleFunc("PATCH /api/preferences", a.handleUpdatePreferencesRequest)
+	mux.HandleFunc("DELETE /api/preferences", a.handleDeletePreferencesRequest)
+
+	mux.HandleFunc("POST /api/wake-on-lan/{target}", a.handleWakeOnLANRequest)
+	mux.HandleFunc("GET /api/events", a.handleEventsRequest)
+
+	mux.HandleFunc("GET /debug/widgets", a.handleDebugWidgetsRequest)
+	mux.HandleFunc("GET /history/{widget}", a.handleWidgetHistoryPageRequest)
+	mux.HandleFunc("GET /api/widgets/{widget}/history", a.handleWidgetHistoryRequest)
+	mux.HandleFunc("POST /api/widgets/{widget}/refresh", a.handleWidgetRefreshRequest)
+	mux.HandleFunc("GET /api/widgets/{widget}/fragment", a.handleWidgetFragmentRequest)
 	mux.HandleFunc("/api/widgets/{widget}/{path...}", a.handleWidgetRequest)
-	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	})
+	if a.imageCache != nil {
+		mux.HandleFunc("GET /cache/images/{name}", a.handleCachedImageRequest)
+		mux.HandleFunc("GET /api/image-cache/stats", a.handleImageCacheStatsRequest)
+	}
+	mux.HandleFunc("GET "+imageProxyPath, a.handleImageProxyRequest)
+
+	if a.Config.Metrics.Enabled {
+		mux.HandleFunc("GET /metrics", a.handleMetricsRequest)
+	}
+
+	mux.HandleFunc("GET /api/healthz", a.handleHealthRequest)
 
 	if a.RequiresAuth {
 		mux.HandleFunc("GET /login", a.handleLoginPageRequest)
@@ -456,19 +877,19 @@ func (a *application) server() (func() error, func() error) {
 		mux.HandleFunc("POST /api/authenticate", a.handleAuthenticationAttempt)
 	}
 
+	assetCacheControlValue := fmt.Sprintf(
+		"public, max-age=%d, immutable",
+		int(STATIC_ASSETS_CACHE_DURATION.Seconds()),
+	)
+
 	mux.Handle(
 		fmt.Sprintf("GET /static/%s/{path...}", staticFSHash),
 		http.StripPrefix(
 			"/static/"+staticFSHash,
-			fileServerWithCache(http.FS(staticFS), STATIC_ASSETS_CACHE_DURATION),
+			fileServerWithCache(http.FS(staticFS), assetCacheControlValue),
 		),
 	)
 
-	assetCacheControlValue := fmt.Sprintf(
-		"public, max-age=%d",
-		int(STATIC_ASSETS_CACHE_DURATION.Seconds()),
-	)
-
 	mux.HandleFunc(fmt.Sprintf("GET /static/%s/css/bundle.css", staticFSHash), func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Cache-Control", assetCacheControlValue)
 		w.Header().Add("Content-Type", "text/css; charset=utf-8")
@@ -481,27 +902,83 @@ func (a *application) server() (func() error, func() error) {
 		w.Write(a.parsedManifest)
 	})
 
+	// served from the root rather than with the other static assets since
+	// that's where the pages it can control have to be under
+	mux.HandleFunc("GET /service-worker.js", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Cache-Control", "no-cache")
+		w.Header().Add("Content-Type", "text/javascript; charset=utf-8")
+		w.Write(serviceWorkerContents)
+	})
+
 	var absAssetsPath string
 	if a.Config.Server.AssetsPath != "" {
 		absAssetsPath, _ = filepath.Abs(a.Config.Server.AssetsPath)
-		assetsFS := fileServerWithCache(http.Dir(a.Config.Server.AssetsPath), 2*time.Hour)
+		assetsFS := fileServerWithCache(http.Dir(a.Config.Server.AssetsPath), "public, max-age=7200")
 		mux.Handle("/assets/{path...}", http.StripPrefix("/assets/", assetsFS))
 	}
 
 	server := http.Server{
 		Addr:    fmt.Sprintf("%s:%d", a.Config.Server.Host, a.Config.Server.Port),
-		Handler: mux,
+		Handler: a.withBasePath(withCompression(mux)),
+	}
+
+	var redirectServer *http.Server
+	if a.tls != nil {
+		server.TLSConfig = a.tls.config
+
+		if a.tls.httpHandler != nil {
+			redirectServer = &http.Server{
+				Addr:    fmt.Sprintf("%s:%d", a.Config.Server.Host, a.Config.Server.TLS.HTTPPort),
+				Handler: a.tls.httpHandler,
+			}
+		}
 	}
 
+	// stopped along with the server so that reloading the config doesn't leave
+	// the widgets of the previous application running
+	backgroundCtx, stopBackgroundTasks := context.WithCancel(context.Background())
+
 	start := func() error {
-		log.Printf("Starting server on %s:%d (base-url: \"%s\", assets-path: \"%s\")\n",
+		for i := range a.backgroundTasks {
+			go a.backgroundTasks[i].runInBackground(backgroundCtx)
+		}
+
+		go a.imageCache.runJanitor(backgroundCtx)
+		go a.runDevicesJanitor(backgroundCtx)
+		go a.runWidgetEvents(backgroundCtx)
+		go a.runScheduledUpdates(backgroundCtx)
+
+		log.Printf("Starting server on %s:%d (base-url: \"%s\", assets-path: \"%s\", tls: %t)\n",
 			a.Config.Server.Host,
 			a.Config.Server.Port,
 			a.Config.Server.BaseURL,
 			absAssetsPath,
+			a.tls != nil,
 		)
 
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if a.tls == nil {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				return err
+			}
+
+			return nil
+		}
+
+		if a.tls.run != nil {
+			go a.tls.run(backgroundCtx)
+		}
+
+		if redirectServer != nil {
+			go func() {
+				log.Printf("Redirecting HTTP requests on port %d to HTTPS\n", a.Config.Server.TLS.HTTPPort)
+
+				if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					log.Printf("HTTP server failed: %v\n", err)
+				}
+			}()
+		}
+
+		if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
 			return err
 		}
 
@@ -509,6 +986,12 @@ func (a *application) server() (func() error, func() error) {
 	}
 
 	stop := func() error {
+		stopBackgroundTasks()
+
+		if redirectServer != nil {
+			redirectServer.Close()
+		}
+
 		return server.Close()
 	}
 
@@ -0,0 +1,124 @@
+package glance
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAssetPathsUnderBaseURL(t *testing.T) {
+	for _, baseURL := range []string{"", "/dash", "https://example.com/dash"} {
+		app := &application{CreatedAt: time.Unix(1700000000, 0)}
+		app.Config.Server.BaseURL = baseURL
+
+		for _, asset := range []string{"manifest.json", "/manifest.json"} {
+			if got, expected := app.VersionedAssetPath(asset), baseURL+"/manifest.json?v=1700000000"; got != expected {
+				t.Errorf("expected %q, got %q", expected, got)
+			}
+		}
+
+		if got := app.StaticAssetPath("css/bundle.css"); !strings.HasPrefix(got, baseURL+"/static/") {
+			t.Errorf("expected the static asset to be under %q, got %q", baseURL+"/static/", got)
+		}
+	}
+}
+
+func TestFailedReloadKeepsGlobalSettings(t *testing.T) {
+	previousProxies, previousDialer := hostProxyRules.Load(), outboundDialer.Load()
+	previousLimits, previousDefaults := requestLimits.Load(), requestDefaults.Load()
+	previousImageCache := globalImageCache
+	t.Cleanup(func() {
+		hostProxyRules.Store(previousProxies)
+		outboundDialer.Store(previousDialer)
+		requestLimits.Store(previousLimits)
+		requestDefaults.Store(previousDefaults)
+		globalImageCache = previousImageCache
+		configureImageProxy("", nil)
+	})
+
+	newApp := func(contents string) (*application, error) {
+		config, err := newConfigFromYAML([]byte(contents))
+		if err != nil {
+			t.Fatalf("parsing config: %v", err)
+		}
+
+		return newApplication(config)
+	}
+
+	running, err := newApp(`
+proxies:
+  - hosts: [example.com]
+    url: direct
+server:
+  dns: 192.0.2.53
+requests:
+  timeout: 5s
+image-proxy:
+  rules:
+    - hosts: [example.com]
+      headers:
+        Referer: https://example.com/
+pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets:
+          - type: html
+            source: hello
+`)
+	if err != nil {
+		t.Fatalf("creating application: %v", err)
+	}
+	running.applyGlobalSettings()
+
+	proxies, dialer := hostProxyRules.Load(), outboundDialer.Load()
+	limits, defaults := requestLimits.Load(), requestDefaults.Load()
+	imageCache := globalImageCache
+	imageProxyMu.RLock()
+	imageProxyRuleCount := len(imageProxyRules)
+	imageProxyMu.RUnlock()
+
+	// the reserved slug only gets rejected once the application is created
+	_, err = newApp(`
+proxies:
+  - hosts: [example.org]
+    url: socks5://127.0.0.1:1080
+server:
+  dns: https://dns.example.org/dns-query
+requests:
+  timeout: 30s
+rate-limits:
+  max-concurrent-requests: 2
+image-proxy:
+  rules: []
+pages:
+  - name: Login
+    slug: login
+    columns:
+      - size: full
+        widgets:
+          - type: html
+            source: hello
+`)
+	if err == nil {
+		t.Fatal("expected the reserved slug to be rejected")
+	}
+
+	if hostProxyRules.Load() != proxies || outboundDialer.Load() != dialer {
+		t.Error("expected the proxies and the DNS server to be unchanged")
+	}
+
+	if requestLimits.Load() != limits || requestDefaults.Load() != defaults {
+		t.Error("expected the rate limits and the request defaults to be unchanged")
+	}
+
+	if globalImageCache != imageCache {
+		t.Error("expected the image cache to be unchanged")
+	}
+
+	imageProxyMu.RLock()
+	defer imageProxyMu.RUnlock()
+	if len(imageProxyRules) != imageProxyRuleCount {
+		t.Error("expected the image proxy rules to be unchanged")
+	}
+}
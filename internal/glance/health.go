@@ -0,0 +1,93 @@
+package glance
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+var processStartedAt = time.Now()
+
+type healthResponse struct {
+	Status        string               `json:"status"`
+	Version       string               `json:"version"`
+	StartedAt     time.Time            `json:"started_at"`
+	UptimeSeconds int64                `json:"uptime_seconds"`
+	Widgets       []healthWidgetStatus `json:"widgets,omitempty"`
+}
+
+type healthWidgetStatus struct {
+	ID            uint64     `json:"id"`
+	Type          string     `json:"type"`
+	Title         string     `json:"title"`
+	Page          string     `json:"page"`
+	LastUpdated   *time.Time `json:"last_updated,omitempty"`
+	LastSucceeded *time.Time `json:"last_succeeded,omitempty"`
+	NextUpdate    *time.Time `json:"next_update,omitempty"`
+	Error         string     `json:"error,omitempty"`
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// Always responds with 200 while the server is running so that it can be used
+// as a container healthcheck, unless strict is set, in which case any widget
+// that's failing to update results in a 503.
+//
+// The widgets are opt-in since listing them has to wait on pages which are in
+// the middle of updating, and they're only listed for those who can see them
+// on the dashboard
+func (a *application) handleHealthRequest(w http.ResponseWriter, r *http.Request) {
+	response := healthResponse{
+		Status:        "ok",
+		Version:       a.Version,
+		StartedAt:     processStartedAt,
+		UptimeSeconds: int64(time.Since(processStartedAt).Seconds()),
+	}
+
+	query := r.URL.Query()
+	strict := query.Has("strict")
+
+	if (strict || query.Has("widgets")) && a.isAuthorized(w, r) {
+		for _, page := range a.accessiblePages(r) {
+			page.mu.Lock()
+			forEachPageWidget(page, func(widget widget) bool {
+				base := widget.base()
+				if base.cacheType == cacheTypeInfinite || !a.canAccessWidget(r, base.ID) {
+					return true
+				}
+
+				status := healthWidgetStatus{
+					ID:            base.ID,
+					Type:          base.Type,
+					Title:         base.Title,
+					Page:          page.Slug,
+					LastUpdated:   optionalTime(base.lastUpdated),
+					LastSucceeded: optionalTime(base.lastSucceeded),
+					NextUpdate:    optionalTime(base.nextUpdate),
+				}
+
+				if base.Error != nil {
+					status.Error = base.Error.Error()
+					response.Status = "degraded"
+				}
+
+				response.Widgets = append(response.Widgets, status)
+				return true
+			})
+			page.mu.Unlock()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if response.Status != "ok" && strict {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,145 @@
+package glance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/text/language"
+)
+
+// The messages of the other languages fall back to the ones of this one
+const fallbackLanguage = "en"
+
+type locale struct {
+	Language string
+	// Keyed by the titles which widgets have by default, which are a mix of
+	// English and Chinese
+	widgetTitles map[string]string
+	messages     map[string]string
+	// Whether large numbers get shortened with 万 and 亿 rather than k and m
+	usesWan bool
+}
+
+type localeFile struct {
+	Messages     map[string]string `json:"messages"`
+	WidgetTitles map[string]string `json:"widget-titles"`
+}
+
+var locales = func() map[string]*locale {
+	files, err := fs.Glob(localesFS, "*.json")
+	if err != nil {
+		panic(err)
+	}
+
+	parsed := make(map[string]*localeFile, len(files))
+
+	for _, name := range files {
+		contents, err := fs.ReadFile(localesFS, name)
+		if err != nil {
+			panic(err)
+		}
+
+		file := &localeFile{}
+		if err := json.Unmarshal(contents, file); err != nil {
+			panic(fmt.Sprintf("parsing locale %s: %v", name, err))
+		}
+
+		parsed[strings.TrimSuffix(name, ".json")] = file
+	}
+
+	loaded := make(map[string]*locale, len(parsed))
+
+	for code, file := range parsed {
+		messages := maps.Clone(parsed[fallbackLanguage].Messages)
+		maps.Copy(messages, file.Messages)
+
+		base, _ := language.Make(code).Base()
+
+		loaded[code] = &locale{
+			Language:     code,
+			widgetTitles: file.WidgetTitles,
+			messages:     messages,
+			usesWan:      base.String() == "zh",
+		}
+	}
+
+	return loaded
+}()
+
+var currentLocale atomic.Pointer[locale]
+
+func init() {
+	currentLocale.Store(locales[fallbackLanguage])
+}
+
+// Matches the language regardless of its case, returns nil if there's no
+// locale for it
+func localeByLanguage(code string) *locale {
+	for key, locale := range locales {
+		if strings.EqualFold(key, code) {
+			return locale
+		}
+	}
+
+	return nil
+}
+
+func availableLanguages() []string {
+	return slices.Sorted(maps.Keys(locales))
+}
+
+// Widgets keep the titles they have by default when no language is set
+func configureLanguage(code string) {
+	if code == "" {
+		currentLocale.Store(&locale{
+			Language: fallbackLanguage,
+			messages: locales[fallbackLanguage].messages,
+		})
+		return
+	}
+
+	currentLocale.Store(localeByLanguage(code))
+}
+
+// Placeholders in the message are the indexes of the arguments in braces,
+// such as {0}, which lets translations put them in a different order
+func translate(key string, args ...any) string {
+	message, exists := currentLocale.Load().messages[key]
+	if !exists {
+		return key
+	}
+
+	if len(args) == 0 {
+		return message
+	}
+
+	replacements := make([]string, 0, len(args)*2)
+	for i, arg := range args {
+		replacements = append(replacements, "{"+strconv.Itoa(i)+"}", fmt.Sprint(arg))
+	}
+
+	return strings.NewReplacer(replacements...).Replace(message)
+}
+
+func translateWidgetTitle(title string) string {
+	if translated, exists := currentLocale.Load().widgetTitles[title]; exists {
+		return translated
+	}
+
+	return title
+}
+
+func (a *application) Locale() *locale {
+	return currentLocale.Load()
+}
+
+// The messages used by the scripts of the page
+func (l *locale) Client() map[string]string {
+	return l.messages
+}
@@ -0,0 +1,626 @@
+package glance
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	imageCacheDefaultDuration        = 24 * time.Hour
+	imageCacheDefaultCleanupInterval = time.Hour
+	imageCacheDefaultDirName         = "images"
+	imageCacheURLPath                = "/cache/images/"
+)
+
+// Images larger than this aren't cached, they're kept in memory while they
+// get written to the store
+const imageCacheMaxImageSize = 32 * 1024 * 1024
+
+// Only names which could have been given to cached images get served, which
+// also keeps requests from reaching anything else in the store
+var imageCacheFileNamePattern = regexp.MustCompile(`^[0-9a-f]{32}(-[0-9]{1,4}w)?\.(jpg|png|gif|webp|avif|svg|ico|bmp)$`)
+
+// The extensions which cached images are saved with, by content type
+var imageCacheExtensions = map[string]string{
+	"image/jpeg":    "jpg",
+	"image/png":     "png",
+	"image/gif":     "gif",
+	"image/webp":    "webp",
+	"image/avif":    "avif",
+	"image/svg+xml": "svg",
+	"image/x-icon":  "ico",
+	"image/bmp":     "bmp",
+}
+
+func imageCacheHash(url string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(url)))
+}
+
+// Works out the type of an image from its first bytes, which is more reliable
+// than the URL or the Content-Type of the response. The Content-Type is only
+// used for the formats which can't be told apart by their first bytes, such as
+// SVG. Returns an empty string for anything that isn't an image.
+func detectImageContentType(head []byte, contentTypeHeader string) string {
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" && (string(head[8:12]) == "avif" || string(head[8:12]) == "avis") {
+		return "image/avif"
+	}
+
+	detected := http.DetectContentType(head)
+	if _, ok := imageCacheExtensions[detected]; ok {
+		return detected
+	}
+
+	// error pages which claim to be images
+	if strings.HasPrefix(detected, "text/html") {
+		return ""
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentTypeHeader)
+	if mediaType == "image/vnd.microsoft.icon" {
+		mediaType = "image/x-icon"
+	}
+
+	if _, ok := imageCacheExtensions[mediaType]; ok {
+		return mediaType
+	}
+
+	return ""
+}
+
+// Set up from the image-cache section of the config when the application is
+// created, nil when the cache is disabled, in which case the original URLs
+// of images get used as they are
+var globalImageCache *ImageCache
+
+// 图片缓存管理器
+type ImageCache struct {
+	store           cacheStore
+	cacheDuration   time.Duration
+	cleanupInterval time.Duration
+	maxSize         int64
+	baseURL         string
+	resize          bool                     // 是否生成缩略图尺寸的副本
+	downloading     map[string]chan struct{} // 防止重复下载
+	mutex           sync.RWMutex
+	// the widths of the cached images by their key, needed for srcset
+	widths map[string]int
+
+	// 最近访问时间，用于按LRU清理，重启后以文件修改时间为准
+	accessed        map[string]time.Time
+	cleanupRequests chan struct{}
+
+	size   atomic.Int64
+	files  atomic.Int64
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type imageCacheStats struct {
+	Files        int64  `json:"files"`
+	SizeBytes    int64  `json:"size_bytes"`
+	MaxSizeBytes int64  `json:"max_size_bytes"`
+	Hits         uint64 `json:"hits"`
+	Misses       uint64 `json:"misses"`
+}
+
+// 创建图片缓存管理器
+func NewImageCache(store cacheStore, duration time.Duration, maxSize int64) *ImageCache {
+	return &ImageCache{
+		store:           store,
+		cacheDuration:   duration,
+		cleanupInterval: imageCacheDefaultCleanupInterval,
+		maxSize:         maxSize,
+		downloading:     make(map[string]chan struct{}),
+		widths:          make(map[string]int),
+		accessed:        make(map[string]time.Time),
+		cleanupRequests: make(chan struct{}, 1),
+	}
+}
+
+// 记录图片被使用的时间
+func (ic *ImageCache) touch(key string) {
+	ic.mutex.Lock()
+	ic.accessed[key] = time.Now()
+	ic.mutex.Unlock()
+}
+
+func (ic *ImageCache) lastAccessed(entry cacheEntry) time.Time {
+	ic.mutex.RLock()
+	defer ic.mutex.RUnlock()
+
+	if accessed, ok := ic.accessed[entry.key]; ok && accessed.After(entry.modTime) {
+		return accessed
+	}
+
+	return entry.modTime
+}
+
+func (ic *ImageCache) stats() imageCacheStats {
+	return imageCacheStats{
+		Files:        ic.files.Load(),
+		SizeBytes:    ic.size.Load(),
+		MaxSizeBytes: ic.maxSize,
+		Hits:         ic.hits.Load(),
+		Misses:       ic.misses.Load(),
+	}
+}
+
+// Returns the name which the image is served under, which is only known once
+// it has been downloaded since it depends on the type of the image
+func (ic *ImageCache) cachedImage(url string) (string, cacheEntry, bool) {
+	entry, err := ic.store.stat(imageCacheHash(url))
+	if err != nil {
+		if !errors.Is(err, errCacheEntryNotFound) {
+			slog.Error("Failed to look up cached image", "url", url, "error", err)
+		}
+		return "", entry, false
+	}
+
+	return entry.key + "." + imageCacheExtensions[entry.contentType], entry, true
+}
+
+// 检查缓存是否有效
+func (ic *ImageCache) isCacheValid(entry cacheEntry) bool {
+	// 检查文件是否在有效期内
+	return time.Since(entry.modTime) < ic.cacheDuration
+}
+
+// 下载图片到缓存
+func (ic *ImageCache) downloadImage(url string) error {
+	// 创建带有防盗链头部的请求
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("create request failed: %w", err)
+	}
+
+	// 🔑 关键：设置请求头绕过防盗链
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	req.Header.Set("Accept", "image/webp,image/apng,image/*,*/*;q=0.8")
+	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9")
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("Sec-Fetch-Dest", "image")
+	req.Header.Set("Sec-Fetch-Mode", "no-cors")
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	// Referer 等防盗链头部由图片代理的规则决定
+	applyImageProxyHeaders(req)
+
+	client := &http.Client{
+		Timeout: 15 * time.Second,
+		Transport: &http.Transport{
+			MaxIdleConns:      10,
+			IdleConnTimeout:   30 * time.Second,
+			Proxy:             proxyForRequest,
+			DialContext:       dialOutbound,
+			ForceAttemptHTTP2: true,
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad status code: %d", resp.StatusCode)
+	}
+
+	// 下载图片内容
+	data, err := io.ReadAll(io.LimitReader(resp.Body, imageCacheMaxImageSize+1))
+	if err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+
+	if len(data) > imageCacheMaxImageSize {
+		return fmt.Errorf("image is larger than %dMB", imageCacheMaxImageSize/(1024*1024))
+	}
+
+	// the type is detected from the first bytes of the image rather than
+	// guessed from the URL
+	contentType := detectImageContentType(data[:min(len(data), 512)], resp.Header.Get("Content-Type"))
+	if contentType == "" {
+		return fmt.Errorf("response is not an image: %s", http.DetectContentType(data))
+	}
+
+	key := imageCacheHash(url)
+	if err := ic.store.put(key, data, contentType); err != nil {
+		return fmt.Errorf("storing image failed: %w", err)
+	}
+
+	ic.touch(key)
+	ic.mutex.Lock()
+	delete(ic.widths, key)
+	ic.mutex.Unlock()
+
+	files, written := 1, int64(len(data))
+	if ic.resize {
+		variantFiles, variantsSize := ic.createImageVariants(key, data)
+		files += variantFiles
+		written += variantsSize
+	}
+
+	ic.files.Add(int64(files))
+	size := ic.size.Add(written)
+
+	// 超出容量时不必等到下一次定时清理
+	if ic.maxSize > 0 && size > ic.maxSize {
+		select {
+		case ic.cleanupRequests <- struct{}{}:
+		default:
+		}
+	}
+
+	slog.Info("Image cached successfully", "url", url, "key", key)
+	return nil
+}
+
+// 获取缓存的图片URL（同步版本）
+func (ic *ImageCache) GetCachedImageURL(originalURL string) string {
+	if originalURL == "" {
+		return ""
+	}
+
+	// 缓存未启用时通过图片代理加载
+	if ic == nil {
+		return imageProxyURL(originalURL)
+	}
+
+	// 确保使用 HTTPS
+	if strings.HasPrefix(originalURL, "http://") {
+		originalURL = strings.Replace(originalURL, "http://", "https://", 1)
+	}
+
+	fileName, entry, cached := ic.cachedImage(originalURL)
+
+	// 如果缓存有效，直接返回缓存URL
+	if cached && ic.isCacheValid(entry) {
+		ic.hits.Add(1)
+		ic.touch(entry.key)
+		return ic.baseURL + imageCacheURLPath + fileName
+	}
+
+	ic.misses.Add(1)
+
+	// 防止同一图片重复下载
+	ic.mutex.Lock()
+	if ch, exists := ic.downloading[originalURL]; exists {
+		ic.mutex.Unlock()
+		// 等待其他goroutine下载完成
+		<-ch
+		if fileName, entry, cached := ic.cachedImage(originalURL); cached && ic.isCacheValid(entry) {
+			return ic.baseURL + imageCacheURLPath + fileName
+		}
+	} else {
+		// 标记正在下载
+		ch := make(chan struct{})
+		ic.downloading[originalURL] = ch
+		ic.mutex.Unlock()
+
+		// 下载图片
+		go func() {
+			defer func() {
+				close(ch)
+				ic.mutex.Lock()
+				delete(ic.downloading, originalURL)
+				ic.mutex.Unlock()
+			}()
+
+			if err := ic.downloadImage(originalURL); err != nil {
+				slog.Error("Failed to download image", "url", originalURL, "error", err)
+			}
+		}()
+	}
+
+	// 检查是否存在旧缓存（即使过期也先用着）
+	if cached {
+		ic.touch(entry.key)
+		return ic.baseURL + imageCacheURLPath + fileName
+	}
+
+	// 如果没有缓存，先通过图片代理加载
+	return imageProxyURL(originalURL)
+}
+
+// Lists the smaller copies of a cached image along with the image itself in
+// the format of the srcset attribute, or returns an empty string when there
+// aren't any, such as when the image hasn't finished downloading yet
+func (ic *ImageCache) GetCachedImageSrcset(originalURL string) string {
+	if ic == nil || !ic.resize || originalURL == "" {
+		return ""
+	}
+
+	if strings.HasPrefix(originalURL, "http://") {
+		originalURL = strings.Replace(originalURL, "http://", "https://", 1)
+	}
+
+	fileName, entry, cached := ic.cachedImage(originalURL)
+	if !cached {
+		return ""
+	}
+
+	width := ic.imageWidth(entry.key)
+	if width == 0 {
+		return ""
+	}
+
+	candidates := make([]string, 0, len(imageCacheVariantWidths)+1)
+
+	for _, variantWidth := range imageCacheVariantWidths {
+		if variantWidth >= width {
+			break
+		}
+
+		variant := imageVariantKey(entry.key, variantWidth)
+		if _, err := ic.store.stat(variant); err != nil {
+			continue
+		}
+
+		candidates = append(candidates, fmt.Sprintf("%s%s%s.jpg %dw", ic.baseURL, imageCacheURLPath, variant, variantWidth))
+	}
+
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	candidates = append(candidates, fmt.Sprintf("%s%s%s %dw", ic.baseURL, imageCacheURLPath, fileName, width))
+
+	return strings.Join(candidates, ", ")
+}
+
+// Decoded once per image, which for stores other than the filesystem means
+// downloading it from the store
+func (ic *ImageCache) imageWidth(key string) int {
+	ic.mutex.RLock()
+	width, known := ic.widths[key]
+	ic.mutex.RUnlock()
+
+	if known {
+		return width
+	}
+
+	data, _, err := ic.store.get(key)
+	if err != nil {
+		return 0
+	}
+
+	// images which can't be decoded are remembered as having no width
+	config, _, _ := image.DecodeConfig(bytes.NewReader(data))
+
+	ic.mutex.Lock()
+	ic.widths[key] = config.Width
+	ic.mutex.Unlock()
+
+	return config.Width
+}
+
+// 预加载图片到缓存（异步版本）
+func (ic *ImageCache) PreloadImage(originalURL string) {
+	if ic == nil || originalURL == "" {
+		return
+	}
+
+	// 确保使用 HTTPS
+	if strings.HasPrefix(originalURL, "http://") {
+		originalURL = strings.Replace(originalURL, "http://", "https://", 1)
+	}
+
+	// 如果已经缓存且有效，跳过
+	if _, entry, cached := ic.cachedImage(originalURL); cached && ic.isCacheValid(entry) {
+		return
+	}
+
+	// 防止重复下载
+	ic.mutex.Lock()
+	if _, exists := ic.downloading[originalURL]; exists {
+		ic.mutex.Unlock()
+		return
+	}
+
+	ch := make(chan struct{})
+	ic.downloading[originalURL] = ch
+	ic.mutex.Unlock()
+
+	// 异步下载
+	go func() {
+		defer func() {
+			close(ch)
+			ic.mutex.Lock()
+			delete(ic.downloading, originalURL)
+			ic.mutex.Unlock()
+		}()
+
+		if err := ic.downloadImage(originalURL); err != nil {
+			slog.Error("Failed to preload image", "url", originalURL, "error", err)
+		}
+	}()
+}
+
+// 清理过期缓存
+func (ic *ImageCache) CleanExpiredCache() {
+	if ic == nil {
+		return
+	}
+
+	entries, err := ic.store.list()
+	if err != nil {
+		slog.Error("Failed to list cache files", "error", err)
+		return
+	}
+
+	var cleaned int
+	var totalSize int64
+	var remaining []cacheEntry
+	var remainingSize int64
+
+	for _, entry := range entries {
+		// 删除过期文件
+		if time.Since(entry.modTime) > ic.cacheDuration {
+			if err := ic.store.remove(entry.key); err == nil {
+				cleaned++
+				totalSize += entry.size
+			}
+		} else {
+			remaining = append(remaining, entry)
+			remainingSize += entry.size
+		}
+	}
+
+	// still over the limit, drop the least recently used images until it fits
+	if ic.maxSize > 0 && remainingSize > ic.maxSize {
+		slices.SortFunc(remaining, func(a, b cacheEntry) int {
+			return ic.lastAccessed(a).Compare(ic.lastAccessed(b))
+		})
+
+		for len(remaining) > 0 && remainingSize > ic.maxSize {
+			entry := remaining[0]
+			remaining = remaining[1:]
+
+			if err := ic.store.remove(entry.key); err == nil {
+				cleaned++
+				totalSize += entry.size
+				remainingSize -= entry.size
+			}
+		}
+	}
+
+	ic.mutex.Lock()
+	accessed := make(map[string]time.Time, len(remaining))
+	widths := make(map[string]int, len(remaining))
+	for _, entry := range remaining {
+		if at, ok := ic.accessed[entry.key]; ok {
+			accessed[entry.key] = at
+		}
+		if width, ok := ic.widths[entry.key]; ok {
+			widths[entry.key] = width
+		}
+	}
+	ic.accessed = accessed
+	ic.widths = widths
+	ic.mutex.Unlock()
+
+	ic.files.Store(int64(len(remaining)))
+	ic.size.Store(remainingSize)
+
+	if cleaned > 0 {
+		slog.Info("Cache cleanup completed",
+			"files_removed", cleaned,
+			"space_freed", fmt.Sprintf("%.2fMB", float64(totalSize)/(1024*1024)))
+	}
+}
+
+// Cleans up the cache right away and then every cleanup interval, or sooner
+// whenever a download takes it over the maximum size
+func (ic *ImageCache) runJanitor(ctx context.Context) {
+	if ic == nil {
+		return
+	}
+
+	ticker := time.NewTicker(ic.cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		ic.CleanExpiredCache()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-ic.cleanupRequests:
+		}
+	}
+}
+
+// When no path is configured, the images are kept next to the rest of the
+// persistent data if there is any, otherwise in the user's cache directory
+func defaultImageCachePath(dataPath string) string {
+	if dataPath != "" {
+		return filepath.Join(dataPath, "cache", imageCacheDefaultDirName)
+	}
+
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "glance", imageCacheDefaultDirName)
+	}
+
+	return filepath.Join(os.TempDir(), "glance", imageCacheDefaultDirName)
+}
+
+func newImageCacheFromConfig(config *config, store cacheStore) *ImageCache {
+	cacheConfig := &config.ImageCache
+
+	if store == nil || (cacheConfig.Enabled != nil && !*cacheConfig.Enabled) {
+		return nil
+	}
+
+	duration := time.Duration(cacheConfig.Duration)
+	if duration == 0 {
+		duration = imageCacheDefaultDuration
+	}
+
+	cache := NewImageCache(store, duration, int64(cacheConfig.MaxSize))
+	cache.baseURL = config.Server.BaseURL
+	cache.resize = cacheConfig.Resize
+
+	if cacheConfig.CleanupInterval > 0 {
+		cache.cleanupInterval = time.Duration(cacheConfig.CleanupInterval)
+	}
+
+	return cache
+}
+
+func (ic *ImageCache) serveImage(w http.ResponseWriter, r *http.Request, fileName string) {
+	if !imageCacheFileNamePattern.MatchString(fileName) {
+		http.NotFound(w, r)
+		return
+	}
+
+	key, extension, _ := strings.Cut(fileName, ".")
+
+	data, entry, err := ic.store.get(key)
+	if err != nil {
+		if !errors.Is(err, errCacheEntryNotFound) {
+			slog.Error("Failed to read cached image", "key", key, "error", err)
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	if imageCacheExtensions[entry.contentType] != extension {
+		http.NotFound(w, r)
+		return
+	}
+
+	ic.touch(key)
+
+	// the image gets replaced whenever it's downloaded again, so its
+	// modification time is enough to tell versions of it apart
+	etag := fmt.Sprintf(`"%s-%x-%x"`, key, entry.modTime.UnixNano(), len(data))
+
+	w.Header().Set("Content-Type", entry.contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(ic.cacheDuration.Seconds())))
+
+	// SVGs can contain scripts, which shouldn't run with access to the dashboard
+	if entry.contentType == "image/svg+xml" {
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	}
+
+	// handles If-None-Match and If-Modified-Since
+	http.ServeContent(w, r, fileName, entry.modTime, bytes.NewReader(data))
+}
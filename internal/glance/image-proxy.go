@@ -0,0 +1,168 @@
+package glance
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	imageProxyPath          = "/image-proxy"
+	imageProxyMaxImageSize  = 10 * 1024 * 1024
+	imageProxyCacheDuration = 24 * time.Hour
+)
+
+// Images from these hosts refuse to load unless the request looks like it
+// came from the site itself. Rules from the config are checked first, so
+// these can be overridden
+var imageProxyDefaultRules = []imageProxyRule{
+	{
+		Hosts:   []string{"hdslb.com", "bilibili.com", "biliimg.com"},
+		Headers: map[string]string{"Referer": "https://www.bilibili.com/"},
+	},
+	{
+		Hosts:   []string{"sinaimg.cn"},
+		Headers: map[string]string{"Referer": "https://weibo.com/"},
+	},
+	{
+		Hosts:   []string{"pximg.net"},
+		Headers: map[string]string{"Referer": "https://www.pixiv.net/"},
+	},
+}
+
+type imageProxyRule struct {
+	Hosts   []string          `yaml:"hosts"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+func (rule *imageProxyRule) matches(host string) bool {
+	return hostMatches(host, rule.Hosts)
+}
+
+var (
+	// Generated once per process rather than per config reload, so that
+	// the URLs in pages which are already open keep working after a reload
+	imageProxySigningKey = func() []byte {
+		key := make([]byte, 32)
+		rand.Read(key)
+		return key
+	}()
+
+	imageProxyMu      sync.RWMutex
+	imageProxyBaseURL string
+	imageProxyRules   = imageProxyDefaultRules
+)
+
+func configureImageProxy(baseURL string, rules []imageProxyRule) {
+	imageProxyMu.Lock()
+	defer imageProxyMu.Unlock()
+
+	imageProxyBaseURL = baseURL
+	imageProxyRules = append(append([]imageProxyRule{}, rules...), imageProxyDefaultRules...)
+}
+
+func signImageProxyURL(imageURL string) string {
+	mac := hmac.New(sha256.New, imageProxySigningKey)
+	mac.Write([]byte(imageURL))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Returns a URL which loads the image through Glance with the headers from
+// the matching rule, the URL is signed so that the endpoint can't be used
+// to fetch anything other than what was put on the page
+func imageProxyURL(imageURL string) string {
+	if !strings.HasPrefix(imageURL, "http://") && !strings.HasPrefix(imageURL, "https://") {
+		return imageURL
+	}
+
+	imageProxyMu.RLock()
+	baseURL := imageProxyBaseURL
+	imageProxyMu.RUnlock()
+
+	return baseURL + imageProxyPath + "?url=" + url.QueryEscape(imageURL) + "&sig=" + signImageProxyURL(imageURL)
+}
+
+func applyImageProxyHeaders(request *http.Request) {
+	imageProxyMu.RLock()
+	defer imageProxyMu.RUnlock()
+
+	host := request.URL.Hostname()
+
+	for i := range imageProxyRules {
+		if imageProxyRules[i].matches(host) {
+			for key, value := range imageProxyRules[i].Headers {
+				request.Header.Set(key, value)
+			}
+			return
+		}
+	}
+}
+
+func (a *application) handleImageProxyRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	imageURL := r.URL.Query().Get("url")
+	signature := r.URL.Query().Get("sig")
+
+	if imageURL == "" || !hmac.Equal([]byte(signature), []byte(signImageProxyURL(imageURL))) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	parsedURL, err := url.Parse(imageURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+		http.Error(w, "invalid url", http.StatusBadRequest)
+		return
+	}
+
+	request, _ := http.NewRequestWithContext(r.Context(), "GET", parsedURL.String(), nil)
+	request.Header.Set("User-Agent", glanceUserAgentString)
+	request.Header.Set("Accept", "image/webp,image/apng,image/*,*/*;q=0.8")
+	applyImageProxyHeaders(request)
+
+	response, err := defaultHTTPClient.Do(request)
+	if err != nil {
+		http.Error(w, "fetching image failed", http.StatusBadGateway)
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		http.Error(w, "unexpected status code "+strconv.Itoa(response.StatusCode), http.StatusBadGateway)
+		return
+	}
+
+	contentType := response.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		http.Error(w, "not an image", http.StatusBadGateway)
+		return
+	}
+
+	if response.ContentLength > imageProxyMaxImageSize {
+		http.Error(w, "image is too large", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(imageProxyCacheDuration.Seconds())))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// the image is served from the same origin as the dashboard, this keeps
+	// scripts in SVGs from running if the image gets opened directly
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	if response.ContentLength > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(response.ContentLength, 10))
+	}
+
+	io.Copy(w, io.LimitReader(response.Body, imageProxyMaxImageSize))
+}
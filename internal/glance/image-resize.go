@@ -0,0 +1,130 @@
+package glance
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+	"log/slog"
+)
+
+// Widths of the smaller copies kept of cached images, sized for the thumbnails
+// of lists, grids and cards in that order
+var imageCacheVariantWidths = []int{240, 320, 480}
+
+const (
+	imageVariantQuality = 82
+	// Not worth decoding just to make thumbnails out of
+	imageVariantMaxPixels = 40_000_000
+)
+
+func imageVariantKey(key string, width int) string {
+	return fmt.Sprintf("%s-%dw", key, width)
+}
+
+// Creates the variants which are narrower than the image and returns how many
+// were stored and their combined size. Only JPEG and PNG images are resized,
+// GIFs would lose their animation and images with transparent pixels would
+// lose their transparency since the variants are JPEGs.
+func (ic *ImageCache) createImageVariants(key string, data []byte) (int, int64) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "jpeg" && format != "png") {
+		return 0, 0
+	}
+
+	if config.Width <= imageCacheVariantWidths[0] || config.Width*config.Height > imageVariantMaxPixels {
+		return 0, 0
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		slog.Warn("Failed to decode image for resizing", "key", key, "error", err)
+		return 0, 0
+	}
+
+	if opaque, ok := decoded.(interface{ Opaque() bool }); !ok || !opaque.Opaque() {
+		return 0, 0
+	}
+
+	var files int
+	var size int64
+
+	for _, width := range imageCacheVariantWidths {
+		if width >= config.Width {
+			break
+		}
+
+		variantKey := imageVariantKey(key, width)
+		written, err := ic.storeImageVariant(variantKey, resizeImageToWidth(decoded, width))
+		if err != nil {
+			slog.Warn("Failed to store resized image", "key", variantKey, "error", err)
+			continue
+		}
+
+		files++
+		size += written
+	}
+
+	return files, size
+}
+
+func (ic *ImageCache) storeImageVariant(key string, img image.Image) (int64, error) {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: imageVariantQuality}); err != nil {
+		return 0, err
+	}
+
+	if err := ic.store.put(key, encoded.Bytes(), "image/jpeg"); err != nil {
+		return 0, err
+	}
+
+	return int64(encoded.Len()), nil
+}
+
+// Averages the pixels which each pixel of the resized image covers, which
+// is good enough for shrinking and doesn't need anything beyond the standard
+// library.
+func resizeImageToWidth(src image.Image, width int) *image.RGBA {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	height := max(1, srcHeight*width/srcWidth)
+
+	rgba, ok := src.(*image.RGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+		draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := range height {
+		y0, y1 := y*srcHeight/height, max((y+1)*srcHeight/height, y*srcHeight/height+1)
+
+		for x := range width {
+			x0, x1 := x*srcWidth/width, max((x+1)*srcWidth/width, x*srcWidth/width+1)
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					b += uint32(p[2])
+					a += uint32(p[3])
+					n++
+				}
+			}
+
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
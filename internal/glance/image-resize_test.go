@@ -0,0 +1,87 @@
+package glance
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestResizeImageToWidth(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(10, 10, 410, 210))
+	for y := 10; y < 210; y++ {
+		for x := 10; x < 410; x++ {
+			// the left half is white and the right half is black
+			if x < 210 {
+				src.Set(x, y, color.White)
+			} else {
+				src.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	resized := resizeImageToWidth(src, 100)
+
+	if resized.Bounds() != image.Rect(0, 0, 100, 50) {
+		t.Fatalf("unexpected bounds %v", resized.Bounds())
+	}
+
+	if c := resized.RGBAAt(10, 25); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("expected white on the left, got %v", c)
+	}
+
+	if c := resized.RGBAAt(90, 25); c != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("expected black on the right, got %v", c)
+	}
+}
+
+func TestCreateImageVariants(t *testing.T) {
+	encode := func(img image.Image, format string) []byte {
+		var buf bytes.Buffer
+		if format == "png" {
+			png.Encode(&buf, img)
+		} else {
+			jpeg.Encode(&buf, img, nil)
+		}
+		return buf.Bytes()
+	}
+
+	opaque := image.NewNRGBA(image.Rect(0, 0, 600, 300))
+	for i := 3; i < len(opaque.Pix); i += 4 {
+		opaque.Pix[i] = 255
+	}
+
+	transparent := image.NewNRGBA(image.Rect(0, 0, 600, 300))
+	copy(transparent.Pix, opaque.Pix)
+	transparent.Pix[3] = 0
+
+	tests := []struct {
+		name     string
+		data     []byte
+		variants int
+	}{
+		{name: "opaque png", data: encode(opaque, "png"), variants: 3},
+		{name: "jpeg", data: encode(opaque, "jpeg"), variants: 3},
+		{name: "narrower than the variants", data: encode(image.NewGray(image.Rect(0, 0, 200, 100)), "png"), variants: 0},
+		{name: "png with transparency", data: encode(transparent, "png"), variants: 0},
+		{name: "not an image", data: []byte("<svg></svg>"), variants: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ic := &ImageCache{store: openFileCacheStore(t.TempDir())}
+
+			files, _ := ic.createImageVariants("key", test.data)
+			stored, err := ic.store.list()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if files != test.variants || len(stored) != test.variants {
+				t.Errorf("expected %d variants, got %d with %d stored", test.variants, files, len(stored))
+			}
+		})
+	}
+}
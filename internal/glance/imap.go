@@ -0,0 +1,307 @@
+package glance
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A minimal IMAP4rev1 client which only supports what's needed to summarize
+// a mailbox: logging in, reading the status of folders and fetching headers
+
+const imapMaxLiteralSize = 1 << 20
+
+type imapConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	tag    int
+}
+
+// A single untagged response, literals are kept separately from the text
+// of the line they were part of
+type imapResponse struct {
+	text     string
+	literals [][]byte
+}
+
+type imapError struct {
+	Status  string
+	Message string
+}
+
+func (e *imapError) Error() string {
+	return e.Status + " " + e.Message
+}
+
+func dialIMAP(ctx context.Context, address string, security string, allowInsecure bool) (*imapConn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(20 * time.Second))
+	}
+
+	host, _, _ := net.SplitHostPort(address)
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: allowInsecure}
+
+	if security == "tls" {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c := &imapConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	greeting, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("reading greeting: %v", err)
+	}
+
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected greeting: %s", greeting)
+	}
+
+	if security == "starttls" {
+		if _, err := c.command("STARTTLS"); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("starting TLS: %v", err)
+		}
+
+		c.conn = tls.Client(conn, tlsConfig)
+		c.reader = bufio.NewReader(c.conn)
+	}
+
+	return c, nil
+}
+
+func (c *imapConn) Close() error {
+	c.command("LOGOUT")
+	return c.conn.Close()
+}
+
+func (c *imapConn) login(username, password string) error {
+	_, err := c.command("LOGIN " + imapQuote(username) + " " + imapQuote(password))
+	return err
+}
+
+// Returns the total number of messages and the number of unseen messages
+func (c *imapConn) status(folder string) (int, int, error) {
+	responses, err := c.command("STATUS " + imapQuote(folder) + " (MESSAGES UNSEEN)")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for i := range responses {
+		if !strings.HasPrefix(responses[i].text, "* STATUS ") {
+			continue
+		}
+
+		messages, _ := imapStatusValue(responses[i].text, "MESSAGES")
+		unseen, _ := imapStatusValue(responses[i].text, "UNSEEN")
+
+		return messages, unseen, nil
+	}
+
+	return 0, 0, errors.New("server did not return a status")
+}
+
+// Selects the folder in read-only mode so that fetching doesn't mark anything as seen
+func (c *imapConn) examine(folder string) error {
+	_, err := c.command("EXAMINE " + imapQuote(folder))
+	return err
+}
+
+// Returns the sequence numbers of messages matching the criteria
+func (c *imapConn) search(criteria string) ([]int, error) {
+	responses, err := c.command("SEARCH " + criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	var numbers []int
+
+	for i := range responses {
+		fields, ok := strings.CutPrefix(responses[i].text, "* SEARCH")
+		if !ok {
+			continue
+		}
+
+		for _, field := range strings.Fields(fields) {
+			if n, err := strconv.Atoi(field); err == nil {
+				numbers = append(numbers, n)
+			}
+		}
+	}
+
+	return numbers, nil
+}
+
+type imapFetchedMessage struct {
+	seqNum int
+	flags  []string
+	header []byte
+}
+
+var imapFetchPattern = regexp.MustCompile(`^\* (\d+) FETCH `)
+var imapFlagsPattern = regexp.MustCompile(`FLAGS \(([^)]*)\)`)
+
+// Fetches the flags and the given header fields of the messages in the sequence set
+func (c *imapConn) fetchHeaders(seqSet string, fields ...string) ([]imapFetchedMessage, error) {
+	responses, err := c.command(
+		"FETCH " + seqSet + " (FLAGS BODY.PEEK[HEADER.FIELDS (" + strings.Join(fields, " ") + ")])",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]imapFetchedMessage, 0, len(responses))
+
+	for i := range responses {
+		matches := imapFetchPattern.FindStringSubmatch(responses[i].text)
+		if matches == nil {
+			continue
+		}
+
+		message := imapFetchedMessage{}
+		message.seqNum, _ = strconv.Atoi(matches[1])
+
+		if flags := imapFlagsPattern.FindStringSubmatch(responses[i].text); flags != nil {
+			message.flags = strings.Fields(flags[1])
+		}
+
+		if len(responses[i].literals) > 0 {
+			message.header = responses[i].literals[0]
+		}
+
+		messages = append(messages, message)
+	}
+
+	return messages, nil
+}
+
+// Sends the command and returns the untagged responses which arrived before
+// the tagged completion, which returns an error unless its status is OK
+func (c *imapConn) command(command string) ([]imapResponse, error) {
+	c.tag++
+	tag := "G" + strconv.Itoa(c.tag)
+
+	if _, err := io.WriteString(c.conn, tag+" "+command+"\r\n"); err != nil {
+		return nil, err
+	}
+
+	var responses []imapResponse
+
+	for {
+		response, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+
+		rest, ok := strings.CutPrefix(response.text, tag+" ")
+		if !ok {
+			responses = append(responses, response)
+			continue
+		}
+
+		status, message, _ := strings.Cut(rest, " ")
+		if status != "OK" {
+			return nil, &imapError{Status: status, Message: message}
+		}
+
+		return responses, nil
+	}
+}
+
+func (c *imapConn) readResponse() (imapResponse, error) {
+	var response imapResponse
+	var text strings.Builder
+
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return response, err
+		}
+
+		size, ok := imapLiteralSize(line)
+		if !ok {
+			text.WriteString(line)
+			response.text = text.String()
+			return response, nil
+		}
+
+		if size > imapMaxLiteralSize {
+			return response, fmt.Errorf("literal of %d bytes is too large", size)
+		}
+
+		literal := make([]byte, size)
+		if _, err := io.ReadFull(c.reader, literal); err != nil {
+			return response, err
+		}
+
+		text.WriteString(line)
+		response.literals = append(response.literals, literal)
+	}
+}
+
+func (c *imapConn) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Lines which are followed by a literal end with its size, e.g. {123}
+func imapLiteralSize(line string) (int, bool) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, false
+	}
+
+	start := strings.LastIndexByte(line, '{')
+	if start == -1 {
+		return 0, false
+	}
+
+	size, err := strconv.Atoi(line[start+1 : len(line)-1])
+	if err != nil || size < 0 {
+		return 0, false
+	}
+
+	return size, true
+}
+
+func imapStatusValue(text string, item string) (int, bool) {
+	_, after, found := strings.Cut(text, item+" ")
+	if !found {
+		return 0, false
+	}
+
+	end := strings.IndexAny(after, " )")
+	if end == -1 {
+		end = len(after)
+	}
+
+	value, err := strconv.Atoi(after[:end])
+	return value, err == nil
+}
+
+func imapQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+
+	return `"` + s + `"`
+}
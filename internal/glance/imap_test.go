@@ -0,0 +1,141 @@
+package glance
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIMAPLiteralSize(t *testing.T) {
+	tests := []struct {
+		line     string
+		size     int
+		expected bool
+	}{
+		{line: "* 1 FETCH (FLAGS (\\Seen) BODY[HEADER.FIELDS (SUBJECT)] {42}", size: 42, expected: true},
+		{line: "* 1 FETCH (BODY[] {0}", size: 0, expected: true},
+		{line: "* 1 FETCH (FLAGS (\\Seen))", expected: false},
+		{line: "* OK {not a size}", expected: false},
+		{line: "* OK {-1}", expected: false},
+		{line: "* OK 12}", expected: false},
+		{line: "", expected: false},
+	}
+
+	for _, test := range tests {
+		size, ok := imapLiteralSize(test.line)
+		if ok != test.expected || size != test.size {
+			t.Errorf("expected %q to give %d, %v, got %d, %v", test.line, test.size, test.expected, size, ok)
+		}
+	}
+}
+
+func TestIMAPStatusValue(t *testing.T) {
+	text := `* STATUS "INBOX" (MESSAGES 231 UNSEEN 7)`
+
+	if value, ok := imapStatusValue(text, "MESSAGES"); !ok || value != 231 {
+		t.Errorf("expected 231 messages, got %d, %v", value, ok)
+	}
+
+	if value, ok := imapStatusValue(text, "UNSEEN"); !ok || value != 7 {
+		t.Errorf("expected 7 unseen, got %d, %v", value, ok)
+	}
+
+	if _, ok := imapStatusValue(text, "RECENT"); ok {
+		t.Error("expected a missing item to not be found")
+	}
+}
+
+func TestIMAPQuote(t *testing.T) {
+	if got := imapQuote(`pass"word\`); got != `"pass\"word\\"` {
+		t.Errorf("unexpected quoting %s", got)
+	}
+}
+
+// Plays the server side of a conversation, replying to each command with the
+// given lines followed by the tagged completion
+func serveIMAPTest(t *testing.T, conn net.Conn, replies [][]string) {
+	reader := bufio.NewReader(conn)
+
+	for _, lines := range replies {
+		command, err := reader.ReadString('\n')
+		if err != nil {
+			t.Errorf("reading command: %v", err)
+			return
+		}
+
+		tag, _, _ := strings.Cut(command, " ")
+		for _, line := range lines {
+			conn.Write([]byte(strings.ReplaceAll(line, "TAG", tag)))
+		}
+	}
+}
+
+func TestIMAPFetchHeaders(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	server.SetDeadline(time.Now().Add(5 * time.Second))
+
+	first := "Subject: Hello\r\nFrom: Jane <jane@example.com>\r\n\r\n"
+	second := "Subject: =?UTF-8?B?w6nDqQ==?=\r\n\r\n"
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serveIMAPTest(t, server, [][]string{
+			{
+				"* 12 FETCH (FLAGS (\\Seen \\Answered) BODY[HEADER.FIELDS (SUBJECT FROM)] {" + strconv.Itoa(len(first)) + "}\r\n",
+				first + ")\r\n",
+				// flags can come after the literal
+				"* 13 FETCH (BODY[HEADER.FIELDS (SUBJECT FROM)] {" + strconv.Itoa(len(second)) + "}\r\n",
+				second + " FLAGS ())\r\n",
+				"* 14 EXPUNGE\r\n",
+				"TAG OK FETCH completed\r\n",
+			},
+			{
+				"TAG NO [NONEXISTENT] Unknown mailbox\r\n",
+			},
+		})
+	}()
+
+	conn := &imapConn{conn: client, reader: bufio.NewReader(client)}
+
+	messages, err := conn.fetchHeaders("12:13", "SUBJECT", "FROM")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(messages))
+	}
+
+	if messages[0].seqNum != 12 || !slices.Equal(messages[0].flags, []string{`\Seen`, `\Answered`}) || string(messages[0].header) != first {
+		t.Errorf("unexpected first message %+v", messages[0])
+	}
+
+	if messages[1].seqNum != 13 || len(messages[1].flags) != 0 || string(messages[1].header) != second {
+		t.Errorf("unexpected second message %+v", messages[1])
+	}
+
+	parsed := parseEmailMessage(&messages[0])
+	if parsed.Unread || parsed.Subject != "Hello" || parsed.From != "Jane" || parsed.FromEmail != "jane@example.com" {
+		t.Errorf("unexpected parsed message %+v", parsed)
+	}
+
+	if parsed := parseEmailMessage(&messages[1]); !parsed.Unread || parsed.Subject != "éé" {
+		t.Errorf("unexpected parsed message %+v", parsed)
+	}
+
+	var imapErr *imapError
+	if err := conn.examine("Missing"); !errors.As(err, &imapErr) || imapErr.Status != "NO" {
+		t.Errorf("expected a NO response, got %v", err)
+	}
+
+	<-done
+}
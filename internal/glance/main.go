@@ -19,13 +19,13 @@ func Main() int {
 		return 1
 	}
 
-	_pwd, _ := os.Getwd()
-	fmt.Println("pwd: "+ _pwd)
-
 	switch options.intent {
 	case cliIntentVersionPrint:
 		fmt.Println(buildVersion)
 	case cliIntentServe:
+		_pwd, _ := os.Getwd()
+		fmt.Println("pwd: " + _pwd)
+
 		// remove in v0.10.0
 		if serveUpdateNoticeIfConfigLocationNotMigrated(options.configPath) {
 			return 1
@@ -42,8 +42,11 @@ func Main() int {
 			return 1
 		}
 
-		if _, err := newConfigFromYAML(contents); err != nil {
-			fmt.Printf("Config file is invalid: %v\n", err)
+		if diagnostics := validateConfigContents(contents); len(diagnostics) > 0 {
+			fmt.Println("Config file is invalid:")
+			for _, diagnostic := range diagnostics {
+				fmt.Printf("  %s\n", diagnostic)
+			}
 			return 1
 		}
 	case cliIntentConfigPrint:
@@ -60,6 +63,12 @@ func Main() int {
 		return cliMountpointInfo(options.args[1])
 	case cliIntentDiagnose:
 		runDiagnostic()
+	case cliIntentHealthcheck:
+		return cliHealthcheck(options.configPath)
+	case cliIntentMigrate:
+		return cliMigrate(options.args[0], options.args[1])
+	case cliIntentAgent:
+		return cliAgent(options.agent)
 	case cliIntentSecretMake:
 		key, err := makeAuthSecretKey(AUTH_SECRET_KEY_LENGTH)
 		if err != nil {
@@ -100,6 +109,7 @@ func serveApp(configPath string) error {
 	exitChannel := make(chan struct{})
 	hadValidConfigOnStartup := false
 	var stopServer func() error
+	var currentApp *application
 
 	onChange := func(newContents []byte) {
 		if stopServer != nil {
@@ -132,6 +142,12 @@ func serveApp(configPath string) error {
 			hadValidConfigOnStartup = true
 		}
 
+		if currentApp != nil {
+			app.takeOverWidgetContent(currentApp)
+		}
+		currentApp = app
+		app.applyGlobalSettings()
+
 		if stopServer != nil {
 			if err := stopServer(); err != nil {
 				log.Printf("Error while trying to stop server: %v", err)
@@ -173,6 +189,7 @@ func serveApp(configPath string) error {
 			return fmt.Errorf("creating application: %w", err)
 		}
 
+		app.applyGlobalSettings()
 		startServer, _ := app.server()
 		if err := startServer(); err != nil {
 			return fmt.Errorf("starting server: %w", err)
@@ -204,7 +221,7 @@ func serveUpdateNoticeIfConfigLocationNotMigrated(configPath string) bool {
 	fmt.Println("The default location of glance.yml in the Docker image has changed starting from v0.7.0.")
 	fmt.Println("Please see https://github.com/glanceapp/glance/blob/main/docs/v0.7.0-upgrade.md for more information.")
 	_pwd, _ := os.Getwd()
-	fmt.Printf("pwd: "+ _pwd)
+	fmt.Println("pwd: " + _pwd)
 
 	mux := http.NewServeMux()
 	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
@@ -0,0 +1,210 @@
+package glance
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A small markdown renderer for user provided content. It never lets any HTML
+// from the source through, everything gets escaped before the markup is
+// applied, so the output is safe to insert into the page as is.
+//
+// Supports headings, paragraphs, emphasis, strikethrough, inline code, code
+// blocks, links, lists, task lists, blockquotes and horizontal rules.
+
+var (
+	markdownHeadingPattern     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	markdownRulePattern        = regexp.MustCompile(`^ {0,3}(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	markdownListItemPattern    = regexp.MustCompile(`^\s*([-*+]|\d{1,9}[.)])\s+(.*)$`)
+	markdownTaskPattern        = regexp.MustCompile(`^\[([ xX])\]\s+(.*)$`)
+	markdownLinkPattern        = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	markdownAutolinkPattern    = regexp.MustCompile(`https?://[^\s<>]*[^\s<>.,:;"')\]]`)
+	markdownBoldPattern        = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	markdownItalicPattern      = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+	markdownStrikePattern      = regexp.MustCompile(`~~([^~]+)~~`)
+	markdownPlaceholderPattern = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+func renderMarkdown(source string) template.HTML {
+	// NUL is used to mark the placeholders of inline markup, the same as in
+	// CommonMark it gets replaced with the replacement character
+	source = strings.ReplaceAll(source, "\x00", "\uFFFD")
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+	var out strings.Builder
+
+	renderMarkdownBlocks(lines, &out)
+
+	return template.HTML(out.String())
+}
+
+func renderMarkdownBlocks(lines []string, out *strings.Builder) {
+	paragraph := make([]string, 0)
+
+	flushParagraph := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+
+		out.WriteString("<p>")
+		for i := range paragraph {
+			if i > 0 {
+				out.WriteString("<br>")
+			}
+			out.WriteString(renderMarkdownInline(paragraph[i]))
+		}
+		out.WriteString("</p>")
+		paragraph = paragraph[:0]
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flushParagraph()
+
+		case strings.HasPrefix(trimmed, "```"):
+			flushParagraph()
+			code := make([]string, 0)
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			out.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>")
+
+		case markdownHeadingPattern.MatchString(trimmed):
+			flushParagraph()
+			matches := markdownHeadingPattern.FindStringSubmatch(trimmed)
+			level := strconv.Itoa(len(matches[1]))
+			out.WriteString("<h" + level + ">" + renderMarkdownInline(matches[2]) + "</h" + level + ">")
+
+		case markdownRulePattern.MatchString(line):
+			flushParagraph()
+			out.WriteString("<hr>")
+
+		case strings.HasPrefix(trimmed, ">"):
+			flushParagraph()
+			quoted := make([]string, 0)
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				content := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quoted = append(quoted, strings.TrimPrefix(content, " "))
+			}
+			i--
+			out.WriteString("<blockquote>")
+			renderMarkdownBlocks(quoted, out)
+			out.WriteString("</blockquote>")
+
+		case markdownListItemPattern.MatchString(line):
+			flushParagraph()
+			ordered := !strings.ContainsAny(markdownListItemPattern.FindStringSubmatch(line)[1], "-*+")
+			out.WriteString(ternary(ordered, "<ol>", "<ul>"))
+			for ; i < len(lines) && markdownListItemPattern.MatchString(lines[i]); i++ {
+				out.WriteString(renderMarkdownListItem(markdownListItemPattern.FindStringSubmatch(lines[i])[2]))
+			}
+			i--
+			out.WriteString(ternary(ordered, "</ol>", "</ul>"))
+
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+
+	flushParagraph()
+}
+
+func renderMarkdownListItem(content string) string {
+	matches := markdownTaskPattern.FindStringSubmatch(content)
+	if matches == nil {
+		return "<li>" + renderMarkdownInline(content) + "</li>"
+	}
+
+	checked := ternary(matches[1] != " ", " checked", "")
+	return `<li class="markdown-task"><input type="checkbox" disabled` + checked + `> ` + renderMarkdownInline(matches[2]) + "</li>"
+}
+
+func renderMarkdownInline(text string) string {
+	placeholders := make([]string, 0)
+	placeholder := func(rendered string) string {
+		placeholders = append(placeholders, rendered)
+		return fmt.Sprintf("\x00%d\x00", len(placeholders)-1)
+	}
+
+	// code spans first since nothing within them should be interpreted
+	var withoutCode strings.Builder
+	for {
+		start := strings.Index(text, "`")
+		if start == -1 {
+			break
+		}
+
+		end := strings.Index(text[start+1:], "`")
+		if end == -1 {
+			break
+		}
+
+		withoutCode.WriteString(text[:start])
+		withoutCode.WriteString(placeholder("<code>" + html.EscapeString(text[start+1:start+1+end]) + "</code>"))
+		text = text[start+1+end+1:]
+	}
+	withoutCode.WriteString(text)
+	text = withoutCode.String()
+
+	text = markdownLinkPattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := markdownLinkPattern.FindStringSubmatch(match)
+		if !isSafeMarkdownURL(parts[2]) {
+			return parts[1]
+		}
+
+		return placeholder(markdownLink(parts[2], applyMarkdownEmphasis(html.EscapeString(parts[1]))))
+	})
+
+	text = markdownAutolinkPattern.ReplaceAllStringFunc(text, func(match string) string {
+		return placeholder(markdownLink(match, html.EscapeString(match)))
+	})
+
+	text = applyMarkdownEmphasis(html.EscapeString(text))
+
+	return markdownPlaceholderPattern.ReplaceAllStringFunc(text, func(match string) string {
+		index, err := strconv.Atoi(strings.Trim(match, "\x00"))
+		if err != nil || index >= len(placeholders) {
+			return match
+		}
+
+		return placeholders[index]
+	})
+}
+
+func applyMarkdownEmphasis(text string) string {
+	text = markdownBoldPattern.ReplaceAllString(text, "<strong>$1$2</strong>")
+	text = markdownItalicPattern.ReplaceAllString(text, "<em>$1</em>")
+	text = markdownStrikePattern.ReplaceAllString(text, "<del>$1</del>")
+
+	return text
+}
+
+func markdownLink(href string, content string) string {
+	return `<a href="` + html.EscapeString(href) + `" target="_blank" rel="noreferrer">` + content + `</a>`
+}
+
+func isSafeMarkdownURL(rawURL string) bool {
+	if strings.HasPrefix(rawURL, "/") || strings.HasPrefix(rawURL, "#") {
+		return true
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,101 @@
+package glance
+
+import "testing"
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{
+			name:     "heading",
+			source:   "# Title",
+			expected: "<h1>Title</h1>",
+		},
+		{
+			name:     "emphasis",
+			source:   "**bold** and *italic* and ~~gone~~",
+			expected: "<p><strong>bold</strong> and <em>italic</em> and <del>gone</del></p>",
+		},
+		{
+			name:     "html is escaped",
+			source:   "<script>alert(1)</script>",
+			expected: "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>",
+		},
+		{
+			name:     "inline code is escaped and not interpreted",
+			source:   "`<b>**x**</b>` code",
+			expected: "<p><code>&lt;b&gt;**x**&lt;/b&gt;</code> code</p>",
+		},
+		{
+			name:     "link",
+			source:   "[link](https://example.com)",
+			expected: `<p><a href="https://example.com" target="_blank" rel="noreferrer">link</a></p>`,
+		},
+		{
+			name:     "unsafe link is dropped",
+			source:   "[bad](javascript:alert)",
+			expected: "<p>bad</p>",
+		},
+		{
+			name:     "autolink leaves out trailing punctuation",
+			source:   "see https://example.com.",
+			expected: `<p>see <a href="https://example.com" target="_blank" rel="noreferrer">https://example.com</a>.</p>`,
+		},
+		{
+			name:     "task list",
+			source:   "- [x] done\n- [ ] todo",
+			expected: `<ul><li class="markdown-task"><input type="checkbox" disabled checked> done</li><li class="markdown-task"><input type="checkbox" disabled> todo</li></ul>`,
+		},
+		{
+			name:     "ordered list",
+			source:   "1. one\n2. two",
+			expected: "<ol><li>one</li><li>two</li></ol>",
+		},
+		{
+			name:     "blockquote",
+			source:   "> quoted",
+			expected: "<blockquote><p>quoted</p></blockquote>",
+		},
+		{
+			name:     "horizontal rule",
+			source:   "---",
+			expected: "<hr>",
+		},
+		{
+			name:     "code block",
+			source:   "```\n<b>\n```",
+			expected: "<pre><code>&lt;b&gt;</code></pre>",
+		},
+		{
+			name:     "paragraphs and line breaks",
+			source:   "line one\r\nline two\n\nnext",
+			expected: "<p>line one<br>line two</p><p>next</p>",
+		},
+		{
+			name:     "nul characters can't reference placeholders",
+			source:   "hello \x007\x00 world",
+			expected: "<p>hello �7� world</p>",
+		},
+		{
+			name:     "nul characters next to inline markup",
+			source:   "`a` \x000\x00",
+			expected: "<p><code>a</code> �0�</p>",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(renderMarkdown(test.source)); got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownInlineIgnoresUnknownPlaceholders(t *testing.T) {
+	if got := renderMarkdownInline("hello \x007\x00 world"); got != "hello \x007\x00 world" {
+		t.Errorf("expected the text to be left as is, got %q", got)
+	}
+}
@@ -0,0 +1,234 @@
+package glance
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// There's only a handful of metrics, so they're written out in the Prometheus
+// text format directly rather than through the client library
+var metricsDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type durationHistogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *durationHistogram) observe(d time.Duration) {
+	if h.buckets == nil {
+		h.buckets = make([]uint64, len(metricsDurationBuckets))
+	}
+
+	seconds := d.Seconds()
+	for i, bound := range metricsDurationBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+
+	h.count++
+	h.sum += seconds
+}
+
+// Kept outside of the application so that the counters don't reset when the
+// config gets reloaded
+var metrics = struct {
+	sync.Mutex
+	widgetUpdateDurations map[string]*durationHistogram
+	widgetUpdateErrors    map[string]uint64
+	widgetUpdatePartials  map[string]uint64
+	pageRenderDurations   map[string]*durationHistogram
+}{
+	widgetUpdateDurations: make(map[string]*durationHistogram),
+	widgetUpdateErrors:    make(map[string]uint64),
+	widgetUpdatePartials:  make(map[string]uint64),
+	pageRenderDurations:   make(map[string]*durationHistogram),
+}
+
+var (
+	workerPoolQueuedTasks atomic.Int64
+	workerPoolActiveTasks atomic.Int64
+)
+
+func recordWidgetUpdateMetrics(w widget, duration time.Duration) {
+	base := w.base()
+
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	histogram, exists := metrics.widgetUpdateDurations[base.Type]
+	if !exists {
+		histogram = &durationHistogram{}
+		metrics.widgetUpdateDurations[base.Type] = histogram
+	}
+	histogram.observe(duration)
+
+	if base.Error != nil {
+		metrics.widgetUpdateErrors[base.Type]++
+	} else if base.Notice != nil {
+		metrics.widgetUpdatePartials[base.Type]++
+	}
+}
+
+func recordPageRenderMetrics(slug string, duration time.Duration) {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	histogram, exists := metrics.pageRenderDurations[slug]
+	if !exists {
+		histogram = &durationHistogram{}
+		metrics.pageRenderDurations[slug] = histogram
+	}
+	histogram.observe(duration)
+}
+
+type metricsWriter struct {
+	bytes.Buffer
+}
+
+func (m *metricsWriter) header(name, metricType, help string) {
+	fmt.Fprintf(m, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// Labels are given as name, value pairs
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	m.WriteString(name)
+
+	if len(labels) > 0 {
+		m.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.WriteByte(',')
+			}
+			m.WriteString(labels[i])
+			m.WriteString(`="`)
+			m.WriteString(metricsLabelEscaper.Replace(labels[i+1]))
+			m.WriteByte('"')
+		}
+		m.WriteByte('}')
+	}
+
+	m.WriteByte(' ')
+	m.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	m.WriteByte('\n')
+}
+
+var metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (m *metricsWriter) histograms(name, help, label string, histograms map[string]*durationHistogram) {
+	m.header(name, "histogram", help)
+
+	for _, key := range slices.Sorted(maps.Keys(histograms)) {
+		h := histograms[key]
+
+		for i, bound := range metricsDurationBuckets {
+			m.sample(name+"_bucket", float64(h.buckets[i]), label, key, "le", strconv.FormatFloat(bound, 'g', -1, 64))
+		}
+
+		m.sample(name+"_bucket", float64(h.count), label, key, "le", "+Inf")
+		m.sample(name+"_sum", h.sum, label, key)
+		m.sample(name+"_count", float64(h.count), label, key)
+	}
+}
+
+func (m *metricsWriter) counters(name, help, label string, counters map[string]uint64) {
+	m.header(name, "counter", help)
+
+	for _, key := range slices.Sorted(maps.Keys(counters)) {
+		m.sample(name, float64(counters[key]), label, key)
+	}
+}
+
+func (a *application) writeMetrics(m *metricsWriter) {
+	metrics.Lock()
+	m.histograms("glance_widget_update_duration_seconds", "How long widget updates take.", "type", metrics.widgetUpdateDurations)
+	m.counters("glance_widget_update_errors_total", "Widget updates which failed to get any content.", "type", metrics.widgetUpdateErrors)
+	m.counters("glance_widget_update_partial_total", "Widget updates which only got some of their content.", "type", metrics.widgetUpdatePartials)
+	m.histograms("glance_page_render_duration_seconds", "How long pages take to render, including updating their widgets.", "page", metrics.pageRenderDurations)
+	metrics.Unlock()
+
+	// widgets only get updated once their page is opened, the ones which haven't
+	// been yet are counted as being up rather than setting off alerts
+	m.header("glance_widget_up", "gauge", "Whether the last update of the widget succeeded.")
+	// written after all of the up samples since samples of a metric have to be together
+	type lastSuccessSample struct {
+		labels []string
+		time   time.Time
+	}
+	lastSuccess := make([]lastSuccessSample, 0)
+
+	for i := range a.Config.Pages {
+		page := &a.Config.Pages[i]
+
+		page.mu.Lock()
+		forEachPageWidget(page, func(w widget) bool {
+			base := w.base()
+			if base.cacheType == cacheTypeInfinite {
+				return true
+			}
+
+			labels := []string{"id", strconv.FormatUint(base.ID, 10), "type", base.Type, "title", base.Title, "page", page.Slug}
+			m.sample("glance_widget_up", float64(ternary(base.Error == nil, 1, 0)), labels...)
+
+			if !base.lastSucceeded.IsZero() {
+				lastSuccess = append(lastSuccess, lastSuccessSample{labels, base.lastSucceeded})
+			}
+			return true
+		})
+		page.mu.Unlock()
+	}
+
+	m.header("glance_widget_last_success_timestamp_seconds", "gauge", "When the widget was last updated successfully.")
+	for _, sample := range lastSuccess {
+		m.sample("glance_widget_last_success_timestamp_seconds", float64(sample.time.Unix()), sample.labels...)
+	}
+
+	m.header("glance_worker_pool_queued_tasks", "gauge", "Tasks waiting for a worker, such as feeds which are yet to be fetched.")
+	m.sample("glance_worker_pool_queued_tasks", float64(workerPoolQueuedTasks.Load()))
+	m.header("glance_worker_pool_active_tasks", "gauge", "Tasks currently being run by a worker.")
+	m.sample("glance_worker_pool_active_tasks", float64(workerPoolActiveTasks.Load()))
+
+	if a.imageCache == nil {
+		return
+	}
+
+	stats := a.imageCache.stats()
+	m.header("glance_image_cache_hits_total", "counter", "Requests for images which were already cached.")
+	m.sample("glance_image_cache_hits_total", float64(stats.Hits))
+	m.header("glance_image_cache_misses_total", "counter", "Requests for images which had to be downloaded.")
+	m.sample("glance_image_cache_misses_total", float64(stats.Misses))
+	m.header("glance_image_cache_files", "gauge", "Images in the cache.")
+	m.sample("glance_image_cache_files", float64(stats.Files))
+	m.header("glance_image_cache_size_bytes", "gauge", "Size of the images in the cache.")
+	m.sample("glance_image_cache_size_bytes", float64(stats.SizeBytes))
+	m.header("glance_image_cache_max_size_bytes", "gauge", "Size that the cache gets cleaned up at.")
+	m.sample("glance_image_cache_max_size_bytes", float64(stats.MaxSizeBytes))
+}
+
+func (a *application) handleMetricsRequest(w http.ResponseWriter, r *http.Request) {
+	if token := a.Config.Metrics.Token; token != "" {
+		provided, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	} else if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	var m metricsWriter
+	a.writeMetrics(&m)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(m.Bytes())
+}
@@ -0,0 +1,504 @@
+package glance
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	migrateSourceHomepage = "homepage"
+	migrateSourceHomer    = "homer"
+	migrateSourceDashy    = "dashy"
+)
+
+var migrateSources = []string{migrateSourceHomepage, migrateSourceHomer, migrateSourceDashy}
+
+type migratedConfig struct {
+	Pages []migratedPage `yaml:"pages"`
+}
+
+type migratedPage struct {
+	Name    string           `yaml:"name"`
+	Columns []migratedColumn `yaml:"columns"`
+}
+
+type migratedColumn struct {
+	Size    string           `yaml:"size"`
+	Widgets []migratedWidget `yaml:"widgets"`
+}
+
+// Only contains the properties of the widgets that we know how to map to,
+// makes the output a lot more readable than marshaling a map
+type migratedWidget struct {
+	Type        string              `yaml:"type"`
+	Title       string              `yaml:"title,omitempty"`
+	Service     string              `yaml:"service,omitempty"`
+	URL         string              `yaml:"url,omitempty"`
+	InstanceURL string              `yaml:"instance-url,omitempty"`
+	Username    string              `yaml:"username,omitempty"`
+	Password    string              `yaml:"password,omitempty"`
+	Token       string              `yaml:"token,omitempty"`
+	Location    string              `yaml:"location,omitempty"`
+	Feeds       []migratedFeed      `yaml:"feeds,omitempty"`
+	Sites       []migratedLink      `yaml:"sites,omitempty"`
+	Groups      []migratedLinkGroup `yaml:"groups,omitempty"`
+}
+
+type migratedFeed struct {
+	URL   string `yaml:"url"`
+	Title string `yaml:"title,omitempty"`
+}
+
+type migratedLink struct {
+	Title       string `yaml:"title"`
+	URL         string `yaml:"url"`
+	Description string `yaml:"description,omitempty"`
+	Icon        string `yaml:"icon,omitempty"`
+}
+
+type migratedLinkGroup struct {
+	Title string         `yaml:"title,omitempty"`
+	Links []migratedLink `yaml:"links"`
+}
+
+type migrationResult struct {
+	widgets  []migratedWidget
+	warnings []string
+}
+
+func (r *migrationResult) warn(format string, args ...any) {
+	r.warnings = append(r.warnings, fmt.Sprintf(format, args...))
+}
+
+func cliMigrate(source, path string) int {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("Could not read %s: %v\n", path, err)
+		return 1
+	}
+
+	var result *migrationResult
+
+	switch source {
+	case migrateSourceHomepage:
+		result, err = migrateFromHomepage(contents)
+	case migrateSourceHomer:
+		result, err = migrateFromHomer(contents)
+	case migrateSourceDashy:
+		result, err = migrateFromDashy(contents)
+	default:
+		fmt.Printf("Unknown source %s, must be one of: %s\n", source, strings.Join(migrateSources, ", "))
+		return 1
+	}
+
+	if err != nil {
+		fmt.Printf("Could not migrate config: %v\n", err)
+		return 1
+	}
+
+	if len(result.widgets) == 0 {
+		fmt.Println("Could not find anything to migrate")
+		return 1
+	}
+
+	var output bytes.Buffer
+	encoder := yaml.NewEncoder(&output)
+	encoder.SetIndent(2)
+
+	err = encoder.Encode(&migratedConfig{
+		Pages: []migratedPage{{
+			Name: "Home",
+			Columns: []migratedColumn{{
+				Size:    "full",
+				Widgets: result.widgets,
+			}},
+		}},
+	})
+	if err != nil {
+		fmt.Printf("Could not encode migrated config: %v\n", err)
+		return 1
+	}
+
+	// Warnings go to stderr so that the output can be redirected straight into a file
+	for _, warning := range result.warnings {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
+
+	fmt.Print(output.String())
+	return 0
+}
+
+// Converts the icon formats used by other dashboards into the prefixes we support,
+// returns an empty string for icons that we can't map such as font awesome classes
+func migrateIcon(icon string) string {
+	icon = strings.TrimSpace(icon)
+
+	if icon == "" || strings.HasPrefix(icon, "http://") || strings.HasPrefix(icon, "https://") || strings.HasPrefix(icon, "/") {
+		return icon
+	}
+
+	for _, prefix := range []string{"mdi", "si", "sh"} {
+		if name, found := strings.CutPrefix(icon, prefix+"-"); found {
+			return prefix + ":" + name
+		}
+	}
+
+	// Dashy's homelab icons are the dashboard icons
+	if name, found := strings.CutPrefix(icon, "hl-"); found {
+		return "di:" + name
+	}
+
+	if strings.HasPrefix(icon, "fa") && strings.Contains(icon, " ") || icon == "favicon" {
+		return ""
+	}
+
+	// Relative paths such as Homer's assets/tools/icon.png
+	if strings.Contains(icon, "/") {
+		return icon
+	}
+
+	// Homepage uses bare names of dashboard icons, e.g. sonarr.png
+	return "di:" + icon
+}
+
+func yamlString(m map[string]any, key string) string {
+	value, ok := m[key]
+	if !ok || value == nil {
+		return ""
+	}
+
+	if s, ok := value.(string); ok {
+		return s
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+func yamlMap(m map[string]any, key string) map[string]any {
+	value, _ := m[key].(map[string]any)
+	return value
+}
+
+//
+// Homepage (gethomepage.dev)
+//
+
+// Services and bookmarks in Homepage share the same shape, a list of named groups
+// containing a list of named items, with the difference being that service items
+// are maps while bookmark items are lists, so the same parser works on both
+// services.yaml and bookmarks.yaml
+func migrateFromHomepage(contents []byte) (*migrationResult, error) {
+	var groups []map[string][]map[string]any
+	if err := yaml.Unmarshal(contents, &groups); err != nil {
+		return nil, fmt.Errorf("parsing homepage config: %v", err)
+	}
+
+	result := &migrationResult{}
+	var linkGroups []migratedLinkGroup
+
+	for _, group := range groups {
+		for groupName, items := range group {
+			var sites []migratedLink
+			var bookmarks []migratedLink
+
+			for _, item := range items {
+				for itemName, value := range item {
+					switch properties := value.(type) {
+					case map[string]any:
+						link := migratedLink{
+							Title: itemName,
+							URL:   yamlString(properties, "href"),
+							Icon:  migrateIcon(yamlString(properties, "icon")),
+						}
+
+						if link.URL != "" {
+							sites = append(sites, link)
+						}
+
+						if widgetProperties := yamlMap(properties, "widget"); widgetProperties != nil {
+							if w, ok := migrateHomepageServiceWidget(itemName, widgetProperties, result); ok {
+								result.widgets = append(result.widgets, w)
+							}
+						}
+					case []any:
+						if len(properties) == 0 {
+							continue
+						}
+
+						bookmark, _ := properties[0].(map[string]any)
+						if bookmark == nil {
+							continue
+						}
+
+						bookmarks = append(bookmarks, migratedLink{
+							Title:       itemName,
+							URL:         yamlString(bookmark, "href"),
+							Description: yamlString(bookmark, "description"),
+							Icon:        migrateIcon(yamlString(bookmark, "icon")),
+						})
+					}
+				}
+			}
+
+			if len(sites) > 0 {
+				result.widgets = append(result.widgets, migratedWidget{
+					Type:  "monitor",
+					Title: groupName,
+					Sites: sites,
+				})
+			}
+
+			if len(bookmarks) > 0 {
+				linkGroups = append(linkGroups, migratedLinkGroup{
+					Title: groupName,
+					Links: bookmarks,
+				})
+			}
+		}
+	}
+
+	if len(linkGroups) > 0 {
+		result.widgets = append(result.widgets, migratedWidget{
+			Type:   "bookmarks",
+			Groups: linkGroups,
+		})
+	}
+
+	return result, nil
+}
+
+func migrateHomepageServiceWidget(name string, properties map[string]any, result *migrationResult) (migratedWidget, bool) {
+	widgetType := yamlString(properties, "type")
+	url := yamlString(properties, "url")
+
+	switch widgetType {
+	case "pihole":
+		service := ternary(yamlString(properties, "version") == "6", dnsServicePiholeV6, dnsServicePihole)
+		return migratedWidget{
+			Type:     "dns-stats",
+			Title:    name,
+			Service:  service,
+			URL:      url,
+			Token:    ternary(service == dnsServicePihole, yamlString(properties, "key"), ""),
+			Password: ternary(service == dnsServicePiholeV6, yamlString(properties, "key"), ""),
+		}, true
+	case "adguard":
+		return migratedWidget{
+			Type:     "dns-stats",
+			Title:    name,
+			Service:  dnsServiceAdguard,
+			URL:      url,
+			Username: yamlString(properties, "username"),
+			Password: yamlString(properties, "password"),
+		}, true
+	case "technitium":
+		return migratedWidget{
+			Type:    "dns-stats",
+			Title:   name,
+			Service: dnsServiceTechnitium,
+			URL:     url,
+			Token:   yamlString(properties, "key"),
+		}, true
+	case "changedetectionio":
+		return migratedWidget{
+			Type:        "change-detection",
+			Title:       name,
+			InstanceURL: url,
+			Token:       yamlString(properties, "key"),
+		}, true
+	}
+
+	result.warn("service %s: no equivalent widget for homepage widget type %s, skipping", name, widgetType)
+	return migratedWidget{}, false
+}
+
+//
+// Homer
+//
+
+type homerConfigYaml struct {
+	Services []struct {
+		Name  string `yaml:"name"`
+		Items []struct {
+			Name     string `yaml:"name"`
+			Subtitle string `yaml:"subtitle"`
+			Logo     string `yaml:"logo"`
+			Icon     string `yaml:"icon"`
+			URL      string `yaml:"url"`
+			Type     string `yaml:"type"`
+			APIKey   string `yaml:"apikey"`
+			Endpoint string `yaml:"endpoint"`
+		} `yaml:"items"`
+	} `yaml:"services"`
+	Links []struct {
+		Name string `yaml:"name"`
+		URL  string `yaml:"url"`
+	} `yaml:"links"`
+}
+
+func migrateFromHomer(contents []byte) (*migrationResult, error) {
+	var config homerConfigYaml
+	if err := yaml.Unmarshal(contents, &config); err != nil {
+		return nil, fmt.Errorf("parsing homer config: %v", err)
+	}
+
+	result := &migrationResult{}
+	groups := make([]migratedLinkGroup, 0, len(config.Services))
+
+	for _, service := range config.Services {
+		group := migratedLinkGroup{Title: service.Name}
+
+		for _, item := range service.Items {
+			group.Links = append(group.Links, migratedLink{
+				Title:       item.Name,
+				URL:         item.URL,
+				Description: item.Subtitle,
+				Icon:        migrateIcon(ternary(item.Logo != "", item.Logo, item.Icon)),
+			})
+
+			url := ternary(item.Endpoint != "", item.Endpoint, item.URL)
+
+			switch strings.ToLower(item.Type) {
+			case "":
+			case "pihole":
+				result.widgets = append(result.widgets, migratedWidget{
+					Type:    "dns-stats",
+					Title:   item.Name,
+					Service: dnsServicePihole,
+					URL:     url,
+					Token:   item.APIKey,
+				})
+			case "adguardhome":
+				result.widgets = append(result.widgets, migratedWidget{
+					Type:    "dns-stats",
+					Title:   item.Name,
+					Service: dnsServiceAdguard,
+					URL:     url,
+				})
+				result.warn("service %s: adguard credentials must be added manually", item.Name)
+			default:
+				result.warn("service %s: no equivalent widget for homer type %s, skipping", item.Name, item.Type)
+			}
+		}
+
+		if len(group.Links) > 0 {
+			groups = append(groups, group)
+		}
+	}
+
+	if len(config.Links) > 0 {
+		group := migratedLinkGroup{Title: "Links"}
+		for _, link := range config.Links {
+			group.Links = append(group.Links, migratedLink{Title: link.Name, URL: link.URL})
+		}
+		groups = append(groups, group)
+	}
+
+	if len(groups) > 0 {
+		// Prepend, homer is primarily a links dashboard and the bookmarks are the main content
+		result.widgets = append([]migratedWidget{{Type: "bookmarks", Groups: groups}}, result.widgets...)
+	}
+
+	return result, nil
+}
+
+//
+// Dashy
+//
+
+type dashyConfigYaml struct {
+	Sections []struct {
+		Name  string `yaml:"name"`
+		Items []struct {
+			Title       string `yaml:"title"`
+			Description string `yaml:"description"`
+			URL         string `yaml:"url"`
+			Icon        string `yaml:"icon"`
+		} `yaml:"items"`
+		Widgets []struct {
+			Type    string         `yaml:"type"`
+			Options map[string]any `yaml:"options"`
+		} `yaml:"widgets"`
+	} `yaml:"sections"`
+}
+
+func migrateFromDashy(contents []byte) (*migrationResult, error) {
+	var config dashyConfigYaml
+	if err := yaml.Unmarshal(contents, &config); err != nil {
+		return nil, fmt.Errorf("parsing dashy config: %v", err)
+	}
+
+	if len(config.Sections) == 0 {
+		return nil, errors.New("no sections found")
+	}
+
+	result := &migrationResult{}
+	var groups []migratedLinkGroup
+
+	for _, section := range config.Sections {
+		group := migratedLinkGroup{Title: section.Name}
+
+		for _, item := range section.Items {
+			group.Links = append(group.Links, migratedLink{
+				Title:       item.Title,
+				URL:         item.URL,
+				Description: item.Description,
+				Icon:        migrateIcon(item.Icon),
+			})
+		}
+
+		if len(group.Links) > 0 {
+			groups = append(groups, group)
+		}
+
+		for _, w := range section.Widgets {
+			options := w.Options
+			if options == nil {
+				options = map[string]any{}
+			}
+
+			switch w.Type {
+			case "clock":
+				result.widgets = append(result.widgets, migratedWidget{Type: "clock"})
+			case "weather", "weather-forecast":
+				result.widgets = append(result.widgets, migratedWidget{
+					Type:     "weather",
+					Location: yamlString(options, "city"),
+				})
+			case "rss-feed":
+				result.widgets = append(result.widgets, migratedWidget{
+					Type:  "rss",
+					Feeds: []migratedFeed{{URL: yamlString(options, "rssUrl")}},
+				})
+			case "pi-hole-stats":
+				result.widgets = append(result.widgets, migratedWidget{
+					Type:    "dns-stats",
+					Service: dnsServicePihole,
+					URL:     yamlString(options, "hostname"),
+					Token:   yamlString(options, "apiKey"),
+				})
+			case "adguard-stats":
+				result.widgets = append(result.widgets, migratedWidget{
+					Type:     "dns-stats",
+					Service:  dnsServiceAdguard,
+					URL:      yamlString(options, "hostname"),
+					Username: yamlString(options, "username"),
+					Password: yamlString(options, "password"),
+				})
+			default:
+				result.warn("section %s: no equivalent widget for dashy widget type %s, skipping", section.Name, w.Type)
+			}
+		}
+	}
+
+	if len(groups) > 0 {
+		result.widgets = append([]migratedWidget{{Type: "bookmarks", Groups: groups}}, result.widgets...)
+	}
+
+	return result, nil
+}
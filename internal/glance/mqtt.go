@@ -0,0 +1,347 @@
+package glance
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A minimal MQTT 3.1.1 client which only supports what's needed to watch
+// topics: connecting, subscribing and receiving messages with QoS 0 or 1
+
+const (
+	mqttPacketConnect     = 1
+	mqttPacketConnAck     = 2
+	mqttPacketPublish     = 3
+	mqttPacketPubAck      = 4
+	mqttPacketSubscribe   = 8
+	mqttPacketSubAck      = 9
+	mqttPacketPingReq     = 12
+	mqttPacketPingResp    = 13
+	mqttPacketDisconnect  = 14
+	mqttMaxPacketSize     = 1 << 20
+	mqttDefaultPort       = "1883"
+	mqttDefaultSecurePort = "8883"
+)
+
+var mqttConnectErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad username or password",
+	5: "not authorized",
+}
+
+type mqttConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+}
+
+type mqttMessage struct {
+	topic   string
+	payload []byte
+}
+
+type mqttConnectOptions struct {
+	clientID      string
+	username      string
+	password      string
+	keepAlive     time.Duration
+	allowInsecure bool
+}
+
+// Accepts URLs with the mqtt, tcp, mqtts, ssl and tls schemes, as well as a
+// plain host with an optional port
+func parseMQTTBrokerURL(broker string) (string, bool, error) {
+	if !strings.Contains(broker, "://") {
+		broker = "mqtt://" + broker
+	}
+
+	parsed, err := url.Parse(broker)
+	if err != nil {
+		return "", false, err
+	}
+
+	var secure bool
+
+	switch parsed.Scheme {
+	case "mqtt", "tcp":
+	case "mqtts", "ssl", "tls":
+		secure = true
+	default:
+		return "", false, fmt.Errorf("unsupported scheme %q", parsed.Scheme)
+	}
+
+	if parsed.Hostname() == "" {
+		return "", false, errors.New("missing host")
+	}
+
+	port := parsed.Port()
+	if port == "" {
+		port = ternary(secure, mqttDefaultSecurePort, mqttDefaultPort)
+	}
+
+	return net.JoinHostPort(parsed.Hostname(), port), secure, nil
+}
+
+func dialMQTT(ctx context.Context, address string, secure bool, options *mqttConnectOptions) (*mqttConn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if secure {
+		host, _, _ := net.SplitHostPort(address)
+		conn = tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: options.allowInsecure})
+	}
+
+	c := &mqttConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	conn.SetDeadline(time.Now().Add(15 * time.Second))
+
+	if err := c.connect(options); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	return c, nil
+}
+
+func (c *mqttConn) Close() error {
+	c.writePacket(mqttPacketDisconnect<<4, nil)
+	return c.conn.Close()
+}
+
+func (c *mqttConn) connect(options *mqttConnectOptions) error {
+	var body []byte
+	body = appendMQTTString(body, "MQTT")
+	body = append(body, 4) // protocol level for 3.1.1
+
+	// always start with a clean session since nothing is kept between connections anyway
+	flags := byte(0x02)
+	if options.username != "" {
+		flags |= 0x80
+	}
+	if options.password != "" {
+		flags |= 0x40
+	}
+
+	body = append(body, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(options.keepAlive/time.Second))
+	body = appendMQTTString(body, options.clientID)
+
+	if options.username != "" {
+		body = appendMQTTString(body, options.username)
+	}
+	if options.password != "" {
+		body = appendMQTTString(body, options.password)
+	}
+
+	if err := c.writePacket(mqttPacketConnect<<4, body); err != nil {
+		return err
+	}
+
+	packetType, payload, err := c.readPacket()
+	if err != nil {
+		return fmt.Errorf("reading CONNACK: %v", err)
+	}
+
+	if packetType>>4 != mqttPacketConnAck || len(payload) < 2 {
+		return fmt.Errorf("expected CONNACK, got packet of type %d", packetType>>4)
+	}
+
+	if code := payload[1]; code != 0 {
+		if message, ok := mqttConnectErrors[code]; ok {
+			return fmt.Errorf("connection refused: %s", message)
+		}
+
+		return fmt.Errorf("connection refused with code %d", code)
+	}
+
+	return nil
+}
+
+// The SUBACK gets handled by receive, since messages for the topics can
+// start arriving before it does
+func (c *mqttConn) subscribe(packetID uint16, filters []string) error {
+	body := binary.BigEndian.AppendUint16(nil, packetID)
+
+	for i := range filters {
+		body = appendMQTTString(body, filters[i])
+		body = append(body, 1) // maximum QoS
+	}
+
+	return c.writePacket(mqttPacketSubscribe<<4|0x02, body)
+}
+
+func (c *mqttConn) ping() error {
+	return c.writePacket(mqttPacketPingReq<<4, nil)
+}
+
+// Blocks until a message arrives, acknowledging it if needed and skipping
+// over any other packets. The deadline is extended by the given duration
+// before every read, so the connection is considered dead if nothing at all
+// arrives in that time.
+func (c *mqttConn) receive(timeout time.Duration) (mqttMessage, error) {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(timeout))
+
+		header, body, err := c.readPacket()
+		if err != nil {
+			return mqttMessage{}, err
+		}
+
+		switch header >> 4 {
+		case mqttPacketPublish:
+			return c.handlePublish(header, body)
+		case mqttPacketSubAck:
+			for _, code := range body[min(2, len(body)):] {
+				if code == 0x80 {
+					return mqttMessage{}, errors.New("subscription was rejected by the broker")
+				}
+			}
+		case mqttPacketPingResp:
+		default:
+			return mqttMessage{}, fmt.Errorf("unexpected packet of type %d", header>>4)
+		}
+	}
+}
+
+func (c *mqttConn) handlePublish(header byte, body []byte) (mqttMessage, error) {
+	if len(body) < 2 {
+		return mqttMessage{}, errors.New("malformed PUBLISH packet")
+	}
+
+	topicLength := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+topicLength {
+		return mqttMessage{}, errors.New("malformed PUBLISH packet")
+	}
+
+	message := mqttMessage{topic: string(body[2 : 2+topicLength])}
+	rest := body[2+topicLength:]
+
+	if qos := (header >> 1) & 0x03; qos > 0 {
+		if len(rest) < 2 {
+			return mqttMessage{}, errors.New("malformed PUBLISH packet")
+		}
+
+		packetID := rest[:2]
+		rest = rest[2:]
+
+		// QoS 2 isn't requested when subscribing, so brokers shouldn't send it
+		if err := c.writePacket(mqttPacketPubAck<<4, packetID); err != nil {
+			return mqttMessage{}, err
+		}
+	}
+
+	message.payload = rest
+
+	return message, nil
+}
+
+func (c *mqttConn) writePacket(header byte, body []byte) error {
+	packet := []byte{header}
+
+	// the remaining length is encoded 7 bits at a time
+	length := len(body)
+	for {
+		encoded := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			encoded |= 0x80
+		}
+
+		packet = append(packet, encoded)
+		if length == 0 {
+			break
+		}
+	}
+
+	packet = append(packet, body...)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(packet)
+
+	return err
+}
+
+func (c *mqttConn) readPacket() (byte, []byte, error) {
+	header, err := c.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var length, multiplier int = 0, 1
+
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+
+		encoded, err := c.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		length += int(encoded&0x7f) * multiplier
+		multiplier *= 128
+
+		if encoded&0x80 == 0 {
+			break
+		}
+	}
+
+	if length > mqttMaxPacketSize {
+		return 0, nil, fmt.Errorf("packet of %d bytes is too large", length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return 0, nil, err
+	}
+
+	return header, body, nil
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// Whether the topic matches the filter, which can contain the + and # wildcards
+func mqttTopicMatches(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	for i := range filterLevels {
+		if filterLevels[i] == "#" {
+			return true
+		}
+
+		if i >= len(topicLevels) {
+			return false
+		}
+
+		if filterLevels[i] != "+" && filterLevels[i] != topicLevels[i] {
+			return false
+		}
+	}
+
+	return len(filterLevels) == len(topicLevels)
+}
@@ -0,0 +1,220 @@
+package glance
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMQTTBrokerURL(t *testing.T) {
+	tests := []struct {
+		broker  string
+		address string
+		secure  bool
+		fails   bool
+	}{
+		{broker: "broker.local", address: "broker.local:1883"},
+		{broker: "broker.local:1884", address: "broker.local:1884"},
+		{broker: "mqtt://broker.local", address: "broker.local:1883"},
+		{broker: "tcp://10.0.0.5:1885", address: "10.0.0.5:1885"},
+		{broker: "mqtts://broker.local", address: "broker.local:8883", secure: true},
+		{broker: "ssl://broker.local:8884", address: "broker.local:8884", secure: true},
+		{broker: "mqtt://[fd00::1]", address: "[fd00::1]:1883"},
+		{broker: "ws://broker.local", fails: true},
+		{broker: "mqtt://:1883", fails: true},
+	}
+
+	for _, test := range tests {
+		address, secure, err := parseMQTTBrokerURL(test.broker)
+		if test.fails {
+			if err == nil {
+				t.Errorf("expected %q to fail", test.broker)
+			}
+			continue
+		}
+
+		if err != nil || address != test.address || secure != test.secure {
+			t.Errorf("expected %q to give %q, %v, got %q, %v, %v", test.broker, test.address, test.secure, address, secure, err)
+		}
+	}
+}
+
+func TestMQTTTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter   string
+		topic    string
+		expected bool
+	}{
+		{filter: "home/kitchen/temperature", topic: "home/kitchen/temperature", expected: true},
+		{filter: "home/kitchen/temperature", topic: "home/kitchen", expected: false},
+		{filter: "home/+/temperature", topic: "home/kitchen/temperature", expected: true},
+		{filter: "home/+/temperature", topic: "home/kitchen/humidity", expected: false},
+		{filter: "home/+", topic: "home/kitchen/temperature", expected: false},
+		{filter: "home/#", topic: "home/kitchen/temperature", expected: true},
+		{filter: "home/#", topic: "home", expected: true},
+		{filter: "#", topic: "home/kitchen", expected: true},
+		{filter: "+/+", topic: "/kitchen", expected: true},
+		{filter: "home/kitchen", topic: "home/kitchen/", expected: false},
+	}
+
+	for _, test := range tests {
+		if got := mqttTopicMatches(test.filter, test.topic); got != test.expected {
+			t.Errorf("expected %q matching %q to be %v", test.filter, test.topic, test.expected)
+		}
+	}
+}
+
+func TestMQTTPacketRemainingLength(t *testing.T) {
+	for _, size := range []int{0, 127, 128, 16383, 16384, 300000} {
+		var buf bytes.Buffer
+		writer := &mqttConn{conn: &bufferConn{buf: &buf}}
+
+		body := bytes.Repeat([]byte{'x'}, size)
+		if err := writer.writePacket(mqttPacketPublish<<4, body); err != nil {
+			t.Fatal(err)
+		}
+
+		reader := &mqttConn{reader: bufio.NewReader(&buf)}
+		header, read, err := reader.readPacket()
+		if err != nil {
+			t.Fatalf("reading packet with %d bytes: %v", size, err)
+		}
+
+		if header != mqttPacketPublish<<4 || !bytes.Equal(read, body) {
+			t.Errorf("packet with %d bytes did not round trip", size)
+		}
+	}
+
+	malformed := &mqttConn{reader: bufio.NewReader(bytes.NewReader([]byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x01}))}
+	if _, _, err := malformed.readPacket(); err == nil {
+		t.Error("expected a remaining length of more than 4 bytes to fail")
+	}
+}
+
+func TestMQTTSession(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	server.SetDeadline(time.Now().Add(5 * time.Second))
+
+	broker := &mqttConn{conn: server, reader: bufio.NewReader(server)}
+	publish := func(qos byte, packetID uint16, topic, payload string) {
+		body := appendMQTTString(nil, topic)
+		if qos > 0 {
+			body = binary.BigEndian.AppendUint16(body, packetID)
+		}
+		broker.writePacket(mqttPacketPublish<<4|qos<<1, append(body, payload...))
+	}
+
+	errs := make(chan string, 10)
+	go func() {
+		defer close(errs)
+
+		header, body, err := broker.readPacket()
+		if err != nil || header>>4 != mqttPacketConnect {
+			errs <- "expected CONNECT"
+			return
+		}
+
+		expected := appendMQTTString(nil, "MQTT")
+		expected = append(expected, 4, 0xc2, 0, 30)
+		expected = appendMQTTString(expected, "glance")
+		expected = appendMQTTString(expected, "user")
+		expected = appendMQTTString(expected, "pass")
+		if !bytes.Equal(body, expected) {
+			errs <- "unexpected CONNECT body"
+		}
+
+		broker.writePacket(mqttPacketConnAck<<4, []byte{0, 0})
+
+		header, body, err = broker.readPacket()
+		if err != nil || header != mqttPacketSubscribe<<4|0x02 || !bytes.Equal(body, append(appendMQTTString([]byte{0, 1}, "home/#"), 1)) {
+			errs <- "unexpected SUBSCRIBE"
+			return
+		}
+
+		// messages can arrive before the SUBACK
+		publish(0, 0, "home/door", "open")
+		broker.writePacket(mqttPacketSubAck<<4, []byte{0, 1, 1})
+		publish(1, 7, "home/kitchen", "21.5")
+
+		header, body, err = broker.readPacket()
+		if err != nil || header != mqttPacketPubAck<<4 || !bytes.Equal(body, []byte{0, 7}) {
+			errs <- "expected PUBACK for packet 7"
+			return
+		}
+
+		broker.writePacket(mqttPacketPingResp<<4, nil)
+		publish(0, 0, "home/door", "closed")
+	}()
+
+	conn := &mqttConn{conn: client, reader: bufio.NewReader(client)}
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	err := conn.connect(&mqttConnectOptions{clientID: "glance", username: "user", password: "pass", keepAlive: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("connecting: %v", err)
+	}
+
+	if err := conn.subscribe(1, []string{"home/#"}); err != nil {
+		t.Fatalf("subscribing: %v", err)
+	}
+
+	for _, expected := range []mqttMessage{
+		{topic: "home/door", payload: []byte("open")},
+		{topic: "home/kitchen", payload: []byte("21.5")},
+		{topic: "home/door", payload: []byte("closed")},
+	} {
+		message, err := conn.receive(5 * time.Second)
+		if err != nil {
+			t.Fatalf("receiving: %v", err)
+		}
+
+		if message.topic != expected.topic || !bytes.Equal(message.payload, expected.payload) {
+			t.Errorf("expected %s=%s, got %s=%s", expected.topic, expected.payload, message.topic, message.payload)
+		}
+	}
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestMQTTConnectRefused(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	server.SetDeadline(time.Now().Add(5 * time.Second))
+
+	go func() {
+		broker := &mqttConn{conn: server, reader: bufio.NewReader(server)}
+		if _, _, err := broker.readPacket(); err == nil {
+			broker.writePacket(mqttPacketConnAck<<4, []byte{0, 4})
+		}
+	}()
+
+	conn := &mqttConn{conn: client, reader: bufio.NewReader(client)}
+	err := conn.connect(&mqttConnectOptions{clientID: "glance"})
+	if err == nil || !strings.Contains(err.Error(), "bad username or password") {
+		t.Errorf("expected the connection to be refused, got %v", err)
+	}
+}
+
+// Collects what's written to it, for the parts of a connection which only write
+type bufferConn struct {
+	net.Conn
+	buf *bytes.Buffer
+}
+
+func (c *bufferConn) Write(b []byte) (int, error) {
+	return c.buf.Write(b)
+}
+
+func (c *bufferConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
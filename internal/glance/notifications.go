@@ -0,0 +1,361 @@
+package glance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// How long an item which is no longer returned by any of the sources of a
+// widget is remembered for, so that it doesn't get announced again if it
+// comes back after a source stops failing
+const notificationSeenItemRetention = 7 * 24 * time.Hour
+
+const notificationRequestTimeout = 15 * time.Second
+
+const (
+	defaultNotificationTitleTemplate   = `{{ .Widget.Title }}`
+	defaultNotificationMessageTemplate = `{{ if .Item.Author }}{{ .Item.Author }}: {{ end }}{{ .Item.Title }}`
+)
+
+type notificationTarget struct {
+	Name     string            `yaml:"name"`
+	Type     string            `yaml:"type"`
+	URL      string            `yaml:"url"`
+	Token    string            `yaml:"token"`
+	Priority int               `yaml:"priority"`
+	Headers  map[string]string `yaml:"headers"`
+	Title    string            `yaml:"title"`
+	Message  string            `yaml:"message"`
+	Body     string            `yaml:"body"`
+
+	titleTemplate   *template.Template
+	messageTemplate *template.Template
+	bodyTemplate    *template.Template
+}
+
+// An entry of a widget which can be announced when it first shows up, such as
+// a video or a post from a feed
+type notificationItem struct {
+	// Used to tell whether the item was already there during a previous update
+	Key         string    `json:"-"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Author      string    `json:"author"`
+	ImageURL    string    `json:"image_url"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+type notifyingWidget interface {
+	notificationItems() []notificationItem
+}
+
+type notificationWidgetData struct {
+	ID    uint64 `json:"id"`
+	Type  string `json:"type"`
+	Title string `json:"title"`
+}
+
+type notificationEvent struct {
+	Widget notificationWidgetData `json:"widget"`
+	Item   notificationItem       `json:"item"`
+}
+
+type notificationWidgetState struct {
+	primed bool
+	seen   map[string]time.Time
+}
+
+func (t *notificationTarget) init() error {
+	if t.URL == "" {
+		return errors.New("url is required")
+	}
+
+	switch t.Type {
+	case "ntfy", "gotify", "discord", "webhook":
+	case "":
+		return errors.New("type is required")
+	default:
+		return fmt.Errorf("unknown type %q, must be one of ntfy, gotify, discord or webhook", t.Type)
+	}
+
+	if t.Type == "gotify" && t.Token == "" {
+		return errors.New("token is required for gotify")
+	}
+
+	if t.Body != "" && t.Type != "webhook" {
+		return errors.New("body can only be set for webhook")
+	}
+
+	var err error
+
+	if t.titleTemplate, err = parseNotificationTemplate("title", t.Title, defaultNotificationTitleTemplate); err != nil {
+		return err
+	}
+
+	if t.messageTemplate, err = parseNotificationTemplate("message", t.Message, defaultNotificationMessageTemplate); err != nil {
+		return err
+	}
+
+	if t.Body != "" {
+		if t.bodyTemplate, err = parseNotificationTemplate("body", t.Body, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseNotificationTemplate(name, text, fallback string) (*template.Template, error) {
+	parsed, err := template.New(name).Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			encoded, err := json.Marshal(v)
+			return string(encoded), err
+		},
+	}).Parse(ternary(text == "", fallback, text))
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s template: %v", name, err)
+	}
+
+	return parsed, nil
+}
+
+func executeNotificationTemplate(t *template.Template, event *notificationEvent) (string, error) {
+	var buffer bytes.Buffer
+	if err := t.Execute(&buffer, event); err != nil {
+		return "", fmt.Errorf("executing %s template: %v", t.Name(), err)
+	}
+
+	return buffer.String(), nil
+}
+
+func (t *notificationTarget) newRequest(ctx context.Context, event *notificationEvent) (*http.Request, error) {
+	title, err := executeNotificationTemplate(t.titleTemplate, event)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := executeNotificationTemplate(t.messageTemplate, event)
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	var contentType string
+
+	switch t.Type {
+	case "ntfy":
+		body, contentType = []byte(message), "text/plain; charset=utf-8"
+	case "gotify":
+		payload := map[string]any{
+			"title":   title,
+			"message": message,
+		}
+
+		// gotify falls back to the default priority of the app when it's not set
+		if t.Priority > 0 {
+			payload["priority"] = t.Priority
+		}
+
+		if event.Item.URL != "" {
+			payload["extras"] = map[string]any{
+				"client::notification": map[string]any{
+					"click": map[string]string{"url": event.Item.URL},
+				},
+			}
+		}
+
+		body, err = json.Marshal(payload)
+		contentType = "application/json"
+	case "discord":
+		embed := map[string]any{
+			"title":       title,
+			"description": message,
+		}
+
+		if event.Item.URL != "" {
+			embed["url"] = event.Item.URL
+		}
+
+		if event.Item.ImageURL != "" {
+			embed["thumbnail"] = map[string]string{"url": event.Item.ImageURL}
+		}
+
+		body, err = json.Marshal(map[string]any{"embeds": []any{embed}})
+		contentType = "application/json"
+	case "webhook":
+		if t.bodyTemplate != nil {
+			var rendered string
+			rendered, err = executeNotificationTemplate(t.bodyTemplate, event)
+			body = []byte(rendered)
+		} else {
+			body, err = json.Marshal(struct {
+				Title   string `json:"title"`
+				Message string `json:"message"`
+				*notificationEvent
+			}{title, message, event})
+		}
+		contentType = "application/json"
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("creating payload: %v", err)
+	}
+
+	url := t.URL
+	if t.Type == "gotify" {
+		url = strings.TrimRight(url, "/") + "/message"
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", contentType)
+
+	switch t.Type {
+	case "ntfy":
+		// header values which aren't ASCII get mangled, ntfy decodes them from RFC 2047
+		request.Header.Set("Title", mime.QEncoding.Encode("utf-8", title))
+
+		if event.Item.URL != "" {
+			request.Header.Set("Click", event.Item.URL)
+		}
+
+		if t.Priority > 0 {
+			request.Header.Set("Priority", fmt.Sprint(t.Priority))
+		}
+
+		if t.Token != "" {
+			request.Header.Set("Authorization", "Bearer "+t.Token)
+		}
+	case "gotify":
+		request.Header.Set("X-Gotify-Key", t.Token)
+	}
+
+	for key, value := range t.Headers {
+		request.Header.Set(key, value)
+	}
+
+	return request, nil
+}
+
+func (t *notificationTarget) send(event *notificationEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notificationRequestTimeout)
+	defer cancel()
+
+	request, err := t.newRequest(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	response, err := defaultHTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 256))
+		return fmt.Errorf("unexpected status code %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+func sendNotifications(targets []*notificationTarget, events []notificationEvent) {
+	for _, target := range targets {
+		for i := range events {
+			if err := target.send(&events[i]); err != nil {
+				slog.Error("Failed to send notification", "target", target.Name, "widget", events[i].Widget.ID, "error", err)
+			}
+		}
+	}
+}
+
+// Called before and after every update of a widget which has notifications
+// enabled, items which are returned for the first time get announced, except
+// during the very first update since everything would be new then
+func (w *widgetBase) findNewNotificationItems(previous, current []notificationItem, now time.Time) []notificationItem {
+	state := &w.notifications
+	if state.seen == nil {
+		state.seen = make(map[string]time.Time)
+	}
+
+	// content restored from the cache or kept from before the config was reloaded
+	// was already seen by the time it was saved
+	if !state.primed && len(previous) > 0 {
+		for _, item := range previous {
+			state.seen[item.Key] = now
+		}
+		state.primed = true
+	}
+
+	// items which were pushed out by newer ones and then show up again after one
+	// of them gets deleted are older than everything that was there before
+	var oldestPrevious time.Time
+	for _, item := range previous {
+		if !item.PublishedAt.IsZero() && (oldestPrevious.IsZero() || item.PublishedAt.Before(oldestPrevious)) {
+			oldestPrevious = item.PublishedAt
+		}
+	}
+
+	newItems := make([]notificationItem, 0)
+
+	for _, item := range current {
+		if _, seen := state.seen[item.Key]; !seen && state.primed {
+			if item.PublishedAt.IsZero() || oldestPrevious.IsZero() || !item.PublishedAt.Before(oldestPrevious) {
+				newItems = append(newItems, item)
+			}
+		}
+
+		state.seen[item.Key] = now
+	}
+
+	state.primed = true
+
+	for key, lastSeen := range state.seen {
+		if now.Sub(lastSeen) > notificationSeenItemRetention {
+			delete(state.seen, key)
+		}
+	}
+
+	return newItems
+}
+
+func (w *widgetBase) queueNotifications(items []notificationItem) {
+	if len(items) == 0 || w.Providers == nil {
+		return
+	}
+
+	targets := make([]*notificationTarget, 0, len(w.Notify))
+	for _, name := range w.Notify {
+		if target, exists := w.Providers.notificationTargets[name]; exists {
+			targets = append(targets, target)
+		}
+	}
+
+	if len(targets) == 0 {
+		return
+	}
+
+	events := make([]notificationEvent, len(items))
+	for i := range items {
+		events[i] = notificationEvent{
+			Widget: notificationWidgetData{ID: w.ID, Type: w.Type, Title: w.Title},
+			Item:   items[i],
+		}
+	}
+
+	go sendNotifications(targets, events)
+}
@@ -0,0 +1,261 @@
+package glance
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const pageLayoutMaxRequestSize = 64 * 1024
+
+// The order of the widgets within the columns of a page as arranged from the
+// browser. Rather than rewriting the config, which can have comments, includes
+// and variables that wouldn't survive being written back, layouts are kept in
+// the state store and applied on top of it. Widgets are referred to by their
+// config hash, so changing the config of a widget puts it back where the
+// config has it.
+type pageLayout struct {
+	Columns   [][]string `json:"columns"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func pageLayoutKey(slug string) string {
+	return "layout:" + slug
+}
+
+func (a *application) loadPageLayout(slug string) (*pageLayout, bool) {
+	layout := &pageLayout{}
+
+	exists, err := a.store.get(pageLayoutKey(slug), layout)
+	if err != nil {
+		slog.Error("Failed to load page layout", "page", slug, "error", err)
+		return nil, false
+	}
+
+	return layout, exists
+}
+
+// Widgets which the layout doesn't mention, such as ones added to the config
+// after it was saved, go after the rest in the column they're configured in.
+// Passing no columns restores the order of the config. Must be called with the
+// page's lock held once the page is being served.
+func (p *page) applyLayout(columns [][]string) {
+	available := make(map[string][]widget)
+	for c := range p.configLayout {
+		for _, w := range p.configLayout[c] {
+			key := w.base().configHash
+			available[key] = append(available[key], w)
+		}
+	}
+
+	placed := make(map[widget]bool)
+	arranged := make([]widgets, len(p.Columns))
+
+	for c := range min(len(columns), len(p.Columns)) {
+		for _, key := range columns[c] {
+			candidates := available[key]
+			if len(candidates) == 0 {
+				continue
+			}
+
+			arranged[c] = append(arranged[c], candidates[0])
+			available[key] = candidates[1:]
+			placed[candidates[0]] = true
+		}
+	}
+
+	for c := range p.configLayout {
+		for _, w := range p.configLayout[c] {
+			if !placed[w] {
+				arranged[c] = append(arranged[c], w)
+			}
+		}
+	}
+
+	for c := range p.Columns {
+		p.Columns[c].Widgets = arranged[c]
+	}
+}
+
+// A layout can only move the widgets of the page around, so it has to have
+// as many columns as the page and each widget at most once. Widgets can be
+// left out, in which case they go after the rest in their configured column.
+func (p *page) validateLayout(columns [][]string) error {
+	if len(columns) != len(p.configLayout) {
+		return fmt.Errorf("expected %d columns, got %d", len(p.configLayout), len(columns))
+	}
+
+	remaining := make(map[string]int)
+	for c := range p.configLayout {
+		for _, w := range p.configLayout[c] {
+			remaining[w.base().configHash]++
+		}
+	}
+
+	for c := range columns {
+		for _, key := range columns[c] {
+			if remaining[key] == 0 {
+				return fmt.Errorf("unknown or repeated widget %q", key)
+			}
+
+			remaining[key]--
+		}
+	}
+
+	return nil
+}
+
+// Users only get to arrange the widgets they can access while the layout is
+// shared by everyone, so the widgets hidden from them keep their place in the
+// current arrangement and the ones they can see fill the remaining slots of
+// each column in the order they were submitted. Must be called with the
+// page's lock held.
+func (p *page) mergeLayout(columns [][]string, hidden func(widget) bool) ([][]string, error) {
+	hiddenKeys := make(map[string]bool)
+	visibleKeys := make(map[string]bool)
+	for c := range p.Columns {
+		for _, w := range p.Columns[c].Widgets {
+			if hidden(w) {
+				hiddenKeys[w.base().configHash] = true
+			} else {
+				visibleKeys[w.base().configHash] = true
+			}
+		}
+	}
+
+	for c := range columns {
+		for _, key := range columns[c] {
+			if hiddenKeys[key] && !visibleKeys[key] {
+				return nil, fmt.Errorf("unknown or repeated widget %q", key)
+			}
+		}
+	}
+
+	merged := make([][]string, len(p.Columns))
+	for c := range p.Columns {
+		var submitted []string
+		if c < len(columns) {
+			submitted = columns[c]
+		}
+
+		merged[c] = make([]string, 0, len(p.Columns[c].Widgets)+len(submitted))
+		for _, w := range p.Columns[c].Widgets {
+			if hidden(w) {
+				merged[c] = append(merged[c], w.base().configHash)
+			} else if len(submitted) > 0 {
+				merged[c] = append(merged[c], submitted[0])
+				submitted = submitted[1:]
+			}
+		}
+
+		merged[c] = append(merged[c], submitted...)
+	}
+
+	return merged, nil
+}
+
+// Requires being logged in since layouts are shared by everyone who can
+// see the page
+func (a *application) canEditLayout(r *http.Request) bool {
+	if !a.Config.LayoutEditing.Enabled {
+		return false
+	}
+
+	username, _, ok := a.sessionFromRequest(r)
+	if !ok {
+		return false
+	}
+
+	return len(a.Config.LayoutEditing.Users) == 0 || slices.Contains(a.Config.LayoutEditing.Users, username)
+}
+
+func (a *application) handleUpdatePageLayoutRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	page, exists := a.pageFromRequest(r)
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	if !a.canEditLayout(r) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	layout := &pageLayout{}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, pageLayoutMaxRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(layout); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if err := page.validateLayout(layout.Columns); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	page.mu.Lock()
+	defer page.mu.Unlock()
+
+	merged, err := page.mergeLayout(layout.Columns, func(widget widget) bool {
+		return !a.canAccessWidget(r, widget.GetID())
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	layout.Columns = merged
+	layout.UpdatedAt = time.Now()
+
+	if err := a.store.set(pageLayoutKey(page.Slug), layout); err != nil {
+		slog.Error("Failed to save page layout", "page", page.Slug, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	page.applyLayout(layout.Columns)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(layout)
+}
+
+func (a *application) handleDeletePageLayoutRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	page, exists := a.pageFromRequest(r)
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	if !a.canEditLayout(r) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if err := a.store.delete(pageLayoutKey(page.Slug)); err != nil {
+		slog.Error("Failed to delete page layout", "page", page.Slug, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	page.mu.Lock()
+	page.applyLayout(nil)
+	page.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
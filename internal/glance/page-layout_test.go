@@ -0,0 +1,89 @@
+package glance
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestMergeLayoutKeepsHiddenWidgetsInPlace(t *testing.T) {
+	newWidget := func(key string) widget {
+		return &htmlWidget{widgetBase: widgetBase{configHash: key}}
+	}
+
+	tests := []struct {
+		name     string
+		current  [][]string
+		hidden   []string
+		columns  [][]string
+		expected [][]string
+		fails    bool
+	}{
+		{
+			name:     "nothing hidden",
+			current:  [][]string{{"a", "b"}, {"c"}},
+			columns:  [][]string{{"b"}, {"c", "a"}},
+			expected: [][]string{{"b"}, {"c", "a"}},
+		},
+		{
+			name:     "reordered around a hidden widget",
+			current:  [][]string{{"a", "secret", "b"}, {"c"}},
+			hidden:   []string{"secret"},
+			columns:  [][]string{{"b", "a"}, {"c"}},
+			expected: [][]string{{"b", "secret", "a"}, {"c"}},
+		},
+		{
+			name:     "widget moved out of a column with a hidden widget",
+			current:  [][]string{{"a", "b", "secret"}, {"c"}},
+			hidden:   []string{"secret"},
+			columns:  [][]string{{"b"}, {"a", "c"}},
+			expected: [][]string{{"b", "secret"}, {"a", "c"}},
+		},
+		{
+			name:     "widget moved into a column with a hidden widget",
+			current:  [][]string{{"a"}, {"secret", "c"}},
+			hidden:   []string{"secret"},
+			columns:  [][]string{{}, {"c", "a"}},
+			expected: [][]string{{}, {"secret", "c", "a"}},
+		},
+		{
+			name:    "hidden widget mentioned",
+			current: [][]string{{"a", "secret"}, {"c"}},
+			hidden:  []string{"secret"},
+			columns: [][]string{{"secret", "a"}, {"c"}},
+			fails:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hidden := make(map[widget]bool)
+			page := &page{}
+			page.Columns = slices.Grow(page.Columns, len(test.current))[:len(test.current)]
+
+			for c := range test.current {
+				for _, key := range test.current[c] {
+					w := newWidget(key)
+					hidden[w] = slices.Contains(test.hidden, key)
+					page.Columns[c].Widgets = append(page.Columns[c].Widgets, w)
+				}
+			}
+
+			merged, err := page.mergeLayout(test.columns, func(w widget) bool { return hidden[w] })
+			if test.fails {
+				if err == nil {
+					t.Errorf("expected an error, got %v", merged)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(merged, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, merged)
+			}
+		})
+	}
+}
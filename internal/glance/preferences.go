@@ -0,0 +1,360 @@
+package glance
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	preferencesDeviceCookieName = "device_token"
+	preferencesDeviceTokenBytes = 16
+	preferencesMaxWidgetKeys    = 500
+	preferencesMaxRequestSize   = 64 * 1024
+	// Devices which haven't been seen for this long get their state removed
+	preferencesDeviceMaxIdle = 180 * 24 * time.Hour
+	// When there are more devices than this, the least recently seen ones
+	// get their state removed to make room for new ones
+	preferencesMaxDevices = 1000
+	// How often a device's last seen time gets written to the store
+	preferencesDeviceSeenInterval = 24 * time.Hour
+)
+
+var preferencesDeviceTokenPattern = regexp.MustCompile(`^[a-f0-9]{32}$`)
+
+// Preferences that used to only live in the browser, stored server side so that
+// they follow the user across browsers and devices. Widgets are referred to by
+// their config hash since their IDs change every time the config is reloaded.
+type userPreferences struct {
+	Theme            string   `json:"theme"`
+	CollapsedWidgets []string `json:"collapsed_widgets"`
+	HiddenWidgets    []string `json:"hidden_widgets"`
+	// Number of seconds after which to cycle to the next page, 0 to disable
+	KioskInterval int       `json:"kiosk_interval"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func newUserPreferences() *userPreferences {
+	return &userPreferences{
+		CollapsedWidgets: []string{},
+		HiddenWidgets:    []string{},
+	}
+}
+
+// When authentication is enabled preferences and other per-person state belong
+// to the logged in user, otherwise they belong to the device, identified by a
+// randomly generated token
+func (a *application) ownerKeyFromRequest(r *http.Request) (string, bool) {
+	if username, _, ok := a.sessionFromRequest(r); ok {
+		return "user:" + username, true
+	}
+
+	if a.RequiresAuth {
+		return "", false
+	}
+
+	cookie, err := r.Cookie(preferencesDeviceCookieName)
+	if err != nil || !preferencesDeviceTokenPattern.MatchString(cookie.Value) {
+		return "", false
+	}
+
+	owner := "device:" + cookie.Value
+	a.markDeviceSeen(owner, false)
+
+	return owner, true
+}
+
+// Same as ownerKeyFromRequest, except that if the device doesn't have a token
+// yet one gets generated and set
+func (a *application) ownerKeyForWriting(w http.ResponseWriter, r *http.Request) (string, error) {
+	if key, ok := a.ownerKeyFromRequest(r); ok {
+		if strings.HasPrefix(key, "device:") && a.markDeviceSeen(key, true) {
+			a.pruneDevices(time.Now())
+		}
+
+		return key, nil
+	}
+
+	if a.RequiresAuth {
+		return "", errors.New("requires being logged in")
+	}
+
+	tokenBytes := make([]byte, preferencesDeviceTokenBytes)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+
+	token := hex.EncodeToString(tokenBytes)
+	http.SetCookie(w, &http.Cookie{
+		Name:     preferencesDeviceCookieName,
+		Value:    token,
+		Path:     a.Config.Server.basePath + "/",
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+		Expires:  time.Now().Add(2 * 365 * 24 * time.Hour),
+	})
+
+	owner := "device:" + token
+	if a.markDeviceSeen(owner, true) {
+		a.pruneDevices(time.Now())
+	}
+
+	return owner, nil
+}
+
+// Keeps track of when each device was last seen so that the state of devices
+// which are no longer around, or of clients which never keep their cookie,
+// doesn't pile up in the store
+type deviceRecord struct {
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Tokens can be made up by clients, so devices only get added once they have
+// something to store. Returns whether the device was added.
+func (a *application) markDeviceSeen(owner string, add bool) bool {
+	record := &deviceRecord{}
+	exists, err := a.store.get(owner, record)
+	if err != nil {
+		slog.Error("Failed to load device", "error", err)
+		return false
+	}
+
+	if (!exists && !add) || time.Since(record.LastSeen) < preferencesDeviceSeenInterval {
+		return false
+	}
+
+	record.LastSeen = time.Now()
+	if err := a.store.set(owner, record); err != nil {
+		slog.Error("Failed to save device", "error", err)
+		return false
+	}
+
+	return !exists
+}
+
+// Removes the devices which haven't been seen for too long, or the least
+// recently seen ones when there are too many, along with all of their state
+func (a *application) pruneDevices(now time.Time) {
+	type device struct {
+		owner    string
+		lastSeen time.Time
+	}
+
+	devices := make([]device, 0)
+	owners := make(map[string]bool)
+
+	for _, owner := range a.store.keysWithPrefix("device:") {
+		record := &deviceRecord{}
+		if _, err := a.store.get(owner, record); err != nil {
+			continue
+		}
+
+		devices = append(devices, device{owner: owner, lastSeen: record.LastSeen})
+		owners[owner] = true
+	}
+
+	slices.SortFunc(devices, func(a, b device) int {
+		return b.lastSeen.Compare(a.lastSeen)
+	})
+
+	expired := make(map[string]bool)
+	for i := range devices {
+		if i >= preferencesMaxDevices || now.Sub(devices[i].lastSeen) > preferencesDeviceMaxIdle {
+			expired[devices[i].owner] = true
+		}
+	}
+
+	keys := make([]string, 0)
+	for _, key := range a.store.keysWithPrefix("") {
+		// per-owner state is stored under <kind>:<owner>
+		_, owner, found := strings.Cut(key, ":")
+		if !found || !strings.HasPrefix(owner, "device:") {
+			if expired[key] {
+				keys = append(keys, key)
+			}
+
+			continue
+		}
+
+		if expired[owner] {
+			keys = append(keys, key)
+		} else if !owners[owner] {
+			// state from before devices were tracked, which gets a record so
+			// that it expires like everything else
+			owners[owner] = true
+			if err := a.store.set(owner, &deviceRecord{LastSeen: now}); err != nil {
+				slog.Error("Failed to save device", "error", err)
+			}
+		}
+	}
+
+	if len(keys) == 0 {
+		return
+	}
+
+	if err := a.store.delete(keys...); err != nil {
+		slog.Error("Failed to remove the state of inactive devices", "error", err)
+		return
+	}
+
+	slog.Info("Removed the state of inactive devices", "devices", len(expired))
+}
+
+func (a *application) runDevicesJanitor(ctx context.Context) {
+	ticker := time.NewTicker(preferencesDeviceSeenInterval)
+	defer ticker.Stop()
+
+	for {
+		a.pruneDevices(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *application) preferencesKeyFromRequest(r *http.Request) (string, bool) {
+	key, ok := a.ownerKeyFromRequest(r)
+	return "preferences:" + key, ok
+}
+
+func (a *application) preferencesKeyForWriting(w http.ResponseWriter, r *http.Request) (string, error) {
+	key, err := a.ownerKeyForWriting(w, r)
+	return "preferences:" + key, err
+}
+
+func (a *application) preferencesFromRequest(r *http.Request) *userPreferences {
+	preferences := newUserPreferences()
+
+	key, ok := a.preferencesKeyFromRequest(r)
+	if !ok {
+		return preferences
+	}
+
+	if _, err := a.store.get(key, preferences); err != nil {
+		slog.Error("Failed to load preferences", "error", err)
+		return newUserPreferences()
+	}
+
+	return preferences
+}
+
+func (a *application) savePreferences(key string, preferences *userPreferences) error {
+	preferences.UpdatedAt = time.Now()
+	return a.store.set(key, preferences)
+}
+
+func (p *userPreferences) equal(other *userPreferences) bool {
+	return p.Theme == other.Theme &&
+		p.KioskInterval == other.KioskInterval &&
+		slices.Equal(p.CollapsedWidgets, other.CollapsedWidgets) &&
+		slices.Equal(p.HiddenWidgets, other.HiddenWidgets)
+}
+
+func (p *userPreferences) sanitize(a *application) {
+	if p.Theme != "" && p.Theme != "default" {
+		if _, exists := a.Config.Theme.Presets.Get(p.Theme); !exists {
+			p.Theme = ""
+		}
+	}
+
+	p.KioskInterval = max(p.KioskInterval, 0)
+	if p.KioskInterval > 0 {
+		p.KioskInterval = max(p.KioskInterval, 5)
+	}
+
+	sanitizeKeys := func(keys []string) []string {
+		if len(keys) == 0 {
+			return []string{}
+		}
+
+		keys = slices.Compact(slices.Sorted(slices.Values(keys)))
+		keys = slices.DeleteFunc(keys, func(key string) bool {
+			return key == "" || len(key) > 64
+		})
+
+		return keys[:min(len(keys), preferencesMaxWidgetKeys)]
+	}
+
+	p.CollapsedWidgets = sanitizeKeys(p.CollapsedWidgets)
+	p.HiddenWidgets = sanitizeKeys(p.HiddenWidgets)
+}
+
+func (a *application) handleGetPreferencesRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.preferencesFromRequest(r))
+}
+
+// Only the properties present in the request body get changed
+func (a *application) handleUpdatePreferencesRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	preferences := a.preferencesFromRequest(r)
+	unchanged := *preferences
+	unchanged.CollapsedWidgets = slices.Clone(preferences.CollapsedWidgets)
+	unchanged.HiddenWidgets = slices.Clone(preferences.HiddenWidgets)
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, preferencesMaxRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(preferences); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	preferences.sanitize(a)
+
+	// avoids creating a device for requests which don't change anything
+	if preferences.equal(&unchanged) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(preferences)
+		return
+	}
+
+	key, err := a.preferencesKeyForWriting(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.savePreferences(key, preferences); err != nil {
+		slog.Error("Failed to save preferences", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preferences)
+}
+
+func (a *application) handleDeletePreferencesRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	if key, ok := a.preferencesKeyFromRequest(r); ok {
+		if err := a.store.delete(key); err != nil {
+			slog.Error("Failed to delete preferences", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,142 @@
+package glance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spaces out the requests made to some hosts and caps how many requests can be
+// made at once across all widgets, so that many widgets updating at the same
+// time don't trip the rate limits of the services they fetch from
+type rateLimitsConfig struct {
+	MaxConcurrentRequests int             `yaml:"max-concurrent-requests"`
+	Rules                 []rateLimitRule `yaml:"rules"`
+}
+
+type rateLimitRule struct {
+	Hosts    []string      `yaml:"hosts"`
+	Requests int           `yaml:"requests"`
+	Per      durationField `yaml:"per"`
+}
+
+func (r *rateLimitRule) UnmarshalYAML(node *yaml.Node) error {
+	type rateLimitRuleAlias rateLimitRule
+
+	if err := node.Decode((*rateLimitRuleAlias)(r)); err != nil {
+		return err
+	}
+
+	if len(r.Hosts) == 0 {
+		return fmt.Errorf("line %d: rate limit needs at least one host", node.Line)
+	}
+
+	if r.Requests <= 0 {
+		return fmt.Errorf("line %d: rate limit requests must be greater than 0", node.Line)
+	}
+
+	if r.Per == 0 {
+		r.Per = durationField(time.Second)
+	}
+
+	return nil
+}
+
+type requestLimiter struct {
+	// nil when the number of requests made at once isn't limited
+	slots chan struct{}
+	hosts []*hostRateLimiter
+}
+
+type hostRateLimiter struct {
+	hosts    []string
+	interval time.Duration
+	mu       sync.Mutex
+	// When the next request to the hosts can be made
+	next time.Time
+}
+
+// Set from the rate limits in the config once the application replaces the
+// previous one
+var requestLimits atomic.Pointer[requestLimiter]
+
+func configureRateLimits(config *rateLimitsConfig) {
+	limiter := &requestLimiter{}
+
+	if config.MaxConcurrentRequests > 0 {
+		limiter.slots = make(chan struct{}, config.MaxConcurrentRequests)
+	}
+
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		limiter.hosts = append(limiter.hosts, &hostRateLimiter{
+			hosts:    rule.Hosts,
+			interval: time.Duration(rule.Per) / time.Duration(rule.Requests),
+		})
+	}
+
+	requestLimits.Store(limiter)
+}
+
+// Blocks until the request is allowed to be made and returns the function
+// which frees up its slot once it's done, or an error if the request's context
+// gets cancelled while waiting
+func (l *requestLimiter) wait(request *http.Request) (func(), error) {
+	ctx := request.Context()
+	host := request.URL.Hostname()
+
+	for _, h := range l.hosts {
+		if !hostMatches(host, h.hosts) {
+			continue
+		}
+
+		if err := h.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		break
+	}
+
+	if l.slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Requests are spaced out evenly rather than allowed to burst, since bursts
+// are what services tend to block
+func (h *hostRateLimiter) wait(ctx context.Context) error {
+	h.mu.Lock()
+	now := time.Now()
+	at := h.next
+	if at.Before(now) {
+		at = now
+	}
+	h.next = at.Add(h.interval)
+	h.mu.Unlock()
+
+	if at.Equal(now) {
+		return nil
+	}
+
+	timer := time.NewTimer(at.Sub(now))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
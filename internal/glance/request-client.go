@@ -0,0 +1,210 @@
+package glance
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRequestRetries      = 0
+	defaultRequestRetryBackoff = time.Second
+	maxRequestRetries          = 10
+)
+
+// How requests get made, set globally through the requests section of the
+// config and overridden by widgets. Unset fields fall back to the defaults.
+type requestOptions struct {
+	Timeout      durationField `yaml:"timeout"`
+	Retries      *int          `yaml:"retries"`
+	RetryBackoff durationField `yaml:"retry-backoff"`
+}
+
+// Set from the requests section of the config once the application replaces
+// the previous one
+var requestDefaults atomic.Pointer[requestOptions]
+
+func configureRequestDefaults(options requestOptions) {
+	requestDefaults.Store(&options)
+}
+
+// Returns a copy of the options with the fields that are set in other
+// replacing their counterparts
+func (o requestOptions) overriddenBy(other *requestOptions) requestOptions {
+	if other == nil {
+		return o
+	}
+
+	if other.Timeout > 0 {
+		o.Timeout = other.Timeout
+	}
+
+	if other.Retries != nil {
+		o.Retries = other.Retries
+	}
+
+	if other.RetryBackoff > 0 {
+		o.RetryBackoff = other.RetryBackoff
+	}
+
+	return o
+}
+
+func (o *requestOptions) isEmpty() bool {
+	return o.Timeout == 0 && o.Retries == nil && o.RetryBackoff == 0
+}
+
+func (o *requestOptions) resolve() (timeout time.Duration, retries int, backoff time.Duration) {
+	resolved := requestOptions{}
+	if defaults := requestDefaults.Load(); defaults != nil {
+		resolved = *defaults
+	}
+	resolved = resolved.overriddenBy(o)
+
+	timeout, retries, backoff = defaultClientTimeout, defaultRequestRetries, defaultRequestRetryBackoff
+
+	if resolved.Timeout > 0 {
+		timeout = time.Duration(resolved.Timeout)
+	}
+
+	if resolved.Retries != nil {
+		retries = min(max(*resolved.Retries, 0), maxRequestRetries)
+	}
+
+	if resolved.RetryBackoff > 0 {
+		backoff = time.Duration(resolved.RetryBackoff)
+	}
+
+	return timeout, retries, backoff
+}
+
+// Applies the rate limits, timeout and retries to the requests made through
+// the underlying client. The timeout is applied to each attempt separately
+// and doesn't include the time spent waiting for the rate limits, which is
+// why it's not set on the client itself.
+type requestClient struct {
+	*http.Client
+	// nil when only the global options apply
+	options *requestOptions
+}
+
+// Returns a client which shares the underlying one, with the given options
+// taking precedence over the ones of this client
+func (c *requestClient) withOptions(options *requestOptions) *requestClient {
+	if options == nil || options.isEmpty() {
+		return c
+	}
+
+	merged := requestOptions{}
+	if c.options != nil {
+		merged = *c.options
+	}
+	merged = merged.overriddenBy(options)
+
+	return &requestClient{Client: c.Client, options: &merged}
+}
+
+func (c *requestClient) Do(request *http.Request) (*http.Response, error) {
+	timeout, retries, backoff := c.options.resolve()
+
+	for attempt := 0; ; attempt++ {
+		response, err := c.attempt(request, timeout)
+
+		if attempt >= retries || !isRetryableResponse(request, response, err) {
+			return response, err
+		}
+
+		if response != nil {
+			// the connection can only be reused once the body has been read
+			io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+			response.Body.Close()
+		}
+
+		// full jitter so that the widgets which failed at the same time don't
+		// all retry at the same time as well
+		wait := backoff << attempt
+		wait = wait/2 + rand.N(wait/2+1)
+
+		select {
+		case <-time.After(wait):
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		}
+
+		if request.Body != nil && request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+
+			request = request.Clone(request.Context())
+			request.Body = body
+		}
+	}
+}
+
+func (c *requestClient) attempt(request *http.Request, timeout time.Duration) (*http.Response, error) {
+	if limiter := requestLimits.Load(); limiter != nil {
+		release, err := limiter.wait(request)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	ctx, cancel := context.WithTimeout(request.Context(), timeout)
+
+	response, err := c.Client.Do(request.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// the timeout also covers reading the body, same as the client's own timeout would
+	response.Body = &cancelOnCloseBody{ReadCloser: response.Body, cancel: cancel}
+
+	return response, nil
+}
+
+// Only requests which are safe to send more than once get retried, the same
+// way the transport decides which requests it can replay on a new connection.
+// Client errors other than being rate limited aren't retried either, since
+// sending the same request again won't change the outcome.
+func isRetryableResponse(request *http.Request, response *http.Response, err error) bool {
+	if request.Body != nil && request.GetBody == nil {
+		return false
+	}
+
+	if !isIdempotentRequest(request) {
+		return false
+	}
+
+	if err != nil {
+		return request.Context().Err() == nil
+	}
+
+	return response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500
+}
+
+func isIdempotentRequest(request *http.Request) bool {
+	switch request.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return request.Header.Get("Idempotency-Key") != "" || request.Header.Get("X-Idempotency-Key") != ""
+}
+
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
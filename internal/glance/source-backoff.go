@@ -0,0 +1,86 @@
+package glance
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// How many times in a row a source has to fail before it gets skipped
+	sourceBackoffThreshold = 3
+	sourceBackoffMinWait   = 5 * time.Minute
+	sourceBackoffMaxWait   = 6 * time.Hour
+)
+
+// Keeps track of the sources of a widget, such as the channels of the videos
+// widget or the feeds of the RSS widget, which keep failing so that they can be
+// skipped for a while rather than retried on every update. The wait doubles
+// every time a source fails again after being retried, up to a cap.
+type sourceBackoff struct {
+	mu      sync.Mutex
+	sources map[string]*sourceFailures
+}
+
+type sourceFailures struct {
+	streak  int
+	retryAt time.Time
+}
+
+func newSourceBackoff() *sourceBackoff {
+	return &sourceBackoff{sources: make(map[string]*sourceFailures)}
+}
+
+func (b *sourceBackoff) isDisabled(source string, now time.Time) bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failures, exists := b.sources[source]
+	return exists && now.Before(failures.retryAt)
+}
+
+func (b *sourceBackoff) record(source string, err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		delete(b.sources, source)
+		return
+	}
+
+	failures, exists := b.sources[source]
+	if !exists {
+		failures = &sourceFailures{}
+		b.sources[source] = failures
+	}
+
+	failures.streak++
+	if failures.streak < sourceBackoffThreshold {
+		return
+	}
+
+	wait := sourceBackoffMinWait << min(failures.streak-sourceBackoffThreshold, 10)
+	wait = min(wait, sourceBackoffMaxWait)
+	failures.retryAt = time.Now().Add(wait)
+
+	slog.Warn("Temporarily disabling source after repeated failures", "source", source, "failures", failures.streak, "retry_in", wait)
+}
+
+// Added to the error of widgets with disabled sources so that it's clear why
+// they're missing without having to look through the logs
+func disabledSourcesMessage(disabled int) string {
+	if disabled == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(", %d temporarily disabled after failing repeatedly", disabled)
+}
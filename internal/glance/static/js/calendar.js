@@ -1,9 +1,17 @@
 import { directions, easeOutQuint, slideFade } from "./animations.js";
 import { elem, repeat, text } from "./templating.js";
+import { usesEnglish, dateFormatter } from "./utils.js";
 
 const FULL_MONTH_SLOTS = 7*6;
-const WEEKDAY_ABBRS = ["Su", "Mo", "Tu", "We", "Th", "Fr", "Sa"];
-const MONTH_NAMES = ["January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"];
+
+// 1 January 2023 was a Sunday
+const WEEKDAY_ABBRS = usesEnglish
+    ? ["Su", "Mo", "Tu", "We", "Th", "Fr", "Sa"]
+    : repeat(7, (i) => dateFormatter({ weekday: "narrow" }).format(new Date(2023, 0, 1 + i)));
+
+const MONTH_NAMES = usesEnglish
+    ? ["January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"]
+    : repeat(12, (i) => dateFormatter({ month: "long" }).format(new Date(2023, i, 1)));
 
 const leftArrowSvg = `<svg stroke="var(--color-text-base)" fill="none" viewBox="0 0 24 24" stroke-width="1.5" xmlns="http://www.w3.org/2000/svg">
   <path stroke-linecap="round" stroke-linejoin="round" d="M15.75 19.5 8.25 12l7.5-7.5" />
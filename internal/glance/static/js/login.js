@@ -1,4 +1,5 @@
 import { find } from "./templating.js";
+import { translate } from "./utils.js";
 
 const AUTH_ENDPOINT = pageData.baseURL + "/api/authenticate";
 
@@ -26,11 +27,11 @@ const state = {
 };
 
 const lang = {
-    showPassword: "Show password",
-    hidePassword: "Hide password",
-    incorrectCredentials: "Incorrect username or password",
-    rateLimited: "Too many login attempts, try again in a few minutes",
-    unknownError: "An error occurred, please try again",
+    showPassword: translate("login.show-password"),
+    hidePassword: translate("login.hide-password"),
+    incorrectCredentials: translate("login.incorrect-credentials"),
+    rateLimited: translate("login.rate-limited"),
+    unknownError: translate("login.unknown-error"),
 };
 
 container.clearStyles("display");
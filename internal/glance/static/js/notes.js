@@ -0,0 +1,166 @@
+import { elem } from "./templating.js";
+
+async function noteRequest(url, method = "GET", body = null) {
+    const response = await fetch(url, {
+        method,
+        headers: body === null ? {} : { "Content-Type": "application/json" },
+        body: body === null ? null : JSON.stringify(body),
+    });
+
+    if (!response.ok) {
+        throw new Error((await response.text()).trim() || response.statusText);
+    }
+
+    return response.json();
+}
+
+function formatRevisionTime(time) {
+    return new Date(time).toLocaleString([], { dateStyle: "medium", timeStyle: "short" });
+}
+
+export default async function(element) {
+    const url = element.dataset.noteUrl;
+    const contentElement = element.querySelector(".notes-content");
+
+    if (!("editable" in element.dataset)) return;
+
+    let note = null;
+    let editor = null;
+
+    const status = elem().classes("notes-status", "size-h6", "color-negative");
+
+    const editButton = elem("button")
+        .classes("notes-button", "notes-edit-button")
+        .attr("type", "button")
+        .text("Edit")
+        .on("click", () => startEditing());
+
+    const actions = elem().classes("notes-actions", "flex", "items-center", "gap-10").append(editButton);
+    element.append(actions, status);
+
+    const setStatus = (text) => status.text(text);
+
+    const render = (response) => {
+        note = response;
+        contentElement.innerHTML = response.html;
+        editButton.showIf(response.editable);
+    };
+
+    const stopEditing = () => {
+        if (editor === null) return;
+
+        editor.remove();
+        editor = null;
+        contentElement.show();
+        actions.show();
+        setStatus("");
+    };
+
+    const startEditing = async () => {
+        try {
+            render(await noteRequest(`${url}/note`));
+        } catch (error) {
+            setStatus(error.message);
+            return;
+        }
+
+        if (!note.editable) {
+            setStatus("This note is locked");
+            return;
+        }
+
+        const textarea = elem("textarea")
+            .classes("notes-textarea")
+            .attr("spellcheck", "false")
+            .attr("placeholder", "Write something, markdown is supported");
+        textarea.value = note.content;
+
+        const save = async () => {
+            setStatus("");
+            saveButton.disable();
+
+            try {
+                render(await noteRequest(`${url}/note`, "PUT", {
+                    content: textarea.value,
+                    updated_at: note.updated_at,
+                }));
+                stopEditing();
+            } catch (error) {
+                setStatus(error.message);
+            } finally {
+                saveButton.enable();
+            }
+        };
+
+        const saveButton = elem("button")
+            .classes("notes-button", "notes-button-primary")
+            .attr("type", "button")
+            .text("Save")
+            .on("click", save);
+
+        const cancelButton = elem("button")
+            .classes("notes-button")
+            .attr("type", "button")
+            .text("Cancel")
+            .on("click", stopEditing);
+
+        let revisionsData = [];
+        const revisions = elem("select")
+            .classes("notes-revisions")
+            .attr("title", "Restore a previous revision")
+            .append(elem("option").attr("value", "").text("Revisions"));
+
+        revisions.on("change", () => {
+            const index = revisions.value;
+            if (index === "") return;
+
+            textarea.value = revisionsData[index].content;
+            revisions.value = "";
+            textarea.focus();
+        });
+
+        textarea.on("keydown", (event) => {
+            if (event.key == "Escape") {
+                stopEditing();
+            } else if (event.key == "Enter" && (event.ctrlKey || event.metaKey)) {
+                event.preventDefault();
+                save();
+            }
+        });
+
+        editor = elem().classes("notes-editor").append(
+            textarea,
+            elem().classes("notes-actions", "flex", "items-center", "gap-10").append(
+                saveButton,
+                cancelButton,
+                revisions,
+            ),
+        );
+
+        contentElement.hide();
+        actions.hide();
+        element.insertBefore(editor, status);
+        textarea.focus();
+
+        try {
+            revisionsData = await noteRequest(`${url}/revisions`);
+
+            if (revisionsData.length == 0) {
+                revisions.hide();
+            }
+
+            revisionsData.forEach((revision, i) => {
+                const by = revision.saved_by ? ` · ${revision.saved_by}` : "";
+                revisions.append(
+                    elem("option").attr("value", i).text(formatRevisionTime(revision.saved_at) + by)
+                );
+            });
+        } catch (error) {
+            revisions.hide();
+        }
+    };
+
+    contentElement.on("dblclick", () => {
+        if (editor === null && !editButton.isHidden()) startEditing();
+    });
+}
@@ -1,19 +1,64 @@
 import { setupPopovers } from './popover.js';
 import { setupMasonries } from './masonry.js';
-import { throttledDebounce, isElementVisible, openURLInNewTab } from './utils.js';
+import { throttledDebounce, isElementVisible, openURLInNewTab, translate, usesEnglish, dateFormatter } from './utils.js';
 import { elem, find, findAll } from './templating.js';
 
+// Like querySelectorAll, but also includes the root itself when it matches so
+// that a widget whose content got replaced can be set up on its own
+function findAllWithin(root, selector) {
+    const elements = Array.from(root.querySelectorAll(selector));
+
+    if (root.matches !== undefined && root.matches(selector)) {
+        elements.unshift(root);
+    }
+
+    return elements;
+}
+
 async function fetchPageContent(pageData) {
     // TODO: handle non 200 status codes/time outs
     // TODO: add retries
     const response = await fetch(`${pageData.baseURL}/api/pages/${pageData.slug}/content/`);
     const content = await response.text();
 
+    // set by the service worker when the content comes from its cache
+    if (response.headers.get("X-Glance-Offline") !== null) {
+        const date = Date.parse(response.headers.get("Date"));
+        pageData.offlineSince = isNaN(date) ? null : date;
+    }
+
     return content;
 }
 
-function setupCarousels() {
-    const carouselElements = document.getElementsByClassName("carousel-container");
+function registerServiceWorker() {
+    if (!("serviceWorker" in navigator)) return;
+
+    // the directory of the static assets, which includes their version
+    const staticPath = new URL("../", import.meta.url).pathname;
+
+    navigator.serviceWorker
+        .register(`${pageData.baseURL}/service-worker.js?static=${encodeURIComponent(staticPath)}`)
+        .catch((error) => console.error("Failed to register service worker:", error));
+}
+
+function showOfflineNotice(pageContentElement) {
+    if (pageData.offlineSince === undefined) return;
+
+    const notice = elem().classes("offline-notice", "size-h5", "color-subdue");
+    notice.append(elem().classes("notice-icon", "notice-icon-minor"));
+
+    const label = elem("span");
+    label.textContent = pageData.offlineSince === null
+        ? translate("page.offline")
+        : translate("page.offline-since", timestampToRelativeTime(Math.floor(pageData.offlineSince / 1000)));
+    notice.append(label);
+
+    pageContentElement.prepend(notice);
+    window.addEventListener("online", () => location.reload(), { once: true });
+}
+
+function setupCarousels(root = document) {
+    const carouselElements = findAllWithin(root, ".carousel-container");
 
     if (carouselElements.length == 0) {
         return;
@@ -55,30 +100,61 @@ const yearInSeconds = dayInSeconds * 365;
 
 function timestampToRelativeTime(timestamp) {
     let delta = Math.round((Date.now() / 1000) - timestamp);
-    let prefix = "";
+    const inFuture = delta < 0;
 
-    if (delta < 0) {
+    if (inFuture) {
         delta = -delta;
-        prefix = "in ";
     }
 
+    let text;
+
     if (delta < minuteInSeconds) {
-        return prefix + "1m";
-    }
-    if (delta < hourInSeconds) {
-        return prefix + Math.floor(delta / minuteInSeconds) + "m";
-    }
-    if (delta < dayInSeconds) {
-        return prefix + Math.floor(delta / hourInSeconds) + "h";
-    }
-    if (delta < monthInSeconds) {
-        return prefix + Math.floor(delta / dayInSeconds) + "d";
-    }
-    if (delta < yearInSeconds) {
-        return prefix + Math.floor(delta / monthInSeconds) + "mo";
+        text = translate("relative-time.minutes", 1);
+    } else if (delta < hourInSeconds) {
+        text = translate("relative-time.minutes", Math.floor(delta / minuteInSeconds));
+    } else if (delta < dayInSeconds) {
+        text = translate("relative-time.hours", Math.floor(delta / hourInSeconds));
+    } else if (delta < monthInSeconds) {
+        text = translate("relative-time.days", Math.floor(delta / dayInSeconds));
+    } else if (delta < yearInSeconds) {
+        text = translate("relative-time.months", Math.floor(delta / monthInSeconds));
+    } else {
+        text = translate("relative-time.years", Math.floor(delta / yearInSeconds));
     }
 
-    return prefix + Math.floor(delta / yearInSeconds) + "y";
+    return inFuture ? translate("relative-time.future", text) : text;
+}
+
+const timeLayoutTokenPattern = /January|Jan|Monday|Mon|2006|01|02|_2|06|15|03|04|05|PM|pm|1|2|3|4|5/g;
+const padTwo = (value) => String(value).padStart(2, "0");
+
+const timeLayoutTokens = {
+    "January": (date) => dateFormatter({ month: "long" }).format(date),
+    "Jan": (date) => dateFormatter({ month: "short" }).format(date),
+    "Monday": (date) => dateFormatter({ weekday: "long" }).format(date),
+    "Mon": (date) => dateFormatter({ weekday: "short" }).format(date),
+    "2006": (date) => date.getFullYear(),
+    "06": (date) => padTwo(date.getFullYear() % 100),
+    "01": (date) => padTwo(date.getMonth() + 1),
+    "1": (date) => date.getMonth() + 1,
+    "02": (date) => padTwo(date.getDate()),
+    "_2": (date) => String(date.getDate()).padStart(2, " "),
+    "2": (date) => date.getDate(),
+    "15": (date) => padTwo(date.getHours()),
+    "03": (date) => padTwo(date.getHours() % 12 || 12),
+    "3": (date) => date.getHours() % 12 || 12,
+    "04": (date) => padTwo(date.getMinutes()),
+    "4": (date) => date.getMinutes(),
+    "05": (date) => padTwo(date.getSeconds()),
+    "5": (date) => date.getSeconds(),
+    "PM": (date) => date.getHours() < 12 ? "AM" : "PM",
+    "pm": (date) => date.getHours() < 12 ? "am" : "pm",
+};
+
+// Supports the parts of Go's layouts which make sense for showing a date, such
+// as "2006-01-02 15:04" or "Jan 2, 3:04 PM", in the timezone of the browser
+function formatTimeWithLayout(date, layout) {
+    return layout.replace(timeLayoutTokenPattern, (token) => timeLayoutTokens[token](date));
 }
 
 function updateRelativeTimeForElements(elements)
@@ -91,7 +167,22 @@ function updateRelativeTimeForElements(elements)
         if (timestamp === undefined)
             continue
 
-        element.textContent = timestampToRelativeTime(timestamp);
+        // set through the time-format property of the widget
+        const format = element.closest("[data-time-format]")?.dataset;
+
+        if (format?.timeFormat == "absolute") {
+            element.textContent = formatTimeWithLayout(new Date(timestamp * 1000), format.timeLayout);
+            continue;
+        }
+
+        const relativeTime = timestampToRelativeTime(timestamp);
+        element.textContent = element.dataset.relativeTimeAgo !== undefined
+            ? translate("relative-time.ago", relativeTime)
+            : relativeTime;
+
+        if (format?.timeFormat == "both" && !element.hasAttribute("title")) {
+            element.title = formatTimeWithLayout(new Date(timestamp * 1000), format.timeLayout);
+        }
     }
 }
 
@@ -104,7 +195,7 @@ function setupSearchBoxes() {
 
     for (let i = 0; i < searchWidgets.length; i++) {
         const widget = searchWidgets[i];
-        const defaultSearchUrl = widget.dataset.defaultSearchUrl;
+        let defaultSearchUrl = widget.dataset.defaultSearchUrl;
         const target = widget.dataset.target || "_blank";
         const newTab = widget.dataset.newTab === "true";
         const inputElement = widget.getElementsByClassName("search-input")[0];
@@ -120,6 +211,24 @@ function setupSearchBoxes() {
             bangsMap[bang.dataset.shortcut] = bang;
         }
 
+        const engineSelect = widget.getElementsByClassName("search-engine-select")[0];
+
+        if (engineSelect !== undefined) {
+            const storageKey = `search-engine-${widget.closest(".widget").dataset.widgetKey}`;
+            const storedSearchUrl = localStorage.getItem(storageKey);
+
+            if (storedSearchUrl !== null && Array.from(engineSelect.options).some((option) => option.value == storedSearchUrl)) {
+                engineSelect.value = storedSearchUrl;
+                defaultSearchUrl = storedSearchUrl;
+            }
+
+            engineSelect.addEventListener("change", () => {
+                defaultSearchUrl = engineSelect.value;
+                localStorage.setItem(storageKey, defaultSearchUrl);
+                inputElement.focus();
+            });
+        }
+
         const handleKeyDown = (event) => {
             if (event.key == "Escape") {
                 inputElement.blur();
@@ -193,8 +302,8 @@ function setupSearchBoxes() {
         });
 
         document.addEventListener("keydown", (event) => {
-            if (['INPUT', 'TEXTAREA'].includes(document.activeElement.tagName)) return;
-            if (event.code != "KeyS") return;
+            if (['INPUT', 'TEXTAREA', 'SELECT'].includes(document.activeElement.tagName)) return;
+            if (event.code != "KeyS" && event.key != "/") return;
 
             inputElement.focus();
             event.preventDefault();
@@ -207,14 +316,15 @@ function setupSearchBoxes() {
 }
 
 function setupDynamicRelativeTime() {
-    const elements = document.querySelectorAll("[data-dynamic-relative-time]");
+    // queried every time since widgets can get replaced by live updates
+    const findElements = () => document.querySelectorAll("[data-dynamic-relative-time]");
     const updateInterval = 60 * 1000;
     let lastUpdateTime = Date.now();
 
-    updateRelativeTimeForElements(elements);
+    updateRelativeTimeForElements(findElements());
 
     const updateElementsAndTimestamp = () => {
-        updateRelativeTimeForElements(elements);
+        updateRelativeTimeForElements(findElements());
         lastUpdateTime = Date.now();
     };
 
@@ -248,8 +358,8 @@ function setupDynamicRelativeTime() {
     });
 }
 
-function setupGroups() {
-    const groups = document.getElementsByClassName("widget-type-group");
+function setupGroups(root = document) {
+    const groups = findAllWithin(root, ".widget-type-group");
 
     if (groups.length == 0) {
         return;
@@ -259,7 +369,7 @@ function setupGroups() {
         const group = groups[g];
         const titles = group.getElementsByClassName("widget-header")[0].children;
         const tabs = group.getElementsByClassName("widget-group-contents")[0].children;
-        let current = 0;
+        let current = Math.max(0, Array.prototype.findIndex.call(titles, (title) => title.classList.contains("widget-group-title-current")));
 
         for (let t = 0; t < titles.length; t++) {
             const title = titles[t];
@@ -308,8 +418,8 @@ function setupGroups() {
     }
 }
 
-function setupLazyImages() {
-    const images = document.querySelectorAll("img[loading=lazy]");
+function setupLazyImages(root = document) {
+    const images = findAllWithin(root, "img[loading=lazy]");
 
     if (images.length == 0) {
         return;
@@ -340,8 +450,8 @@ function setupLazyImages() {
 }
 
 function attachExpandToggleButton(collapsibleContainer) {
-    const showMoreText = "Show more";
-    const showLessText = "Show less";
+    const showMoreText = translate("expand.show-more");
+    const showLessText = translate("expand.show-less");
 
     let expanded = false;
     const button = document.createElement("button");
@@ -383,8 +493,8 @@ function attachExpandToggleButton(collapsibleContainer) {
 };
 
 
-function setupCollapsibleLists() {
-    const collapsibleLists = document.querySelectorAll(".list.collapsible-container");
+function setupCollapsibleLists(root = document) {
+    const collapsibleLists = findAllWithin(root, ".list.collapsible-container");
 
     if (collapsibleLists.length == 0) {
         return;
@@ -417,8 +527,8 @@ function setupCollapsibleLists() {
     }
 }
 
-function setupCollapsibleGrids() {
-    const collapsibleGridElements = document.querySelectorAll(".cards-grid.collapsible-container");
+function setupCollapsibleGrids(root = document) {
+    const collapsibleGridElements = findAllWithin(root, ".cards-grid.collapsible-container");
 
     if (collapsibleGridElements.length == 0) {
         return;
@@ -493,14 +603,36 @@ function setupCollapsibleGrids() {
 }
 
 const contentReadyCallbacks = [];
+let contentReady = false;
 
 function afterContentReady(callback) {
+    if (contentReady) {
+        callback();
+        return;
+    }
+
     contentReadyCallbacks.push(callback);
 }
 
 const weekDayNames = ['Sunday', 'Monday', 'Tuesday', 'Wednesday', 'Thursday', 'Friday', 'Saturday'];
 const monthNames = ['January', 'February', 'March', 'April', 'May', 'June', 'July', 'August', 'September', 'October', 'November', 'December'];
 
+const weekdayFormat = dateFormatter({ weekday: "long" });
+const dayAndMonthFormat = dateFormatter({ month: "long", day: "numeric" });
+const weekdayDayAndMonthFormat = dateFormatter({ weekday: "long", month: "long", day: "numeric" });
+
+function formatDayAndMonth(date) {
+    return usesEnglish ? date.getDate() + ' ' + monthNames[date.getMonth()] : dayAndMonthFormat.format(date);
+}
+
+function formatWeekday(date) {
+    return usesEnglish ? weekDayNames[date.getDay()] : weekdayFormat.format(date);
+}
+
+function formatWeekdayDayAndMonth(date) {
+    return usesEnglish ? formatWeekday(date) + ', ' + formatDayAndMonth(date) : weekdayDayAndMonthFormat.format(date);
+}
+
 function makeSettableTimeElement(element, hourFormat) {
     const fragment = document.createDocumentFragment();
     const hour = document.createElement('span');
@@ -551,27 +683,35 @@ function zoneDiffText(diffInMinutes) {
     }
 
     const sign = diffInMinutes < 0 ? "-" : "+";
-    const signText = diffInMinutes < 0 ? "behind" : "ahead";
+    const direction = diffInMinutes < 0 ? "clock.behind" : "clock.ahead";
 
     diffInMinutes = Math.abs(diffInMinutes);
 
     const hours = Math.floor(diffInMinutes / 60);
     const minutes = diffInMinutes % 60;
-    const hourSuffix = hours == 1 ? "" : "s";
+    const hoursText = translate(hours == 1 ? "clock.hour" : "clock.hours", hours);
+    const minutesText = translate("clock.minutes", minutes);
 
     if (minutes == 0) {
-        return { text: `${sign}${hours}h`, title: `${hours} hour${hourSuffix} ${signText}` };
+        return { text: `${sign}${hours}h`, title: translate(direction, hoursText) };
     }
 
     if (hours == 0) {
-        return { text: `${sign}${minutes}m`, title: `${minutes} minutes ${signText}` };
+        return { text: `${sign}${minutes}m`, title: translate(direction, minutesText) };
     }
 
-    return { text: `${sign}${hours}h~`, title: `${hours} hour${hourSuffix} and ${minutes} minutes ${signText}` };
+    return { text: `${sign}${hours}h~`, title: translate(direction, translate("clock.hours-and-minutes", hoursText, minutesText)) };
+}
+
+function isoWeekNumber(date) {
+    const thursday = new Date(date.getFullYear(), date.getMonth(), date.getDate() + 3 - (date.getDay() + 6) % 7);
+    const firstThursday = new Date(thursday.getFullYear(), 0, 4);
+
+    return 1 + Math.round(((thursday - firstThursday) / 86400000 - 3 + (firstThursday.getDay() + 6) % 7) / 7);
 }
 
-function setupClocks() {
-    const clocks = document.getElementsByClassName('clock');
+function setupClocks(root = document) {
+    const clocks = findAllWithin(root, ".clock");
 
     if (clocks.length == 0) {
         return;
@@ -586,6 +726,7 @@ function setupClocks() {
         const localDateElement = localTimeContainer.querySelector('[data-date]');
         const localWeekdayElement = localTimeContainer.querySelector('[data-weekday]');
         const localYearElement = localTimeContainer.querySelector('[data-year]');
+        const localWeekNumberElement = localTimeContainer.querySelector('[data-week-number]');
         const timeZoneContainers = clock.querySelectorAll('[data-time-in-zone]');
 
         const setLocalTime = makeSettableTimeElement(
@@ -595,14 +736,19 @@ function setupClocks() {
 
         updateCallbacks.push((now) => {
             setLocalTime(now);
-            localDateElement.textContent = now.getDate() + ' ' + monthNames[now.getMonth()];
-            localWeekdayElement.textContent = weekDayNames[now.getDay()];
+            localDateElement.textContent = formatDayAndMonth(now);
+            localWeekdayElement.textContent = formatWeekday(now);
             localYearElement.textContent = now.getFullYear();
+
+            if (localWeekNumberElement !== null) {
+                localWeekNumberElement.textContent = ' · ' + translate("clock.week", isoWeekNumber(now));
+            }
         });
 
         for (var z = 0; z < timeZoneContainers.length; z++) {
             const timeZoneContainer = timeZoneContainers[z];
             const diffElement = timeZoneContainer.querySelector('[data-time-diff]');
+            const dateElement = timeZoneContainer.querySelector('[data-date]');
 
             const setZoneTime = makeSettableTimeElement(
                 timeZoneContainer.querySelector('[data-time]'),
@@ -615,6 +761,10 @@ function setupClocks() {
                 const { text, title } = zoneDiffText(diffInMinutes);
                 diffElement.textContent = text;
                 diffElement.title = title;
+
+                if (dateElement !== null) {
+                    dateElement.textContent = formatWeekdayDayAndMonth(time);
+                }
             });
         }
     }
@@ -631,8 +781,8 @@ function setupClocks() {
     updateClocks();
 }
 
-async function setupCalendars() {
-    const elems = document.getElementsByClassName("calendar");
+async function setupCalendars(root = document) {
+    const elems = findAllWithin(root, ".calendar");
     if (elems.length == 0) return;
 
     // TODO: implement prefetching, currently loads as a nasty waterfall of requests
@@ -642,8 +792,8 @@ async function setupCalendars() {
         calendar.default(elems[i]);
 }
 
-async function setupTodos() {
-    const elems = Array.from(document.getElementsByClassName("todo"));
+async function setupTodos(root = document) {
+    const elems = findAllWithin(root, ".todo");
     if (elems.length == 0) return;
 
     const todo = await import ('./todo.js');
@@ -653,8 +803,19 @@ async function setupTodos() {
     }
 }
 
-function setupTruncatedElementTitles() {
-    const elements = document.querySelectorAll(".text-truncate, .single-line-titles .title, .text-truncate-2-lines, .text-truncate-3-lines");
+async function setupNotes(root = document) {
+    const elems = findAllWithin(root, ".notes");
+    if (elems.length == 0) return;
+
+    const notes = await import ('./notes.js');
+
+    for (let i = 0; i < elems.length; i++) {
+        notes.default(elems[i]);
+    }
+}
+
+function setupTruncatedElementTitles(root = document) {
+    const elements = findAllWithin(root, ".text-truncate, .single-line-titles .title, .text-truncate-2-lines, .text-truncate-3-lines");
 
     if (elements.length == 0) {
         return;
@@ -687,6 +848,7 @@ async function changeTheme(key, onChanged) {
     themeStyleElem.html(newThemeStyle);
     document.documentElement.setAttribute("data-theme", key);
     document.documentElement.setAttribute("data-scheme", response.headers.get("X-Scheme"));
+    if (key == "auto" && typeof applyAutoTheme == "function") applyAutoTheme();
     typeof onChanged == "function" && onChanged();
     setTimeout(() => { tempStyle.remove(); }, 10);
 }
@@ -743,31 +905,883 @@ function initThemePicker() {
     })
 }
 
+function highlightWidgetFromHash() {
+    const match = location.hash.match(/^#widget-\d+$/);
+    if (match === null) return;
+
+    const widget = document.getElementById(match[0].substring(1));
+    if (widget === null) return;
+
+    // the widget may be inside of a group or column that isn't currently shown
+    const groupTab = widget.closest(".widget-group-content");
+    if (groupTab !== null && !groupTab.classList.contains("widget-group-content-current")) {
+        const index = Array.from(groupTab.parentElement.children).indexOf(groupTab);
+        const titles = groupTab.closest(".widget-group-contents")?.previousElementSibling?.querySelectorAll(".widget-group-title");
+        titles?.[index]?.click();
+    }
+
+    widget.scrollIntoView({ behavior: "smooth", block: "center" });
+    widget.classList.remove("widget-highlighted");
+    void widget.offsetWidth;
+    widget.classList.add("widget-highlighted");
+}
+
+function setupContentSearch() {
+    const container = find(".content-search");
+    if (container === null) return;
+
+    const input = container.find(".content-search-input");
+    const resultsElement = container.find(".content-search-results");
+    let selectedIndex = -1;
+    let lastQuery = "";
+    let abortController = null;
+
+    const widgetURL = (result) => `${pageData.baseURL}/${result.page_slug}#widget-${result.widget_id}`;
+
+    const close = () => {
+        container.classList.remove("has-results");
+        selectedIndex = -1;
+    };
+
+    const select = (index) => {
+        const results = resultsElement.children;
+        if (results.length == 0) return;
+
+        if (selectedIndex >= 0 && selectedIndex < results.length) {
+            results[selectedIndex].classList.remove("selected");
+        }
+
+        selectedIndex = (index + results.length) % results.length;
+        results[selectedIndex].classList.add("selected");
+        results[selectedIndex].scrollIntoView({ block: "nearest" });
+    };
+
+    const render = (results) => {
+        resultsElement.innerHTML = "";
+        selectedIndex = -1;
+
+        if (results.length == 0) {
+            resultsElement.append(elem().classes("content-search-empty").text("No results"));
+        }
+
+        for (let i = 0; i < results.length; i++) {
+            const result = results[i];
+            const subtitle = result.widget_title == result.title
+                ? result.page_title
+                : `${result.widget_title} · ${result.page_title}`;
+
+            const link = elem("a")
+                .classes("content-search-result")
+                .attr("href", result.url || widgetURL(result))
+                .attr("role", "option")
+                .append(
+                    elem().classes("content-search-result-title", "text-truncate").text(result.title),
+                    elem().classes("content-search-result-location", "text-truncate").text(subtitle),
+                );
+
+            if (result.url) {
+                link.attr("target", "_blank").attr("rel", "noreferrer");
+                // holding shift jumps to the widget rather than opening the item
+                link.on("click", (event) => {
+                    if (!event.shiftKey) return;
+                    event.preventDefault();
+                    location.href = widgetURL(result);
+                });
+            }
+
+            resultsElement.append(link);
+        }
+
+        container.classList.add("has-results");
+    };
+
+    const search = throttledDebounce(async () => {
+        const query = input.value.trim();
+        if (query == lastQuery) return;
+        lastQuery = query;
+
+        if (query.length < 2) {
+            close();
+            return;
+        }
+
+        abortController?.abort();
+        abortController = new AbortController();
+
+        try {
+            const response = await fetch(`${pageData.baseURL}/api/search?q=${encodeURIComponent(query)}`, {
+                signal: abortController.signal,
+            });
+
+            if (!response.ok) return;
+            render(await response.json());
+        } catch (e) {
+            if (e.name != "AbortError") console.error(e);
+        }
+    }, 10, 200);
+
+    input.addEventListener("input", search);
+    input.addEventListener("focus", () => {
+        if (resultsElement.children.length > 0 && input.value.trim().length >= 2) {
+            container.classList.add("has-results");
+        }
+    });
+
+    input.addEventListener("keydown", (event) => {
+        if (event.key == "Escape") {
+            close();
+            input.blur();
+        } else if (event.key == "ArrowDown") {
+            event.preventDefault();
+            select(selectedIndex + 1);
+        } else if (event.key == "ArrowUp") {
+            event.preventDefault();
+            select(selectedIndex - 1);
+        } else if (event.key == "Enter" && selectedIndex >= 0) {
+            event.preventDefault();
+            resultsElement.children[selectedIndex].click();
+        }
+    });
+
+    document.addEventListener("click", (event) => {
+        if (!container.contains(event.target)) close();
+    });
+
+    resultsElement.addEventListener("click", (event) => {
+        if (event.target.closest(".content-search-result")) close();
+    });
+
+    window.addEventListener("hashchange", highlightWidgetFromHash);
+}
+
+function setupWakeOnLAN(root = document) {
+    const buttons = findAllWithin(root, "[data-wake-on-lan]");
+
+    for (let i = 0; i < buttons.length; i++) {
+        const button = buttons[i];
+        let resetTimeout;
+
+        button.addEventListener("click", async (event) => {
+            event.preventDefault();
+            if (button.classList.contains("wake-on-lan-pending")) return;
+
+            clearTimeout(resetTimeout);
+            button.classList.remove("wake-on-lan-sent", "wake-on-lan-failed");
+            button.classList.add("wake-on-lan-pending");
+
+            let ok = false;
+            try {
+                const response = await fetch(`${pageData.baseURL}/api/wake-on-lan/${button.dataset.wakeOnLan}`, {
+                    method: "POST",
+                });
+                ok = response.ok;
+            } catch (e) {
+                console.error(e);
+            }
+
+            button.classList.remove("wake-on-lan-pending");
+            button.classList.add(ok ? "wake-on-lan-sent" : "wake-on-lan-failed");
+            resetTimeout = setTimeout(() => {
+                button.classList.remove("wake-on-lan-sent", "wake-on-lan-failed");
+            }, 3000);
+        });
+    }
+}
+
+function setupHabits(root = document) {
+    const widgets = findAllWithin(root, ".habits");
+
+    for (let w = 0; w < widgets.length; w++) {
+        const url = widgets[w].dataset.toggleUrl;
+        const habits = widgets[w].getElementsByClassName("habit");
+
+        for (let h = 0; h < habits.length; h++) {
+            const habit = habits[h];
+            const month = habit.querySelector(".habit-month");
+            const streak = habit.querySelector(".habit-streak");
+            const weekProgress = habit.querySelector(".habit-week-progress");
+
+            habit.querySelector(".habit-name").addEventListener("click", () => {
+                month.hidden = !month.hidden;
+            });
+
+            const cellsForDate = (date) => habit.querySelectorAll(`.habit-cell[data-date="${date}"]`);
+
+            habit.addEventListener("click", async (event) => {
+                const cell = event.target.closest(".habit-cell");
+                if (cell === null || cell.classList.contains("habit-cell-pending")) return;
+
+                const date = cell.dataset.date;
+                const done = !cell.classList.contains("habit-cell-done");
+                const cells = cellsForDate(date);
+
+                cells.forEach(c => c.classList.add("habit-cell-pending"));
+                cells.forEach(c => c.classList.toggle("habit-cell-done", done));
+
+                try {
+                    const response = await fetch(url, {
+                        method: "POST",
+                        headers: { "Content-Type": "application/json" },
+                        body: JSON.stringify({ habit: parseInt(habit.dataset.habit), date, done }),
+                    });
+
+                    if (!response.ok) {
+                        throw new Error((await response.text()).trim());
+                    }
+
+                    const result = await response.json();
+                    streak.textContent = result.streak;
+                    if (weekProgress !== null) weekProgress.textContent = result.week_progress;
+                } catch (e) {
+                    console.error(e);
+                    cells.forEach(c => c.classList.toggle("habit-cell-done", !done));
+                } finally {
+                    cells.forEach(c => c.classList.remove("habit-cell-pending"));
+                }
+            });
+        }
+    }
+}
+
+async function setupSeenVideos(root = document) {
+    const containers = findAllWithin(root, "[data-seen-url]");
+
+    await Promise.all(containers.map(async (container) => {
+        const url = container.dataset.seenUrl;
+        const markAllButton = container.closest(".widget").querySelector(":scope > .widget-header > .videos-mark-seen");
+        const videos = Array.from(container.querySelectorAll("[data-video-key]"));
+
+        let state;
+        try {
+            const response = await fetch(url);
+            if (!response.ok) throw new Error((await response.text()).trim());
+            state = await response.json();
+        } catch (e) {
+            console.error(e);
+            return;
+        }
+
+        // videos posted from now on count as new
+        if (!state.started) {
+            fetch(url, {
+                method: "POST",
+                headers: { "Content-Type": "application/json" },
+                body: JSON.stringify({ keys: [] }),
+            }).catch(e => console.error(e));
+        }
+
+        const seen = new Set(state.seen);
+        const unseen = videos.filter(video => !seen.has(video.dataset.videoKey) && parseInt(video.dataset.videoPosted) > state.since);
+
+        const markAsSeen = async (videosToMark) => {
+            videosToMark.forEach(video => video.classList.remove("video-unseen"));
+            if (markAllButton !== null) markAllButton.hidden = container.querySelector(".video-unseen") === null;
+
+            try {
+                await fetch(url, {
+                    method: "POST",
+                    headers: { "Content-Type": "application/json" },
+                    body: JSON.stringify({ keys: videosToMark.map(video => video.dataset.videoKey) }),
+                });
+            } catch (e) {
+                console.error(e);
+            }
+        };
+
+        unseen.forEach(video => {
+            video.classList.add("video-unseen");
+            video.addEventListener("click", (event) => {
+                if (event.target.closest("a") === null || !video.classList.contains("video-unseen")) return;
+                markAsSeen([video]);
+            });
+        });
+
+        if (markAllButton === null) return;
+        markAllButton.hidden = unseen.length == 0;
+        markAllButton.addEventListener("click", () => {
+            markAsSeen(videos.filter(video => video.classList.contains("video-unseen")));
+        });
+    }));
+}
+
+function setupRefreshingIframes(root = document) {
+    const iframes = findAllWithin(root, "iframe[data-refresh-interval]");
+
+    for (let i = 0; i < iframes.length; i++) {
+        const iframe = iframes[i];
+        const interval = Number(iframe.dataset.refreshInterval) * 1000;
+
+        setInterval(() => {
+            // no point in reloading something nobody is looking at
+            if (document.hidden) return;
+            iframe.src = iframe.src;
+        }, interval);
+    }
+}
+
+function setupRadars(root = document) {
+    const radars = findAllWithin(root, ".radar");
+
+    for (let r = 0; r < radars.length; r++) {
+        const radar = radars[r];
+        const frames = Array.from(radar.getElementsByClassName("radar-frame"));
+        const playButton = radar.querySelector(".radar-play");
+        const timeElement = radar.querySelector(".radar-time");
+
+        if (frames.length == 0) continue;
+
+        let current = frames.length - 1;
+        let interval = null;
+
+        const showFrame = (index) => {
+            frames[current].hidden = true;
+            frames[index].hidden = false;
+            current = index;
+
+            const time = new Date(parseInt(frames[index].dataset.time) * 1000);
+            timeElement.textContent = time.toLocaleTimeString([], { hour: "2-digit", minute: "2-digit" });
+        };
+
+        const stop = () => {
+            clearInterval(interval);
+            interval = null;
+            playButton.classList.remove("radar-playing");
+            showFrame(frames.length - 1);
+        };
+
+        playButton.addEventListener("click", () => {
+            if (interval !== null) {
+                stop();
+                return;
+            }
+
+            // the older frames only get loaded once they're needed
+            radar.querySelectorAll(".radar-frame img[data-src]").forEach(img => {
+                img.src = img.dataset.src;
+                img.removeAttribute("data-src");
+            });
+
+            playButton.classList.add("radar-playing");
+            showFrame(0);
+
+            interval = setInterval(() => {
+                if (current == frames.length - 1) {
+                    stop();
+                    return;
+                }
+
+                showFrame(current + 1);
+            }, 700);
+        });
+
+        showFrame(current);
+    }
+}
+
+function setupSystemdServices(root = document) {
+    const lists = findAllWithin(root, ".systemd-services");
+
+    for (let l = 0; l < lists.length; l++) {
+        const url = lists[l].dataset.restartUrl;
+        const buttons = lists[l].getElementsByClassName("systemd-service-restart");
+
+        for (let i = 0; i < buttons.length; i++) {
+            const button = buttons[i];
+            let resetTimeout;
+
+            button.addEventListener("click", async () => {
+                if (button.classList.contains("systemd-service-restart-pending")) return;
+                if (!confirm(button.title + "?")) return;
+
+                clearTimeout(resetTimeout);
+                button.classList.remove("systemd-service-restart-done", "systemd-service-restart-failed");
+                button.classList.add("systemd-service-restart-pending");
+
+                let ok = false;
+                try {
+                    const response = await fetch(url, {
+                        method: "POST",
+                        headers: { "Content-Type": "application/json" },
+                        body: JSON.stringify({ unit: parseInt(button.dataset.unit) }),
+                    });
+
+                    if (!response.ok) {
+                        throw new Error((await response.text()).trim());
+                    }
+
+                    ok = true;
+                } catch (e) {
+                    console.error(e);
+                }
+
+                button.classList.remove("systemd-service-restart-pending");
+                button.classList.add(ok ? "systemd-service-restart-done" : "systemd-service-restart-failed");
+                resetTimeout = setTimeout(() => {
+                    button.classList.remove("systemd-service-restart-done", "systemd-service-restart-failed");
+                }, 3000);
+            });
+        }
+    }
+}
+
+function setupHomeAssistant(root = document) {
+    const lists = findAllWithin(root, ".home-assistant-entities");
+
+    for (let l = 0; l < lists.length; l++) {
+        const url = lists[l].dataset.toggleUrl;
+        const buttons = lists[l].getElementsByClassName("home-assistant-toggle");
+
+        for (let i = 0; i < buttons.length; i++) {
+            const button = buttons[i];
+            const entity = button.closest(".home-assistant-entity");
+            const stateElement = entity.getElementsByClassName("home-assistant-state")[0];
+
+            button.addEventListener("click", async () => {
+                if (button.classList.contains("home-assistant-toggle-pending")) return;
+
+                button.classList.remove("home-assistant-toggle-failed");
+                button.classList.add("home-assistant-toggle-pending");
+
+                try {
+                    const response = await fetch(url, {
+                        method: "POST",
+                        headers: { "Content-Type": "application/json" },
+                        body: JSON.stringify({ entity: parseInt(button.dataset.entity) }),
+                    });
+
+                    if (!response.ok) {
+                        throw new Error((await response.text()).trim());
+                    }
+
+                    const result = await response.json();
+
+                    // only toggles have a state worth reflecting, scripts and buttons just get triggered
+                    if (result.state !== undefined && button.hasAttribute("aria-pressed")) {
+                        entity.classList.toggle("home-assistant-entity-active", result.active);
+                        button.setAttribute("aria-pressed", result.active ? "true" : "false");
+                        if (stateElement !== undefined) stateElement.textContent = result.state;
+                    }
+                } catch (e) {
+                    console.error(e);
+                    button.classList.add("home-assistant-toggle-failed");
+                }
+
+                button.classList.remove("home-assistant-toggle-pending");
+            });
+        }
+    }
+}
+
+async function savePreferences(changes) {
+    const response = await fetch(`${pageData.baseURL}/api/preferences`, {
+        method: "PATCH",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(changes),
+    });
+
+    if (!response.ok) {
+        console.error("Failed to save preferences: " + response.statusText);
+        return;
+    }
+
+    pageData.preferences = await response.json();
+}
+
+function setupWidgetPreferences(root = document) {
+    const preferences = pageData.preferences;
+    if (!preferences) return;
+
+    const collapsed = new Set(preferences.collapsed_widgets);
+    const hidden = new Set(preferences.hidden_widgets);
+    const widgets = findAllWithin(root, ".widget[data-widget-key]");
+
+    for (let i = 0; i < widgets.length; i++) {
+        const widget = widgets[i];
+        const key = widget.dataset.widgetKey;
+        const toggle = widget.querySelector(":scope > .widget-header > .widget-collapse-toggle");
+
+        widget.classList.toggle("widget-hidden", hidden.has(key));
+
+        const setCollapsed = (isCollapsed) => {
+            widget.classList.toggle("widget-collapsed", isCollapsed);
+            toggle?.setAttribute("aria-expanded", isCollapsed ? "false" : "true");
+            toggle?.setAttribute("title", isCollapsed ? "Expand" : "Collapse");
+        };
+
+        setCollapsed(collapsed.has(key));
+
+        toggle?.addEventListener("click", () => {
+            const current = new Set(pageData.preferences.collapsed_widgets);
+            const isCollapsed = !current.has(key);
+
+            isCollapsed ? current.add(key) : current.delete(key);
+            setCollapsed(isCollapsed);
+            savePreferences({ collapsed_widgets: Array.from(current) });
+        });
+    }
+}
+
+// Swiping sideways goes to the next or previous page in the navigation, unless
+// it starts on something which scrolls sideways, such as a carousel
+function setupSwipeNavigation() {
+    const pageElement = document.getElementById("page");
+    if (pageElement.dataset.swipeNavigation === undefined) return;
+
+    const links = Array.from(document.querySelectorAll(".mobile-navigation-page-links .nav-item"));
+    const current = links.findIndex((link) => link.classList.contains("nav-item-current"));
+    if (links.length < 2 || current == -1) return;
+
+    const mobileQuery = matchMedia("(max-width: 1190px)");
+    let start = null;
+
+    const scrollsSideways = (element) => {
+        for (; element !== null && element !== pageElement; element = element.parentElement) {
+            const overflow = getComputedStyle(element).overflowX;
+            if (element.scrollWidth > element.clientWidth && (overflow == "auto" || overflow == "scroll")) {
+                return true;
+            }
+        }
+
+        return false;
+    };
+
+    pageElement.addEventListener("touchstart", (event) => {
+        start = null;
+        if (!mobileQuery.matches || event.touches.length != 1 || scrollsSideways(event.target)) return;
+
+        const touch = event.touches[0];
+        start = { x: touch.clientX, y: touch.clientY, time: Date.now() };
+    }, { passive: true });
+
+    pageElement.addEventListener("touchend", (event) => {
+        if (start === null) return;
+
+        const touch = event.changedTouches[0];
+        const dx = touch.clientX - start.x;
+        const dy = touch.clientY - start.y;
+        const elapsed = Date.now() - start.time;
+        start = null;
+
+        if (Math.abs(dx) < 80 || Math.abs(dx) < Math.abs(dy) * 2 || elapsed > 600) return;
+
+        const next = current + (dx < 0 ? 1 : -1);
+        if (next < 0 || next >= links.length) return;
+
+        location.href = links[next].href;
+    }, { passive: true });
+}
+
+// Widgets get dragged around the columns of the page and the new layout only
+// gets saved once done, after which it's what everyone gets served
+function setupLayoutEditing() {
+    const toggle = document.querySelector(".layout-edit-toggle");
+    if (toggle === null) return;
+
+    const pageElement = document.getElementById("page");
+    const pageContentElement = document.getElementById("page-content");
+    const layoutURL = `${pageData.baseURL}/api/pages/${pageData.slug}/layout`;
+
+    let editing = false;
+    let bar = null;
+    let initialLayout = null;
+    let dragged = null;
+
+    const currentLayout = () => Array.from(
+        pageContentElement.querySelectorAll(".page-columns > .page-column"),
+        (column) => Array.from(column.querySelectorAll(":scope > .widget[data-widget-key]"), (widget) => widget.dataset.widgetKey),
+    );
+
+    const setEditing = (value) => {
+        editing = value;
+        pageElement.classList.toggle("page-editing-layout", editing);
+        toggle.setAttribute("aria-pressed", editing ? "true" : "false");
+
+        if (editing) {
+            initialLayout = JSON.stringify(currentLayout());
+            bar = createBar();
+            pageContentElement.prepend(bar);
+        } else {
+            bar.remove();
+            bar = null;
+        }
+    };
+
+    const createBar = () => {
+        const hint = elem("span").classes("grow", "color-subdue").text(translate("page.layout-hint"));
+        const reset = elem("button").attr("type", "button").text(translate("page.reset-layout"));
+        const done = elem("button").attr("type", "button").text(translate("page.save-layout"));
+
+        const request = async (button, method, body) => {
+            button.disable();
+
+            try {
+                const response = await fetch(layoutURL, {
+                    method,
+                    headers: { "Content-Type": "application/json" },
+                    body: body === undefined ? undefined : JSON.stringify(body),
+                });
+
+                if (!response.ok) {
+                    throw new Error((await response.text()).trim() || response.statusText);
+                }
+
+                return true;
+            } catch (e) {
+                console.error(e);
+                hint.text(translate("page.layout-save-failed"));
+                button.enable();
+                return false;
+            }
+        };
+
+        reset.on("click", async () => {
+            if (await request(reset, "DELETE")) location.reload();
+        });
+
+        done.on("click", async () => {
+            const layout = currentLayout();
+
+            if (JSON.stringify(layout) == initialLayout || await request(done, "PUT", { columns: layout })) {
+                setEditing(false);
+            }
+        });
+
+        return elem().classes("layout-edit-bar", "size-h5").append(hint, reset, done).component({ done });
+    };
+
+    toggle.addEventListener("click", () => {
+        editing ? bar.component.done.click() : setEditing(true);
+    });
+
+    // widgets can get replaced by live updates at any point, so they're
+    // only made draggable right before being dragged
+    pageContentElement.addEventListener("pointerdown", (event) => {
+        if (!editing) return;
+
+        const widget = event.target.closest(".page-column > .widget");
+        if (widget !== null) widget.draggable = true;
+    });
+
+    pageContentElement.addEventListener("dragstart", (event) => {
+        const widget = event.target.closest?.(".page-column > .widget");
+        if (!editing || widget == null) return;
+
+        dragged = widget;
+        dragged.classList.add("widget-dragging");
+        event.dataTransfer.effectAllowed = "move";
+        // Firefox doesn't start the drag without any data
+        event.dataTransfer.setData("text/plain", widget.dataset.widgetKey);
+    });
+
+    pageContentElement.addEventListener("dragover", (event) => {
+        if (dragged === null) return;
+
+        const column = event.target.closest(".page-column");
+        if (column === null) return;
+
+        event.preventDefault();
+
+        const before = Array.from(column.querySelectorAll(":scope > .widget:not(.widget-dragging)")).find((widget) => {
+            const rect = widget.getBoundingClientRect();
+            return event.clientY < rect.top + rect.height / 2;
+        });
+
+        if (before === undefined) {
+            if (column.lastElementChild !== dragged) column.append(dragged);
+        } else if (before.previousElementSibling !== dragged) {
+            column.insertBefore(dragged, before);
+        }
+    });
+
+    pageContentElement.addEventListener("drop", (event) => {
+        if (dragged !== null) event.preventDefault();
+    });
+
+    pageContentElement.addEventListener("dragend", () => {
+        if (dragged === null) return;
+
+        dragged.classList.remove("widget-dragging");
+        dragged.draggable = false;
+        dragged = null;
+    });
+}
+
+function setupKioskMode() {
+    const interval = pageData.preferences?.kiosk_interval;
+    if (!interval) return;
+
+    const links = Array.from(document.querySelectorAll(".mobile-navigation-page-links .nav-item"));
+    const current = links.findIndex((link) => link.classList.contains("nav-item-current"));
+
+    setTimeout(() => {
+        if (links.length < 2) {
+            location.reload();
+            return;
+        }
+
+        location.href = links[(current + 1) % links.length].href;
+    }, interval * 1000);
+}
+
+// Sets up everything within the root, which is either the whole page or a
+// single widget whose content got replaced by a live update
+async function setupContent(root) {
+    setupWidgetPreferences(root);
+    setupWidgetRefresh(root);
+    setupPopovers(root);
+    setupClocks(root);
+    await setupCalendars(root);
+    await setupTodos(root);
+    await setupNotes(root);
+    await setupSeenVideos(root);
+    setupCarousels(root);
+    setupWakeOnLAN(root);
+    setupHabits(root);
+    setupRadars(root);
+    setupRefreshingIframes(root);
+    setupSystemdServices(root);
+    setupHomeAssistant(root);
+    setupCollapsibleLists(root);
+    setupCollapsibleGrids(root);
+    setupGroups(root);
+    setupLazyImages(root);
+}
+
+// Groups would otherwise go back to their first tab every time they get updated
+function preserveSelectedGroupTabs(from, to) {
+    const groups = findAllWithin(from, ".widget-type-group");
+
+    for (let g = 0; g < groups.length; g++) {
+        const group = groups[g];
+        const replacement = group === from ? to : to.querySelector("#" + group.id);
+        if (replacement === null) continue;
+
+        const selected = Array.prototype.findIndex.call(
+            group.getElementsByClassName("widget-header")[0].children,
+            (title) => title.classList.contains("widget-group-title-current")
+        );
+
+        const titles = replacement.getElementsByClassName("widget-header")[0].children;
+        const tabs = replacement.getElementsByClassName("widget-group-contents")[0].children;
+        if (selected <= 0 || selected >= titles.length) continue;
+
+        for (let i = 0; i < titles.length; i++) {
+            titles[i].classList.toggle("widget-group-title-current", i == selected);
+            titles[i].setAttribute("aria-selected", i == selected ? "true" : "false");
+            tabs[i].classList.toggle("widget-group-content-current", i == selected);
+            tabs[i].setAttribute("aria-hidden", i == selected ? "false" : "true");
+        }
+    }
+}
+
+function setupLiveUpdates() {
+    if (window.EventSource === undefined) return;
+
+    const events = new EventSource(`${pageData.baseURL}/api/events?page=${encodeURIComponent(pageData.slug)}`);
+
+    events.addEventListener("widget", (event) => {
+        const data = JSON.parse(event.data);
+        const current = document.getElementById("widget-" + data.id);
+        if (current === null) return;
+
+        replaceWidget(current, data.html);
+    });
+}
+
+async function replaceWidget(current, html) {
+    const template = document.createElement("template");
+    template.innerHTML = html;
+    const replacement = template.content.firstElementChild;
+    if (replacement === null) return;
+
+    preserveSelectedGroupTabs(current, replacement);
+    current.replaceWith(replacement);
+    await setupContent(replacement);
+    updateRelativeTimeForElements(findAllWithin(replacement, "[data-dynamic-relative-time]"));
+    setupTruncatedElementTitles(replacement);
+}
+
+function setupWidgetRefresh(root = document) {
+    const buttons = findAllWithin(root, ".widget-refresh-button");
+
+    for (let i = 0; i < buttons.length; i++) {
+        const button = buttons[i];
+        const widget = button.closest(".widget");
+        const id = widget.id.substring("widget-".length);
+
+        button.addEventListener("click", async () => {
+            if (button.classList.contains("widget-refresh-pending")) return;
+
+            button.classList.remove("widget-refresh-failed");
+            button.classList.add("widget-refresh-pending");
+
+            try {
+                const response = await fetch(`${pageData.baseURL}/api/widgets/${id}/refresh`, { method: "POST" });
+
+                // widgets which time out respond with a placeholder and get pushed once done
+                if (!response.ok && response.status !== 504) {
+                    throw new Error((await response.text()).trim());
+                }
+
+                // the widget might have been replaced by a live update in the meantime
+                const current = document.getElementById(widget.id);
+                if (current !== null) await replaceWidget(current, await response.text());
+            } catch (e) {
+                console.error(e);
+                button.classList.remove("widget-refresh-pending");
+                button.classList.add("widget-refresh-failed");
+            }
+        });
+    }
+}
+
+function setupWidgetPlaceholders() {
+    const placeholders = document.querySelectorAll(".widget-placeholder");
+
+    for (let i = 0; i < placeholders.length; i++) {
+        const placeholder = placeholders[i];
+        const id = placeholder.id.substring("widget-".length);
+
+        fetch(`${pageData.baseURL}/api/widgets/${id}/fragment`)
+            .then(async (response) => {
+                // timing out responds with a placeholder saying so, the content
+                // then gets pushed through the live updates once it's ready
+                if (!response.ok && response.status !== 504) {
+                    throw new Error((await response.text()).trim());
+                }
+
+                const html = await response.text();
+                const current = document.getElementById(placeholder.id);
+
+                // a live update might have already brought in the content
+                if (current !== null && current.classList.contains("widget-placeholder")) {
+                    await replaceWidget(current, html);
+                }
+            })
+            .catch((e) => console.error(e));
+    }
+}
+
 async function setupPage() {
     initThemePicker();
+    setupContentSearch();
 
     const pageElement = document.getElementById("page");
     const pageContentElement = document.getElementById("page-content");
     const pageContent = await fetchPageContent(pageData);
 
     pageContentElement.innerHTML = pageContent;
+    showOfflineNotice(pageContentElement);
 
     try {
-        setupPopovers();
-        setupClocks()
-        await setupCalendars();
-        await setupTodos();
-        setupCarousels();
         setupSearchBoxes();
-        setupCollapsibleLists();
-        setupCollapsibleGrids();
-        setupGroups();
+        await setupContent(document);
         setupMasonries();
         setupDynamicRelativeTime();
-        setupLazyImages();
     } finally {
         pageElement.classList.add("content-ready");
         pageElement.setAttribute("aria-busy", "false");
+        contentReady = true;
 
         for (let i = 0; i < contentReadyCallbacks.length; i++) {
             contentReadyCallbacks[i]();
@@ -777,6 +1791,14 @@ async function setupPage() {
             setupTruncatedElementTitles();
         }, 50);
 
+        setTimeout(highlightWidgetFromHash, 100);
+        setupKioskMode();
+        setupSwipeNavigation();
+        setupLayoutEditing();
+        setupLiveUpdates();
+        setupWidgetPlaceholders();
+        registerServiceWorker();
+
         setTimeout(() => {
             document.body.classList.add("page-columns-transitioned");
         }, 300);
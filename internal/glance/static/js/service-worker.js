@@ -0,0 +1,133 @@
+// Keeps the static assets along with the last rendered version of each page so
+// that Glance can still be opened without a connection. Pages and their content
+// always come from the network first and the cache only gets used when that
+// fails, in which case the response is marked so that the page can tell.
+
+const params = new URL(location).searchParams;
+const basePath = new URL("./", location).pathname;
+const staticPath = params.get("static") ?? `${basePath}static/`;
+
+const staticCacheName = `glance-static-${staticPath.split("/").filter(Boolean).pop()}`;
+const pagesCacheName = "glance-pages";
+const maxCachedPages = 200;
+
+const precachedAssets = [
+    "css/bundle.css",
+    "js/page.js",
+    "js/popover.js",
+    "js/masonry.js",
+    "js/utils.js",
+    "js/templating.js",
+    "app-icon.png",
+];
+
+self.addEventListener("install", (event) => {
+    event.waitUntil((async () => {
+        const cache = await caches.open(staticCacheName);
+        await cache.addAll(precachedAssets.map((asset) => staticPath + asset));
+
+        // redirects to the login page when not logged in, in which case the
+        // home page gets cached once it's been visited
+        const response = await fetch(basePath).catch(() => null);
+        if (response?.ok && !response.redirected) {
+            const pages = await caches.open(pagesCacheName);
+            await pages.put(basePath, response);
+        }
+
+        await self.skipWaiting();
+    })());
+});
+
+self.addEventListener("activate", (event) => {
+    event.waitUntil((async () => {
+        for (const name of await caches.keys()) {
+            if (name.startsWith("glance-static-") && name != staticCacheName) {
+                await caches.delete(name);
+            }
+        }
+
+        await self.clients.claim();
+    })());
+});
+
+self.addEventListener("fetch", (event) => {
+    const request = event.request;
+    if (request.method != "GET" || request.headers.has("range")) return;
+
+    const url = new URL(request.url);
+    if (url.origin != location.origin || !url.pathname.startsWith(basePath)) return;
+
+    const path = url.pathname.slice(basePath.length);
+
+    if (path == "logout") {
+        event.respondWith(caches.delete(pagesCacheName).then(() => fetch(request)));
+        return;
+    }
+
+    if (url.pathname.startsWith(staticPath)) {
+        event.respondWith(cacheFirst(request));
+        return;
+    }
+
+    if (request.mode == "navigate" || /^api\/pages\/[^/]+\/content\/$/.test(path) || path.startsWith("cache/images/") || path == "manifest.json") {
+        event.respondWith(networkFirst(request, request.mode == "navigate"));
+    }
+});
+
+async function cacheFirst(request) {
+    const cache = await caches.open(staticCacheName);
+    const cached = await cache.match(request);
+    if (cached !== undefined) return cached;
+
+    const response = await fetch(request);
+    if (response.ok) await cache.put(request, response.clone());
+
+    return response;
+}
+
+async function networkFirst(request, isNavigation) {
+    const cache = await caches.open(pagesCacheName);
+
+    try {
+        const response = await fetch(request);
+
+        // redirects to the login page shouldn't replace the snapshot either
+        if (response.ok && !response.redirected) {
+            await cache.put(request, response.clone());
+            await trimCache(cache);
+        }
+
+        return response;
+    } catch (error) {
+        let cached = await cache.match(request, { ignoreSearch: isNavigation });
+
+        if (cached === undefined && isNavigation) {
+            cached = await cache.match(basePath);
+        }
+
+        if (cached === undefined) {
+            if (!isNavigation) throw error;
+
+            return new Response(
+                `<!DOCTYPE html><meta name="viewport" content="width=device-width, initial-scale=1.0"><title>Offline</title>` +
+                `<p style="font-family: sans-serif; text-align: center; margin-top: 30vh">You're offline and this page hasn't been opened before.</p>`,
+                { status: 503, headers: { "Content-Type": "text/html; charset=utf-8" } },
+            );
+        }
+
+        const headers = new Headers(cached.headers);
+        headers.set("X-Glance-Offline", "true");
+
+        return new Response(cached.body, { status: cached.status, statusText: cached.statusText, headers });
+    }
+}
+
+// Entries come back in the order they were last stored in, so the ones at the
+// start are the oldest
+async function trimCache(cache) {
+    const keys = await cache.keys();
+
+    for (let i = 0; i < keys.length - maxCachedPages; i++) {
+        await cache.delete(keys[i]);
+    }
+}
@@ -8,7 +8,7 @@ const trashIconSvg = `<svg fill="currentColor" xmlns="http://www.w3.org/2000/svg
 
 export default function(element) {
     element.swapWith(
-        Todo(element.dataset.todoId)
+        Todo(element.dataset.todoId, element.dataset.syncUrl)
     )
 }
 
@@ -45,6 +45,91 @@ function saveToLocalStorage(id, data) {
     localStorage.setItem(`todo-${id}`, JSON.stringify(data));
 }
 
+async function syncRequest(url, method = "GET", body = null) {
+    const response = await fetch(url, {
+        method,
+        headers: body === null ? {} : { "Content-Type": "application/json" },
+        body: body === null ? null : JSON.stringify(body),
+    });
+
+    if (!response.ok) {
+        throw new Error((await response.text()).trim() || response.statusText);
+    }
+
+    return response.status == 204 ? null : response.json();
+}
+
+function formatDate(date) {
+    return date.getFullYear() + "-" +
+        String(date.getMonth() + 1).padStart(2, "0") + "-" +
+        String(date.getDate()).padStart(2, "0");
+}
+
+// Allows setting the priority and due date of new tasks when synced,
+// e.g. "renew passport !1 due:2025-06-01" or "call mom due:tomorrow"
+function parseQuickSyntax(text) {
+    const result = { text, priority: 0, due: "" };
+
+    result.text = result.text.replace(/(^|\s)!([1-3])(?=\s|$)/, (_, space, priority) => {
+        result.priority = parseInt(priority);
+        return space;
+    });
+
+    result.text = result.text.replace(/(^|\s)due:(\S+)(?=\s|$)/i, (match, space, value) => {
+        const date = new Date();
+        value = value.toLowerCase();
+
+        if (value == "today") {
+            result.due = formatDate(date);
+        } else if (value == "tomorrow") {
+            date.setDate(date.getDate() + 1);
+            result.due = formatDate(date);
+        } else if (/^\d{4}-\d{2}-\d{2}$/.test(value)) {
+            result.due = value;
+        } else {
+            return match;
+        }
+
+        return space;
+    });
+
+    result.text = result.text.replace(/\s+/g, " ").trim();
+    return result;
+}
+
+function dueDateText(due) {
+    const today = formatDate(new Date());
+    const tomorrowDate = new Date();
+    tomorrowDate.setDate(tomorrowDate.getDate() + 1);
+
+    if (due < today) return ["overdue · " + due, "color-negative"];
+    if (due == today) return ["today", "color-primary"];
+    if (due == formatDate(tomorrowDate)) return ["tomorrow", ""];
+
+    return [due, ""];
+}
+
+function ItemMeta(data) {
+    if (!data.due && !data.priority) return null;
+
+    const meta = elem().classes("todo-item-meta", "size-h6", "flex", "gap-10");
+
+    if (data.priority) {
+        meta.append(
+            elem("span")
+                .classes("todo-item-priority", `todo-item-priority-${data.priority}`)
+                .text("P" + data.priority)
+        );
+    }
+
+    if (data.due) {
+        const [text, color] = dueDateText(data.due);
+        meta.append(elem("span").tap(span => color && span.classes(color)).text(text));
+    }
+
+    return meta;
+}
+
 function Item(unserialize = {}, onUpdate, onDelete, onEscape, onDragStart) {
     let item, input, inputArea;
 
@@ -53,6 +138,13 @@ function Item(unserialize = {}, onUpdate, onDelete, onEscape, onDragStart) {
         checked: unserialize.checked || false
     };
 
+    // only present for synced to-do lists
+    if (unserialize.id !== undefined) serializeable.id = unserialize.id;
+    if (unserialize.due) serializeable.due = unserialize.due;
+    if (unserialize.priority) serializeable.priority = unserialize.priority;
+
+    const meta = ItemMeta(serializeable);
+
     item = elem().classes("todo-item", "flex", "gap-10", "items-center").append(
         elem("input")
             .classes("todo-item-checkbox", "shrink-0")
@@ -60,7 +152,7 @@ function Item(unserialize = {}, onUpdate, onDelete, onEscape, onDragStart) {
             .attrs({ type: "checkbox" })
             .on("change", (e) => {
                 serializeable.checked = e.target.checked;
-                onUpdate();
+                onUpdate(item);
             })
             .tap(self => self.checked = serializeable.checked),
 
@@ -80,13 +172,17 @@ function Item(unserialize = {}, onUpdate, onDelete, onEscape, onDragStart) {
             })
             .on("input", () => {
                 serializeable.text = inputArea.value;
-                onUpdate();
+                onUpdate(item);
             })
-        ).classes("min-width-0", "grow").append(
-            elem()
-                .classes("todo-item-drag-handle")
-                .on("mousedown", (e) => onDragStart(e, item))
-        ),
+        ).classes("min-width-0", "grow").tap(container => {
+            if (onDragStart === null) return;
+
+            container.append(
+                elem()
+                    .classes("todo-item-drag-handle")
+                    .on("mousedown", (e) => onDragStart(e, item))
+            );
+        }),
 
         elem("button")
             .classes("todo-item-delete", "shrink-0")
@@ -94,15 +190,24 @@ function Item(unserialize = {}, onUpdate, onDelete, onEscape, onDragStart) {
             .on("click", () => onDelete(item))
     );
 
+    // the textarea covers the entire container so the meta has to go outside of it
+    if (meta !== null) {
+        const wrapper = elem().classes("min-width-0", "grow");
+        input.replaceWith(wrapper);
+        wrapper.append(input, meta);
+    }
+
     input.component.setValue(serializeable.text);
     return item.component({
         focusInput: () => inputArea.focus(),
-        serialize: () => serializeable
+        serialize: () => serializeable,
+        setID: (id) => serializeable.id = id,
     });
 }
 
-function Todo(id) {
-    let items, input, inputArea, inputContainer, lastAddedItem;
+function Todo(id, syncURL) {
+    const isSynced = syncURL !== undefined;
+    let items, input, inputArea, inputContainer, lastAddedItem, syncStatus;
     let queuedForRemoval = 0;
     let reorderable;
     let isDragging = false;
@@ -121,37 +226,97 @@ function Todo(id) {
         );
     };
 
+    const showSyncError = (error) => {
+        console.error(error);
+        syncStatus.text("Failed to sync: " + error.message).show();
+    };
+
+    // items that haven't been created remotely yet don't have an ID, their
+    // changes stay queued until they do
+    const pendingUpdates = new Set();
+    const flushPendingUpdates = throttledDebounce(() => {
+        for (const item of Array.from(pendingUpdates)) {
+            const data = item.component.serialize();
+            if (data.id === undefined) continue;
+
+            pendingUpdates.delete(item);
+            if (data.text.trim() === "") continue;
+
+            syncRequest(`${syncURL}/${encodeURIComponent(data.id)}`, "PUT", data).catch(showSyncError);
+        }
+    }, 10, 1000);
+
     const onItemRepositioned = () => saveItems();
     const debouncedOnItemUpdate = throttledDebounce(saveItems, 10, 1000);
 
+    const onItemUpdate = (item) => {
+        if (!isSynced) {
+            debouncedOnItemUpdate();
+            return;
+        }
+
+        pendingUpdates.add(item);
+        flushPendingUpdates();
+    };
+
+    const deleteRemotely = (item) => {
+        const data = item.component.serialize();
+        pendingUpdates.delete(item);
+
+        if (data.id === undefined) {
+            item.deletedBeforeCreated = true;
+            return;
+        }
+
+        syncRequest(`${syncURL}/${encodeURIComponent(data.id)}`, "DELETE").catch(showSyncError);
+    };
+
     const onItemDelete = (item) => {
+        if (isSynced) deleteRemotely(item);
+
         if (lastAddedItem === item) lastAddedItem = null;
         const height = item.clientHeight;
         queuedForRemoval++;
         item.animate(itemAnim(height, false), () => {
             item.remove();
             queuedForRemoval--;
-            saveItems();
+            if (!isSynced) saveItems();
         });
 
         if (items.children.length - queuedForRemoval === 0)
             inputContainer.animate(inputMarginAnim(false));
     };
 
+    // the order of synced tasks is determined by the remote service
     const newItem = (data) => Item(
         data,
-        debouncedOnItemUpdate,
+        onItemUpdate,
         onItemDelete,
         () => inputArea.focus(),
-        onDragStart
+        isSynced ? null : onDragStart
     );
 
+    const createRemotely = async (item) => {
+        try {
+            const created = await syncRequest(syncURL, "POST", item.component.serialize());
+            item.component.setID(created.id);
+
+            if (item.deletedBeforeCreated) {
+                deleteRemotely(item);
+            } else if (pendingUpdates.has(item)) {
+                flushPendingUpdates();
+            }
+        } catch (error) {
+            showSyncError(error);
+        }
+    };
+
     const addNewItem = (itemText, prepend) => {
         const totalItemsBeforeAppending = items.children.length;
-        const item = lastAddedItem = newItem({ text: itemText });
+        const item = lastAddedItem = newItem(isSynced ? parseQuickSyntax(itemText) : { text: itemText });
 
         prepend ? items.prepend(item) : items.append(item);
-        saveItems();
+        isSynced ? createRemotely(item) : saveItems();
         const height = item.clientHeight;
         item.animate(itemAnim(height));
 
@@ -182,10 +347,22 @@ function Todo(id) {
     items = elem()
         .classes("todo-items")
         .append(
-            ...loadFromLocalStorage(id).map(data => newItem(data))
+            ...(isSynced ? [] : loadFromLocalStorage(id).map(data => newItem(data)))
         );
 
+    syncStatus = elem().classes("todo-sync-status", "size-h6", "color-negative", "margin-bottom-10").hide();
+
+    if (isSynced) {
+        syncRequest(syncURL).then((loaded) => {
+            if (loaded.length == 0) return;
+
+            items.append(...loaded.map(data => newItem(data)));
+            inputContainer.classes("margin-bottom-15");
+        }).catch(showSyncError);
+    }
+
     return fragment().append(
+        syncStatus,
         inputContainer = elem()
             .classes("todo-input", "flex", "gap-10", "items-center")
             .classesIf(items.children.length > 0, "margin-bottom-15")
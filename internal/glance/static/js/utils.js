@@ -79,3 +79,18 @@ export function toggleableEvents(element, eventToHandlerMap) {
         }
     ];
 }
+
+// Same as its counterpart on the server, placeholders such as {0} get replaced
+// with the argument at that index
+export function translate(key, ...args) {
+    const message = pageData.messages?.[key] ?? key;
+    return message.replace(/\{(\d+)\}/g, (placeholder, index) => args[index] ?? placeholder);
+}
+
+// The English formats predate the translations and differ from what Intl
+// gives, so they're kept for it
+export const usesEnglish = (pageData.language ?? "en") == "en";
+
+export function dateFormatter(options) {
+    return new Intl.DateTimeFormat(pageData.language, options);
+}
@@ -0,0 +1,150 @@
+package glance
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const stateStoreFileName = "state.json"
+
+// A small key/value store for state that has to survive restarts, such as the
+// layouts of pages. Everything is kept in memory and written to a single JSON
+// file within server.data-path on every change, so it's not meant for values
+// which change on every widget update. When no data path is configured the
+// store only lives in memory.
+type stateStore struct {
+	filePath string
+	mu       sync.RWMutex
+	data     map[string]json.RawMessage
+}
+
+var (
+	stateStoresMu sync.Mutex
+	stateStores   = make(map[string]*stateStore)
+)
+
+// Config reloads create a new application, the store gets reused as long as the
+// data path doesn't change, otherwise we'd lose whatever is held in memory
+func openStateStore(dataPath string) (*stateStore, error) {
+	stateStoresMu.Lock()
+	defer stateStoresMu.Unlock()
+
+	if store, exists := stateStores[dataPath]; exists {
+		return store, nil
+	}
+
+	store := &stateStore{data: make(map[string]json.RawMessage)}
+
+	if dataPath != "" {
+		if err := os.MkdirAll(dataPath, 0755); err != nil {
+			return nil, fmt.Errorf("creating data directory: %v", err)
+		}
+
+		store.filePath = filepath.Join(dataPath, stateStoreFileName)
+
+		contents, err := os.ReadFile(store.filePath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("reading state file: %v", err)
+		}
+
+		if len(contents) > 0 {
+			if err := json.Unmarshal(contents, &store.data); err != nil {
+				return nil, fmt.Errorf("parsing state file %s: %v", store.filePath, err)
+			}
+		}
+	}
+
+	stateStores[dataPath] = store
+	return store, nil
+}
+
+func (s *stateStore) get(key string, value any) (bool, error) {
+	s.mu.RLock()
+	raw, exists := s.data[key]
+	s.mu.RUnlock()
+
+	if !exists {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(raw, value); err != nil {
+		return false, fmt.Errorf("decoding value of %s: %v", key, err)
+	}
+
+	return true, nil
+}
+
+func (s *stateStore) set(key string, value any) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encoding value of %s: %v", key, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data[key] = encoded
+	return s.persist()
+}
+
+func (s *stateStore) delete(keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := false
+	for _, key := range keys {
+		if _, exists := s.data[key]; exists {
+			delete(s.data, key)
+			deleted = true
+		}
+	}
+
+	if !deleted {
+		return nil
+	}
+
+	return s.persist()
+}
+
+func (s *stateStore) keysWithPrefix(prefix string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]string, 0)
+	for key := range s.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// Must be called with the lock held
+func (s *stateStore) persist() error {
+	if s.filePath == "" {
+		return nil
+	}
+
+	contents, err := json.Marshal(s.data)
+	if err != nil {
+		return fmt.Errorf("encoding state: %v", err)
+	}
+
+	// Write to a temporary file first so that a crash mid-write doesn't corrupt the state
+	tempPath := s.filePath + ".tmp"
+	if err := os.WriteFile(tempPath, contents, 0600); err != nil {
+		return fmt.Errorf("writing state file: %v", err)
+	}
+
+	if err := os.Rename(tempPath, s.filePath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("replacing state file: %v", err)
+	}
+
+	return nil
+}
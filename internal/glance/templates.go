@@ -5,6 +5,7 @@ import (
 	"html/template"
 	"math"
 	"strconv"
+	"strings"
 
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
@@ -13,6 +14,7 @@ import (
 var intl = message.NewPrinter(language.English)
 
 var globalTemplateFunctions = template.FuncMap{
+	"t":                  translate,
 	"formatApproxNumber": formatApproxNumber,
 	"formatNumber":       intl.Sprint,
 	"safeCSS": func(str string) template.CSS {
@@ -21,6 +23,7 @@ var globalTemplateFunctions = template.FuncMap{
 	"safeURL": func(str string) template.URL {
 		return template.URL(str)
 	},
+	"proxyImage": imageProxyURL,
 	"safeHTML": func(str string) template.HTML {
 		return template.HTML(str)
 	},
@@ -33,7 +36,8 @@ var globalTemplateFunctions = template.FuncMap{
 	"formatPriceWithPrecision": func(precision int, price float64) string {
 		return intl.Sprintf("%."+strconv.Itoa(precision)+"f", price)
 	},
-	"dynamicRelativeTimeAttrs": dynamicRelativeTimeAttrs,
+	"formatChineseApproxNumber": formatChineseApproxNumber,
+	"dynamicRelativeTimeAttrs":  dynamicRelativeTimeAttrs,
 	"formatServerMegabytes": func(mb uint64) template.HTML {
 		var value string
 		var label string
@@ -71,6 +75,10 @@ func mustParseTemplate(primary string, dependencies ...string) *template.Templat
 }
 
 func formatApproxNumber(count int) string {
+	if currentLocale.Load().usesWan {
+		return formatChineseApproxNumber(count)
+	}
+
 	if count < 1_000 {
 		return strconv.Itoa(count)
 	}
@@ -86,6 +94,24 @@ func formatApproxNumber(count int) string {
 	return strconv.FormatFloat(float64(count)/1_000_000, 'f', 1, 64) + "m"
 }
 
+// Uses 万 (ten thousand) and 亿 (hundred million) the way that Bilibili
+// and other Chinese sites do, e.g. 12.3万
+func formatChineseApproxNumber(count int) string {
+	format := func(value float64, unit string) string {
+		return strings.TrimSuffix(strconv.FormatFloat(value, 'f', 1, 64), ".0") + unit
+	}
+
+	if count < 10_000 {
+		return strconv.Itoa(count)
+	}
+
+	if count < 100_000_000 {
+		return format(float64(count)/10_000, "万")
+	}
+
+	return format(float64(count)/100_000_000, "亿")
+}
+
 func dynamicRelativeTimeAttrs(t interface{ Unix() int64 }) template.HTMLAttr {
 	return template.HTMLAttr(`data-dynamic-relative-time="` + strconv.FormatInt(t.Unix(), 10) + `"`)
 }
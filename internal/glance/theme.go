@@ -3,15 +3,24 @@ package glance
 import (
 	"fmt"
 	"html/template"
+	"log/slog"
+	"maps"
 	"net/http"
+	"regexp"
+	"strings"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 var (
 	themeStyleTemplate         = mustParseTemplate("theme-style.gotmpl")
 	themePresetPreviewTemplate = mustParseTemplate("theme-preset-preview.html")
+	themeAutoPreviewTemplate   = mustParseTemplate("theme-auto-preview.html")
 )
 
+const themeAutoKey = "auto"
+
 func (a *application) handleThemeChangeRequest(w http.ResponseWriter, r *http.Request) {
 	themeKey := r.PathValue("key")
 
@@ -28,11 +37,21 @@ func (a *application) handleThemeChangeRequest(w http.ResponseWriter, r *http.Re
 	http.SetCookie(w, &http.Cookie{
 		Name:     "theme",
 		Value:    themeKey,
-		Path:     a.Config.Server.BaseURL + "/",
+		Path:     a.Config.Server.basePath + "/",
 		SameSite: http.SameSiteLaxMode,
 		Expires:  time.Now().Add(2 * 365 * 24 * time.Hour),
 	})
 
+	if preferences := a.preferencesFromRequest(r); preferences.Theme != themeKey {
+		if key, err := a.preferencesKeyForWriting(w, r); err == nil {
+			preferences.Theme = themeKey
+
+			if err := a.savePreferences(key, preferences); err != nil {
+				slog.Error("Failed to save theme preference", "error", err)
+			}
+		}
+	}
+
 	w.Header().Set("Content-Type", "text/css")
 	w.Header().Set("X-Scheme", ternary(properties.Light, "light", "dark"))
 	w.Write([]byte(properties.CSS))
@@ -47,13 +66,39 @@ type themeProperties struct {
 	ContrastMultiplier       float32        `yaml:"contrast-multiplier"`
 	TextSaturationMultiplier float32        `yaml:"text-saturation-multiplier"`
 
+	// Custom properties set on :root, which can override the ones Glance
+	// derives from the colors as well as any used by custom CSS
+	Variables map[string]string `yaml:"variables"`
+
 	Key                  string        `yaml:"-"`
 	CSS                  template.CSS  `yaml:"-"`
 	PreviewHTML          template.HTML `yaml:"-"`
 	BackgroundColorAsHex string        `yaml:"-"`
 }
 
+var themeVariableNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
 func (t *themeProperties) init() error {
+	if len(t.Variables) > 0 {
+		variables := make(map[string]string, len(t.Variables))
+
+		for name, value := range t.Variables {
+			name = strings.TrimPrefix(name, "--")
+			if !themeVariableNamePattern.MatchString(name) {
+				return fmt.Errorf("invalid variable name %q", name)
+			}
+
+			value = strings.TrimSpace(value)
+			if value == "" || strings.ContainsAny(value, ";{}<>\\\n") {
+				return fmt.Errorf("invalid value for variable %s: %q", name, value)
+			}
+
+			variables[name] = value
+		}
+
+		t.Variables = variables
+	}
+
 	css, err := executeTemplateToString(themeStyleTemplate, t)
 	if err != nil {
 		return fmt.Errorf("compiling theme style: %v", err)
@@ -103,5 +148,139 @@ func (t1 *themeProperties) SameAs(t2 *themeProperties) bool {
 	if !t1.NegativeColor.SameAs(t2.NegativeColor) {
 		return false
 	}
+	if !maps.Equal(t1.Variables, t2.Variables) {
+		return false
+	}
 	return true
 }
+
+// Switches between a light and a dark theme, following the preference of the
+// system or a schedule which uses the local time of the browser. Both themes
+// get sent with the page, the one to use is picked by a script which runs
+// before the page is shown, without it the preference of the system is used.
+type themeAutoField struct {
+	Enabled bool
+	// The keys of the presets to use, "default" being the main theme
+	LightKey string
+	DarkKey  string
+	// When set, the minutes of the day between which the light theme is used
+	Schedule []int
+
+	Light *themeProperties
+	Dark  *themeProperties
+}
+
+type themeAutoPalette struct {
+	CSS        template.CSS `json:"css"`
+	Scheme     string       `json:"scheme"`
+	Background string       `json:"background"`
+}
+
+func (a *themeAutoField) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&a.Enabled)
+	}
+
+	var options struct {
+		Light    string `yaml:"light"`
+		Dark     string `yaml:"dark"`
+		Schedule string `yaml:"schedule"`
+	}
+
+	if err := node.Decode(&options); err != nil {
+		return err
+	}
+
+	a.Enabled = true
+	a.LightKey = options.Light
+	a.DarkKey = options.Dark
+
+	if options.Schedule == "" {
+		return nil
+	}
+
+	from, to, found := strings.Cut(options.Schedule, "-")
+	fromTime, fromErr := time.Parse("15:04", strings.TrimSpace(from))
+	toTime, toErr := time.Parse("15:04", strings.TrimSpace(to))
+	if !found || fromErr != nil || toErr != nil || fromTime.Equal(toTime) {
+		return fmt.Errorf("line %d: invalid schedule %q, expected the times the light theme starts and ends, such as 7:00-19:00", node.Line, options.Schedule)
+	}
+
+	a.Schedule = []int{
+		fromTime.Hour()*60 + fromTime.Minute(),
+		toTime.Hour()*60 + toTime.Minute(),
+	}
+
+	return nil
+}
+
+// Resolves the presets and returns the theme which stands in for them, which
+// is what the page starts with unless another theme was picked
+func (a *themeAutoField) init(main *themeProperties, presets *orderedYAMLMap[string, *themeProperties]) (*themeProperties, error) {
+	if a.LightKey == "" {
+		a.LightKey = ternary(main.Light, "default", "default-light")
+	}
+
+	if a.DarkKey == "" {
+		a.DarkKey = ternary(main.Light, "default-dark", "default")
+	}
+
+	lookup := func(key string) (*themeProperties, error) {
+		if key == "default" {
+			return main, nil
+		}
+
+		if key == themeAutoKey {
+			return nil, fmt.Errorf("preset key %s is reserved for the automatic theme", themeAutoKey)
+		}
+
+		if preset, exists := presets.Get(key); exists {
+			return preset, nil
+		}
+
+		return nil, fmt.Errorf("theme preset \"%s\" does not exist", key)
+	}
+
+	var err error
+	if a.Light, err = lookup(a.LightKey); err != nil {
+		return nil, err
+	}
+
+	if a.Dark, err = lookup(a.DarkKey); err != nil {
+		return nil, err
+	}
+
+	if _, exists := presets.Get(themeAutoKey); exists {
+		return nil, fmt.Errorf("preset key %s is reserved for the automatic theme", themeAutoKey)
+	}
+
+	previewHTML, err := executeTemplateToString(themeAutoPreviewTemplate, a)
+	if err != nil {
+		return nil, fmt.Errorf("compiling theme preview: %v", err)
+	}
+
+	return &themeProperties{
+		Key:                  themeAutoKey,
+		Light:                a.Dark.Light,
+		CSS:                  template.CSS("@media (prefers-color-scheme: light) {" + string(a.Light.CSS) + "}\n@media not all and (prefers-color-scheme: light) {" + string(a.Dark.CSS) + "}"),
+		PreviewHTML:          template.HTML(previewHTML),
+		BackgroundColorAsHex: a.Dark.BackgroundColorAsHex,
+	}, nil
+}
+
+// What the script which picks the theme in the browser needs
+func (a *themeAutoField) Client() map[string]any {
+	palette := func(t *themeProperties) themeAutoPalette {
+		return themeAutoPalette{
+			CSS:        t.CSS,
+			Scheme:     ternary(t.Light, "light", "dark"),
+			Background: t.BackgroundColorAsHex,
+		}
+	}
+
+	return map[string]any{
+		"light":    palette(a.Light),
+		"dark":     palette(a.Dark),
+		"schedule": a.Schedule,
+	}
+}
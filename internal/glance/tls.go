@@ -0,0 +1,691 @@
+package glance
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	tlsChallengeHTTP01 = "http-01"
+	tlsChallengeDNS01  = "dns-01"
+
+	tlsDNSProviderCloudflare = "cloudflare"
+	tlsDNSProviderCommand    = "command"
+
+	// Certificates get renewed once they expire within this long, Let's
+	// Encrypt's are valid for 90 days
+	tlsRenewBefore = 30 * 24 * time.Hour
+	// How often certificates from files get checked for having been replaced
+	tlsFileCheckInterval = time.Minute
+	tlsDNSRequestTimeout = time.Minute
+)
+
+type tlsConfig struct {
+	CertFile string `yaml:"cert-file"`
+	KeyFile  string `yaml:"key-file"`
+	// Plain HTTP requests to this port get redirected to HTTPS, with ACME's
+	// HTTP-01 challenges getting answered on it as well
+	HTTPPort uint16         `yaml:"http-port"`
+	ACME     *tlsACMEConfig `yaml:"acme"`
+}
+
+type tlsACMEConfig struct {
+	Domains      []string `yaml:"domains"`
+	Email        string   `yaml:"email"`
+	Challenge    string   `yaml:"challenge"`
+	DirectoryURL string   `yaml:"directory-url"`
+	// Where the account key and certificates are kept, defaults to a
+	// directory within server.data-path
+	CachePath string `yaml:"cache-path"`
+	DNS       struct {
+		Provider         string        `yaml:"provider"`
+		APIToken         string        `yaml:"api-token"`
+		Command          string        `yaml:"command"`
+		PropagationDelay durationField `yaml:"propagation-delay"`
+	} `yaml:"dns"`
+}
+
+func (c *tlsConfig) UnmarshalYAML(node *yaml.Node) error {
+	type tlsConfigAlias tlsConfig
+
+	if err := node.Decode((*tlsConfigAlias)(c)); err != nil {
+		return err
+	}
+
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("line %d: cert-file and key-file must be set together", node.Line)
+	}
+
+	if c.CertFile != "" && c.ACME != nil {
+		return fmt.Errorf("line %d: cert-file and key-file can't be used along with acme", node.Line)
+	}
+
+	if c.CertFile == "" && c.ACME == nil {
+		return fmt.Errorf("line %d: tls needs either cert-file and key-file or acme", node.Line)
+	}
+
+	if c.ACME == nil {
+		return nil
+	}
+
+	acmeConfig := c.ACME
+
+	if len(acmeConfig.Domains) == 0 {
+		return fmt.Errorf("line %d: acme needs at least one domain", node.Line)
+	}
+
+	switch acmeConfig.Challenge {
+	case "", tlsChallengeHTTP01:
+		acmeConfig.Challenge = tlsChallengeHTTP01
+
+		if slices.ContainsFunc(acmeConfig.Domains, func(domain string) bool { return strings.HasPrefix(domain, "*.") }) {
+			return fmt.Errorf("line %d: wildcard domains require the dns-01 challenge", node.Line)
+		}
+
+		if c.HTTPPort == 0 {
+			c.HTTPPort = 80
+		}
+	case tlsChallengeDNS01:
+		switch acmeConfig.DNS.Provider {
+		case tlsDNSProviderCloudflare:
+			if acmeConfig.DNS.APIToken == "" {
+				return fmt.Errorf("line %d: the cloudflare dns provider needs an api-token", node.Line)
+			}
+		case tlsDNSProviderCommand:
+			if acmeConfig.DNS.Command == "" {
+				return fmt.Errorf("line %d: the command dns provider needs a command", node.Line)
+			}
+		default:
+			return fmt.Errorf("line %d: unsupported dns provider %q, must be one of cloudflare or command", node.Line, acmeConfig.DNS.Provider)
+		}
+
+		if acmeConfig.DNS.PropagationDelay == 0 {
+			acmeConfig.DNS.PropagationDelay = durationField(30 * time.Second)
+		}
+	default:
+		return fmt.Errorf("line %d: unsupported challenge %q, must be one of http-01 or dns-01", node.Line, acmeConfig.Challenge)
+	}
+
+	if acmeConfig.DirectoryURL == "" {
+		acmeConfig.DirectoryURL = acme.LetsEncryptURL
+	}
+
+	return nil
+}
+
+func (c *tlsACMEConfig) cacheDir(dataPath string) string {
+	if c.CachePath != "" {
+		return c.CachePath
+	}
+
+	return filepath.Join(dataPath, "certificates")
+}
+
+type tlsServer struct {
+	config *tls.Config
+	// Serves the port which plain HTTP requests get redirected from, nil when
+	// there isn't one
+	httpHandler http.Handler
+	// Keeps the certificate up to date in the background, nil when there's
+	// nothing to keep up to date
+	run func(ctx context.Context)
+}
+
+// Certificates from files are loaded right away so that a config with a
+// broken certificate doesn't replace a working one
+func newTLSServer(config *config) (*tlsServer, error) {
+	serverConfig := config.Server.TLS
+	server := &tlsServer{}
+
+	switch {
+	case serverConfig.ACME == nil:
+		files := &tlsCertificateFiles{certFile: serverConfig.CertFile, keyFile: serverConfig.KeyFile}
+		if err := files.load(); err != nil {
+			return nil, err
+		}
+
+		server.config = &tls.Config{GetCertificate: files.getCertificate}
+	case serverConfig.ACME.Challenge == tlsChallengeHTTP01:
+		acmeConfig := serverConfig.ACME
+
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(acmeConfig.cacheDir(config.Server.DataPath)),
+			HostPolicy: autocert.HostWhitelist(acmeConfig.Domains...),
+			Email:      acmeConfig.Email,
+			Client:     &acme.Client{DirectoryURL: acmeConfig.DirectoryURL},
+		}
+
+		// also answers TLS-ALPN-01 challenges
+		server.config = manager.TLSConfig()
+		server.httpHandler = manager.HTTPHandler(tlsRedirectHandler(config.Server.Port))
+	default:
+		manager, err := newACMEDNSManager(serverConfig.ACME, serverConfig.ACME.cacheDir(config.Server.DataPath))
+		if err != nil {
+			return nil, err
+		}
+
+		server.config = &tls.Config{GetCertificate: manager.getCertificate}
+		server.run = manager.run
+	}
+
+	if serverConfig.HTTPPort != 0 && server.httpHandler == nil {
+		server.httpHandler = tlsRedirectHandler(config.Server.Port)
+	}
+
+	return server, nil
+}
+
+func tlsRedirectHandler(httpsPort uint16) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if hostWithoutPort, _, err := net.SplitHostPort(host); err == nil {
+			host = hostWithoutPort
+		}
+
+		if httpsPort != 443 {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(int(httpsPort)))
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// Certificates from tools such as certbot get replaced when they're renewed,
+// in which case the new one gets picked up without having to restart
+type tlsCertificateFiles struct {
+	certFile    string
+	keyFile     string
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	modTime     time.Time
+	checkedAt   time.Time
+}
+
+func (f *tlsCertificateFiles) lastModified() (time.Time, error) {
+	var latest time.Time
+
+	for _, path := range []string{f.certFile, f.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+func (f *tlsCertificateFiles) load() error {
+	modTime, err := f.lastModified()
+	if err != nil {
+		return fmt.Errorf("reading TLS certificate: %v", err)
+	}
+
+	certificate, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %v", err)
+	}
+
+	f.certificate = &certificate
+	f.modTime = modTime
+	f.checkedAt = time.Now()
+
+	return nil
+}
+
+func (f *tlsCertificateFiles) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if time.Since(f.checkedAt) < tlsFileCheckInterval {
+		return f.certificate, nil
+	}
+
+	f.checkedAt = time.Now()
+
+	// the files can be in the middle of being replaced, the current
+	// certificate gets kept until both of them load
+	if modTime, err := f.lastModified(); err == nil && !modTime.Equal(f.modTime) {
+		if err := f.load(); err != nil {
+			slog.Error("Failed to reload TLS certificate", "error", err)
+		} else {
+			slog.Info("Reloaded TLS certificate", "cert_file", f.certFile)
+		}
+	}
+
+	return f.certificate, nil
+}
+
+// The autocert package only supports the challenges that are answered by the
+// server itself, certificates which are obtained through DNS records get
+// requested and renewed here instead. The account key and the certificate,
+// along with its key, are kept as PEM files in the cache directory.
+type acmeDNSManager struct {
+	config      *tlsACMEConfig
+	dir         string
+	provider    acmeDNSProvider
+	certificate atomic.Pointer[tls.Certificate]
+}
+
+type acmeDNSProvider interface {
+	// Creates a TXT record and returns the function that removes it again
+	present(ctx context.Context, name, value string) (func(), error)
+}
+
+func newACMEDNSManager(config *tlsACMEConfig, dir string) (*acmeDNSManager, error) {
+	manager := &acmeDNSManager{config: config, dir: dir}
+
+	switch config.DNS.Provider {
+	case tlsDNSProviderCloudflare:
+		manager.provider = &cloudflareDNSProvider{token: config.DNS.APIToken}
+	case tlsDNSProviderCommand:
+		manager.provider = &commandDNSProvider{command: config.DNS.Command}
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating certificates directory: %v", err)
+	}
+
+	contents, err := os.ReadFile(manager.certificatePath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading TLS certificate: %v", err)
+	}
+
+	if len(contents) > 0 {
+		certificate, err := tls.X509KeyPair(contents, contents)
+		if err != nil {
+			slog.Warn("Ignoring invalid cached TLS certificate", "path", manager.certificatePath(), "error", err)
+		} else {
+			manager.certificate.Store(&certificate)
+		}
+	}
+
+	return manager, nil
+}
+
+func (m *acmeDNSManager) certificatePath() string {
+	return filepath.Join(m.dir, "certificate.pem")
+}
+
+func (m *acmeDNSManager) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if certificate := m.certificate.Load(); certificate != nil {
+		return certificate, nil
+	}
+
+	return nil, errors.New("the TLS certificate has not been obtained yet")
+}
+
+func (m *acmeDNSManager) needsRenewal() bool {
+	certificate := m.certificate.Load()
+	if certificate == nil || certificate.Leaf == nil {
+		return true
+	}
+
+	// the domains may have changed since it was obtained
+	if !slices.Equal(slices.Sorted(slices.Values(certificate.Leaf.DNSNames)), slices.Sorted(slices.Values(m.config.Domains))) {
+		return true
+	}
+
+	return time.Until(certificate.Leaf.NotAfter) < tlsRenewBefore
+}
+
+func (m *acmeDNSManager) run(ctx context.Context) {
+	for {
+		wait := 12 * time.Hour
+
+		if m.needsRenewal() {
+			slog.Info("Obtaining TLS certificate", "domains", m.config.Domains)
+
+			if err := m.obtain(ctx); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				slog.Error("Failed to obtain TLS certificate", "error", err)
+				wait = time.Hour
+			} else {
+				slog.Info("Obtained TLS certificate", "domains", m.config.Domains)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (m *acmeDNSManager) accountKey() (*ecdsa.PrivateKey, error) {
+	path := filepath.Join(m.dir, "account.key")
+
+	contents, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(contents)
+		if block == nil {
+			return nil, fmt.Errorf("invalid account key in %s", path)
+		}
+
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := encodeECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(path, encoded, 0600); err != nil {
+		return nil, fmt.Errorf("writing account key: %v", err)
+	}
+
+	return key, nil
+}
+
+func (m *acmeDNSManager) obtain(ctx context.Context) error {
+	accountKey, err := m.accountKey()
+	if err != nil {
+		return err
+	}
+
+	client := &acme.Client{Key: accountKey, DirectoryURL: m.config.DirectoryURL}
+
+	account := &acme.Account{}
+	if m.config.Email != "" {
+		account.Contact = []string{"mailto:" + m.config.Email}
+	}
+
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("registering account: %v", err)
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(m.config.Domains...))
+	if err != nil {
+		return fmt.Errorf("creating order: %v", err)
+	}
+
+	var pending []*acme.Challenge
+	var authorizations []string
+
+	for _, authorizationURL := range order.AuthzURLs {
+		authorization, err := client.GetAuthorization(ctx, authorizationURL)
+		if err != nil {
+			return fmt.Errorf("getting authorization: %v", err)
+		}
+
+		if authorization.Status == acme.StatusValid {
+			continue
+		}
+
+		index := slices.IndexFunc(authorization.Challenges, func(c *acme.Challenge) bool { return c.Type == tlsChallengeDNS01 })
+		if index == -1 {
+			return fmt.Errorf("no dns-01 challenge offered for %s", authorization.Identifier.Value)
+		}
+
+		challenge := authorization.Challenges[index]
+		value, err := client.DNS01ChallengeRecord(challenge.Token)
+		if err != nil {
+			return err
+		}
+
+		// wildcard domains get validated through the record of their base domain
+		cleanup, err := m.provider.present(ctx, "_acme-challenge."+authorization.Identifier.Value, value)
+		if err != nil {
+			return fmt.Errorf("creating DNS record for %s: %v", authorization.Identifier.Value, err)
+		}
+		defer cleanup()
+
+		pending = append(pending, challenge)
+		authorizations = append(authorizations, authorization.URI)
+	}
+
+	if len(pending) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(m.config.DNS.PropagationDelay)):
+		}
+	}
+
+	for i := range pending {
+		if _, err := client.Accept(ctx, pending[i]); err != nil {
+			return fmt.Errorf("accepting challenge: %v", err)
+		}
+
+		if _, err := client.WaitAuthorization(ctx, authorizations[i]); err != nil {
+			return fmt.Errorf("waiting for authorization: %v", err)
+		}
+	}
+
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return fmt.Errorf("waiting for order: %v", err)
+	}
+
+	certificateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: m.config.Domains}, certificateKey)
+	if err != nil {
+		return err
+	}
+
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("finalizing order: %v", err)
+	}
+
+	encoded, err := encodeECPrivateKey(certificateKey)
+	if err != nil {
+		return err
+	}
+
+	for _, der := range chain {
+		encoded = append(encoded, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+
+	certificate, err := tls.X509KeyPair(encoded, encoded)
+	if err != nil {
+		return fmt.Errorf("parsing obtained certificate: %v", err)
+	}
+
+	tempPath := m.certificatePath() + ".tmp"
+	if err := os.WriteFile(tempPath, encoded, 0600); err != nil {
+		return fmt.Errorf("writing certificate: %v", err)
+	}
+
+	if err := os.Rename(tempPath, m.certificatePath()); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("replacing certificate: %v", err)
+	}
+
+	m.certificate.Store(&certificate)
+	return nil
+}
+
+func encodeECPrivateKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+type cloudflareDNSProvider struct {
+	token string
+}
+
+func (p *cloudflareDNSProvider) request(ctx context.Context, method, path string, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, "https://api.cloudflare.com/client/v4"+path, reader)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Authorization", "Bearer "+p.token)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := defaultHTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	var envelope struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+		Result json.RawMessage `json:"result"`
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("cloudflare: unexpected response with status code %d", response.StatusCode)
+	}
+
+	if !envelope.Success {
+		if len(envelope.Errors) > 0 {
+			return fmt.Errorf("cloudflare: %s (code %d)", envelope.Errors[0].Message, envelope.Errors[0].Code)
+		}
+
+		return fmt.Errorf("cloudflare: request failed with status code %d", response.StatusCode)
+	}
+
+	if result != nil {
+		return json.Unmarshal(envelope.Result, result)
+	}
+
+	return nil
+}
+
+// The zone is the longest suffix of the name which Cloudflare knows of
+func (p *cloudflareDNSProvider) findZone(ctx context.Context, name string) (string, error) {
+	labels := strings.Split(name, ".")
+
+	for i := 1; i < len(labels)-1; i++ {
+		var zones []struct {
+			ID string `json:"id"`
+		}
+
+		err := p.request(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(strings.Join(labels[i:], ".")), nil, &zones)
+		if err != nil {
+			return "", err
+		}
+
+		if len(zones) > 0 {
+			return zones[0].ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("cloudflare: no zone found for %s", name)
+}
+
+func (p *cloudflareDNSProvider) present(ctx context.Context, name, value string) (func(), error) {
+	zoneID, err := p.findZone(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var record struct {
+		ID string `json:"id"`
+	}
+
+	err = p.request(ctx, http.MethodPost, "/zones/"+zoneID+"/dns_records", map[string]any{
+		"type":    "TXT",
+		"name":    name,
+		"content": value,
+		"ttl":     120,
+	}, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tlsDNSRequestTimeout)
+		defer cancel()
+
+		if err := p.request(ctx, http.MethodDelete, "/zones/"+zoneID+"/dns_records/"+record.ID, nil, nil); err != nil {
+			slog.Error("Failed to remove DNS record", "name", name, "error", err)
+		}
+	}, nil
+}
+
+// Runs the command with "present" or "cleanup", the name of the record and its
+// value as arguments, for DNS providers which aren't supported directly
+type commandDNSProvider struct {
+	command string
+}
+
+func (p *commandDNSProvider) exec(ctx context.Context, action, name, value string) error {
+	ctx, cancel := context.WithTimeout(ctx, tlsDNSRequestTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, p.command, action, name, value).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", action, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+func (p *commandDNSProvider) present(ctx context.Context, name, value string) (func(), error) {
+	if err := p.exec(ctx, "present", name, value); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if err := p.exec(context.Background(), "cleanup", name, value); err != nil {
+			slog.Error("Failed to remove DNS record", "name", name, "error", err)
+		}
+	}, nil
+}
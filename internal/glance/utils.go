@@ -8,8 +8,10 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -54,11 +56,14 @@ func svgPolylineCoordsFromYValues(width float64, height float64, values []float6
 	max := slices.Max(values)
 
 	for i := range values {
-		coordinates[i] = fmt.Sprintf(
-			"%.2f,%.2f",
-			float64(i)*distanceBetweenPoints,
-			((max-values[i])/(max-min))*height+verticalPadding,
-		)
+		y := height/2 + verticalPadding
+
+		// all values being the same would otherwise divide by zero
+		if max != min {
+			y = ((max-values[i])/(max-min))*height + verticalPadding
+		}
+
+		coordinates[i] = fmt.Sprintf("%.2f,%.2f", float64(i)*distanceBetweenPoints, y)
 	}
 
 	return strings.Join(coordinates, " ")
@@ -146,13 +151,17 @@ func titleToSlug(s string) string {
 	return s
 }
 
-func fileServerWithCache(fs http.FileSystem, cacheDuration time.Duration) http.Handler {
+func fileServerWithCache(fs http.FileSystem, cacheControlValue string) http.Handler {
 	server := http.FileServer(fs)
-	cacheControlValue := fmt.Sprintf("public, max-age=%d", int(cacheDuration.Seconds()))
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// TODO: fix always setting cache control even if the file doesn't exist
-		w.Header().Set("Cache-Control", cacheControlValue)
+		// otherwise a missing file would keep being missing for as long as
+		// the cache lasts, even once it's been added
+		if file, err := fs.Open(path.Clean("/" + r.URL.Path)); err == nil {
+			file.Close()
+			w.Header().Set("Cache-Control", cacheControlValue)
+		}
+
 		server.ServeHTTP(w, r)
 	})
 }
@@ -245,3 +254,7 @@ func hslToHex(h, s, l float64) string {
 
 	return fmt.Sprintf("#%02x%02x%02x", ir, ig, ib)
 }
+
+func pluralize(count int, unit string) string {
+	return strconv.Itoa(count) + " " + unit + ternary(count == 1, "", "s")
+}
@@ -0,0 +1,152 @@
+package glance
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	wakeOnLANDefaultBroadcast = "255.255.255.255"
+	wakeOnLANDefaultPort      = 9
+)
+
+// Widgets that have items which can wake machines need to implement this so that
+// the targets can be looked up when a request to wake one of them comes in
+type wakeOnLANCapableWidget interface {
+	wakeOnLANTargets() []*wakeOnLANField
+}
+
+type wakeOnLANField struct {
+	MAC       string `yaml:"mac"`
+	Broadcast string `yaml:"broadcast"`
+	Port      uint16 `yaml:"port"`
+	// Identifies the target in requests without exposing its MAC address to the page
+	Key          string           `yaml:"-"`
+	hardwareAddr net.HardwareAddr `yaml:"-"`
+	address      string           `yaml:"-"`
+}
+
+func (f *wakeOnLANField) UnmarshalYAML(node *yaml.Node) error {
+	type wakeOnLANFieldAlias wakeOnLANField
+	alias := (*wakeOnLANFieldAlias)(f)
+
+	// allows for both `wake-on-lan: <mac>` and specifying the individual options
+	if err := node.Decode(&f.MAC); err != nil {
+		if err := node.Decode(alias); err != nil {
+			return err
+		}
+	}
+
+	hardwareAddr, err := net.ParseMAC(f.MAC)
+	if err != nil {
+		return fmt.Errorf("invalid wake-on-lan MAC address %s: %v", f.MAC, err)
+	}
+
+	if len(hardwareAddr) != 6 {
+		return fmt.Errorf("wake-on-lan MAC address %s must be 6 bytes long", f.MAC)
+	}
+
+	if f.Broadcast == "" {
+		f.Broadcast = wakeOnLANDefaultBroadcast
+	}
+
+	if f.Port == 0 {
+		f.Port = wakeOnLANDefaultPort
+	}
+
+	if net.ParseIP(f.Broadcast) == nil {
+		return fmt.Errorf("wake-on-lan broadcast address %s is not a valid IP address", f.Broadcast)
+	}
+
+	f.hardwareAddr = hardwareAddr
+	f.address = net.JoinHostPort(f.Broadcast, strconv.Itoa(int(f.Port)))
+
+	hash := sha256.Sum256([]byte(hardwareAddr.String() + "|" + f.address))
+	f.Key = hex.EncodeToString(hash[:8])
+
+	return nil
+}
+
+// The magic packet is 6 bytes of 0xFF followed by the MAC address repeated 16 times
+func (f *wakeOnLANField) magicPacket() []byte {
+	packet := bytes.Repeat([]byte{0xFF}, 6)
+
+	for range 16 {
+		packet = append(packet, f.hardwareAddr...)
+	}
+
+	return packet
+}
+
+func (f *wakeOnLANField) wake() error {
+	conn, err := net.DialTimeout("udp", f.address, 3*time.Second)
+	if err != nil {
+		return fmt.Errorf("dialing %s: %v", f.address, err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(f.magicPacket()); err != nil {
+		return fmt.Errorf("sending magic packet to %s: %v", f.address, err)
+	}
+
+	return nil
+}
+
+func (a *application) handleWakeOnLANRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	key := r.PathValue("target")
+	target, exists := a.wakeOnLANTargets[key]
+	if !exists || !slices.ContainsFunc(a.wakeOnLANTargetWidgets[key], func(id uint64) bool { return a.canAccessWidget(r, id) }) {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	if err := target.wake(); err != nil {
+		slog.Error("Failed to send wake-on-lan packet", "mac", target.MAC, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	slog.Info("Sent wake-on-lan packet", "mac", target.MAC, "address", target.address)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (widget *bookmarksWidget) wakeOnLANTargets() []*wakeOnLANField {
+	targets := make([]*wakeOnLANField, 0)
+
+	for g := range widget.Groups {
+		for l := range widget.Groups[g].Links {
+			if target := widget.Groups[g].Links[l].WakeOnLAN; target != nil {
+				targets = append(targets, target)
+			}
+		}
+	}
+
+	return targets
+}
+
+func (widget *monitorWidget) wakeOnLANTargets() []*wakeOnLANField {
+	targets := make([]*wakeOnLANField, 0)
+
+	for i := range widget.Sites {
+		if target := widget.Sites[i].WakeOnLAN; target != nil {
+			targets = append(targets, target)
+		}
+	}
+
+	return targets
+}
@@ -0,0 +1,436 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var printerWidgetTemplate = mustParseTemplate("3d-printer.html", "widget-base.html")
+
+const (
+	printerServiceOctoPrint = "octoprint"
+	printerServiceMoonraker = "moonraker"
+)
+
+const (
+	printerStatePrinting = "printing"
+	printerStatePaused   = "paused"
+	printerStateReady    = "ready"
+	printerStateError    = "error"
+	printerStateOffline  = "offline"
+)
+
+const printerSnapshotCacheTime = 10 * time.Second
+
+type printerWidget struct {
+	widgetBase    `yaml:",inline"`
+	Service       string         `yaml:"service"`
+	URL           string         `yaml:"url"`
+	APIKey        string         `yaml:"api-key"`
+	AllowInsecure bool           `yaml:"allow-insecure"`
+	WebcamURL     string         `yaml:"webcam-url"`
+	HideWebcam    bool           `yaml:"hide-webcam"`
+	Status        *printerStatus `yaml:"-"`
+	client        requestDoer    `yaml:"-"`
+	snapshots     *tileCache     `yaml:"-"`
+	// Worked out on every update for Moonraker since its webcams can change
+	snapshotURL string     `yaml:"-"`
+	mu          sync.Mutex `yaml:"-"`
+}
+
+type printerStatus struct {
+	State     string
+	Message   string
+	FileName  string
+	Progress  int
+	Elapsed   time.Duration
+	Remaining time.Duration
+	Hotend    printerTemperature
+	Bed       printerTemperature
+	HasWebcam bool
+}
+
+type printerTemperature struct {
+	Actual float64
+	Target float64
+}
+
+func (widget *printerWidget) initialize() error {
+	widget.withTitle("3D Printer").withCacheDuration(30 * time.Second)
+
+	switch widget.Service {
+	case printerServiceOctoPrint, printerServiceMoonraker:
+	default:
+		return fmt.Errorf("service must be one of: %s, %s", printerServiceOctoPrint, printerServiceMoonraker)
+	}
+
+	if widget.URL == "" {
+		return errors.New("url is required")
+	}
+
+	if widget.Service == printerServiceOctoPrint && widget.APIKey == "" {
+		return errors.New("api-key is required for OctoPrint")
+	}
+
+	widget.URL = strings.TrimRight(widget.URL, "/")
+	widget.withTitleURL(widget.URL)
+
+	widget.client = widget.httpClient(ternary(widget.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient))
+	widget.snapshots = newTileCache(1)
+	widget.snapshots.client = widget.client
+	if widget.APIKey != "" {
+		widget.snapshots.headers = map[string]string{"X-Api-Key": widget.APIKey}
+	}
+
+	if widget.WebcamURL != "" {
+		widget.snapshotURL = widget.resolveURL(widget.WebcamURL)
+	} else if widget.Service == printerServiceOctoPrint {
+		widget.snapshotURL = widget.URL + "/webcam/?action=snapshot"
+	}
+
+	return nil
+}
+
+func (widget *printerWidget) update(ctx context.Context) {
+	var status *printerStatus
+	var err error
+
+	switch widget.Service {
+	case printerServiceOctoPrint:
+		status, err = widget.fetchOctoPrintStatus(ctx)
+	case printerServiceMoonraker:
+		status, err = widget.fetchMoonrakerStatus(ctx)
+	}
+
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.mu.Lock()
+	status.HasWebcam = !widget.HideWebcam && widget.snapshotURL != "" && status.State != printerStateOffline
+	widget.mu.Unlock()
+
+	widget.Status = status
+}
+
+func (widget *printerWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, printerWidgetTemplate)
+}
+
+func (widget *printerWidget) SnapshotURL() string {
+	if widget.Providers == nil {
+		return ""
+	}
+
+	return widget.Providers.baseURL + "/api/widgets/" + strconv.FormatUint(widget.ID, 10) + "/snapshot"
+}
+
+// Webcam URLs are usually relative to the printer's host
+func (widget *printerWidget) resolveURL(path string) string {
+	base, err := url.Parse(widget.URL + "/")
+	if err != nil {
+		return path
+	}
+
+	resolved, err := base.Parse(path)
+	if err != nil {
+		return path
+	}
+
+	return resolved.String()
+}
+
+func (widget *printerWidget) request(ctx context.Context, path string) *http.Request {
+	request, _ := http.NewRequestWithContext(ctx, "GET", widget.URL+path, nil)
+	if widget.APIKey != "" {
+		request.Header.Set("X-Api-Key", widget.APIKey)
+	}
+
+	return request
+}
+
+func (status *printerStatus) IsActive() bool {
+	return status.State == printerStatePrinting || status.State == printerStatePaused
+}
+
+func (status *printerStatus) StateText() string {
+	switch status.State {
+	case printerStatePrinting:
+		return "Printing"
+	case printerStatePaused:
+		return "Paused"
+	case printerStateReady:
+		return "Ready"
+	case printerStateError:
+		return "Error"
+	}
+
+	return "Offline"
+}
+
+func (status *printerStatus) ETA() time.Time {
+	return time.Now().Add(status.Remaining)
+}
+
+func (status *printerStatus) ElapsedText() string {
+	return formatPrintDuration(status.Elapsed)
+}
+
+func (status *printerStatus) RemainingText() string {
+	return formatPrintDuration(status.Remaining)
+}
+
+func (temperature printerTemperature) String() string {
+	text := strconv.FormatFloat(math.Round(temperature.Actual), 'f', 0, 64) + "°C"
+	if temperature.Target > 0 {
+		text += " / " + strconv.FormatFloat(math.Round(temperature.Target), 'f', 0, 64) + "°C"
+	}
+
+	return text
+}
+
+func formatPrintDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+
+	if hours == 0 {
+		return strconv.Itoa(minutes) + "m"
+	}
+
+	return strconv.Itoa(hours) + "h " + strconv.Itoa(minutes) + "m"
+}
+
+type octoPrintJobResponseJson struct {
+	State string `json:"state"`
+	Job   struct {
+		File struct {
+			Name    string `json:"name"`
+			Display string `json:"display"`
+		} `json:"file"`
+	} `json:"job"`
+	Progress struct {
+		Completion    *float64 `json:"completion"`
+		PrintTime     *float64 `json:"printTime"`
+		PrintTimeLeft *float64 `json:"printTimeLeft"`
+	} `json:"progress"`
+	Error string `json:"error"`
+}
+
+type octoPrintPrinterResponseJson struct {
+	Temperature map[string]struct {
+		Actual float64 `json:"actual"`
+		Target float64 `json:"target"`
+	} `json:"temperature"`
+}
+
+func (widget *printerWidget) fetchOctoPrintStatus(ctx context.Context) (*printerStatus, error) {
+	job, err := decodeJsonFromRequest[octoPrintJobResponseJson](widget.client, widget.request(ctx, "/api/job"))
+	if err != nil {
+		var netErr *url.Error
+		if errors.As(err, &netErr) {
+			return &printerStatus{State: printerStateOffline}, nil
+		}
+
+		return nil, fmt.Errorf("%w: fetching job: %v", errNoContent, err)
+	}
+
+	status := &printerStatus{}
+	state := strings.ToLower(job.State)
+
+	switch {
+	case strings.HasPrefix(state, "printing"), state == "pausing", state == "cancelling", state == "finishing":
+		status.State = printerStatePrinting
+	case state == "paused":
+		status.State = printerStatePaused
+	case state == "operational":
+		status.State = printerStateReady
+	case strings.HasPrefix(state, "offline"), state == "closed", strings.HasPrefix(state, "detecting"), strings.HasPrefix(state, "connecting"), state == "opening serial connection":
+		status.State = printerStateOffline
+	default:
+		status.State = printerStateError
+		status.Message = ternary(job.Error != "", job.Error, job.State)
+	}
+
+	if status.IsActive() {
+		status.FileName = ternary(job.Job.File.Display != "", job.Job.File.Display, job.Job.File.Name)
+		if job.Progress.Completion != nil {
+			status.Progress = int(*job.Progress.Completion)
+		}
+		if job.Progress.PrintTime != nil {
+			status.Elapsed = time.Duration(*job.Progress.PrintTime) * time.Second
+		}
+		if job.Progress.PrintTimeLeft != nil {
+			status.Remaining = time.Duration(*job.Progress.PrintTimeLeft) * time.Second
+		}
+	}
+
+	if status.State == printerStateOffline {
+		return status, nil
+	}
+
+	printer, err := decodeJsonFromRequest[octoPrintPrinterResponseJson](widget.client, widget.request(ctx, "/api/printer?history=false"))
+	if err != nil {
+		return status, fmt.Errorf("%w: fetching temperatures: %v", errPartialContent, err)
+	}
+
+	if tool, ok := printer.Temperature["tool0"]; ok {
+		status.Hotend = printerTemperature{Actual: tool.Actual, Target: tool.Target}
+	}
+
+	if bed, ok := printer.Temperature["bed"]; ok {
+		status.Bed = printerTemperature{Actual: bed.Actual, Target: bed.Target}
+	}
+
+	return status, nil
+}
+
+type moonrakerObjectsResponseJson struct {
+	Result struct {
+		Status struct {
+			PrintStats struct {
+				State         string  `json:"state"`
+				Filename      string  `json:"filename"`
+				PrintDuration float64 `json:"print_duration"`
+				Message       string  `json:"message"`
+			} `json:"print_stats"`
+			VirtualSDCard struct {
+				Progress float64 `json:"progress"`
+			} `json:"virtual_sdcard"`
+			Extruder struct {
+				Temperature float64 `json:"temperature"`
+				Target      float64 `json:"target"`
+			} `json:"extruder"`
+			HeaterBed struct {
+				Temperature float64 `json:"temperature"`
+				Target      float64 `json:"target"`
+			} `json:"heater_bed"`
+			Webhooks struct {
+				State        string `json:"state"`
+				StateMessage string `json:"state_message"`
+			} `json:"webhooks"`
+		} `json:"status"`
+	} `json:"result"`
+}
+
+type moonrakerWebcamsResponseJson struct {
+	Result struct {
+		Webcams []struct {
+			Enabled     *bool  `json:"enabled"`
+			SnapshotURL string `json:"snapshot_url"`
+		} `json:"webcams"`
+	} `json:"result"`
+}
+
+func (widget *printerWidget) fetchMoonrakerStatus(ctx context.Context) (*printerStatus, error) {
+	request := widget.request(ctx, "/printer/objects/query?webhooks&print_stats&virtual_sdcard&extruder&heater_bed")
+	response, err := decodeJsonFromRequest[moonrakerObjectsResponseJson](widget.client, request)
+	if err != nil {
+		var netErr *url.Error
+		if errors.As(err, &netErr) {
+			return &printerStatus{State: printerStateOffline}, nil
+		}
+
+		return nil, fmt.Errorf("%w: fetching printer status: %v", errNoContent, err)
+	}
+
+	objects := &response.Result.Status
+	status := &printerStatus{
+		Hotend: printerTemperature{Actual: objects.Extruder.Temperature, Target: objects.Extruder.Target},
+		Bed:    printerTemperature{Actual: objects.HeaterBed.Temperature, Target: objects.HeaterBed.Target},
+	}
+
+	switch objects.PrintStats.State {
+	case "printing":
+		status.State = printerStatePrinting
+	case "paused":
+		status.State = printerStatePaused
+	case "error":
+		status.State = printerStateError
+		status.Message = objects.PrintStats.Message
+	default:
+		status.State = printerStateReady
+	}
+
+	// klipper itself being in a bad state takes precedence over the print
+	switch objects.Webhooks.State {
+	case "shutdown", "error":
+		status.State = printerStateError
+		status.Message = objects.Webhooks.StateMessage
+	case "startup":
+		status.State = printerStateOffline
+	}
+
+	if status.IsActive() {
+		status.FileName = objects.PrintStats.Filename
+		status.Progress = int(objects.VirtualSDCard.Progress * 100)
+		status.Elapsed = time.Duration(objects.PrintStats.PrintDuration) * time.Second
+
+		// moonraker doesn't estimate the time left, so it's extrapolated
+		// from how long it's taken so far, same as the default in mainsail
+		if progress := objects.VirtualSDCard.Progress; progress > 0 {
+			total := objects.PrintStats.PrintDuration / progress
+			status.Remaining = time.Duration(total-objects.PrintStats.PrintDuration) * time.Second
+		}
+	}
+
+	if widget.WebcamURL == "" && !widget.HideWebcam {
+		widget.updateMoonrakerSnapshotURL(ctx)
+	}
+
+	return status, nil
+}
+
+func (widget *printerWidget) updateMoonrakerSnapshotURL(ctx context.Context) {
+	response, err := decodeJsonFromRequest[moonrakerWebcamsResponseJson](widget.client, widget.request(ctx, "/server/webcams/list"))
+	if err != nil {
+		return
+	}
+
+	snapshotURL := ""
+	for _, webcam := range response.Result.Webcams {
+		if (webcam.Enabled == nil || *webcam.Enabled) && webcam.SnapshotURL != "" {
+			snapshotURL = widget.resolveURL(webcam.SnapshotURL)
+			break
+		}
+	}
+
+	widget.mu.Lock()
+	widget.snapshotURL = snapshotURL
+	widget.mu.Unlock()
+}
+
+func (widget *printerWidget) handleRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	widget.mu.Lock()
+	snapshotURL := widget.snapshotURL
+	widget.mu.Unlock()
+
+	if r.PathValue("path") != "snapshot" || snapshotURL == "" || widget.HideWebcam {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	snapshot, err := widget.snapshots.get(r.Context(), snapshotURL, printerSnapshotCacheTime)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", snapshot.contentType)
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(printerSnapshotCacheTime.Seconds())))
+	w.Write(snapshot.data)
+}
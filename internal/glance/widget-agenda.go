@@ -0,0 +1,742 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var agendaWidgetTemplate = mustParseTemplate("agenda.html", "widget-base.html")
+
+const (
+	agendaMaxDays = 31
+	// the number of days, weeks, months or years a recurring event is expanded
+	// for, which prevents events that repeat every day since decades from taking long
+	agendaMaxRecurrencePeriods = 20000
+	agendaMaxCalendarSize      = 10 * 1024 * 1024
+)
+
+type agendaWidget struct {
+	widgetBase `yaml:",inline"`
+	Calendars  []agendaCalendarConfig `yaml:"calendars"`
+	Timezone   string                 `yaml:"timezone"`
+	Days       int                    `yaml:"days"`
+	HourFormat string                 `yaml:"hour-format"`
+	HideEmpty  bool                   `yaml:"hide-empty-days"`
+
+	AgendaDays []agendaDay `yaml:"-"`
+	location   *time.Location
+}
+
+type agendaCalendarConfig struct {
+	URL     string            `yaml:"url"`
+	Name    string            `yaml:"name"`
+	Color   *hslColorField    `yaml:"color"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+type agendaEvent struct {
+	Title        string
+	Location     string
+	Start        time.Time
+	End          time.Time
+	AllDay       bool
+	CalendarName string
+	Color        *hslColorField
+}
+
+type agendaDay struct {
+	Label  string
+	Date   time.Time
+	Events []agendaDayEvent
+}
+
+type agendaDayEvent struct {
+	*agendaEvent
+	TimeLabel string
+}
+
+func (widget *agendaWidget) initialize() error {
+	widget.withTitle("日程").withCacheDuration(time.Hour)
+
+	if len(widget.Calendars) == 0 {
+		return errors.New("no calendars specified")
+	}
+
+	for i := range widget.Calendars {
+		calendar := &widget.Calendars[i]
+		if calendar.URL == "" {
+			return fmt.Errorf("calendar #%d has no url", i+1)
+		}
+
+		// the scheme that calendar apps use for subscriptions
+		if rest, found := strings.CutPrefix(calendar.URL, "webcal://"); found {
+			calendar.URL = "https://" + rest
+		}
+	}
+
+	widget.location = time.Local
+	if widget.Timezone != "" {
+		location, err := time.LoadLocation(widget.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone '%s': %v", widget.Timezone, err)
+		}
+		widget.location = location
+	}
+
+	if widget.Days == 0 {
+		widget.Days = 7
+	} else if widget.Days < 0 || widget.Days > agendaMaxDays {
+		return fmt.Errorf("days must be between 1 and %d", agendaMaxDays)
+	}
+
+	if widget.HourFormat == "" {
+		widget.HourFormat = "24h"
+	} else if widget.HourFormat != "12h" && widget.HourFormat != "24h" {
+		return errors.New("hour-format must be either 12h or 24h")
+	}
+
+	return nil
+}
+
+func (widget *agendaWidget) update(ctx context.Context) {
+	now := time.Now().In(widget.location)
+	windowStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, widget.location)
+	windowEnd := windowStart.AddDate(0, 0, widget.Days)
+
+	events, err := fetchAgendaEvents(widget.httpClient(defaultHTTPClient), widget.Calendars, widget.location, windowStart, windowEnd)
+
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.AgendaDays = widget.groupEventsByDay(events, windowStart, now)
+}
+
+func (widget *agendaWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, agendaWidgetTemplate)
+}
+
+func (widget *agendaWidget) groupEventsByDay(events []agendaEvent, windowStart, now time.Time) []agendaDay {
+	days := make([]agendaDay, 0, widget.Days)
+
+	for i := 0; i < widget.Days; i++ {
+		dayStart := windowStart.AddDate(0, 0, i)
+		dayEnd := dayStart.AddDate(0, 0, 1)
+		day := agendaDay{Label: relativeDayLabel(now, i), Date: dayStart}
+
+		for j := range events {
+			event := &events[j]
+
+			overlaps := event.Start.Before(dayEnd) && event.End.After(dayStart)
+			instant := event.Start.Equal(event.End) && !event.Start.Before(dayStart) && event.Start.Before(dayEnd)
+			if !overlaps && !instant {
+				continue
+			}
+
+			// events of today which are already over aren't worth showing
+			if i == 0 && !event.AllDay && !event.End.After(now) && !instant {
+				continue
+			}
+
+			day.Events = append(day.Events, agendaDayEvent{
+				agendaEvent: event,
+				TimeLabel:   widget.eventTimeLabel(event, dayStart, dayEnd),
+			})
+		}
+
+		sort.SliceStable(day.Events, func(a, b int) bool {
+			ea, eb := day.Events[a], day.Events[b]
+			if ea.AllDay != eb.AllDay {
+				return ea.AllDay
+			}
+			return ea.Start.Before(eb.Start)
+		})
+
+		if len(day.Events) > 0 || !widget.HideEmpty {
+			days = append(days, day)
+		}
+	}
+
+	return days
+}
+
+func (widget *agendaWidget) formatTime(t time.Time) string {
+	if widget.HourFormat == "12h" {
+		return t.Format("3:04pm")
+	}
+
+	return t.Format("15:04")
+}
+
+func (widget *agendaWidget) eventTimeLabel(event *agendaEvent, dayStart, dayEnd time.Time) string {
+	startsBefore := event.Start.Before(dayStart)
+	endsAfter := event.End.After(dayEnd)
+
+	switch {
+	case event.AllDay, startsBefore && endsAfter:
+		return "全天"
+	case startsBefore:
+		return "至 " + widget.formatTime(event.End.In(widget.location))
+	case endsAfter:
+		return widget.formatTime(event.Start.In(widget.location)) + " 起"
+	case event.Start.Equal(event.End):
+		return widget.formatTime(event.Start.In(widget.location))
+	}
+
+	return widget.formatTime(event.Start.In(widget.location)) + " - " + widget.formatTime(event.End.In(widget.location))
+}
+
+func fetchAgendaEvents(client requestDoer, calendars []agendaCalendarConfig, location *time.Location, windowStart, windowEnd time.Time) ([]agendaEvent, error) {
+	task := func(calendar agendaCalendarConfig) ([]agendaEvent, error) {
+		data, err := fetchICalendarData(client, calendar)
+		if err != nil {
+			return nil, err
+		}
+
+		events := expandICalendarEvents(parseVEVENTs(data), location, windowStart, windowEnd)
+		for i := range events {
+			events[i].CalendarName = calendar.Name
+			events[i].Color = calendar.Color
+		}
+
+		return events, nil
+	}
+
+	job := newJob(task, calendars).withWorkers(10)
+	results, errs, err := workerPoolDo(job)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNoContent, err)
+	}
+
+	events := make([]agendaEvent, 0)
+	failed := 0
+
+	for i := range results {
+		if errs[i] != nil {
+			failed++
+			slog.Error("Failed to fetch calendar", "url", calendars[i].URL, "error", errs[i])
+			continue
+		}
+
+		events = append(events, results[i]...)
+	}
+
+	if failed == len(calendars) {
+		return nil, fmt.Errorf("%w: could not fetch any of the calendars", errNoContent)
+	}
+
+	if failed > 0 {
+		return events, fmt.Errorf("%w: could not fetch %d calendars", errPartialContent, failed)
+	}
+
+	return events, nil
+}
+
+func fetchICalendarData(client requestDoer, calendar agendaCalendarConfig) (string, error) {
+	request, err := http.NewRequest("GET", calendar.URL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	request.Header.Set("User-Agent", glanceUserAgentString)
+	for key, value := range calendar.Headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, agendaMaxCalendarSize))
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.Contains(string(body[:min(len(body), 1024)]), "BEGIN:VCALENDAR") {
+		return "", errors.New("response is not an iCalendar file")
+	}
+
+	return string(body), nil
+}
+
+// Properties such as EXDATE can be repeated, so every value is kept
+type vevent map[string][]icalendarProperty
+
+func (e vevent) get(name string) icalendarProperty {
+	if values := e[name]; len(values) > 0 {
+		return values[0]
+	}
+
+	return icalendarProperty{}
+}
+
+func parseVEVENTs(data string) []vevent {
+	events := make([]vevent, 0)
+	var current vevent
+	depth := 0
+
+	for _, line := range unfoldICalendarLines(data) {
+		name, params, value := splitICalendarLine(line)
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT") && current == nil:
+			current = make(vevent)
+		case current == nil:
+			continue
+		case name == "BEGIN":
+			depth++
+		case name == "END" && depth > 0:
+			depth--
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			events = append(events, current)
+			current = nil
+		case depth == 0:
+			current[name] = append(current[name], icalendarProperty{params: params, value: value})
+		}
+	}
+
+	return events
+}
+
+func icalendarParam(params, name string) string {
+	for _, param := range strings.Split(params, ";") {
+		key, value, _ := strings.Cut(param, "=")
+		if strings.EqualFold(key, name) {
+			return strings.Trim(value, `"`)
+		}
+	}
+
+	return ""
+}
+
+// Times without a timezone are floating and happen at the same wall clock
+// time wherever you are, as are dates
+func parseICalendarTime(params, value string, fallback *time.Location) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+
+	if len(value) == 8 || strings.EqualFold(icalendarParam(params, "VALUE"), "DATE") {
+		t, err := time.ParseInLocation("20060102", value[:min(len(value), 8)], fallback)
+		return t, true, err
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+
+	location := fallback
+	if tzid := icalendarParam(params, "TZID"); tzid != "" {
+		// some clients prefix the IANA name, such as /mozilla.org/20050126_1/Europe/Paris
+		parts := strings.Split(strings.TrimPrefix(tzid, "/"), "/")
+		candidates := []string{strings.Join(parts, "/")}
+		if len(parts) > 2 {
+			candidates = append(candidates, strings.Join(parts[len(parts)-2:], "/"))
+		}
+
+		for _, candidate := range candidates {
+			if loaded, err := time.LoadLocation(candidate); err == nil {
+				location = loaded
+				break
+			}
+		}
+	}
+
+	t, err := time.ParseInLocation("20060102T150405", value, location)
+	return t, false, err
+}
+
+// Durations look like P1D, PT1H30M or P2W
+func parseICalendarDuration(value string) (time.Duration, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "+")
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(value, "-")
+
+	if !strings.HasPrefix(value, "P") {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	var total time.Duration
+	number := ""
+	inTime := false
+
+	for _, r := range value[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			number += string(r)
+			continue
+		case r == 'T':
+			inTime = true
+			continue
+		}
+
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		number = ""
+
+		switch {
+		case r == 'W':
+			total += time.Duration(n) * 7 * 24 * time.Hour
+		case r == 'D':
+			total += time.Duration(n) * 24 * time.Hour
+		case r == 'H' && inTime:
+			total += time.Duration(n) * time.Hour
+		case r == 'M' && inTime:
+			total += time.Duration(n) * time.Minute
+		case r == 'S' && inTime:
+			total += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+	}
+
+	return ternary(negative, -total, total), nil
+}
+
+type recurrenceWeekday struct {
+	// the nth occurrence of the weekday within the month or year, 0 for all
+	// of them and negative to count from the end
+	n   int
+	day time.Weekday
+}
+
+type recurrenceRule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	byDay      []recurrenceWeekday
+	byMonthDay []int
+	byMonth    []time.Month
+	weekStart  time.Weekday
+}
+
+var icalendarWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func parseRecurrenceRule(value string, location *time.Location) (*recurrenceRule, error) {
+	rule := &recurrenceRule{interval: 1, weekStart: time.Monday}
+
+	for _, part := range strings.Split(value, ";") {
+		key, value, _ := strings.Cut(part, "=")
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.freq = strings.ToUpper(value)
+		case "INTERVAL":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				rule.interval = n
+			}
+		case "COUNT":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				rule.count = n
+			}
+		case "UNTIL":
+			until, allDay, err := parseICalendarTime("", value, location)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UNTIL: %v", err)
+			}
+			// the whole day is included when only a date is given
+			rule.until = ternary(allDay, until.AddDate(0, 0, 1).Add(-time.Second), until)
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				day = strings.ToUpper(strings.TrimSpace(day))
+				if len(day) < 2 {
+					continue
+				}
+
+				weekday, ok := icalendarWeekdays[day[len(day)-2:]]
+				if !ok {
+					return nil, fmt.Errorf("invalid BYDAY %q", day)
+				}
+
+				n := 0
+				if len(day) > 2 {
+					var err error
+					if n, err = strconv.Atoi(strings.TrimPrefix(day[:len(day)-2], "+")); err != nil {
+						return nil, fmt.Errorf("invalid BYDAY %q", day)
+					}
+				}
+
+				rule.byDay = append(rule.byDay, recurrenceWeekday{n: n, day: weekday})
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				if n, err := strconv.Atoi(day); err == nil && n != 0 {
+					rule.byMonthDay = append(rule.byMonthDay, n)
+				}
+			}
+		case "BYMONTH":
+			for _, month := range strings.Split(value, ",") {
+				if n, err := strconv.Atoi(month); err == nil && n >= 1 && n <= 12 {
+					rule.byMonth = append(rule.byMonth, time.Month(n))
+				}
+			}
+		case "WKST":
+			if weekday, ok := icalendarWeekdays[strings.ToUpper(value)]; ok {
+				rule.weekStart = weekday
+			}
+		}
+	}
+
+	switch rule.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return nil, fmt.Errorf("unsupported FREQ %q", rule.freq)
+	}
+
+	return rule, nil
+}
+
+// The days of a month which match the BYDAY and BYMONTHDAY parts of a rule
+func (r *recurrenceRule) daysOfMonth(year int, month time.Month, defaultDay int) []int {
+	total := daysInMonth(month, year)
+	days := make([]int, 0, 5)
+
+	if len(r.byMonthDay) > 0 {
+		for _, day := range r.byMonthDay {
+			if day < 0 {
+				day = total + day + 1
+			}
+			if day >= 1 && day <= total {
+				days = append(days, day)
+			}
+		}
+	}
+
+	if len(r.byDay) > 0 {
+		firstWeekday := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC).Weekday()
+		matching := make([]int, 0, 5)
+
+		for _, byDay := range r.byDay {
+			first := 1 + (int(byDay.day)-int(firstWeekday)+7)%7
+			occurrences := make([]int, 0, 5)
+			for day := first; day <= total; day += 7 {
+				occurrences = append(occurrences, day)
+			}
+
+			switch {
+			case byDay.n == 0:
+				matching = append(matching, occurrences...)
+			case byDay.n > 0 && byDay.n <= len(occurrences):
+				matching = append(matching, occurrences[byDay.n-1])
+			case byDay.n < 0 && -byDay.n <= len(occurrences):
+				matching = append(matching, occurrences[len(occurrences)+byDay.n])
+			}
+		}
+
+		if len(r.byMonthDay) > 0 {
+			days = slices.DeleteFunc(days, func(day int) bool { return !slices.Contains(matching, day) })
+		} else {
+			days = matching
+		}
+	}
+
+	if len(r.byMonthDay) == 0 && len(r.byDay) == 0 && defaultDay <= total {
+		days = append(days, defaultDay)
+	}
+
+	slices.Sort(days)
+	return slices.Compact(days)
+}
+
+// The candidate occurrences of the period which is the given number of
+// intervals after the one of the start
+func (r *recurrenceRule) periodOccurrences(start time.Time, period int) []time.Time {
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	}
+
+	occurrences := make([]time.Time, 0, 4)
+	step := period * r.interval
+
+	switch r.freq {
+	case "DAILY":
+		day := start.AddDate(0, 0, step)
+		if len(r.byDay) > 0 && !slices.ContainsFunc(r.byDay, func(d recurrenceWeekday) bool { return d.day == day.Weekday() }) {
+			break
+		}
+		if len(r.byMonth) > 0 && !slices.Contains(r.byMonth, day.Month()) {
+			break
+		}
+		occurrences = append(occurrences, day)
+	case "WEEKLY":
+		weekStart := start.AddDate(0, 0, -((int(start.Weekday())-int(r.weekStart)+7)%7)+7*step)
+		weekdays := []time.Weekday{start.Weekday()}
+		if len(r.byDay) > 0 {
+			weekdays = weekdays[:0]
+			for _, byDay := range r.byDay {
+				weekdays = append(weekdays, byDay.day)
+			}
+		}
+
+		for _, weekday := range weekdays {
+			day := weekStart.AddDate(0, 0, (int(weekday)-int(r.weekStart)+7)%7)
+			if len(r.byMonth) == 0 || slices.Contains(r.byMonth, day.Month()) {
+				occurrences = append(occurrences, day)
+			}
+		}
+	case "MONTHLY":
+		first := time.Date(start.Year(), start.Month()+time.Month(step), 1, 0, 0, 0, 0, time.UTC)
+		if len(r.byMonth) > 0 && !slices.Contains(r.byMonth, first.Month()) {
+			break
+		}
+		for _, day := range r.daysOfMonth(first.Year(), first.Month(), start.Day()) {
+			occurrences = append(occurrences, at(first.Year(), first.Month(), day))
+		}
+	case "YEARLY":
+		year := start.Year() + step
+		months := r.byMonth
+		if len(months) == 0 {
+			months = []time.Month{start.Month()}
+		}
+
+		for _, month := range months {
+			for _, day := range r.daysOfMonth(year, month, start.Day()) {
+				occurrences = append(occurrences, at(year, month, day))
+			}
+		}
+	}
+
+	sort.Slice(occurrences, func(i, j int) bool { return occurrences[i].Before(occurrences[j]) })
+	return occurrences
+}
+
+// Calls the function with every occurrence that starts before the end, in order
+func (r *recurrenceRule) occurrences(start, end time.Time, yield func(time.Time)) {
+	count := 0
+
+	for period := 0; period < agendaMaxRecurrencePeriods; period++ {
+		for _, occurrence := range r.periodOccurrences(start, period) {
+			if occurrence.Before(start) {
+				continue
+			}
+
+			if (r.count > 0 && count >= r.count) || (!r.until.IsZero() && occurrence.After(r.until)) || !occurrence.Before(end) {
+				return
+			}
+
+			count++
+			yield(occurrence)
+		}
+	}
+}
+
+func expandICalendarEvents(vevents []vevent, location *time.Location, windowStart, windowEnd time.Time) []agendaEvent {
+	type occurrenceKey struct {
+		uid   string
+		start int64
+	}
+
+	// modified occurrences of recurring events are separate events which have
+	// the same UID and the start of the occurrence they replace
+	overridden := make(map[occurrenceKey]bool)
+	for _, e := range vevents {
+		if id := e.get("RECURRENCE-ID"); id.value != "" {
+			if t, _, err := parseICalendarTime(id.params, id.value, location); err == nil {
+				overridden[occurrenceKey{e.get("UID").value, t.Unix()}] = true
+			}
+		}
+	}
+
+	events := make([]agendaEvent, 0)
+
+	for _, e := range vevents {
+		if strings.EqualFold(e.get("STATUS").value, "CANCELLED") {
+			continue
+		}
+
+		dtstart := e.get("DTSTART")
+		start, allDay, err := parseICalendarTime(dtstart.params, dtstart.value, location)
+		if err != nil {
+			continue
+		}
+
+		var duration time.Duration
+		if dtend := e.get("DTEND"); dtend.value != "" {
+			if end, _, err := parseICalendarTime(dtend.params, dtend.value, location); err == nil {
+				duration = end.Sub(start)
+			}
+		} else if value := e.get("DURATION").value; value != "" {
+			duration, _ = parseICalendarDuration(value)
+		} else if allDay {
+			duration = 24 * time.Hour
+		}
+
+		duration = max(0, duration)
+
+		event := agendaEvent{
+			Title:    unescapeICalendarText(e.get("SUMMARY").value),
+			Location: unescapeICalendarText(e.get("LOCATION").value),
+			AllDay:   allDay,
+		}
+
+		add := func(occurrenceStart time.Time) {
+			occurrenceEnd := occurrenceStart.Add(duration)
+			if allDay {
+				// keeps all day events aligned to days across daylight saving changes
+				occurrenceEnd = occurrenceStart.AddDate(0, 0, int((duration+time.Hour)/(24*time.Hour)))
+			}
+
+			if occurrenceEnd.After(windowStart) || (duration == 0 && !occurrenceStart.Before(windowStart)) {
+				if occurrenceStart.Before(windowEnd) {
+					event.Start, event.End = occurrenceStart, occurrenceEnd
+					events = append(events, event)
+				}
+			}
+		}
+
+		rrule := e.get("RRULE").value
+		if rrule == "" || e.get("RECURRENCE-ID").value != "" {
+			add(start)
+			continue
+		}
+
+		rule, err := parseRecurrenceRule(rrule, location)
+		if err != nil {
+			slog.Warn("Skipping recurring calendar event", "summary", event.Title, "error", err)
+			add(start)
+			continue
+		}
+
+		excluded := make(map[int64]bool)
+		for _, exdate := range e["EXDATE"] {
+			for _, value := range strings.Split(exdate.value, ",") {
+				if t, _, err := parseICalendarTime(exdate.params, value, start.Location()); err == nil {
+					excluded[t.Unix()] = true
+				}
+			}
+		}
+
+		uid := e.get("UID").value
+		// occurrences can't start after the window ends for them to be shown,
+		// but ones that started before it can still be going on
+		rule.occurrences(start, windowEnd, func(occurrence time.Time) {
+			if excluded[occurrence.Unix()] || overridden[occurrenceKey{uid, occurrence.Unix()}] {
+				return
+			}
+			add(occurrence)
+		})
+	}
+
+	return events
+}
@@ -0,0 +1,183 @@
+package glance
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecurrenceRuleOccurrences(t *testing.T) {
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 9, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		rule     string
+		start    time.Time
+		end      time.Time
+		expected []time.Time
+	}{
+		{
+			name:     "count",
+			rule:     "FREQ=DAILY;COUNT=3",
+			start:    at(2026, 10, 15),
+			end:      at(2027, 1, 1),
+			expected: []time.Time{at(2026, 10, 15), at(2026, 10, 16), at(2026, 10, 17)},
+		},
+		{
+			name:     "interval",
+			rule:     "FREQ=DAILY;INTERVAL=2;COUNT=3",
+			start:    at(2026, 10, 15),
+			end:      at(2027, 1, 1),
+			expected: []time.Time{at(2026, 10, 15), at(2026, 10, 17), at(2026, 10, 19)},
+		},
+		{
+			name:     "end of the range",
+			rule:     "FREQ=DAILY",
+			start:    at(2026, 10, 15),
+			end:      at(2026, 10, 18),
+			expected: []time.Time{at(2026, 10, 15), at(2026, 10, 16), at(2026, 10, 17)},
+		},
+		{
+			name:     "until as a date includes the whole day",
+			rule:     "FREQ=WEEKLY;UNTIL=20261029",
+			start:    at(2026, 10, 15),
+			end:      at(2027, 1, 1),
+			expected: []time.Time{at(2026, 10, 15), at(2026, 10, 22), at(2026, 10, 29)},
+		},
+		{
+			name:     "until as a time",
+			rule:     "FREQ=WEEKLY;UNTIL=20261029T085959Z",
+			start:    at(2026, 10, 15),
+			end:      at(2027, 1, 1),
+			expected: []time.Time{at(2026, 10, 15), at(2026, 10, 22)},
+		},
+		{
+			name:     "weekly by day skips days before the start",
+			rule:     "FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=4",
+			start:    at(2026, 10, 15),
+			end:      at(2027, 1, 1),
+			expected: []time.Time{at(2026, 10, 16), at(2026, 10, 19), at(2026, 10, 21), at(2026, 10, 23)},
+		},
+		{
+			name:     "monthly on the last friday",
+			rule:     "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3",
+			start:    at(2026, 10, 30),
+			end:      at(2027, 6, 1),
+			expected: []time.Time{at(2026, 10, 30), at(2026, 11, 27), at(2026, 12, 25)},
+		},
+		{
+			name:     "monthly on the second tuesday",
+			rule:     "FREQ=MONTHLY;BYDAY=2TU;COUNT=2",
+			start:    at(2026, 10, 13),
+			end:      at(2027, 6, 1),
+			expected: []time.Time{at(2026, 10, 13), at(2026, 11, 10)},
+		},
+		{
+			name:     "monthly skips months without the day",
+			rule:     "FREQ=MONTHLY;COUNT=3",
+			start:    at(2026, 1, 31),
+			end:      at(2027, 1, 1),
+			expected: []time.Time{at(2026, 1, 31), at(2026, 3, 31), at(2026, 5, 31)},
+		},
+		{
+			name:     "yearly by month",
+			rule:     "FREQ=YEARLY;BYMONTH=1,7;BYMONTHDAY=1;COUNT=3",
+			start:    at(2026, 1, 1),
+			end:      at(2030, 1, 1),
+			expected: []time.Time{at(2026, 1, 1), at(2026, 7, 1), at(2027, 1, 1)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule, err := parseRecurrenceRule(test.rule, time.UTC)
+			if err != nil {
+				t.Fatalf("parsing %q: %v", test.rule, err)
+			}
+
+			got := make([]time.Time, 0)
+			rule.occurrences(test.start, test.end, func(occurrence time.Time) {
+				got = append(got, occurrence)
+			})
+
+			if !slices.EqualFunc(got, test.expected, time.Time.Equal) {
+				t.Errorf("expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseRecurrenceRuleErrors(t *testing.T) {
+	invalid := []string{
+		"FREQ=HOURLY",
+		"COUNT=3",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=MONTHLY;BYDAY=AFR",
+		"FREQ=DAILY;UNTIL=tomorrow",
+	}
+
+	for _, rule := range invalid {
+		if _, err := parseRecurrenceRule(rule, time.UTC); err == nil {
+			t.Errorf("expected %q to be invalid", rule)
+		}
+	}
+}
+
+func TestExpandICalendarEventsExclusions(t *testing.T) {
+	calendar := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"SUMMARY:Standup",
+		"DTSTART;TZID=Europe/Berlin:20261019T093000",
+		"DURATION:PT15M",
+		"RRULE:FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR;COUNT=5",
+		"EXDATE;TZID=Europe/Berlin:20261020T093000,20261021T093000",
+		"EXDATE:20261022T073000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"SUMMARY:Late standup",
+		"RECURRENCE-ID;TZID=Europe/Berlin:20261023T093000",
+		"DTSTART;TZID=Europe/Berlin:20261023T110000",
+		"DURATION:PT15M",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:cancelled",
+		"SUMMARY:Cancelled",
+		"STATUS:CANCELLED",
+		"DTSTART:20261020T100000Z",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	events := expandICalendarEvents(
+		parseVEVENTs(calendar),
+		time.UTC,
+		time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 26, 0, 0, 0, 0, time.UTC),
+	)
+
+	// 09:30 in Berlin is 07:30 UTC during summer time
+	expected := map[string]time.Time{
+		"Standup":      time.Date(2026, 10, 19, 7, 30, 0, 0, time.UTC),
+		"Late standup": time.Date(2026, 10, 23, 9, 0, 0, 0, time.UTC),
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %v", len(expected), len(events), events)
+	}
+
+	for _, event := range events {
+		start, ok := expected[event.Title]
+		if !ok || !event.Start.Equal(start) {
+			t.Errorf("unexpected event %q starting at %v", event.Title, event.Start)
+		}
+		if event.End.Sub(event.Start) != 15*time.Minute {
+			t.Errorf("expected %q to last 15 minutes, got %v", event.Title, event.End.Sub(event.Start))
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var bilibiliDynamicsWidgetTemplate = mustParseTemplate("bilibili-dynamics.html", "widget-base.html")
+
+const bilibiliDynamicsMaxImages = 9
+
+type bilibiliDynamicsWidget struct {
+	widgetBase    `yaml:",inline"`
+	UIDs          []string          `yaml:"uids"`
+	Following     bool              `yaml:"following"`
+	Limit         int               `yaml:"limit"`
+	CollapseAfter int               `yaml:"collapse-after"`
+	Proxy         proxyOptionsField `yaml:"proxy"`
+	Headers       map[string]string `yaml:"headers"`
+	Cookies       map[string]string `yaml:"cookies"`
+
+	Dynamics []bilibiliDynamic `yaml:"-"`
+}
+
+type bilibiliDynamic struct {
+	ID           string
+	Url          string
+	AuthorName   string
+	AuthorUrl    string
+	AuthorAvatar string
+	// e.g. 投稿了视频, provided by bilibili
+	Action      string
+	Text        string
+	Images      []string
+	Video       *bilibiliDynamicVideo
+	PublishedAt time.Time
+	Likes       int
+	Comments    int
+	Forwards    int
+	// The dynamic which got reposted, only set for reposts
+	Original *bilibiliDynamic
+}
+
+type bilibiliDynamicVideo struct {
+	Title    string
+	Url      string
+	CoverUrl string
+	Duration string
+}
+
+type bilibiliDynamicItemJson struct {
+	IDStr   string `json:"id_str"`
+	Modules struct {
+		Author struct {
+			Mid       int64  `json:"mid"`
+			Name      string `json:"name"`
+			Face      string `json:"face"`
+			PubTs     int64  `json:"pub_ts"`
+			PubAction string `json:"pub_action"`
+		} `json:"module_author"`
+		Dynamic struct {
+			Desc *struct {
+				Text string `json:"text"`
+			} `json:"desc"`
+			Major *struct {
+				Archive *struct {
+					Title        string `json:"title"`
+					Cover        string `json:"cover"`
+					Bvid         string `json:"bvid"`
+					DurationText string `json:"duration_text"`
+				} `json:"archive"`
+				Draw *struct {
+					Items []struct {
+						Src string `json:"src"`
+					} `json:"items"`
+				} `json:"draw"`
+				Opus *struct {
+					Title   string `json:"title"`
+					Summary struct {
+						Text string `json:"text"`
+					} `json:"summary"`
+					Pics []struct {
+						URL string `json:"url"`
+					} `json:"pics"`
+				} `json:"opus"`
+				Article *struct {
+					Title  string   `json:"title"`
+					Desc   string   `json:"desc"`
+					Covers []string `json:"covers"`
+				} `json:"article"`
+			} `json:"major"`
+		} `json:"module_dynamic"`
+		Stat *struct {
+			Comment struct {
+				Count int `json:"count"`
+			} `json:"comment"`
+			Forward struct {
+				Count int `json:"count"`
+			} `json:"forward"`
+			Like struct {
+				Count int `json:"count"`
+			} `json:"like"`
+		} `json:"module_stat"`
+	} `json:"modules"`
+	Orig *bilibiliDynamicItemJson `json:"orig"`
+}
+
+type bilibiliDynamicFeedResponseJson struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Items []bilibiliDynamicItemJson `json:"items"`
+	} `json:"data"`
+}
+
+func (widget *bilibiliDynamicsWidget) initialize() error {
+	widget.withTitle("动态").withCacheDuration(10 * time.Minute)
+
+	if len(widget.UIDs) == 0 && !widget.Following {
+		return errors.New("either uids or following must be set")
+	}
+
+	for _, uid := range widget.UIDs {
+		if _, err := strconv.ParseUint(uid, 10, 64); err != nil {
+			return fmt.Errorf("invalid bilibili UID %q, expected a number", uid)
+		}
+	}
+
+	if widget.Following {
+		if len(widget.Cookies) == 0 {
+			return errors.New("following requires the SESSDATA cookie of your account to be set through cookies")
+		}
+
+		widget.withTitleURL("https://t.bilibili.com/")
+	} else if len(widget.UIDs) == 1 {
+		widget.withTitleURL("https://space.bilibili.com/" + widget.UIDs[0] + "/dynamic")
+	}
+
+	if widget.Limit <= 0 {
+		widget.Limit = 15
+	}
+
+	if widget.CollapseAfter == 0 || widget.CollapseAfter < -1 {
+		widget.CollapseAfter = 5
+	}
+
+	return nil
+}
+
+func (widget *bilibiliDynamicsWidget) update(ctx context.Context) {
+	client := widget.httpClient(ternary(widget.Proxy.client != nil, widget.Proxy.client, defaultHTTPClient))
+	dynamics, err := fetchBilibiliDynamics(withRequestHeaders(client, widget.Headers, widget.Cookies), widget.UIDs, widget.Following)
+
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	if len(dynamics) > widget.Limit {
+		dynamics = dynamics[:widget.Limit]
+	}
+
+	widget.Dynamics = dynamics
+}
+
+func (widget *bilibiliDynamicsWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, bilibiliDynamicsWidgetTemplate)
+}
+
+func fetchBilibiliDynamics(client requestDoer, uids []string, following bool) ([]bilibiliDynamic, error) {
+	const feedURL = "https://api.bilibili.com/x/polymer/web-dynamic/v1/feed/"
+
+	requests := make([]*http.Request, 0, len(uids)+1)
+	if following {
+		requests = append(requests, newBilibiliRequest(feedURL+"all?type=all"))
+	}
+
+	for _, uid := range uids {
+		requests = append(requests, newBilibiliRequest(feedURL+"space?host_mid="+uid))
+	}
+
+	job := newJob(decodeJsonFromRequestTask[bilibiliDynamicFeedResponseJson](client), requests).withWorkers(10)
+	responses, errs, err := workerPoolDo(job)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNoContent, err)
+	}
+
+	dynamics := make([]bilibiliDynamic, 0, len(requests)*12)
+	seen := make(map[string]bool)
+	var failed int
+	var lastErr error
+
+	for i := range responses {
+		if errs[i] == nil && responses[i].Code != 0 {
+			errs[i] = fmt.Errorf("bilibili returned code %d: %s", responses[i].Code, responses[i].Message)
+		}
+
+		if errs[i] != nil {
+			failed++
+			lastErr = errs[i]
+			slog.Error("Failed to fetch bilibili dynamics", "url", requests[i].URL.String(), "error", errs[i])
+			continue
+		}
+
+		for j := range responses[i].Data.Items {
+			item := &responses[i].Data.Items[j]
+
+			// the feed of followed users and the feed of a user can have the same dynamic
+			if seen[item.IDStr] {
+				continue
+			}
+			seen[item.IDStr] = true
+
+			if dynamic, ok := item.toDynamic(); ok {
+				dynamics = append(dynamics, dynamic)
+			}
+		}
+	}
+
+	if failed == len(requests) {
+		return nil, fmt.Errorf("%w: %v", errNoContent, lastErr)
+	}
+
+	sort.SliceStable(dynamics, func(i, j int) bool {
+		return dynamics[i].PublishedAt.After(dynamics[j].PublishedAt)
+	})
+
+	if failed > 0 {
+		return dynamics, fmt.Errorf("%w: could not fetch %d feeds", errPartialContent, failed)
+	}
+
+	return dynamics, nil
+}
+
+// Returns false for dynamics which can't be shown, such as ones which were deleted
+func (item *bilibiliDynamicItemJson) toDynamic() (bilibiliDynamic, bool) {
+	author := &item.Modules.Author
+	if item.IDStr == "" || author.Mid == 0 {
+		return bilibiliDynamic{}, false
+	}
+
+	dynamic := bilibiliDynamic{
+		ID:           item.IDStr,
+		Url:          "https://t.bilibili.com/" + item.IDStr,
+		AuthorName:   author.Name,
+		AuthorUrl:    "https://space.bilibili.com/" + strconv.FormatInt(author.Mid, 10),
+		AuthorAvatar: globalImageCache.GetCachedImageURL(author.Face),
+		Action:       author.PubAction,
+		PublishedAt:  time.Unix(author.PubTs, 0),
+	}
+
+	content := &item.Modules.Dynamic
+	if content.Desc != nil {
+		dynamic.Text = content.Desc.Text
+	}
+
+	if major := content.Major; major != nil {
+		switch {
+		case major.Archive != nil:
+			archive := major.Archive
+			dynamic.Video = &bilibiliDynamicVideo{
+				Title:    archive.Title,
+				Url:      "https://www.bilibili.com/video/" + archive.Bvid,
+				CoverUrl: globalImageCache.GetCachedImageURL(archive.Cover),
+				Duration: archive.DurationText,
+			}
+		case major.Draw != nil:
+			for _, image := range major.Draw.Items {
+				dynamic.Images = append(dynamic.Images, image.Src)
+			}
+		case major.Opus != nil:
+			if dynamic.Text == "" {
+				dynamic.Text = strings.TrimSpace(major.Opus.Title + "\n" + major.Opus.Summary.Text)
+			}
+
+			for _, image := range major.Opus.Pics {
+				dynamic.Images = append(dynamic.Images, image.URL)
+			}
+		case major.Article != nil:
+			dynamic.Text = strings.TrimSpace(major.Article.Title + "\n" + major.Article.Desc)
+			dynamic.Images = major.Article.Covers
+		}
+	}
+
+	if len(dynamic.Images) > bilibiliDynamicsMaxImages {
+		dynamic.Images = dynamic.Images[:bilibiliDynamicsMaxImages]
+	}
+
+	for i := range dynamic.Images {
+		dynamic.Images[i] = globalImageCache.GetCachedImageURL(dynamic.Images[i])
+	}
+
+	if stat := item.Modules.Stat; stat != nil {
+		dynamic.Likes = stat.Like.Count
+		dynamic.Comments = stat.Comment.Count
+		dynamic.Forwards = stat.Forward.Count
+	}
+
+	if item.Orig != nil {
+		if original, ok := item.Orig.toDynamic(); ok {
+			dynamic.Original = &original
+		} else {
+			// the original got deleted, which is still worth saying rather than
+			// showing the repost as if it was a text post
+			dynamic.Original = &bilibiliDynamic{Text: "源动态已被作者删除"}
+		}
+	}
+
+	return dynamic, true
+}
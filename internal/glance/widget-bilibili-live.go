@@ -0,0 +1,172 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var bilibiliLiveWidgetTemplate = mustParseTemplate("bilibili-live.html", "widget-base.html")
+
+type bilibiliLiveWidget struct {
+	widgetBase    `yaml:",inline"`
+	UIDs          []string           `yaml:"uids"`
+	Rooms         []bilibiliLiveRoom `yaml:"-"`
+	CollapseAfter int                `yaml:"collapse-after"`
+	SortBy        string             `yaml:"sort-by"`
+	HideOffline   bool               `yaml:"hide-offline"`
+}
+
+type bilibiliLiveRoom struct {
+	UID          string
+	Exists       bool
+	Name         string
+	AvatarUrl    string
+	RoomUrl      string
+	Title        string
+	CoverUrl     string
+	Area         string
+	IsLive       bool
+	LiveSince    time.Time
+	ViewersCount int
+}
+
+type bilibiliLiveStatusResponseJson struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    map[string]struct {
+		Title      string `json:"title"`
+		RoomID     int    `json:"room_id"`
+		Online     int    `json:"online"`
+		LiveTime   int64  `json:"live_time"`
+		LiveStatus int    `json:"live_status"`
+		Uname      string `json:"uname"`
+		Face       string `json:"face"`
+		Cover      string `json:"cover_from_user"`
+		Keyframe   string `json:"keyframe"`
+		AreaName   string `json:"area_v2_name"`
+	} `json:"data"`
+}
+
+func (widget *bilibiliLiveWidget) initialize() error {
+	widget.
+		withTitle("直播").
+		withTitleURL("https://live.bilibili.com/").
+		withCacheDuration(2 * time.Minute)
+
+	if len(widget.UIDs) == 0 {
+		return errors.New("no uids specified")
+	}
+
+	for _, uid := range widget.UIDs {
+		if _, err := strconv.ParseUint(uid, 10, 64); err != nil {
+			return fmt.Errorf("invalid bilibili UID %q, expected a number", uid)
+		}
+	}
+
+	if widget.CollapseAfter == 0 || widget.CollapseAfter < -1 {
+		widget.CollapseAfter = 5
+	}
+
+	if widget.SortBy != "viewers" && widget.SortBy != "live" {
+		widget.SortBy = "viewers"
+	}
+
+	return nil
+}
+
+func (widget *bilibiliLiveWidget) update(ctx context.Context) {
+	rooms, err := fetchBilibiliLiveRooms(widget.httpClient(defaultHTTPClient), widget.UIDs)
+
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	if widget.HideOffline {
+		live := rooms[:0]
+		for i := range rooms {
+			if rooms[i].IsLive {
+				live = append(live, rooms[i])
+			}
+		}
+		rooms = live
+	}
+
+	if widget.SortBy == "viewers" {
+		sort.SliceStable(rooms, func(i, j int) bool {
+			return rooms[i].ViewersCount > rooms[j].ViewersCount
+		})
+	} else {
+		sort.SliceStable(rooms, func(i, j int) bool {
+			return rooms[i].IsLive && !rooms[j].IsLive
+		})
+	}
+
+	widget.Rooms = rooms
+}
+
+func (widget *bilibiliLiveWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, bilibiliLiveWidgetTemplate)
+}
+
+// The status of every room can be fetched with a single request, users who
+// have never opened a live room are left out of the response
+func fetchBilibiliLiveRooms(client requestDoer, uids []string) ([]bilibiliLiveRoom, error) {
+	query := url.Values{}
+	for _, uid := range uids {
+		query.Add("uids[]", uid)
+	}
+
+	request := newBilibiliRequest("https://api.live.bilibili.com/room/v1/Room/get_status_info_by_uids?" + query.Encode())
+	response, err := decodeJsonFromRequest[bilibiliLiveStatusResponseJson](client, request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNoContent, err)
+	}
+
+	if response.Code != 0 {
+		return nil, fmt.Errorf("%w: bilibili returned code %d: %s", errNoContent, response.Code, response.Message)
+	}
+
+	rooms := make([]bilibiliLiveRoom, 0, len(uids))
+
+	for _, uid := range uids {
+		status, exists := response.Data[uid]
+		if !exists {
+			rooms = append(rooms, bilibiliLiveRoom{UID: uid, Name: uid, ViewersCount: -1})
+			continue
+		}
+
+		room := bilibiliLiveRoom{
+			UID:       uid,
+			Exists:    true,
+			Name:      status.Uname,
+			AvatarUrl: globalImageCache.GetCachedImageURL(status.Face),
+			RoomUrl:   "https://live.bilibili.com/" + strconv.Itoa(status.RoomID),
+			Title:     status.Title,
+			Area:      status.AreaName,
+			// 2 is for rooms which are looping previous videos while offline
+			IsLive: status.LiveStatus == 1,
+		}
+
+		if room.IsLive {
+			room.ViewersCount = status.Online
+			room.CoverUrl = globalImageCache.GetCachedImageURL(ternary(status.Cover != "", status.Cover, status.Keyframe))
+
+			if status.LiveTime > 0 {
+				room.LiveSince = time.Unix(status.LiveTime, 0)
+			}
+		} else {
+			// keeps live rooms with no viewers above offline ones
+			room.ViewersCount = -1
+		}
+
+		rooms = append(rooms, room)
+	}
+
+	return rooms, nil
+}
@@ -1,14 +1,27 @@
 package glance
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"html/template"
+	"net/url"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 var bookmarksWidgetTemplate = mustParseTemplate("bookmarks.html", "widget-base.html")
 
+// The value of icon which uses the favicon of the site
+const bookmarksFaviconIcon = "favicon"
+
 type bookmarksWidget struct {
 	widgetBase `yaml:",inline"`
 	cachedHTML template.HTML `yaml:"-"`
+	Style      string        `yaml:"style"`
+	Favicons   bool          `yaml:"favicons"`
 	Groups     []struct {
 		Title     string         `yaml:"title"`
 		Color     *hslColorField `yaml:"color"`
@@ -25,18 +38,55 @@ type bookmarksWidget struct {
 			// {{ if not .SameTab }} would return true for any non-nil pointer
 			// which leaves us with no way of checking if the value is true or
 			// false, hence the duplicated fields below
-			SameTabRaw   *bool  `yaml:"same-tab"`
-			SameTab      bool   `yaml:"-"`
-			HideArrowRaw *bool  `yaml:"hide-arrow"`
-			HideArrow    bool   `yaml:"-"`
-			Target       string `yaml:"target"`
+			SameTabRaw   *bool                `yaml:"same-tab"`
+			SameTab      bool                 `yaml:"-"`
+			HideArrowRaw *bool                `yaml:"hide-arrow"`
+			HideArrow    bool                 `yaml:"-"`
+			Target       string               `yaml:"target"`
+			WakeOnLAN    *wakeOnLANField      `yaml:"wake-on-lan"`
+			Check        bookmarkCheckOptions `yaml:"check"`
+			Status       *bookmarkLinkStatus  `yaml:"-"`
+			usesFavicon  bool
 		} `yaml:"links"`
 	} `yaml:"groups"`
 }
 
+type bookmarkCheckOptions struct {
+	Enabled        bool          `yaml:"-"`
+	URL            string        `yaml:"url"`
+	Timeout        durationField `yaml:"timeout"`
+	AllowInsecure  bool          `yaml:"allow-insecure"`
+	AltStatusCodes []int         `yaml:"alt-status-codes"`
+	request        *SiteStatusRequest
+}
+
+func (o *bookmarkCheckOptions) UnmarshalYAML(node *yaml.Node) error {
+	type bookmarkCheckOptionsAlias bookmarkCheckOptions
+	alias := (*bookmarkCheckOptionsAlias)(o)
+
+	// allows for both `check: true` and specifying the individual options
+	if err := node.Decode(&o.Enabled); err == nil {
+		return nil
+	}
+
+	o.Enabled = true
+	return node.Decode(alias)
+}
+
+type bookmarkLinkStatus struct {
+	OK   bool
+	Text string
+}
+
 func (widget *bookmarksWidget) initialize() error {
 	widget.withTitle("Bookmarks").withError(nil)
 
+	if widget.Style != "" && widget.Style != "list" && widget.Style != "grid" {
+		return fmt.Errorf("unknown style %q, must be either list or grid", widget.Style)
+	}
+
+	needsUpdates := false
+
 	for g := range widget.Groups {
 		group := &widget.Groups[g]
 		for l := range group.Links {
@@ -64,14 +114,114 @@ func (widget *bookmarksWidget) initialize() error {
 					}
 				}
 			}
+
+			if link.Icon.URL == bookmarksFaviconIcon || (widget.Favicons && link.Icon.URL == "") {
+				link.usesFavicon = true
+				link.Icon = customIconField{}
+				needsUpdates = true
+			}
+
+			if link.Check.Enabled {
+				if link.Check.URL == "" && link.URL == "" {
+					return errors.New("links which are checked need a url")
+				}
+
+				link.Check.request = &SiteStatusRequest{
+					DefaultURL:    link.URL,
+					CheckURL:      link.Check.URL,
+					AllowInsecure: link.Check.AllowInsecure,
+					Timeout:       link.Check.Timeout,
+				}
+				needsUpdates = true
+			}
 		}
 	}
 
-	widget.cachedHTML = widget.renderTemplate(widget, bookmarksWidgetTemplate)
+	// only links which get checked or use favicons need the widget to update,
+	// the rest of the time it never changes so it only gets rendered once
+	if needsUpdates {
+		widget.withCacheDuration(5 * time.Minute)
+	} else {
+		widget.cachedHTML = widget.renderTemplate(widget, bookmarksWidgetTemplate)
+	}
 
 	return nil
 }
 
+func (widget *bookmarksWidget) update(ctx context.Context) {
+	requests := make([]*SiteStatusRequest, 0)
+
+	for g := range widget.Groups {
+		group := &widget.Groups[g]
+		for l := range group.Links {
+			link := &group.Links[l]
+
+			// the image cache doesn't exist yet when the widget is initialized
+			if link.usesFavicon {
+				link.Icon.URL = template.URL(bookmarkFaviconURL(link.URL))
+			}
+
+			if link.Check.request != nil {
+				requests = append(requests, link.Check.request)
+			}
+		}
+	}
+
+	if len(requests) == 0 {
+		widget.withError(nil).scheduleNextUpdate()
+		return
+	}
+
+	statuses, err := fetchStatusForSites(widget.statusCheckClient(false), widget.statusCheckClient(true), requests)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	i := 0
+	for g := range widget.Groups {
+		group := &widget.Groups[g]
+		for l := range group.Links {
+			link := &group.Links[l]
+			if link.Check.request == nil {
+				continue
+			}
+
+			status := &statuses[i]
+			okStatusCodes := append([]int{200}, link.Check.AltStatusCodes...)
+			link.Status = &bookmarkLinkStatus{
+				OK:   status.Error == nil && slices.Contains(okStatusCodes, status.Code),
+				Text: siteStatusLabel(status, statusCodeToText(status.Code, okStatusCodes)),
+			}
+
+			if status.Error == nil {
+				link.Status.Text += fmt.Sprintf(" · %dms", status.ResponseTime.Milliseconds())
+			}
+
+			i++
+		}
+	}
+}
+
 func (widget *bookmarksWidget) Render() template.HTML {
-	return widget.cachedHTML
+	if widget.cachedHTML != "" {
+		return widget.cachedHTML
+	}
+
+	return widget.renderTemplate(widget, bookmarksWidgetTemplate)
+}
+
+// Sites served over plain HTTP, which is common for self-hosted ones, can't
+// go through the image cache since it upgrades every request to HTTPS
+func bookmarkFaviconURL(link string) string {
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+
+	faviconURL := parsed.Scheme + "://" + parsed.Host + "/favicon.ico"
+	if parsed.Scheme == "http" {
+		return imageProxyURL(faviconURL)
+	}
+
+	return globalImageCache.GetCachedImageURL(faviconURL)
 }
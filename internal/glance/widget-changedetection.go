@@ -2,13 +2,20 @@ package glance
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"log/slog"
 	"net/http"
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
 )
 
 var changeDetectionWidgetTemplate = mustParseTemplate("change-detection.html", "widget-base.html")
@@ -19,10 +26,17 @@ type changeDetectionWidget struct {
 	WatchUUIDs       []string                 `yaml:"watches"`
 	InstanceURL      string                   `yaml:"instance-url"`
 	Token            string                   `yaml:"token"`
+	Pages            []changeDetectionPage    `yaml:"pages"`
 	Limit            int                      `yaml:"limit"`
 	CollapseAfter    int                      `yaml:"collapse-after"`
 }
 
+type changeDetectionPage struct {
+	URL      string `yaml:"url"`
+	Selector string `yaml:"selector"`
+	Title    string `yaml:"title"`
+}
+
 func (widget *changeDetectionWidget) initialize() error {
 	widget.withTitle("Change Detection").withCacheDuration(1 * time.Hour)
 
@@ -34,16 +48,55 @@ func (widget *changeDetectionWidget) initialize() error {
 		widget.CollapseAfter = 5
 	}
 
+	if len(widget.Pages) > 0 {
+		if len(widget.WatchUUIDs) > 0 || widget.InstanceURL != "" {
+			return errors.New("pages can't be combined with watches or instance-url")
+		}
+
+		for i := range widget.Pages {
+			page := &widget.Pages[i]
+
+			if page.URL == "" {
+				return fmt.Errorf("page #%d has no url", i+1)
+			}
+
+			if page.Selector != "" {
+				if _, err := cascadia.Compile(page.Selector); err != nil {
+					return fmt.Errorf("invalid selector for page #%d: %v", i+1, err)
+				}
+			}
+		}
+
+		return nil
+	}
+
 	if widget.InstanceURL == "" {
 		widget.InstanceURL = "https://www.changedetection.io"
+	} else {
+		widget.InstanceURL = strings.TrimRight(widget.InstanceURL, "/")
 	}
 
 	return nil
 }
 
 func (widget *changeDetectionWidget) update(ctx context.Context) {
+	if len(widget.Pages) > 0 {
+		watches, err := widget.checkPages()
+
+		if !widget.canContinueUpdateAfterHandlingErr(err) {
+			return
+		}
+
+		if len(watches) > widget.Limit {
+			watches = watches[:widget.Limit]
+		}
+
+		widget.ChangeDetections = watches
+		return
+	}
+
 	if len(widget.WatchUUIDs) == 0 {
-		uuids, err := fetchWatchUUIDsFromChangeDetection(widget.InstanceURL, string(widget.Token))
+		uuids, err := fetchWatchUUIDsFromChangeDetection(widget.httpClient(defaultHTTPClient), widget.InstanceURL, string(widget.Token))
 
 		if !widget.canContinueUpdateAfterHandlingErr(err) {
 			return
@@ -52,7 +105,7 @@ func (widget *changeDetectionWidget) update(ctx context.Context) {
 		widget.WatchUUIDs = uuids
 	}
 
-	watches, err := fetchWatchesFromChangeDetection(widget.InstanceURL, widget.WatchUUIDs, string(widget.Token))
+	watches, err := fetchWatchesFromChangeDetection(widget.httpClient(defaultHTTPClient), widget.InstanceURL, widget.WatchUUIDs, string(widget.Token))
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
@@ -75,6 +128,8 @@ type changeDetectionWatch struct {
 	LastChanged  time.Time
 	DiffURL      string
 	PreviousHash string
+	Unviewed     bool
+	LastError    string
 }
 
 type changeDetectionWatchList []changeDetectionWatch
@@ -93,16 +148,20 @@ type changeDetectionResponseJson struct {
 	LastChanged  int64  `json:"last_changed"`
 	DateCreated  int64  `json:"date_created"`
 	PreviousHash string `json:"previous_md5"`
+	// Not present in older versions, in which case it's worked out from last_viewed
+	Viewed     *bool `json:"viewed"`
+	LastViewed int64 `json:"last_viewed"`
+	LastError  any   `json:"last_error"`
 }
 
-func fetchWatchUUIDsFromChangeDetection(instanceURL string, token string) ([]string, error) {
+func fetchWatchUUIDsFromChangeDetection(client requestDoer, instanceURL string, token string) ([]string, error) {
 	request, _ := http.NewRequest("GET", fmt.Sprintf("%s/api/v1/watch", instanceURL), nil)
 
 	if token != "" {
 		request.Header.Add("x-api-key", token)
 	}
 
-	uuidsMap, err := decodeJsonFromRequest[map[string]struct{}](defaultHTTPClient, request)
+	uuidsMap, err := decodeJsonFromRequest[map[string]struct{}](client, request)
 	if err != nil {
 		return nil, fmt.Errorf("could not fetch list of watch UUIDs: %v", err)
 	}
@@ -116,7 +175,7 @@ func fetchWatchUUIDsFromChangeDetection(instanceURL string, token string) ([]str
 	return uuids, nil
 }
 
-func fetchWatchesFromChangeDetection(instanceURL string, requestedWatchIDs []string, token string) (changeDetectionWatchList, error) {
+func fetchWatchesFromChangeDetection(client requestDoer, instanceURL string, requestedWatchIDs []string, token string) (changeDetectionWatchList, error) {
 	watches := make(changeDetectionWatchList, 0, len(requestedWatchIDs))
 
 	if len(requestedWatchIDs) == 0 {
@@ -135,7 +194,7 @@ func fetchWatchesFromChangeDetection(instanceURL string, requestedWatchIDs []str
 		requests[i] = request
 	}
 
-	task := decodeJsonFromRequestTask[changeDetectionResponseJson](defaultHTTPClient)
+	task := decodeJsonFromRequestTask[changeDetectionResponseJson](client)
 	job := newJob(task, requests).withWorkers(15)
 	responses, errs, err := workerPoolDo(job)
 	if err != nil {
@@ -158,6 +217,17 @@ func fetchWatchesFromChangeDetection(instanceURL string, requestedWatchIDs []str
 			DiffURL: fmt.Sprintf("%s/diff/%s?from_version=%d", instanceURL, requestedWatchIDs[i], watchJson.LastChanged-1),
 		}
 
+		if watchJson.Viewed != nil {
+			watch.Unviewed = !*watchJson.Viewed
+		} else {
+			watch.Unviewed = watchJson.LastChanged > 0 && watchJson.LastViewed < watchJson.LastChanged
+		}
+
+		// false when there is no error, a string otherwise
+		if lastError, ok := watchJson.LastError.(string); ok {
+			watch.LastError = lastError
+		}
+
 		if watchJson.LastChanged == 0 {
 			watch.LastChanged = time.Unix(watchJson.DateCreated, 0)
 		} else {
@@ -195,3 +265,153 @@ func fetchWatchesFromChangeDetection(instanceURL string, requestedWatchIDs []str
 
 	return watches, nil
 }
+
+// How long a page which was checked by the widget itself is marked as new after it changed
+const changeDetectionPageNewDuration = 24 * time.Hour
+
+type changeDetectionPageState struct {
+	Hash      string    `json:"hash"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+type changeDetectionPageResult struct {
+	hash  string
+	title string
+}
+
+func (page *changeDetectionPage) storeKey() string {
+	sum := sha256.Sum256([]byte(page.URL + "\n" + page.Selector))
+	return "change-detection:" + hex.EncodeToString(sum[:8])
+}
+
+// Checks the pages without a changedetection.io instance by hashing the text of
+// the elements matched by the selector and comparing it to the last known hash
+func (widget *changeDetectionWidget) checkPages() (changeDetectionWatchList, error) {
+	job := newJob(fetchChangeDetectionPageTask(widget.httpClient(defaultHTTPClient)), widget.Pages).withWorkers(10)
+	results, errs, err := workerPoolDo(job)
+	if err != nil {
+		return nil, err
+	}
+
+	var store *stateStore
+	if widget.Providers != nil {
+		store = widget.Providers.store
+	}
+
+	now := time.Now()
+	watches := make(changeDetectionWatchList, 0, len(widget.Pages))
+	var failed int
+
+	for i := range widget.Pages {
+		page := &widget.Pages[i]
+
+		var state changeDetectionPageState
+		if store != nil {
+			store.get(page.storeKey(), &state)
+		}
+
+		watch := changeDetectionWatch{
+			Title: page.Title,
+			URL:   page.URL,
+		}
+
+		if errs[i] != nil {
+			failed++
+			slog.Error("Failed to check page for changes", "url", page.URL, "error", errs[i])
+			watch.LastError = errs[i].Error()
+		} else if results[i].hash != state.Hash {
+			// the first time a page is seen isn't considered a change
+			if state.Hash != "" {
+				watch.Unviewed = true
+			}
+
+			state = changeDetectionPageState{Hash: results[i].hash, ChangedAt: now}
+
+			if store != nil {
+				if err := store.set(page.storeKey(), state); err != nil {
+					slog.Error("Failed to save page hash", "url", page.URL, "error", err)
+				}
+			}
+		}
+
+		if watch.Title == "" && errs[i] == nil {
+			watch.Title = results[i].title
+		}
+
+		if watch.Title == "" {
+			watch.Title = strings.TrimPrefix(strings.Trim(stripURLScheme(page.URL), "/"), "www.")
+		}
+
+		if state.Hash != "" {
+			watch.LastChanged = state.ChangedAt
+			watch.PreviousHash = state.Hash[:8]
+			watch.Unviewed = watch.Unviewed || now.Sub(state.ChangedAt) < changeDetectionPageNewDuration
+		}
+
+		watches = append(watches, watch)
+	}
+
+	if failed == len(widget.Pages) {
+		return nil, fmt.Errorf("%w: %s", errNoContent, watches[0].LastError)
+	}
+
+	watches.sortByNewest()
+
+	if failed > 0 {
+		return watches, fmt.Errorf("%w: could not check %d pages", errPartialContent, failed)
+	}
+
+	return watches, nil
+}
+
+func fetchChangeDetectionPageTask(client requestDoer) func(changeDetectionPage) (changeDetectionPageResult, error) {
+	return func(page changeDetectionPage) (changeDetectionPageResult, error) {
+		return fetchChangeDetectionPage(client, page)
+	}
+}
+
+func fetchChangeDetectionPage(client requestDoer, page changeDetectionPage) (changeDetectionPageResult, error) {
+	request, err := http.NewRequest("GET", page.URL, nil)
+	if err != nil {
+		return changeDetectionPageResult{}, err
+	}
+
+	setBrowserUserAgentHeader(request)
+
+	response, err := client.Do(request)
+	if err != nil {
+		return changeDetectionPageResult{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return changeDetectionPageResult{}, fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+
+	document, err := goquery.NewDocumentFromReader(io.LimitReader(response.Body, 5*1024*1024))
+	if err != nil {
+		return changeDetectionPageResult{}, err
+	}
+
+	selection := document.Find("body")
+	if page.Selector != "" {
+		selection = document.Find(page.Selector)
+
+		if selection.Length() == 0 {
+			return changeDetectionPageResult{}, fmt.Errorf("selector %s did not match anything", page.Selector)
+		}
+	}
+
+	// only the text is compared so that changes to markup, such as
+	// attributes with random values, don't count as a change
+	hash := sha256.New()
+	selection.Each(func(_ int, s *goquery.Selection) {
+		hash.Write([]byte(sequentialWhitespacePattern.ReplaceAllString(strings.TrimSpace(s.Text()), " ")))
+		hash.Write([]byte{0})
+	})
+
+	return changeDetectionPageResult{
+		hash:  hex.EncodeToString(hash.Sum(nil)),
+		title: strings.TrimSpace(document.Find("title").First().Text()),
+	}, nil
+}
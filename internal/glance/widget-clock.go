@@ -13,7 +13,11 @@ type clockWidget struct {
 	widgetBase `yaml:",inline"`
 	cachedHTML template.HTML `yaml:"-"`
 	HourFormat string        `yaml:"hour-format"`
-	Timezones  []struct {
+	// Uses ISO 8601 week numbers, where the first week of the year is the one
+	// with the first Thursday in it
+	ShowWeekNumber    bool `yaml:"show-week-number"`
+	ShowTimezoneDates bool `yaml:"show-timezone-dates"`
+	Timezones         []struct {
 		Timezone string `yaml:"timezone"`
 		Label    string `yaml:"label"`
 	} `yaml:"timezones"`
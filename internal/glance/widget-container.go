@@ -34,7 +34,7 @@ func (widget *containerWidgetBase) _update(ctx context.Context) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			widget.update(ctx)
+			updateWidget(ctx, widget)
 		}()
 	}
 
@@ -56,3 +56,58 @@ func (widget *containerWidgetBase) _requiresUpdate(now *time.Time) bool {
 
 	return false
 }
+
+// Implemented by every widget that embeds containerWidgetBase
+type containerWidget interface {
+	containedWidgets() widgets
+}
+
+func (widget *containerWidgetBase) containedWidgets() widgets {
+	return widget.Widgets
+}
+
+// Calls fn for each widget, including the ones nested within containers,
+// stops early if fn returns false
+func walkWidgets(list widgets, fn func(widget) bool) bool {
+	for i := range list {
+		if !fn(list[i]) {
+			return false
+		}
+
+		if container, ok := list[i].(containerWidget); ok {
+			if !walkWidgets(container.containedWidgets(), fn) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Widgets which are being updated in the background get skipped along with
+// the ones within them, since nothing can touch them until they're done
+func forEachPageWidget(page *page, fn func(widget) bool) {
+	walk := func(list widgets) bool {
+		for i := range list {
+			if list[i].base().updateDone != nil {
+				continue
+			}
+
+			if !walkWidgets(list[i:i+1], fn) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	if !walk(page.HeadWidgets) {
+		return
+	}
+
+	for c := range page.Columns {
+		if !walk(page.Columns[c].Widgets) {
+			return
+		}
+	}
+}
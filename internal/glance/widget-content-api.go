@@ -0,0 +1,238 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type widgetContentResponse struct {
+	ID               uint64                     `json:"id"`
+	Type             string                     `json:"type"`
+	Title            string                     `json:"title"`
+	Page             string                     `json:"page"`
+	ContentAvailable bool                       `json:"content_available"`
+	Error            string                     `json:"error,omitempty"`
+	Notice           string                     `json:"notice,omitempty"`
+	LastUpdated      *time.Time                 `json:"last_updated,omitempty"`
+	NextUpdate       *time.Time                 `json:"next_update,omitempty"`
+	Content          map[string]json.RawMessage `json:"content"`
+}
+
+func newWidgetContentResponse(w widget, page *page) *widgetContentResponse {
+	base := w.base()
+
+	response := &widgetContentResponse{
+		ID:               base.ID,
+		Type:             base.Type,
+		Title:            base.Title,
+		Page:             page.Slug,
+		ContentAvailable: base.ContentAvailable,
+		LastUpdated:      optionalTime(base.lastUpdated),
+		NextUpdate:       optionalTime(base.nextUpdate),
+		Content:          make(map[string]json.RawMessage),
+	}
+
+	if base.Error != nil {
+		response.Error = base.Error.Error()
+	}
+
+	if base.Notice != nil {
+		response.Notice = base.Notice.Error()
+	}
+
+	// the same fields that get saved to the content cache, except that the ones
+	// which can't be encoded get left out rather than leaving out everything
+	value, fields := widgetContentFields(w)
+	for _, field := range fields {
+		encoded, err := json.Marshal(value.FieldByIndex(field.Index).Interface())
+		if err != nil {
+			continue
+		}
+
+		response.Content[field.Name] = encoded
+	}
+
+	return response
+}
+
+// Outdated widgets get updated the same way they would when their page gets
+// loaded, including the previous content being served while they update if
+// the widget allows it
+func (a *application) handleWidgetContentRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	page, exists := a.pageFromRequest(r)
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	widget, exists := a.widgetFromRequest(r)
+	if !exists || a.widgetPage[widget.GetID()] != page {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	page.mu.Lock()
+	now := time.Now()
+	var done <-chan struct{} = closedChannel
+
+	if widget.base().updateDone != nil || widget.requiresUpdate(&now) {
+		if widget.base().updateDone == nil && widget.base().canServeStale(now) {
+			widget.base().revalidating = true
+			response := newWidgetContentResponse(widget, page)
+			page.startWidgetUpdate(widget, false)
+			page.mu.Unlock()
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		done = page.startWidgetUpdate(widget, false)
+	}
+	page.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-r.Context().Done():
+		return
+	}
+
+	page.mu.Lock()
+	response := newWidgetContentResponse(widget, page)
+	page.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Responds with the HTML of a widget which was rendered as a placeholder once
+// it has been updated, or with the placeholder showing that it timed out if the
+// update takes longer than the widget's load timeout, in which case the content
+// gets pushed to the page once it's ready
+func (a *application) handleWidgetFragmentRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	widget, exists := a.widgetFromRequest(r)
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	page := a.widgetPage[widget.GetID()]
+
+	page.mu.Lock()
+	done := page.startWidgetUpdate(widget, false)
+	page.mu.Unlock()
+
+	timeout := time.NewTimer(widget.base().loadTimeout())
+	defer timeout.Stop()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	select {
+	case <-done:
+	case <-timeout.C:
+		w.WriteHeader(http.StatusGatewayTimeout)
+		w.Write([]byte(renderWidgetPlaceholder(widget, true)))
+		return
+	case <-r.Context().Done():
+		return
+	}
+
+	page.mu.Lock()
+	html := page.RenderWidget(widget)
+	page.mu.Unlock()
+
+	w.Write([]byte(html))
+}
+
+// Widgets which were updated more recently than this get re-rendered without
+// being updated again, so that clicking refresh repeatedly doesn't hammer the
+// services behind them
+const widgetRefreshMinInterval = 5 * time.Second
+
+// Updates the widget regardless of whether its cache has expired and responds
+// with its re-rendered HTML
+func (a *application) handleWidgetRefreshRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	widget, exists := a.widgetFromRequest(r)
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	if !widget.base().IsRefreshable() {
+		http.Error(w, "widget can not be refreshed", http.StatusBadRequest)
+		return
+	}
+
+	page := a.widgetPage[widget.GetID()]
+
+	page.mu.Lock()
+	var done <-chan struct{} = closedChannel
+	if widget.base().updateDone != nil || time.Since(widget.base().lastUpdated) >= widgetRefreshMinInterval {
+		done = page.startWidgetUpdate(widget, true)
+	}
+	page.mu.Unlock()
+
+	timeout := time.NewTimer(widget.base().loadTimeout())
+	defer timeout.Stop()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	select {
+	case <-done:
+	case <-timeout.C:
+		w.WriteHeader(http.StatusGatewayTimeout)
+		w.Write([]byte(renderWidgetPlaceholder(widget, true)))
+		return
+	case <-r.Context().Done():
+		return
+	}
+
+	page.mu.Lock()
+	html := page.RenderWidget(widget)
+	page.mu.Unlock()
+
+	w.Write([]byte(html))
+}
+
+// Containers only update the widgets within them whose cache has expired, so
+// those have to be updated directly
+func refreshWidget(ctx context.Context, w widget) {
+	container, ok := w.(containerWidget)
+	if !ok {
+		updateWidget(ctx, w)
+		return
+	}
+
+	var wg sync.WaitGroup
+	children := container.containedWidgets()
+
+	for i := range children {
+		child := children[i]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			refreshWidget(ctx, child)
+		}()
+	}
+
+	wg.Wait()
+
+	// none of the widgets within need updating anymore, this only records the update
+	updateWidget(ctx, w)
+}
@@ -0,0 +1,220 @@
+package glance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"time"
+)
+
+const widgetContentCacheDirName = "widgets"
+
+// The last content of every widget is kept in the cache store, within the
+// data path unless another store is configured, so that after a restart
+// widgets show what they had right away rather than all of them fetching
+// their data at once
+type widgetContentSnapshot struct {
+	UpdatedAt  time.Time                  `json:"updated_at"`
+	NextUpdate time.Time                  `json:"next_update"`
+	Fields     map[string]json.RawMessage `json:"fields"`
+}
+
+// The content of a widget is whatever it sets during update, which are its
+// exported fields that don't come from the config
+func widgetContentFields(w widget) (reflect.Value, []reflect.StructField) {
+	value := reflect.ValueOf(w)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, nil
+	}
+
+	value = value.Elem()
+	fields := make([]reflect.StructField, 0)
+
+	for _, field := range reflect.VisibleFields(value.Type()) {
+		// the fields of embedded structs such as widgetBase are handled separately
+		if len(field.Index) != 1 || field.Anonymous || !field.IsExported() || field.Tag.Get("yaml") != "-" {
+			continue
+		}
+
+		fields = append(fields, field)
+	}
+
+	return value, fields
+}
+
+func widgetContentCacheStore(w widget) cacheStore {
+	base := w.base()
+	if base.Providers == nil || base.configHash == "" {
+		return nil
+	}
+
+	return base.Providers.contentCache
+}
+
+func saveWidgetContent(w widget) {
+	base := w.base()
+	if base.Error != nil || !base.ContentAvailable || base.cacheType == cacheTypeInfinite {
+		return
+	}
+
+	store := widgetContentCacheStore(w)
+	if store == nil {
+		return
+	}
+
+	value, fields := widgetContentFields(w)
+	if len(fields) == 0 {
+		return
+	}
+
+	snapshot := widgetContentSnapshot{
+		UpdatedAt:  base.lastUpdated,
+		NextUpdate: base.nextUpdate,
+		Fields:     make(map[string]json.RawMessage, len(fields)),
+	}
+
+	for _, field := range fields {
+		encoded, err := json.Marshal(value.FieldByIndex(field.Index).Interface())
+		if err != nil {
+			// not every widget holds content which can be written out
+			slog.Debug("Not saving widget content", "widget", base.Type, "field", field.Name, "error", err)
+			return
+		}
+
+		snapshot.Fields[field.Name] = encoded
+	}
+
+	contents, err := json.Marshal(&snapshot)
+	if err != nil {
+		slog.Error("Failed to save widget content", "widget", base.Type, "error", fmt.Errorf("encoding content: %v", err))
+		return
+	}
+
+	if err := store.put(base.configHash, contents, "application/json"); err != nil {
+		slog.Error("Failed to save widget content", "widget", base.Type, "error", err)
+	}
+}
+
+// Content which is older than the widget's cache duration still gets
+// restored, it's shown until the update that follows finishes, or while it
+// fails
+func restoreWidgetContent(w widget) {
+	base := w.base()
+	if base.cacheType == cacheTypeInfinite {
+		return
+	}
+
+	store := widgetContentCacheStore(w)
+	if store == nil {
+		return
+	}
+
+	contents, _, err := store.get(base.configHash)
+	if err != nil {
+		if !errors.Is(err, errCacheEntryNotFound) {
+			slog.Error("Failed to read widget content", "widget", base.Type, "error", err)
+		}
+		return
+	}
+
+	var snapshot widgetContentSnapshot
+	if err := json.Unmarshal(contents, &snapshot); err != nil {
+		slog.Error("Failed to parse widget content", "widget", base.Type, "key", base.configHash, "error", err)
+		return
+	}
+
+	value, fields := widgetContentFields(w)
+	if len(fields) == 0 || len(snapshot.Fields) != len(fields) {
+		return
+	}
+
+	// decoded up front so that the widget is left untouched if any field fails
+	decoded := make([]reflect.Value, len(fields))
+	for i, field := range fields {
+		raw, exists := snapshot.Fields[field.Name]
+		if !exists {
+			return
+		}
+
+		decoded[i] = reflect.New(field.Type)
+		if err := json.Unmarshal(raw, decoded[i].Interface()); err != nil {
+			slog.Debug("Not restoring widget content", "widget", base.Type, "field", field.Name, "error", err)
+			return
+		}
+	}
+
+	for i, field := range fields {
+		value.FieldByIndex(field.Index).Set(decoded[i].Elem())
+	}
+
+	base.ContentAvailable = true
+	base.lastUpdated = snapshot.UpdatedAt
+	base.lastSucceeded = snapshot.UpdatedAt
+	base.nextUpdate = snapshot.NextUpdate
+}
+
+// On config reload the widgets whose config didn't change take over the
+// content of the ones they replace, which unlike the content cache doesn't
+// depend on there being a data path
+func (a *application) takeOverWidgetContent(previous *application) {
+	previousByHash := make(map[string][]widget)
+
+	// held until the content has been copied since the previous widgets are
+	// still being updated until their server gets stopped
+	for i := range previous.Config.Pages {
+		page := &previous.Config.Pages[i]
+		page.mu.Lock()
+		defer page.mu.Unlock()
+
+		forEachPageWidget(page, func(w widget) bool {
+			if hash := w.base().configHash; hash != "" {
+				previousByHash[hash] = append(previousByHash[hash], w)
+			}
+			return true
+		})
+	}
+
+	for i := range a.Config.Pages {
+		forEachPageWidget(&a.Config.Pages[i], func(w widget) bool {
+			base := w.base()
+			candidates := previousByHash[base.configHash]
+			if len(candidates) == 0 || base.cacheType == cacheTypeInfinite {
+				return true
+			}
+
+			// identical widgets get matched up in the order they appear in
+			previousByHash[base.configHash] = candidates[1:]
+			copyWidgetContent(candidates[0], w)
+			return true
+		})
+	}
+}
+
+func copyWidgetContent(from, to widget) {
+	fromBase, toBase := from.base(), to.base()
+	if !fromBase.ContentAvailable || fromBase.Type != toBase.Type {
+		return
+	}
+
+	fromValue, fields := widgetContentFields(from)
+	toValue, _ := widgetContentFields(to)
+	if len(fields) == 0 {
+		return
+	}
+
+	for _, field := range fields {
+		toValue.FieldByIndex(field.Index).Set(fromValue.FieldByIndex(field.Index))
+	}
+
+	toBase.ContentAvailable = true
+	toBase.Error = fromBase.Error
+	toBase.Notice = fromBase.Notice
+	toBase.lastUpdated = fromBase.lastUpdated
+	toBase.lastSucceeded = fromBase.lastSucceeded
+	toBase.nextUpdate = fromBase.nextUpdate
+	toBase.lastUpdateDuration = fromBase.lastUpdateDuration
+	toBase.lastError = fromBase.lastError
+	toBase.lastErrorAt = fromBase.lastErrorAt
+}
@@ -0,0 +1,247 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var cryptoPortfolioWidgetTemplate = mustParseTemplate("crypto-portfolio.html", "widget-base.html")
+
+// CoinGecko's free tier is limited to a few dozen requests per minute which
+// is shared between everything that uses the same IP address
+const cryptoPortfolioMinCacheDuration = time.Minute
+
+type cryptoPortfolioWidget struct {
+	widgetBase `yaml:",inline"`
+	Currency   string                   `yaml:"currency"`
+	APIKey     string                   `yaml:"api-key"`
+	Holdings   []cryptoPortfolioHolding `yaml:"holdings"`
+	Portfolio  *cryptoPortfolio         `yaml:"-"`
+}
+
+type cryptoPortfolioHolding struct {
+	Coin      string   `yaml:"coin"`
+	Amount    float64  `yaml:"amount"`
+	CostBasis *float64 `yaml:"cost-basis"`
+}
+
+type cryptoPortfolio struct {
+	CurrencySymbol string
+	Value          float64
+	Change         float64
+	ChangePercent  float64
+	HasProfit      bool
+	Profit         float64
+	ProfitPercent  float64
+	Assets         []cryptoPortfolioAsset
+}
+
+type cryptoPortfolioAsset struct {
+	Name              string
+	Symbol            string
+	ImageURL          string
+	URL               string
+	Amount            float64
+	Value             float64
+	ChangePercent     float64
+	AllocationPercent float64
+	HasProfit         bool
+	Profit            float64
+	ProfitPercent     float64
+}
+
+func (asset *cryptoPortfolioAsset) AmountText() string {
+	return strconv.FormatFloat(asset.Amount, 'f', -1, 64)
+}
+
+// Formats gains and losses with their sign before the currency symbol, such as -$12.50
+func (portfolio *cryptoPortfolio) FormatChange(value float64) string {
+	sign := ternary(value < 0, "-", "+")
+	return sign + portfolio.CurrencySymbol + intl.Sprintf("%.2f", math.Abs(value))
+}
+
+type coingeckoMarketsResponseJson []struct {
+	ID            string  `json:"id"`
+	Symbol        string  `json:"symbol"`
+	Name          string  `json:"name"`
+	Image         string  `json:"image"`
+	CurrentPrice  float64 `json:"current_price"`
+	ChangePercent float64 `json:"price_change_percentage_24h"`
+}
+
+func (widget *cryptoPortfolioWidget) initialize() error {
+	widget.withTitle("加密货币").withCacheDuration(10 * time.Minute)
+
+	if widget.CustomCacheDuration > 0 && time.Duration(widget.CustomCacheDuration) < cryptoPortfolioMinCacheDuration {
+		return errors.New("cache must be at least 1m to stay under the rate limits of CoinGecko")
+	}
+
+	if len(widget.Holdings) == 0 {
+		return errors.New("at least one holding is required")
+	}
+
+	for i := range widget.Holdings {
+		holding := &widget.Holdings[i]
+		holding.Coin = strings.ToLower(strings.TrimSpace(holding.Coin))
+
+		if holding.Coin == "" {
+			return fmt.Errorf("holding #%d has no coin", i+1)
+		}
+
+		if holding.Amount < 0 {
+			return fmt.Errorf("the amount of %s can't be negative", holding.Coin)
+		}
+	}
+
+	if widget.Currency == "" {
+		widget.Currency = "usd"
+	}
+
+	widget.Currency = strings.ToLower(widget.Currency)
+
+	return nil
+}
+
+func (widget *cryptoPortfolioWidget) update(ctx context.Context) {
+	portfolio, err := fetchCryptoPortfolio(widget.httpClient(defaultHTTPClient), widget.Holdings, widget.Currency, widget.APIKey)
+
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Portfolio = portfolio
+}
+
+func (widget *cryptoPortfolioWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, cryptoPortfolioWidgetTemplate)
+}
+
+// The prices of all coins are fetched with a single request, regardless of how
+// many holdings there are
+func fetchCryptoPortfolio(client requestDoer, holdings []cryptoPortfolioHolding, currency, apiKey string) (*cryptoPortfolio, error) {
+	type combinedHolding struct {
+		amount       float64
+		costBasis    float64
+		hasCostBasis bool
+	}
+
+	// the same coin can be held in several places
+	combined := make(map[string]*combinedHolding)
+	ids := make([]string, 0, len(holdings))
+
+	for i := range holdings {
+		holding := &holdings[i]
+
+		c, exists := combined[holding.Coin]
+		if !exists {
+			c = &combinedHolding{hasCostBasis: true}
+			combined[holding.Coin] = c
+			ids = append(ids, holding.Coin)
+		}
+
+		c.amount += holding.Amount
+		if holding.CostBasis != nil {
+			c.costBasis += *holding.CostBasis
+		} else {
+			c.hasCostBasis = false
+		}
+	}
+
+	query := url.Values{}
+	query.Set("vs_currency", currency)
+	query.Set("ids", strings.Join(ids, ","))
+	query.Set("price_change_percentage", "24h")
+
+	request, _ := http.NewRequest("GET", "https://api.coingecko.com/api/v3/coins/markets?"+query.Encode(), nil)
+	if apiKey != "" {
+		request.Header.Set("x-cg-demo-api-key", apiKey)
+	}
+
+	response, err := decodeJsonFromRequest[coingeckoMarketsResponseJson](client, request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNoContent, err)
+	}
+
+	if len(response) == 0 {
+		return nil, fmt.Errorf("%w: none of the coins were found, make sure to use their CoinGecko IDs", errNoContent)
+	}
+
+	currencySymbol, exists := currencyToSymbol[strings.ToUpper(currency)]
+	if !exists {
+		currencySymbol = strings.ToUpper(currency) + " "
+	}
+
+	portfolio := &cryptoPortfolio{
+		CurrencySymbol: currencySymbol,
+		Assets:         make([]cryptoPortfolioAsset, 0, len(response)),
+		HasProfit:      true,
+	}
+
+	var totalCost, valueBeforeChange float64
+
+	for i := range response {
+		coin := &response[i]
+		holding, exists := combined[coin.ID]
+		if !exists {
+			continue
+		}
+
+		asset := cryptoPortfolioAsset{
+			Name:          coin.Name,
+			Symbol:        strings.ToUpper(coin.Symbol),
+			ImageURL:      globalImageCache.GetCachedImageURL(coin.Image),
+			URL:           "https://www.coingecko.com/en/coins/" + coin.ID,
+			Amount:        holding.amount,
+			Value:         coin.CurrentPrice * holding.amount,
+			ChangePercent: coin.ChangePercent,
+		}
+
+		if holding.hasCostBasis {
+			asset.HasProfit = true
+			asset.Profit = asset.Value - holding.costBasis
+			asset.ProfitPercent = percentChange(asset.Value, holding.costBasis)
+			totalCost += holding.costBasis
+		} else {
+			portfolio.HasProfit = false
+		}
+
+		portfolio.Value += asset.Value
+		valueBeforeChange += asset.Value / (1 + coin.ChangePercent/100)
+		portfolio.Assets = append(portfolio.Assets, asset)
+	}
+
+	// only shown when it covers the whole portfolio, otherwise it'd look like
+	// the coins without a cost basis were free
+	if portfolio.HasProfit {
+		portfolio.Profit = portfolio.Value - totalCost
+		portfolio.ProfitPercent = percentChange(portfolio.Value, totalCost)
+	}
+
+	portfolio.Change = portfolio.Value - valueBeforeChange
+	portfolio.ChangePercent = percentChange(portfolio.Value, valueBeforeChange)
+
+	for i := range portfolio.Assets {
+		if portfolio.Value > 0 {
+			portfolio.Assets[i].AllocationPercent = portfolio.Assets[i].Value / portfolio.Value * 100
+		}
+	}
+
+	sort.SliceStable(portfolio.Assets, func(a, b int) bool {
+		return portfolio.Assets[a].Value > portfolio.Assets[b].Value
+	})
+
+	if missing := len(ids) - len(portfolio.Assets); missing > 0 {
+		return portfolio, fmt.Errorf("%w: %d coin(s) were not found", errPartialContent, missing)
+	}
+
+	return portfolio, nil
+}
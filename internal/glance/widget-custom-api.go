@@ -35,6 +35,8 @@ type CustomAPIRequest struct {
 	SkipJSONValidation bool                 `yaml:"skip-json-validation"`
 	bodyReader         io.ReadSeeker        `yaml:"-"`
 	httpRequest        *http.Request        `yaml:"-"`
+	// nil for the requests made from within templates
+	client requestDoer `yaml:"-"`
 }
 
 type customAPIWidget struct {
@@ -55,10 +57,16 @@ func (widget *customAPIWidget) initialize() error {
 		return fmt.Errorf("initializing primary request: %v", err)
 	}
 
+	if widget.CustomAPIRequest != nil {
+		widget.CustomAPIRequest.client = widget.requestClientFor(widget.CustomAPIRequest)
+	}
+
 	for key := range widget.Subrequests {
 		if err := widget.Subrequests[key].initialize(); err != nil {
 			return fmt.Errorf("initializing subrequest %q: %v", key, err)
 		}
+
+		widget.Subrequests[key].client = widget.requestClientFor(widget.Subrequests[key])
 	}
 
 	if widget.Template == "" {
@@ -122,6 +130,10 @@ func (o *customAPIOptions) JSON(key string) string {
 	return string(encoded)
 }
 
+func (widget *customAPIWidget) requestClientFor(req *CustomAPIRequest) requestDoer {
+	return widget.httpClient(ternary(req.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient))
+}
+
 func customAPIGetOptionOrDefault[T any](o customAPIOptions, key string, defaultValue T) T {
 	if value, exists := o[key]; exists {
 		if typedValue, ok := value.(T); ok {
@@ -240,7 +252,11 @@ func fetchCustomAPIResponse(ctx context.Context, req *CustomAPIRequest) (*custom
 		req.bodyReader.Seek(0, io.SeekStart)
 	}
 
-	client := ternary(req.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient)
+	client := req.client
+	if client == nil {
+		client = ternary(req.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient)
+	}
+
 	resp, err := client.Do(req.httpRequest.WithContext(ctx))
 	if err != nil {
 		return nil, err
@@ -620,6 +636,35 @@ var customAPITemplateFuncs = func() template.FuncMap {
 
 			return results
 		},
+		"formatBytes": func(bytes any) string {
+			switch b := bytes.(type) {
+			case int:
+				return formatBytesApprox(int64(b))
+			case float64:
+				return formatBytesApprox(int64(b))
+			default:
+				return ""
+			}
+		},
+		"formatDuration": func(value any) string {
+			// numbers are treated as seconds since that's what most APIs return
+			switch v := value.(type) {
+			case time.Duration:
+				return customAPIFuncFormatDuration(v)
+			case int:
+				return customAPIFuncFormatDuration(time.Duration(v) * time.Second)
+			case float64:
+				return customAPIFuncFormatDuration(time.Duration(v * float64(time.Second)))
+			default:
+				return ""
+			}
+		},
+		"default": func(fallback, value string) string {
+			if value == "" {
+				return fallback
+			}
+			return value
+		},
 		"concat": func(items ...string) string {
 			return strings.Join(items, "")
 		},
@@ -706,6 +751,42 @@ func customAPIFuncFormatTime(layout string, t time.Time) string {
 	return t.Format(layout)
 }
 
+// Only shows the two largest units, such as 3d 4h or 5m 10s
+func customAPIFuncFormatDuration(d time.Duration) string {
+	d = d.Abs().Round(time.Second)
+
+	units := []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	}
+
+	parts := make([]string, 0, 2)
+
+	for _, unit := range units {
+		if d < unit.size && len(parts) == 0 {
+			continue
+		}
+
+		parts = append(parts, strconv.FormatInt(int64(d/unit.size), 10)+unit.suffix)
+		d %= unit.size
+
+		if len(parts) == 2 {
+			break
+		}
+	}
+
+	if len(parts) == 0 {
+		return "0s"
+	}
+
+	return strings.Join(parts, " ")
+}
+
 func customAPIFuncParseTimeInLocation(layout, value string, loc *time.Location) time.Time {
 	switch strings.ToLower(layout) {
 	case "unix":
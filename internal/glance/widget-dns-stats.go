@@ -88,18 +88,20 @@ func (widget *dnsStatsWidget) update(ctx context.Context) {
 	var stats *dnsStats
 	var err error
 
+	client := widget.httpClient(ternary(widget.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient))
+
 	switch widget.Service {
 	case dnsServiceAdguard:
-		stats, err = fetchAdguardStats(widget.URL, widget.AllowInsecure, widget.Username, widget.Password, widget.HideGraph)
+		stats, err = fetchAdguardStats(widget.URL, client, widget.Username, widget.Password, widget.HideGraph)
 	case dnsServicePihole:
-		stats, err = fetchPihole5Stats(widget.URL, widget.AllowInsecure, widget.Token, widget.HideGraph)
+		stats, err = fetchPihole5Stats(widget.URL, client, widget.Token, widget.HideGraph)
 	case dnsServiceTechnitium:
-		stats, err = fetchTechnitiumStats(widget.URL, widget.AllowInsecure, widget.Token, widget.HideGraph)
+		stats, err = fetchTechnitiumStats(widget.URL, client, widget.Token, widget.HideGraph)
 	case dnsServicePiholeV6:
 		var newSessionID string
 		stats, newSessionID, err = fetchPiholeStats(
 			widget.URL,
-			widget.AllowInsecure,
+			client,
 			widget.Password,
 			widget.piholeSessionID,
 			!widget.HideGraph,
@@ -135,8 +137,17 @@ type dnsStats struct {
 	DomainsBlocked    int
 	Series            [dnsStatsBars]dnsStatsSeries
 	TopBlockedDomains []dnsStatsBlockedDomain
+	// Empty when the service didn't report whether blocking is enabled
+	BlockingStatus string
+	// Only set when blocking was disabled for a limited amount of time
+	BlockingResumesAt time.Time
 }
 
+const (
+	dnsBlockingEnabled  = "enabled"
+	dnsBlockingDisabled = "disabled"
+)
+
 type dnsStatsSeries struct {
 	Queries        int
 	Blocked        int
@@ -158,7 +169,7 @@ type adguardStatsResponse struct {
 	TopBlockedDomains []map[string]int `json:"top_blocked_domains"`
 }
 
-func fetchAdguardStats(instanceURL string, allowInsecure bool, username, password string, noGraph bool) (*dnsStats, error) {
+func fetchAdguardStats(instanceURL string, client requestDoer, username, password string, noGraph bool) (*dnsStats, error) {
 	requestURL := strings.TrimRight(instanceURL, "/") + "/control/stats"
 
 	request, err := http.NewRequest("GET", requestURL, nil)
@@ -168,7 +179,6 @@ func fetchAdguardStats(instanceURL string, allowInsecure bool, username, passwor
 
 	request.SetBasicAuth(username, password)
 
-	var client = ternary(allowInsecure, defaultInsecureHTTPClient, defaultHTTPClient)
 	responseJson, err := decodeJsonFromRequest[adguardStatsResponse](client, request)
 	if err != nil {
 		return nil, err
@@ -183,8 +193,14 @@ func fetchAdguardStats(instanceURL string, allowInsecure bool, username, passwor
 		TopBlockedDomains: make([]dnsStatsBlockedDomain, 0, topBlockedDomainsCount),
 	}
 
+	var statusErr error
+	if err := fetchAdguardBlockingStatus(client, instanceURL, username, password, stats); err != nil {
+		slog.Error("Failed to fetch AdGuard protection status", "error", err)
+		statusErr = errPartialContent
+	}
+
 	if stats.TotalQueries <= 0 {
-		return stats, nil
+		return stats, statusErr
 	}
 
 	stats.BlockedPercent = int(float64(responseJson.BlockedQueries) / float64(responseJson.TotalQueries) * 100)
@@ -212,7 +228,7 @@ func fetchAdguardStats(instanceURL string, allowInsecure bool, username, passwor
 	}
 
 	if noGraph {
-		return stats, nil
+		return stats, statusErr
 	}
 
 	queriesSeries := responseJson.QueriesSeries
@@ -259,7 +275,35 @@ func fetchAdguardStats(instanceURL string, allowInsecure bool, username, passwor
 		stats.Series[i].PercentTotal = int(float64(stats.Series[i].Queries) / float64(maxQueriesInSeries) * 100)
 	}
 
-	return stats, nil
+	return stats, statusErr
+}
+
+type adguardStatusResponse struct {
+	ProtectionEnabled bool `json:"protection_enabled"`
+	// Milliseconds left until protection is enabled again
+	ProtectionDisabledDuration int64 `json:"protection_disabled_duration"`
+}
+
+func fetchAdguardBlockingStatus(client requestDoer, instanceURL, username, password string, stats *dnsStats) error {
+	request, err := http.NewRequest("GET", strings.TrimRight(instanceURL, "/")+"/control/status", nil)
+	if err != nil {
+		return err
+	}
+
+	request.SetBasicAuth(username, password)
+
+	status, err := decodeJsonFromRequest[adguardStatusResponse](client, request)
+	if err != nil {
+		return err
+	}
+
+	stats.BlockingStatus = ternary(status.ProtectionEnabled, dnsBlockingEnabled, dnsBlockingDisabled)
+
+	if !status.ProtectionEnabled && status.ProtectionDisabledDuration > 0 {
+		stats.BlockingResumesAt = time.Now().Add(time.Duration(status.ProtectionDisabledDuration) * time.Millisecond)
+	}
+
+	return nil
 }
 
 // Legacy Pi-hole stats response (before v6)
@@ -271,6 +315,7 @@ type pihole5StatsResponse struct {
 	BlockedPercentage float64                  `json:"ads_percentage_today"`
 	TopBlockedDomains pihole5TopBlockedDomains `json:"top_ads"`
 	DomainsBlocked    int                      `json:"domains_being_blocked"`
+	Status            string                   `json:"status"`
 }
 
 // If the user has query logging disabled it's possible for domains_over_time to be returned as an
@@ -311,7 +356,7 @@ func (p *pihole5TopBlockedDomains) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-func fetchPihole5Stats(instanceURL string, allowInsecure bool, token string, noGraph bool) (*dnsStats, error) {
+func fetchPihole5Stats(instanceURL string, client requestDoer, token string, noGraph bool) (*dnsStats, error) {
 	if token == "" {
 		return nil, errors.New("missing API token")
 	}
@@ -324,7 +369,6 @@ func fetchPihole5Stats(instanceURL string, allowInsecure bool, token string, noG
 		return nil, err
 	}
 
-	var client = ternary(allowInsecure, defaultInsecureHTTPClient, defaultHTTPClient)
 	responseJson, err := decodeJsonFromRequest[pihole5StatsResponse](client, request)
 	if err != nil {
 		return nil, err
@@ -337,6 +381,10 @@ func fetchPihole5Stats(instanceURL string, allowInsecure bool, token string, noG
 		DomainsBlocked: responseJson.DomainsBlocked,
 	}
 
+	if responseJson.Status == dnsBlockingEnabled || responseJson.Status == dnsBlockingDisabled {
+		stats.BlockingStatus = responseJson.Status
+	}
+
 	if len(responseJson.TopBlockedDomains) > 0 {
 		domains := make([]dnsStatsBlockedDomain, 0, len(responseJson.TopBlockedDomains))
 
@@ -411,14 +459,13 @@ func fetchPihole5Stats(instanceURL string, allowInsecure bool, token string, noG
 
 func fetchPiholeStats(
 	instanceURL string,
-	allowInsecure bool,
+	client requestDoer,
 	password string,
 	sessionID string,
 	includeGraph bool,
 	includeTopDomains bool,
 ) (*dnsStats, string, error) {
 	instanceURL = strings.TrimRight(instanceURL, "/")
-	var client = ternary(allowInsecure, defaultInsecureHTTPClient, defaultHTTPClient)
 
 	fetchNewSessionID := func() error {
 		newSessionID, err := fetchPiholeSessionID(instanceURL, client, password)
@@ -525,6 +572,24 @@ func fetchPiholeStats(
 		}()
 	}
 
+	type blockingResponseJson struct {
+		Blocking string `json:"blocking"`
+		// Seconds until blocking gets toggled back, null when there's no timer
+		Timer *float64 `json:"timer"`
+	}
+
+	var blockingResponse blockingResponseJson
+	var blockingErr error
+
+	blockingRequest, _ := http.NewRequestWithContext(ctx, "GET", instanceURL+"/api/dns/blocking", nil)
+	blockingRequest.Header.Set("x-ftl-sid", sessionID)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		blockingResponse, blockingErr = decodeJsonFromRequest[blockingResponseJson](client, blockingRequest)
+	}()
+
 	wg.Wait()
 	partialContent := false
 
@@ -542,6 +607,11 @@ func fetchPiholeStats(
 		partialContent = true
 	}
 
+	if blockingErr != nil {
+		slog.Error("Failed to fetch Pihole v6 blocking status", "error", blockingErr)
+		partialContent = true
+	}
+
 	stats := &dnsStats{
 		TotalQueries:   statsResponse.Queries.Total,
 		BlockedQueries: statsResponse.Queries.Blocked,
@@ -549,6 +619,19 @@ func fetchPiholeStats(
 		DomainsBlocked: statsResponse.Gravity.DomainsBlocked,
 	}
 
+	if blockingErr == nil {
+		switch blockingResponse.Blocking {
+		case dnsBlockingEnabled:
+			stats.BlockingStatus = dnsBlockingEnabled
+		case dnsBlockingDisabled:
+			stats.BlockingStatus = dnsBlockingDisabled
+
+			if blockingResponse.Timer != nil && *blockingResponse.Timer > 0 {
+				stats.BlockingResumesAt = time.Now().Add(time.Duration(*blockingResponse.Timer * float64(time.Second)))
+			}
+		}
+	}
+
 	if includeGraph && seriesErr == nil {
 		if len(seriesResponse.History) != 145 {
 			slog.Error(
@@ -615,7 +698,7 @@ func fetchPiholeStats(
 	return stats, sessionID, ternary(partialContent, errPartialContent, nil)
 }
 
-func fetchPiholeSessionID(instanceURL string, client *http.Client, password string) (string, error) {
+func fetchPiholeSessionID(instanceURL string, client requestDoer, password string) (string, error) {
 	requestBody := []byte(`{"password":"` + password + `"}`)
 
 	request, err := http.NewRequest("POST", instanceURL+"/api/auth", bytes.NewBuffer(requestBody))
@@ -663,7 +746,7 @@ func fetchPiholeSessionID(instanceURL string, client *http.Client, password stri
 	return jsonResponse.Session.SID, nil
 }
 
-func checkPiholeSessionIDIsValid(instanceURL string, client *http.Client, sessionID string) (bool, error) {
+func checkPiholeSessionIDIsValid(instanceURL string, client requestDoer, sessionID string) (bool, error) {
 	request, err := http.NewRequest("GET", instanceURL+"/api/auth", nil)
 	if err != nil {
 		return false, fmt.Errorf("creating session ID check request: %v", err)
@@ -704,7 +787,7 @@ type technitiumStatsResponse struct {
 	} `json:"response"`
 }
 
-func fetchTechnitiumStats(instanceUrl string, allowInsecure bool, token string, noGraph bool) (*dnsStats, error) {
+func fetchTechnitiumStats(instanceUrl string, client requestDoer, token string, noGraph bool) (*dnsStats, error) {
 	if token == "" {
 		return nil, errors.New("missing API token")
 	}
@@ -716,13 +799,6 @@ func fetchTechnitiumStats(instanceUrl string, allowInsecure bool, token string,
 		return nil, err
 	}
 
-	var client requestDoer
-	if !allowInsecure {
-		client = defaultHTTPClient
-	} else {
-		client = defaultInsecureHTTPClient
-	}
-
 	responseJson, err := decodeJsonFromRequest[technitiumStatsResponse](client, request)
 	if err != nil {
 		return nil, err
@@ -2,12 +2,17 @@ package glance
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"sort"
 	"strings"
 	"time"
@@ -21,9 +26,28 @@ type dockerContainersWidget struct {
 	RunningOnly          bool                         `yaml:"running-only"`
 	Category             string                       `yaml:"category"`
 	SockPath             string                       `yaml:"sock-path"`
+	TLS                  dockerTLSOptions             `yaml:"tls"`
 	FormatContainerNames bool                         `yaml:"format-container-names"`
+	LabelFilters         map[string]string            `yaml:"label-filters"`
+	GroupBy              string                       `yaml:"group-by"`
+	ShowStats            bool                         `yaml:"show-stats"`
 	Containers           dockerContainerList          `yaml:"-"`
+	Groups               []dockerContainerGroup       `yaml:"-"`
 	LabelOverrides       map[string]map[string]string `yaml:"containers"`
+	client               *http.Client
+	baseURL              string
+}
+
+type dockerTLSOptions struct {
+	CA            string `yaml:"ca"`
+	Cert          string `yaml:"cert"`
+	Key           string `yaml:"key"`
+	AllowInsecure bool   `yaml:"allow-insecure"`
+}
+
+type dockerContainerGroup struct {
+	Name       string
+	Containers dockerContainerList
 }
 
 func (widget *dockerContainersWidget) initialize() error {
@@ -33,24 +57,45 @@ func (widget *dockerContainersWidget) initialize() error {
 		widget.SockPath = "/var/run/docker.sock"
 	}
 
+	client, baseURL, err := newDockerClient(widget.SockPath, &widget.TLS)
+	if err != nil {
+		return err
+	}
+
+	widget.client = client
+	widget.baseURL = baseURL
+
 	return nil
 }
 
 func (widget *dockerContainersWidget) update(ctx context.Context) {
 	containers, err := fetchDockerContainers(
-		widget.SockPath,
+		widget.client,
+		widget.baseURL,
 		widget.HideByDefault,
 		widget.Category,
 		widget.RunningOnly,
 		widget.FormatContainerNames,
+		widget.LabelFilters,
 		widget.LabelOverrides,
 	)
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
 	}
 
+	if widget.ShowStats {
+		err = fetchDockerContainersStats(widget.client, widget.baseURL, containers)
+		if !widget.canContinueUpdateAfterHandlingErr(err) {
+			return
+		}
+	}
+
 	containers.sortByStateIconThenTitle()
 	widget.Containers = containers
+
+	if widget.GroupBy != "" {
+		widget.Groups = groupDockerContainersByLabel(containers, widget.GroupBy)
+	}
 }
 
 func (widget *dockerContainersWidget) Render() template.HTML {
@@ -84,6 +129,7 @@ var dockerContainerStateIconPriorities = map[string]int{
 }
 
 type dockerContainerJsonResponse struct {
+	ID     string                `json:"Id"`
 	Names  []string              `json:"Names"`
 	Image  string                `json:"Image"`
 	State  string                `json:"State"`
@@ -118,9 +164,15 @@ type dockerContainer struct {
 	State       string
 	StateText   string
 	StateIcon   string
+	Health      string
 	Description string
 	Icon        customIconField
 	Children    dockerContainerList
+	HasStats    bool
+	CPUPercent  float64
+	MemoryMB    uint64
+	id          string
+	labels      dockerContainerLabels
 }
 
 type dockerContainerList []dockerContainer
@@ -137,6 +189,23 @@ func (containers dockerContainerList) sortByStateIconThenTitle() {
 	})
 }
 
+// Docker only includes the health of containers with a health check in the
+// status text, such as "Up 2 hours (healthy)"
+func dockerContainerHealthFromStatus(status string) string {
+	status = strings.ToLower(status)
+
+	switch {
+	case strings.Contains(status, "(unhealthy)"):
+		return "unhealthy"
+	case strings.Contains(status, "(healthy)"):
+		return "healthy"
+	case strings.Contains(status, "(health: starting)"):
+		return "starting"
+	}
+
+	return ""
+}
+
 func dockerContainerStateToStateIcon(state string) string {
 	switch state {
 	case "running":
@@ -151,14 +220,16 @@ func dockerContainerStateToStateIcon(state string) string {
 }
 
 func fetchDockerContainers(
-	socketPath string,
+	client *http.Client,
+	baseURL string,
 	hideByDefault bool,
 	category string,
 	runningOnly bool,
 	formatNames bool,
+	labelFilters map[string]string,
 	labelOverrides map[string]map[string]string,
 ) (dockerContainerList, error) {
-	containers, err := fetchDockerContainersFromSource(socketPath, category, runningOnly, labelOverrides)
+	containers, err := fetchDockerContainersFromSource(client, baseURL, category, runningOnly, labelFilters, labelOverrides)
 	if err != nil {
 		return nil, fmt.Errorf("fetching containers: %w", err)
 	}
@@ -177,17 +248,25 @@ func fetchDockerContainers(
 			Image:       container.Image,
 			State:       strings.ToLower(container.State),
 			StateText:   strings.ToLower(container.Status),
+			Health:      dockerContainerHealthFromStatus(container.Status),
 			Icon:        newCustomIconField(container.Labels.getOrDefault(dockerContainerLabelIcon, "si:docker")),
+			id:          container.ID,
+			labels:      container.Labels,
 		}
 
 		if idValue := container.Labels.getOrDefault(dockerContainerLabelID, ""); idValue != "" {
 			if children, ok := children[idValue]; ok {
 				for i := range children {
 					child := &children[i]
+					childState := strings.ToLower(child.State)
+					if dockerContainerHealthFromStatus(child.Status) == "unhealthy" {
+						childState = "unhealthy"
+					}
+
 					dc.Children = append(dc.Children, dockerContainer{
 						Name:      deriveDockerContainerName(child, formatNames),
 						StateText: child.Status,
-						StateIcon: dockerContainerStateToStateIcon(strings.ToLower(child.State)),
+						StateIcon: dockerContainerStateToStateIcon(childState),
 					})
 				}
 			}
@@ -204,7 +283,7 @@ func fetchDockerContainers(
 			}
 		}
 		if !stateIconSupersededByChild {
-			dc.StateIcon = dockerContainerStateToStateIcon(dc.State)
+			dc.StateIcon = dockerContainerStateToStateIcon(ternary(dc.Health == "unhealthy", "unhealthy", dc.State))
 		}
 
 		dockerContainers = append(dockerContainers, dc)
@@ -278,46 +357,93 @@ func isDockerContainerHidden(container *dockerContainerJsonResponse, hideByDefau
 	return hideByDefault
 }
 
+// Returns the client along with the base URL that requests should be sent to.
+// Remote daemons protected by TLS can be reached through https:// or through
+// tcp:// with the certificates set
+func newDockerClient(source string, tlsOptions *dockerTLSOptions) (*http.Client, string, error) {
+	useTLS := strings.HasPrefix(source, "https://") ||
+		(strings.HasPrefix(source, "tcp://") && (tlsOptions.CA != "" || tlsOptions.Cert != ""))
 
-func fetchDockerContainersFromSource(
-	source string,
-	category string,
-	runningOnly bool,
-	labelOverrides map[string]map[string]string,
-) ([]dockerContainerJsonResponse, error) {
-	var hostname string
+	if !useTLS && !strings.HasPrefix(source, "tcp://") && !strings.HasPrefix(source, "http://") {
+		return &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+					return net.Dial("unix", source)
+				},
+			},
+		}, "http://docker", nil
+	}
+
+	parsed, err := url.Parse(source)
+	if err != nil {
+		return nil, "", fmt.Errorf("parsing sock-path: %v", err)
+	}
 
-	var client *http.Client
-	if strings.HasPrefix(source, "tcp://") || strings.HasPrefix(source, "http://") {
-		client = &http.Client{}
-		parsed, err := url.Parse(source)
+	port := parsed.Port()
+	if port == "" {
+		port = ternary(useTLS, "2376", "80")
+	}
+
+	hostname := parsed.Hostname() + ":" + port
+
+	if !useTLS {
+		return &http.Client{}, "http://" + hostname, nil
+	}
+
+	tlsConfig, err := tlsOptions.config()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}, "https://" + hostname, nil
+}
+
+func (o *dockerTLSOptions) config() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: o.AllowInsecure}
+
+	if o.CA != "" {
+		contents, err := os.ReadFile(o.CA)
 		if err != nil {
-			return nil, fmt.Errorf("parsing URL: %w", err)
+			return nil, fmt.Errorf("reading tls ca: %v", err)
 		}
 
-		port := parsed.Port()
-		if port == "" {
-			port = "80"
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(contents) {
+			return nil, fmt.Errorf("no certificates found in tls ca %s", o.CA)
 		}
+	}
 
-		hostname = parsed.Hostname() + ":" + port
-	} else {
-		hostname = "docker"
-		client = &http.Client{
-			Transport: &http.Transport{
-				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-					return net.Dial("unix", source)
-				},
-			},
+	if (o.Cert == "") != (o.Key == "") {
+		return nil, errors.New("both tls cert and key must be set")
+	}
+
+	if o.Cert != "" {
+		certificate, err := tls.LoadX509KeyPair(o.Cert, o.Key)
+		if err != nil {
+			return nil, fmt.Errorf("loading tls cert and key: %v", err)
 		}
+
+		config.Certificates = []tls.Certificate{certificate}
 	}
 
+	return config, nil
+}
 
+func fetchDockerContainersFromSource(
+	client *http.Client,
+	baseURL string,
+	category string,
+	runningOnly bool,
+	labelFilters map[string]string,
+	labelOverrides map[string]map[string]string,
+) ([]dockerContainerJsonResponse, error) {
 	fetchAll := ternary(runningOnly, "false", "true")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	request, err := http.NewRequestWithContext(ctx, "GET", "http://"+hostname+"/containers/json?all="+fetchAll, nil)
+	request, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/containers/json?all="+fetchAll, nil)
 	if err != nil {
 		return nil, fmt.Errorf("creating request: %w", err)
 	}
@@ -375,5 +501,164 @@ func fetchDockerContainersFromSource(
 		containers = filtered
 	}
 
+	if len(labelFilters) > 0 {
+		filtered := make([]dockerContainerJsonResponse, 0, len(containers))
+
+		for i := range containers {
+			if dockerContainerMatchesLabelFilters(containers[i].Labels, labelFilters) {
+				filtered = append(filtered, containers[i])
+			}
+		}
+
+		containers = filtered
+	}
+
 	return containers, nil
 }
+
+// An empty value only requires the label to be present
+func dockerContainerMatchesLabelFilters(labels dockerContainerLabels, filters map[string]string) bool {
+	for label, expected := range filters {
+		value, exists := labels[label]
+		if !exists || (expected != "" && value != expected) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Containers without the label are put in a group of their own at the end
+func groupDockerContainersByLabel(containers dockerContainerList, label string) []dockerContainerGroup {
+	groups := make([]dockerContainerGroup, 0)
+	indexes := make(map[string]int)
+
+	for i := range containers {
+		name := containers[i].labels.getOrDefault(label, "")
+
+		index, exists := indexes[name]
+		if !exists {
+			index = len(groups)
+			indexes[name] = index
+			groups = append(groups, dockerContainerGroup{Name: name})
+		}
+
+		groups[index].Containers = append(groups[index].Containers, containers[i])
+	}
+
+	sort.SliceStable(groups, func(a, b int) bool {
+		if groups[a].Name == "" || groups[b].Name == "" {
+			return groups[b].Name == ""
+		}
+
+		return strings.ToLower(groups[a].Name) < strings.ToLower(groups[b].Name)
+	})
+
+	if len(groups) > 0 && groups[len(groups)-1].Name == "" {
+		groups[len(groups)-1].Name = "Other"
+	}
+
+	return groups
+}
+
+type dockerContainerCPUStatsJson struct {
+	CPUUsage struct {
+		TotalUsage  uint64   `json:"total_usage"`
+		PercpuUsage []uint64 `json:"percpu_usage"`
+	} `json:"cpu_usage"`
+	SystemCPUUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs     int    `json:"online_cpus"`
+}
+
+type dockerContainerStatsJsonResponse struct {
+	CPUStats    dockerContainerCPUStatsJson `json:"cpu_stats"`
+	PreCPUStats dockerContainerCPUStatsJson `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage uint64 `json:"usage"`
+		Stats struct {
+			InactiveFile      uint64 `json:"inactive_file"`
+			TotalInactiveFile uint64 `json:"total_inactive_file"`
+		} `json:"stats"`
+	} `json:"memory_stats"`
+}
+
+// Same as what `docker stats` shows, the CPU usage can go above 100% when more
+// than one core is being used
+func (stats *dockerContainerStatsJsonResponse) cpuPercent() float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemCPUUsage) - float64(stats.PreCPUStats.SystemCPUUsage)
+
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+
+	cpus := stats.CPUStats.OnlineCPUs
+	if cpus == 0 {
+		cpus = max(1, len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+
+	return cpuDelta / systemDelta * float64(cpus) * 100
+}
+
+// The page cache is counted in the usage, but can be reclaimed at any time so
+// it's left out, the stat has a different name on cgroup v1 and v2
+func (stats *dockerContainerStatsJsonResponse) memoryUsage() uint64 {
+	memory := &stats.MemoryStats
+	inactive := ternary(memory.Stats.InactiveFile > 0, memory.Stats.InactiveFile, memory.Stats.TotalInactiveFile)
+
+	if inactive > memory.Usage {
+		return memory.Usage
+	}
+
+	return memory.Usage - inactive
+}
+
+func fetchDockerContainersStats(client *http.Client, baseURL string, containers dockerContainerList) error {
+	running := make([]*dockerContainer, 0, len(containers))
+
+	for i := range containers {
+		if containers[i].State == "running" && containers[i].id != "" {
+			running = append(running, &containers[i])
+		}
+	}
+
+	if len(running) == 0 {
+		return nil
+	}
+
+	// without one-shot, docker waits for a second sample so that the CPU usage
+	// can be calculated, which is why this has a longer timeout
+	task := func(container *dockerContainer) (dockerContainerStatsJsonResponse, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		request, _ := http.NewRequestWithContext(ctx, "GET", baseURL+"/containers/"+container.id+"/stats?stream=false", nil)
+		return decodeJsonFromRequest[dockerContainerStatsJsonResponse](client, request)
+	}
+
+	job := newJob(task, running).withWorkers(10)
+	results, errs, err := workerPoolDo(job)
+	if err != nil {
+		return fmt.Errorf("%w: fetching container stats: %v", errPartialContent, err)
+	}
+
+	var failed int
+
+	for i := range results {
+		if errs[i] != nil {
+			failed++
+			slog.Error("Failed to fetch docker container stats", "container", running[i].Name, "error", errs[i])
+			continue
+		}
+
+		running[i].HasStats = true
+		running[i].CPUPercent = results[i].cpuPercent()
+		running[i].MemoryMB = results[i].memoryUsage() / 1_000_000
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%w: could not fetch the stats of %d containers", errPartialContent, failed)
+	}
+
+	return nil
+}
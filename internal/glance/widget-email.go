@@ -0,0 +1,278 @@
+package glance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"mime"
+	"net"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var emailWidgetTemplate = mustParseTemplate("email.html", "widget-base.html")
+
+type emailWidget struct {
+	widgetBase    `yaml:",inline"`
+	Host          string              `yaml:"host"`
+	Port          uint16              `yaml:"port"`
+	Security      string              `yaml:"security"`
+	AllowInsecure bool                `yaml:"allow-insecure"`
+	Username      string              `yaml:"username"`
+	Password      string              `yaml:"password"`
+	Folders       []emailFolderConfig `yaml:"folders"`
+	Limit         int                 `yaml:"limit"`
+	CollapseAfter int                 `yaml:"collapse-after"`
+
+	Mailbox []emailFolder `yaml:"-"`
+}
+
+type emailFolderConfig struct {
+	Name       string `yaml:"name"`
+	Title      string `yaml:"title"`
+	Limit      int    `yaml:"limit"`
+	UnreadOnly bool   `yaml:"unread-only"`
+}
+
+func (f *emailFolderConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&f.Name)
+	}
+
+	type alias emailFolderConfig
+	return node.Decode((*alias)(f))
+}
+
+type emailFolder struct {
+	Title    string
+	Total    int
+	Unread   int
+	Messages []emailMessage
+	Error    error
+}
+
+type emailMessage struct {
+	From       string
+	FromEmail  string
+	Subject    string
+	ReceivedAt time.Time
+	Unread     bool
+}
+
+func (widget *emailWidget) initialize() error {
+	widget.withTitle("Email").withCacheDuration(5 * time.Minute)
+
+	if widget.Host == "" {
+		return errors.New("host is required")
+	}
+
+	if widget.Username == "" || widget.Password == "" {
+		return errors.New("username and password are required")
+	}
+
+	switch widget.Security {
+	case "":
+		widget.Security = "tls"
+	case "tls", "starttls", "none":
+	default:
+		return fmt.Errorf("invalid security %q, expected tls, starttls or none", widget.Security)
+	}
+
+	if widget.Port == 0 {
+		widget.Port = ternary[uint16](widget.Security == "tls", 993, 143)
+	}
+
+	if len(widget.Folders) == 0 {
+		widget.Folders = []emailFolderConfig{{Name: "INBOX"}}
+	}
+
+	if widget.Limit <= 0 {
+		widget.Limit = 5
+	}
+
+	if widget.CollapseAfter == 0 || widget.CollapseAfter < -1 {
+		widget.CollapseAfter = 5
+	}
+
+	for i := range widget.Folders {
+		folder := &widget.Folders[i]
+
+		if folder.Name == "" {
+			return fmt.Errorf("folder #%d has no name", i+1)
+		}
+
+		if folder.Title == "" {
+			folder.Title = ternary(strings.EqualFold(folder.Name, "INBOX"), "Inbox", folder.Name)
+		}
+
+		if folder.Limit <= 0 {
+			folder.Limit = widget.Limit
+		}
+	}
+
+	return nil
+}
+
+func (widget *emailWidget) update(ctx context.Context) {
+	folders, err := widget.fetchMailbox(ctx)
+
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Mailbox = folders
+}
+
+func (widget *emailWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, emailWidgetTemplate)
+}
+
+func (widget *emailWidget) fetchMailbox(ctx context.Context) ([]emailFolder, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	address := net.JoinHostPort(widget.Host, strconv.Itoa(int(widget.Port)))
+	conn, err := dialIMAP(ctx, address, widget.Security, widget.AllowInsecure)
+	if err != nil {
+		return nil, fmt.Errorf("%w: connecting to %s: %v", errNoContent, address, err)
+	}
+	defer conn.Close()
+
+	if err := conn.login(widget.Username, widget.Password); err != nil {
+		return nil, fmt.Errorf("%w: logging in: %v", errNoContent, err)
+	}
+
+	folders := make([]emailFolder, len(widget.Folders))
+	var failed int
+
+	// commands have to be sent one after the other over a single connection,
+	// so unlike most widgets the folders aren't fetched in parallel
+	for i := range widget.Folders {
+		folders[i] = fetchEmailFolder(conn, &widget.Folders[i])
+
+		if folders[i].Error != nil {
+			failed++
+			slog.Error("Failed to fetch email folder", "host", widget.Host, "folder", widget.Folders[i].Name, "error", folders[i].Error)
+		}
+	}
+
+	if failed == len(folders) {
+		return nil, fmt.Errorf("%w: %v", errNoContent, folders[0].Error)
+	}
+
+	if failed > 0 {
+		return folders, fmt.Errorf("%w: could not fetch %d folders", errPartialContent, failed)
+	}
+
+	return folders, nil
+}
+
+func fetchEmailFolder(conn *imapConn, config *emailFolderConfig) emailFolder {
+	folder := emailFolder{Title: config.Title}
+
+	total, unread, err := conn.status(config.Name)
+	if err != nil {
+		folder.Error = fmt.Errorf("getting status: %v", err)
+		return folder
+	}
+
+	folder.Total = total
+	folder.Unread = unread
+
+	if total == 0 || (config.UnreadOnly && unread == 0) {
+		return folder
+	}
+
+	if err := conn.examine(config.Name); err != nil {
+		folder.Error = fmt.Errorf("selecting folder: %v", err)
+		return folder
+	}
+
+	var seqSet string
+
+	if config.UnreadOnly {
+		numbers, err := conn.search("UNSEEN")
+		if err != nil {
+			folder.Error = fmt.Errorf("searching unread messages: %v", err)
+			return folder
+		}
+
+		if len(numbers) > config.Limit {
+			numbers = numbers[len(numbers)-config.Limit:]
+		}
+
+		parts := make([]string, len(numbers))
+		for i := range numbers {
+			parts[i] = strconv.Itoa(numbers[i])
+		}
+		seqSet = strings.Join(parts, ",")
+	} else {
+		seqSet = fmt.Sprintf("%d:%d", max(1, total-config.Limit+1), total)
+	}
+
+	if seqSet == "" {
+		return folder
+	}
+
+	fetched, err := conn.fetchHeaders(seqSet, "FROM", "SUBJECT", "DATE")
+	if err != nil {
+		folder.Error = fmt.Errorf("fetching messages: %v", err)
+		return folder
+	}
+
+	// higher sequence numbers are the more recently received messages
+	slices.SortFunc(fetched, func(a, b imapFetchedMessage) int {
+		return b.seqNum - a.seqNum
+	})
+
+	folder.Messages = make([]emailMessage, 0, len(fetched))
+	for i := range fetched {
+		folder.Messages = append(folder.Messages, parseEmailMessage(&fetched[i]))
+	}
+
+	return folder
+}
+
+var emailWordDecoder = &mime.WordDecoder{}
+
+func parseEmailMessage(fetched *imapFetchedMessage) emailMessage {
+	message := emailMessage{
+		Unread:  !slices.Contains(fetched.flags, `\Seen`),
+		Subject: "(no subject)",
+	}
+
+	// the header fields don't end with an empty line when fetched on their own
+	parsed, err := mail.ReadMessage(bytes.NewReader(append(bytes.TrimRight(fetched.header, "\r\n"), "\r\n\r\n"...)))
+	if err != nil {
+		return message
+	}
+
+	if subject := parsed.Header.Get("Subject"); subject != "" {
+		if decoded, err := emailWordDecoder.DecodeHeader(subject); err == nil {
+			subject = decoded
+		}
+
+		message.Subject = strings.TrimSpace(subject)
+	}
+
+	if from, err := mail.ParseAddress(parsed.Header.Get("From")); err == nil {
+		message.From = ternary(from.Name != "", from.Name, from.Address)
+		message.FromEmail = from.Address
+	} else {
+		message.From = parsed.Header.Get("From")
+	}
+
+	if date, err := parsed.Header.Date(); err == nil {
+		message.ReceivedAt = date
+	}
+
+	return message
+}
@@ -0,0 +1,583 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var energyWidgetTemplate = mustParseTemplate("energy.html", "widget-base.html")
+
+const (
+	energyServiceSolarEdge     = "solaredge"
+	energyServiceFronius       = "fronius"
+	energyServiceShelly        = "shelly"
+	energyServiceHomeAssistant = "home-assistant"
+)
+
+type energyWidget struct {
+	widgetBase        `yaml:",inline"`
+	Service           string        `yaml:"service"`
+	URL               string        `yaml:"url"`
+	AllowInsecure     bool          `yaml:"allow-insecure"`
+	SiteID            string        `yaml:"site-id"`
+	APIKey            string        `yaml:"api-key"`
+	Token             string        `yaml:"token"`
+	Sensors           energySensors `yaml:"sensors"`
+	ProductionChannel *int          `yaml:"production-channel"`
+	Status            *energyStatus `yaml:"-"`
+}
+
+type energySensors struct {
+	Production    string `yaml:"production"`
+	Consumption   string `yaml:"consumption"`
+	Grid          string `yaml:"grid"`
+	Battery       string `yaml:"battery"`
+	BatteryLevel  string `yaml:"battery-level"`
+	ProducedToday string `yaml:"produced-today"`
+	ConsumedToday string `yaml:"consumed-today"`
+	ImportedToday string `yaml:"imported-today"`
+	ExportedToday string `yaml:"exported-today"`
+}
+
+// Power is in watts and energy in watt-hours. Values which the service
+// doesn't provide are left as nil.
+type energyStatus struct {
+	Production  *float64
+	Consumption *float64
+	// Positive when importing from the grid, negative when exporting
+	Grid *float64
+	// Positive when discharging, negative when charging
+	Battery      *float64
+	BatteryLevel *float64
+
+	ProducedToday *float64
+	ConsumedToday *float64
+	ImportedToday *float64
+	ExportedToday *float64
+}
+
+func (widget *energyWidget) initialize() error {
+	cacheDuration := time.Minute
+
+	switch widget.Service {
+	case energyServiceSolarEdge:
+		if widget.SiteID == "" || widget.APIKey == "" {
+			return errors.New("site-id and api-key are required for solaredge")
+		}
+
+		// the monitoring API only allows 300 requests per day
+		cacheDuration = 15 * time.Minute
+		widget.withTitleURL("https://monitoring.solaredge.com/")
+	case energyServiceFronius, energyServiceShelly:
+		if widget.URL == "" {
+			return fmt.Errorf("url is required for %s", widget.Service)
+		}
+	case energyServiceHomeAssistant:
+		if widget.URL == "" || widget.Token == "" {
+			return errors.New("url and token are required for home-assistant")
+		}
+
+		if widget.Sensors == (energySensors{}) {
+			return errors.New("at least one sensor is required for home-assistant")
+		}
+	default:
+		return fmt.Errorf(
+			"service must be one of: %s, %s, %s, %s",
+			energyServiceSolarEdge, energyServiceFronius, energyServiceShelly, energyServiceHomeAssistant,
+		)
+	}
+
+	widget.URL = strings.TrimRight(widget.URL, "/")
+	widget.withTitle("能源").withCacheDuration(cacheDuration)
+
+	return nil
+}
+
+func (widget *energyWidget) update(ctx context.Context) {
+	var status *energyStatus
+	var err error
+
+	client := widget.httpClient(ternary(widget.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient))
+
+	switch widget.Service {
+	case energyServiceSolarEdge:
+		status, err = fetchSolarEdgeEnergyStatus(ctx, client, widget.SiteID, widget.APIKey)
+	case energyServiceFronius:
+		status, err = fetchFroniusEnergyStatus(ctx, client, widget.URL)
+	case energyServiceShelly:
+		status, err = fetchShellyEnergyStatus(ctx, client, widget.URL, widget.ProductionChannel)
+	case energyServiceHomeAssistant:
+		status, err = fetchHomeAssistantEnergyStatus(ctx, client, widget.URL, widget.Token, &widget.Sensors)
+	}
+
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	status.fillDerivedValues()
+	widget.Status = status
+}
+
+func (widget *energyWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, energyWidgetTemplate)
+}
+
+// Whatever isn't reported directly can usually be worked out from the rest,
+// since everything that flows into the house has to flow out of it too
+func (s *energyStatus) fillDerivedValues() {
+	battery := 0.0
+	if s.Battery != nil {
+		battery = *s.Battery
+	}
+
+	if s.Consumption == nil && s.Production != nil && s.Grid != nil {
+		s.Consumption = floatPtr(math.Max(0, *s.Production+*s.Grid+battery))
+	} else if s.Grid == nil && s.Production != nil && s.Consumption != nil {
+		s.Grid = floatPtr(*s.Consumption - *s.Production - battery)
+	} else if s.Production == nil && s.Consumption != nil && s.Grid != nil {
+		s.Production = floatPtr(math.Max(0, *s.Consumption-*s.Grid-battery))
+	}
+
+	if s.ConsumedToday == nil && s.ProducedToday != nil && s.ImportedToday != nil && s.ExportedToday != nil {
+		s.ConsumedToday = floatPtr(math.Max(0, *s.ProducedToday+*s.ImportedToday-*s.ExportedToday))
+	}
+}
+
+func (s *energyStatus) HasBattery() bool {
+	return s.Battery != nil || s.BatteryLevel != nil
+}
+
+func (s *energyStatus) HasToday() bool {
+	return s.ProducedToday != nil || s.ImportedToday != nil || s.ExportedToday != nil
+}
+
+func (s *energyStatus) HasBalance() bool {
+	return s.ImportedToday != nil && s.ExportedToday != nil
+}
+
+// The share of today's consumption that was covered without importing from the grid
+func (s *energyStatus) SelfSufficiencyPercent() int {
+	if s.ConsumedToday == nil || s.ImportedToday == nil || *s.ConsumedToday <= 0 {
+		return -1
+	}
+
+	return int(math.Round(math.Max(0, math.Min(1, 1 - *s.ImportedToday / *s.ConsumedToday)) * 100))
+}
+
+func (s *energyStatus) BalanceToday() float64 {
+	return *s.ExportedToday - *s.ImportedToday
+}
+
+func formatPower(watts *float64) string {
+	if watts == nil {
+		return "-"
+	}
+
+	value := math.Abs(*watts)
+	if value < 1000 {
+		return strconv.Itoa(int(math.Round(value))) + " W"
+	}
+
+	return strconv.FormatFloat(value/1000, 'f', ternary(value < 10_000, 2, 1), 64) + " kW"
+}
+
+func formatEnergy(wattHours *float64) string {
+	if wattHours == nil {
+		return "-"
+	}
+
+	value := math.Abs(*wattHours)
+	if value < 1000 {
+		return strconv.Itoa(int(math.Round(value))) + " Wh"
+	}
+
+	return strconv.FormatFloat(value/1000, 'f', 1, 64) + " kWh"
+}
+
+func (s *energyStatus) ProductionText() string    { return formatPower(s.Production) }
+func (s *energyStatus) ConsumptionText() string   { return formatPower(s.Consumption) }
+func (s *energyStatus) GridText() string          { return formatPower(s.Grid) }
+func (s *energyStatus) BatteryText() string       { return formatPower(s.Battery) }
+func (s *energyStatus) ProducedTodayText() string { return formatEnergy(s.ProducedToday) }
+func (s *energyStatus) ConsumedTodayText() string { return formatEnergy(s.ConsumedToday) }
+func (s *energyStatus) ImportedTodayText() string { return formatEnergy(s.ImportedToday) }
+func (s *energyStatus) ExportedTodayText() string { return formatEnergy(s.ExportedToday) }
+
+func (s *energyStatus) BalanceTodayText() string {
+	balance := s.BalanceToday()
+	return ternary(balance >= 0, "+", "-") + formatEnergy(&balance)
+}
+
+func (s *energyStatus) GridDirection() string {
+	switch {
+	case s.Grid == nil || math.Abs(*s.Grid) < 1:
+		return "idle"
+	case *s.Grid > 0:
+		return "importing"
+	default:
+		return "exporting"
+	}
+}
+
+func (s *energyStatus) BatteryDirection() string {
+	switch {
+	case s.Battery == nil || math.Abs(*s.Battery) < 1:
+		return "idle"
+	case *s.Battery > 0:
+		return "discharging"
+	default:
+		return "charging"
+	}
+}
+
+func (s *energyStatus) BatteryLevelPercent() int {
+	if s.BatteryLevel == nil {
+		return -1
+	}
+
+	return int(math.Round(*s.BatteryLevel))
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+type solarEdgePowerFlowResponseJson struct {
+	Flow struct {
+		Unit        string `json:"unit"`
+		Connections []struct {
+			From string `json:"from"`
+			To   string `json:"to"`
+		} `json:"connections"`
+		Grid    *solarEdgeFlowNodeJson `json:"GRID"`
+		Load    *solarEdgeFlowNodeJson `json:"LOAD"`
+		PV      *solarEdgeFlowNodeJson `json:"PV"`
+		Storage *solarEdgeFlowNodeJson `json:"STORAGE"`
+	} `json:"siteCurrentPowerFlow"`
+}
+
+type solarEdgeFlowNodeJson struct {
+	Status       string   `json:"status"`
+	CurrentPower float64  `json:"currentPower"`
+	ChargeLevel  *float64 `json:"chargeLevel"`
+}
+
+type solarEdgeEnergyDetailsResponseJson struct {
+	Details struct {
+		Meters []struct {
+			Type   string `json:"type"`
+			Values []struct {
+				Value *float64 `json:"value"`
+			} `json:"values"`
+		} `json:"meters"`
+	} `json:"energyDetails"`
+}
+
+func fetchSolarEdgeEnergyStatus(ctx context.Context, client requestDoer, siteID, apiKey string) (*energyStatus, error) {
+	baseURL := "https://monitoringapi.solaredge.com/site/" + url.PathEscape(siteID)
+
+	request, _ := http.NewRequestWithContext(ctx, "GET", baseURL+"/currentPowerFlow?api_key="+url.QueryEscape(apiKey), nil)
+	flowResponse, err := decodeJsonFromRequest[solarEdgePowerFlowResponseJson](client, request)
+	if err != nil {
+		return nil, fmt.Errorf("fetching power flow: %v", err)
+	}
+
+	flow := &flowResponse.Flow
+	multiplier := ternary(strings.EqualFold(flow.Unit, "kW"), 1000.0, 1.0)
+	status := &energyStatus{}
+
+	if flow.PV != nil {
+		status.Production = floatPtr(flow.PV.CurrentPower * multiplier)
+	}
+
+	if flow.Load != nil {
+		status.Consumption = floatPtr(flow.Load.CurrentPower * multiplier)
+	}
+
+	// the direction of the power is only given through the connections between the nodes
+	if flow.Grid != nil {
+		grid := flow.Grid.CurrentPower * multiplier
+		for _, connection := range flow.Connections {
+			if strings.EqualFold(connection.To, "grid") {
+				grid = -grid
+				break
+			}
+		}
+		status.Grid = &grid
+	}
+
+	if flow.Storage != nil {
+		battery := flow.Storage.CurrentPower * multiplier
+		if strings.EqualFold(flow.Storage.Status, "charging") {
+			battery = -battery
+		}
+		status.Battery = &battery
+		status.BatteryLevel = flow.Storage.ChargeLevel
+	}
+
+	now := time.Now()
+	query := url.Values{
+		"api_key":   {apiKey},
+		"meters":    {"PRODUCTION,CONSUMPTION,FEEDIN,PURCHASED"},
+		"timeUnit":  {"DAY"},
+		"startTime": {now.Format("2006-01-02") + " 00:00:00"},
+		"endTime":   {now.Format("2006-01-02") + " 23:59:59"},
+	}
+
+	request, _ = http.NewRequestWithContext(ctx, "GET", baseURL+"/energyDetails?"+query.Encode(), nil)
+	details, err := decodeJsonFromRequest[solarEdgeEnergyDetailsResponseJson](client, request)
+	if err != nil {
+		return status, fmt.Errorf("%w: fetching energy details: %v", errPartialContent, err)
+	}
+
+	for _, meter := range details.Details.Meters {
+		if len(meter.Values) == 0 || meter.Values[0].Value == nil {
+			continue
+		}
+
+		value := meter.Values[0].Value
+		switch strings.ToLower(meter.Type) {
+		case "production":
+			status.ProducedToday = value
+		case "consumption":
+			status.ConsumedToday = value
+		case "feedin":
+			status.ExportedToday = value
+		case "purchased":
+			status.ImportedToday = value
+		}
+	}
+
+	return status, nil
+}
+
+type froniusPowerFlowResponseJson struct {
+	Body struct {
+		Data struct {
+			Site struct {
+				Grid    *float64 `json:"P_Grid"`
+				Load    *float64 `json:"P_Load"`
+				PV      *float64 `json:"P_PV"`
+				Battery *float64 `json:"P_Akku"`
+				EDay    *float64 `json:"E_Day"`
+			} `json:"Site"`
+			Inverters map[string]struct {
+				SOC *float64 `json:"SOC"`
+			} `json:"Inverters"`
+		} `json:"Data"`
+	} `json:"Body"`
+}
+
+func fetchFroniusEnergyStatus(ctx context.Context, client requestDoer, baseURL string) (*energyStatus, error) {
+	request, _ := http.NewRequestWithContext(ctx, "GET", baseURL+"/solar_api/v1/GetPowerFlowRealtimeData.fcgi", nil)
+	response, err := decodeJsonFromRequest[froniusPowerFlowResponseJson](client, request)
+	if err != nil {
+		return nil, fmt.Errorf("fetching power flow: %v", err)
+	}
+
+	site := &response.Body.Data.Site
+	status := &energyStatus{
+		Grid:          site.Grid,
+		Battery:       site.Battery,
+		ProducedToday: site.EDay,
+		Production:    floatPtr(0),
+	}
+
+	// P_PV is null rather than 0 during the night
+	if site.PV != nil {
+		status.Production = site.PV
+	}
+
+	// the load is reported as a negative value
+	if site.Load != nil {
+		status.Consumption = floatPtr(-*site.Load)
+	}
+
+	for _, inverter := range response.Body.Data.Inverters {
+		if inverter.SOC != nil {
+			status.BatteryLevel = inverter.SOC
+			break
+		}
+	}
+
+	return status, nil
+}
+
+type shellyGen1StatusResponseJson struct {
+	Emeters []struct {
+		Power float64 `json:"power"`
+	} `json:"emeters"`
+}
+
+func fetchShellyEnergyStatus(ctx context.Context, client requestDoer, baseURL string, productionChannel *int) (*energyStatus, error) {
+	powers, err := fetchShellyGen2Powers(ctx, client, baseURL)
+	if err != nil {
+		// older devices don't have the RPC API
+		request, _ := http.NewRequestWithContext(ctx, "GET", baseURL+"/status", nil)
+		response, gen1Err := decodeJsonFromRequest[shellyGen1StatusResponseJson](client, request)
+		if gen1Err != nil {
+			return nil, fmt.Errorf("fetching status: %v", gen1Err)
+		}
+
+		powers = make([]float64, len(response.Emeters))
+		for i := range response.Emeters {
+			powers[i] = response.Emeters[i].Power
+		}
+	}
+
+	if len(powers) == 0 {
+		return nil, errors.New("device doesn't report any energy meters")
+	}
+
+	// every channel other than the one measuring production is assumed to be
+	// measuring the grid connection, which is how 3 phase meters are set up
+	status := &energyStatus{Grid: floatPtr(0)}
+
+	for i := range powers {
+		if productionChannel != nil && *productionChannel == i {
+			status.Production = floatPtr(math.Abs(powers[i]))
+		} else {
+			*status.Grid += powers[i]
+		}
+	}
+
+	if productionChannel != nil && status.Production == nil {
+		return nil, fmt.Errorf("device doesn't have a channel %d", *productionChannel)
+	}
+
+	return status, nil
+}
+
+func fetchShellyGen2Powers(ctx context.Context, client requestDoer, baseURL string) ([]float64, error) {
+	request, _ := http.NewRequestWithContext(ctx, "GET", baseURL+"/rpc/Shelly.GetStatus", nil)
+	response, err := decodeJsonFromRequest[map[string]map[string]any](client, request)
+	if err != nil {
+		return nil, err
+	}
+
+	powers := make([]float64, 0)
+
+	// Pro 3EM reports all phases together as em:0, Pro EM reports each channel as em1:N
+	if em, exists := response["em:0"]; exists {
+		if power, ok := em["total_act_power"].(float64); ok {
+			return append(powers, power), nil
+		}
+	}
+
+	for i := 0; ; i++ {
+		channel, exists := response["em1:"+strconv.Itoa(i)]
+		if !exists {
+			break
+		}
+
+		power, _ := channel["act_power"].(float64)
+		powers = append(powers, power)
+	}
+
+	return powers, nil
+}
+
+type homeAssistantStateResponseJson struct {
+	State      string `json:"state"`
+	Attributes struct {
+		Unit string `json:"unit_of_measurement"`
+	} `json:"attributes"`
+}
+
+func fetchHomeAssistantEnergyStatus(
+	ctx context.Context,
+	client requestDoer,
+	baseURL string,
+	token string,
+	sensors *energySensors,
+) (*energyStatus, error) {
+	status := &energyStatus{}
+
+	targets := []struct {
+		entity string
+		value  **float64
+	}{
+		{sensors.Production, &status.Production},
+		{sensors.Consumption, &status.Consumption},
+		{sensors.Grid, &status.Grid},
+		{sensors.Battery, &status.Battery},
+		{sensors.BatteryLevel, &status.BatteryLevel},
+		{sensors.ProducedToday, &status.ProducedToday},
+		{sensors.ConsumedToday, &status.ConsumedToday},
+		{sensors.ImportedToday, &status.ImportedToday},
+		{sensors.ExportedToday, &status.ExportedToday},
+	}
+
+	requests := make([]*http.Request, 0, len(targets))
+	for i := range targets {
+		if targets[i].entity == "" {
+			continue
+		}
+
+		request, _ := http.NewRequestWithContext(ctx, "GET", baseURL+"/api/states/"+url.PathEscape(targets[i].entity), nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		requests = append(requests, request)
+	}
+
+	job := newJob(decodeJsonFromRequestTask[homeAssistantStateResponseJson](client), requests)
+	states, errs, err := workerPoolDo(job)
+	if err != nil {
+		return nil, err
+	}
+
+	var failed int
+	var lastErr error
+	r := 0
+
+	for i := range targets {
+		if targets[i].entity == "" {
+			continue
+		}
+
+		state, err := states[r], errs[r]
+		r++
+
+		if err == nil {
+			*targets[i].value, err = parseHomeAssistantEnergyState(&state)
+		}
+
+		if err != nil {
+			failed++
+			lastErr = fmt.Errorf("%s: %v", targets[i].entity, err)
+		}
+	}
+
+	if failed == len(requests) {
+		return nil, lastErr
+	}
+
+	if failed > 0 {
+		return status, fmt.Errorf("%w: %v", errPartialContent, lastErr)
+	}
+
+	return status, nil
+}
+
+func parseHomeAssistantEnergyState(state *homeAssistantStateResponseJson) (*float64, error) {
+	value, err := strconv.ParseFloat(state.State, 64)
+	if err != nil {
+		return nil, fmt.Errorf("state %q is not a number", state.State)
+	}
+
+	switch state.Attributes.Unit {
+	case "kW", "kWh":
+		value *= 1000
+	case "MW", "MWh":
+		value *= 1_000_000
+	}
+
+	return &value, nil
+}
@@ -10,6 +10,7 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 )
 
@@ -17,6 +18,9 @@ var extensionWidgetTemplate = mustParseTemplate("extension.html", "widget-base.h
 
 const extensionWidgetDefaultTitle = "Extension"
 
+// Keeps extensions from getting requested on every page load
+const extensionMinRefreshInterval = 10 * time.Second
+
 type extensionWidget struct {
 	widgetBase          `yaml:",inline"`
 	URL                 string               `yaml:"url"`
@@ -43,7 +47,7 @@ func (widget *extensionWidget) initialize() error {
 }
 
 func (widget *extensionWidget) update(ctx context.Context) {
-	extension, err := fetchExtension(extensionRequestOptions{
+	extension, err := fetchExtension(widget.httpClient(defaultHTTPClient), extensionRequestOptions{
 		URL:                 widget.URL,
 		FallbackContentType: widget.FallbackContentType,
 		Parameters:          widget.Parameters,
@@ -51,6 +55,11 @@ func (widget *extensionWidget) update(ctx context.Context) {
 		AllowHtml:           widget.AllowHtml,
 	})
 
+	// the cache duration from the config takes precedence over the one requested by the extension
+	if extension.RefreshInterval > 0 && widget.CustomCacheDuration == 0 {
+		widget.cacheDuration = extension.RefreshInterval
+	}
+
 	widget.canContinueUpdateAfterHandlingErr(err)
 
 	widget.Extension = extension
@@ -86,6 +95,7 @@ const (
 	extensionHeaderTitleURL         = "Widget-Title-URL"
 	extensionHeaderContentType      = "Widget-Content-Type"
 	extensionHeaderContentFrameless = "Widget-Content-Frameless"
+	extensionHeaderRefreshInterval  = "Widget-Refresh-Interval"
 )
 
 type extensionRequestOptions struct {
@@ -97,10 +107,11 @@ type extensionRequestOptions struct {
 }
 
 type extension struct {
-	Title     string
-	TitleURL  string
-	Content   template.HTML
-	Frameless bool
+	Title           string
+	TitleURL        string
+	Content         template.HTML
+	Frameless       bool
+	RefreshInterval time.Duration
 }
 
 func convertExtensionContent(options extensionRequestOptions, content []byte, contentType extensionType) template.HTML {
@@ -116,7 +127,7 @@ func convertExtensionContent(options extensionRequestOptions, content []byte, co
 	}
 }
 
-func fetchExtension(options extensionRequestOptions) (extension, error) {
+func fetchExtension(client requestDoer, options extensionRequestOptions) (extension, error) {
 	request, _ := http.NewRequest("GET", options.URL, nil)
 	if len(options.Parameters) > 0 {
 		request.URL.RawQuery = options.Parameters.toQueryString()
@@ -126,7 +137,7 @@ func fetchExtension(options extensionRequestOptions) (extension, error) {
 		request.Header.Add(key, value)
 	}
 
-	response, err := http.DefaultClient.Do(request)
+	response, err := client.Do(request)
 	if err != nil {
 		slog.Error("Failed fetching extension", "url", options.URL, "error", err)
 		return extension{}, fmt.Errorf("%w: request failed: %w", errNoContent, err)
@@ -140,6 +151,11 @@ func fetchExtension(options extensionRequestOptions) (extension, error) {
 		return extension{}, fmt.Errorf("%w: could not read body: %w", errNoContent, err)
 	}
 
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		slog.Error("Extension returned an unexpected status code", "url", options.URL, "status", response.StatusCode)
+		return extension{}, fmt.Errorf("%w: unexpected status code %d", errNoContent, response.StatusCode)
+	}
+
 	extension := extension{}
 
 	if response.Header.Get(extensionHeaderTitle) == "" {
@@ -166,7 +182,38 @@ func fetchExtension(options extensionRequestOptions) (extension, error) {
 		extension.Frameless = true
 	}
 
+	if value := response.Header.Get(extensionHeaderRefreshInterval); value != "" {
+		interval, err := parseExtensionRefreshInterval(value)
+		if err != nil {
+			slog.Warn("Ignoring invalid refresh interval of extension", "url", options.URL, "value", value)
+		} else {
+			extension.RefreshInterval = max(interval, extensionMinRefreshInterval)
+		}
+	}
+
 	extension.Content = convertExtensionContent(options, body, contentType)
 
 	return extension, nil
 }
+
+// Accepts either a number of seconds or a duration such as 5m
+func parseExtensionRefreshInterval(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0, errors.New("interval must be positive")
+		}
+
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if interval <= 0 {
+		return 0, errors.New("interval must be positive")
+	}
+
+	return interval, nil
+}
@@ -0,0 +1,371 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var fireflyWidgetTemplate = mustParseTemplate("firefly.html", "widget-base.html")
+
+// Budgets which are at least this much spent get a warning before going over
+const fireflyBudgetWarningPercent = 90
+
+type fireflyWidget struct {
+	widgetBase        `yaml:",inline"`
+	URL               string         `yaml:"url"`
+	Token             string         `yaml:"token"`
+	AllowInsecure     bool           `yaml:"allow-insecure"`
+	TransactionsLimit int            `yaml:"transactions-limit"`
+	BillsLimit        int            `yaml:"bills-limit"`
+	BillsDays         int            `yaml:"bills-days"`
+	Status            *fireflyStatus `yaml:"-"`
+	client            requestDoer    `yaml:"-"`
+}
+
+type fireflyStatus struct {
+	Budgets      []fireflyBudget
+	Transactions []fireflyTransaction
+	Bills        []fireflyBill
+}
+
+type fireflyBudget struct {
+	Name           string
+	CurrencySymbol string
+	Spent          float64
+	Budgeted       float64
+	Percent        int
+}
+
+type fireflyTransaction struct {
+	Description    string
+	Type           string
+	Category       string
+	CurrencySymbol string
+	Amount         float64
+	Date           time.Time
+	URL            string
+}
+
+type fireflyBill struct {
+	Name           string
+	CurrencySymbol string
+	Amount         float64
+	Due            time.Time
+}
+
+type fireflyBudgetsResponseJson struct {
+	Data []struct {
+		ID         string `json:"id"`
+		Attributes struct {
+			Name   string `json:"name"`
+			Active bool   `json:"active"`
+			Spent  []struct {
+				Sum          string `json:"sum"`
+				CurrencyCode string `json:"currency_code"`
+			} `json:"spent"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+type fireflyBudgetLimitsResponseJson struct {
+	Data []struct {
+		Attributes struct {
+			BudgetID       string `json:"budget_id"`
+			Amount         string `json:"amount"`
+			CurrencyCode   string `json:"currency_code"`
+			CurrencySymbol string `json:"currency_symbol"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+type fireflyTransactionsResponseJson struct {
+	Data []struct {
+		ID         string `json:"id"`
+		Attributes struct {
+			GroupTitle   string `json:"group_title"`
+			Transactions []struct {
+				Type           string    `json:"type"`
+				Date           time.Time `json:"date"`
+				Amount         string    `json:"amount"`
+				Description    string    `json:"description"`
+				CategoryName   string    `json:"category_name"`
+				CurrencySymbol string    `json:"currency_symbol"`
+			} `json:"transactions"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+type fireflyBillsResponseJson struct {
+	Data []struct {
+		Attributes struct {
+			Name              string `json:"name"`
+			Active            bool   `json:"active"`
+			AmountMin         string `json:"amount_min"`
+			AmountMax         string `json:"amount_max"`
+			CurrencySymbol    string `json:"currency_symbol"`
+			NextExpectedMatch string `json:"next_expected_match"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+func (widget *fireflyWidget) initialize() error {
+	widget.withTitle("Budget").withCacheDuration(30 * time.Minute)
+
+	if widget.URL == "" {
+		return errors.New("url is required")
+	}
+
+	if widget.Token == "" {
+		return errors.New("token is required")
+	}
+
+	widget.URL = strings.TrimRight(widget.URL, "/")
+
+	if widget.TransactionsLimit == 0 {
+		widget.TransactionsLimit = 5
+	}
+
+	if widget.BillsLimit == 0 {
+		widget.BillsLimit = 5
+	}
+
+	if widget.BillsDays <= 0 {
+		widget.BillsDays = 14
+	}
+
+	widget.client = widget.httpClient(ternary(widget.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient))
+
+	return nil
+}
+
+func (widget *fireflyWidget) update(ctx context.Context) {
+	status, err := widget.fetchStatus(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Status = status
+}
+
+func (widget *fireflyWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, fireflyWidgetTemplate)
+}
+
+func (widget *fireflyWidget) request(ctx context.Context, path string, query url.Values) *http.Request {
+	request, _ := http.NewRequestWithContext(ctx, "GET", widget.URL+"/api/v1"+path+"?"+query.Encode(), nil)
+	request.Header.Set("Authorization", "Bearer "+widget.Token)
+	request.Header.Set("Accept", "application/vnd.api+json")
+
+	return request
+}
+
+func (widget *fireflyWidget) fetchStatus(ctx context.Context) (*fireflyStatus, error) {
+	now := time.Now()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	month := url.Values{
+		"start": {monthStart.Format(time.DateOnly)},
+		"end":   {monthStart.AddDate(0, 1, -1).Format(time.DateOnly)},
+		"limit": {"100"},
+	}
+
+	var (
+		wg           sync.WaitGroup
+		budgets      fireflyBudgetsResponseJson
+		limits       fireflyBudgetLimitsResponseJson
+		transactions fireflyTransactionsResponseJson
+		bills        fireflyBillsResponseJson
+		errs         [4]error
+	)
+
+	fetch := func(i int, request *http.Request, fn func(*http.Request) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(request)
+		}()
+	}
+
+	fetch(0, widget.request(ctx, "/budgets", month), func(r *http.Request) (err error) {
+		budgets, err = decodeJsonFromRequest[fireflyBudgetsResponseJson](widget.client, r)
+		return
+	})
+	fetch(1, widget.request(ctx, "/budget-limits", month), func(r *http.Request) (err error) {
+		limits, err = decodeJsonFromRequest[fireflyBudgetLimitsResponseJson](widget.client, r)
+		return
+	})
+
+	if widget.TransactionsLimit > 0 {
+		query := url.Values{"limit": {strconv.Itoa(widget.TransactionsLimit)}}
+		fetch(2, widget.request(ctx, "/transactions", query), func(r *http.Request) (err error) {
+			transactions, err = decodeJsonFromRequest[fireflyTransactionsResponseJson](widget.client, r)
+			return
+		})
+	}
+
+	if widget.BillsLimit > 0 {
+		query := url.Values{
+			"start": {now.Format(time.DateOnly)},
+			"end":   {now.AddDate(0, 0, widget.BillsDays).Format(time.DateOnly)},
+			"limit": {"100"},
+		}
+		fetch(3, widget.request(ctx, "/bills", query), func(r *http.Request) (err error) {
+			bills, err = decodeJsonFromRequest[fireflyBillsResponseJson](widget.client, r)
+			return
+		})
+	}
+
+	wg.Wait()
+
+	if errs[0] != nil && (widget.TransactionsLimit <= 0 || errs[2] != nil) {
+		return nil, fmt.Errorf("%w: fetching budgets: %v", errNoContent, errs[0])
+	}
+
+	var partialErr error
+	for _, err := range errs {
+		if err != nil {
+			partialErr = fmt.Errorf("%w: %v", errPartialContent, err)
+			break
+		}
+	}
+
+	status := &fireflyStatus{}
+
+	if errs[0] == nil && errs[1] == nil {
+		status.Budgets = widget.combineBudgets(&budgets, &limits)
+	}
+
+	for i := range transactions.Data {
+		group := &transactions.Data[i]
+		splits := group.Attributes.Transactions
+		if len(splits) == 0 {
+			continue
+		}
+
+		transaction := fireflyTransaction{
+			Description:    ternary(group.Attributes.GroupTitle != "", group.Attributes.GroupTitle, splits[0].Description),
+			Type:           splits[0].Type,
+			Category:       splits[0].CategoryName,
+			CurrencySymbol: splits[0].CurrencySymbol,
+			Date:           splits[0].Date,
+			URL:            widget.URL + "/transactions/show/" + group.ID,
+		}
+
+		for j := range splits {
+			transaction.Amount += parseFireflyAmount(splits[j].Amount)
+		}
+
+		status.Transactions = append(status.Transactions, transaction)
+	}
+
+	for i := range bills.Data {
+		attributes := &bills.Data[i].Attributes
+		if !attributes.Active || attributes.NextExpectedMatch == "" {
+			continue
+		}
+
+		due, err := time.Parse(time.RFC3339, attributes.NextExpectedMatch)
+		if err != nil {
+			continue
+		}
+
+		if due.After(now.AddDate(0, 0, widget.BillsDays)) {
+			continue
+		}
+
+		status.Bills = append(status.Bills, fireflyBill{
+			Name:           attributes.Name,
+			CurrencySymbol: attributes.CurrencySymbol,
+			Amount:         (parseFireflyAmount(attributes.AmountMin) + parseFireflyAmount(attributes.AmountMax)) / 2,
+			Due:            due,
+		})
+	}
+
+	slices.SortFunc(status.Bills, func(a, b fireflyBill) int {
+		return a.Due.Compare(b.Due)
+	})
+
+	if len(status.Bills) > widget.BillsLimit {
+		status.Bills = status.Bills[:widget.BillsLimit]
+	}
+
+	return status, partialErr
+}
+
+// Only budgets which have an amount set for the current month are included,
+// there's nothing to compare the spending of the rest against
+func (widget *fireflyWidget) combineBudgets(budgets *fireflyBudgetsResponseJson, limits *fireflyBudgetLimitsResponseJson) []fireflyBudget {
+	combined := make([]fireflyBudget, 0, len(budgets.Data))
+
+	for i := range budgets.Data {
+		data := &budgets.Data[i]
+		if !data.Attributes.Active {
+			continue
+		}
+
+		budget := fireflyBudget{Name: data.Attributes.Name}
+		currencyCode := ""
+
+		for j := range limits.Data {
+			limit := &limits.Data[j].Attributes
+			if limit.BudgetID != data.ID {
+				continue
+			}
+
+			budget.Budgeted += parseFireflyAmount(limit.Amount)
+			budget.CurrencySymbol = limit.CurrencySymbol
+			currencyCode = limit.CurrencyCode
+		}
+
+		if budget.Budgeted <= 0 {
+			continue
+		}
+
+		for j := range data.Attributes.Spent {
+			spent := &data.Attributes.Spent[j]
+			if spent.CurrencyCode == currencyCode {
+				budget.Spent += math.Abs(parseFireflyAmount(spent.Sum))
+			}
+		}
+
+		budget.Percent = int(math.Round(budget.Spent / budget.Budgeted * 100))
+		combined = append(combined, budget)
+	}
+
+	// the ones closest to running out first
+	slices.SortStableFunc(combined, func(a, b fireflyBudget) int {
+		return b.Percent - a.Percent
+	})
+
+	return combined
+}
+
+func (budget *fireflyBudget) IsOver() bool {
+	return budget.Spent > budget.Budgeted
+}
+
+func (budget *fireflyBudget) IsNearlyOver() bool {
+	return !budget.IsOver() && budget.Percent >= fireflyBudgetWarningPercent
+}
+
+func (budget *fireflyBudget) BarPercent() int {
+	return min(budget.Percent, 100)
+}
+
+func (budget *fireflyBudget) Remaining() float64 {
+	return math.Abs(budget.Budgeted - budget.Spent)
+}
+
+func parseFireflyAmount(amount string) float64 {
+	value, _ := strconv.ParseFloat(amount, 64)
+	return value
+}
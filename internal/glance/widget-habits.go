@@ -0,0 +1,326 @@
+package glance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var habitsWidgetTemplate = mustParseTemplate("habits.html", "widget-base.html")
+
+const (
+	habitsDateFormat = "2006-01-02"
+	// Completions older than this are dropped, they'd never be shown anyway
+	habitsMaxDaysKept = 400
+)
+
+type habitsWidget struct {
+	widgetBase     `yaml:",inline"`
+	Habits         []habitConfig `yaml:"habits"`
+	FirstDayOfWeek string        `yaml:"first-day-of-week"`
+	Rows           []habitRow    `yaml:"-"`
+	firstDay       time.Weekday  `yaml:"-"`
+	mu             sync.Mutex    `yaml:"-"`
+}
+
+type habitConfig struct {
+	Name      string `yaml:"name"`
+	ID        string `yaml:"id"`
+	Frequency string `yaml:"frequency"`
+	Target    int    `yaml:"target"`
+}
+
+type habitDay struct {
+	Date  string
+	Label string
+	Done  bool
+	Today bool
+	// Future days are shown in the month heatmap but can't be toggled yet
+	Future bool
+	// Padding before the first day of the month in the heatmap
+	Blank bool
+}
+
+type habitRow struct {
+	Index        int
+	Name         string
+	Weekly       bool
+	Streak       string
+	WeekProgress string
+	Days         []habitDay
+	MonthName    string
+	Month        []habitDay
+}
+
+type habitToggleResponse struct {
+	Streak       string `json:"streak"`
+	WeekProgress string `json:"week_progress,omitempty"`
+}
+
+func (widget *habitsWidget) initialize() error {
+	widget.withTitle("习惯").withError(nil)
+
+	if len(widget.Habits) == 0 {
+		return errors.New("at least one habit is required")
+	}
+
+	if widget.FirstDayOfWeek == "" {
+		widget.FirstDayOfWeek = "monday"
+	} else if _, ok := calendarWeekdaysToInt[widget.FirstDayOfWeek]; !ok {
+		return errors.New("invalid first day of week")
+	}
+	widget.firstDay = calendarWeekdaysToInt[widget.FirstDayOfWeek]
+
+	seen := make(map[string]bool, len(widget.Habits))
+
+	for i := range widget.Habits {
+		habit := &widget.Habits[i]
+
+		if habit.Name == "" {
+			return fmt.Errorf("habit #%d has no name", i+1)
+		}
+
+		if habit.ID == "" {
+			habit.ID = strings.ToLower(strings.Join(strings.Fields(habit.Name), "-"))
+		}
+
+		if seen[habit.ID] {
+			return fmt.Errorf("habit %s is defined more than once, give one of them a different id", habit.ID)
+		}
+		seen[habit.ID] = true
+
+		switch habit.Frequency {
+		case "", "daily":
+			habit.Frequency = "daily"
+			habit.Target = 1
+		case "weekly":
+			if habit.Target <= 0 {
+				habit.Target = 1
+			} else if habit.Target > 7 {
+				return fmt.Errorf("habit %s has a target of %d, which is more than the days in a week", habit.Name, habit.Target)
+			}
+		default:
+			return fmt.Errorf("habit %s has an invalid frequency %s, must be either daily or weekly", habit.Name, habit.Frequency)
+		}
+	}
+
+	return nil
+}
+
+func (widget *habitsWidget) Render() template.HTML {
+	now := time.Now()
+	widget.Rows = make([]habitRow, len(widget.Habits))
+
+	for i := range widget.Habits {
+		widget.Rows[i] = widget.row(i, widget.loadCompletions(&widget.Habits[i]), now)
+	}
+
+	return widget.renderTemplate(widget, habitsWidgetTemplate)
+}
+
+func (widget *habitsWidget) ToggleURL() string {
+	if widget.Providers == nil {
+		return ""
+	}
+
+	return widget.Providers.baseURL + "/api/widgets/" + strconv.FormatUint(widget.ID, 10) + "/toggle"
+}
+
+func (widget *habitsWidget) storeKey(habit *habitConfig) string {
+	return "habits:" + habit.ID
+}
+
+// Dates on which the habit was completed, sorted from oldest to newest
+func (widget *habitsWidget) loadCompletions(habit *habitConfig) []string {
+	completions := make([]string, 0)
+
+	if widget.Providers == nil || widget.Providers.store == nil {
+		return completions
+	}
+
+	widget.Providers.store.get(widget.storeKey(habit), &completions)
+	return completions
+}
+
+func (widget *habitsWidget) row(index int, completions []string, now time.Time) habitRow {
+	habit := &widget.Habits[index]
+	today := now.Format(habitsDateFormat)
+
+	row := habitRow{
+		Index:  index,
+		Name:   habit.Name,
+		Weekly: habit.Frequency == "weekly",
+		Days:   make([]habitDay, 0, 7),
+	}
+
+	isDone := func(date string) bool {
+		_, found := slices.BinarySearch(completions, date)
+		return found
+	}
+
+	for i := 6; i >= 0; i-- {
+		date := now.AddDate(0, 0, -i)
+		formatted := date.Format(habitsDateFormat)
+
+		row.Days = append(row.Days, habitDay{
+			Date:  formatted,
+			Label: date.Weekday().String()[:2],
+			Done:  isDone(formatted),
+			Today: formatted == today,
+		})
+	}
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	row.MonthName = monthStart.Format("January")
+	padding := (int(monthStart.Weekday()) - int(widget.firstDay) + 7) % 7
+
+	for range padding {
+		row.Month = append(row.Month, habitDay{Blank: true})
+	}
+
+	for date := monthStart; date.Month() == now.Month(); date = date.AddDate(0, 0, 1) {
+		formatted := date.Format(habitsDateFormat)
+
+		row.Month = append(row.Month, habitDay{
+			Date:   formatted,
+			Label:  strconv.Itoa(date.Day()),
+			Done:   isDone(formatted),
+			Today:  formatted == today,
+			Future: formatted > today,
+		})
+	}
+
+	row.Streak, row.WeekProgress = widget.streak(habit, completions, now)
+	return row
+}
+
+func (widget *habitsWidget) streak(habit *habitConfig, completions []string, now time.Time) (string, string) {
+	isDone := func(date time.Time) bool {
+		_, found := slices.BinarySearch(completions, date.Format(habitsDateFormat))
+		return found
+	}
+
+	if habit.Frequency == "daily" {
+		streak := 0
+		date := now
+
+		// the streak isn't broken until the day is over
+		if !isDone(date) {
+			date = date.AddDate(0, 0, -1)
+		}
+
+		for ; isDone(date) && streak < habitsMaxDaysKept; date = date.AddDate(0, 0, -1) {
+			streak++
+		}
+
+		return pluralize(streak, "day"), ""
+	}
+
+	weekStart := now.AddDate(0, 0, -((int(now.Weekday()) - int(widget.firstDay) + 7) % 7))
+	countInWeek := func(start time.Time) int {
+		count := 0
+		for i := range 7 {
+			if isDone(start.AddDate(0, 0, i)) {
+				count++
+			}
+		}
+		return count
+	}
+
+	thisWeek := countInWeek(weekStart)
+	progress := fmt.Sprintf("%d/%d this week", thisWeek, habit.Target)
+
+	streak := 0
+	start := weekStart
+
+	if thisWeek < habit.Target {
+		start = start.AddDate(0, 0, -7)
+	}
+
+	for ; countInWeek(start) >= habit.Target && streak < habitsMaxDaysKept/7; start = start.AddDate(0, 0, -7) {
+		streak++
+	}
+
+	return pluralize(streak, "week"), progress
+}
+
+func (widget *habitsWidget) handleRequest(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("path") != "toggle" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		Habit int    `json:"habit"`
+		Date  string `json:"date"`
+		Done  bool   `json:"done"`
+	}
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if request.Habit < 0 || request.Habit >= len(widget.Habits) {
+		http.Error(w, "unknown habit", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	date, err := time.ParseInLocation(habitsDateFormat, request.Date, now.Location())
+	if err != nil {
+		http.Error(w, "invalid date", http.StatusBadRequest)
+		return
+	}
+
+	if request.Date > now.Format(habitsDateFormat) || date.Before(now.AddDate(0, 0, -habitsMaxDaysKept)) {
+		http.Error(w, "date is out of range", http.StatusBadRequest)
+		return
+	}
+
+	if widget.Providers.store == nil {
+		http.Error(w, "state store is not available", http.StatusInternalServerError)
+		return
+	}
+
+	habit := &widget.Habits[request.Habit]
+
+	widget.mu.Lock()
+	defer widget.mu.Unlock()
+
+	completions := widget.loadCompletions(habit)
+	index, found := slices.BinarySearch(completions, request.Date)
+
+	if request.Done && !found {
+		completions = slices.Insert(completions, index, request.Date)
+	} else if !request.Done && found {
+		completions = slices.Delete(completions, index, index+1)
+	}
+
+	oldest := now.AddDate(0, 0, -habitsMaxDaysKept).Format(habitsDateFormat)
+	for len(completions) > 0 && completions[0] < oldest {
+		completions = completions[1:]
+	}
+
+	if err := widget.Providers.store.set(widget.storeKey(habit), completions); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	streak, progress := widget.streak(habit, completions, now)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(habitToggleResponse{Streak: streak, WeekProgress: progress})
+}
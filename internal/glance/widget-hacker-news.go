@@ -44,7 +44,7 @@ func (widget *hackerNewsWidget) initialize() error {
 }
 
 func (widget *hackerNewsWidget) update(ctx context.Context) {
-	posts, err := fetchHackerNewsPosts(widget.SortBy, 40, widget.CommentsUrlTemplate)
+	posts, err := fetchHackerNewsPosts(widget.httpClient(defaultHTTPClient), widget.SortBy, 40, widget.CommentsUrlTemplate)
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
@@ -75,9 +75,9 @@ type hackerNewsPostResponseJson struct {
 	TimePosted   int64  `json:"time"`
 }
 
-func fetchHackerNewsPostIds(sort string) ([]int, error) {
+func fetchHackerNewsPostIds(client requestDoer, sort string) ([]int, error) {
 	request, _ := http.NewRequest("GET", fmt.Sprintf("https://hacker-news.firebaseio.com/v0/%sstories.json", sort), nil)
-	response, err := decodeJsonFromRequest[[]int](defaultHTTPClient, request)
+	response, err := decodeJsonFromRequest[[]int](client, request)
 	if err != nil {
 		return nil, fmt.Errorf("%w: could not fetch list of post IDs", errNoContent)
 	}
@@ -85,7 +85,7 @@ func fetchHackerNewsPostIds(sort string) ([]int, error) {
 	return response, nil
 }
 
-func fetchHackerNewsPostsFromIds(postIds []int, commentsUrlTemplate string) (forumPostList, error) {
+func fetchHackerNewsPostsFromIds(client requestDoer, postIds []int, commentsUrlTemplate string) (forumPostList, error) {
 	requests := make([]*http.Request, len(postIds))
 
 	for i, id := range postIds {
@@ -93,7 +93,7 @@ func fetchHackerNewsPostsFromIds(postIds []int, commentsUrlTemplate string) (for
 		requests[i] = request
 	}
 
-	task := decodeJsonFromRequestTask[hackerNewsPostResponseJson](defaultHTTPClient)
+	task := decodeJsonFromRequestTask[hackerNewsPostResponseJson](client)
 	job := newJob(task, requests).withWorkers(30)
 	results, errs, err := workerPoolDo(job)
 	if err != nil {
@@ -138,8 +138,8 @@ func fetchHackerNewsPostsFromIds(postIds []int, commentsUrlTemplate string) (for
 	return posts, nil
 }
 
-func fetchHackerNewsPosts(sort string, limit int, commentsUrlTemplate string) (forumPostList, error) {
-	postIds, err := fetchHackerNewsPostIds(sort)
+func fetchHackerNewsPosts(client requestDoer, sort string, limit int, commentsUrlTemplate string) (forumPostList, error) {
+	postIds, err := fetchHackerNewsPostIds(client, sort)
 	if err != nil {
 		return nil, err
 	}
@@ -148,5 +148,5 @@ func fetchHackerNewsPosts(sort string, limit int, commentsUrlTemplate string) (f
 		postIds = postIds[:limit]
 	}
 
-	return fetchHackerNewsPostsFromIds(postIds, commentsUrlTemplate)
+	return fetchHackerNewsPostsFromIds(client, postIds, commentsUrlTemplate)
 }
@@ -0,0 +1,303 @@
+package glance
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var widgetHistoryPageTemplate = mustParseTemplate("widget-history.html", "document.html", "footer.html")
+
+const (
+	widgetHistoryDefaultMaxEntries = 100
+	widgetHistoryDefaultMaxAge     = 7 * 24 * time.Hour
+)
+
+// Widgets that support history need to implement this, the values are flat
+// label -> value pairs so that any two snapshots can be diffed the same way
+type historyCapableWidget interface {
+	historySnapshot() map[string]string
+}
+
+type widgetHistoryOptions struct {
+	Enabled    bool          `yaml:"enabled"`
+	MaxEntries int           `yaml:"max-entries"`
+	MaxAge     durationField `yaml:"max-age"`
+}
+
+func (o *widgetHistoryOptions) UnmarshalYAML(node *yaml.Node) error {
+	type widgetHistoryOptionsAlias widgetHistoryOptions
+	alias := (*widgetHistoryOptionsAlias)(o)
+
+	// allows for both `history: true` and specifying the individual options
+	if err := node.Decode(&o.Enabled); err == nil {
+		return nil
+	}
+
+	o.Enabled = true
+	return node.Decode(alias)
+}
+
+func (o *widgetHistoryOptions) maxEntries() int {
+	return ternary(o.MaxEntries > 0, o.MaxEntries, widgetHistoryDefaultMaxEntries)
+}
+
+func (o *widgetHistoryOptions) maxAge() time.Duration {
+	return ternary(o.MaxAge > 0, time.Duration(o.MaxAge), widgetHistoryDefaultMaxAge)
+}
+
+type widgetHistoryEntry struct {
+	Time   time.Time         `json:"time"`
+	Values map[string]string `json:"values"`
+}
+
+type widgetHistoryChange struct {
+	Label    string
+	Previous string
+	Current  string
+}
+
+// The history of each widget is kept under its own key next to the content of
+// widgets so that an update only writes that one entry, rather than the state
+// store writing out everything it holds. The state store is only used when
+// there's no content cache, in which case it lives in memory, and to pick up
+// the history saved there before.
+func widgetHistoryStoreKey(w widget) string {
+	return "history:" + w.base().configHash
+}
+
+func widgetHistoryCacheKey(w widget) string {
+	return "history-" + w.base().configHash
+}
+
+func recordWidgetHistory(w widget) {
+	base := w.base()
+	if !base.History.Enabled || base.Providers == nil || base.Providers.store == nil {
+		return
+	}
+
+	if base.Error != nil || !base.ContentAvailable {
+		return
+	}
+
+	snapshotter, ok := w.(historyCapableWidget)
+	if !ok {
+		return
+	}
+
+	values := snapshotter.historySnapshot()
+	if len(values) == 0 {
+		return
+	}
+
+	entries, err := loadWidgetHistory(w)
+	if err != nil {
+		slog.Error("Failed to load widget history", "widget", base.Type, "error", err)
+		entries = nil
+	}
+
+	now := time.Now()
+	entries = append(entries, widgetHistoryEntry{Time: now, Values: values})
+
+	cutoff := now.Add(-base.History.maxAge())
+	entries = slices.DeleteFunc(entries, func(e widgetHistoryEntry) bool {
+		return e.Time.Before(cutoff)
+	})
+
+	if overflow := len(entries) - base.History.maxEntries(); overflow > 0 {
+		entries = entries[overflow:]
+	}
+
+	if err := saveWidgetHistory(w, entries); err != nil {
+		slog.Error("Failed to save widget history", "widget", base.Type, "error", err)
+	}
+}
+
+func saveWidgetHistory(w widget, entries []widgetHistoryEntry) error {
+	store := widgetContentCacheStore(w)
+	if store == nil {
+		return w.base().Providers.store.set(widgetHistoryStoreKey(w), entries)
+	}
+
+	contents, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("encoding history: %v", err)
+	}
+
+	if err := store.put(widgetHistoryCacheKey(w), contents, "application/json"); err != nil {
+		return err
+	}
+
+	return w.base().Providers.store.delete(widgetHistoryStoreKey(w))
+}
+
+// Returns the entries from oldest to newest
+func loadWidgetHistory(w widget) ([]widgetHistoryEntry, error) {
+	base := w.base()
+	if base.Providers == nil || base.Providers.store == nil {
+		return nil, nil
+	}
+
+	var entries []widgetHistoryEntry
+
+	if store := widgetContentCacheStore(w); store != nil {
+		contents, _, err := store.get(widgetHistoryCacheKey(w))
+		if err == nil {
+			if err := json.Unmarshal(contents, &entries); err != nil {
+				return nil, fmt.Errorf("decoding history: %v", err)
+			}
+
+			return entries, nil
+		}
+
+		if !errors.Is(err, errCacheEntryNotFound) {
+			return nil, err
+		}
+	}
+
+	if _, err := base.Providers.store.get(widgetHistoryStoreKey(w), &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func diffWidgetHistoryEntries(previous, current map[string]string) []widgetHistoryChange {
+	changes := make([]widgetHistoryChange, 0)
+
+	for _, label := range slices.Sorted(maps.Keys(current)) {
+		if previousValue, existed := previous[label]; !existed || previousValue != current[label] {
+			changes = append(changes, widgetHistoryChange{
+				Label:    label,
+				Previous: previousValue,
+				Current:  current[label],
+			})
+		}
+	}
+
+	for _, label := range slices.Sorted(maps.Keys(previous)) {
+		if _, exists := current[label]; !exists {
+			changes = append(changes, widgetHistoryChange{
+				Label:    label,
+				Previous: previous[label],
+			})
+		}
+	}
+
+	return changes
+}
+
+type widgetHistoryTemplateEntry struct {
+	Time    time.Time
+	First   bool
+	Changes []widgetHistoryChange
+}
+
+type widgetHistoryTemplateData struct {
+	templateData
+	WidgetTitle string
+	Entries     []widgetHistoryTemplateEntry
+}
+
+func (a *application) widgetFromRequest(r *http.Request) (widget, bool) {
+	widgetID, err := strconv.ParseUint(r.PathValue("widget"), 10, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	widget, exists := a.widgetByID[widgetID]
+	if !exists || !a.canAccessWidget(r, widgetID) {
+		return nil, false
+	}
+
+	return widget, true
+}
+
+func (a *application) handleWidgetHistoryRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	widget, exists := a.widgetFromRequest(r)
+	if !exists || !widget.base().History.Enabled {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	entries, err := loadWidgetHistory(widget)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if entries == nil {
+		entries = []widgetHistoryEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (a *application) handleWidgetHistoryPageRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, redirectToLogin) {
+		return
+	}
+
+	widget, exists := a.widgetFromRequest(r)
+	if !exists || !widget.base().History.Enabled {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	entries, err := loadWidgetHistory(widget)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	data := widgetHistoryTemplateData{
+		templateData: templateData{App: a},
+		WidgetTitle:  widget.base().Title,
+		Entries:      make([]widgetHistoryTemplateEntry, 0, len(entries)),
+	}
+	a.populateTemplateRequestData(&data.Request, r)
+
+	// newest first, each entry only shows what changed compared to the one before it
+	for i := len(entries) - 1; i >= 0; i-- {
+		var previous map[string]string
+		if i > 0 {
+			previous = entries[i-1].Values
+		}
+
+		changes := diffWidgetHistoryEntries(previous, entries[i].Values)
+		if i > 0 && len(changes) == 0 {
+			continue
+		}
+
+		data.Entries = append(data.Entries, widgetHistoryTemplateEntry{
+			Time:    entries[i].Time,
+			First:   i == 0,
+			Changes: changes,
+		})
+	}
+
+	var responseBytes bytes.Buffer
+	if err := widgetHistoryPageTemplate.Execute(&responseBytes, data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Write(responseBytes.Bytes())
+}
@@ -0,0 +1,62 @@
+package glance
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWidgetHistoryIsKeptInTheContentCache(t *testing.T) {
+	dataPath := t.TempDir()
+	store := &stateStore{filePath: filepath.Join(dataPath, stateStoreFileName), data: make(map[string]json.RawMessage)}
+
+	widget := &marketsWidget{}
+	widget.configHash = "0123456789abcdef"
+	widget.History.Enabled = true
+	widget.ContentAvailable = true
+	widget.Providers = &widgetProviders{
+		store:        store,
+		contentCache: openFileCacheStore(filepath.Join(dataPath, widgetContentCacheDirName)),
+	}
+
+	// history saved in the state store before it moved gets carried over
+	legacy := []widgetHistoryEntry{{Time: time.Now().Add(-time.Hour), Values: map[string]string{"BTC": "1.00 USD"}}}
+	if err := store.set(widgetHistoryStoreKey(widget), legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(store.filePath); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, price := range []float64{2, 3} {
+		widget.Markets = marketList{{Name: "BTC", Currency: "USD", Price: price}}
+		recordWidgetHistory(widget)
+	}
+
+	entries, err := loadWidgetHistory(widget)
+	if err != nil {
+		t.Fatalf("loading history: %v", err)
+	}
+
+	if len(entries) != 3 || entries[0].Values["BTC"] != "1.00 USD" || entries[2].Values["BTC"] != "3.00 USD" {
+		t.Errorf("unexpected history %+v", entries)
+	}
+
+	if keys := store.keysWithPrefix("history:"); len(keys) != 0 {
+		t.Errorf("expected the history to be removed from the state store, got %v", keys)
+	}
+
+	// only the removal of the old history writes the state file
+	if err := os.Remove(store.filePath); err != nil {
+		t.Fatalf("expected the state file to have been written once: %v", err)
+	}
+
+	widget.Markets = marketList{{Name: "BTC", Currency: "USD", Price: 4}}
+	recordWidgetHistory(widget)
+
+	if _, err := os.Stat(store.filePath); !os.IsNotExist(err) {
+		t.Errorf("expected an update to not write the state file, got %v", err)
+	}
+}
@@ -0,0 +1,355 @@
+package glance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var homeAssistantWidgetTemplate = mustParseTemplate("home-assistant.html", "widget-base.html")
+
+type homeAssistantWidget struct {
+	widgetBase    `yaml:",inline"`
+	URL           string                      `yaml:"url"`
+	Token         string                      `yaml:"token"`
+	AllowInsecure bool                        `yaml:"allow-insecure"`
+	Entities      []homeAssistantEntityConfig `yaml:"entities"`
+	Users         []string                    `yaml:"users"`
+	States        []homeAssistantEntityState  `yaml:"-"`
+}
+
+type homeAssistantEntityConfig struct {
+	ID     string          `yaml:"id"`
+	Title  string          `yaml:"title"`
+	Icon   customIconField `yaml:"icon"`
+	Unit   string          `yaml:"unit"`
+	Toggle bool            `yaml:"toggle"`
+}
+
+func (e *homeAssistantEntityConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&e.ID)
+	}
+
+	type alias homeAssistantEntityConfig
+	return node.Decode((*alias)(e))
+}
+
+type homeAssistantEntityState struct {
+	Index  int
+	ID     string
+	Title  string
+	Icon   customIconField
+	State  string
+	Unit   string
+	Active bool
+	// Empty when the entity doesn't have a toggle button
+	Action      string
+	LastChanged time.Time
+	Error       error
+}
+
+type homeAssistantStateJson struct {
+	EntityID    string `json:"entity_id"`
+	State       string `json:"state"`
+	LastChanged string `json:"last_changed"`
+	Attributes  struct {
+		FriendlyName string `json:"friendly_name"`
+		Icon         string `json:"icon"`
+		Unit         string `json:"unit_of_measurement"`
+	} `json:"attributes"`
+}
+
+func (widget *homeAssistantWidget) initialize() error {
+	widget.withTitle("Home Assistant").withCacheDuration(30 * time.Second)
+
+	if widget.URL == "" || widget.Token == "" {
+		return errors.New("url and token are required")
+	}
+
+	if len(widget.Entities) == 0 {
+		return errors.New("at least one entity is required")
+	}
+
+	widget.URL = strings.TrimRight(widget.URL, "/")
+
+	for i := range widget.Entities {
+		entity := &widget.Entities[i]
+
+		if entity.ID == "" {
+			return fmt.Errorf("entity #%d has no id", i+1)
+		}
+
+		if !strings.Contains(entity.ID, ".") {
+			return fmt.Errorf("entity id %q must include the domain, e.g. light.%s", entity.ID, entity.ID)
+		}
+
+		if entity.Toggle && homeAssistantToggleService(entity.ID) == "" {
+			return fmt.Errorf("entity %s can not be toggled", entity.ID)
+		}
+	}
+
+	return nil
+}
+
+func (widget *homeAssistantWidget) update(ctx context.Context) {
+	states, err := widget.fetchStates(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.States = states
+}
+
+func (widget *homeAssistantWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, homeAssistantWidgetTemplate)
+}
+
+func (widget *homeAssistantWidget) ToggleURL() string {
+	if widget.Providers == nil {
+		return ""
+	}
+
+	return widget.Providers.baseURL + "/api/widgets/" + strconv.FormatUint(widget.ID, 10) + "/toggle"
+}
+
+// Toggling is only ever allowed for logged in users
+func (widget *homeAssistantWidget) MaybeToggleable() bool {
+	return widget.Providers != nil && widget.Providers.usernameFromRequest != nil
+}
+
+func (widget *homeAssistantWidget) canToggle(r *http.Request) bool {
+	if widget.Providers.usernameFromRequest == nil {
+		return false
+	}
+
+	username, ok := widget.Providers.usernameFromRequest(r)
+	if !ok {
+		return false
+	}
+
+	return len(widget.Users) == 0 || slices.Contains(widget.Users, username)
+}
+
+func (widget *homeAssistantWidget) client() requestDoer {
+	return widget.httpClient(ternary(widget.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient))
+}
+
+func (widget *homeAssistantWidget) newRequest(ctx context.Context, method, path string, body io.Reader) *http.Request {
+	request, _ := http.NewRequestWithContext(ctx, method, widget.URL+path, body)
+	request.Header.Set("Authorization", "Bearer "+widget.Token)
+
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	return request
+}
+
+func (widget *homeAssistantWidget) fetchStates(ctx context.Context) ([]homeAssistantEntityState, error) {
+	requests := make([]*http.Request, len(widget.Entities))
+	for i := range widget.Entities {
+		requests[i] = widget.newRequest(ctx, "GET", "/api/states/"+url.PathEscape(widget.Entities[i].ID), nil)
+	}
+
+	job := newJob(decodeJsonFromRequestTask[homeAssistantStateJson](widget.client()), requests)
+	responses, errs, err := workerPoolDo(job)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNoContent, err)
+	}
+
+	states := make([]homeAssistantEntityState, len(widget.Entities))
+	var failed int
+
+	for i := range widget.Entities {
+		config := &widget.Entities[i]
+		state := &states[i]
+
+		state.Index = i
+		state.ID = config.ID
+		state.Title = ternary(config.Title != "", config.Title, config.ID)
+		state.Icon = config.Icon
+
+		if config.Toggle {
+			state.Action = homeAssistantActionText(config.ID)
+		}
+
+		if errs[i] != nil {
+			failed++
+			state.Error = errs[i]
+			slog.Error("Failed to fetch Home Assistant entity", "entity", config.ID, "error", errs[i])
+			continue
+		}
+
+		response := &responses[i]
+
+		if config.Title == "" && response.Attributes.FriendlyName != "" {
+			state.Title = response.Attributes.FriendlyName
+		}
+
+		if state.Icon.URL == "" && response.Attributes.Icon != "" {
+			state.Icon = newCustomIconField(response.Attributes.Icon)
+		}
+
+		state.State = formatHomeAssistantState(response.State)
+		state.Unit = ternary(config.Unit != "", config.Unit, response.Attributes.Unit)
+		state.Active = isHomeAssistantStateActive(response.State)
+		state.LastChanged, _ = time.Parse(time.RFC3339, response.LastChanged)
+	}
+
+	if failed == len(states) {
+		return nil, fmt.Errorf("%w: could not fetch any entity: %v", errNoContent, errs[0])
+	}
+
+	if failed > 0 {
+		return states, fmt.Errorf("%w: could not fetch %d entities", errPartialContent, failed)
+	}
+
+	return states, nil
+}
+
+func (widget *homeAssistantWidget) handleRequest(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("path") != "toggle" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// forms can be posted from other sites without a preflight request, JSON can't
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		http.Error(w, "cross-site requests are not allowed", http.StatusForbidden)
+		return
+	}
+
+	if !widget.canToggle(r) {
+		http.Error(w, "not allowed to toggle entities", http.StatusForbidden)
+		return
+	}
+
+	var request struct {
+		Entity int `json:"entity"`
+	}
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if request.Entity < 0 || request.Entity >= len(widget.Entities) {
+		http.Error(w, "unknown entity", http.StatusBadRequest)
+		return
+	}
+
+	entity := &widget.Entities[request.Entity]
+
+	if !entity.Toggle {
+		http.Error(w, "entity can not be toggled", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	body, _ := json.Marshal(map[string]string{"entity_id": entity.ID})
+	serviceRequest := widget.newRequest(ctx, "POST", "/api/services/"+homeAssistantToggleService(entity.ID), bytes.NewReader(body))
+
+	// the service responds with the states which changed as a result of the call
+	changed, err := decodeJsonFromRequest[[]homeAssistantStateJson](widget.client(), serviceRequest)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("calling service: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	username, _ := widget.Providers.usernameFromRequest(r)
+	slog.Info("Toggled Home Assistant entity", "entity", entity.ID, "user", username)
+
+	var response struct {
+		State  string `json:"state,omitempty"`
+		Active bool   `json:"active"`
+	}
+
+	for i := range changed {
+		if changed[i].EntityID == entity.ID {
+			response.State = formatHomeAssistantState(changed[i].State)
+			response.Active = isHomeAssistantStateActive(changed[i].State)
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Returns the service which toggles or triggers the entity, or an empty
+// string if the entity's domain doesn't have one
+func homeAssistantToggleService(entityID string) string {
+	domain, _, _ := strings.Cut(entityID, ".")
+
+	switch domain {
+	case "light", "switch", "fan", "input_boolean", "automation", "siren", "humidifier", "media_player", "cover":
+		return domain + "/toggle"
+	case "script", "scene":
+		return domain + "/turn_on"
+	case "button", "input_button":
+		return domain + "/press"
+	}
+
+	return ""
+}
+
+func homeAssistantActionText(entityID string) string {
+	domain, _, _ := strings.Cut(entityID, ".")
+
+	switch domain {
+	case "script", "scene", "button", "input_button":
+		return "Run"
+	}
+
+	return "Toggle"
+}
+
+func isHomeAssistantStateActive(state string) bool {
+	switch state {
+	case "on", "open", "opening", "playing", "home", "unlocked", "heat", "cool", "heat_cool", "auto":
+		return true
+	}
+
+	return false
+}
+
+func formatHomeAssistantState(state string) string {
+	if value, err := strconv.ParseFloat(state, 64); err == nil {
+		if value == math.Trunc(value) {
+			return strconv.FormatFloat(value, 'f', 0, 64)
+		}
+
+		// sensors often report far more precision than is useful to show
+		return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64)
+	}
+
+	return strings.ReplaceAll(state, "_", " ")
+}
@@ -0,0 +1,85 @@
+package glance
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHomeAssistantToggleRequest(t *testing.T) {
+	var called int
+	homeAssistant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called++
+		body, _ := io.ReadAll(r.Body)
+
+		if r.URL.Path != "/api/services/light/toggle" || string(body) != `{"entity_id":"light.desk"}` || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		w.Write([]byte(`[{"entity_id":"light.desk","state":"on"}]`))
+	}))
+	defer homeAssistant.Close()
+
+	widget := &homeAssistantWidget{
+		URL:      homeAssistant.URL,
+		Token:    "token",
+		Entities: []homeAssistantEntityConfig{{ID: "light.desk", Toggle: true}, {ID: "sensor.temperature"}},
+		Users:    []string{"admin"},
+	}
+	widget.Providers = &widgetProviders{
+		usernameFromRequest: func(r *http.Request) (string, bool) {
+			username := r.Header.Get("X-Test-User")
+			return username, username != ""
+		},
+	}
+
+	tests := []struct {
+		name        string
+		user        string
+		contentType string
+		fetchSite   string
+		body        string
+		status      int
+	}{
+		{name: "allowed user", user: "admin", contentType: "application/json", fetchSite: "same-origin", body: `{"entity":0}`, status: http.StatusOK},
+		{name: "content type with parameters", user: "admin", contentType: "application/json; charset=utf-8", body: `{"entity":0}`, status: http.StatusOK},
+		{name: "not logged in", contentType: "application/json", body: `{"entity":0}`, status: http.StatusForbidden},
+		{name: "user not in the list", user: "guest", contentType: "application/json", body: `{"entity":0}`, status: http.StatusForbidden},
+		{name: "form content type", user: "admin", contentType: "application/x-www-form-urlencoded", body: `{"entity":0}`, status: http.StatusUnsupportedMediaType},
+		{name: "cross-site", user: "admin", contentType: "application/json", fetchSite: "cross-site", body: `{"entity":0}`, status: http.StatusForbidden},
+		{name: "entity without toggle", user: "admin", contentType: "application/json", body: `{"entity":1}`, status: http.StatusForbidden},
+		{name: "unknown entity", user: "admin", contentType: "application/json", body: `{"entity":2}`, status: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/api/widgets/1/toggle", strings.NewReader(test.body))
+			request.SetPathValue("path", "toggle")
+			request.Header.Set("Content-Type", test.contentType)
+			if test.user != "" {
+				request.Header.Set("X-Test-User", test.user)
+			}
+			if test.fetchSite != "" {
+				request.Header.Set("Sec-Fetch-Site", test.fetchSite)
+			}
+
+			recorder := httptest.NewRecorder()
+			widget.handleRequest(recorder, request)
+
+			if recorder.Code != test.status {
+				t.Errorf("expected status %d, got %d: %s", test.status, recorder.Code, recorder.Body.String())
+			}
+
+			if test.status == http.StatusOK && !strings.Contains(recorder.Body.String(), `"active":true`) {
+				t.Errorf("expected the new state in the response, got %s", recorder.Body.String())
+			}
+		})
+	}
+
+	if called != 2 {
+		t.Errorf("expected Home Assistant to be called twice, got %d", called)
+	}
+}
@@ -5,15 +5,63 @@ import (
 	"fmt"
 	"html/template"
 	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 var iframeWidgetTemplate = mustParseTemplate("iframe.html", "widget-base.html")
 
+var iframeSandboxPermissions = []string{
+	"allow-downloads",
+	"allow-forms",
+	"allow-modals",
+	"allow-orientation-lock",
+	"allow-pointer-lock",
+	"allow-popups",
+	"allow-popups-to-escape-sandbox",
+	"allow-presentation",
+	"allow-same-origin",
+	"allow-scripts",
+	"allow-storage-access-by-user-activation",
+	"allow-top-navigation",
+	"allow-top-navigation-by-user-activation",
+	"allow-top-navigation-to-custom-protocols",
+}
+
 type iframeWidget struct {
-	widgetBase `yaml:",inline"`
-	cachedHTML template.HTML `yaml:"-"`
-	Source     string        `yaml:"source"`
-	Height     int           `yaml:"height"`
+	widgetBase      `yaml:",inline"`
+	cachedHTML      template.HTML      `yaml:"-"`
+	Source          string             `yaml:"source"`
+	Height          int                `yaml:"height"`
+	Sandbox         iframeSandboxField `yaml:"sandbox"`
+	Allow           string             `yaml:"allow"`
+	RefreshInterval durationField      `yaml:"refresh-interval"`
+}
+
+type iframeSandboxField struct {
+	Enabled     bool
+	Permissions []string
+}
+
+func (f *iframeSandboxField) UnmarshalYAML(node *yaml.Node) error {
+	// allows for both `sandbox: true` and a list of the permissions to grant
+	if err := node.Decode(&f.Enabled); err == nil {
+		return nil
+	}
+
+	if err := node.Decode(&f.Permissions); err != nil {
+		return errors.New("sandbox must be either a boolean or a list of permissions")
+	}
+
+	f.Enabled = true
+	return nil
+}
+
+func (f *iframeSandboxField) String() string {
+	return strings.Join(f.Permissions, " ")
 }
 
 func (widget *iframeWidget) initialize() error {
@@ -27,17 +75,31 @@ func (widget *iframeWidget) initialize() error {
 		return fmt.Errorf("parsing URL: %v", err)
 	}
 
-	if widget.Height == 50 {
+	if widget.Height == 0 {
 		widget.Height = 300
 	} else if widget.Height < 50 {
 		widget.Height = 50
 	}
 
+	for _, permission := range widget.Sandbox.Permissions {
+		if !slices.Contains(iframeSandboxPermissions, permission) {
+			return fmt.Errorf("unknown sandbox permission %q", permission)
+		}
+	}
+
+	if widget.RefreshInterval > 0 && time.Duration(widget.RefreshInterval) < 10*time.Second {
+		return errors.New("refresh-interval must be at least 10s")
+	}
+
 	widget.cachedHTML = widget.renderTemplate(widget, iframeWidgetTemplate)
 
 	return nil
 }
 
+func (widget *iframeWidget) RefreshIntervalSeconds() int {
+	return int(time.Duration(widget.RefreshInterval).Seconds())
+}
+
 func (widget *iframeWidget) Render() template.HTML {
 	return widget.cachedHTML
 }
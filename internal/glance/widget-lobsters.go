@@ -4,6 +4,7 @@ import (
 	"context"
 	"html/template"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -18,6 +19,8 @@ type lobstersWidget struct {
 	SortBy         string        `yaml:"sort-by"`
 	Tags           []string      `yaml:"tags"`
 	ShowThumbnails bool          `yaml:"-"`
+
+	CommentsURLTemplate string `yaml:"comments-url-template"`
 }
 
 func (widget *lobstersWidget) initialize() error {
@@ -45,7 +48,7 @@ func (widget *lobstersWidget) initialize() error {
 }
 
 func (widget *lobstersWidget) update(ctx context.Context) {
-	posts, err := fetchLobstersPosts(widget.CustomURL, widget.InstanceURL, widget.SortBy, widget.Tags)
+	posts, err := fetchLobstersPosts(widget.httpClient(defaultHTTPClient), widget.CustomURL, widget.InstanceURL, widget.SortBy, widget.Tags, widget.CommentsURLTemplate)
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
@@ -63,6 +66,7 @@ func (widget *lobstersWidget) Render() template.HTML {
 }
 
 type lobstersPostResponseJson struct {
+	ShortID      string   `json:"short_id"`
 	CreatedAt    string   `json:"created_at"`
 	Title        string   `json:"title"`
 	URL          string   `json:"url"`
@@ -74,13 +78,13 @@ type lobstersPostResponseJson struct {
 
 type lobstersFeedResponseJson []lobstersPostResponseJson
 
-func fetchLobstersPostsFromFeed(feedUrl string) (forumPostList, error) {
+func fetchLobstersPostsFromFeed(client requestDoer, feedUrl string, commentsUrlTemplate string) (forumPostList, error) {
 	request, err := http.NewRequest("GET", feedUrl, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	feed, err := decodeJsonFromRequest[lobstersFeedResponseJson](defaultHTTPClient, request)
+	feed, err := decodeJsonFromRequest[lobstersFeedResponseJson](client, request)
 	if err != nil {
 		return nil, err
 	}
@@ -90,9 +94,20 @@ func fetchLobstersPostsFromFeed(feedUrl string) (forumPostList, error) {
 	for i := range feed {
 		createdAt, _ := time.Parse(time.RFC3339, feed[i].CreatedAt)
 
+		commentsUrl := feed[i].CommentsURL
+		if commentsUrlTemplate != "" {
+			var postPath string
+			if parsedUrl, err := url.Parse(feed[i].CommentsURL); err == nil {
+				postPath = strings.TrimLeft(parsedUrl.Path, "/")
+			}
+
+			commentsUrl = strings.ReplaceAll(commentsUrlTemplate, "{POST-ID}", feed[i].ShortID)
+			commentsUrl = strings.ReplaceAll(commentsUrl, "{POST-PATH}", postPath)
+		}
+
 		posts = append(posts, forumPost{
 			Title:           feed[i].Title,
-			DiscussionUrl:   feed[i].CommentsURL,
+			DiscussionUrl:   commentsUrl,
 			TargetUrl:       feed[i].URL,
 			TargetUrlDomain: extractDomainFromUrl(feed[i].URL),
 			CommentCount:    feed[i].CommentCount,
@@ -109,7 +124,7 @@ func fetchLobstersPostsFromFeed(feedUrl string) (forumPostList, error) {
 	return posts, nil
 }
 
-func fetchLobstersPosts(customURL string, instanceURL string, sortBy string, tags []string) (forumPostList, error) {
+func fetchLobstersPosts(client requestDoer, customURL string, instanceURL string, sortBy string, tags []string, commentsUrlTemplate string) (forumPostList, error) {
 	var feedUrl string
 
 	if customURL != "" {
@@ -135,7 +150,7 @@ func fetchLobstersPosts(customURL string, instanceURL string, sortBy string, tag
 		}
 	}
 
-	posts, err := fetchLobstersPostsFromFeed(feedUrl)
+	posts, err := fetchLobstersPostsFromFeed(client, feedUrl, commentsUrlTemplate)
 	if err != nil {
 		return nil, err
 	}
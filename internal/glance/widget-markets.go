@@ -2,12 +2,15 @@ package glance
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
 	"math"
 	"net/http"
+	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -21,9 +24,15 @@ type marketsWidget struct {
 	ChartLinkTemplate  string          `yaml:"chart-link-template"`
 	SymbolLinkTemplate string          `yaml:"symbol-link-template"`
 	Sort               string          `yaml:"sort-by"`
+	Provider           string          `yaml:"provider"`
 	Markets            marketList      `yaml:"-"`
 }
 
+const (
+	marketProviderYahoo   = "yahoo"
+	marketProviderBinance = "binance"
+)
+
 func (widget *marketsWidget) initialize() error {
 	widget.withTitle("股市").withCacheDuration(time.Hour)
 
@@ -32,9 +41,25 @@ func (widget *marketsWidget) initialize() error {
 		widget.MarketRequests = widget.StocksRequests
 	}
 
+	if widget.Provider == "" {
+		widget.Provider = marketProviderYahoo
+	}
+
 	for i := range widget.MarketRequests {
 		m := &widget.MarketRequests[i]
 
+		if m.Provider == "" {
+			m.Provider = widget.Provider
+		}
+
+		if m.Provider != marketProviderYahoo && m.Provider != marketProviderBinance {
+			return fmt.Errorf("unknown provider %q for market %s, must be either yahoo or binance", m.Provider, m.Symbol)
+		}
+
+		if m.Provider == marketProviderBinance {
+			m.Symbol = strings.ToUpper(m.Symbol)
+		}
+
 		if widget.ChartLinkTemplate != "" && m.ChartLink == "" {
 			m.ChartLink = strings.ReplaceAll(widget.ChartLinkTemplate, "{SYMBOL}", m.Symbol)
 		}
@@ -48,7 +73,7 @@ func (widget *marketsWidget) initialize() error {
 }
 
 func (widget *marketsWidget) update(ctx context.Context) {
-	markets, err := fetchMarketsDataFromYahoo(widget.MarketRequests)
+	markets, err := fetchMarketsData(widget.httpClient(defaultHTTPClient), widget.MarketRequests)
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
@@ -67,11 +92,23 @@ func (widget *marketsWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, marketsWidgetTemplate)
 }
 
+func (widget *marketsWidget) historySnapshot() map[string]string {
+	values := make(map[string]string, len(widget.Markets))
+
+	for i := range widget.Markets {
+		m := &widget.Markets[i]
+		values[m.Name] = fmt.Sprintf("%.2f %s", m.Price, m.Currency)
+	}
+
+	return values
+}
+
 type marketRequest struct {
 	CustomName string `yaml:"name"`
 	Symbol     string `yaml:"symbol"`
 	ChartLink  string `yaml:"chart-link"`
 	SymbolLink string `yaml:"symbol-link"`
+	Provider   string `yaml:"provider"`
 }
 
 type market struct {
@@ -121,85 +158,178 @@ type marketResponseJson struct {
 // TODO: allow changing chart time frame
 const marketChartDays = 21
 
-func fetchMarketsDataFromYahoo(marketRequests []marketRequest) (marketList, error) {
-	requests := make([]*http.Request, 0, len(marketRequests))
-
-	for i := range marketRequests {
-		request, _ := http.NewRequest("GET", fmt.Sprintf("https://query1.finance.yahoo.com/v8/finance/chart/%s?range=1mo&interval=1d", marketRequests[i].Symbol), nil)
-		setBrowserUserAgentHeader(request)
-		requests = append(requests, request)
-	}
-
-	job := newJob(decodeJsonFromRequestTask[marketResponseJson](defaultHTTPClient), requests)
-	responses, errs, err := workerPoolDo(job)
+func fetchMarketsData(client requestDoer, marketRequests []marketRequest) (marketList, error) {
+	job := newJob(fetchMarketTask(client), marketRequests)
+	results, errs, err := workerPoolDo(job)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", errNoContent, err)
 	}
 
-	markets := make(marketList, 0, len(responses))
+	markets := make(marketList, 0, len(results))
 	var failed int
 
-	for i := range responses {
+	for i := range results {
 		if errs[i] != nil {
 			failed++
-			slog.Error("Failed to fetch market data", "symbol", marketRequests[i].Symbol, "error", errs[i])
+			slog.Error("Failed to fetch market data", "symbol", marketRequests[i].Symbol, "provider", marketRequests[i].Provider, "error", errs[i])
 			continue
 		}
 
-		response := responses[i]
+		markets = append(markets, results[i])
+	}
+
+	if len(markets) == 0 {
+		return nil, errNoContent
+	}
 
-		if len(response.Chart.Result) == 0 {
-			failed++
-			slog.Error("Market response contains no data", "symbol", marketRequests[i].Symbol)
-			continue
-		}
+	if failed > 0 {
+		return markets, fmt.Errorf("%w: could not fetch data for %d market(s)", errPartialContent, failed)
+	}
 
-		result := &response.Chart.Result[0]
-		prices := result.Indicators.Quote[0].Close
+	return markets, nil
+}
 
-		if len(prices) > marketChartDays {
-			prices = prices[len(prices)-marketChartDays:]
+func fetchMarketTask(client requestDoer) func(marketRequest) (market, error) {
+	return func(request marketRequest) (market, error) {
+		if request.Provider == marketProviderBinance {
+			return fetchMarketFromBinance(client, request)
 		}
 
-		previous := result.Meta.RegularMarketPrice
+		return fetchMarketFromYahoo(client, request)
+	}
+}
 
-		if len(prices) >= 2 && prices[len(prices)-2] != 0 {
-			previous = prices[len(prices)-2]
-		}
+func fetchMarketFromYahoo(client requestDoer, marketRequest marketRequest) (market, error) {
+	request, _ := http.NewRequest("GET", fmt.Sprintf("https://query1.finance.yahoo.com/v8/finance/chart/%s?range=1mo&interval=1d", marketRequest.Symbol), nil)
+	setBrowserUserAgentHeader(request)
 
-		points := svgPolylineCoordsFromYValues(100, 50, maybeCopySliceWithoutZeroValues(prices))
+	response, err := decodeJsonFromRequest[marketResponseJson](client, request)
+	if err != nil {
+		return market{}, err
+	}
 
-		currency, exists := currencyToSymbol[strings.ToUpper(result.Meta.Currency)]
-		if !exists {
-			currency = result.Meta.Currency
-		}
+	if len(response.Chart.Result) == 0 || len(response.Chart.Result[0].Indicators.Quote) == 0 {
+		return market{}, errors.New("market response contains no data")
+	}
 
-		markets = append(markets, market{
-			marketRequest: marketRequests[i],
-			Price:         result.Meta.RegularMarketPrice,
-			Currency:      currency,
-			PriceHint:     result.Meta.PriceHint,
-			Name: ternary(marketRequests[i].CustomName == "",
-				result.Meta.ShortName,
-				marketRequests[i].CustomName,
-			),
-			PercentChange: percentChange(
-				result.Meta.RegularMarketPrice,
-				previous,
-			),
-			SvgChartPoints: points,
-		})
+	result := &response.Chart.Result[0]
+	prices := result.Indicators.Quote[0].Close
+
+	if len(prices) > marketChartDays {
+		prices = prices[len(prices)-marketChartDays:]
 	}
 
-	if len(markets) == 0 {
-		return nil, errNoContent
+	previous := result.Meta.RegularMarketPrice
+
+	if len(prices) >= 2 && prices[len(prices)-2] != 0 {
+		previous = prices[len(prices)-2]
 	}
 
-	if failed > 0 {
-		return markets, fmt.Errorf("%w: could not fetch data for %d market(s)", errPartialContent, failed)
+	points := svgPolylineCoordsFromYValues(100, 50, maybeCopySliceWithoutZeroValues(prices))
+
+	currency, exists := currencyToSymbol[strings.ToUpper(result.Meta.Currency)]
+	if !exists {
+		currency = result.Meta.Currency
 	}
 
-	return markets, nil
+	return market{
+		marketRequest: marketRequest,
+		Price:         result.Meta.RegularMarketPrice,
+		Currency:      currency,
+		PriceHint:     result.Meta.PriceHint,
+		Name: ternary(marketRequest.CustomName == "",
+			result.Meta.ShortName,
+			marketRequest.CustomName,
+		),
+		PercentChange: percentChange(
+			result.Meta.RegularMarketPrice,
+			previous,
+		),
+		SvgChartPoints: points,
+	}, nil
+}
+
+type binanceTickerResponseJson struct {
+	Symbol             string `json:"symbol"`
+	LastPrice          string `json:"lastPrice"`
+	PriceChangePercent string `json:"priceChangePercent"`
+}
+
+// Checked in order, so the ones which end with another one need to come first
+var binanceQuoteAssets = []string{"FDUSD", "USDT", "USDC", "TUSD", "EUR", "GBP", "TRY", "BRL", "JPY", "BTC", "ETH", "BNB"}
+
+var binanceStablecoins = map[string]bool{"FDUSD": true, "USDT": true, "USDC": true, "TUSD": true}
+
+// The symbols are pairs such as BTCUSDT, the daily change is the one of the
+// last 24 hours since crypto is traded at all times
+func fetchMarketFromBinance(client requestDoer, marketRequest marketRequest) (market, error) {
+	symbol := marketRequest.Symbol
+	query := "?symbol=" + url.QueryEscape(symbol)
+
+	tickerRequest, _ := http.NewRequest("GET", "https://api.binance.com/api/v3/ticker/24hr"+query, nil)
+	ticker, err := decodeJsonFromRequest[binanceTickerResponseJson](client, tickerRequest)
+	if err != nil {
+		return market{}, err
+	}
+
+	price, err := strconv.ParseFloat(ticker.LastPrice, 64)
+	if err != nil {
+		return market{}, fmt.Errorf("parsing price: %v", err)
+	}
+
+	change, _ := strconv.ParseFloat(ticker.PriceChangePercent, 64)
+
+	// each kline is an array of mixed values, the close price being the fifth one
+	klinesRequest, _ := http.NewRequest("GET", "https://api.binance.com/api/v3/klines"+query+"&interval=1d&limit="+strconv.Itoa(marketChartDays), nil)
+	klines, err := decodeJsonFromRequest[[][]any](client, klinesRequest)
+	if err != nil {
+		return market{}, fmt.Errorf("fetching chart: %v", err)
+	}
+
+	prices := make([]float64, 0, len(klines))
+	for _, kline := range klines {
+		if len(kline) < 5 {
+			continue
+		}
+
+		if value, ok := kline[4].(string); ok {
+			if closePrice, err := strconv.ParseFloat(value, 64); err == nil {
+				prices = append(prices, closePrice)
+			}
+		}
+	}
+
+	base, currency := symbol, ""
+	for _, quote := range binanceQuoteAssets {
+		if trimmed, found := strings.CutSuffix(symbol, quote); found && trimmed != "" {
+			base = trimmed
+			currency = ternary(binanceStablecoins[quote], "$", currencyToSymbol[quote])
+			break
+		}
+	}
+
+	return market{
+		marketRequest:  marketRequest,
+		Name:           ternary(marketRequest.CustomName == "", base, marketRequest.CustomName),
+		Currency:       currency,
+		Price:          price,
+		PriceHint:      binancePricePrecision(price),
+		PercentChange:  change,
+		SvgChartPoints: svgPolylineCoordsFromYValues(100, 50, prices),
+	}, nil
+}
+
+// Binance doesn't say how many decimals are worth showing, cheap coins need
+// more of them for the price to mean anything
+func binancePricePrecision(price float64) int {
+	switch {
+	case price >= 1:
+		return 2
+	case price >= 0.01:
+		return 4
+	default:
+		return 8
+	}
 }
 
 var currencyToSymbol = map[string]string{
@@ -0,0 +1,222 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var mealieWidgetTemplate = mustParseTemplate("mealie.html", "widget-base.html")
+
+// The order in which meals are shown within a day
+var mealieEntryTypes = []string{"breakfast", "lunch", "dinner", "side", "snack", "drink", "dessert"}
+
+type mealieWidget struct {
+	widgetBase        `yaml:",inline"`
+	URL               string      `yaml:"url"`
+	Token             string      `yaml:"token"`
+	AllowInsecure     bool        `yaml:"allow-insecure"`
+	HideShoppingList  bool        `yaml:"hide-shopping-list"`
+	HideThumbnails    bool        `yaml:"hide-thumbnails"`
+	Days              []mealieDay `yaml:"-"`
+	ShoppingListItems int         `yaml:"-"`
+	client            requestDoer `yaml:"-"`
+}
+
+type mealieDay struct {
+	Title string
+	Meals []mealieMeal
+}
+
+type mealieMeal struct {
+	Type     string
+	Name     string
+	URL      string
+	ImageURL string
+}
+
+type mealieMealPlanResponseJson struct {
+	Items []struct {
+		Date      string `json:"date"`
+		EntryType string `json:"entryType"`
+		Title     string `json:"title"`
+		Recipe    *struct {
+			ID    string `json:"id"`
+			Slug  string `json:"slug"`
+			Name  string `json:"name"`
+			Image string `json:"image"`
+		} `json:"recipe"`
+	} `json:"items"`
+}
+
+type mealieShoppingItemsResponseJson struct {
+	Total int `json:"total"`
+}
+
+type mealieGroupJson struct {
+	Slug string `json:"slug"`
+}
+
+func (widget *mealieWidget) initialize() error {
+	widget.withTitle("Meal Plan").withCacheDuration(30 * time.Minute)
+
+	if widget.URL == "" {
+		return errors.New("url is required")
+	}
+
+	if widget.Token == "" {
+		return errors.New("token is required")
+	}
+
+	widget.URL = strings.TrimRight(widget.URL, "/")
+	widget.client = widget.httpClient(ternary(widget.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient))
+
+	return nil
+}
+
+func (widget *mealieWidget) update(ctx context.Context) {
+	days, shoppingListItems, err := widget.fetchMealPlan(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Days = days
+	widget.ShoppingListItems = shoppingListItems
+}
+
+func (widget *mealieWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, mealieWidgetTemplate)
+}
+
+func (widget *mealieWidget) request(ctx context.Context, path string, query url.Values) *http.Request {
+	target := widget.URL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	request, _ := http.NewRequestWithContext(ctx, "GET", target, nil)
+	request.Header.Set("Authorization", "Bearer "+widget.Token)
+
+	return request
+}
+
+func (widget *mealieWidget) fetchMealPlan(ctx context.Context) ([]mealieDay, int, error) {
+	now := time.Now()
+	today := now.Format(time.DateOnly)
+	tomorrow := now.AddDate(0, 0, 1).Format(time.DateOnly)
+
+	var (
+		wg            sync.WaitGroup
+		mealPlan      mealieMealPlanResponseJson
+		shoppingItems mealieShoppingItemsResponseJson
+		group         mealieGroupJson
+		mealPlanErr   error
+		shoppingErr   error
+		groupErr      error
+	)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		mealPlan, mealPlanErr = decodeJsonFromRequest[mealieMealPlanResponseJson](
+			widget.client,
+			widget.request(ctx, "/api/households/mealplans", url.Values{
+				"start_date": {today},
+				"end_date":   {tomorrow},
+				"perPage":    {"-1"},
+			}),
+		)
+	}()
+	// recipe pages are under the group's slug
+	go func() {
+		defer wg.Done()
+		group, groupErr = decodeJsonFromRequest[mealieGroupJson](widget.client, widget.request(ctx, "/api/groups/self", nil))
+	}()
+
+	if !widget.HideShoppingList {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			shoppingItems, shoppingErr = decodeJsonFromRequest[mealieShoppingItemsResponseJson](
+				widget.client,
+				widget.request(ctx, "/api/households/shopping/items", url.Values{
+					"queryFilter": {"checked = false"},
+					"perPage":     {"1"},
+				}),
+			)
+		}()
+	}
+
+	wg.Wait()
+
+	if mealPlanErr != nil {
+		return nil, 0, fmt.Errorf("%w: fetching meal plan: %v", errNoContent, mealPlanErr)
+	}
+
+	var partialErr error
+	if shoppingErr != nil {
+		partialErr = fmt.Errorf("%w: fetching shopping list: %v", errPartialContent, shoppingErr)
+	}
+
+	if groupErr != nil {
+		partialErr = fmt.Errorf("%w: fetching group: %v", errPartialContent, groupErr)
+	}
+
+	days := []mealieDay{{Title: "Today"}, {Title: "Tomorrow"}}
+
+	for i := range mealPlan.Items {
+		item := &mealPlan.Items[i]
+
+		var day *mealieDay
+		switch item.Date {
+		case today:
+			day = &days[0]
+		case tomorrow:
+			day = &days[1]
+		default:
+			continue
+		}
+
+		meal := mealieMeal{
+			Type: item.EntryType,
+			Name: item.Title,
+		}
+
+		if item.Recipe != nil {
+			meal.Name = item.Recipe.Name
+
+			if group.Slug != "" {
+				meal.URL = widget.URL + "/g/" + group.Slug + "/r/" + item.Recipe.Slug
+			}
+
+			if !widget.HideThumbnails && item.Recipe.Image != "" {
+				meal.ImageURL = widget.URL + "/api/media/recipes/" + item.Recipe.ID + "/images/min-original.webp"
+			}
+		}
+
+		day.Meals = append(day.Meals, meal)
+	}
+
+	for i := range days {
+		slices.SortStableFunc(days[i].Meals, func(a, b mealieMeal) int {
+			return mealieEntryTypeOrder(a.Type) - mealieEntryTypeOrder(b.Type)
+		})
+	}
+
+	return days, shoppingItems.Total, partialErr
+}
+
+func mealieEntryTypeOrder(entryType string) int {
+	if i := slices.Index(mealieEntryTypes, entryType); i != -1 {
+		return i
+	}
+
+	return len(mealieEntryTypes)
+}
@@ -3,10 +3,13 @@ package glance
 import (
 	"context"
 	"errors"
+	"fmt"
 	"html/template"
+	"net"
 	"net/http"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,28 +18,70 @@ var (
 	monitorWidgetCompactTemplate = mustParseTemplate("monitor-compact.html", "widget-base.html")
 )
 
+const monitorMaxStatusHistory = 100
+
 type monitorWidget struct {
 	widgetBase `yaml:",inline"`
 	Sites      []struct {
-		*SiteStatusRequest `yaml:",inline"`
-		Status             *siteStatus     `yaml:"-"`
-		URL                string          `yaml:"-"`
-		ErrorURL           string          `yaml:"error-url"`
-		Title              string          `yaml:"title"`
-		Icon               customIconField `yaml:"icon"`
-		SameTab            bool            `yaml:"same-tab"`
-		StatusText         string          `yaml:"-"`
-		StatusStyle        string          `yaml:"-"`
-		AltStatusCodes     []int           `yaml:"alt-status-codes"`
+		*SiteStatusRequest  `yaml:",inline"`
+		Status              *siteStatus     `yaml:"-"`
+		URL                 string          `yaml:"-"`
+		ErrorURL            string          `yaml:"error-url"`
+		Title               string          `yaml:"title"`
+		Icon                customIconField `yaml:"icon"`
+		SameTab             bool            `yaml:"same-tab"`
+		StatusText          string          `yaml:"-"`
+		StatusStyle         string          `yaml:"-"`
+		AltStatusCodes      []int           `yaml:"alt-status-codes"`
+		ExpectedStatusCodes []int           `yaml:"expected-status-codes"`
+		WakeOnLAN           *wakeOnLANField `yaml:"wake-on-lan"`
+		History             []monitorCheck  `yaml:"-"`
+		Uptime              int             `yaml:"-"`
+		LatencyChartPoints  string          `yaml:"-"`
+		okStatusCodes       []int
 	} `yaml:"sites"`
 	Style           string `yaml:"style"`
 	ShowFailingOnly bool   `yaml:"show-failing-only"`
+	StatusHistory   int    `yaml:"status-history"`
 	HasFailing      bool   `yaml:"-"`
 }
 
+// The result of a single check of a site, the last few are kept in memory
+// to show how the site has been doing recently
+type monitorCheck struct {
+	Time         time.Time
+	Up           bool
+	ResponseTime time.Duration
+	StatusText   string
+}
+
 func (widget *monitorWidget) initialize() error {
 	widget.withTitle("监控").withCacheDuration(5 * time.Minute)
 
+	if widget.StatusHistory < 0 || widget.StatusHistory > monitorMaxStatusHistory {
+		return fmt.Errorf("status-history must be between 0 and %d", monitorMaxStatusHistory)
+	}
+
+	for i := range widget.Sites {
+		site := &widget.Sites[i]
+		if site.SiteStatusRequest == nil {
+			return fmt.Errorf("site %q has no url", site.Title)
+		}
+
+		if site.isTCP() {
+			if _, _, err := net.SplitHostPort(strings.TrimPrefix(site.checkURL(), "tcp://")); err != nil {
+				return fmt.Errorf("site %q: tcp checks need a host and a port, such as tcp://192.168.1.2:22", site.Title)
+			}
+		}
+
+		// expected-status-codes replaces the default of 200 while alt-status-codes adds to it
+		if len(site.ExpectedStatusCodes) > 0 {
+			site.okStatusCodes = site.ExpectedStatusCodes
+		} else {
+			site.okStatusCodes = append([]int{200}, site.AltStatusCodes...)
+		}
+	}
+
 	return nil
 }
 
@@ -47,32 +92,77 @@ func (widget *monitorWidget) update(ctx context.Context) {
 		requests[i] = widget.Sites[i].SiteStatusRequest
 	}
 
-	statuses, err := fetchStatusForSites(requests)
+	statuses, err := fetchStatusForSites(widget.statusCheckClient(false), widget.statusCheckClient(true), requests)
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
 	}
 
 	widget.HasFailing = false
+	now := time.Now()
 
 	for i := range widget.Sites {
 		site := &widget.Sites[i]
 		status := &statuses[i]
 		site.Status = status
 
-		if !slices.Contains(site.AltStatusCodes, status.Code) && (status.Code >= 400 || status.Error != nil) {
+		var up bool
+		if site.isTCP() {
+			up = status.Error == nil
+			site.StatusText = "Open"
+		} else {
+			up = status.Error == nil && slices.Contains(site.okStatusCodes, status.Code)
+			site.StatusText = statusCodeToText(status.Code, site.okStatusCodes)
+		}
+
+		site.StatusStyle = ternary(up, "ok", "error")
+		if !up {
 			widget.HasFailing = true
 		}
 
 		if status.Error != nil && site.ErrorURL != "" {
 			site.URL = site.ErrorURL
+		} else if strings.HasPrefix(site.DefaultURL, "tcp://") {
+			// there's nothing to open in the browser
+			site.URL = ""
 		} else {
 			site.URL = site.DefaultURL
 		}
 
-		site.StatusText = statusCodeToText(status.Code, site.AltStatusCodes)
-		site.StatusStyle = statusCodeToStyle(status.Code, site.AltStatusCodes)
+		if widget.StatusHistory > 0 {
+			site.History = append(site.History, monitorCheck{
+				Time:         now,
+				Up:           up,
+				ResponseTime: status.ResponseTime,
+				StatusText:   siteStatusLabel(site.Status, site.StatusText),
+			})
+
+			if overflow := len(site.History) - widget.StatusHistory; overflow > 0 {
+				site.History = slices.Delete(site.History, 0, overflow)
+			}
+
+			site.Uptime, site.LatencyChartPoints = summarizeMonitorChecks(site.History)
+		}
+	}
+}
+
+// Returns the percentage of checks during which the site was up and the points
+// of a chart of the response times of those checks
+func summarizeMonitorChecks(checks []monitorCheck) (int, string) {
+	responseTimes := make([]float64, 0, len(checks))
+
+	for i := range checks {
+		if checks[i].Up {
+			responseTimes = append(responseTimes, float64(checks[i].ResponseTime.Milliseconds()))
+		}
+	}
+
+	if len(checks) == 0 {
+		return 0, ""
 	}
+
+	uptime := len(responseTimes) * 100 / len(checks)
+	return uptime, svgPolylineCoordsFromYValues(100, 20, responseTimes)
 }
 
 func (widget *monitorWidget) Render() template.HTML {
@@ -83,8 +173,31 @@ func (widget *monitorWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, monitorWidgetTemplate)
 }
 
-func statusCodeToText(status int, altStatusCodes []int) string {
-	if status == 200 || slices.Contains(altStatusCodes, status) {
+func (widget *monitorWidget) historySnapshot() map[string]string {
+	values := make(map[string]string, len(widget.Sites))
+
+	for i := range widget.Sites {
+		site := &widget.Sites[i]
+		if site.Status == nil {
+			continue
+		}
+
+		values[site.Title] = siteStatusLabel(site.Status, site.StatusText)
+	}
+
+	return values
+}
+
+func siteStatusLabel(status *siteStatus, statusText string) string {
+	if status.Error != nil {
+		return ternary(status.TimedOut, "Timed Out", "Error")
+	}
+
+	return statusText
+}
+
+func statusCodeToText(status int, okStatusCodes []int) string {
+	if slices.Contains(okStatusCodes, status) {
 		return "OK"
 	}
 	if status == 404 {
@@ -106,14 +219,6 @@ func statusCodeToText(status int, altStatusCodes []int) string {
 	return strconv.Itoa(status)
 }
 
-func statusCodeToStyle(status int, altStatusCodes []int) string {
-	if status == 200 || slices.Contains(altStatusCodes, status) {
-		return "ok"
-	}
-
-	return "error"
-}
-
 type SiteStatusRequest struct {
 	DefaultURL    string        `yaml:"url"`
 	CheckURL      string        `yaml:"check-url"`
@@ -125,6 +230,14 @@ type SiteStatusRequest struct {
 	} `yaml:"basic-auth"`
 }
 
+func (statusRequest *SiteStatusRequest) checkURL() string {
+	return ternary(statusRequest.CheckURL != "", statusRequest.CheckURL, statusRequest.DefaultURL)
+}
+
+func (statusRequest *SiteStatusRequest) isTCP() bool {
+	return strings.HasPrefix(statusRequest.checkURL(), "tcp://")
+}
+
 type siteStatus struct {
 	Code         int
 	TimedOut     bool
@@ -132,19 +245,29 @@ type siteStatus struct {
 	Error        error
 }
 
-func fetchSiteStatusTask(statusRequest *SiteStatusRequest) (siteStatus, error) {
-	var url string
-	if statusRequest.CheckURL != "" {
-		url = statusRequest.CheckURL
-	} else {
-		url = statusRequest.DefaultURL
+// Status checks only get retried when the widget asks for it, since retrying
+// would hide the very failures that they're meant to show
+func (w *widgetBase) statusCheckClient(allowInsecure bool) *requestClient {
+	client := ternary(allowInsecure, defaultInsecureHTTPClient, defaultHTTPClient)
+	return w.httpClient(client.withOptions(&requestOptions{Retries: new(int)}))
+}
+
+func fetchSiteStatusTask(client, insecureClient requestDoer) func(*SiteStatusRequest) (siteStatus, error) {
+	return func(statusRequest *SiteStatusRequest) (siteStatus, error) {
+		return fetchSiteStatus(ternary(statusRequest.AllowInsecure, insecureClient, client), statusRequest)
 	}
+}
 
+func fetchSiteStatus(client requestDoer, statusRequest *SiteStatusRequest) (siteStatus, error) {
 	timeout := ternary(statusRequest.Timeout > 0, time.Duration(statusRequest.Timeout), 3*time.Second)
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if statusRequest.isTCP() {
+		return fetchTCPPortStatus(ctx, strings.TrimPrefix(statusRequest.checkURL(), "tcp://")), nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, statusRequest.checkURL(), nil)
 	if err != nil {
 		return siteStatus{
 			Error: err,
@@ -156,14 +279,7 @@ func fetchSiteStatusTask(statusRequest *SiteStatusRequest) (siteStatus, error) {
 	}
 
 	requestSentAt := time.Now()
-	var response *http.Response
-
-	if !statusRequest.AllowInsecure {
-		response, err = defaultHTTPClient.Do(request)
-	} else {
-		response, err = defaultInsecureHTTPClient.Do(request)
-	}
-
+	response, err := client.Do(request)
 	status := siteStatus{ResponseTime: time.Since(requestSentAt)}
 
 	if err != nil {
@@ -182,8 +298,30 @@ func fetchSiteStatusTask(statusRequest *SiteStatusRequest) (siteStatus, error) {
 	return status, nil
 }
 
-func fetchStatusForSites(requests []*SiteStatusRequest) ([]siteStatus, error) {
-	job := newJob(fetchSiteStatusTask, requests).withWorkers(20)
+// The port is considered open as soon as a connection can be made, nothing
+// gets sent through it
+func fetchTCPPortStatus(ctx context.Context, address string) siteStatus {
+	dialer := net.Dialer{}
+	connectStartedAt := time.Now()
+	connection, err := dialer.DialContext(ctx, "tcp", address)
+	status := siteStatus{ResponseTime: time.Since(connectStartedAt)}
+
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			status.TimedOut = true
+		}
+
+		status.Error = err
+		return status
+	}
+
+	connection.Close()
+
+	return status
+}
+
+func fetchStatusForSites(client, insecureClient requestDoer, requests []*SiteStatusRequest) ([]siteStatus, error) {
+	job := newJob(fetchSiteStatusTask(client, insecureClient), requests).withWorkers(20)
 	results, _, err := workerPoolDo(job)
 	if err != nil {
 		return nil, err
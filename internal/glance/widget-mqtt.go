@@ -0,0 +1,274 @@
+package glance
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"gopkg.in/yaml.v3"
+)
+
+var mqttWidgetTemplate = mustParseTemplate("mqtt.html", "widget-base.html")
+
+const (
+	mqttKeepAlive           = 60 * time.Second
+	mqttMaxReconnectWait    = 5 * time.Minute
+	mqttMaxDisplayedPayload = 256
+)
+
+type mqttWidget struct {
+	widgetBase    `yaml:",inline"`
+	Broker        string            `yaml:"broker"`
+	Username      string            `yaml:"username"`
+	Password      string            `yaml:"password"`
+	ClientID      string            `yaml:"client-id"`
+	AllowInsecure bool              `yaml:"allow-insecure"`
+	Topics        []mqttTopicConfig `yaml:"topics"`
+
+	Values          []mqttTopicValue `yaml:"-"`
+	Connected       bool             `yaml:"-"`
+	ConnectionError string           `yaml:"-"`
+
+	address string
+	secure  bool
+	mu      sync.RWMutex
+}
+
+type mqttTopicConfig struct {
+	Topic    string `yaml:"topic"`
+	Title    string `yaml:"title"`
+	JSONPath string `yaml:"json-path"`
+	Unit     string `yaml:"unit"`
+	Decimals *int   `yaml:"decimals"`
+}
+
+func (t *mqttTopicConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&t.Topic)
+	}
+
+	type alias mqttTopicConfig
+	return node.Decode((*alias)(t))
+}
+
+type mqttTopicValue struct {
+	Title     string
+	Topic     string
+	Value     string
+	Unit      string
+	UpdatedAt time.Time
+}
+
+func (widget *mqttWidget) initialize() error {
+	widget.withTitle("MQTT").withError(nil)
+
+	if widget.Broker == "" {
+		return errors.New("broker is required")
+	}
+
+	address, secure, err := parseMQTTBrokerURL(widget.Broker)
+	if err != nil {
+		return fmt.Errorf("invalid broker: %v", err)
+	}
+
+	widget.address = address
+	widget.secure = secure
+
+	if len(widget.Topics) == 0 {
+		return errors.New("at least one topic is required")
+	}
+
+	if widget.ClientID == "" {
+		// brokers disconnect the older client when two connect with the same ID,
+		// which would happen when the same config gets loaded by multiple instances
+		suffix := make([]byte, 4)
+		rand.Read(suffix)
+		widget.ClientID = "glance-" + hex.EncodeToString(suffix)
+	}
+
+	widget.Values = make([]mqttTopicValue, len(widget.Topics))
+
+	for i := range widget.Topics {
+		topic := &widget.Topics[i]
+
+		if topic.Topic == "" {
+			return fmt.Errorf("topic #%d is empty", i+1)
+		}
+
+		if topic.Decimals != nil && (*topic.Decimals < 0 || *topic.Decimals > 10) {
+			return fmt.Errorf("decimals of topic %s must be between 0 and 10", topic.Topic)
+		}
+
+		widget.Values[i] = mqttTopicValue{
+			Title: ternary(topic.Title != "", topic.Title, topic.Topic),
+			Topic: topic.Topic,
+			Unit:  topic.Unit,
+		}
+	}
+
+	return nil
+}
+
+func (widget *mqttWidget) Render() template.HTML {
+	widget.mu.RLock()
+	defer widget.mu.RUnlock()
+
+	return widget.renderTemplate(widget, mqttWidgetTemplate)
+}
+
+func (widget *mqttWidget) runInBackground(ctx context.Context) {
+	wait := time.Second
+
+	for {
+		started := time.Now()
+		err := widget.watch(ctx)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		slog.Error("MQTT connection lost", "broker", widget.address, "error", err)
+		widget.setStatus(false, err)
+
+		// only back off when the connection keeps failing shortly after being made
+		if time.Since(started) > mqttMaxReconnectWait {
+			wait = time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		wait = min(wait*2, mqttMaxReconnectWait)
+	}
+}
+
+func (widget *mqttWidget) watch(ctx context.Context) error {
+	dialCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	conn, err := dialMQTT(dialCtx, widget.address, widget.secure, &mqttConnectOptions{
+		clientID:      widget.ClientID,
+		username:      widget.Username,
+		password:      widget.Password,
+		keepAlive:     mqttKeepAlive,
+		allowInsecure: widget.AllowInsecure,
+	})
+	cancel()
+	if err != nil {
+		return fmt.Errorf("connecting: %v", err)
+	}
+
+	// closing the connection is what unblocks receive when the context gets cancelled
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(mqttKeepAlive / 2)
+		defer ticker.Stop()
+		defer conn.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := conn.ping(); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	filters := make([]string, 0, len(widget.Topics))
+	for i := range widget.Topics {
+		filters = append(filters, widget.Topics[i].Topic)
+	}
+
+	if err := conn.subscribe(1, filters); err != nil {
+		return fmt.Errorf("subscribing: %v", err)
+	}
+
+	widget.setStatus(true, nil)
+
+	for {
+		message, err := conn.receive(mqttKeepAlive * 3 / 2)
+		if err != nil {
+			return err
+		}
+
+		widget.handleMessage(&message)
+	}
+}
+
+func (widget *mqttWidget) handleMessage(message *mqttMessage) {
+	now := time.Now()
+
+	for i := range widget.Topics {
+		config := &widget.Topics[i]
+
+		if !mqttTopicMatches(config.Topic, message.topic) {
+			continue
+		}
+
+		value, ok := formatMQTTPayload(message.payload, config)
+		if !ok {
+			continue
+		}
+
+		widget.mu.Lock()
+		widget.Values[i].Value = value
+		widget.Values[i].UpdatedAt = now
+		widget.mu.Unlock()
+
+		widget.notifyChanged()
+	}
+}
+
+func (widget *mqttWidget) setStatus(connected bool, err error) {
+	widget.mu.Lock()
+	widget.Connected = connected
+	widget.ConnectionError = ""
+	if err != nil {
+		widget.ConnectionError = err.Error()
+	}
+	widget.mu.Unlock()
+
+	widget.notifyChanged()
+}
+
+func formatMQTTPayload(payload []byte, config *mqttTopicConfig) (string, bool) {
+	var value string
+
+	if config.JSONPath != "" {
+		result := gjson.GetBytes(payload, config.JSONPath)
+		if !result.Exists() {
+			return "", false
+		}
+
+		value = result.String()
+	} else {
+		value = strings.TrimSpace(string(payload))
+	}
+
+	if config.Decimals != nil {
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			value = strconv.FormatFloat(number, 'f', *config.Decimals, 64)
+		}
+	}
+
+	value, _ = limitStringLength(value, mqttMaxDisplayedPayload)
+
+	return value, true
+}
@@ -0,0 +1,234 @@
+package glance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var notesWidgetTemplate = mustParseTemplate("notes.html", "widget-base.html")
+
+const (
+	notesDefaultMaxRevisions = 20
+	notesMaxContentLength    = 256 * 1024
+)
+
+type notesWidget struct {
+	widgetBase   `yaml:",inline"`
+	NoteID       string        `yaml:"id"`
+	Default      string        `yaml:"default"`
+	Locked       bool          `yaml:"locked"`
+	Editors      []string      `yaml:"editors"`
+	MaxRevisions int           `yaml:"max-revisions"`
+	ContentHTML  template.HTML `yaml:"-"`
+	mu           sync.Mutex    `yaml:"-"`
+}
+
+type noteState struct {
+	Content   string         `json:"content"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	UpdatedBy string         `json:"updated_by,omitempty"`
+	Revisions []noteRevision `json:"revisions"`
+}
+
+type noteRevision struct {
+	Content string    `json:"content"`
+	SavedAt time.Time `json:"saved_at"`
+	SavedBy string    `json:"saved_by,omitempty"`
+}
+
+type noteResponse struct {
+	Content   string        `json:"content"`
+	HTML      template.HTML `json:"html"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	UpdatedBy string        `json:"updated_by,omitempty"`
+	Editable  bool          `json:"editable"`
+}
+
+func (widget *notesWidget) initialize() error {
+	widget.withTitle("笔记").withError(nil)
+
+	if widget.NoteID == "" {
+		return errors.New("id is required, it's used to store the note")
+	}
+
+	if widget.MaxRevisions == 0 {
+		widget.MaxRevisions = notesDefaultMaxRevisions
+	} else if widget.MaxRevisions < 0 {
+		widget.MaxRevisions = 0
+	}
+
+	return nil
+}
+
+func (widget *notesWidget) Render() template.HTML {
+	state, _ := widget.load()
+	widget.ContentHTML = renderMarkdown(state.Content)
+
+	return widget.renderTemplate(widget, notesWidgetTemplate)
+}
+
+func (widget *notesWidget) NoteURL() string {
+	if widget.Providers == nil {
+		return ""
+	}
+
+	return widget.Providers.baseURL + "/api/widgets/" + strconv.FormatUint(widget.ID, 10)
+}
+
+// Whether anyone at all could edit the note, the exact check happens once a request comes in
+func (widget *notesWidget) MaybeEditable() bool {
+	return !widget.Locked || (widget.Providers != nil && widget.Providers.usernameFromRequest != nil)
+}
+
+func (widget *notesWidget) storeKey() string {
+	return "notes:" + widget.NoteID
+}
+
+func (widget *notesWidget) load() (noteState, error) {
+	state := noteState{Content: widget.Default}
+
+	if widget.Providers == nil || widget.Providers.store == nil {
+		return state, nil
+	}
+
+	if _, err := widget.Providers.store.get(widget.storeKey(), &state); err != nil {
+		return state, err
+	}
+
+	return state, nil
+}
+
+func (widget *notesWidget) canEdit(r *http.Request) (string, bool) {
+	if widget.Providers.usernameFromRequest == nil {
+		return "", !widget.Locked
+	}
+
+	username, ok := widget.Providers.usernameFromRequest(r)
+	if !ok {
+		return "", false
+	}
+
+	if widget.Locked && len(widget.Editors) > 0 && !slices.Contains(widget.Editors, username) {
+		return username, false
+	}
+
+	return username, true
+}
+
+func (widget *notesWidget) handleRequest(w http.ResponseWriter, r *http.Request) {
+	path := r.PathValue("path")
+	username, editable := widget.canEdit(r)
+
+	switch {
+	case path == "note" && r.Method == http.MethodGet:
+		state, err := widget.load()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeNoteResponse(w, state, editable)
+	case path == "note" && r.Method == http.MethodPut:
+		if !editable {
+			http.Error(w, "this note is locked", http.StatusForbidden)
+			return
+		}
+
+		widget.handleSaveRequest(w, r, username)
+	case path == "revisions" && r.Method == http.MethodGet:
+		state, err := widget.load()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state.Revisions)
+	case path == "note" || path == "revisions":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func (widget *notesWidget) handleSaveRequest(w http.ResponseWriter, r *http.Request, username string) {
+	var request struct {
+		Content string `json:"content"`
+		// The version the edit was based on, used to avoid overwriting changes made elsewhere
+		UpdatedAt *time.Time `json:"updated_at"`
+	}
+
+	body := http.MaxBytesReader(w, r.Body, notesMaxContentLength+1024)
+	if err := json.NewDecoder(body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(request.Content) > notesMaxContentLength {
+		http.Error(w, "note is too long", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if widget.Providers.store == nil {
+		http.Error(w, "state store is not available", http.StatusInternalServerError)
+		return
+	}
+
+	widget.mu.Lock()
+	defer widget.mu.Unlock()
+
+	state, err := widget.load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if request.UpdatedAt != nil && !request.UpdatedAt.Equal(state.UpdatedAt) {
+		http.Error(w, "the note was changed elsewhere, reload it before saving", http.StatusConflict)
+		return
+	}
+
+	if request.Content != state.Content {
+		if !state.UpdatedAt.IsZero() && widget.MaxRevisions > 0 {
+			state.Revisions = slices.Insert(state.Revisions, 0, noteRevision{
+				Content: state.Content,
+				SavedAt: state.UpdatedAt,
+				SavedBy: state.UpdatedBy,
+			})
+		}
+
+		if len(state.Revisions) > widget.MaxRevisions {
+			state.Revisions = state.Revisions[:widget.MaxRevisions]
+		}
+
+		state.Content = request.Content
+		state.UpdatedAt = time.Now().UTC()
+		state.UpdatedBy = username
+
+		if err := widget.Providers.store.set(widget.storeKey(), state); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeNoteResponse(w, state, true)
+}
+
+func writeNoteResponse(w http.ResponseWriter, state noteState, editable bool) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(noteResponse{
+		Content:   state.Content,
+		HTML:      renderMarkdown(state.Content),
+		UpdatedAt: state.UpdatedAt,
+		UpdatedBy: state.UpdatedBy,
+		Editable:  editable,
+	})
+}
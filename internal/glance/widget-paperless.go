@@ -0,0 +1,252 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var paperlessWidgetTemplate = mustParseTemplate("paperless.html", "widget-base.html")
+
+const (
+	paperlessThumbnailCacheTime  = 24 * time.Hour
+	paperlessMaxCachedThumbnails = 100
+)
+
+type paperlessWidget struct {
+	widgetBase     `yaml:",inline"`
+	URL            string           `yaml:"url"`
+	Token          string           `yaml:"token"`
+	AllowInsecure  bool             `yaml:"allow-insecure"`
+	Limit          int              `yaml:"limit"`
+	HideThumbnails bool             `yaml:"hide-thumbnails"`
+	Status         *paperlessStatus `yaml:"-"`
+	client         requestDoer      `yaml:"-"`
+	thumbnails     *tileCache       `yaml:"-"`
+	// Only thumbnails of documents which are currently shown get proxied,
+	// otherwise the endpoint could be used to fetch any document's thumbnail
+	allowedThumbnails map[int]bool `yaml:"-"`
+	mu                sync.Mutex   `yaml:"-"`
+}
+
+type paperlessStatus struct {
+	Documents     []paperlessDocument
+	Total         int
+	InboxCount    int
+	HasInbox      bool
+	UntaggedCount int
+}
+
+type paperlessDocument struct {
+	ID            int
+	Title         string
+	Added         time.Time
+	Correspondent string
+	URL           string
+}
+
+type paperlessDocumentsResponseJson struct {
+	Count   int `json:"count"`
+	Results []struct {
+		ID            int       `json:"id"`
+		Title         string    `json:"title"`
+		Added         time.Time `json:"added"`
+		Correspondent *int      `json:"correspondent"`
+	} `json:"results"`
+}
+
+type paperlessCorrespondentsResponseJson struct {
+	Results []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"results"`
+}
+
+func (widget *paperlessWidget) initialize() error {
+	widget.withTitle("Paperless").withCacheDuration(5 * time.Minute)
+
+	if widget.URL == "" {
+		return errors.New("url is required")
+	}
+
+	if widget.Token == "" {
+		return errors.New("token is required")
+	}
+
+	widget.URL = strings.TrimRight(widget.URL, "/")
+
+	if widget.Limit <= 0 {
+		widget.Limit = 5
+	}
+
+	widget.client = widget.httpClient(ternary(widget.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient))
+	widget.thumbnails = newTileCache(paperlessMaxCachedThumbnails)
+	widget.thumbnails.client = widget.client
+	widget.thumbnails.headers = map[string]string{"Authorization": "Token " + widget.Token}
+
+	return nil
+}
+
+func (widget *paperlessWidget) update(ctx context.Context) {
+	status, err := widget.fetchStatus(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	allowedThumbnails := make(map[int]bool, len(status.Documents))
+	for i := range status.Documents {
+		allowedThumbnails[status.Documents[i].ID] = true
+	}
+
+	widget.mu.Lock()
+	widget.allowedThumbnails = allowedThumbnails
+	widget.mu.Unlock()
+
+	widget.Status = status
+}
+
+func (widget *paperlessWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, paperlessWidgetTemplate)
+}
+
+func (widget *paperlessWidget) ThumbnailsURL() string {
+	if widget.HideThumbnails || widget.Providers == nil {
+		return ""
+	}
+
+	return widget.Providers.baseURL + "/api/widgets/" + strconv.FormatUint(widget.ID, 10) + "/thumbnails"
+}
+
+func (widget *paperlessWidget) request(ctx context.Context, path string, query url.Values) *http.Request {
+	request, _ := http.NewRequestWithContext(ctx, "GET", widget.URL+path+"?"+query.Encode(), nil)
+	request.Header.Set("Authorization", "Token "+widget.Token)
+	request.Header.Set("Accept", "application/json")
+
+	return request
+}
+
+func (widget *paperlessWidget) fetchStatus(ctx context.Context) (*paperlessStatus, error) {
+	requests := []*http.Request{
+		widget.request(ctx, "/api/documents/", url.Values{
+			"ordering":         {"-added"},
+			"page_size":        {strconv.Itoa(widget.Limit)},
+			"truncate_content": {"true"},
+		}),
+		widget.request(ctx, "/api/documents/", url.Values{
+			"tags__is_inbox_tag": {"true"},
+			"page_size":          {"1"},
+		}),
+		widget.request(ctx, "/api/documents/", url.Values{
+			"is_tagged": {"false"},
+			"page_size": {"1"},
+		}),
+	}
+
+	job := newJob(decodeJsonFromRequestTask[paperlessDocumentsResponseJson](widget.client), requests)
+	responses, errs, err := workerPoolDo(job)
+	if err != nil {
+		return nil, err
+	}
+
+	if errs[0] != nil {
+		return nil, fmt.Errorf("%w: fetching documents: %v", errNoContent, errs[0])
+	}
+
+	var partialErr error
+	status := &paperlessStatus{Total: responses[0].Count}
+
+	// an instance without an inbox tag matches every document, which isn't
+	// a useful number to show
+	if errs[1] != nil {
+		partialErr = fmt.Errorf("%w: fetching inbox count: %v", errPartialContent, errs[1])
+	} else if responses[1].Count < status.Total {
+		status.HasInbox = true
+		status.InboxCount = responses[1].Count
+	}
+
+	if errs[2] != nil {
+		partialErr = fmt.Errorf("%w: fetching untagged count: %v", errPartialContent, errs[2])
+	} else {
+		status.UntaggedCount = responses[2].Count
+	}
+
+	correspondentIDs := make([]string, 0)
+	for _, document := range responses[0].Results {
+		if document.Correspondent != nil {
+			correspondentIDs = append(correspondentIDs, strconv.Itoa(*document.Correspondent))
+		}
+	}
+
+	correspondents := make(map[int]string)
+	if len(correspondentIDs) > 0 {
+		request := widget.request(ctx, "/api/correspondents/", url.Values{
+			"id__in":    {strings.Join(correspondentIDs, ",")},
+			"page_size": {strconv.Itoa(len(correspondentIDs))},
+		})
+
+		response, err := decodeJsonFromRequest[paperlessCorrespondentsResponseJson](widget.client, request)
+		if err != nil {
+			partialErr = fmt.Errorf("%w: fetching correspondents: %v", errPartialContent, err)
+		} else {
+			for _, correspondent := range response.Results {
+				correspondents[correspondent.ID] = correspondent.Name
+			}
+		}
+	}
+
+	status.Documents = make([]paperlessDocument, 0, len(responses[0].Results))
+	for _, result := range responses[0].Results {
+		document := paperlessDocument{
+			ID:    result.ID,
+			Title: result.Title,
+			Added: result.Added,
+			URL:   widget.URL + "/documents/" + strconv.Itoa(result.ID) + "/details",
+		}
+
+		if result.Correspondent != nil {
+			document.Correspondent = correspondents[*result.Correspondent]
+		}
+
+		status.Documents = append(status.Documents, document)
+	}
+
+	return status, partialErr
+}
+
+func (widget *paperlessWidget) handleRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path, found := strings.CutPrefix(r.PathValue("path"), "thumbnails/")
+	id, err := strconv.Atoi(path)
+
+	widget.mu.Lock()
+	allowed := widget.allowedThumbnails[id]
+	widget.mu.Unlock()
+
+	if !found || err != nil || !allowed {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	upstreamURL := widget.URL + "/api/documents/" + strconv.Itoa(id) + "/thumb/"
+	thumbnail, err := widget.thumbnails.get(r.Context(), upstreamURL, paperlessThumbnailCacheTime)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", thumbnail.contentType)
+	// the thumbnails require authentication, so they shouldn't end up in shared caches
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(paperlessThumbnailCacheTime.Seconds())))
+	w.Write(thumbnail.data)
+}
@@ -0,0 +1,412 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var radarWidgetTemplate = mustParseTemplate("radar.html", "widget-base.html")
+
+const (
+	radarTileSize           = 256
+	radarDefaultTileURL     = "https://tile.openstreetmap.org/{z}/{x}/{y}.png"
+	radarRainViewerMapsURL  = "https://api.rainviewer.com/public/weather-maps.json"
+	radarMapTileCacheTime   = 7 * 24 * time.Hour
+	radarFrameTileCacheTime = 2 * time.Hour
+	radarMaxCachedTiles     = 1000
+	radarMaxTileSize        = 2 * 1024 * 1024
+)
+
+type radarWidget struct {
+	widgetBase `yaml:",inline"`
+	Location   string       `yaml:"location"`
+	Latitude   float64      `yaml:"latitude"`
+	Longitude  float64      `yaml:"longitude"`
+	Zoom       int          `yaml:"zoom"`
+	Height     int          `yaml:"height"`
+	ShowRadar  *bool        `yaml:"show-radar"`
+	RadarColor int          `yaml:"radar-color"`
+	TileURL    string       `yaml:"tile-url"`
+	Tiles      []radarTile  `yaml:"-"`
+	Frames     []radarFrame `yaml:"-"`
+	located    bool         `yaml:"-"`
+	// Only tiles which are part of the map get proxied, otherwise the
+	// endpoint could be used to fetch anything from the tile servers
+	allowedTiles   map[[2]int]bool  `yaml:"-"`
+	framePaths     map[int64]string `yaml:"-"`
+	rainViewerHost string           `yaml:"-"`
+	tiles          *tileCache       `yaml:"-"`
+	// Guards the fields above which are also used when proxying tiles
+	mu sync.Mutex `yaml:"-"`
+}
+
+type radarTile struct {
+	X    int
+	Y    int
+	Left int
+	Top  int
+}
+
+type radarFrame struct {
+	Time   int64
+	Latest bool
+}
+
+type rainViewerMapsResponseJson struct {
+	Host  string `json:"host"`
+	Radar struct {
+		Past []struct {
+			Time int64  `json:"time"`
+			Path string `json:"path"`
+		} `json:"past"`
+	} `json:"radar"`
+}
+
+func (widget *radarWidget) initialize() error {
+	widget.withTitle("天气雷达").withCacheDuration(10 * time.Minute)
+
+	widget.located = widget.Latitude != 0 || widget.Longitude != 0
+
+	if !widget.located && widget.Location == "" {
+		return errors.New("either location or latitude and longitude are required")
+	}
+
+	if widget.Latitude < -85 || widget.Latitude > 85 || widget.Longitude < -180 || widget.Longitude > 180 {
+		return errors.New("latitude must be between -85 and 85 and longitude between -180 and 180")
+	}
+
+	if widget.Zoom == 0 {
+		widget.Zoom = 7
+	} else if widget.Zoom < 2 || widget.Zoom > 12 {
+		return errors.New("zoom must be between 2 and 12")
+	}
+
+	if widget.Height == 0 {
+		widget.Height = 250
+	} else if widget.Height < 100 || widget.Height > 600 {
+		return errors.New("height must be between 100 and 600")
+	}
+
+	if widget.ShowRadar == nil {
+		widget.ShowRadar = new(bool)
+		*widget.ShowRadar = true
+	}
+
+	if widget.RadarColor == 0 {
+		widget.RadarColor = 2
+	}
+
+	if widget.TileURL == "" {
+		widget.TileURL = radarDefaultTileURL
+	} else if !strings.Contains(widget.TileURL, "{x}") || !strings.Contains(widget.TileURL, "{y}") || !strings.Contains(widget.TileURL, "{z}") {
+		return errors.New("tile-url must contain {x}, {y} and {z}")
+	}
+
+	widget.tiles = newTileCache(radarMaxCachedTiles)
+
+	if widget.located {
+		widget.computeTiles()
+	}
+
+	return nil
+}
+
+func (widget *radarWidget) update(ctx context.Context) {
+	if !widget.located {
+		place, err := fetchOpenMeteoPlaceFromName(widget.httpClient(defaultHTTPClient), widget.Location)
+		if err != nil {
+			widget.withError(err).scheduleEarlyUpdate()
+			return
+		}
+
+		widget.Latitude = place.Latitude
+		widget.Longitude = place.Longitude
+		widget.located = true
+		widget.computeTiles()
+	}
+
+	if !*widget.ShowRadar {
+		widget.withError(nil).scheduleNextUpdate()
+		return
+	}
+
+	request, _ := http.NewRequestWithContext(ctx, "GET", radarRainViewerMapsURL, nil)
+	maps, err := decodeJsonFromRequest[rainViewerMapsResponseJson](widget.httpClient(defaultHTTPClient), request)
+	if err == nil && len(maps.Radar.Past) == 0 {
+		err = errors.New("no radar frames available")
+	}
+
+	// the map is still useful without the radar, so this isn't treated as an error
+	if err != nil {
+		widget.withError(nil).withNotice(fmt.Errorf("radar: %v", err)).scheduleEarlyUpdate()
+		return
+	}
+
+	widget.withNotice(nil).withError(nil).scheduleNextUpdate()
+
+	// the frames are 10 minutes apart, only keep the ones from the last hour
+	latest := maps.Radar.Past[len(maps.Radar.Past)-1].Time
+	frames := make([]radarFrame, 0, 7)
+	paths := make(map[int64]string, 7)
+
+	for _, frame := range maps.Radar.Past {
+		if frame.Time < latest-3600 {
+			continue
+		}
+
+		frames = append(frames, radarFrame{Time: frame.Time, Latest: frame.Time == latest})
+		paths[frame.Time] = frame.Path
+	}
+
+	widget.mu.Lock()
+	widget.Frames = frames
+	widget.framePaths = paths
+	widget.rainViewerHost = maps.Host
+	widget.mu.Unlock()
+}
+
+func (widget *radarWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, radarWidgetTemplate)
+}
+
+func (widget *radarWidget) TilesURL() string {
+	if widget.Providers == nil {
+		return ""
+	}
+
+	return widget.Providers.baseURL + "/api/widgets/" + strconv.FormatUint(widget.ID, 10)
+}
+
+func (widget *radarWidget) Attribution() string {
+	credits := make([]string, 0, 2)
+
+	if widget.TileURL == radarDefaultTileURL {
+		credits = append(credits, "© OpenStreetMap contributors")
+	}
+
+	if len(widget.Frames) > 0 {
+		credits = append(credits, "RainViewer")
+	}
+
+	return strings.Join(credits, " · ")
+}
+
+// Lays out enough tiles around the center to cover the widget in a full size column
+func (widget *radarWidget) computeTiles() {
+	n := math.Exp2(float64(widget.Zoom))
+	latitude := widget.Latitude * math.Pi / 180
+
+	centerX := (widget.Longitude + 180) / 360 * n * radarTileSize
+	centerY := (1 - math.Log(math.Tan(latitude)+1/math.Cos(latitude))/math.Pi) / 2 * n * radarTileSize
+
+	tileX := int(centerX / radarTileSize)
+	tileY := int(centerY / radarTileSize)
+	radiusX := 3
+	radiusY := int(math.Ceil(float64(widget.Height)/2/radarTileSize)) + 1
+
+	tiles := make([]radarTile, 0)
+	allowedTiles := make(map[[2]int]bool)
+
+	for dy := -radiusY; dy <= radiusY; dy++ {
+		y := tileY + dy
+		if y < 0 || y >= int(n) {
+			continue
+		}
+
+		for dx := -radiusX; dx <= radiusX; dx++ {
+			// wraps around the antimeridian
+			x := ((tileX+dx)%int(n) + int(n)) % int(n)
+
+			tiles = append(tiles, radarTile{
+				X:    x,
+				Y:    y,
+				Left: int(math.Round(float64((tileX+dx)*radarTileSize) - centerX)),
+				Top:  int(math.Round(float64(y*radarTileSize) - centerY)),
+			})
+			allowedTiles[[2]int{x, y}] = true
+		}
+	}
+
+	widget.mu.Lock()
+	widget.Tiles = tiles
+	widget.allowedTiles = allowedTiles
+	widget.mu.Unlock()
+}
+
+func (widget *radarWidget) handleRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimSuffix(r.PathValue("path"), ".png"), "/")
+
+	widget.mu.Lock()
+	upstreamURL, cacheFor := widget.upstreamTileURL(parts)
+	widget.mu.Unlock()
+
+	if upstreamURL == "" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	tile, err := widget.tiles.get(r.Context(), upstreamURL, cacheFor)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", tile.contentType)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(cacheFor.Seconds())))
+	w.Write(tile.data)
+}
+
+// Must be called with the lock held
+func (widget *radarWidget) upstreamTileURL(parts []string) (string, time.Duration) {
+	var upstreamURL string
+	var cacheFor time.Duration
+
+	switch {
+	case len(parts) == 4 && parts[0] == "tiles":
+		x, y, ok := widget.parseTile(parts[1:])
+		if !ok {
+			break
+		}
+
+		upstreamURL = strings.NewReplacer(
+			"{z}", strconv.Itoa(widget.Zoom),
+			"{x}", strconv.Itoa(x),
+			"{y}", strconv.Itoa(y),
+		).Replace(widget.TileURL)
+		cacheFor = radarMapTileCacheTime
+	case len(parts) == 5 && parts[0] == "radar":
+		frameTime, err := strconv.ParseInt(parts[1], 10, 64)
+		path, exists := widget.framePaths[frameTime]
+		if err != nil || !exists {
+			break
+		}
+
+		x, y, ok := widget.parseTile(parts[2:])
+		if !ok {
+			break
+		}
+
+		upstreamURL = fmt.Sprintf(
+			"%s%s/%d/%d/%d/%d/%d/1_1.png",
+			widget.rainViewerHost, path, radarTileSize, widget.Zoom, x, y, widget.RadarColor,
+		)
+		cacheFor = radarFrameTileCacheTime
+	}
+
+	return upstreamURL, cacheFor
+}
+
+func (widget *radarWidget) parseTile(parts []string) (int, int, bool) {
+	z, errZ := strconv.Atoi(parts[0])
+	x, errX := strconv.Atoi(parts[1])
+	y, errY := strconv.Atoi(parts[2])
+
+	if errZ != nil || errX != nil || errY != nil || z != widget.Zoom || !widget.allowedTiles[[2]int{x, y}] {
+		return 0, 0, false
+	}
+
+	return x, y, true
+}
+
+type cachedTile struct {
+	data        []byte
+	contentType string
+	expiresAt   time.Time
+}
+
+type tileCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*cachedTile
+	client     requestDoer
+	// Sent along with every upstream request, e.g. for authentication
+	headers map[string]string
+}
+
+func newTileCache(maxEntries int) *tileCache {
+	return &tileCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*cachedTile),
+		client:     defaultHTTPClient,
+	}
+}
+
+func (c *tileCache) get(ctx context.Context, url string, cacheFor time.Duration) (*cachedTile, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	tile, exists := c.entries[url]
+	c.mu.Unlock()
+
+	if exists && now.Before(tile.expiresAt) {
+		return tile, nil
+	}
+
+	request, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	// required by the tile usage policy of OpenStreetMap
+	request.Header.Set("User-Agent", glanceUserAgentString)
+	for key, value := range c.headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("fetching tile: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d while fetching tile", response.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, radarMaxTileSize))
+	if err != nil {
+		return nil, fmt.Errorf("reading tile: %v", err)
+	}
+
+	tile = &cachedTile{
+		data:        data,
+		contentType: response.Header.Get("Content-Type"),
+		expiresAt:   now.Add(cacheFor),
+	}
+
+	if !strings.HasPrefix(tile.contentType, "image/") {
+		tile.contentType = "image/png"
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= c.maxEntries {
+		for key, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, key)
+			}
+		}
+
+		// still full, make room by dropping whatever comes first
+		for key := range c.entries {
+			if len(c.entries) < c.maxEntries {
+				break
+			}
+			delete(c.entries, key)
+		}
+	}
+
+	c.entries[url] = tile
+	return tile, nil
+}
@@ -8,6 +8,8 @@ import (
 	"html/template"
 	"net/http"
 	"net/url"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -34,6 +36,9 @@ type redditWidget struct {
 	Limit               int               `yaml:"limit"`
 	CollapseAfter       int               `yaml:"collapse-after"`
 	RequestURLTemplate  string            `yaml:"request-url-template"`
+	Subreddits          []string          `yaml:"subreddits"`
+	IncludeFlairs       []string          `yaml:"include-flairs"`
+	ExcludeFlairs       []string          `yaml:"exclude-flairs"`
 
 	AppAuth struct {
 		Name   string `yaml:"name"`
@@ -46,11 +51,31 @@ type redditWidget struct {
 	} `yaml:"app-auth"`
 }
 
+var subredditNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
 func (widget *redditWidget) initialize() error {
-	if widget.Subreddit == "" {
+	subreddits := make([]string, 0, len(widget.Subreddits)+1)
+	for _, subreddit := range append([]string{widget.Subreddit}, widget.Subreddits...) {
+		subreddit = strings.TrimPrefix(strings.TrimSpace(subreddit), "r/")
+		if subreddit == "" || slices.Contains(subreddits, subreddit) {
+			continue
+		}
+
+		if !subredditNamePattern.MatchString(subreddit) {
+			return fmt.Errorf("invalid subreddit name %q", subreddit)
+		}
+
+		subreddits = append(subreddits, subreddit)
+	}
+
+	if len(subreddits) == 0 {
 		return errors.New("subreddit is required")
 	}
 
+	// reddit combines subreddits joined with a plus into a single listing
+	widget.Subreddits = subreddits
+	widget.Subreddit = strings.Join(subreddits, "+")
+
 	if widget.Limit <= 0 {
 		widget.Limit = 15
 	}
@@ -139,6 +164,7 @@ type subredditResponseJson struct {
 				IsSelf        bool    `json:"is_self"`
 				Thumbnail     string  `json:"thumbnail"`
 				Flair         string  `json:"link_flair_text"`
+				Subreddit     string  `json:"subreddit"`
 				ParentList    []struct {
 					Id        string `json:"id"`
 					Subreddit string `json:"subreddit"`
@@ -158,7 +184,7 @@ func (widget *redditWidget) parseCustomCommentsURL(subreddit, postId, postPath s
 }
 
 func (widget *redditWidget) fetchSubredditPosts() (forumPostList, error) {
-	var client requestDoer = defaultHTTPClient
+	var client requestDoer = widget.httpClient(defaultHTTPClient)
 	var baseURL string
 	var requestURL string
 	var headers http.Header
@@ -189,7 +215,12 @@ func (widget *redditWidget) fetchSubredditPosts() (forumPostList, error) {
 		query.Set("limit", strconv.Itoa(widget.Limit))
 	}
 
-	if widget.Search != "" {
+	if widget.Search != "" && len(widget.Subreddits) > 1 {
+		query.Set("q", widget.Search)
+		query.Set("restrict_sr", "on")
+		query.Set("sort", widget.SortBy)
+		requestURL = fmt.Sprintf("%s/r/%s/search.json?%s", baseURL, widget.Subreddit, query.Encode())
+	} else if widget.Search != "" {
 		query.Set("q", widget.Search+" subreddit:"+widget.Subreddit)
 		query.Set("sort", widget.SortBy)
 		requestURL = fmt.Sprintf("%s/search.json?%s", baseURL, query.Encode())
@@ -230,12 +261,17 @@ func (widget *redditWidget) fetchSubredditPosts() (forumPostList, error) {
 			continue
 		}
 
+		if !widget.isFlairAllowed(post.Flair) {
+			continue
+		}
+
 		var commentsUrl string
 
 		if widget.CommentsURLTemplate == "" {
 			commentsUrl = "https://www.reddit.com" + post.Permalink
 		} else {
-			commentsUrl = widget.parseCustomCommentsURL(widget.Subreddit, post.Id, post.Permalink)
+			subreddit := ternary(post.Subreddit != "", post.Subreddit, widget.Subreddit)
+			commentsUrl = widget.parseCustomCommentsURL(subreddit, post.Id, post.Permalink)
 		}
 
 		forumPost := forumPost{
@@ -247,12 +283,16 @@ func (widget *redditWidget) fetchSubredditPosts() (forumPostList, error) {
 			TimePosted:      time.Unix(int64(post.Time), 0),
 		}
 
-		if post.Thumbnail != "" && post.Thumbnail != "self" && post.Thumbnail != "default" && post.Thumbnail != "nsfw" {
-			forumPost.ThumbnailUrl = html.UnescapeString(post.Thumbnail)
+		// can also be one of self, default, nsfw, spoiler or image
+		if strings.HasPrefix(post.Thumbnail, "http") {
+			forumPost.ThumbnailUrl = globalImageCache.GetCachedImageURL(html.UnescapeString(post.Thumbnail))
 		}
 
 		if !post.IsSelf {
 			forumPost.TargetUrl = post.Url
+		} else if post.Subreddit != "" {
+			// shown in place of the domain by the card styles
+			forumPost.TargetUrlDomain = "r/" + post.Subreddit
 		}
 
 		if widget.ShowFlairs && post.Flair != "" {
@@ -280,6 +320,20 @@ func (widget *redditWidget) fetchSubredditPosts() (forumPostList, error) {
 	return posts, nil
 }
 
+func (widget *redditWidget) isFlairAllowed(flair string) bool {
+	matches := func(flairs []string) bool {
+		return slices.ContainsFunc(flairs, func(f string) bool {
+			return strings.EqualFold(strings.TrimSpace(f), strings.TrimSpace(flair))
+		})
+	}
+
+	if len(widget.IncludeFlairs) > 0 && (flair == "" || !matches(widget.IncludeFlairs)) {
+		return false
+	}
+
+	return flair == "" || !matches(widget.ExcludeFlairs)
+}
+
 func (widget *redditWidget) fetchNewAppAccessToken() error {
 	body := strings.NewReader("grant_type=client_credentials")
 	req, err := http.NewRequest("POST", "https://www.reddit.com/api/v1/access_token", body)
@@ -297,7 +351,7 @@ func (widget *redditWidget) fetchNewAppAccessToken() error {
 		ExpiresIn   int    `json:"expires_in"`
 	}
 
-	client := ternary(widget.Proxy.client != nil, widget.Proxy.client, defaultHTTPClient)
+	client := widget.httpClient(ternary(widget.Proxy.client != nil, widget.Proxy.client, defaultHTTPClient))
 	response, err := decodeJsonFromRequest[tokenResponse](client, req)
 	if err != nil {
 		return err
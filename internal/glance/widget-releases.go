@@ -23,6 +23,7 @@ type releasesWidget struct {
 	Repositories   []*releaseRequest `yaml:"repositories"`
 	Token          string            `yaml:"token"`
 	GitLabToken    string            `yaml:"gitlab-token"`
+	GiteaToken     string            `yaml:"gitea-token"`
 	Limit          int               `yaml:"limit"`
 	CollapseAfter  int               `yaml:"collapse-after"`
 	ShowSourceIcon bool              `yaml:"show-source-icon"`
@@ -42,10 +43,14 @@ func (widget *releasesWidget) initialize() error {
 	for i := range widget.Repositories {
 		r := widget.Repositories[i]
 
-		if r.source == releaseSourceGithub && widget.Token != "" {
+		if r.Token != "" {
+			r.token = &r.Token
+		} else if r.source == releaseSourceGithub && widget.Token != "" {
 			r.token = &widget.Token
 		} else if r.source == releaseSourceGitlab && widget.GitLabToken != "" {
 			r.token = &widget.GitLabToken
+		} else if r.isGiteaCompatible() && widget.GiteaToken != "" {
+			r.token = &widget.GiteaToken
 		}
 	}
 
@@ -53,7 +58,7 @@ func (widget *releasesWidget) initialize() error {
 }
 
 func (widget *releasesWidget) update(ctx context.Context) {
-	releases, err := fetchLatestReleases(widget.Repositories)
+	releases, err := fetchLatestReleases(widget.httpClient(defaultHTTPClient), widget.Repositories)
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
@@ -74,6 +79,16 @@ func (widget *releasesWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, releasesWidgetTemplate)
 }
 
+func (widget *releasesWidget) historySnapshot() map[string]string {
+	values := make(map[string]string, len(widget.Releases))
+
+	for i := range widget.Releases {
+		values[widget.Releases[i].Name] = widget.Releases[i].Version
+	}
+
+	return values
+}
+
 type releaseSource string
 
 const (
@@ -81,8 +96,13 @@ const (
 	releaseSourceGithub    releaseSource = "github"
 	releaseSourceGitlab    releaseSource = "gitlab"
 	releaseSourceDockerHub releaseSource = "dockerhub"
+	releaseSourceGitea     releaseSource = "gitea"
+	releaseSourceForgejo   releaseSource = "forgejo"
 )
 
+const codebergBaseURL = "https://codeberg.org"
+const giteaBaseURL = "https://gitea.com"
+
 type appRelease struct {
 	Source        releaseSource
 	SourceIconURL string
@@ -106,11 +126,18 @@ func (r appReleaseList) sortByNewest() appReleaseList {
 type releaseRequest struct {
 	IncludePreleases bool   `yaml:"include-prereleases"`
 	Repository       string `yaml:"repository"`
+	URL              string `yaml:"url"`
+	Token            string `yaml:"token"`
+	Tags             bool   `yaml:"tags"`
 
 	source releaseSource
 	token  *string
 }
 
+func (r *releaseRequest) isGiteaCompatible() bool {
+	return r.source == releaseSourceGitea || r.source == releaseSourceForgejo || r.source == releaseSourceCodeberg
+}
+
 func (r *releaseRequest) UnmarshalYAML(node *yaml.Node) error {
 	type releaseRequestAlias releaseRequest
 	alias := (*releaseRequestAlias)(r)
@@ -130,7 +157,7 @@ func (r *releaseRequest) UnmarshalYAML(node *yaml.Node) error {
 		}
 	}
 
-	parts := strings.SplitN(repository, ":", 2)
+	parts := strings.SplitN(r.Repository, ":", 2)
 	if len(parts) == 1 {
 		r.source = releaseSourceGithub
 	} else if len(parts) == 2 {
@@ -145,16 +172,49 @@ func (r *releaseRequest) UnmarshalYAML(node *yaml.Node) error {
 			r.source = releaseSourceDockerHub
 		case string(releaseSourceCodeberg):
 			r.source = releaseSourceCodeberg
+		case string(releaseSourceGitea):
+			r.source = releaseSourceGitea
+		case string(releaseSourceForgejo):
+			r.source = releaseSourceForgejo
 		default:
 			return errors.New("invalid source")
 		}
 	}
 
+	switch r.source {
+	case releaseSourceCodeberg:
+		r.URL = codebergBaseURL
+	case releaseSourceGitea:
+		if r.URL == "" {
+			r.URL = giteaBaseURL
+		}
+	case releaseSourceForgejo:
+		if r.URL == "" {
+			return fmt.Errorf("url is required for forgejo repository %s", r.Repository)
+		}
+	default:
+		if r.URL != "" {
+			return fmt.Errorf("url is only supported for gitea and forgejo repositories")
+		}
+	}
+
+	if r.URL != "" {
+		r.URL = strings.TrimRight(r.URL, "/")
+
+		if !strings.HasPrefix(r.URL, "http://") && !strings.HasPrefix(r.URL, "https://") {
+			return fmt.Errorf("url for repository %s must start with http:// or https://", r.Repository)
+		}
+	}
+
+	if r.Tags && (r.source == releaseSourceGitlab || r.source == releaseSourceDockerHub) {
+		return fmt.Errorf("tags is not supported for %s repositories", r.source)
+	}
+
 	return nil
 }
 
-func fetchLatestReleases(requests []*releaseRequest) (appReleaseList, error) {
-	job := newJob(fetchLatestReleaseTask, requests).withWorkers(20)
+func fetchLatestReleases(client requestDoer, requests []*releaseRequest) (appReleaseList, error) {
+	job := newJob(fetchLatestReleaseTask(client), requests).withWorkers(20)
 	results, errs, err := workerPoolDo(job)
 	if err != nil {
 		return nil, err
@@ -187,19 +247,27 @@ func fetchLatestReleases(requests []*releaseRequest) (appReleaseList, error) {
 	return releases, nil
 }
 
-func fetchLatestReleaseTask(request *releaseRequest) (*appRelease, error) {
-	switch request.source {
-	case releaseSourceCodeberg:
-		return fetchLatestCodebergRelease(request)
-	case releaseSourceGithub:
-		return fetchLatestGithubRelease(request)
-	case releaseSourceGitlab:
-		return fetchLatestGitLabRelease(request)
-	case releaseSourceDockerHub:
-		return fetchLatestDockerHubRelease(request)
-	}
+func fetchLatestReleaseTask(client requestDoer) func(*releaseRequest) (*appRelease, error) {
+	return func(request *releaseRequest) (*appRelease, error) {
+		switch request.source {
+		case releaseSourceCodeberg, releaseSourceGitea, releaseSourceForgejo:
+			if request.Tags {
+				return fetchLatestGiteaTag(client, request)
+			}
+			return fetchLatestGiteaRelease(client, request)
+		case releaseSourceGithub:
+			if request.Tags {
+				return fetchLatestGithubTag(client, request)
+			}
+			return fetchLatestGithubRelease(client, request)
+		case releaseSourceGitlab:
+			return fetchLatestGitLabRelease(client, request)
+		case releaseSourceDockerHub:
+			return fetchLatestDockerHubRelease(client, request)
+		}
 
-	return nil, errors.New("unsupported source")
+		return nil, errors.New("unsupported source")
+	}
 }
 
 type githubReleaseResponseJson struct {
@@ -211,7 +279,7 @@ type githubReleaseResponseJson struct {
 	} `json:"reactions"`
 }
 
-func fetchLatestGithubRelease(request *releaseRequest) (*appRelease, error) {
+func fetchLatestGithubRelease(client requestDoer, request *releaseRequest) (*appRelease, error) {
 	var requestURL string
 	if !request.IncludePreleases {
 		requestURL = fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", request.Repository)
@@ -231,12 +299,12 @@ func fetchLatestGithubRelease(request *releaseRequest) (*appRelease, error) {
 	var response githubReleaseResponseJson
 
 	if !request.IncludePreleases {
-		response, err = decodeJsonFromRequest[githubReleaseResponseJson](defaultHTTPClient, httpRequest)
+		response, err = decodeJsonFromRequest[githubReleaseResponseJson](client, httpRequest)
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		responses, err := decodeJsonFromRequest[[]githubReleaseResponseJson](defaultHTTPClient, httpRequest)
+		responses, err := decodeJsonFromRequest[[]githubReleaseResponseJson](client, httpRequest)
 		if err != nil {
 			return nil, err
 		}
@@ -272,7 +340,7 @@ const dockerHubRepoTagURLFormat = "https://hub.docker.com/r/%s/tags?name=%s"
 const dockerHubTagsURLFormat = "https://hub.docker.com/v2/namespaces/%s/repositories/%s/tags"
 const dockerHubSpecificTagURLFormat = "https://hub.docker.com/v2/namespaces/%s/repositories/%s/tags/%s"
 
-func fetchLatestDockerHubRelease(request *releaseRequest) (*appRelease, error) {
+func fetchLatestDockerHubRelease(client requestDoer, request *releaseRequest) (*appRelease, error) {
 	nameParts := strings.Split(request.Repository, "/")
 
 	if len(nameParts) > 2 {
@@ -302,7 +370,7 @@ func fetchLatestDockerHubRelease(request *releaseRequest) (*appRelease, error) {
 	var tag *dockerHubRepositoryTagResponse
 
 	if len(tagParts) == 1 {
-		response, err := decodeJsonFromRequest[dockerHubRepositoryTagsResponse](defaultHTTPClient, httpRequest)
+		response, err := decodeJsonFromRequest[dockerHubRepositoryTagsResponse](client, httpRequest)
 		if err != nil {
 			return nil, err
 		}
@@ -313,7 +381,7 @@ func fetchLatestDockerHubRelease(request *releaseRequest) (*appRelease, error) {
 
 		tag = &response.Results[0]
 	} else {
-		response, err := decodeJsonFromRequest[dockerHubRepositoryTagResponse](defaultHTTPClient, httpRequest)
+		response, err := decodeJsonFromRequest[dockerHubRepositoryTagResponse](client, httpRequest)
 		if err != nil {
 			return nil, err
 		}
@@ -356,7 +424,7 @@ type gitlabReleaseResponseJson struct {
 	} `json:"_links"`
 }
 
-func fetchLatestGitLabRelease(request *releaseRequest) (*appRelease, error) {
+func fetchLatestGitLabRelease(client requestDoer, request *releaseRequest) (*appRelease, error) {
 	httpRequest, err := http.NewRequest(
 		"GET",
 		fmt.Sprintf(
@@ -373,7 +441,7 @@ func fetchLatestGitLabRelease(request *releaseRequest) (*appRelease, error) {
 		httpRequest.Header.Add("PRIVATE-TOKEN", *request.token)
 	}
 
-	response, err := decodeJsonFromRequest[gitlabReleaseResponseJson](defaultHTTPClient, httpRequest)
+	response, err := decodeJsonFromRequest[gitlabReleaseResponseJson](client, httpRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -387,35 +455,160 @@ func fetchLatestGitLabRelease(request *releaseRequest) (*appRelease, error) {
 	}, nil
 }
 
-type codebergReleaseResponseJson struct {
+type githubTagResponseJson struct {
+	Name   string `json:"name"`
+	Commit struct {
+		Url string `json:"url"`
+	} `json:"commit"`
+}
+
+type githubCommitResponseJson struct {
+	Commit struct {
+		Committer struct {
+			Date string `json:"date"`
+		} `json:"committer"`
+	} `json:"commit"`
+}
+
+func fetchLatestGithubTag(client requestDoer, request *releaseRequest) (*appRelease, error) {
+	httpRequest, err := http.NewRequest(
+		"GET",
+		fmt.Sprintf("https://api.github.com/repos/%s/tags?per_page=1", request.Repository),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.token != nil {
+		httpRequest.Header.Add("Authorization", "Bearer "+(*request.token))
+	}
+
+	tags, err := decodeJsonFromRequest[[]githubTagResponseJson](client, httpRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("no tags found for repository %s", request.Repository)
+	}
+
+	tag := tags[0]
+
+	// The tags endpoint doesn't include a date, so it has to be taken from the tagged commit
+	commitRequest, err := http.NewRequest("GET", tag.Commit.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.token != nil {
+		commitRequest.Header.Add("Authorization", "Bearer "+(*request.token))
+	}
+
+	commit, err := decodeJsonFromRequest[githubCommitResponseJson](client, commitRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &appRelease{
+		Source:       releaseSourceGithub,
+		Name:         request.Repository,
+		Version:      normalizeVersionFormat(tag.Name),
+		NotesUrl:     fmt.Sprintf("https://github.com/%s/tree/%s", request.Repository, url.PathEscape(tag.Name)),
+		TimeReleased: parseRFC3339Time(commit.Commit.Committer.Date),
+	}, nil
+}
+
+type giteaReleaseResponseJson struct {
 	TagName     string `json:"tag_name"`
 	PublishedAt string `json:"published_at"`
 	HtmlUrl     string `json:"html_url"`
 }
 
-func fetchLatestCodebergRelease(request *releaseRequest) (*appRelease, error) {
+func newGiteaRequest(request *releaseRequest, path string) (*http.Request, error) {
 	httpRequest, err := http.NewRequest(
 		"GET",
-		fmt.Sprintf(
-			"https://codeberg.org/api/v1/repos/%s/releases/latest",
-			request.Repository,
-		),
+		fmt.Sprintf("%s/api/v1/repos/%s/%s", request.URL, request.Repository, path),
 		nil,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	response, err := decodeJsonFromRequest[codebergReleaseResponseJson](defaultHTTPClient, httpRequest)
-	if err != nil {
-		return nil, err
+	if request.token != nil {
+		httpRequest.Header.Add("Authorization", "token "+(*request.token))
+	}
+
+	return httpRequest, nil
+}
+
+func fetchLatestGiteaRelease(client requestDoer, request *releaseRequest) (*appRelease, error) {
+	var response giteaReleaseResponseJson
+
+	if !request.IncludePreleases {
+		httpRequest, err := newGiteaRequest(request, "releases/latest")
+		if err != nil {
+			return nil, err
+		}
+
+		response, err = decodeJsonFromRequest[giteaReleaseResponseJson](client, httpRequest)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		httpRequest, err := newGiteaRequest(request, "releases?draft=false&limit=1")
+		if err != nil {
+			return nil, err
+		}
+
+		responses, err := decodeJsonFromRequest[[]giteaReleaseResponseJson](client, httpRequest)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(responses) == 0 {
+			return nil, fmt.Errorf("no releases found for repository %s", request.Repository)
+		}
+
+		response = responses[0]
 	}
 
 	return &appRelease{
-		Source:       releaseSourceCodeberg,
+		Source:       request.source,
 		Name:         request.Repository,
 		Version:      normalizeVersionFormat(response.TagName),
 		NotesUrl:     response.HtmlUrl,
 		TimeReleased: parseRFC3339Time(response.PublishedAt),
 	}, nil
 }
+
+type giteaTagResponseJson struct {
+	Name   string `json:"name"`
+	Commit struct {
+		Created string `json:"created"`
+	} `json:"commit"`
+}
+
+func fetchLatestGiteaTag(client requestDoer, request *releaseRequest) (*appRelease, error) {
+	httpRequest, err := newGiteaRequest(request, "tags?limit=1")
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := decodeJsonFromRequest[[]giteaTagResponseJson](client, httpRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("no tags found for repository %s", request.Repository)
+	}
+
+	return &appRelease{
+		Source:       request.source,
+		Name:         request.Repository,
+		Version:      normalizeVersionFormat(tags[0].Name),
+		NotesUrl:     fmt.Sprintf("%s/%s/src/tag/%s", request.URL, request.Repository, url.PathEscape(tags[0].Name)),
+		TimeReleased: parseRFC3339Time(tags[0].Commit.Created),
+	}, nil
+}
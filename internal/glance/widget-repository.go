@@ -42,6 +42,7 @@ func (widget *repositoryWidget) initialize() error {
 
 func (widget *repositoryWidget) update(ctx context.Context) {
 	details, err := fetchRepositoryDetailsFromGithub(
+		widget.httpClient(defaultHTTPClient),
 		widget.RequestedRepository,
 		string(widget.Token),
 		widget.PullRequestsLimit,
@@ -111,7 +112,7 @@ type gitHubCommitResponseJson struct {
 	} `json:"commit"`
 }
 
-func fetchRepositoryDetailsFromGithub(repo string, token string, maxPRs int, maxIssues int, maxCommits int) (repository, error) {
+func fetchRepositoryDetailsFromGithub(client requestDoer, repo string, token string, maxPRs int, maxIssues int, maxCommits int) (repository, error) {
 	repositoryRequest, err := http.NewRequest("GET", fmt.Sprintf("https://api.github.com/repos/%s", repo), nil)
 	if err != nil {
 		return repository{}, fmt.Errorf("%w: could not create request with repository: %v", errNoContent, err)
@@ -142,14 +143,14 @@ func fetchRepositoryDetailsFromGithub(repo string, token string, maxPRs int, max
 	wg.Add(1)
 	go (func() {
 		defer wg.Done()
-		repositoryResponse, detailsErr = decodeJsonFromRequest[githubRepositoryResponseJson](defaultHTTPClient, repositoryRequest)
+		repositoryResponse, detailsErr = decodeJsonFromRequest[githubRepositoryResponseJson](client, repositoryRequest)
 	})()
 
 	if maxPRs > 0 {
 		wg.Add(1)
 		go (func() {
 			defer wg.Done()
-			PRsResponse, PRsErr = decodeJsonFromRequest[githubTicketResponseJson](defaultHTTPClient, PRsRequest)
+			PRsResponse, PRsErr = decodeJsonFromRequest[githubTicketResponseJson](client, PRsRequest)
 		})()
 	}
 
@@ -157,7 +158,7 @@ func fetchRepositoryDetailsFromGithub(repo string, token string, maxPRs int, max
 		wg.Add(1)
 		go (func() {
 			defer wg.Done()
-			issuesResponse, issuesErr = decodeJsonFromRequest[githubTicketResponseJson](defaultHTTPClient, issuesRequest)
+			issuesResponse, issuesErr = decodeJsonFromRequest[githubTicketResponseJson](client, issuesRequest)
 		})()
 	}
 
@@ -165,7 +166,7 @@ func fetchRepositoryDetailsFromGithub(repo string, token string, maxPRs int, max
 		wg.Add(1)
 		go (func() {
 			defer wg.Done()
-			commitsResponse, CommitsErr = decodeJsonFromRequest[[]gitHubCommitResponseJson](defaultHTTPClient, CommitsRequest)
+			commitsResponse, CommitsErr = decodeJsonFromRequest[[]gitHubCommitResponseJson](client, CommitsRequest)
 		})()
 	}
 
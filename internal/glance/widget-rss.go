@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -42,8 +43,12 @@ type rssWidget struct {
 	Items          rssFeedItemList `yaml:"-"`
 	NoItemsMessage string          `yaml:"-"`
 
-	cachedFeedsMutex sync.Mutex
-	cachedFeeds      map[string]*cachedRSSFeed `yaml:"-"`
+	cachedFeeds  *conditionalRequestCache[[]rssFeedItem]
+	failingFeeds *sourceBackoff
+
+	// og:image of the pages of items, with an empty string for pages which don't have one
+	ogImagesMutex sync.Mutex
+	ogImages      map[string]string
 }
 
 func (widget *rssWidget) initialize() error {
@@ -72,7 +77,9 @@ func (widget *rssWidget) initialize() error {
 	}
 
 	widget.NoItemsMessage = "No items were returned from the feeds."
-	widget.cachedFeeds = make(map[string]*cachedRSSFeed)
+	widget.cachedFeeds = newConditionalRequestCache[[]rssFeedItem]()
+	widget.failingFeeds = newSourceBackoff()
+	widget.ogImages = make(map[string]string)
 
 	return nil
 }
@@ -84,6 +91,11 @@ func (widget *rssWidget) update(ctx context.Context) {
 		return
 	}
 
+	// none of the feeds changed so neither would the items after sorting them
+	if widget.cachedFeeds.allNotModified() {
+		return
+	}
+
 	if !widget.PreserveOrder {
 		items.sortByNewest()
 	}
@@ -95,6 +107,24 @@ func (widget *rssWidget) update(ctx context.Context) {
 	widget.Items = items
 }
 
+func (widget *rssWidget) notificationItems() []notificationItem {
+	items := make([]notificationItem, len(widget.Items))
+
+	for i := range widget.Items {
+		item := &widget.Items[i]
+		items[i] = notificationItem{
+			Key:         ternary(item.Link != "", item.Link, item.ChannelURL+"\n"+item.Title),
+			Title:       item.Title,
+			URL:         item.Link,
+			Author:      item.ChannelName,
+			ImageURL:    item.ImageURL,
+			PublishedAt: item.PublishedAt,
+		}
+	}
+
+	return items
+}
+
 func (widget *rssWidget) Render() template.HTML {
 	if widget.Style == "horizontal-cards" {
 		return widget.renderTemplate(widget, rssWidgetHorizontalCardsTemplate)
@@ -111,12 +141,6 @@ func (widget *rssWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, rssWidgetTemplate)
 }
 
-type cachedRSSFeed struct {
-	etag         string
-	lastModified string
-	items        []rssFeedItem
-}
-
 type rssFeedItem struct {
 	ChannelName string
 	ChannelURL  string
@@ -137,6 +161,9 @@ type rssFeedRequest struct {
 	ItemLinkPrefix  string            `yaml:"item-link-prefix"`
 	Headers         map[string]string `yaml:"headers"`
 	IsDetailed      bool              `yaml:"-"`
+
+	HideThumbnails bool `yaml:"hide-thumbnails"`
+	FetchOgImage   bool `yaml:"fetch-og-image"`
 }
 
 type rssFeedItemList []rssFeedItem
@@ -150,7 +177,19 @@ func (f rssFeedItemList) sortByNewest() rssFeedItemList {
 }
 
 func (widget *rssWidget) fetchItemsFromFeeds() (rssFeedItemList, error) {
-	requests := widget.FeedRequests
+	requests := make([]rssFeedRequest, 0, len(widget.FeedRequests))
+	now := time.Now()
+
+	for i := range widget.FeedRequests {
+		if !widget.failingFeeds.isDisabled(widget.FeedRequests[i].URL, now) {
+			requests = append(requests, widget.FeedRequests[i])
+		}
+	}
+
+	disabled := len(widget.FeedRequests) - len(requests)
+	if disabled > 0 && len(requests) == 0 {
+		return nil, fmt.Errorf("%w: all feeds are temporarily disabled after failing repeatedly", errNoContent)
+	}
 
 	job := newJob(widget.fetchItemsFromFeedTask, requests).withWorkers(30)
 	feeds, errs, err := workerPoolDo(job)
@@ -163,6 +202,8 @@ func (widget *rssWidget) fetchItemsFromFeeds() (rssFeedItemList, error) {
 	seen := make(map[string]struct{})
 
 	for i := range feeds {
+		widget.failingFeeds.record(requests[i].URL, errs[i])
+
 		if errs[i] != nil {
 			failed++
 			slog.Error("Failed to get RSS feed", "url", requests[i].URL, "error", errs[i])
@@ -182,8 +223,8 @@ func (widget *rssWidget) fetchItemsFromFeeds() (rssFeedItemList, error) {
 		return nil, errNoContent
 	}
 
-	if failed > 0 {
-		return entries, fmt.Errorf("%w: missing %d RSS feeds", errPartialContent, failed)
+	if failed > 0 || disabled > 0 {
+		return entries, fmt.Errorf("%w: missing %d RSS feeds%s", errPartialContent, failed+disabled, disabledSourcesMessage(disabled))
 	}
 
 	return entries, nil
@@ -197,32 +238,23 @@ func (widget *rssWidget) fetchItemsFromFeedTask(request rssFeedRequest) ([]rssFe
 
 	req.Header.Add("User-Agent", glanceUserAgentString)
 
-	widget.cachedFeedsMutex.Lock()
-	cache, isCached := widget.cachedFeeds[request.URL]
-	if isCached {
-		if cache.etag != "" {
-			req.Header.Add("If-None-Match", cache.etag)
-		}
-		if cache.lastModified != "" {
-			req.Header.Add("If-Modified-Since", cache.lastModified)
-		}
-	}
-	widget.cachedFeedsMutex.Unlock()
+	widget.cachedFeeds.addValidators(req)
 
 	for key, value := range request.Headers {
 		req.Header.Set(key, value)
 	}
 
-	resp, err := defaultHTTPClient.Do(req)
+	resp, err := widget.httpClient(defaultHTTPClient).Do(req)
+	if items, ok := widget.cachedFeeds.notModified(req, resp); ok {
+		resp.Body.Close()
+		return items, nil
+	}
+
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotModified && isCached {
-		return cache.items, nil
-	}
-
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, request.URL)
 	}
@@ -242,6 +274,14 @@ func (widget *rssWidget) fetchItemsFromFeedTask(request rssFeedRequest) ([]rssFe
 	}
 
 	items := make(rssFeedItemList, 0, len(feed.Items))
+	feedImageURL := ""
+	if feed.Image != nil {
+		if len(feed.Image.URL) > 0 && feed.Image.URL[0] == '/' {
+			feedImageURL = strings.TrimRight(feed.Link, "/") + feed.Image.URL
+		} else {
+			feedImageURL = feed.Image.URL
+		}
+	}
 
 	for i := range feed.Items {
 		item := feed.Items[i]
@@ -309,15 +349,17 @@ func (widget *rssWidget) fetchItemsFromFeedTask(request rssFeedRequest) ([]rssFe
 			rssItem.ChannelName = feed.Title
 		}
 
-		if item.Image != nil {
-			rssItem.ImageURL = item.Image.URL
-		} else if url := findThumbnailInItemExtensions(item); url != "" {
-			rssItem.ImageURL = url
-		} else if feed.Image != nil {
-			if len(feed.Image.URL) > 0 && feed.Image.URL[0] == '/' {
-				rssItem.ImageURL = strings.TrimRight(feed.Link, "/") + feed.Image.URL
-			} else {
-				rssItem.ImageURL = feed.Image.URL
+		if !request.HideThumbnails {
+			if item.Image != nil {
+				rssItem.ImageURL = item.Image.URL
+			} else if url := findThumbnailInItemExtensions(item); url != "" {
+				rssItem.ImageURL = url
+			} else if url := findThumbnailInItemEnclosures(item); url != "" {
+				rssItem.ImageURL = url
+			} else if !request.FetchOgImage {
+				// with fetch-og-image the feed's image is only used once we know
+				// the page of the item doesn't have one of its own
+				rssItem.ImageURL = feedImageURL
 			}
 		}
 
@@ -330,16 +372,12 @@ func (widget *rssWidget) fetchItemsFromFeedTask(request rssFeedRequest) ([]rssFe
 		items = append(items, rssItem)
 	}
 
-	if resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != "" {
-		widget.cachedFeedsMutex.Lock()
-		widget.cachedFeeds[request.URL] = &cachedRSSFeed{
-			etag:         resp.Header.Get("ETag"),
-			lastModified: resp.Header.Get("Last-Modified"),
-			items:        items,
-		}
-		widget.cachedFeedsMutex.Unlock()
+	if request.FetchOgImage && !request.HideThumbnails {
+		widget.fillItemImagesFromOgImage(items, feedImageURL)
 	}
 
+	widget.cachedFeeds.store(req, resp, items)
+
 	return items, nil
 }
 
@@ -373,6 +411,143 @@ func recursiveFindThumbnailInExtensions(extensions map[string][]gofeedext.Extens
 	return ""
 }
 
+func findThumbnailInItemEnclosures(item *gofeed.Item) string {
+	for _, enclosure := range item.Enclosures {
+		if enclosure == nil || enclosure.URL == "" {
+			continue
+		}
+
+		if strings.HasPrefix(enclosure.Type, "image/") {
+			return enclosure.URL
+		}
+
+		if enclosure.Type == "" && imageURLExtensionPattern.MatchString(enclosure.URL) {
+			return enclosure.URL
+		}
+	}
+
+	return ""
+}
+
+var (
+	imageURLExtensionPattern = regexp.MustCompile(`(?i)\.(?:jpe?g|png|gif|webp|avif)(?:\?|#|$)`)
+	ogImageMetaTagPattern    = regexp.MustCompile(`(?i)<meta\s[^>]*(?:property|name)\s*=\s*["']og:image(?::url)?["'][^>]*>`)
+	metaTagContentPattern    = regexp.MustCompile(`(?i)\scontent\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+const (
+	rssMaxCachedOgImages  = 2000
+	rssOgImageMaxBodySize = 512 * 1024
+)
+
+func (widget *rssWidget) fillItemImagesFromOgImage(items []rssFeedItem, fallback string) {
+	pending := make([]string, 0, len(items))
+
+	widget.ogImagesMutex.Lock()
+	for i := range items {
+		if items[i].ImageURL != "" || items[i].Link == "" {
+			continue
+		}
+
+		if _, exists := widget.ogImages[items[i].Link]; !exists && !slices.Contains(pending, items[i].Link) {
+			pending = append(pending, items[i].Link)
+		}
+	}
+	widget.ogImagesMutex.Unlock()
+
+	if len(pending) > 0 {
+		job := newJob(fetchOgImageFromPageTask(widget.httpClient(defaultHTTPClient)), pending).withWorkers(5)
+		images, errs, err := workerPoolDo(job)
+
+		widget.ogImagesMutex.Lock()
+		if len(widget.ogImages)+len(pending) > rssMaxCachedOgImages {
+			clear(widget.ogImages)
+		}
+
+		if err == nil {
+			for i := range pending {
+				// failed requests get retried during the next update
+				if errs[i] == nil {
+					widget.ogImages[pending[i]] = images[i]
+				} else {
+					slog.Warn("Failed to fetch og:image of RSS item", "url", pending[i], "error", errs[i])
+				}
+			}
+		}
+		widget.ogImagesMutex.Unlock()
+	}
+
+	widget.ogImagesMutex.Lock()
+	defer widget.ogImagesMutex.Unlock()
+
+	for i := range items {
+		if items[i].ImageURL != "" {
+			continue
+		}
+
+		items[i].ImageURL = ternary(widget.ogImages[items[i].Link] != "", widget.ogImages[items[i].Link], fallback)
+	}
+}
+
+func fetchOgImageFromPageTask(client requestDoer) func(string) (string, error) {
+	return func(pageURL string) (string, error) {
+		return fetchOgImageFromPage(client, pageURL)
+	}
+}
+
+func fetchOgImageFromPage(client requestDoer, pageURL string) (string, error) {
+	request, err := http.NewRequest("GET", pageURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	request.Header.Set("User-Agent", glanceUserAgentString)
+	request.Header.Set("Accept", "text/html")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+
+	// the meta tags are in the head, there's no need to read entire pages
+	body, err := io.ReadAll(io.LimitReader(response.Body, rssOgImageMaxBodySize))
+	if err != nil {
+		return "", err
+	}
+
+	tag := ogImageMetaTagPattern.Find(body)
+	if tag == nil {
+		return "", nil
+	}
+
+	matches := metaTagContentPattern.FindSubmatch(tag)
+	if matches == nil {
+		return "", nil
+	}
+
+	image := strings.TrimSpace(html.UnescapeString(string(matches[1]) + string(matches[2])))
+	if image == "" {
+		return "", nil
+	}
+
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return image, nil
+	}
+
+	resolved, err := base.Parse(image)
+	if err != nil {
+		return "", nil
+	}
+
+	return resolved.String(), nil
+}
+
 var htmlTagsWithAttributesPattern = regexp.MustCompile(`<\/?[a-zA-Z0-9-]+ *(?:[a-zA-Z-]+=(?:"|').*?(?:"|') ?)* *\/?>`)
 
 func sanitizeFeedDescription(description string) string {
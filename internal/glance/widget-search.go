@@ -3,6 +3,8 @@ package glance
 import (
 	"fmt"
 	"html/template"
+	"net/url"
+	"slices"
 	"strings"
 )
 
@@ -23,6 +25,15 @@ type searchWidget struct {
 	Target       string        `yaml:"target"`
 	Autofocus    bool          `yaml:"autofocus"`
 	Placeholder  string        `yaml:"placeholder"`
+	// Lets the default engine be changed from the widget itself
+	SearchEngines []string             `yaml:"search-engines"`
+	BuiltinBangs  bool                 `yaml:"builtin-bangs"`
+	Engines       []searchEngineOption `yaml:"-"`
+}
+
+type searchEngineOption struct {
+	Title string
+	URL   string
 }
 
 func convertSearchUrl(url string) string {
@@ -38,6 +49,38 @@ var searchEngines = map[string]string{
 	"perplexity": "https://www.perplexity.ai/search?q={QUERY}",
 	"kagi": "https://kagi.com/search?q={QUERY}",
 	"startpage": "https://www.startpage.com/search?q={QUERY}",
+	"baidu":      "https://www.baidu.com/s?wd={QUERY}",
+}
+
+var searchEngineTitles = map[string]string{
+	"duckduckgo": "DuckDuckGo",
+	"google":     "Google",
+	"bing":       "Bing",
+	"perplexity": "Perplexity",
+	"kagi":       "Kagi",
+	"startpage":  "Startpage",
+	"baidu":      "Baidu",
+}
+
+var searchBuiltinBangs = []SearchBang{
+	{Title: "Bilibili", Shortcut: "!b", URL: "https://search.bilibili.com/all?keyword={QUERY}"},
+	{Title: "GitHub", Shortcut: "!gh", URL: "https://github.com/search?q={QUERY}"},
+	{Title: "YouTube", Shortcut: "!yt", URL: "https://www.youtube.com/results?search_query={QUERY}"},
+	{Title: "Wikipedia", Shortcut: "!w", URL: "https://en.wikipedia.org/wiki/Special:Search?search={QUERY}"},
+	{Title: "知乎", Shortcut: "!zh", URL: "https://www.zhihu.com/search?q={QUERY}"},
+}
+
+func newSearchEngineOption(engine string) searchEngineOption {
+	if url, ok := searchEngines[engine]; ok {
+		return searchEngineOption{Title: searchEngineTitles[engine], URL: convertSearchUrl(url)}
+	}
+
+	title := engine
+	if parsed, err := url.Parse(engine); err == nil && parsed.Host != "" {
+		title = strings.TrimPrefix(parsed.Host, "www.")
+	}
+
+	return searchEngineOption{Title: title, URL: convertSearchUrl(engine)}
 }
 
 func (widget *searchWidget) initialize() error {
@@ -51,11 +94,18 @@ func (widget *searchWidget) initialize() error {
 		widget.Placeholder = "Type here to search…"
 	}
 
-	if url, ok := searchEngines[widget.SearchEngine]; ok {
-		widget.SearchEngine = url
+	if len(widget.SearchEngines) > 0 {
+		widget.Engines = make([]searchEngineOption, 0, len(widget.SearchEngines)+1)
+		if !slices.Contains(widget.SearchEngines, widget.SearchEngine) {
+			widget.Engines = append(widget.Engines, newSearchEngineOption(widget.SearchEngine))
+		}
+
+		for _, engine := range widget.SearchEngines {
+			widget.Engines = append(widget.Engines, newSearchEngineOption(engine))
+		}
 	}
 
-	widget.SearchEngine = convertSearchUrl(widget.SearchEngine)
+	widget.SearchEngine = newSearchEngineOption(widget.SearchEngine).URL
 
 	for i := range widget.Bangs {
 		if widget.Bangs[i].Shortcut == "" {
@@ -69,6 +119,18 @@ func (widget *searchWidget) initialize() error {
 		widget.Bangs[i].URL = convertSearchUrl(widget.Bangs[i].URL)
 	}
 
+	if widget.BuiltinBangs {
+		for _, bang := range searchBuiltinBangs {
+			// bangs from the config take precedence
+			if slices.ContainsFunc(widget.Bangs, func(b SearchBang) bool { return b.Shortcut == bang.Shortcut }) {
+				continue
+			}
+
+			bang.URL = convertSearchUrl(bang.URL)
+			widget.Bangs = append(widget.Bangs, bang)
+		}
+	}
+
 	widget.cachedHTML = widget.renderTemplate(widget, searchWidgetTemplate)
 	return nil
 }
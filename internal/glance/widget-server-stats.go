@@ -61,7 +61,7 @@ func (widget *serverStatsWidget) update(context.Context) {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				info, err := fetchRemoteServerInfo(serv)
+				info, err := fetchRemoteServerInfo(widget.httpClient(defaultHTTPClient), serv)
 				if err != nil {
 					slog.Warn("Getting remote system info: " + err.Error())
 					serv.IsReachable = false
@@ -99,7 +99,7 @@ type serverStatsRequest struct {
 	// Provider                   string              `yaml:"provider"`
 }
 
-func fetchRemoteServerInfo(infoReq *serverStatsRequest) (*sysinfo.SystemInfo, error) {
+func fetchRemoteServerInfo(client requestDoer, infoReq *serverStatsRequest) (*sysinfo.SystemInfo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(infoReq.Timeout))
 	defer cancel()
 
@@ -108,7 +108,7 @@ func fetchRemoteServerInfo(infoReq *serverStatsRequest) (*sysinfo.SystemInfo, er
 		request.Header.Set("Authorization", "Bearer "+infoReq.Token)
 	}
 
-	info, err := decodeJsonFromRequest[*sysinfo.SystemInfo](defaultHTTPClient, request)
+	info, err := decodeJsonFromRequest[*sysinfo.SystemInfo](client, request)
 	if err != nil {
 		return nil, err
 	}
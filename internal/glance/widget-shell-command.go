@@ -0,0 +1,138 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+var shellCommandWidgetTemplate = mustParseTemplate("shell-command.html", "widget-base.html")
+
+type shellCommandWidget struct {
+	widgetBase       `yaml:",inline"`
+	Command          string             `yaml:"command"`
+	Directory        string             `yaml:"directory"`
+	Env              map[string]string  `yaml:"env"`
+	ParseJSON        bool               `yaml:"parse-json"`
+	IgnoreExitCode   bool               `yaml:"ignore-exit-code"`
+	Timeout          durationField      `yaml:"timeout"`
+	Template         string             `yaml:"template"`
+	Options          customAPIOptions   `yaml:"options"`
+	Frameless        bool               `yaml:"frameless"`
+	CompiledHTML     template.HTML      `yaml:"-"`
+	compiledTemplate *template.Template `yaml:"-"`
+}
+
+func (widget *shellCommandWidget) initialize() error {
+	widget.withTitle("Command").withCacheDuration(5 * time.Minute)
+
+	if widget.Command == "" {
+		return errors.New("command is required")
+	}
+
+	if widget.Timeout == 0 {
+		widget.Timeout = durationField(10 * time.Second)
+	}
+
+	if widget.Template != "" {
+		compiledTemplate, err := template.New("").Funcs(customAPITemplateFuncs).Parse(widget.Template)
+		if err != nil {
+			return fmt.Errorf("parsing template: %w", err)
+		}
+
+		widget.compiledTemplate = compiledTemplate
+	}
+
+	return nil
+}
+
+func (widget *shellCommandWidget) update(ctx context.Context) {
+	data, err := widget.runCommand(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	compiledHTML, err := renderCommandOutput(widget.compiledTemplate, data)
+	if err != nil {
+		widget.withError(err).scheduleEarlyUpdate()
+		return
+	}
+
+	widget.CompiledHTML = compiledHTML
+}
+
+func (widget *shellCommandWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, shellCommandWidgetTemplate)
+}
+
+func (widget *shellCommandWidget) runCommand(ctx context.Context) (*commandOutputTemplateData, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(widget.Timeout))
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", widget.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", widget.Command)
+	}
+
+	cmd.Dir = widget.Directory
+	// processes started by the command can keep the output open after it gets killed
+	cmd.WaitDelay = time.Second
+
+	if len(widget.Env) > 0 {
+		cmd.Env = cmd.Environ()
+		for key, value := range widget.Env {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+
+	var stdout, stderr limitedBuffer
+	stdout.limit = commandMaxOutputSize
+	stderr.limit = commandMaxOutputSize
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	data := &commandOutputTemplateData{Options: widget.Options}
+
+	err := cmd.Run()
+	data.Output = stdout.String()
+	data.Stderr = stderr.String()
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("command did not finish within %s", time.Duration(widget.Timeout))
+	}
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("running command: %v", err)
+		}
+
+		data.ExitCode = exitErr.ExitCode()
+
+		if !widget.IgnoreExitCode {
+			message := strings.TrimSpace(data.Stderr)
+			if message == "" {
+				message = "no output on stderr"
+			}
+			message, _ = limitStringLength(message, 200)
+
+			return nil, fmt.Errorf("command exited with code %d: %s", data.ExitCode, message)
+		}
+	}
+
+	if widget.ParseJSON && !gjson.Valid(data.Output) {
+		message, _ := limitStringLength(strings.TrimSpace(data.Output), 100)
+		return nil, fmt.Errorf("command output is not valid JSON: %s", message)
+	}
+
+	return data, nil
+}
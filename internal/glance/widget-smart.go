@@ -0,0 +1,493 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var smartWidgetTemplate = mustParseTemplate("smart.html", "widget-base.html")
+
+const (
+	smartStatusHealthy = "healthy"
+	smartStatusWarning = "warning"
+	smartStatusFailing = "failing"
+	smartStatusStandby = "standby"
+	smartStatusUnknown = "unknown"
+)
+
+type smartWidget struct {
+	widgetBase           `yaml:",inline"`
+	Devices              []string      `yaml:"devices"`
+	SmartctlPath         string        `yaml:"smartctl-path"`
+	URL                  string        `yaml:"url"`
+	Token                string        `yaml:"token"`
+	AllowInsecure        bool          `yaml:"allow-insecure"`
+	TemperatureThreshold int           `yaml:"temperature-threshold"`
+	WearThreshold        int           `yaml:"wear-threshold"`
+	HideHealthy          bool          `yaml:"hide-healthy"`
+	Disks                []smartDisk   `yaml:"-"`
+	HealthyCount         int           `yaml:"-"`
+	timeout              time.Duration `yaml:"-"`
+}
+
+type smartDisk struct {
+	Name        string
+	Model       string
+	Serial      string
+	Capacity    string
+	Status      string
+	Problems    []string
+	Temperature int
+	HotTemp     bool
+	PowerOnTime string
+	// -1 when the disk doesn't report it
+	WearPercent     int
+	Reallocated     int64
+	Pending         int64
+	Uncorrectable   int64
+	MediaErrors     int64
+	HasSectorCounts bool
+	HasMediaErrors  bool
+}
+
+// The parts of the output of smartctl --json --all that are used
+type smartctlOutput struct {
+	Smartctl struct {
+		ExitStatus int `json:"exit_status"`
+		Messages   []struct {
+			String   string `json:"string"`
+			Severity string `json:"severity"`
+		} `json:"messages"`
+	} `json:"smartctl"`
+	Device struct {
+		Name     string `json:"name"`
+		Protocol string `json:"protocol"`
+	} `json:"device"`
+	ModelName    string `json:"model_name"`
+	SerialNumber string `json:"serial_number"`
+	UserCapacity struct {
+		Bytes int64 `json:"bytes"`
+	} `json:"user_capacity"`
+	SmartStatus *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature *struct {
+		Current int `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime *struct {
+		Hours int `json:"hours"`
+	} `json:"power_on_time"`
+	ATAAttributes *struct {
+		Table []smartctlATAAttribute `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NVMeHealth *struct {
+		CriticalWarning         int   `json:"critical_warning"`
+		AvailableSpare          int   `json:"available_spare"`
+		AvailableSpareThreshold int   `json:"available_spare_threshold"`
+		PercentageUsed          int   `json:"percentage_used"`
+		MediaErrors             int64 `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+}
+
+type smartctlATAAttribute struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Value      int    `json:"value"`
+	Threshold  int    `json:"thresh"`
+	WhenFailed string `json:"when_failed"`
+	Raw        struct {
+		Value int64 `json:"value"`
+	} `json:"raw"`
+}
+
+type smartctlScanOutput struct {
+	Devices []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"devices"`
+}
+
+func (widget *smartWidget) initialize() error {
+	widget.withTitle("硬盘健康").withCacheDuration(10 * time.Minute)
+
+	if widget.URL != "" {
+		widget.URL = strings.TrimRight(widget.URL, "/")
+	} else if widget.SmartctlPath == "" {
+		widget.SmartctlPath = "smartctl"
+	}
+
+	if widget.TemperatureThreshold <= 0 {
+		widget.TemperatureThreshold = 55
+	}
+
+	if widget.WearThreshold <= 0 {
+		widget.WearThreshold = 80
+	} else if widget.WearThreshold > 100 {
+		return errors.New("wear-threshold must be a percentage between 1 and 100")
+	}
+
+	widget.timeout = 30 * time.Second
+
+	return nil
+}
+
+func (widget *smartWidget) update(ctx context.Context) {
+	var outputs []smartctlOutput
+	var err error
+
+	if widget.URL != "" {
+		outputs, err = widget.fetchFromAgent(ctx)
+	} else {
+		outputs, err = widget.runSmartctl(ctx)
+	}
+
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	disks := make([]smartDisk, 0, len(outputs))
+	healthy := 0
+
+	for i := range outputs {
+		disk := widget.diskFromOutput(&outputs[i])
+		// disks in standby aren't checked so that they aren't woken up,
+		// but there's nothing wrong with them either
+		if disk.Status == smartStatusHealthy || disk.Status == smartStatusStandby {
+			healthy++
+		}
+		disks = append(disks, disk)
+	}
+
+	// problems first so that they're noticed, the rest stays in device order
+	slices.SortStableFunc(disks, func(a, b smartDisk) int {
+		return smartStatusPriority(a.Status) - smartStatusPriority(b.Status)
+	})
+
+	widget.Disks = disks
+	widget.HealthyCount = healthy
+}
+
+func (widget *smartWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, smartWidgetTemplate)
+}
+
+func smartStatusPriority(status string) int {
+	switch status {
+	case smartStatusFailing:
+		return 0
+	case smartStatusWarning:
+		return 1
+	case smartStatusUnknown:
+		return 2
+	default:
+		return 3
+	}
+}
+
+func (widget *smartWidget) fetchFromAgent(ctx context.Context) ([]smartctlOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, widget.timeout)
+	defer cancel()
+
+	request, _ := http.NewRequestWithContext(ctx, "GET", widget.URL, nil)
+	if widget.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+widget.Token)
+	}
+
+	client := widget.httpClient(ternary(widget.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient))
+	outputs, err := decodeJsonFromRequest[[]smartctlOutput](client, request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNoContent, err)
+	}
+
+	if len(widget.Devices) > 0 {
+		outputs = slices.DeleteFunc(outputs, func(o smartctlOutput) bool {
+			return !slices.Contains(widget.Devices, o.Device.Name)
+		})
+	}
+
+	if len(outputs) == 0 {
+		return nil, errors.New("the agent didn't report any disks")
+	}
+
+	return outputs, nil
+}
+
+type smartctlDevice struct {
+	name string
+	// passed to smartctl with -d, for devices such as disks behind a RAID
+	// controller or USB bridge which can't be auto-detected
+	kind string
+}
+
+func (widget *smartWidget) runSmartctl(ctx context.Context) ([]smartctlOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, widget.timeout)
+	defer cancel()
+
+	devices := make([]smartctlDevice, 0, len(widget.Devices))
+
+	if len(widget.Devices) > 0 {
+		for _, device := range widget.Devices {
+			devices = append(devices, smartctlDevice{name: device})
+		}
+	} else {
+		output, err := exec.CommandContext(ctx, widget.SmartctlPath, "--scan", "--json").Output()
+		if err != nil {
+			return nil, fmt.Errorf("scanning for disks: %v", err)
+		}
+
+		var scan smartctlScanOutput
+		if err := json.Unmarshal(output, &scan); err != nil {
+			return nil, fmt.Errorf("parsing smartctl scan output: %v", err)
+		}
+
+		for _, device := range scan.Devices {
+			devices = append(devices, smartctlDevice{name: device.Name, kind: device.Type})
+		}
+
+		if len(devices) == 0 {
+			return nil, errors.New("smartctl didn't find any disks")
+		}
+	}
+
+	job := newJob(func(device smartctlDevice) (smartctlOutput, error) {
+		return widget.querySmartctl(ctx, device)
+	}, devices)
+
+	outputs, errs, err := workerPoolDo(job)
+	if err != nil {
+		return nil, err
+	}
+
+	var failed int
+	var lastErr error
+
+	for i := range outputs {
+		if errs[i] != nil {
+			failed++
+			lastErr = errs[i]
+			// still shown, otherwise a disk which disappeared would go unnoticed
+			outputs[i] = smartctlOutput{}
+			outputs[i].Device.Name = devices[i].name
+		}
+	}
+
+	if failed == len(outputs) {
+		return nil, fmt.Errorf("%w: %v", errNoContent, lastErr)
+	} else if failed > 0 {
+		return outputs, fmt.Errorf("%w: %v", errPartialContent, lastErr)
+	}
+
+	return outputs, nil
+}
+
+func (widget *smartWidget) querySmartctl(ctx context.Context, device smartctlDevice) (smartctlOutput, error) {
+	// don't spin up disks which are asleep just to check on them
+	args := []string{"--json", "--all", "--nocheck=standby"}
+	if device.kind != "" {
+		args = append(args, "--device", device.kind)
+	}
+	args = append(args, device.name)
+
+	var result smartctlOutput
+
+	// the exit status is a bitmask which is also non-zero when the disk is
+	// failing or in standby, so the output is parsed regardless
+	output, err := exec.CommandContext(ctx, widget.SmartctlPath, args...).Output()
+	if len(output) == 0 {
+		if err == nil {
+			err = errors.New("no output")
+		}
+		return result, fmt.Errorf("running smartctl for %s: %v", device.name, err)
+	}
+
+	if err := json.Unmarshal(output, &result); err != nil {
+		return result, fmt.Errorf("parsing smartctl output for %s: %v", device.name, err)
+	}
+
+	if result.Device.Name == "" {
+		result.Device.Name = device.name
+	}
+
+	return result, nil
+}
+
+func (widget *smartWidget) diskFromOutput(output *smartctlOutput) smartDisk {
+	disk := smartDisk{
+		Name:        output.Device.Name,
+		Model:       output.ModelName,
+		Serial:      output.SerialNumber,
+		WearPercent: -1,
+		Temperature: -1,
+	}
+
+	if output.UserCapacity.Bytes > 0 {
+		disk.Capacity = formatDiskCapacity(output.UserCapacity.Bytes)
+	}
+
+	if output.SmartStatus == nil {
+		disk.Status = smartStatusUnknown
+
+		for _, message := range output.Smartctl.Messages {
+			if strings.Contains(strings.ToUpper(message.String), "STANDBY") {
+				disk.Status = smartStatusStandby
+				break
+			}
+		}
+
+		if disk.Status == smartStatusUnknown {
+			for _, message := range output.Smartctl.Messages {
+				if message.Severity == "error" {
+					disk.Problems = append(disk.Problems, message.String)
+				}
+			}
+		}
+
+		return disk
+	}
+
+	warn := func(problem string) {
+		disk.Problems = append(disk.Problems, problem)
+		if disk.Status != smartStatusFailing {
+			disk.Status = smartStatusWarning
+		}
+	}
+
+	fail := func(problem string) {
+		disk.Problems = append(disk.Problems, problem)
+		disk.Status = smartStatusFailing
+	}
+
+	disk.Status = smartStatusHealthy
+
+	if !output.SmartStatus.Passed {
+		fail("SMART overall health self-assessment failed")
+	}
+
+	if output.Temperature != nil && output.Temperature.Current > 0 {
+		disk.Temperature = output.Temperature.Current
+		if disk.Temperature >= widget.TemperatureThreshold {
+			disk.HotTemp = true
+			warn(fmt.Sprintf("Temperature is %d°C", disk.Temperature))
+		}
+	}
+
+	if output.PowerOnTime != nil {
+		disk.PowerOnTime = formatPowerOnHours(output.PowerOnTime.Hours)
+	}
+
+	if output.ATAAttributes != nil {
+		for _, attribute := range output.ATAAttributes.Table {
+			switch attribute.WhenFailed {
+			case "now":
+				fail(fmt.Sprintf("%s is below its threshold", smartAttributeName(attribute)))
+			case "past":
+				warn(fmt.Sprintf("%s was below its threshold in the past", smartAttributeName(attribute)))
+			}
+
+			switch attribute.ID {
+			case 5:
+				disk.HasSectorCounts = true
+				disk.Reallocated = attribute.Raw.Value
+			case 197:
+				disk.HasSectorCounts = true
+				disk.Pending = attribute.Raw.Value
+			case 198:
+				disk.HasSectorCounts = true
+				disk.Uncorrectable = attribute.Raw.Value
+			// vendors report the remaining life as the normalized value
+			// under one of these, starting at 100 and counting down
+			case 169, 173, 177, 202, 231, 233:
+				if disk.WearPercent == -1 && attribute.Value > 0 && attribute.Value <= 100 {
+					disk.WearPercent = 100 - attribute.Value
+				}
+			}
+		}
+
+		if disk.Reallocated > 0 {
+			warn(pluralize(int(disk.Reallocated), "reallocated sector"))
+		}
+
+		if disk.Pending > 0 {
+			warn(pluralize(int(disk.Pending), "sector") + " pending reallocation")
+		}
+
+		if disk.Uncorrectable > 0 {
+			warn(pluralize(int(disk.Uncorrectable), "uncorrectable sector"))
+		}
+	}
+
+	if health := output.NVMeHealth; health != nil {
+		disk.WearPercent = health.PercentageUsed
+		disk.HasMediaErrors = true
+		disk.MediaErrors = health.MediaErrors
+
+		if health.CriticalWarning != 0 {
+			fail(fmt.Sprintf("Critical warning reported (0x%02x)", health.CriticalWarning))
+		}
+
+		if health.AvailableSpareThreshold > 0 && health.AvailableSpare < health.AvailableSpareThreshold {
+			fail(fmt.Sprintf("Available spare is down to %d%%", health.AvailableSpare))
+		}
+
+		if health.MediaErrors > 0 {
+			warn(pluralize(int(health.MediaErrors), "media error"))
+		}
+	}
+
+	if disk.WearPercent >= widget.WearThreshold {
+		warn(fmt.Sprintf("%d%% of rated endurance used", disk.WearPercent))
+	}
+
+	return disk
+}
+
+func smartAttributeName(attribute smartctlATAAttribute) string {
+	if attribute.Name == "" {
+		return "Attribute " + strconv.Itoa(attribute.ID)
+	}
+
+	return strings.ReplaceAll(attribute.Name, "_", " ")
+}
+
+func (disk *smartDisk) DisplayName() string {
+	if disk.Model == "" {
+		return disk.Name
+	}
+
+	return disk.Model
+}
+
+func formatDiskCapacity(bytes int64) string {
+	// disks are sold in powers of 10, so show the size people recognize
+	const tb = 1_000_000_000_000
+	const gb = 1_000_000_000
+
+	if bytes >= tb {
+		return strconv.FormatFloat(math.Round(float64(bytes)/tb*10)/10, 'f', -1, 64) + " TB"
+	}
+
+	return strconv.FormatInt(bytes/gb, 10) + " GB"
+}
+
+func formatPowerOnHours(hours int) string {
+	if hours < 24 {
+		return pluralize(hours, "hour")
+	}
+
+	days := hours / 24
+	if days < 365 {
+		return pluralize(days, "day")
+	}
+
+	return strconv.FormatFloat(float64(days)/365, 'f', 1, 64) + " years"
+}
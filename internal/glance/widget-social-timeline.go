@@ -0,0 +1,481 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var socialTimelineWidgetTemplate = mustParseTemplate("social-timeline.html", "widget-base.html")
+
+const socialTimelineMaxMedia = 4
+
+type socialTimelineWidget struct {
+	widgetBase    `yaml:",inline"`
+	Sources       []socialTimelineSource `yaml:"sources"`
+	Limit         int                    `yaml:"limit"`
+	CollapseAfter int                    `yaml:"collapse-after"`
+	ShowSensitive bool                   `yaml:"show-sensitive"`
+	HideBoosts    bool                   `yaml:"hide-boosts"`
+
+	Posts []socialPost `yaml:"-"`
+}
+
+type socialTimelineSource struct {
+	Type     string `yaml:"type"`
+	Instance string `yaml:"instance"`
+	Account  string `yaml:"account"`
+	Hashtag  string `yaml:"hashtag"`
+	Token    string `yaml:"token"`
+}
+
+type socialPost struct {
+	ID           string
+	Url          string
+	AuthorName   string
+	AuthorHandle string
+	AuthorUrl    string
+	AuthorAvatar string
+	// Set when the post is shown because someone else boosted or reposted it
+	BoostedBy   string
+	Text        string
+	Media       []socialPostMedia
+	Sensitive   bool
+	Warning     string
+	PublishedAt time.Time
+	Replies     int
+	Boosts      int
+	Likes       int
+}
+
+type socialPostMedia struct {
+	Url          string
+	ThumbnailUrl string
+	Description  string
+	IsVideo      bool
+}
+
+func (widget *socialTimelineWidget) initialize() error {
+	widget.withTitle("Timeline").withCacheDuration(10 * time.Minute)
+
+	if len(widget.Sources) == 0 {
+		return errors.New("at least one source is required")
+	}
+
+	for i := range widget.Sources {
+		source := &widget.Sources[i]
+		source.Account = strings.TrimPrefix(source.Account, "@")
+		source.Hashtag = strings.TrimPrefix(source.Hashtag, "#")
+
+		switch source.Type {
+		case "mastodon":
+			if source.Instance == "" {
+				return fmt.Errorf("instance is required for mastodon source #%d", i+1)
+			}
+
+			source.Instance = strings.TrimRight(source.Instance, "/")
+			if !strings.HasPrefix(source.Instance, "http://") && !strings.HasPrefix(source.Instance, "https://") {
+				source.Instance = "https://" + source.Instance
+			}
+
+			if (source.Account == "") == (source.Hashtag == "") {
+				return fmt.Errorf("exactly one of account or hashtag is required for mastodon source #%d", i+1)
+			}
+		case "bluesky":
+			if source.Account == "" {
+				return fmt.Errorf("account is required for bluesky source #%d", i+1)
+			}
+
+			if source.Hashtag != "" {
+				return fmt.Errorf("hashtag is not supported for bluesky source #%d", i+1)
+			}
+		case "":
+			return fmt.Errorf("type is required for source #%d", i+1)
+		default:
+			return fmt.Errorf("unsupported type %q for source #%d, expected mastodon or bluesky", source.Type, i+1)
+		}
+	}
+
+	if widget.Limit <= 0 {
+		widget.Limit = 15
+	}
+
+	if widget.CollapseAfter == 0 || widget.CollapseAfter < -1 {
+		widget.CollapseAfter = 5
+	}
+
+	return nil
+}
+
+func (widget *socialTimelineWidget) update(ctx context.Context) {
+	posts, err := fetchSocialTimeline(widget.httpClient(defaultHTTPClient), widget.Sources, widget.Limit)
+
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	if widget.HideBoosts {
+		filtered := posts[:0]
+		for i := range posts {
+			if posts[i].BoostedBy == "" {
+				filtered = append(filtered, posts[i])
+			}
+		}
+		posts = filtered
+	}
+
+	if len(posts) > widget.Limit {
+		posts = posts[:widget.Limit]
+	}
+
+	if widget.ShowSensitive {
+		for i := range posts {
+			posts[i].Sensitive = false
+		}
+	}
+
+	widget.Posts = posts
+}
+
+func (widget *socialTimelineWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, socialTimelineWidgetTemplate)
+}
+
+func fetchSocialTimeline(client requestDoer, sources []socialTimelineSource, limit int) ([]socialPost, error) {
+	task := func(source socialTimelineSource) ([]socialPost, error) {
+		if source.Type == "bluesky" {
+			return fetchBlueskyAuthorFeed(client, source, limit)
+		}
+
+		return fetchMastodonTimeline(client, source, limit)
+	}
+
+	job := newJob(task, sources).withWorkers(10)
+	results, errs, err := workerPoolDo(job)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNoContent, err)
+	}
+
+	posts := make([]socialPost, 0, len(sources)*limit)
+	seen := make(map[string]bool)
+	var failed int
+	var lastErr error
+
+	for i := range results {
+		if errs[i] != nil {
+			failed++
+			lastErr = errs[i]
+			slog.Error("Failed to fetch social timeline", "type", sources[i].Type, "account", sources[i].Account, "hashtag", sources[i].Hashtag, "error", errs[i])
+			continue
+		}
+
+		for j := range results[i] {
+			// the same post can show up in more than one source, e.g. an account and a hashtag it uses
+			if seen[results[i][j].Url] {
+				continue
+			}
+			seen[results[i][j].Url] = true
+			posts = append(posts, results[i][j])
+		}
+	}
+
+	if failed == len(sources) {
+		return nil, fmt.Errorf("%w: %v", errNoContent, lastErr)
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].PublishedAt.After(posts[j].PublishedAt)
+	})
+
+	if failed > 0 {
+		return posts, fmt.Errorf("%w: could not fetch %d sources", errPartialContent, failed)
+	}
+
+	return posts, nil
+}
+
+type mastodonAccountJson struct {
+	ID          string `json:"id"`
+	Acct        string `json:"acct"`
+	DisplayName string `json:"display_name"`
+	Avatar      string `json:"avatar"`
+	Url         string `json:"url"`
+}
+
+type mastodonStatusJson struct {
+	ID              string              `json:"id"`
+	CreatedAt       string              `json:"created_at"`
+	Url             string              `json:"url"`
+	Content         string              `json:"content"`
+	SpoilerText     string              `json:"spoiler_text"`
+	Sensitive       bool                `json:"sensitive"`
+	RepliesCount    int                 `json:"replies_count"`
+	ReblogsCount    int                 `json:"reblogs_count"`
+	FavouritesCount int                 `json:"favourites_count"`
+	Account         mastodonAccountJson `json:"account"`
+	Reblog          *mastodonStatusJson `json:"reblog"`
+	Media           []struct {
+		Type        string `json:"type"`
+		Url         string `json:"url"`
+		PreviewUrl  string `json:"preview_url"`
+		Description string `json:"description"`
+	} `json:"media_attachments"`
+}
+
+func newMastodonRequest(source socialTimelineSource, path string) (*http.Request, error) {
+	request, err := http.NewRequest("GET", source.Instance+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if source.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+source.Token)
+	}
+
+	return request, nil
+}
+
+func fetchMastodonTimeline(client requestDoer, source socialTimelineSource, limit int) ([]socialPost, error) {
+	var path string
+
+	if source.Hashtag != "" {
+		path = fmt.Sprintf("/api/v1/timelines/tag/%s?limit=%d", url.PathEscape(source.Hashtag), min(limit, 40))
+	} else {
+		request, err := newMastodonRequest(source, "/api/v1/accounts/lookup?acct="+url.QueryEscape(source.Account))
+		if err != nil {
+			return nil, err
+		}
+
+		account, err := decodeJsonFromRequest[mastodonAccountJson](client, request)
+		if err != nil {
+			return nil, fmt.Errorf("looking up account %s: %v", source.Account, err)
+		}
+
+		path = fmt.Sprintf("/api/v1/accounts/%s/statuses?limit=%d&exclude_replies=true", url.PathEscape(account.ID), min(limit, 40))
+	}
+
+	request, err := newMastodonRequest(source, path)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := decodeJsonFromRequest[[]mastodonStatusJson](client, request)
+	if err != nil {
+		return nil, err
+	}
+
+	posts := make([]socialPost, 0, len(statuses))
+
+	for i := range statuses {
+		status := &statuses[i]
+		var boostedBy string
+
+		if status.Reblog != nil {
+			boostedBy = ternary(status.Account.DisplayName != "", status.Account.DisplayName, status.Account.Acct)
+			status = status.Reblog
+		}
+
+		post := socialPost{
+			ID:           status.ID,
+			Url:          status.Url,
+			AuthorName:   ternary(status.Account.DisplayName != "", status.Account.DisplayName, status.Account.Acct),
+			AuthorHandle: "@" + status.Account.Acct,
+			AuthorUrl:    status.Account.Url,
+			AuthorAvatar: imageProxyURL(status.Account.Avatar),
+			BoostedBy:    boostedBy,
+			Text:         mastodonContentToText(status.Content),
+			Sensitive:    status.Sensitive || status.SpoilerText != "",
+			Warning:      status.SpoilerText,
+			PublishedAt:  parseRFC3339Time(status.CreatedAt),
+			Replies:      status.RepliesCount,
+			Boosts:       status.ReblogsCount,
+			Likes:        status.FavouritesCount,
+		}
+
+		for _, media := range status.Media {
+			if len(post.Media) == socialTimelineMaxMedia {
+				break
+			}
+
+			if media.PreviewUrl == "" {
+				continue
+			}
+
+			post.Media = append(post.Media, socialPostMedia{
+				Url:          media.Url,
+				ThumbnailUrl: imageProxyURL(media.PreviewUrl),
+				Description:  media.Description,
+				IsVideo:      media.Type == "video" || media.Type == "gifv",
+			})
+		}
+
+		posts = append(posts, post)
+	}
+
+	return posts, nil
+}
+
+var mastodonLineBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>|</p>\s*<p>`)
+
+// Mastodon returns the content of posts as HTML, only the line breaks
+// between paragraphs are kept since links and mentions are shown as text
+func mastodonContentToText(content string) string {
+	content = mastodonLineBreakPattern.ReplaceAllString(content, "\n")
+	content = htmlTagsWithAttributesPattern.ReplaceAllString(content, "")
+
+	return strings.TrimSpace(html.UnescapeString(content))
+}
+
+type blueskyAuthorFeedResponseJson struct {
+	Feed []struct {
+		Post   blueskyPostJson `json:"post"`
+		Reason *struct {
+			Type string            `json:"$type"`
+			By   blueskyAuthorJson `json:"by"`
+		} `json:"reason"`
+	} `json:"feed"`
+}
+
+type blueskyAuthorJson struct {
+	Handle      string `json:"handle"`
+	DisplayName string `json:"displayName"`
+	Avatar      string `json:"avatar"`
+}
+
+type blueskyImageJson struct {
+	Thumb    string `json:"thumb"`
+	Fullsize string `json:"fullsize"`
+	Alt      string `json:"alt"`
+}
+
+type blueskyPostJson struct {
+	Uri    string            `json:"uri"`
+	Author blueskyAuthorJson `json:"author"`
+	Record struct {
+		Text      string `json:"text"`
+		CreatedAt string `json:"createdAt"`
+	} `json:"record"`
+	Embed *struct {
+		Images    []blueskyImageJson `json:"images"`
+		Thumbnail string             `json:"thumbnail"`
+		Playlist  string             `json:"playlist"`
+		Media     *struct {
+			Images    []blueskyImageJson `json:"images"`
+			Thumbnail string             `json:"thumbnail"`
+		} `json:"media"`
+	} `json:"embed"`
+	ReplyCount  int `json:"replyCount"`
+	RepostCount int `json:"repostCount"`
+	LikeCount   int `json:"likeCount"`
+	Labels      []struct {
+		Val string `json:"val"`
+	} `json:"labels"`
+}
+
+var blueskySensitiveLabels = map[string]bool{
+	"porn":          true,
+	"sexual":        true,
+	"nudity":        true,
+	"graphic-media": true,
+	"gore":          true,
+}
+
+func fetchBlueskyAuthorFeed(client requestDoer, source socialTimelineSource, limit int) ([]socialPost, error) {
+	request, err := http.NewRequest(
+		"GET",
+		fmt.Sprintf(
+			"https://public.api.bsky.app/xrpc/app.bsky.feed.getAuthorFeed?actor=%s&limit=%d&filter=posts_no_replies",
+			url.QueryEscape(source.Account),
+			min(limit, 100),
+		),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := decodeJsonFromRequest[blueskyAuthorFeedResponseJson](client, request)
+	if err != nil {
+		return nil, err
+	}
+
+	posts := make([]socialPost, 0, len(response.Feed))
+
+	for i := range response.Feed {
+		item := &response.Feed[i]
+		post := &item.Post
+
+		// at://did:plc:xxx/app.bsky.feed.post/{rkey}
+		rkey := post.Uri[strings.LastIndex(post.Uri, "/")+1:]
+
+		p := socialPost{
+			ID:           rkey,
+			Url:          "https://bsky.app/profile/" + post.Author.Handle + "/post/" + rkey,
+			AuthorName:   ternary(post.Author.DisplayName != "", post.Author.DisplayName, post.Author.Handle),
+			AuthorHandle: "@" + post.Author.Handle,
+			AuthorUrl:    "https://bsky.app/profile/" + post.Author.Handle,
+			AuthorAvatar: imageProxyURL(post.Author.Avatar),
+			Text:         post.Record.Text,
+			PublishedAt:  parseRFC3339Time(post.Record.CreatedAt),
+			Replies:      post.ReplyCount,
+			Boosts:       post.RepostCount,
+			Likes:        post.LikeCount,
+		}
+
+		if item.Reason != nil && strings.HasSuffix(item.Reason.Type, "#reasonRepost") {
+			p.BoostedBy = ternary(item.Reason.By.DisplayName != "", item.Reason.By.DisplayName, item.Reason.By.Handle)
+		}
+
+		for _, label := range post.Labels {
+			if blueskySensitiveLabels[label.Val] {
+				p.Sensitive = true
+				p.Warning = label.Val
+				break
+			}
+		}
+
+		if embed := post.Embed; embed != nil {
+			images := embed.Images
+			thumbnail := embed.Thumbnail
+
+			// posts which quote another post keep their own media one level deeper
+			if embed.Media != nil {
+				images = embed.Media.Images
+				thumbnail = embed.Media.Thumbnail
+			}
+
+			for _, image := range images {
+				p.Media = append(p.Media, socialPostMedia{
+					Url:          image.Fullsize,
+					ThumbnailUrl: imageProxyURL(image.Thumb),
+					Description:  image.Alt,
+				})
+			}
+
+			if thumbnail != "" {
+				p.Media = append(p.Media, socialPostMedia{
+					Url:          p.Url,
+					ThumbnailUrl: imageProxyURL(thumbnail),
+					IsVideo:      true,
+				})
+			}
+		}
+
+		if len(p.Media) > socialTimelineMaxMedia {
+			p.Media = p.Media[:socialTimelineMaxMedia]
+		}
+
+		posts = append(posts, p)
+	}
+
+	return posts, nil
+}
@@ -0,0 +1,537 @@
+package glance
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var speedtestWidgetTemplate = mustParseTemplate("speedtest.html", "widget-base.html")
+
+const (
+	speedtestMethodSpeedtest = "speedtest"
+	speedtestMethodIperf3    = "iperf3"
+
+	speedtestServersURL        = "https://www.speedtest.net/api/js/servers?engine=js&limit=5&https_functional=true"
+	speedtestTransferDuration  = 10 * time.Second
+	speedtestConnections       = 4
+	speedtestUploadChunkSize   = 4 * 1024 * 1024
+	speedtestMinInterval       = 10 * time.Minute
+	speedtestDefaultInterval   = 6 * time.Hour
+	speedtestDefaultHistoryLen = 30
+)
+
+// Transfers can take a while, so the default client with its short timeout can't be used
+var speedtestHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:               proxyForRequest,
+		DialContext:         dialOutbound,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConnsPerHost: speedtestConnections,
+	},
+}
+
+type speedtestWidget struct {
+	widgetBase    `yaml:",inline"`
+	Method        string           `yaml:"method"`
+	Server        string           `yaml:"server"`
+	Interval      durationField    `yaml:"interval"`
+	HistoryLength int              `yaml:"history-length"`
+	Latest        *speedtestResult `yaml:"-"`
+	DownloadChart string           `yaml:"-"`
+	UploadChart   string           `yaml:"-"`
+	running       atomic.Bool      `yaml:"-"`
+	storeMu       sync.Mutex       `yaml:"-"`
+}
+
+type speedtestResult struct {
+	Time     time.Time `json:"time"`
+	Download float64   `json:"download_mbps"`
+	Upload   float64   `json:"upload_mbps"`
+	Ping     float64   `json:"ping_ms"`
+	Server   string    `json:"server"`
+}
+
+type speedtestState struct {
+	Results     []speedtestResult `json:"results"`
+	LastError   string            `json:"last_error,omitempty"`
+	LastErrorAt time.Time         `json:"last_error_at,omitzero"`
+}
+
+func (widget *speedtestWidget) initialize() error {
+	widget.withTitle("网速测试").withCacheDuration(time.Minute)
+
+	switch widget.Method {
+	case "":
+		widget.Method = speedtestMethodSpeedtest
+	case speedtestMethodSpeedtest:
+	case speedtestMethodIperf3:
+		if widget.Server == "" {
+			return errors.New("server is required when using iperf3")
+		}
+	default:
+		return fmt.Errorf("method must be either %s or %s", speedtestMethodSpeedtest, speedtestMethodIperf3)
+	}
+
+	if widget.Interval == 0 {
+		widget.Interval = durationField(speedtestDefaultInterval)
+	} else if time.Duration(widget.Interval) < speedtestMinInterval {
+		return fmt.Errorf("interval must be at least %s", speedtestMinInterval)
+	}
+
+	if widget.HistoryLength <= 0 {
+		widget.HistoryLength = speedtestDefaultHistoryLen
+	}
+
+	return nil
+}
+
+func (widget *speedtestWidget) storeKey() string {
+	return "speedtest:" + widget.Method + ":" + ternary(widget.Server == "", "auto", widget.Server)
+}
+
+func (widget *speedtestWidget) loadState() speedtestState {
+	state := speedtestState{}
+
+	if widget.Providers != nil && widget.Providers.store != nil {
+		widget.Providers.store.get(widget.storeKey(), &state)
+	}
+
+	return state
+}
+
+// The tests themselves run in the background, this only picks up their results
+func (widget *speedtestWidget) update(ctx context.Context) {
+	state := widget.loadState()
+	widget.scheduleNextUpdate()
+
+	var lastErr error
+	if state.LastError != "" {
+		lastErr = fmt.Errorf("last test failed: %s", state.LastError)
+	}
+
+	if len(state.Results) == 0 {
+		if lastErr != nil {
+			widget.withError(lastErr)
+			return
+		}
+
+		widget.withError(nil).withNotice(nil)
+		widget.Latest = nil
+		return
+	}
+
+	widget.withError(nil).withNotice(lastErr)
+	widget.Latest = &state.Results[len(state.Results)-1]
+
+	downloads := make([]float64, len(state.Results))
+	uploads := make([]float64, len(state.Results))
+
+	for i := range state.Results {
+		downloads[i] = state.Results[i].Download
+		uploads[i] = state.Results[i].Upload
+	}
+
+	widget.DownloadChart = svgPolylineCoordsFromYValues(100, 30, downloads)
+	widget.UploadChart = svgPolylineCoordsFromYValues(100, 30, uploads)
+}
+
+func (widget *speedtestWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, speedtestWidgetTemplate)
+}
+
+func (widget *speedtestWidget) IsRunning() bool {
+	return widget.running.Load()
+}
+
+func (widget *speedtestWidget) runInBackground(ctx context.Context) {
+	interval := time.Duration(widget.Interval)
+	wait := time.Minute
+
+	// continue where the previous run left off rather than testing on every restart
+	if state := widget.loadState(); len(state.Results) > 0 {
+		wait = max(wait, time.Until(state.Results[len(state.Results)-1].Time.Add(interval)))
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		widget.runTest(ctx)
+		timer.Reset(interval)
+	}
+}
+
+func (widget *speedtestWidget) runTest(ctx context.Context) {
+	widget.running.Store(true)
+	defer widget.running.Store(false)
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	var result *speedtestResult
+	var err error
+
+	switch widget.Method {
+	case speedtestMethodSpeedtest:
+		result, err = runSpeedtestNetTest(ctx, widget.httpClient(defaultHTTPClient), widget.Server)
+	case speedtestMethodIperf3:
+		result, err = runIperf3Test(ctx, widget.Server)
+	}
+
+	// the application was stopped mid test
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return
+	}
+
+	widget.storeMu.Lock()
+	defer widget.storeMu.Unlock()
+
+	state := widget.loadState()
+
+	if err != nil {
+		slog.Error("Speed test failed", "method", widget.Method, "error", err)
+		state.LastError = err.Error()
+		state.LastErrorAt = time.Now()
+	} else {
+		result.Time = time.Now()
+		state.LastError = ""
+		state.LastErrorAt = time.Time{}
+		state.Results = append(state.Results, *result)
+
+		if len(state.Results) > widget.HistoryLength {
+			state.Results = state.Results[len(state.Results)-widget.HistoryLength:]
+		}
+	}
+
+	if widget.Providers == nil || widget.Providers.store == nil {
+		return
+	}
+
+	if err := widget.Providers.store.set(widget.storeKey(), state); err != nil {
+		slog.Error("Failed to save speed test result", "error", err)
+	}
+}
+
+func (r *speedtestResult) DownloadText() string { return formatMbps(r.Download) }
+func (r *speedtestResult) UploadText() string   { return formatMbps(r.Upload) }
+
+func (r *speedtestResult) PingText() string {
+	return strconv.Itoa(int(math.Round(r.Ping)))
+}
+
+func formatMbps(mbps float64) string {
+	if mbps >= 1000 {
+		return strconv.FormatFloat(mbps/1000, 'f', 2, 64) + " Gbps"
+	}
+
+	return strconv.FormatFloat(mbps, 'f', ternary(mbps < 10, 1, 0), 64) + " Mbps"
+}
+
+type speedtestServerJson struct {
+	URL     string `json:"url"`
+	Host    string `json:"host"`
+	Name    string `json:"name"`
+	Sponsor string `json:"sponsor"`
+}
+
+type speedtestServer struct {
+	baseURL string
+	name    string
+	ping    float64
+}
+
+// Uses the HTTP based protocol which speedtest.net servers still support
+// The widget's request options only apply to finding a server, retrying the
+// measurements themselves would skew the results
+func runSpeedtestNetTest(ctx context.Context, client requestDoer, configuredServer string) (*speedtestResult, error) {
+	candidates := make([]speedtestServer, 0)
+
+	if configuredServer != "" {
+		baseURL := configuredServer
+		if !strings.Contains(baseURL, "://") {
+			baseURL = "http://" + baseURL
+		}
+
+		candidates = append(candidates, speedtestServer{baseURL: strings.TrimRight(baseURL, "/"), name: configuredServer})
+	} else {
+		request, _ := http.NewRequestWithContext(ctx, "GET", speedtestServersURL, nil)
+		servers, err := decodeJsonFromRequest[[]speedtestServerJson](client, request)
+		if err != nil {
+			return nil, fmt.Errorf("fetching servers: %v", err)
+		}
+
+		for _, server := range servers {
+			parsed, err := url.Parse(server.URL)
+			if err != nil {
+				continue
+			}
+
+			candidates = append(candidates, speedtestServer{
+				baseURL: parsed.Scheme + "://" + parsed.Host,
+				name:    server.Sponsor + " (" + server.Name + ")",
+			})
+		}
+	}
+
+	var best *speedtestServer
+	var lastErr error
+
+	for i := range candidates {
+		ping, err := measureSpeedtestPing(ctx, candidates[i].baseURL)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		candidates[i].ping = ping
+		if best == nil || ping < best.ping {
+			best = &candidates[i]
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("no reachable servers, last error: %v", lastErr)
+	}
+
+	download, err := measureSpeedtestTransfer(ctx, func(ctx context.Context, counter *atomic.Int64) error {
+		request, _ := http.NewRequestWithContext(ctx, "GET", best.baseURL+"/speedtest/random4000x4000.jpg?x="+speedtestNonce(), nil)
+		response, err := speedtestHTTPClient.Do(request)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status code %d", response.StatusCode)
+		}
+
+		_, err = io.Copy(io.Discard, &countingReader{reader: response.Body, counter: counter})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("measuring download: %v", err)
+	}
+
+	payload := make([]byte, speedtestUploadChunkSize)
+	rand.Read(payload)
+
+	upload, err := measureSpeedtestTransfer(ctx, func(ctx context.Context, counter *atomic.Int64) error {
+		body := &countingReader{reader: bytes.NewReader(payload), counter: counter}
+		request, _ := http.NewRequestWithContext(ctx, "POST", best.baseURL+"/speedtest/upload.php?x="+speedtestNonce(), body)
+		request.ContentLength = int64(len(payload))
+		request.Header.Set("Content-Type", "application/octet-stream")
+
+		response, err := speedtestHTTPClient.Do(request)
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("measuring upload: %v", err)
+	}
+
+	return &speedtestResult{
+		Download: download,
+		Upload:   upload,
+		Ping:     best.ping,
+		Server:   best.name,
+	}, nil
+}
+
+func measureSpeedtestPing(ctx context.Context, baseURL string) (float64, error) {
+	best := math.Inf(1)
+
+	for range 5 {
+		request, _ := http.NewRequestWithContext(ctx, "GET", baseURL+"/speedtest/latency.txt?x="+speedtestNonce(), nil)
+		start := time.Now()
+
+		response, err := defaultHTTPClient.Do(request)
+		if err != nil {
+			return 0, err
+		}
+		io.Copy(io.Discard, response.Body)
+		response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			return 0, fmt.Errorf("unexpected status code %d from %s", response.StatusCode, baseURL)
+		}
+
+		best = math.Min(best, float64(time.Since(start).Microseconds())/1000)
+	}
+
+	return best, nil
+}
+
+// Runs the transfer over several connections for a fixed amount of time and
+// returns the throughput in megabits per second
+func measureSpeedtestTransfer(ctx context.Context, transfer func(context.Context, *atomic.Int64) error) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, speedtestTransferDuration)
+	defer cancel()
+
+	var transferred atomic.Int64
+	var failures int
+	var lastErr error
+	var errMu sync.Mutex
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	for range speedtestConnections {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for ctx.Err() == nil {
+				if err := transfer(ctx, &transferred); err != nil && ctx.Err() == nil {
+					errMu.Lock()
+					failures++
+					lastErr = err
+					errMu.Unlock()
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	elapsed := time.Since(start).Seconds()
+
+	if failures == speedtestConnections {
+		return 0, lastErr
+	}
+
+	if transferred.Load() == 0 {
+		return 0, errors.New("nothing was transferred")
+	}
+
+	return float64(transferred.Load()) * 8 / elapsed / 1_000_000, nil
+}
+
+type countingReader struct {
+	reader  io.Reader
+	counter *atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.counter.Add(int64(n))
+	return n, err
+}
+
+func speedtestNonce() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+type iperf3ResultJson struct {
+	Error string `json:"error"`
+	End   struct {
+		SumReceived struct {
+			BitsPerSecond float64 `json:"bits_per_second"`
+		} `json:"sum_received"`
+	} `json:"end"`
+}
+
+func runIperf3Test(ctx context.Context, server string) (*speedtestResult, error) {
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		host, port = server, "5201"
+	}
+
+	ping, err := measureTCPPing(ctx, net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %v", server, err)
+	}
+
+	// the server can only run one test at a time, so these can't be done in parallel
+	download, err := runIperf3(ctx, host, port, true)
+	if err != nil {
+		return nil, fmt.Errorf("measuring download: %v", err)
+	}
+
+	upload, err := runIperf3(ctx, host, port, false)
+	if err != nil {
+		return nil, fmt.Errorf("measuring upload: %v", err)
+	}
+
+	return &speedtestResult{
+		Download: download,
+		Upload:   upload,
+		Ping:     ping,
+		Server:   server,
+	}, nil
+}
+
+func runIperf3(ctx context.Context, host, port string, reverse bool) (float64, error) {
+	args := []string{
+		"--client", host,
+		"--port", port,
+		"--json",
+		"--parallel", strconv.Itoa(speedtestConnections),
+		"--time", strconv.Itoa(int(speedtestTransferDuration.Seconds())),
+	}
+
+	if reverse {
+		args = append(args, "--reverse")
+	}
+
+	output, err := exec.CommandContext(ctx, "iperf3", args...).Output()
+
+	var result iperf3ResultJson
+	if jsonErr := json.Unmarshal(output, &result); jsonErr != nil {
+		if err != nil {
+			return 0, fmt.Errorf("running iperf3: %v", err)
+		}
+
+		return 0, fmt.Errorf("parsing iperf3 output: %v", jsonErr)
+	}
+
+	if result.Error != "" {
+		return 0, errors.New(result.Error)
+	}
+
+	return result.End.SumReceived.BitsPerSecond / 1_000_000, nil
+}
+
+func measureTCPPing(ctx context.Context, address string) (float64, error) {
+	best := math.Inf(1)
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+
+	for range 3 {
+		start := time.Now()
+
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return 0, err
+		}
+		conn.Close()
+
+		best = math.Min(best, float64(time.Since(start).Microseconds())/1000)
+	}
+
+	return best, nil
+}
@@ -0,0 +1,294 @@
+package glance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var sshCommandWidgetTemplate = mustParseTemplate("ssh-command.html", "widget-base.html")
+
+const commandMaxOutputSize = 1 << 20
+
+type sshCommandWidget struct {
+	widgetBase       `yaml:",inline"`
+	Host             string             `yaml:"host"`
+	Port             uint16             `yaml:"port"`
+	User             string             `yaml:"user"`
+	PrivateKey       string             `yaml:"private-key"`
+	PrivateKeyPath   string             `yaml:"private-key-path"`
+	Passphrase       string             `yaml:"passphrase"`
+	HostKey          string             `yaml:"host-key"`
+	KnownHostsPath   string             `yaml:"known-hosts-path"`
+	AllowInsecure    bool               `yaml:"allow-insecure"`
+	Command          string             `yaml:"command"`
+	IgnoreExitCode   bool               `yaml:"ignore-exit-code"`
+	Timeout          durationField      `yaml:"timeout"`
+	Template         string             `yaml:"template"`
+	Options          customAPIOptions   `yaml:"options"`
+	Frameless        bool               `yaml:"frameless"`
+	CompiledHTML     template.HTML      `yaml:"-"`
+	compiledTemplate *template.Template `yaml:"-"`
+	clientConfig     *ssh.ClientConfig  `yaml:"-"`
+	address          string             `yaml:"-"`
+}
+
+type commandOutputTemplateData struct {
+	Output   string
+	Stderr   string
+	ExitCode int
+	Options  customAPIOptions
+}
+
+func (data *commandOutputTemplateData) Lines() []string {
+	output := strings.TrimRight(data.Output, "\n")
+	if output == "" {
+		return []string{}
+	}
+
+	return strings.Split(output, "\n")
+}
+
+// For commands which output JSON, works the same way as in the custom API widget
+func (data *commandOutputTemplateData) JSON() *decoratedGJSONResult {
+	return &decoratedGJSONResult{gjson.Parse(data.Output)}
+}
+
+func (widget *sshCommandWidget) initialize() error {
+	widget.withTitle("SSH").withCacheDuration(5 * time.Minute)
+
+	if widget.Host == "" {
+		return errors.New("host is required")
+	}
+
+	if widget.User == "" {
+		return errors.New("user is required")
+	}
+
+	if widget.Command == "" {
+		return errors.New("command is required")
+	}
+
+	if widget.Port == 0 {
+		widget.Port = 22
+	}
+	widget.address = net.JoinHostPort(widget.Host, strconv.Itoa(int(widget.Port)))
+
+	if widget.Timeout == 0 {
+		widget.Timeout = durationField(10 * time.Second)
+	}
+
+	signer, err := widget.parsePrivateKey()
+	if err != nil {
+		return err
+	}
+
+	hostKeyCallback, err := widget.hostKeyCallback()
+	if err != nil {
+		return err
+	}
+
+	widget.clientConfig = &ssh.ClientConfig{
+		User:            widget.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         time.Duration(widget.Timeout),
+	}
+
+	if widget.Template != "" {
+		compiledTemplate, err := template.New("").Funcs(customAPITemplateFuncs).Parse(widget.Template)
+		if err != nil {
+			return fmt.Errorf("parsing template: %w", err)
+		}
+
+		widget.compiledTemplate = compiledTemplate
+	}
+
+	return nil
+}
+
+func (widget *sshCommandWidget) parsePrivateKey() (ssh.Signer, error) {
+	key := []byte(widget.PrivateKey)
+
+	if widget.PrivateKeyPath != "" {
+		if widget.PrivateKey != "" {
+			return nil, errors.New("only one of private-key or private-key-path can be specified")
+		}
+
+		var err error
+		key, err = os.ReadFile(widget.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading private key: %v", err)
+		}
+	}
+
+	if len(key) == 0 {
+		return nil, errors.New("either private-key or private-key-path is required")
+	}
+
+	var signer ssh.Signer
+	var err error
+
+	if widget.Passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(widget.Passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(key)
+	}
+
+	if err != nil {
+		var missingPassphrase *ssh.PassphraseMissingError
+		if errors.As(err, &missingPassphrase) {
+			return nil, errors.New("the private key is encrypted, specify its passphrase")
+		}
+
+		return nil, fmt.Errorf("parsing private key: %v", err)
+	}
+
+	return signer, nil
+}
+
+func (widget *sshCommandWidget) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	switch {
+	case widget.HostKey != "":
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(widget.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("parsing host-key: %v", err)
+		}
+
+		return ssh.FixedHostKey(key), nil
+	case widget.KnownHostsPath != "":
+		callback, err := knownhosts.New(widget.KnownHostsPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading known hosts: %v", err)
+		}
+
+		return callback, nil
+	case widget.AllowInsecure:
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	return nil, errors.New("either host-key or known-hosts-path is required to verify the identity of the host")
+}
+
+func (widget *sshCommandWidget) update(ctx context.Context) {
+	data, err := widget.runCommand(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	compiledHTML, err := renderCommandOutput(widget.compiledTemplate, data)
+	if err != nil {
+		widget.withError(err).scheduleEarlyUpdate()
+		return
+	}
+
+	widget.CompiledHTML = compiledHTML
+}
+
+// Shared with the shell command widget, the output is shown as is when there's no template
+func renderCommandOutput(tmpl *template.Template, data *commandOutputTemplateData) (template.HTML, error) {
+	if tmpl == nil {
+		return template.HTML(`<pre class="command-output">` + template.HTMLEscapeString(data.Output) + `</pre>`), nil
+	}
+
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, data); err != nil {
+		return "", err
+	}
+
+	return template.HTML(buffer.String()), nil
+}
+
+func (widget *sshCommandWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, sshCommandWidgetTemplate)
+}
+
+func (widget *sshCommandWidget) runCommand(ctx context.Context) (*commandOutputTemplateData, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(widget.Timeout))
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", widget.address)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %v", widget.address, err)
+	}
+
+	// covers the handshake and the command, the ssh package doesn't take a context
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	sshConn, channels, requests, err := ssh.NewClientConn(conn, widget.address, widget.clientConfig)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connecting to %s: %v", widget.address, err)
+	}
+
+	client := ssh.NewClient(sshConn, channels, requests)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("opening session: %v", err)
+	}
+	defer session.Close()
+
+	var stdout, stderr limitedBuffer
+	stdout.limit = commandMaxOutputSize
+	stderr.limit = commandMaxOutputSize
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	data := &commandOutputTemplateData{Options: widget.Options}
+
+	err = session.Run(widget.Command)
+	data.Output = stdout.String()
+	data.Stderr = stderr.String()
+
+	if err != nil {
+		var exitErr *ssh.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("running command: %v", err)
+		}
+
+		data.ExitCode = exitErr.ExitStatus()
+
+		if !widget.IgnoreExitCode {
+			message := strings.TrimSpace(data.Stderr)
+			if message == "" {
+				message = "no output on stderr"
+			}
+			message, _ = limitStringLength(message, 200)
+
+			return nil, fmt.Errorf("command exited with code %d: %s", data.ExitCode, message)
+		}
+	}
+
+	return data, nil
+}
+
+// Keeps at most limit bytes and discards the rest, so that a command with a
+// lot of output doesn't use up memory
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - b.Len(); remaining > 0 {
+		b.Buffer.Write(p[:min(len(p), remaining)])
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,330 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var syncthingWidgetTemplate = mustParseTemplate("syncthing.html", "widget-base.html")
+
+type syncthingWidget struct {
+	widgetBase    `yaml:",inline"`
+	URL           string           `yaml:"url"`
+	APIKey        string           `yaml:"api-key"`
+	AllowInsecure bool             `yaml:"allow-insecure"`
+	Folders       []string         `yaml:"folders"`
+	HideDevices   bool             `yaml:"hide-devices"`
+	ErrorsLimit   int              `yaml:"errors-limit"`
+	Status        *syncthingStatus `yaml:"-"`
+	client        requestDoer      `yaml:"-"`
+}
+
+type syncthingStatus struct {
+	Folders []syncthingFolder
+	Devices []syncthingDevice
+	Errors  []syncthingError
+}
+
+type syncthingFolder struct {
+	ID            string
+	Label         string
+	State         string
+	Paused        bool
+	CompletionPct int
+	NeedBytes     int64
+	NeedItems     int
+	PullErrors    int
+}
+
+type syncthingDevice struct {
+	Name      string
+	Connected bool
+	Paused    bool
+	Address   string
+}
+
+type syncthingError struct {
+	When    time.Time
+	Message string
+}
+
+type syncthingFolderConfigJson struct {
+	ID     string `json:"id"`
+	Label  string `json:"label"`
+	Paused bool   `json:"paused"`
+}
+
+type syncthingDeviceConfigJson struct {
+	DeviceID string `json:"deviceID"`
+	Name     string `json:"name"`
+	Paused   bool   `json:"paused"`
+}
+
+type syncthingFolderStatusJson struct {
+	State       string `json:"state"`
+	GlobalBytes int64  `json:"globalBytes"`
+	InSyncBytes int64  `json:"inSyncBytes"`
+	NeedBytes   int64  `json:"needBytes"`
+	NeedFiles   int    `json:"needFiles"`
+	NeedDirs    int    `json:"needDirectories"`
+	NeedDeletes int    `json:"needDeletes"`
+	PullErrors  int    `json:"pullErrors"`
+}
+
+type syncthingConnectionsJson struct {
+	Connections map[string]struct {
+		Connected bool   `json:"connected"`
+		Paused    bool   `json:"paused"`
+		Address   string `json:"address"`
+	} `json:"connections"`
+}
+
+type syncthingSystemStatusJson struct {
+	MyID string `json:"myID"`
+}
+
+type syncthingSystemErrorsJson struct {
+	Errors []struct {
+		When    time.Time `json:"when"`
+		Message string    `json:"message"`
+	} `json:"errors"`
+}
+
+func (widget *syncthingWidget) initialize() error {
+	widget.withTitle("Syncthing").withCacheDuration(1 * time.Minute)
+
+	if widget.URL == "" {
+		return errors.New("url is required")
+	}
+
+	if widget.APIKey == "" {
+		return errors.New("api-key is required")
+	}
+
+	widget.URL = strings.TrimRight(widget.URL, "/")
+
+	if widget.ErrorsLimit == 0 {
+		widget.ErrorsLimit = 3
+	}
+
+	widget.client = widget.httpClient(ternary(widget.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient))
+
+	return nil
+}
+
+func (widget *syncthingWidget) update(ctx context.Context) {
+	status, err := widget.fetchStatus(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Status = status
+}
+
+func (widget *syncthingWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, syncthingWidgetTemplate)
+}
+
+func (widget *syncthingWidget) request(ctx context.Context, path string) *http.Request {
+	request, _ := http.NewRequestWithContext(ctx, "GET", widget.URL+path, nil)
+	request.Header.Set("X-API-Key", widget.APIKey)
+
+	return request
+}
+
+func (widget *syncthingWidget) fetchStatus(ctx context.Context) (*syncthingStatus, error) {
+	var (
+		wg          sync.WaitGroup
+		folders     []syncthingFolderConfigJson
+		devices     []syncthingDeviceConfigJson
+		connections syncthingConnectionsJson
+		system      syncthingSystemStatusJson
+		systemErrs  syncthingSystemErrorsJson
+		errs        [5]error
+	)
+
+	fetch := func(i int, path string, fn func(*http.Request) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(widget.request(ctx, path))
+		}()
+	}
+
+	fetch(0, "/rest/config/folders", func(r *http.Request) (err error) {
+		folders, err = decodeJsonFromRequest[[]syncthingFolderConfigJson](widget.client, r)
+		return
+	})
+	fetch(1, "/rest/config/devices", func(r *http.Request) (err error) {
+		devices, err = decodeJsonFromRequest[[]syncthingDeviceConfigJson](widget.client, r)
+		return
+	})
+	fetch(2, "/rest/system/connections", func(r *http.Request) (err error) {
+		connections, err = decodeJsonFromRequest[syncthingConnectionsJson](widget.client, r)
+		return
+	})
+	fetch(3, "/rest/system/status", func(r *http.Request) (err error) {
+		system, err = decodeJsonFromRequest[syncthingSystemStatusJson](widget.client, r)
+		return
+	})
+	fetch(4, "/rest/system/error", func(r *http.Request) (err error) {
+		systemErrs, err = decodeJsonFromRequest[syncthingSystemErrorsJson](widget.client, r)
+		return
+	})
+
+	wg.Wait()
+
+	// the folders are the main thing, without them there's nothing to show
+	if errs[0] != nil {
+		return nil, fmt.Errorf("%w: fetching folders: %v", errNoContent, errs[0])
+	}
+
+	var partialErr error
+	for _, err := range errs[1:] {
+		if err != nil {
+			partialErr = fmt.Errorf("%w: %v", errPartialContent, err)
+			break
+		}
+	}
+
+	if len(widget.Folders) > 0 {
+		folders = slices.DeleteFunc(folders, func(f syncthingFolderConfigJson) bool {
+			return !slices.Contains(widget.Folders, f.ID) && !slices.Contains(widget.Folders, f.Label)
+		})
+	}
+
+	requests := make([]*http.Request, len(folders))
+	for i := range folders {
+		requests[i] = widget.request(ctx, "/rest/db/status?folder="+url.QueryEscape(folders[i].ID))
+	}
+
+	job := newJob(decodeJsonFromRequestTask[syncthingFolderStatusJson](widget.client), requests)
+	folderStatuses, folderErrs, err := workerPoolDo(job)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &syncthingStatus{
+		Folders: make([]syncthingFolder, 0, len(folders)),
+	}
+
+	for i := range folders {
+		config := &folders[i]
+		folder := syncthingFolder{
+			ID:     config.ID,
+			Label:  ternary(config.Label == "", config.ID, config.Label),
+			Paused: config.Paused,
+		}
+
+		if folderErrs[i] != nil {
+			folder.State = "unknown"
+			partialErr = fmt.Errorf("%w: fetching status of folder %s: %v", errPartialContent, folder.Label, folderErrs[i])
+		} else {
+			s := &folderStatuses[i]
+			folder.State = s.State
+			folder.NeedBytes = s.NeedBytes
+			folder.NeedItems = s.NeedFiles + s.NeedDirs + s.NeedDeletes
+			folder.PullErrors = s.PullErrors
+			folder.CompletionPct = 100
+
+			if s.GlobalBytes > 0 {
+				folder.CompletionPct = int(float64(s.InSyncBytes) / float64(s.GlobalBytes) * 100)
+				// don't show 100% while there's still something left to sync
+				if folder.CompletionPct == 100 && s.NeedBytes > 0 {
+					folder.CompletionPct = 99
+				}
+			}
+		}
+
+		if folder.Paused {
+			folder.State = "paused"
+		}
+
+		status.Folders = append(status.Folders, folder)
+	}
+
+	if !widget.HideDevices && errs[1] == nil {
+		for i := range devices {
+			config := &devices[i]
+			if config.DeviceID == system.MyID {
+				continue
+			}
+
+			device := syncthingDevice{
+				Name:   ternary(config.Name == "", config.DeviceID[:min(7, len(config.DeviceID))], config.Name),
+				Paused: config.Paused,
+			}
+
+			if connection, ok := connections.Connections[config.DeviceID]; ok {
+				device.Connected = connection.Connected
+				device.Address = connection.Address
+				device.Paused = device.Paused || connection.Paused
+			}
+
+			status.Devices = append(status.Devices, device)
+		}
+	}
+
+	for i := len(systemErrs.Errors) - 1; i >= 0 && len(status.Errors) < widget.ErrorsLimit; i-- {
+		status.Errors = append(status.Errors, syncthingError{
+			When:    systemErrs.Errors[i].When,
+			Message: systemErrs.Errors[i].Message,
+		})
+	}
+
+	return status, partialErr
+}
+
+func (folder *syncthingFolder) StateText() string {
+	switch folder.State {
+	case "idle":
+		if folder.NeedItems > 0 || folder.PullErrors > 0 {
+			return "Out of sync"
+		}
+		return "Up to date"
+	case "syncing", "sync-preparing":
+		return "Syncing"
+	case "scanning", "scan-waiting", "sync-waiting", "cleaning", "clean-waiting":
+		return "Scanning"
+	case "error":
+		return "Error"
+	case "paused":
+		return "Paused"
+	}
+
+	return folder.State
+}
+
+func (folder *syncthingFolder) HasProblem() bool {
+	return folder.State == "error" || folder.PullErrors > 0 || (folder.State == "idle" && folder.NeedItems > 0)
+}
+
+func (folder *syncthingFolder) NeedText() string {
+	return formatBytesApprox(folder.NeedBytes)
+}
+
+func formatBytesApprox(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	value := float64(bytes)
+	suffixes := []string{"KB", "MB", "GB", "TB", "PB"}
+	i := -1
+
+	for value >= unit && i < len(suffixes)-1 {
+		value /= unit
+		i++
+	}
+
+	return fmt.Sprintf("%.1f %s", value, suffixes[i])
+}
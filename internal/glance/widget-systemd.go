@@ -0,0 +1,310 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var systemdServicesWidgetTemplate = mustParseTemplate("systemd-services.html", "widget-base.html")
+
+const (
+	systemdBusName        = "org.freedesktop.systemd1"
+	systemdManagerPath    = "/org/freedesktop/systemd1"
+	systemdManagerIface   = "org.freedesktop.systemd1.Manager"
+	systemdUnitIface      = "org.freedesktop.systemd1.Unit"
+	systemdServiceIface   = "org.freedesktop.systemd1.Service"
+	systemdUnitPathPrefix = "/org/freedesktop/systemd1/unit/"
+)
+
+type systemdServicesWidget struct {
+	widgetBase `yaml:",inline"`
+	Units      []systemdUnitConfig `yaml:"units"`
+	SockPath   string              `yaml:"sock-path"`
+	Restarters []string            `yaml:"restarters"`
+	Statuses   []systemdUnitStatus `yaml:"-"`
+}
+
+type systemdUnitConfig struct {
+	Name         string `yaml:"name"`
+	Title        string `yaml:"title"`
+	URL          string `yaml:"url"`
+	AllowRestart bool   `yaml:"allow-restart"`
+}
+
+func (u *systemdUnitConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&u.Name)
+	}
+
+	type alias systemdUnitConfig
+	return node.Decode((*alias)(u))
+}
+
+type systemdUnitStatus struct {
+	Index        int
+	Name         string
+	Title        string
+	URL          string
+	Description  string
+	LoadState    string
+	ActiveState  string
+	SubState     string
+	Since        time.Time
+	Restarts     int
+	HasRestarts  bool
+	AllowRestart bool
+	Error        error
+}
+
+func (widget *systemdServicesWidget) initialize() error {
+	widget.withTitle("系统服务").withCacheDuration(30 * time.Second)
+
+	if len(widget.Units) == 0 {
+		return errors.New("at least one unit is required")
+	}
+
+	if widget.SockPath == "" {
+		widget.SockPath = "/run/dbus/system_bus_socket"
+	}
+
+	for i := range widget.Units {
+		unit := &widget.Units[i]
+
+		if unit.Name == "" {
+			return fmt.Errorf("unit #%d has no name", i+1)
+		}
+
+		if !strings.Contains(unit.Name, ".") {
+			unit.Name += ".service"
+		}
+	}
+
+	return nil
+}
+
+func (widget *systemdServicesWidget) update(ctx context.Context) {
+	statuses, err := widget.fetchStatuses(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Statuses = statuses
+}
+
+func (widget *systemdServicesWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, systemdServicesWidgetTemplate)
+}
+
+func (widget *systemdServicesWidget) RestartURL() string {
+	if widget.Providers == nil {
+		return ""
+	}
+
+	return widget.Providers.baseURL + "/api/widgets/" + strconv.FormatUint(widget.ID, 10) + "/restart"
+}
+
+// Restarting is only ever allowed for logged in users
+func (widget *systemdServicesWidget) MaybeRestartable() bool {
+	return widget.Providers != nil && widget.Providers.usernameFromRequest != nil
+}
+
+func (widget *systemdServicesWidget) fetchStatuses(ctx context.Context) ([]systemdUnitStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	conn, err := dialDBus(ctx, widget.SockPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: connecting to D-Bus: %v", errNoContent, err)
+	}
+	defer conn.Close()
+
+	statuses := make([]systemdUnitStatus, len(widget.Units))
+	var failed int
+	var lastErr error
+
+	for i := range widget.Units {
+		statuses[i] = fetchSystemdUnitStatus(conn, &widget.Units[i])
+		statuses[i].Index = i
+
+		if statuses[i].Error != nil {
+			failed++
+			lastErr = statuses[i].Error
+			slog.Warn("Getting systemd unit status", "unit", widget.Units[i].Name, "error", statuses[i].Error)
+		}
+	}
+
+	if failed == len(statuses) {
+		return nil, fmt.Errorf("%w: %v", errNoContent, lastErr)
+	} else if failed > 0 {
+		return statuses, fmt.Errorf("%w: %v", errPartialContent, lastErr)
+	}
+
+	return statuses, nil
+}
+
+func fetchSystemdUnitStatus(conn *dbusConn, unit *systemdUnitConfig) systemdUnitStatus {
+	status := systemdUnitStatus{
+		Name:         unit.Name,
+		Title:        unit.Title,
+		URL:          unit.URL,
+		AllowRestart: unit.AllowRestart,
+	}
+
+	path := systemdUnitPathPrefix + dbusEscapePathElement(unit.Name)
+
+	getString := func(property string) string {
+		if status.Error != nil {
+			return ""
+		}
+
+		value, err := conn.getProperty(systemdBusName, path, systemdUnitIface, property)
+		if err != nil {
+			status.Error = err
+			return ""
+		}
+
+		s, _ := value.(string)
+		return s
+	}
+
+	status.Description = getString("Description")
+	status.LoadState = getString("LoadState")
+	status.ActiveState = getString("ActiveState")
+	status.SubState = getString("SubState")
+
+	if status.Error != nil {
+		return status
+	}
+
+	if status.Title == "" {
+		status.Title = strings.TrimSuffix(unit.Name, ".service")
+	}
+
+	if status.LoadState == "not-found" {
+		return status
+	}
+
+	// for active units show how long they've been up, otherwise since when
+	// they've been in their current state
+	timestampProperty := ternary(status.ActiveState == "active", "ActiveEnterTimestamp", "StateChangeTimestamp")
+	if value, err := conn.getProperty(systemdBusName, path, systemdUnitIface, timestampProperty); err == nil {
+		if usec, ok := value.(uint64); ok && usec > 0 {
+			status.Since = time.UnixMicro(int64(usec))
+		}
+	}
+
+	if strings.HasSuffix(unit.Name, ".service") {
+		if value, err := conn.getProperty(systemdBusName, path, systemdServiceIface, "NRestarts"); err == nil {
+			if restarts, ok := value.(uint32); ok {
+				status.Restarts = int(restarts)
+				status.HasRestarts = true
+			}
+		}
+	}
+
+	return status
+}
+
+func (s *systemdUnitStatus) StateStyle() string {
+	switch {
+	case s.LoadState == "not-found":
+		return "warn"
+	case s.ActiveState == "active":
+		return "ok"
+	case s.ActiveState == "failed":
+		return "warn"
+	case s.ActiveState == "activating" || s.ActiveState == "deactivating" || s.ActiveState == "reloading":
+		return "paused"
+	}
+
+	return "other"
+}
+
+func (s *systemdUnitStatus) StateText() string {
+	if s.LoadState == "not-found" {
+		return "not found"
+	}
+
+	if s.SubState == "" || s.SubState == s.ActiveState {
+		return s.ActiveState
+	}
+
+	return s.ActiveState + " (" + s.SubState + ")"
+}
+
+func (widget *systemdServicesWidget) canRestart(r *http.Request) bool {
+	if widget.Providers.usernameFromRequest == nil {
+		return false
+	}
+
+	username, ok := widget.Providers.usernameFromRequest(r)
+	if !ok {
+		return false
+	}
+
+	return len(widget.Restarters) == 0 || slices.Contains(widget.Restarters, username)
+}
+
+func (widget *systemdServicesWidget) handleRequest(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("path") != "restart" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		Unit int `json:"unit"`
+	}
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if request.Unit < 0 || request.Unit >= len(widget.Units) {
+		http.Error(w, "unknown unit", http.StatusBadRequest)
+		return
+	}
+
+	unit := &widget.Units[request.Unit]
+
+	if !unit.AllowRestart || !widget.canRestart(r) {
+		http.Error(w, "not allowed to restart this unit", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	conn, err := dialDBus(ctx, widget.SockPath)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("connecting to D-Bus: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.call(systemdBusName, systemdManagerPath, systemdManagerIface, "RestartUnit", unit.Name, "replace"); err != nil {
+		http.Error(w, fmt.Sprintf("restarting %s: %v", unit.Name, err), http.StatusBadGateway)
+		return
+	}
+
+	username, _ := widget.Providers.usernameFromRequest(r)
+	slog.Info("Restarted systemd unit", "unit", unit.Name, "user", username)
+
+	w.WriteHeader(http.StatusNoContent)
+}
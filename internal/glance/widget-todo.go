@@ -1,24 +1,1015 @@
 package glance
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
 	"html/template"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 var todoWidgetTemplate = mustParseTemplate("todo.html", "widget-base.html")
 
 type todoWidget struct {
 	widgetBase `yaml:",inline"`
-	cachedHTML template.HTML `yaml:"-"`
-	TodoID     string        `yaml:"id"`
+	cachedHTML template.HTML   `yaml:"-"`
+	TodoID     string          `yaml:"id"`
+	Sync       *todoSyncConfig `yaml:"sync"`
+	backend    todoBackend     `yaml:"-"`
+}
+
+type todoSyncConfig struct {
+	Type          string `yaml:"type"`
+	Token         string `yaml:"token"`
+	Project       string `yaml:"project"`
+	URL           string `yaml:"url"`
+	Username      string `yaml:"username"`
+	Password      string `yaml:"password"`
+	AllowInsecure bool   `yaml:"allow-insecure"`
 }
 
 func (widget *todoWidget) initialize() error {
 	widget.withTitle("待办项").withError(nil)
 
+	if widget.Sync != nil {
+		backend, err := newTodoBackend(widget)
+		if err != nil {
+			return fmt.Errorf("sync: %v", err)
+		}
+
+		widget.backend = backend
+	}
+
 	widget.cachedHTML = widget.renderTemplate(widget, todoWidgetTemplate)
 	return nil
 }
 
 func (widget *todoWidget) Render() template.HTML {
+	// the sync URL depends on the base URL, which isn't known yet during initialization
+	if widget.backend != nil {
+		return widget.renderTemplate(widget, todoWidgetTemplate)
+	}
+
 	return widget.cachedHTML
 }
+
+func (widget *todoWidget) SyncURL() string {
+	if widget.backend == nil || widget.Providers == nil {
+		return ""
+	}
+
+	return widget.Providers.baseURL + "/api/widgets/" + strconv.FormatUint(widget.ID, 10) + "/items"
+}
+
+func (widget *todoWidget) handleRequest(w http.ResponseWriter, r *http.Request) {
+	if widget.backend == nil {
+		http.Error(w, "to-do widget is not synced", http.StatusNotFound)
+		return
+	}
+
+	path := r.PathValue("path")
+	itemID, hasItemID := strings.CutPrefix(path, "items/")
+
+	if path != "items" && (!hasItemID || itemID == "") {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	var result any
+	var err error
+
+	switch {
+	case path == "items" && r.Method == http.MethodGet:
+		result, err = widget.backend.list(ctx)
+	case path == "items" && r.Method == http.MethodPost:
+		var item todoItem
+		if item, err = decodeTodoItem(w, r); err == nil {
+			result, err = widget.backend.create(ctx, item)
+		}
+	case hasItemID && r.Method == http.MethodPut:
+		var item todoItem
+		if item, err = decodeTodoItem(w, r); err == nil {
+			item.ID = itemID
+			result, err = widget.backend.update(ctx, item)
+		}
+	case hasItemID && r.Method == http.MethodDelete:
+		err = widget.backend.delete(ctx, itemID)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		var badRequest *todoBadRequestError
+		status := ternary(errors.As(err, &badRequest), http.StatusBadRequest, http.StatusBadGateway)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if result == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Priorities are normalized to 1 (high) through 3 (low), with 0 meaning no priority
+type todoItem struct {
+	ID       string `json:"id"`
+	Text     string `json:"text"`
+	Checked  bool   `json:"checked"`
+	Due      string `json:"due,omitempty"`
+	Priority int    `json:"priority,omitempty"`
+}
+
+type todoBadRequestError struct {
+	err error
+}
+
+func (e *todoBadRequestError) Error() string {
+	return e.err.Error()
+}
+
+func decodeTodoItem(w http.ResponseWriter, r *http.Request) (todoItem, error) {
+	var item todoItem
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&item); err != nil {
+		return item, &todoBadRequestError{err}
+	}
+
+	item.Text = strings.TrimSpace(item.Text)
+	if item.Text == "" {
+		return item, &todoBadRequestError{errors.New("text is required")}
+	}
+
+	if item.Priority < 0 || item.Priority > 3 {
+		return item, &todoBadRequestError{errors.New("priority must be between 0 and 3")}
+	}
+
+	if item.Due != "" {
+		if _, err := time.Parse(time.DateOnly, item.Due); err != nil {
+			return item, &todoBadRequestError{errors.New("due must be in the format YYYY-MM-DD")}
+		}
+	}
+
+	return item, nil
+}
+
+// Only tasks which haven't been completed get listed, completed tasks
+// disappear the next time the list is loaded
+type todoBackend interface {
+	list(ctx context.Context) ([]todoItem, error)
+	create(ctx context.Context, item todoItem) (todoItem, error)
+	update(ctx context.Context, item todoItem) (todoItem, error)
+	delete(ctx context.Context, id string) error
+}
+
+func newTodoBackend(widget *todoWidget) (todoBackend, error) {
+	config := widget.Sync
+	client := widget.httpClient(ternary(config.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient))
+
+	switch config.Type {
+	case "server":
+		if widget.TodoID == "" {
+			return nil, errors.New("id is required for server, it's used to store the tasks")
+		}
+
+		return &storedTodoBackend{
+			key: "todo:" + widget.TodoID,
+			store: func() *stateStore {
+				if widget.Providers == nil {
+					return nil
+				}
+				return widget.Providers.store
+			},
+		}, nil
+	case "todoist":
+		if config.Token == "" {
+			return nil, errors.New("token is required for todoist")
+		}
+
+		return &todoistBackend{client: widget.httpClient(defaultHTTPClient), token: config.Token, project: config.Project}, nil
+	case "caldav":
+		if config.URL == "" {
+			return nil, errors.New("url is required for caldav")
+		}
+
+		collectionURL, err := url.Parse(config.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url: %v", err)
+		}
+
+		if !strings.HasSuffix(collectionURL.Path, "/") {
+			collectionURL.Path += "/"
+		}
+
+		return &caldavTodoBackend{
+			collectionURL: collectionURL,
+			username:      config.Username,
+			password:      config.Password,
+			client:        client,
+			tasks:         make(map[string]*caldavTask),
+		}, nil
+	case "":
+		return nil, errors.New("type is required")
+	default:
+		return nil, fmt.Errorf("unsupported type %s, must be one of server, todoist or caldav", config.Type)
+	}
+}
+
+func readTodoSyncResponse(response *http.Response, expected ...int) ([]byte, error) {
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(expected, response.StatusCode) {
+		truncatedBody, _ := limitStringLength(string(body), 256)
+		return nil, fmt.Errorf(
+			"unexpected status code %d from %s, response: %s",
+			response.StatusCode,
+			response.Request.URL,
+			truncatedBody,
+		)
+	}
+
+	return body, nil
+}
+
+// Keeps the tasks in Glance's state store, which persists them to the data path
+type storedTodoBackend struct {
+	key   string
+	store func() *stateStore
+	mu    sync.Mutex
+}
+
+func (b *storedTodoBackend) load() (*stateStore, []todoItem, error) {
+	store := b.store()
+	if store == nil {
+		return nil, nil, errors.New("state store is not available")
+	}
+
+	items := make([]todoItem, 0)
+	if _, err := store.get(b.key, &items); err != nil {
+		return nil, nil, err
+	}
+
+	return store, items, nil
+}
+
+func (b *storedTodoBackend) list(ctx context.Context) ([]todoItem, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	store, items, err := b.load()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := slices.DeleteFunc(slices.Clone(items), func(item todoItem) bool {
+		return item.Checked
+	})
+
+	if len(pending) != len(items) {
+		if err := store.set(b.key, pending); err != nil {
+			return nil, err
+		}
+	}
+
+	return pending, nil
+}
+
+func (b *storedTodoBackend) create(ctx context.Context, item todoItem) (todoItem, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	store, items, err := b.load()
+	if err != nil {
+		return todoItem{}, err
+	}
+
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return todoItem{}, err
+	}
+
+	item.ID = hex.EncodeToString(idBytes)
+
+	if err := store.set(b.key, append(items, item)); err != nil {
+		return todoItem{}, err
+	}
+
+	return item, nil
+}
+
+func (b *storedTodoBackend) update(ctx context.Context, item todoItem) (todoItem, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	store, items, err := b.load()
+	if err != nil {
+		return todoItem{}, err
+	}
+
+	index := slices.IndexFunc(items, func(existing todoItem) bool {
+		return existing.ID == item.ID
+	})
+
+	if index == -1 {
+		return todoItem{}, &todoBadRequestError{fmt.Errorf("task %s not found", item.ID)}
+	}
+
+	items[index] = item
+
+	if err := store.set(b.key, items); err != nil {
+		return todoItem{}, err
+	}
+
+	return item, nil
+}
+
+func (b *storedTodoBackend) delete(ctx context.Context, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	store, items, err := b.load()
+	if err != nil {
+		return err
+	}
+
+	remaining := slices.DeleteFunc(items, func(item todoItem) bool {
+		return item.ID == id
+	})
+
+	if len(remaining) == len(items) {
+		return nil
+	}
+
+	return store.set(b.key, remaining)
+}
+
+const todoistAPIBaseURL = "https://api.todoist.com/api/v1"
+
+type todoistBackend struct {
+	client  requestDoer
+	token   string
+	project string
+}
+
+type todoistTask struct {
+	ID         string `json:"id"`
+	Content    string `json:"content"`
+	Checked    bool   `json:"checked"`
+	Priority   int    `json:"priority"`
+	ChildOrder int    `json:"child_order"`
+	Due        *struct {
+		Date string `json:"date"`
+	} `json:"due"`
+}
+
+func (t *todoistTask) toItem() todoItem {
+	item := todoItem{
+		ID:      t.ID,
+		Text:    t.Content,
+		Checked: t.Checked,
+		// todoist uses 4 for the highest priority and 1 for no priority
+		Priority: ternary(t.Priority > 1, 5-t.Priority, 0),
+	}
+
+	if t.Due != nil && len(t.Due.Date) >= 10 {
+		item.Due = t.Due.Date[:10]
+	}
+
+	return item
+}
+
+func (b *todoistBackend) do(ctx context.Context, method, path string, body any, result any) error {
+	var requestBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, todoistAPIBaseURL+path, requestBody)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Authorization", "Bearer "+b.token)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := b.client.Do(request)
+	if err != nil {
+		return err
+	}
+
+	responseBody, err := readTodoSyncResponse(response, http.StatusOK, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(responseBody, result)
+}
+
+func (b *todoistBackend) list(ctx context.Context) ([]todoItem, error) {
+	tasks := make([]todoistTask, 0)
+	cursor := ""
+
+	// a hard limit on the number of pages just in case the cursor never ends up being empty
+	for range 10 {
+		query := url.Values{}
+		query.Set("limit", "200")
+		if b.project != "" {
+			query.Set("project_id", b.project)
+		}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+
+		var page struct {
+			Results    []todoistTask `json:"results"`
+			NextCursor *string       `json:"next_cursor"`
+		}
+
+		if err := b.do(ctx, http.MethodGet, "/tasks?"+query.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+
+		tasks = append(tasks, page.Results...)
+
+		if page.NextCursor == nil || *page.NextCursor == "" {
+			break
+		}
+		cursor = *page.NextCursor
+	}
+
+	slices.SortStableFunc(tasks, func(a, b todoistTask) int {
+		return a.ChildOrder - b.ChildOrder
+	})
+
+	items := make([]todoItem, 0, len(tasks))
+	for i := range tasks {
+		if !tasks[i].Checked {
+			items = append(items, tasks[i].toItem())
+		}
+	}
+
+	return items, nil
+}
+
+func (b *todoistBackend) taskBody(item todoItem) map[string]any {
+	body := map[string]any{
+		"content":  item.Text,
+		"priority": ternary(item.Priority > 0, 5-item.Priority, 1),
+	}
+
+	if item.Due != "" {
+		body["due_date"] = item.Due
+	} else {
+		body["due_string"] = "no date"
+	}
+
+	return body
+}
+
+func (b *todoistBackend) create(ctx context.Context, item todoItem) (todoItem, error) {
+	body := b.taskBody(item)
+	if item.Due == "" {
+		delete(body, "due_string")
+	}
+
+	if b.project != "" {
+		body["project_id"] = b.project
+	}
+
+	var task todoistTask
+	if err := b.do(ctx, http.MethodPost, "/tasks", body, &task); err != nil {
+		return todoItem{}, err
+	}
+
+	if item.Checked {
+		if err := b.do(ctx, http.MethodPost, "/tasks/"+url.PathEscape(task.ID)+"/close", nil, nil); err != nil {
+			return todoItem{}, err
+		}
+		task.Checked = true
+	}
+
+	return task.toItem(), nil
+}
+
+func (b *todoistBackend) update(ctx context.Context, item todoItem) (todoItem, error) {
+	path := "/tasks/" + url.PathEscape(item.ID)
+
+	var task todoistTask
+	if err := b.do(ctx, http.MethodPost, path, b.taskBody(item), &task); err != nil {
+		return todoItem{}, err
+	}
+
+	if item.Checked != task.Checked {
+		if err := b.do(ctx, http.MethodPost, path+ternary(item.Checked, "/close", "/reopen"), nil, nil); err != nil {
+			return todoItem{}, err
+		}
+		task.Checked = item.Checked
+	}
+
+	return task.toItem(), nil
+}
+
+func (b *todoistBackend) delete(ctx context.Context, id string) error {
+	return b.do(ctx, http.MethodDelete, "/tasks/"+url.PathEscape(id), nil, nil)
+}
+
+const caldavTodoQuery = `<?xml version="1.0" encoding="utf-8" ?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <D:getetag/>
+    <C:calendar-data/>
+  </D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VTODO"/>
+    </C:comp-filter>
+  </C:filter>
+</C:calendar-query>`
+
+type caldavTodoBackend struct {
+	collectionURL *url.URL
+	username      string
+	password      string
+	client        requestDoer
+
+	// The original calendar data is kept so that properties the widget doesn't
+	// know about, such as descriptions or reminders, don't get lost on updates
+	mu    sync.Mutex
+	tasks map[string]*caldavTask
+}
+
+type caldavTask struct {
+	href string
+	etag string
+	data string
+}
+
+type caldavMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				ETag         string `xml:"getetag"`
+				CalendarData string `xml:"calendar-data"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+func (b *caldavTodoBackend) newRequest(ctx context.Context, method, target string, body string) (*http.Request, error) {
+	var requestBody io.Reader
+	if body != "" {
+		requestBody = strings.NewReader(body)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, target, requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.username != "" || b.password != "" {
+		request.SetBasicAuth(b.username, b.password)
+	}
+
+	return request, nil
+}
+
+func (b *caldavTodoBackend) list(ctx context.Context) ([]todoItem, error) {
+	request, err := b.newRequest(ctx, "REPORT", b.collectionURL.String(), caldavTodoQuery)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Depth", "1")
+	request.Header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	response, err := b.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := readTodoSyncResponse(response, http.StatusMultiStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	var multistatus caldavMultistatus
+	if err := xml.Unmarshal(body, &multistatus); err != nil {
+		return nil, fmt.Errorf("parsing caldav response: %v", err)
+	}
+
+	tasks := make(map[string]*caldavTask)
+	items := make([]todoItem, 0, len(multistatus.Responses))
+
+	for _, r := range multistatus.Responses {
+		for _, propstat := range r.Propstat {
+			if propstat.Prop.CalendarData == "" || !strings.Contains(propstat.Status, " 200 ") {
+				continue
+			}
+
+			properties := parseVTODOProperties(propstat.Prop.CalendarData)
+			uid := properties["UID"].value
+			if uid == "" {
+				continue
+			}
+
+			href, err := b.collectionURL.Parse(r.Href)
+			if err != nil {
+				continue
+			}
+
+			tasks[uid] = &caldavTask{
+				href: href.String(),
+				etag: propstat.Prop.ETag,
+				data: propstat.Prop.CalendarData,
+			}
+
+			status := strings.ToUpper(properties["STATUS"].value)
+			if status == "COMPLETED" || status == "CANCELLED" {
+				continue
+			}
+
+			items = append(items, vtodoPropertiesToItem(uid, properties))
+		}
+	}
+
+	// tasks without a priority go last, then the ones without a due date
+	slices.SortStableFunc(items, func(a, b todoItem) int {
+		if a.Priority != b.Priority {
+			return ternary(a.Priority == 0, 10, a.Priority) - ternary(b.Priority == 0, 10, b.Priority)
+		}
+
+		return strings.Compare(ternary(a.Due == "", "9999", a.Due), ternary(b.Due == "", "9999", b.Due))
+	})
+
+	b.mu.Lock()
+	b.tasks = tasks
+	b.mu.Unlock()
+
+	return items, nil
+}
+
+func (b *caldavTodoBackend) task(ctx context.Context, id string) (*caldavTask, error) {
+	b.mu.Lock()
+	task, exists := b.tasks[id]
+	b.mu.Unlock()
+
+	if exists {
+		return task, nil
+	}
+
+	// could have been created elsewhere since the last time the list was loaded
+	if _, err := b.list(ctx); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	task, exists = b.tasks[id]
+	b.mu.Unlock()
+
+	if !exists {
+		return nil, &todoBadRequestError{fmt.Errorf("task %s not found", id)}
+	}
+
+	return task, nil
+}
+
+func (b *caldavTodoBackend) put(ctx context.Context, uid string, task *caldavTask, isNew bool) error {
+	request, err := b.newRequest(ctx, http.MethodPut, task.href, task.data)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/calendar; charset=utf-8")
+
+	if isNew {
+		request.Header.Set("If-None-Match", "*")
+	} else if task.etag != "" {
+		request.Header.Set("If-Match", task.etag)
+	}
+
+	response, err := b.client.Do(request)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode == http.StatusPreconditionFailed {
+		response.Body.Close()
+		b.mu.Lock()
+		delete(b.tasks, uid)
+		b.mu.Unlock()
+		return errors.New("the task was changed elsewhere, reload the page and try again")
+	}
+
+	if _, err := readTodoSyncResponse(response, http.StatusOK, http.StatusCreated, http.StatusNoContent); err != nil {
+		return err
+	}
+
+	// not every server returns the new etag, without it the next update won't be conditional
+	task.etag = response.Header.Get("ETag")
+
+	b.mu.Lock()
+	b.tasks[uid] = task
+	b.mu.Unlock()
+
+	return nil
+}
+
+func (b *caldavTodoBackend) create(ctx context.Context, item todoItem) (todoItem, error) {
+	uidBytes := make([]byte, 16)
+	if _, err := rand.Read(uidBytes); err != nil {
+		return todoItem{}, err
+	}
+
+	uid := hex.EncodeToString(uidBytes) + "@glance"
+	now := formatICalendarTime(time.Now())
+
+	data := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Glance//To-do//EN",
+		"BEGIN:VTODO",
+		"UID:" + uid,
+		"CREATED:" + now,
+		"END:VTODO",
+		"END:VCALENDAR",
+	}, "\r\n") + "\r\n"
+
+	href, err := b.collectionURL.Parse(url.PathEscape(uid) + ".ics")
+	if err != nil {
+		return todoItem{}, err
+	}
+
+	item.ID = uid
+	task := &caldavTask{href: href.String(), data: setVTODOProperties(data, itemToVTODOProperties(item))}
+
+	if err := b.put(ctx, uid, task, true); err != nil {
+		return todoItem{}, err
+	}
+
+	return item, nil
+}
+
+func (b *caldavTodoBackend) update(ctx context.Context, item todoItem) (todoItem, error) {
+	existing, err := b.task(ctx, item.ID)
+	if err != nil {
+		return todoItem{}, err
+	}
+
+	task := &caldavTask{
+		href: existing.href,
+		etag: existing.etag,
+		data: setVTODOProperties(existing.data, itemToVTODOProperties(item)),
+	}
+
+	if err := b.put(ctx, item.ID, task, false); err != nil {
+		return todoItem{}, err
+	}
+
+	return item, nil
+}
+
+func (b *caldavTodoBackend) delete(ctx context.Context, id string) error {
+	task, err := b.task(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	request, err := b.newRequest(ctx, http.MethodDelete, task.href, "")
+	if err != nil {
+		return err
+	}
+
+	if task.etag != "" {
+		request.Header.Set("If-Match", task.etag)
+	}
+
+	response, err := b.client.Do(request)
+	if err != nil {
+		return err
+	}
+
+	if _, err := readTodoSyncResponse(response, http.StatusOK, http.StatusNoContent, http.StatusNotFound); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	delete(b.tasks, id)
+	b.mu.Unlock()
+
+	return nil
+}
+
+type icalendarProperty struct {
+	params string
+	value  string
+}
+
+func unfoldICalendarLines(data string) []string {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	lines := make([]string, 0)
+
+	for _, line := range strings.Split(data, "\n") {
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+// Lines longer than 75 octets must be folded, making sure not to split multi-byte characters
+func foldICalendarLine(line string) string {
+	var folded strings.Builder
+	length := 0
+
+	for _, r := range line {
+		size := len(string(r))
+		if length+size > 75 {
+			folded.WriteString("\r\n ")
+			length = 1
+		}
+
+		folded.WriteRune(r)
+		length += size
+	}
+
+	return folded.String()
+}
+
+func splitICalendarLine(line string) (string, string, string) {
+	nameAndParams, value, _ := strings.Cut(line, ":")
+	name, params, _ := strings.Cut(nameAndParams, ";")
+
+	return strings.ToUpper(name), params, value
+}
+
+func parseVTODOProperties(data string) map[string]icalendarProperty {
+	properties := make(map[string]icalendarProperty)
+	inTodo := false
+	// nested components such as VALARM have properties of their own
+	depth := 0
+
+	for _, line := range unfoldICalendarLines(data) {
+		name, params, value := splitICalendarLine(line)
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VTODO"):
+			inTodo = true
+		case !inTodo:
+			continue
+		case name == "BEGIN":
+			depth++
+		case name == "END" && depth > 0:
+			depth--
+		case name == "END" && strings.EqualFold(value, "VTODO"):
+			return properties
+		case depth == 0:
+			if _, exists := properties[name]; !exists {
+				properties[name] = icalendarProperty{params: params, value: value}
+			}
+		}
+	}
+
+	return properties
+}
+
+// A property with an empty value gets removed
+func setVTODOProperties(data string, properties map[string]string) string {
+	lines := unfoldICalendarLines(data)
+	result := make([]string, 0, len(lines)+len(properties))
+	inTodo := false
+	depth := 0
+
+	for _, line := range lines {
+		name, _, value := splitICalendarLine(line)
+
+		if name == "BEGIN" && strings.EqualFold(value, "VTODO") {
+			inTodo = true
+		} else if inTodo && name == "BEGIN" {
+			depth++
+		} else if inTodo && name == "END" && depth > 0 {
+			depth--
+		} else if inTodo && name == "END" && strings.EqualFold(value, "VTODO") {
+			for _, property := range slices.Sorted(maps.Keys(properties)) {
+				if properties[property] != "" {
+					result = append(result, properties[property])
+				}
+			}
+			inTodo = false
+		} else if inTodo && depth == 0 {
+			if _, replaced := properties[name]; replaced {
+				continue
+			}
+		}
+
+		result = append(result, line)
+	}
+
+	for i := range result {
+		result[i] = foldICalendarLine(result[i])
+	}
+
+	return strings.Join(result, "\r\n") + "\r\n"
+}
+
+func vtodoPropertiesToItem(uid string, properties map[string]icalendarProperty) todoItem {
+	item := todoItem{
+		ID:   uid,
+		Text: unescapeICalendarText(properties["SUMMARY"].value),
+	}
+
+	if due := properties["DUE"].value; len(due) >= 8 {
+		if t, err := time.Parse("20060102", due[:8]); err == nil {
+			item.Due = t.Format(time.DateOnly)
+		}
+	}
+
+	// 1 is the highest priority and 9 the lowest
+	if priority, err := strconv.Atoi(properties["PRIORITY"].value); err == nil && priority > 0 {
+		item.Priority = ternary(priority < 5, 1, ternary(priority == 5, 2, 3))
+	}
+
+	return item
+}
+
+func itemToVTODOProperties(item todoItem) map[string]string {
+	now := formatICalendarTime(time.Now())
+
+	properties := map[string]string{
+		"SUMMARY":          "SUMMARY:" + escapeICalendarText(item.Text),
+		"STATUS":           "STATUS:" + ternary(item.Checked, "COMPLETED", "NEEDS-ACTION"),
+		"COMPLETED":        ternary(item.Checked, "COMPLETED:"+now, ""),
+		"PERCENT-COMPLETE": ternary(item.Checked, "PERCENT-COMPLETE:100", ""),
+		"DTSTAMP":          "DTSTAMP:" + now,
+		"LAST-MODIFIED":    "LAST-MODIFIED:" + now,
+		"DUE":              "",
+		"PRIORITY":         "",
+	}
+
+	if item.Due != "" {
+		properties["DUE"] = "DUE;VALUE=DATE:" + strings.ReplaceAll(item.Due, "-", "")
+	}
+
+	if item.Priority > 0 {
+		properties["PRIORITY"] = "PRIORITY:" + []string{"", "1", "5", "9"}[item.Priority]
+	}
+
+	return properties
+}
+
+func formatICalendarTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+var (
+	icalendarTextEscaper   = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+	icalendarTextUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+)
+
+func escapeICalendarText(text string) string {
+	return icalendarTextEscaper.Replace(text)
+}
+
+func unescapeICalendarText(text string) string {
+	return icalendarTextUnescaper.Replace(text)
+}
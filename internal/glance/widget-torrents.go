@@ -0,0 +1,522 @@
+package glance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	torrentsWidgetTemplate       = mustParseTemplate("torrents.html", "widget-base.html")
+	torrentsWidgetSpeedsTemplate = mustParseTemplate("torrents-speeds.html", "widget-base.html")
+)
+
+const (
+	torrentClientQBittorrent  = "qbittorrent"
+	torrentClientTransmission = "transmission"
+)
+
+type torrentsWidget struct {
+	widgetBase    `yaml:",inline"`
+	Client        string           `yaml:"client"`
+	URL           string           `yaml:"url"`
+	Username      string           `yaml:"username"`
+	Password      string           `yaml:"password"`
+	AllowInsecure bool             `yaml:"allow-insecure"`
+	Filter        string           `yaml:"filter"`
+	Style         string           `yaml:"style"`
+	Limit         int              `yaml:"limit"`
+	CollapseAfter int              `yaml:"collapse-after"`
+	Status        *torrentsStatus  `yaml:"-"`
+	client        requestDoer      `yaml:"-"`
+	session       *torrentsSession `yaml:"-"`
+}
+
+// Both clients hand out a session which has to be sent along with every
+// request and which can expire at any time, in which case a new one is requested
+type torrentsSession struct {
+	mu sync.Mutex
+	id string
+}
+
+type torrentsStatus struct {
+	DownloadSpeed int64
+	UploadSpeed   int64
+	Downloading   int
+	Seeding       int
+	Torrents      []torrent
+}
+
+type torrent struct {
+	Name          string
+	State         string
+	Progress      int
+	Size          int64
+	DownloadSpeed int64
+	UploadSpeed   int64
+	// Negative when the client can't estimate it
+	ETA     time.Duration
+	AddedAt time.Time
+	Error   string
+}
+
+func (widget *torrentsWidget) initialize() error {
+	widget.withTitle("Torrents").withCacheDuration(30 * time.Second)
+
+	switch widget.Client {
+	case torrentClientQBittorrent, torrentClientTransmission:
+	case "":
+		return errors.New("client is required")
+	default:
+		return fmt.Errorf("client must be one of %s or %s", torrentClientQBittorrent, torrentClientTransmission)
+	}
+
+	if widget.URL == "" {
+		return errors.New("url is required")
+	}
+
+	widget.URL = strings.TrimRight(widget.URL, "/")
+	widget.withTitleURL(widget.URL)
+
+	// the RPC endpoint rather than the web interface is what people usually copy
+	if widget.Client == torrentClientTransmission && !strings.HasSuffix(widget.URL, "/rpc") {
+		widget.URL += "/transmission/rpc"
+	}
+
+	switch widget.Filter {
+	case "":
+		widget.Filter = "active"
+	case "active", "downloading", "all":
+	default:
+		return errors.New("filter must be one of active, downloading or all")
+	}
+
+	if widget.Style != "" && widget.Style != "speeds" {
+		return errors.New("style must be speeds or left empty")
+	}
+
+	if widget.Limit <= 0 {
+		widget.Limit = 10
+	}
+
+	if widget.CollapseAfter == 0 || widget.CollapseAfter < -1 {
+		widget.CollapseAfter = 5
+	}
+
+	widget.client = widget.httpClient(ternary(widget.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient))
+	widget.session = &torrentsSession{}
+
+	return nil
+}
+
+func (widget *torrentsWidget) update(ctx context.Context) {
+	var status *torrentsStatus
+	var err error
+
+	switch widget.Client {
+	case torrentClientQBittorrent:
+		status, err = widget.fetchQBittorrentStatus(ctx)
+	case torrentClientTransmission:
+		status, err = widget.fetchTransmissionStatus(ctx)
+	}
+
+	if err != nil {
+		err = fmt.Errorf("%w: %v", errNoContent, err)
+	}
+
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	for i := range status.Torrents {
+		switch status.Torrents[i].State {
+		case "downloading":
+			status.Downloading++
+		case "seeding":
+			status.Seeding++
+		}
+	}
+
+	status.Torrents = slices.DeleteFunc(status.Torrents, func(t torrent) bool {
+		return !t.matchesFilter(widget.Filter)
+	})
+
+	slices.SortStableFunc(status.Torrents, func(a, b torrent) int {
+		return b.AddedAt.Compare(a.AddedAt)
+	})
+
+	if len(status.Torrents) > widget.Limit {
+		status.Torrents = status.Torrents[:widget.Limit]
+	}
+
+	widget.Status = status
+}
+
+func (widget *torrentsWidget) Render() template.HTML {
+	if widget.Style == "speeds" {
+		return widget.renderTemplate(widget, torrentsWidgetSpeedsTemplate)
+	}
+
+	return widget.renderTemplate(widget, torrentsWidgetTemplate)
+}
+
+func (t *torrent) matchesFilter(filter string) bool {
+	switch filter {
+	case "downloading":
+		return t.Progress < 100
+	case "active":
+		return t.State == "downloading" || t.DownloadSpeed > 0 || t.UploadSpeed > 0
+	}
+
+	return true
+}
+
+func (t *torrent) ETAText() string {
+	if t.Progress >= 100 {
+		return ""
+	}
+
+	if t.ETA < 0 {
+		return "∞"
+	}
+
+	if t.ETA < time.Minute {
+		return strconv.Itoa(int(t.ETA.Seconds())) + "s"
+	}
+
+	if t.ETA < time.Hour {
+		return strconv.Itoa(int(t.ETA.Minutes())) + "m"
+	}
+
+	if t.ETA < 24*time.Hour {
+		return fmt.Sprintf("%dh %dm", int(t.ETA.Hours()), int(t.ETA.Minutes())%60)
+	}
+
+	return fmt.Sprintf("%dd %dh", int(t.ETA.Hours())/24, int(t.ETA.Hours())%24)
+}
+
+func (widget *torrentsWidget) SpeedText(speed int64) string {
+	return formatBytesApprox(speed) + "/s"
+}
+
+func (widget *torrentsWidget) SizeText(size int64) string {
+	return formatBytesApprox(size)
+}
+
+type qbittorrentTransferInfoJson struct {
+	DownloadSpeed int64 `json:"dl_info_speed"`
+	UploadSpeed   int64 `json:"up_info_speed"`
+}
+
+type qbittorrentTorrentJson struct {
+	Name          string  `json:"name"`
+	State         string  `json:"state"`
+	Progress      float64 `json:"progress"`
+	Size          int64   `json:"size"`
+	DownloadSpeed int64   `json:"dlspeed"`
+	UploadSpeed   int64   `json:"upspeed"`
+	ETA           int64   `json:"eta"`
+	AddedOn       int64   `json:"added_on"`
+}
+
+// qBittorrent reports an ETA of 100 days when it can't estimate it
+const qbittorrentInfiniteETA = 8640000
+
+func (widget *torrentsWidget) qbittorrentLogin(ctx context.Context) error {
+	form := url.Values{}
+	form.Set("username", widget.Username)
+	form.Set("password", widget.Password)
+
+	request, err := http.NewRequestWithContext(ctx, "POST", widget.URL+"/api/v2/auth/login", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// requests without a matching referer are rejected when CSRF protection is enabled
+	request.Header.Set("Referer", widget.URL)
+
+	response, err := widget.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+
+	if response.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != "Ok." {
+		return fmt.Errorf("login failed with status %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == "SID" {
+			widget.session.id = cookie.Value
+			return nil
+		}
+	}
+
+	// no cookie is returned when authentication is bypassed for the client's address
+	widget.session.id = ""
+	return nil
+}
+
+func qbittorrentGet[T any](ctx context.Context, widget *torrentsWidget, path string) (T, error) {
+	var result T
+
+	for attempt := range 2 {
+		request, err := http.NewRequestWithContext(ctx, "GET", widget.URL+path, nil)
+		if err != nil {
+			return result, err
+		}
+
+		request.Header.Set("Referer", widget.URL)
+		if widget.session.id != "" {
+			request.AddCookie(&http.Cookie{Name: "SID", Value: widget.session.id})
+		}
+
+		response, err := widget.client.Do(request)
+		if err != nil {
+			return result, err
+		}
+
+		body, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return result, err
+		}
+
+		if response.StatusCode == http.StatusForbidden && attempt == 0 {
+			if err := widget.qbittorrentLogin(ctx); err != nil {
+				return result, err
+			}
+			continue
+		}
+
+		if response.StatusCode != http.StatusOK {
+			return result, fmt.Errorf("unexpected status code %d from %s", response.StatusCode, path)
+		}
+
+		return result, json.Unmarshal(body, &result)
+	}
+
+	return result, errors.New("could not authenticate")
+}
+
+func (widget *torrentsWidget) fetchQBittorrentStatus(ctx context.Context) (*torrentsStatus, error) {
+	widget.session.mu.Lock()
+	defer widget.session.mu.Unlock()
+
+	info, err := qbittorrentGet[qbittorrentTransferInfoJson](ctx, widget, "/api/v2/transfer/info")
+	if err != nil {
+		return nil, err
+	}
+
+	torrents, err := qbittorrentGet[[]qbittorrentTorrentJson](ctx, widget, "/api/v2/torrents/info")
+	if err != nil {
+		return nil, err
+	}
+
+	status := &torrentsStatus{
+		DownloadSpeed: info.DownloadSpeed,
+		UploadSpeed:   info.UploadSpeed,
+		Torrents:      make([]torrent, 0, len(torrents)),
+	}
+
+	for i := range torrents {
+		t := &torrents[i]
+
+		status.Torrents = append(status.Torrents, torrent{
+			Name:          t.Name,
+			State:         qbittorrentState(t.State),
+			Progress:      int(t.Progress * 100),
+			Size:          t.Size,
+			DownloadSpeed: t.DownloadSpeed,
+			UploadSpeed:   t.UploadSpeed,
+			ETA:           ternary(t.ETA >= qbittorrentInfiniteETA, -1, time.Duration(t.ETA)*time.Second),
+			AddedAt:       time.Unix(t.AddedOn, 0),
+			Error:         ternary(t.State == "error" || t.State == "missingFiles", t.State, ""),
+		})
+	}
+
+	return status, nil
+}
+
+func qbittorrentState(state string) string {
+	switch state {
+	case "downloading", "forcedDL", "metaDL", "forcedMetaDL", "stalledDL":
+		return "downloading"
+	case "uploading", "forcedUP", "stalledUP":
+		return "seeding"
+	case "pausedDL", "pausedUP", "stoppedDL", "stoppedUP":
+		return "paused"
+	case "queuedDL", "queuedUP":
+		return "queued"
+	case "checkingDL", "checkingUP", "checkingResumeData", "allocating", "moving":
+		return "checking"
+	case "error", "missingFiles":
+		return "error"
+	}
+
+	return state
+}
+
+type transmissionResponseJson[T any] struct {
+	Result    string `json:"result"`
+	Arguments T      `json:"arguments"`
+}
+
+type transmissionTorrentJson struct {
+	Name          string  `json:"name"`
+	Status        int     `json:"status"`
+	PercentDone   float64 `json:"percentDone"`
+	TotalSize     int64   `json:"totalSize"`
+	RateDownload  int64   `json:"rateDownload"`
+	RateUpload    int64   `json:"rateUpload"`
+	ETA           int64   `json:"eta"`
+	AddedDate     int64   `json:"addedDate"`
+	ErrorString   string  `json:"errorString"`
+	ErrorCategory int     `json:"error"`
+}
+
+type transmissionSessionStatsJson struct {
+	DownloadSpeed int64 `json:"downloadSpeed"`
+	UploadSpeed   int64 `json:"uploadSpeed"`
+}
+
+const transmissionSessionHeader = "X-Transmission-Session-Id"
+
+func transmissionCall[T any](ctx context.Context, widget *torrentsWidget, method string, arguments any) (T, error) {
+	var result transmissionResponseJson[T]
+
+	body, err := json.Marshal(map[string]any{"method": method, "arguments": arguments})
+	if err != nil {
+		return result.Arguments, err
+	}
+
+	for attempt := range 2 {
+		request, err := http.NewRequestWithContext(ctx, "POST", widget.URL, bytes.NewReader(body))
+		if err != nil {
+			return result.Arguments, err
+		}
+
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set(transmissionSessionHeader, widget.session.id)
+		if widget.Username != "" || widget.Password != "" {
+			request.SetBasicAuth(widget.Username, widget.Password)
+		}
+
+		response, err := widget.client.Do(request)
+		if err != nil {
+			return result.Arguments, err
+		}
+
+		responseBody, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return result.Arguments, err
+		}
+
+		// the session ID which should be used is sent along with the 409
+		if response.StatusCode == http.StatusConflict && attempt == 0 {
+			widget.session.id = response.Header.Get(transmissionSessionHeader)
+			continue
+		}
+
+		if response.StatusCode != http.StatusOK {
+			return result.Arguments, fmt.Errorf("unexpected status code %d from %s", response.StatusCode, method)
+		}
+
+		if err := json.Unmarshal(responseBody, &result); err != nil {
+			return result.Arguments, err
+		}
+
+		if result.Result != "success" {
+			return result.Arguments, fmt.Errorf("%s failed: %s", method, result.Result)
+		}
+
+		return result.Arguments, nil
+	}
+
+	return result.Arguments, errors.New("could not get a session ID")
+}
+
+func (widget *torrentsWidget) fetchTransmissionStatus(ctx context.Context) (*torrentsStatus, error) {
+	widget.session.mu.Lock()
+	defer widget.session.mu.Unlock()
+
+	stats, err := transmissionCall[transmissionSessionStatsJson](ctx, widget, "session-stats", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := transmissionCall[struct {
+		Torrents []transmissionTorrentJson `json:"torrents"`
+	}](ctx, widget, "torrent-get", map[string]any{
+		"fields": []string{
+			"name", "status", "percentDone", "totalSize", "rateDownload",
+			"rateUpload", "eta", "addedDate", "errorString", "error",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	status := &torrentsStatus{
+		DownloadSpeed: stats.DownloadSpeed,
+		UploadSpeed:   stats.UploadSpeed,
+		Torrents:      make([]torrent, 0, len(response.Torrents)),
+	}
+
+	for i := range response.Torrents {
+		t := &response.Torrents[i]
+
+		item := torrent{
+			Name:          t.Name,
+			State:         transmissionState(t.Status),
+			Progress:      int(t.PercentDone * 100),
+			Size:          t.TotalSize,
+			DownloadSpeed: t.RateDownload,
+			UploadSpeed:   t.RateUpload,
+			// -1 when not available and -2 when it can't be estimated
+			ETA:     ternary(t.ETA < 0, -1, time.Duration(t.ETA)*time.Second),
+			AddedAt: time.Unix(t.AddedDate, 0),
+		}
+
+		if t.ErrorCategory != 0 {
+			item.State = "error"
+			item.Error = t.ErrorString
+		}
+
+		status.Torrents = append(status.Torrents, item)
+	}
+
+	return status, nil
+}
+
+func transmissionState(status int) string {
+	switch status {
+	case 0:
+		return "paused"
+	case 1, 2:
+		return "checking"
+	case 3, 5:
+		return "queued"
+	case 4:
+		return "downloading"
+	case 6:
+		return "seeding"
+	}
+
+	return "unknown"
+}
@@ -40,7 +40,7 @@ func (widget *twitchChannelsWidget) initialize() error {
 }
 
 func (widget *twitchChannelsWidget) update(ctx context.Context) {
-	channels, err := fetchChannelsFromTwitch(widget.ChannelsRequest)
+	channels, err := fetchChannelsFromTwitch(widget.httpClient(defaultHTTPClient), widget.ChannelsRequest)
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
@@ -130,7 +130,13 @@ const twitchChannelStatusOperationRequestBody = `[
 // what the limit is for max operations per request and batch operations in
 // multiple requests if number of channels exceeds allowed limit.
 
-func fetchChannelFromTwitchTask(channel string) (twitchChannel, error) {
+func fetchChannelFromTwitchTask(client requestDoer) func(string) (twitchChannel, error) {
+	return func(channel string) (twitchChannel, error) {
+		return fetchChannelFromTwitch(client, channel)
+	}
+}
+
+func fetchChannelFromTwitch(client requestDoer, channel string) (twitchChannel, error) {
 	result := twitchChannel{
 		Login: strings.ToLower(channel),
 	}
@@ -139,7 +145,7 @@ func fetchChannelFromTwitchTask(channel string) (twitchChannel, error) {
 	request, _ := http.NewRequest("POST", twitchGqlEndpoint, reader)
 	request.Header.Add("Client-ID", twitchGqlClientId)
 
-	response, err := decodeJsonFromRequest[[]twitchOperationResponse](defaultHTTPClient, request)
+	response, err := decodeJsonFromRequest[[]twitchOperationResponse](client, request)
 	if err != nil {
 		return result, err
 	}
@@ -205,10 +211,10 @@ func fetchChannelFromTwitchTask(channel string) (twitchChannel, error) {
 	return result, nil
 }
 
-func fetchChannelsFromTwitch(channelLogins []string) (twitchChannelList, error) {
+func fetchChannelsFromTwitch(client requestDoer, channelLogins []string) (twitchChannelList, error) {
 	result := make(twitchChannelList, 0, len(channelLogins))
 
-	job := newJob(fetchChannelFromTwitchTask, channelLogins).withWorkers(10)
+	job := newJob(fetchChannelFromTwitchTask(client), channelLogins).withWorkers(10)
 	channels, errs, err := workerPoolDo(job)
 	if err != nil {
 		return result, err
@@ -0,0 +1,491 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+var upcomingMediaWidgetTemplate = mustParseTemplate("upcoming-media.html", "widget-base.html")
+
+const (
+	mediaServiceSonarr = "sonarr"
+	mediaServiceRadarr = "radarr"
+	mediaServiceLidarr = "lidarr"
+)
+
+type upcomingMediaWidget struct {
+	widgetBase    `yaml:",inline"`
+	Services      []mediaServiceConfig `yaml:"services"`
+	Days          int                  `yaml:"days"`
+	HideQueue     bool                 `yaml:"hide-queue"`
+	HidePosters   bool                 `yaml:"hide-posters"`
+	Limit         int                  `yaml:"limit"`
+	CollapseAfter int                  `yaml:"collapse-after"`
+
+	Upcoming []upcomingMediaItem `yaml:"-"`
+	Queue    []mediaQueueItem    `yaml:"-"`
+}
+
+type mediaServiceConfig struct {
+	Type          string `yaml:"type"`
+	URL           string `yaml:"url"`
+	APIKey        string `yaml:"api-key"`
+	AllowInsecure bool   `yaml:"allow-insecure"`
+	client        requestDoer
+}
+
+type upcomingMediaItem struct {
+	Service   string
+	Title     string
+	Subtitle  string
+	PosterURL string
+	URL       string
+	Date      time.Time
+	// Whether the file has already been downloaded
+	Available bool
+}
+
+type mediaQueueItem struct {
+	Service  string
+	Title    string
+	Subtitle string
+	Status   string
+	Progress int
+	TimeLeft string
+}
+
+func (widget *upcomingMediaWidget) initialize() error {
+	widget.withTitle("Upcoming").withCacheDuration(15 * time.Minute)
+
+	if len(widget.Services) == 0 {
+		return errors.New("at least one service is required")
+	}
+
+	for i := range widget.Services {
+		service := &widget.Services[i]
+
+		switch service.Type {
+		case mediaServiceSonarr, mediaServiceRadarr, mediaServiceLidarr:
+		case "":
+			return fmt.Errorf("service #%d has no type", i+1)
+		default:
+			return fmt.Errorf("service #%d has an unsupported type %q, must be one of sonarr, radarr or lidarr", i+1, service.Type)
+		}
+
+		if service.URL == "" {
+			return fmt.Errorf("service #%d has no url", i+1)
+		}
+
+		if service.APIKey == "" {
+			return fmt.Errorf("service #%d has no api-key", i+1)
+		}
+
+		service.URL = strings.TrimRight(service.URL, "/")
+		service.client = widget.httpClient(ternary(service.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient))
+	}
+
+	if widget.Days <= 0 {
+		widget.Days = 7
+	}
+
+	if widget.Limit <= 0 {
+		widget.Limit = 10
+	}
+
+	if widget.CollapseAfter == 0 || widget.CollapseAfter < -1 {
+		widget.CollapseAfter = 5
+	}
+
+	return nil
+}
+
+func (widget *upcomingMediaWidget) update(ctx context.Context) {
+	type serviceResult struct {
+		upcoming []upcomingMediaItem
+		queue    []mediaQueueItem
+	}
+
+	now := time.Now()
+	start := now.Add(-24 * time.Hour)
+	end := now.AddDate(0, 0, widget.Days)
+
+	task := func(service *mediaServiceConfig) (serviceResult, error) {
+		var result serviceResult
+		var err error
+
+		result.upcoming, err = fetchMediaServiceCalendar(service, start, end)
+		if err != nil {
+			return result, fmt.Errorf("calendar: %v", err)
+		}
+
+		if !widget.HideQueue {
+			result.queue, err = fetchMediaServiceQueue(service)
+			if err != nil {
+				return result, fmt.Errorf("queue: %v", err)
+			}
+		}
+
+		return result, nil
+	}
+
+	services := make([]*mediaServiceConfig, len(widget.Services))
+	for i := range widget.Services {
+		services[i] = &widget.Services[i]
+	}
+
+	job := newJob(task, services).withWorkers(5)
+	results, errs, err := workerPoolDo(job)
+	if err != nil {
+		widget.canContinueUpdateAfterHandlingErr(fmt.Errorf("%w: %v", errNoContent, err))
+		return
+	}
+
+	upcoming := make([]upcomingMediaItem, 0)
+	queue := make([]mediaQueueItem, 0)
+	var failed int
+	var lastErr error
+
+	for i := range results {
+		if errs[i] != nil {
+			failed++
+			lastErr = errs[i]
+			slog.Error("Failed to fetch media service", "type", services[i].Type, "url", services[i].URL, "error", errs[i])
+			continue
+		}
+
+		upcoming = append(upcoming, results[i].upcoming...)
+		queue = append(queue, results[i].queue...)
+	}
+
+	if failed == len(services) {
+		err = fmt.Errorf("%w: %v", errNoContent, lastErr)
+	} else if failed > 0 {
+		err = fmt.Errorf("%w: could not fetch %d services", errPartialContent, failed)
+	}
+
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	// the calendar starts a day early so that things which came out today
+	// are still shown, but anything older which is already here isn't interesting
+	upcoming = slices.DeleteFunc(upcoming, func(item upcomingMediaItem) bool {
+		return item.Date.Before(now) && (item.Available || now.Sub(item.Date) > 24*time.Hour)
+	})
+
+	slices.SortStableFunc(upcoming, func(a, b upcomingMediaItem) int {
+		return a.Date.Compare(b.Date)
+	})
+
+	if len(upcoming) > widget.Limit {
+		upcoming = upcoming[:widget.Limit]
+	}
+
+	if widget.HidePosters {
+		for i := range upcoming {
+			upcoming[i].PosterURL = ""
+		}
+	} else {
+		for i := range upcoming {
+			upcoming[i].PosterURL = globalImageCache.GetCachedImageURL(upcoming[i].PosterURL)
+		}
+	}
+
+	widget.Upcoming = upcoming
+	widget.Queue = queue
+}
+
+func (widget *upcomingMediaWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, upcomingMediaWidgetTemplate)
+}
+
+func (service *mediaServiceConfig) apiPath() string {
+	if service.Type == mediaServiceLidarr {
+		return "/api/v1"
+	}
+
+	return "/api/v3"
+}
+
+func (service *mediaServiceConfig) request(path string, query url.Values) (*http.Request, error) {
+	request, err := http.NewRequest("GET", service.URL+service.apiPath()+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("X-Api-Key", service.APIKey)
+	return request, nil
+}
+
+type mediaImageJson struct {
+	CoverType string `json:"coverType"`
+	RemoteURL string `json:"remoteUrl"`
+}
+
+func mediaPosterURL(images []mediaImageJson, coverType string) string {
+	for i := range images {
+		if images[i].CoverType == coverType {
+			return images[i].RemoteURL
+		}
+	}
+
+	return ""
+}
+
+type sonarrEpisodeJson struct {
+	SeasonNumber  int    `json:"seasonNumber"`
+	EpisodeNumber int    `json:"episodeNumber"`
+	Title         string `json:"title"`
+	AirDateUTC    string `json:"airDateUtc"`
+	HasFile       bool   `json:"hasFile"`
+	Series        struct {
+		Title     string           `json:"title"`
+		TitleSlug string           `json:"titleSlug"`
+		Images    []mediaImageJson `json:"images"`
+	} `json:"series"`
+}
+
+type radarrMovieJson struct {
+	Title           string           `json:"title"`
+	Year            int              `json:"year"`
+	TmdbID          int              `json:"tmdbId"`
+	InCinemas       string           `json:"inCinemas"`
+	DigitalRelease  string           `json:"digitalRelease"`
+	PhysicalRelease string           `json:"physicalRelease"`
+	HasFile         bool             `json:"hasFile"`
+	Images          []mediaImageJson `json:"images"`
+}
+
+type lidarrAlbumJson struct {
+	Title       string           `json:"title"`
+	ReleaseDate string           `json:"releaseDate"`
+	Images      []mediaImageJson `json:"images"`
+	Statistics  *struct {
+		PercentOfTracks float64 `json:"percentOfTracks"`
+	} `json:"statistics"`
+	Artist struct {
+		ArtistName      string `json:"artistName"`
+		ForeignArtistID string `json:"foreignArtistId"`
+	} `json:"artist"`
+}
+
+func fetchMediaServiceCalendar(service *mediaServiceConfig, start, end time.Time) ([]upcomingMediaItem, error) {
+	query := url.Values{}
+	query.Set("start", start.UTC().Format(time.RFC3339))
+	query.Set("end", end.UTC().Format(time.RFC3339))
+
+	switch service.Type {
+	case mediaServiceSonarr:
+		query.Set("includeSeries", "true")
+	case mediaServiceLidarr:
+		query.Set("includeArtist", "true")
+	}
+
+	request, err := service.request("/calendar", query)
+	if err != nil {
+		return nil, err
+	}
+
+	switch service.Type {
+	case mediaServiceSonarr:
+		episodes, err := decodeJsonFromRequest[[]sonarrEpisodeJson](service.client, request)
+		if err != nil {
+			return nil, err
+		}
+
+		items := make([]upcomingMediaItem, 0, len(episodes))
+		for i := range episodes {
+			episode := &episodes[i]
+			subtitle := fmt.Sprintf("S%02dE%02d", episode.SeasonNumber, episode.EpisodeNumber)
+			if episode.Title != "" && episode.Title != "TBA" {
+				subtitle += " · " + episode.Title
+			}
+
+			items = append(items, upcomingMediaItem{
+				Service:   service.Type,
+				Title:     episode.Series.Title,
+				Subtitle:  subtitle,
+				PosterURL: mediaPosterURL(episode.Series.Images, "poster"),
+				URL:       service.URL + "/series/" + episode.Series.TitleSlug,
+				Date:      parseRFC3339Time(episode.AirDateUTC),
+				Available: episode.HasFile,
+			})
+		}
+
+		return items, nil
+	case mediaServiceRadarr:
+		movies, err := decodeJsonFromRequest[[]radarrMovieJson](service.client, request)
+		if err != nil {
+			return nil, err
+		}
+
+		items := make([]upcomingMediaItem, 0, len(movies))
+		for i := range movies {
+			movie := &movies[i]
+			releaseType, date := radarrReleaseWithinRange(movie, start, end)
+			if date.IsZero() {
+				continue
+			}
+
+			items = append(items, upcomingMediaItem{
+				Service:   service.Type,
+				Title:     movie.Title,
+				Subtitle:  fmt.Sprintf("%d · %s", movie.Year, releaseType),
+				PosterURL: mediaPosterURL(movie.Images, "poster"),
+				URL:       fmt.Sprintf("%s/movie/%d", service.URL, movie.TmdbID),
+				Date:      date,
+				Available: movie.HasFile,
+			})
+		}
+
+		return items, nil
+	case mediaServiceLidarr:
+		albums, err := decodeJsonFromRequest[[]lidarrAlbumJson](service.client, request)
+		if err != nil {
+			return nil, err
+		}
+
+		items := make([]upcomingMediaItem, 0, len(albums))
+		for i := range albums {
+			album := &albums[i]
+
+			items = append(items, upcomingMediaItem{
+				Service:   service.Type,
+				Title:     album.Title,
+				Subtitle:  album.Artist.ArtistName,
+				PosterURL: mediaPosterURL(album.Images, "cover"),
+				URL:       service.URL + "/artist/" + album.Artist.ForeignArtistID,
+				Date:      parseRFC3339Time(album.ReleaseDate),
+				Available: album.Statistics != nil && album.Statistics.PercentOfTracks >= 100,
+			})
+		}
+
+		return items, nil
+	}
+
+	return nil, errors.New("unsupported service")
+}
+
+// Movies show up in the calendar when any of their release dates is within
+// the range, this returns whichever one that is
+func radarrReleaseWithinRange(movie *radarrMovieJson, start, end time.Time) (string, time.Time) {
+	releases := []struct {
+		kind string
+		date string
+	}{
+		{"in cinemas", movie.InCinemas},
+		{"digital release", movie.DigitalRelease},
+		{"physical release", movie.PhysicalRelease},
+	}
+
+	for _, release := range releases {
+		date := parseRFC3339Time(release.date)
+		if !date.IsZero() && !date.Before(start) && date.Before(end) {
+			return release.kind, date
+		}
+	}
+
+	return "", time.Time{}
+}
+
+type mediaQueueResponseJson struct {
+	Records []struct {
+		Title                 string  `json:"title"`
+		Size                  float64 `json:"size"`
+		SizeLeft              float64 `json:"sizeleft"`
+		Status                string  `json:"status"`
+		TrackedDownloadStatus string  `json:"trackedDownloadStatus"`
+		TimeLeft              string  `json:"timeleft"`
+		Series                *struct {
+			Title string `json:"title"`
+		} `json:"series"`
+		Episode *struct {
+			SeasonNumber  int `json:"seasonNumber"`
+			EpisodeNumber int `json:"episodeNumber"`
+		} `json:"episode"`
+		Movie *struct {
+			Title string `json:"title"`
+			Year  int    `json:"year"`
+		} `json:"movie"`
+		Artist *struct {
+			ArtistName string `json:"artistName"`
+		} `json:"artist"`
+		Album *struct {
+			Title string `json:"title"`
+		} `json:"album"`
+	} `json:"records"`
+}
+
+func fetchMediaServiceQueue(service *mediaServiceConfig) ([]mediaQueueItem, error) {
+	query := url.Values{}
+	query.Set("pageSize", "50")
+
+	switch service.Type {
+	case mediaServiceSonarr:
+		query.Set("includeSeries", "true")
+		query.Set("includeEpisode", "true")
+	case mediaServiceRadarr:
+		query.Set("includeMovie", "true")
+	case mediaServiceLidarr:
+		query.Set("includeArtist", "true")
+		query.Set("includeAlbum", "true")
+	}
+
+	request, err := service.request("/queue", query)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := decodeJsonFromRequest[mediaQueueResponseJson](service.client, request)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]mediaQueueItem, 0, len(response.Records))
+
+	for i := range response.Records {
+		record := &response.Records[i]
+		item := mediaQueueItem{
+			Service:  service.Type,
+			Title:    record.Title,
+			Status:   strings.ToLower(record.Status),
+			TimeLeft: record.TimeLeft,
+		}
+
+		switch {
+		case record.Series != nil:
+			item.Title = record.Series.Title
+			if record.Episode != nil {
+				item.Subtitle = fmt.Sprintf("S%02dE%02d", record.Episode.SeasonNumber, record.Episode.EpisodeNumber)
+			}
+		case record.Movie != nil:
+			item.Title = record.Movie.Title
+			item.Subtitle = fmt.Sprint(record.Movie.Year)
+		case record.Album != nil:
+			item.Title = record.Album.Title
+			if record.Artist != nil {
+				item.Subtitle = record.Artist.ArtistName
+			}
+		}
+
+		if record.TrackedDownloadStatus == "warning" || record.TrackedDownloadStatus == "error" {
+			item.Status = record.TrackedDownloadStatus
+		}
+
+		if record.Size > 0 {
+			item.Progress = int((record.Size - record.SizeLeft) / record.Size * 100)
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
@@ -10,7 +10,9 @@ import (
 	"io"
 	"math/rand/v2"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -23,26 +25,91 @@ var (
 
 const defaultClientTimeout = 5 * time.Second
 
-var defaultHTTPClient = &http.Client{
+var defaultHTTPClient = &requestClient{Client: &http.Client{
 	Transport: &http.Transport{
 		MaxIdleConnsPerHost: 10,
-		Proxy:               http.ProxyFromEnvironment,
+		Proxy:               proxyForRequest,
+		DialContext:         dialOutbound,
+		// setting DialContext would otherwise turn off HTTP/2
+		ForceAttemptHTTP2: true,
 	},
-	Timeout: defaultClientTimeout,
-}
+}}
 
-var defaultInsecureHTTPClient = &http.Client{
-	Timeout: defaultClientTimeout,
+var defaultInsecureHTTPClient = &requestClient{Client: &http.Client{
 	Transport: &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		Proxy:           http.ProxyFromEnvironment,
+		Proxy:           proxyForRequest,
+		DialContext:     dialOutbound,
 	},
+}}
+
+// Set from the proxies in the config once the application replaces the
+// previous one
+var hostProxyRules atomic.Pointer[[]hostProxyRule]
+
+func configureHostProxies(rules []hostProxyRule) {
+	hostProxyRules.Store(&rules)
+}
+
+// The first rule whose hosts match the request is used, requests to any other
+// host go through the proxy from the environment, if there is one
+func proxyForRequest(request *http.Request) (*url.URL, error) {
+	if rules := hostProxyRules.Load(); rules != nil {
+		host := request.URL.Hostname()
+
+		for i := range *rules {
+			if hostMatches(host, (*rules)[i].Hosts) {
+				return (*rules)[i].proxyURL, nil
+			}
+		}
+	}
+
+	return http.ProxyFromEnvironment(request)
+}
+
+// Subdomains of the hosts match too
+func hostMatches(host string, hosts []string) bool {
+	for _, h := range hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+
+	return false
 }
 
 type requestDoer interface {
 	Do(*http.Request) (*http.Response, error)
 }
 
+// Sets the headers and cookies from a widget's config on every request made
+// through the client, after the ones which the widget sets itself
+type requestDoerWithHeaders struct {
+	client  requestDoer
+	headers map[string]string
+	cookies map[string]string
+}
+
+func withRequestHeaders(client requestDoer, headers, cookies map[string]string) requestDoer {
+	if len(headers) == 0 && len(cookies) == 0 {
+		return client
+	}
+
+	return &requestDoerWithHeaders{client: client, headers: headers, cookies: cookies}
+}
+
+func (d *requestDoerWithHeaders) Do(request *http.Request) (*http.Response, error) {
+	for key, value := range d.headers {
+		request.Header.Set(key, value)
+	}
+
+	for name, value := range d.cookies {
+		request.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+
+	return d.client.Do(request)
+}
+
 var glanceUserAgentString = "Glance/" + buildVersion + " +https://github.com/glanceapp/glance"
 var userAgentPersistentVersion atomic.Int32
 
@@ -138,6 +205,145 @@ func decodeXmlFromRequestTask[T any](client requestDoer) func(*http.Request) (T,
 	}
 }
 
+// Remembers the ETag and Last-Modified validators of responses along with what
+// they were decoded into, so that sources which haven't changed can respond
+// with 304 Not Modified and don't have to be decoded again
+type conditionalRequestCache[T any] struct {
+	mu        sync.Mutex
+	responses map[string]*conditionalResponse[T]
+	// Whether any request got something other than a 304 since allNotModified
+	// was last called, starts off as true since nothing has been fetched yet
+	modified bool
+}
+
+type conditionalResponse[T any] struct {
+	etag         string
+	lastModified string
+	value        T
+}
+
+func newConditionalRequestCache[T any]() *conditionalRequestCache[T] {
+	return &conditionalRequestCache[T]{
+		responses: make(map[string]*conditionalResponse[T]),
+		modified:  true,
+	}
+}
+
+func (c *conditionalRequestCache[T]) addValidators(request *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous, exists := c.responses[request.URL.String()]
+	if !exists {
+		return
+	}
+
+	if previous.etag != "" {
+		request.Header.Set("If-None-Match", previous.etag)
+	}
+
+	if previous.lastModified != "" {
+		request.Header.Set("If-Modified-Since", previous.lastModified)
+	}
+}
+
+// Returns the value of the previous response when the server responded with
+// 304, otherwise the request counts as modified until store gets called
+func (c *conditionalRequestCache[T]) notModified(request *http.Request, response *http.Response) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if response != nil && response.StatusCode == http.StatusNotModified {
+		if previous, exists := c.responses[request.URL.String()]; exists {
+			return previous.value, true
+		}
+	}
+
+	c.modified = true
+
+	var zero T
+	return zero, false
+}
+
+func (c *conditionalRequestCache[T]) store(request *http.Request, response *http.Response, value T) {
+	etag := response.Header.Get("ETag")
+	lastModified := response.Header.Get("Last-Modified")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if etag == "" && lastModified == "" {
+		delete(c.responses, request.URL.String())
+		return
+	}
+
+	c.responses[request.URL.String()] = &conditionalResponse[T]{
+		etag:         etag,
+		lastModified: lastModified,
+		value:        value,
+	}
+}
+
+// Whether every request made since the last call was answered with a 304,
+// in which case whatever was built from the responses last time is still
+// up to date
+func (c *conditionalRequestCache[T]) allNotModified() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	notModified := !c.modified
+	c.modified = false
+
+	return notModified
+}
+
+func decodeXmlFromConditionalRequest[T any](client requestDoer, cache *conditionalRequestCache[T], request *http.Request) (T, error) {
+	cache.addValidators(request)
+
+	response, err := client.Do(request)
+	if value, ok := cache.notModified(request, response); ok {
+		response.Body.Close()
+		return value, nil
+	}
+
+	var result T
+
+	if err != nil {
+		return result, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return result, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		truncatedBody, _ := limitStringLength(string(body), 256)
+
+		return result, fmt.Errorf(
+			"unexpected status code %d for %s, response: %s",
+			response.StatusCode,
+			request.URL,
+			truncatedBody,
+		)
+	}
+
+	if err = xml.Unmarshal(body, &result); err != nil {
+		return result, err
+	}
+
+	cache.store(request, response, result)
+
+	return result, nil
+}
+
+func decodeXmlFromConditionalRequestTask[T any](client requestDoer, cache *conditionalRequestCache[T]) func(*http.Request) (T, error) {
+	return func(request *http.Request) (T, error) {
+		return decodeXmlFromConditionalRequest(client, cache, request)
+	}
+}
+
 type workerPoolTask[I any, O any] struct {
 	index  int
 	input  I
@@ -190,10 +396,14 @@ func workerPoolDo[I any, O any](job *workerPoolJob[I, O]) ([]O, []error, error)
 	}
 
 	if len(job.data) == 1 {
+		workerPoolActiveTasks.Add(1)
 		results[0], errs[0] = job.task(job.data[0])
+		workerPoolActiveTasks.Add(-1)
 		return results, errs, nil
 	}
 
+	workerPoolQueuedTasks.Add(int64(len(job.data)))
+
 	tasksQueue := make(chan *workerPoolTask[I, O])
 	resultsQueue := make(chan *workerPoolTask[I, O])
 
@@ -205,7 +415,10 @@ func workerPoolDo[I any, O any](job *workerPoolJob[I, O]) ([]O, []error, error)
 			defer wg.Done()
 
 			for t := range tasksQueue {
+				workerPoolQueuedTasks.Add(-1)
+				workerPoolActiveTasks.Add(1)
 				t.output, t.err = job.task(t.input)
+				workerPoolActiveTasks.Add(-1)
 				resultsQueue <- t
 			}
 		}()
@@ -224,6 +437,8 @@ func workerPoolDo[I any, O any](job *workerPoolJob[I, O]) ([]O, []error, error)
 				}
 			case <-job.ctx.Done():
 				err = job.ctx.Err()
+				// the rest of the tasks are never going to be picked up
+				workerPoolQueuedTasks.Add(-int64(len(job.data) - i))
 				break loop
 			}
 		}
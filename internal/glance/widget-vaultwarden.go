@@ -0,0 +1,230 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var vaultwardenWidgetTemplate = mustParseTemplate("vaultwarden.html", "widget-base.html")
+
+const (
+	vaultwardenUserStatusEnabled  = 0
+	vaultwardenUserStatusInvited  = 1
+	vaultwardenUserStatusDisabled = 2
+)
+
+type vaultwardenWidget struct {
+	widgetBase    `yaml:",inline"`
+	URL           string             `yaml:"url"`
+	AdminToken    string             `yaml:"admin-token"`
+	AllowInsecure bool               `yaml:"allow-insecure"`
+	BackupPath    string             `yaml:"backup-path"`
+	BackupMaxAge  durationField      `yaml:"backup-max-age"`
+	Status        *vaultwardenStatus `yaml:"-"`
+	client        *requestClient     `yaml:"-"`
+}
+
+type vaultwardenStatus struct {
+	Online         bool
+	ResponseTime   time.Duration
+	Version        string
+	HasUsers       bool
+	Users          int
+	DisabledUsers  int
+	PendingInvites int
+	HasBackup      bool
+	LastBackup     time.Time
+	BackupOverdue  bool
+	BackupError    string
+}
+
+type vaultwardenUserJson struct {
+	Status      int  `json:"_status"`
+	UserEnabled bool `json:"userEnabled"`
+}
+
+func (widget *vaultwardenWidget) initialize() error {
+	widget.withTitle("Vaultwarden").withCacheDuration(5 * time.Minute)
+
+	if widget.URL == "" {
+		return errors.New("url is required")
+	}
+
+	widget.URL = strings.TrimRight(widget.URL, "/")
+
+	if widget.BackupMaxAge == 0 {
+		widget.BackupMaxAge = durationField(24 * time.Hour)
+	}
+
+	base := ternary(widget.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient)
+	widget.client = widget.httpClient(&requestClient{Client: &http.Client{
+		Transport: base.Transport,
+		// logging in redirects back to the admin page, the cookie is
+		// in the response to the login request
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}})
+
+	return nil
+}
+
+func (widget *vaultwardenWidget) update(ctx context.Context) {
+	status, err := widget.fetchStatus(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Status = status
+}
+
+func (widget *vaultwardenWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, vaultwardenWidgetTemplate)
+}
+
+func (widget *vaultwardenWidget) fetchStatus(ctx context.Context) (*vaultwardenStatus, error) {
+	status := &vaultwardenStatus{}
+
+	// the backup is checked regardless of whether the server is up, since
+	// that's exactly when you want to know whether there's a recent one
+	if widget.BackupPath != "" {
+		status.HasBackup = true
+		lastBackup, err := newestModificationTime(widget.BackupPath)
+		if err != nil {
+			status.BackupError = err.Error()
+			status.BackupOverdue = true
+		} else {
+			status.LastBackup = lastBackup
+			status.BackupOverdue = time.Since(lastBackup) > time.Duration(widget.BackupMaxAge)
+		}
+	}
+
+	started := time.Now()
+	request, _ := http.NewRequestWithContext(ctx, "GET", widget.URL+"/alive", nil)
+	response, err := widget.client.Do(request)
+	if err != nil {
+		return status, nil
+	}
+	response.Body.Close()
+
+	status.ResponseTime = time.Since(started)
+	status.Online = response.StatusCode == http.StatusOK
+
+	if !status.Online {
+		return status, nil
+	}
+
+	request, _ = http.NewRequestWithContext(ctx, "GET", widget.URL+"/api/version", nil)
+	if version, err := decodeJsonFromRequest[string](widget.client, request); err == nil {
+		status.Version = version
+	}
+
+	if widget.AdminToken == "" {
+		return status, nil
+	}
+
+	users, err := widget.fetchUsers(ctx)
+	if err != nil {
+		return status, fmt.Errorf("%w: %v", errPartialContent, err)
+	}
+
+	status.HasUsers = true
+	for i := range users {
+		switch {
+		case users[i].Status == vaultwardenUserStatusInvited:
+			status.PendingInvites++
+		case users[i].Status == vaultwardenUserStatusDisabled || !users[i].UserEnabled:
+			status.Users++
+			status.DisabledUsers++
+		default:
+			status.Users++
+		}
+	}
+
+	return status, nil
+}
+
+func (widget *vaultwardenWidget) fetchUsers(ctx context.Context) ([]vaultwardenUserJson, error) {
+	form := url.Values{"token": {widget.AdminToken}}
+	request, _ := http.NewRequestWithContext(ctx, "POST", widget.URL+"/admin", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := widget.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("logging into the admin panel: %v", err)
+	}
+	response.Body.Close()
+
+	var session *http.Cookie
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == "VW_ADMIN" {
+			session = cookie
+			break
+		}
+	}
+
+	if session == nil {
+		if response.StatusCode == http.StatusNotFound {
+			return nil, errors.New("the admin panel is disabled")
+		}
+
+		return nil, errors.New("logging into the admin panel failed, check the admin token")
+	}
+
+	request, _ = http.NewRequestWithContext(ctx, "GET", widget.URL+"/admin/users", nil)
+	request.AddCookie(session)
+
+	users, err := decodeJsonFromRequest[[]vaultwardenUserJson](widget.client, request)
+	if err != nil {
+		return nil, fmt.Errorf("fetching users: %v", err)
+	}
+
+	return users, nil
+}
+
+// For a directory, the most recently modified file in it
+func newestModificationTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if !info.IsDir() {
+		return info.ModTime(), nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var newest time.Time
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+
+	if newest.IsZero() {
+		return newest, fmt.Errorf("no backups found in %s", filepath.Clean(path))
+	}
+
+	return newest, nil
+}
@@ -0,0 +1,193 @@
+package glance
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	videosSeenMaxAge          = 90 * 24 * time.Hour
+	videosSeenMaxEntries      = 5000
+	videosSeenMaxKeysPerWrite = 500
+)
+
+// Shared across every videos widget of the same person, so that a video which
+// shows up in several widgets only has to be watched once
+var videosSeenMutex sync.Mutex
+
+type videosSeenState struct {
+	// Videos posted before tracking started are considered to be seen, otherwise
+	// everything would show up as new the first time
+	Since time.Time            `json:"since"`
+	Seen  map[string]time.Time `json:"seen"`
+}
+
+type videosSeenResponse struct {
+	Since int64    `json:"since"`
+	Seen  []string `json:"seen"`
+	// Nothing is stored until the page asks for tracking to start, so that
+	// requests which only read don't leave anything behind
+	Started bool `json:"started"`
+}
+
+func (v *video) SeenKey() string {
+	return ternary(v.ID != "", v.ID, v.Url)
+}
+
+func (widget *videosWidget) SeenURL() string {
+	if !widget.TrackSeen || widget.Providers == nil {
+		return ""
+	}
+
+	return widget.Providers.baseURL + "/api/widgets/" + strconv.FormatUint(widget.ID, 10) + "/seen"
+}
+
+func videosSeenStoreKey(owner string) string {
+	return "videos-seen:" + owner
+}
+
+func (widget *videosWidget) handleRequest(w http.ResponseWriter, r *http.Request) {
+	if !widget.TrackSeen || r.PathValue("path") != "seen" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if widget.Providers.store == nil || widget.Providers.ownerKeyForWriting == nil {
+		http.Error(w, "state store is not available", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		widget.handleGetSeenRequest(w, r)
+	case http.MethodPost:
+		widget.handleMarkSeenRequest(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (widget *videosWidget) handleGetSeenRequest(w http.ResponseWriter, r *http.Request) {
+	owner, ok := widget.Providers.ownerKeyFromRequest(r)
+	if !ok && widget.Providers.usernameFromRequest != nil {
+		http.Error(w, "requires being logged in", http.StatusUnauthorized)
+		return
+	}
+
+	var state videosSeenState
+	var found bool
+
+	if ok {
+		videosSeenMutex.Lock()
+		var err error
+		found, err = widget.Providers.store.get(videosSeenStoreKey(owner), &state)
+		videosSeenMutex.Unlock()
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if !found {
+		state.Since = time.Now()
+	}
+
+	writeVideosSeenResponse(w, &state, found)
+}
+
+func (widget *videosWidget) handleMarkSeenRequest(w http.ResponseWriter, r *http.Request) {
+	owner, err := widget.Providers.ownerKeyForWriting(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		Keys []string `json:"keys"`
+	}
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(request.Keys) > videosSeenMaxKeysPerWrite {
+		http.Error(w, "too many keys", http.StatusBadRequest)
+		return
+	}
+
+	videosSeenMutex.Lock()
+	defer videosSeenMutex.Unlock()
+
+	now := time.Now()
+	key := videosSeenStoreKey(owner)
+
+	var state videosSeenState
+	found, err := widget.Providers.store.get(key, &state)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !found || state.Seen == nil {
+		state.Since = ternary(found, state.Since, now)
+		state.Seen = make(map[string]time.Time)
+	}
+
+	if !found || len(request.Keys) > 0 {
+		for _, videoKey := range request.Keys {
+			if videoKey != "" && len(videoKey) <= 256 {
+				state.Seen[videoKey] = now
+			}
+		}
+
+		state.prune(now)
+
+		if err := widget.Providers.store.set(key, &state); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeVideosSeenResponse(w, &state, true)
+}
+
+func writeVideosSeenResponse(w http.ResponseWriter, state *videosSeenState, started bool) {
+	response := videosSeenResponse{
+		Since:   state.Since.Unix(),
+		Seen:    make([]string, 0, len(state.Seen)),
+		Started: started,
+	}
+
+	for videoKey := range state.Seen {
+		response.Seen = append(response.Seen, videoKey)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *videosSeenState) prune(now time.Time) {
+	maps.DeleteFunc(s.Seen, func(_ string, seenAt time.Time) bool {
+		return now.Sub(seenAt) > videosSeenMaxAge
+	})
+
+	if len(s.Seen) <= videosSeenMaxEntries {
+		return
+	}
+
+	keys := slices.SortedFunc(maps.Keys(s.Seen), func(a, b string) int {
+		return s.Seen[a].Compare(s.Seen[b])
+	})
+
+	for _, key := range keys[:len(keys)-videosSeenMaxEntries] {
+		delete(s.Seen, key)
+	}
+}
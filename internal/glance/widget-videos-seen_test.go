@@ -0,0 +1,67 @@
+package glance
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVideosSeenRequestsOnlyWriteOnPost(t *testing.T) {
+	app := &application{store: &stateStore{data: make(map[string]json.RawMessage)}}
+
+	widget := &videosWidget{TrackSeen: true}
+	widget.Providers = &widgetProviders{
+		store:               app.store,
+		ownerKeyFromRequest: app.ownerKeyFromRequest,
+		ownerKeyForWriting:  app.ownerKeyForWriting,
+	}
+
+	request := func(method, body string, cookies ...*http.Cookie) (*httptest.ResponseRecorder, videosSeenResponse) {
+		r := httptest.NewRequest(method, "/api/widgets/1/seen", strings.NewReader(body))
+		r.SetPathValue("path", "seen")
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+
+		recorder := httptest.NewRecorder()
+		widget.handleRequest(recorder, r)
+
+		var response videosSeenResponse
+		if recorder.Code == http.StatusOK {
+			json.Unmarshal(recorder.Body.Bytes(), &response)
+		}
+
+		return recorder, response
+	}
+
+	recorder, response := request("GET", "")
+	if recorder.Code != http.StatusOK || response.Started || len(response.Seen) != 0 {
+		t.Fatalf("unexpected response %d %+v", recorder.Code, response)
+	}
+
+	if len(recorder.Result().Cookies()) != 0 || len(app.store.keysWithPrefix("")) != 0 {
+		t.Fatal("expected a request without a device to not create one")
+	}
+
+	unknown := &http.Cookie{Name: preferencesDeviceCookieName, Value: strings.Repeat("ab", preferencesDeviceTokenBytes)}
+	if recorder, response = request("GET", "", unknown); response.Started || len(app.store.keysWithPrefix("")) != 0 {
+		t.Fatalf("expected an unknown device to not be stored, got %d %+v", recorder.Code, response)
+	}
+
+	recorder, response = request("POST", `{"keys":["abc"]}`)
+	cookies := recorder.Result().Cookies()
+	if recorder.Code != http.StatusOK || !response.Started || len(cookies) != 1 {
+		t.Fatalf("expected marking a video as seen to create a device, got %d %+v", recorder.Code, response)
+	}
+
+	if len(app.store.keysWithPrefix("videos-seen:")) != 1 {
+		t.Fatal("expected the seen videos to be stored")
+	}
+
+	recorder, response = request("GET", "", cookies[0])
+	if recorder.Code != http.StatusOK || !response.Started || len(response.Seen) != 1 || response.Seen[0] != "abc" {
+		t.Errorf("expected the stored state, got %d %+v", recorder.Code, response)
+	}
+}
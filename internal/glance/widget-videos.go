@@ -2,309 +2,77 @@ package glance
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
 	"net/http"
-	// "net/url"
+	"net/url"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
-	"time"
-	"os"
-	"crypto/md5"
-	"io"
-	"path/filepath"
 	"sync"
+	"time"
 )
 
 const videosWidgetPlaylistPrefix = "playlist:"
 
 var (
-	videosWidgetTemplate             = mustParseTemplate("videos.html", "widget-base.html", "video-card-contents.html")
-	videosWidgetGridTemplate         = mustParseTemplate("videos-grid.html", "widget-base.html", "video-card-contents.html")
-	videosWidgetVerticalListTemplate = mustParseTemplate("videos-vertical-list.html", "widget-base.html")
+	videosWidgetTemplate             = mustParseTemplate("videos.html", "widget-base.html", "video-card-contents.html", "videos-mark-seen.html")
+	videosWidgetGridTemplate         = mustParseTemplate("videos-grid.html", "widget-base.html", "video-card-contents.html", "videos-mark-seen.html")
+	videosWidgetVerticalListTemplate = mustParseTemplate("videos-vertical-list.html", "widget-base.html", "videos-mark-seen.html")
 )
 
 type videosWidget struct {
 	widgetBase        `yaml:",inline"`
-	Videos            videoList `yaml:"-"`
-	VideoUrlTemplate  string    `yaml:"video-url-template"`
-	Style             string    `yaml:"style"`
-	CollapseAfter     int       `yaml:"collapse-after"`
-	CollapseAfterRows int       `yaml:"collapse-after-rows"`
-	Channels          []string  `yaml:"channels"`
-	Playlists         []string  `yaml:"playlists"`
-	Limit             int       `yaml:"limit"`
-	IncludeShorts     bool      `yaml:"include-shorts"`
+	Videos            videoList                 `yaml:"-"`
+	VideoUrlTemplate  string                    `yaml:"video-url-template"`
+	Style             string                    `yaml:"style"`
+	CollapseAfter     int                       `yaml:"collapse-after"`
+	CollapseAfterRows int                       `yaml:"collapse-after-rows"`
+	Channels          []string                  `yaml:"channels"`
+	Playlists         []string                  `yaml:"playlists"`
+	Limit             int                       `yaml:"limit"`
+	LimitPerChannel   int                       `yaml:"limit-per-channel"`
+	IncludeShorts     bool                      `yaml:"include-shorts"`
+	Twitch            *videosWidgetTwitchConfig `yaml:"twitch"`
+	Proxy             proxyOptionsField         `yaml:"proxy"`
+	Headers           map[string]string         `yaml:"headers"`
+	Cookies           map[string]string         `yaml:"cookies"`
+	TrackSeen         bool                      `yaml:"track-seen"`
+	ExcludeTitleRegex string                    `yaml:"exclude-title-regex"`
+	IncludeTitleRegex string                    `yaml:"include-title-regex"`
+	MinDuration       durationField             `yaml:"min-duration"`
+
+	excludeTitlePattern *regexp.Regexp
+	includeTitlePattern *regexp.Regexp
+	youtubeFeeds        *conditionalRequestCache[youtubeFeedResponseXml]
+	failingChannels     *sourceBackoff
+	// Only then can the videos be left as they are when none of the feeds changed
+	onlyYoutubeChannels bool
+}
+
+type videosWidgetTwitchConfig struct {
+	ClientID     string `yaml:"client-id"`
+	ClientSecret string `yaml:"client-secret"`
 }
 
 type bilibiliSpaceResponseJson struct {
 	Data struct {
 		Item []struct {
-			Title  string `json:"title"`
-			Cover  string `json:"cover"`
-			Ctime  int64  `json:"ctime"`
-			Author string `json:"author"`
-			Bvid   string `json:"bvid"`
+			Title    string `json:"title"`
+			Cover    string `json:"cover"`
+			Ctime    int64  `json:"ctime"`
+			Author   string `json:"author"`
+			Bvid     string `json:"bvid"`
+			Duration int64  `json:"duration"`
+			Play     int    `json:"play"`
+			Danmaku  int    `json:"danmaku"`
 		} `json:"item"`
 	} `json:"data"`
 }
 
-// 图片缓存管理器
-type ImageCache struct {
-    cacheDir      string
-    cacheDuration time.Duration
-    downloading   map[string]chan struct{} // 防止重复下载
-    mutex         sync.RWMutex
-}
-
-// 创建图片缓存管理器
-func NewImageCache(cacheDir string, duration time.Duration) *ImageCache {
-    // 确保缓存目录存在
-    if err := os.MkdirAll(cacheDir, 0755); err != nil {
-        slog.Error("Failed to create cache directory", "dir", cacheDir, "error", err)
-    }
-
-    return &ImageCache{
-        cacheDir:      cacheDir,
-        cacheDuration: duration,
-        downloading:   make(map[string]chan struct{}),
-    }
-}
-
-// 生成缓存文件名
-func (ic *ImageCache) getCacheFileName(url string) string {
-    hash := md5.Sum([]byte(url))
-    
-    // 根据URL确定文件扩展名
-    ext := ".jpg" // 默认
-    if strings.Contains(url, ".png") {
-        ext = ".png"
-    } else if strings.Contains(url, ".webp") {
-        ext = ".webp"
-    } else if strings.Contains(url, ".gif") {
-        ext = ".gif"
-    }
-    
-    return fmt.Sprintf("%x%s", hash, ext)
-}
-
-// 获取缓存文件完整路径
-func (ic *ImageCache) getCacheFilePath(url string) string {
-    return filepath.Join(ic.cacheDir, ic.getCacheFileName(url))
-}
-
-// 检查缓存是否有效
-func (ic *ImageCache) isCacheValid(filePath string) bool {
-    info, err := os.Stat(filePath)
-    if err != nil {
-        return false
-    }
-    
-    // 检查文件是否在有效期内
-    return time.Since(info.ModTime()) < ic.cacheDuration
-}
-
-// 下载图片到缓存
-func (ic *ImageCache) downloadImage(url, filePath string) error {
-    // 创建带有防盗链头部的请求
-    req, err := http.NewRequest("GET", url, nil)
-    if err != nil {
-        return fmt.Errorf("create request failed: %w", err)
-    }
-    
-    // 🔑 关键：设置请求头绕过B站防盗链
-    req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-    req.Header.Set("Referer", "https://www.bilibili.com/")
-    req.Header.Set("Accept", "image/webp,image/apng,image/*,*/*;q=0.8")
-    req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9")
-    req.Header.Set("Cache-Control", "no-cache")
-    req.Header.Set("Sec-Fetch-Dest", "image")
-    req.Header.Set("Sec-Fetch-Mode", "no-cors")
-    req.Header.Set("Sec-Fetch-Site", "cross-site")
-    
-    client := &http.Client{
-        Timeout: 15 * time.Second,
-        Transport: &http.Transport{
-            MaxIdleConns:       10,
-            IdleConnTimeout:    30 * time.Second,
-        },
-    }
-    
-    resp, err := client.Do(req)
-    if err != nil {
-        return fmt.Errorf("request failed: %w", err)
-    }
-    defer resp.Body.Close()
-    
-    if resp.StatusCode != http.StatusOK {
-        return fmt.Errorf("bad status code: %d", resp.StatusCode)
-    }
-    
-    // 创建临时文件，避免部分下载的文件被使用
-    tempPath := filePath + ".tmp"
-    file, err := os.Create(tempPath)
-    if err != nil {
-        return fmt.Errorf("create temp file failed: %w", err)
-    }
-    
-    // 下载图片内容
-    _, err = io.Copy(file, resp.Body)
-    file.Close()
-    
-    if err != nil {
-        os.Remove(tempPath) // 清理失败的临时文件
-        return fmt.Errorf("download failed: %w", err)
-    }
-    
-    // 原子性移动文件
-    if err := os.Rename(tempPath, filePath); err != nil {
-        os.Remove(tempPath)
-        return fmt.Errorf("move temp file failed: %w", err)
-    }
-    
-    slog.Info("Image cached successfully", "url", url, "path", filePath)
-    return nil
-}
-
-// 获取缓存的图片URL（同步版本）
-func (ic *ImageCache) GetCachedImageURL(originalURL string) string {
-    if originalURL == "" {
-        return ""
-    }
-    
-    // 确保使用 HTTPS
-    if strings.HasPrefix(originalURL, "http://") {
-        originalURL = strings.Replace(originalURL, "http://", "https://", 1)
-    }
-    
-    filePath := ic.getCacheFilePath(originalURL)
-    fileName := ic.getCacheFileName(originalURL)
-    
-    // 如果缓存有效，直接返回缓存URL
-    if ic.isCacheValid(filePath) {
-        return "/cache/images/" + fileName
-    }
-    
-    // 防止同一图片重复下载
-    ic.mutex.Lock()
-    if ch, exists := ic.downloading[originalURL]; exists {
-        ic.mutex.Unlock()
-        // 等待其他goroutine下载完成
-        <-ch
-        if ic.isCacheValid(filePath) {
-            return "/cache/images/" + fileName
-        }
-    } else {
-        // 标记正在下载
-        ch := make(chan struct{})
-        ic.downloading[originalURL] = ch
-        ic.mutex.Unlock()
-        
-        // 下载图片
-        go func() {
-            defer func() {
-                close(ch)
-                ic.mutex.Lock()
-                delete(ic.downloading, originalURL)
-                ic.mutex.Unlock()
-            }()
-            
-            if err := ic.downloadImage(originalURL, filePath); err != nil {
-                slog.Error("Failed to download image", "url", originalURL, "error", err)
-            }
-        }()
-    }
-    
-    // 检查是否存在旧缓存（即使过期也先用着）
-    if _, err := os.Stat(filePath); err == nil {
-        return "/cache/images/" + fileName
-    }
-    
-    // 如果没有缓存，返回原始URL作为后备
-    return originalURL
-}
-
-// 预加载图片到缓存（异步版本）
-func (ic *ImageCache) PreloadImage(originalURL string) {
-    if originalURL == "" {
-        return
-    }
-    
-    // 确保使用 HTTPS
-    if strings.HasPrefix(originalURL, "http://") {
-        originalURL = strings.Replace(originalURL, "http://", "https://", 1)
-    }
-    
-    filePath := ic.getCacheFilePath(originalURL)
-    
-    // 如果已经缓存且有效，跳过
-    if ic.isCacheValid(filePath) {
-        return
-    }
-    
-    // 防止重复下载
-    ic.mutex.Lock()
-    if _, exists := ic.downloading[originalURL]; exists {
-        ic.mutex.Unlock()
-        return
-    }
-    
-    ch := make(chan struct{})
-    ic.downloading[originalURL] = ch
-    ic.mutex.Unlock()
-    
-    // 异步下载
-    go func() {
-        defer func() {
-            close(ch)
-            ic.mutex.Lock()
-            delete(ic.downloading, originalURL)
-            ic.mutex.Unlock()
-        }()
-        
-        if err := ic.downloadImage(originalURL, filePath); err != nil {
-            slog.Error("Failed to preload image", "url", originalURL, "error", err)
-        }
-    }()
-}
-
-// 清理过期缓存
-func (ic *ImageCache) CleanExpiredCache() {
-    files, err := filepath.Glob(filepath.Join(ic.cacheDir, "*"))
-    if err != nil {
-        slog.Error("Failed to list cache files", "error", err)
-        return
-    }
-    
-    var cleaned int
-    var totalSize int64
-    
-    for _, file := range files {
-        info, err := os.Stat(file)
-        if err != nil {
-            continue
-        }
-        
-        // 删除过期文件
-        if time.Since(info.ModTime()) > ic.cacheDuration {
-            if err := os.Remove(file); err == nil {
-                cleaned++
-                totalSize += info.Size()
-            }
-        }
-    }
-    
-    if cleaned > 0 {
-        slog.Info("Cache cleanup completed", 
-            "files_removed", cleaned, 
-            "space_freed", fmt.Sprintf("%.2fMB", float64(totalSize)/(1024*1024)))
-    }
-}
-
-// 全局图片缓存实例
-var globalImageCache = NewImageCache("/root/glance/cache/images", 24*time.Hour)
-
 func (widget *videosWidget) initialize() error {
 	widget.withTitle("视频").withCacheDuration(time.Hour)
 
@@ -328,7 +96,56 @@ func (widget *videosWidget) initialize() error {
 		widget.Channels = append(widget.Channels, make([]string, len(widget.Playlists))...)
 
 		for i := range widget.Playlists {
-			widget.Channels[initialLen+i] = videosWidgetPlaylistPrefix + widget.Playlists[i]
+			// Bilibili collections and series are playlists too, but are told apart by their own prefix
+			if _, _, err := parseBilibiliList(widget.Playlists[i]); err == nil {
+				widget.Channels[initialLen+i] = widget.Playlists[i]
+			} else {
+				widget.Channels[initialLen+i] = videosWidgetPlaylistPrefix + widget.Playlists[i]
+			}
+		}
+	}
+
+	widget.youtubeFeeds = newConditionalRequestCache[youtubeFeedResponseXml]()
+	widget.failingChannels = newSourceBackoff()
+	widget.onlyYoutubeChannels = true
+
+	for i := range widget.Channels {
+		source, id := parseVideoChannel(widget.Channels[i])
+		if source != videoSourceYoutube {
+			widget.onlyYoutubeChannels = false
+		}
+
+		switch source {
+		case videoSourceBilibili:
+			if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+				return fmt.Errorf("invalid bilibili UID %q, expected a number", id)
+			}
+		case videoSourceBilibiliList:
+			if _, _, err := parseBilibiliList(id); err != nil {
+				return err
+			}
+		case videoSourceTwitch:
+			if !twitchLoginPattern.MatchString(id) {
+				return fmt.Errorf("invalid twitch login %q", id)
+			}
+
+			if widget.Twitch == nil || widget.Twitch.ClientID == "" || widget.Twitch.ClientSecret == "" {
+				return errors.New("twitch client-id and client-secret are required for twitch channels")
+			}
+		}
+	}
+
+	var err error
+
+	if widget.ExcludeTitleRegex != "" {
+		if widget.excludeTitlePattern, err = regexp.Compile(widget.ExcludeTitleRegex); err != nil {
+			return fmt.Errorf("invalid exclude-title-regex: %v", err)
+		}
+	}
+
+	if widget.IncludeTitleRegex != "" {
+		if widget.includeTitlePattern, err = regexp.Compile(widget.IncludeTitleRegex); err != nil {
+			return fmt.Errorf("invalid include-title-regex: %v", err)
 		}
 	}
 
@@ -336,12 +153,27 @@ func (widget *videosWidget) initialize() error {
 }
 
 func (widget *videosWidget) update(ctx context.Context) {
-	videos, err := fetchYoutubeChannelUploads(widget.Channels, widget.VideoUrlTemplate, widget.IncludeShorts)
+	client := widget.httpClient(ternary(widget.Proxy.client != nil, widget.Proxy.client, defaultHTTPClient))
+	videos, err := fetchVideoUploads(withRequestHeaders(client, widget.Headers, widget.Cookies), widget.Channels, widget.VideoUrlTemplate, widget.IncludeShorts, widget.Twitch, widget.youtubeFeeds, widget.failingChannels)
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
 	}
 
+	if widget.youtubeFeeds.allNotModified() && widget.onlyYoutubeChannels {
+		return
+	}
+
+	// the same video can show up in both a channel and one of its playlists
+	videos = videos.deduplicate()
+	videos = videos.filter(widget.includeTitlePattern, widget.excludeTitlePattern, time.Duration(widget.MinDuration))
+
+	if widget.LimitPerChannel > 0 {
+		videos = videos.limitPerChannel(widget.LimitPerChannel)
+	}
+
+	videos.pinLive()
+
 	if len(videos) > widget.Limit {
 		videos = videos[:widget.Limit]
 	}
@@ -349,6 +181,24 @@ func (widget *videosWidget) update(ctx context.Context) {
 	widget.Videos = videos
 }
 
+func (widget *videosWidget) notificationItems() []notificationItem {
+	items := make([]notificationItem, len(widget.Videos))
+
+	for i := range widget.Videos {
+		video := &widget.Videos[i]
+		items[i] = notificationItem{
+			Key:         video.SeenKey(),
+			Title:       video.Title,
+			URL:         video.Url,
+			Author:      video.Author,
+			ImageURL:    video.ThumbnailUrl,
+			PublishedAt: video.TimePosted,
+		}
+	}
+
+	return items
+}
+
 func (widget *videosWidget) Render() template.HTML {
 	var template *template.Template
 
@@ -368,6 +218,7 @@ type youtubeFeedResponseXml struct {
 	Channel     string `xml:"author>name"`
 	ChannelLink string `xml:"author>uri"`
 	Videos      []struct {
+		ID        string `xml:"http://www.youtube.com/xml/schemas/2015 videoId"`
 		Title     string `xml:"title"`
 		Published string `xml:"published"`
 		Link      struct {
@@ -392,17 +243,39 @@ func parseYoutubeFeedTime(t string) time.Time {
 }
 
 type video struct {
+	ID           string
 	ThumbnailUrl string
 	Title        string
 	Url          string
 	Author       string
 	AuthorUrl    string
 	TimePosted   time.Time
-	Cover        string
-	Ctime        int64
-	Bvid         string
+	IsLive       bool
+	// the entry from the config which the video was fetched through
+	channel string
+
+	// Zero when the source doesn't provide them, which is the case for YouTube
+	Duration time.Duration
+	Views    int
+	Danmaku  int
+
+	// Smaller copies of the thumbnail made by the image cache, if there are any
+	ThumbnailSrcset string
 }
 
+// Formatted the way that video sites do, e.g. 4:05 or 1:02:03
+func (v *video) FormattedDuration() string {
+	seconds := int(v.Duration.Seconds())
+	if seconds <= 0 {
+		return ""
+	}
+
+	if seconds < 3600 {
+		return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+	}
+
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
 
 type videoList []video
 
@@ -414,94 +287,302 @@ func (v videoList) sortByNewest() videoList {
 	return v
 }
 
-// func fetchYoutubeChannelUploads(channelOrPlaylistIDs []string, videoUrlTemplate string, includeShorts bool) (videoList, error) {
-// 	requests := make([]*http.Request, 0, len(channelOrPlaylistIDs))
-
-// 	for i := range channelOrPlaylistIDs {
-// 		var feedUrl string
-// 		if strings.HasPrefix(channelOrPlaylistIDs[i], videosWidgetPlaylistPrefix) {
-// 			feedUrl = "https://www.youtube.com/feeds/videos.xml?playlist_id=" +
-// 				strings.TrimPrefix(channelOrPlaylistIDs[i], videosWidgetPlaylistPrefix)
-// 		} else if !includeShorts && strings.HasPrefix(channelOrPlaylistIDs[i], "UC") {
-// 			playlistId := strings.Replace(channelOrPlaylistIDs[i], "UC", "UULF", 1)
-// 			feedUrl = "https://www.youtube.com/feeds/videos.xml?playlist_id=" + playlistId
-// 		} else {
-// 			feedUrl = "https://www.youtube.com/feeds/videos.xml?channel_id=" + channelOrPlaylistIDs[i]
-// 		}
-
-// 		request, _ := http.NewRequest("GET", feedUrl, nil)
-// 		requests = append(requests, request)
-// 	}
-
-// 	job := newJob(decodeXmlFromRequestTask[youtubeFeedResponseXml](defaultHTTPClient), requests).withWorkers(30)
-// 	responses, errs, err := workerPoolDo(job)
-// 	if err != nil {
-// 		return nil, fmt.Errorf("%w: %v", errNoContent, err)
-// 	}
-
-// 	videos := make(videoList, 0, len(channelOrPlaylistIDs)*15)
-// 	var failed int
-
-// 	for i := range responses {
-// 		if errs[i] != nil {
-// 			failed++
-// 			slog.Error("Failed to fetch youtube feed", "channel", channelOrPlaylistIDs[i], "error", errs[i])
-// 			continue
-// 		}
-
-// 		response := responses[i]
-
-// 		for j := range response.Videos {
-// 			v := &response.Videos[j]
-// 			var videoUrl string
-
-// 			if videoUrlTemplate == "" {
-// 				videoUrl = v.Link.Href
-// 			} else {
-// 				parsedUrl, err := url.Parse(v.Link.Href)
-
-// 				if err == nil {
-// 					videoUrl = strings.ReplaceAll(videoUrlTemplate, "{VIDEO-ID}", parsedUrl.Query().Get("v"))
-// 				} else {
-// 					videoUrl = "#"
-// 				}
-// 			}
-
-// 			videos = append(videos, video{
-// 				ThumbnailUrl: v.Group.Thumbnail.Url,
-// 				Title:        v.Title,
-// 				Url:          videoUrl,
-// 				Author:       response.Channel,
-// 				AuthorUrl:    response.ChannelLink + "/videos",
-// 				TimePosted:   parseYoutubeFeedTime(v.Published),
-// 			})
-// 		}
-// 	}
-func fetchYoutubeChannelUploads(channelOrPlaylistIDs []string, videoUrlTemplate string, includeShorts bool) (videoList, error) {
+// Keeps the first occurrence of each video, so when called after sorting
+// the order stays the same
+func (v videoList) deduplicate() videoList {
+	seen := make(map[string]struct{}, len(v))
+	deduplicated := v[:0]
+
+	for i := range v {
+		key := ternary(v[i].ID != "", v[i].ID, v[i].Url)
+		if _, exists := seen[key]; exists {
+			continue
+		}
+
+		seen[key] = struct{}{}
+		deduplicated = append(deduplicated, v[i])
+	}
+
+	return deduplicated
+}
+
+// Videos whose duration isn't known are never filtered out by minDuration
+func (v videoList) filter(include, exclude *regexp.Regexp, minDuration time.Duration) videoList {
+	if include == nil && exclude == nil && minDuration <= 0 {
+		return v
+	}
+
+	filtered := v[:0]
+
+	for i := range v {
+		if include != nil && !include.MatchString(v[i].Title) {
+			continue
+		}
+
+		if exclude != nil && exclude.MatchString(v[i].Title) {
+			continue
+		}
+
+		if minDuration > 0 && v[i].Duration > 0 && v[i].Duration < minDuration {
+			continue
+		}
+
+		filtered = append(filtered, v[i])
+	}
+
+	return filtered
+}
+
+// Streams which are live right now go first, they won't be for long
+func (v videoList) pinLive() {
+	sort.SliceStable(v, func(i, j int) bool {
+		return v[i].IsLive && !v[j].IsLive
+	})
+}
+
+func (v videoList) limitPerChannel(limit int) videoList {
+	counts := make(map[string]int)
+	limited := v[:0]
+
+	for i := range v {
+		if counts[v[i].channel] >= limit {
+			continue
+		}
+
+		counts[v[i].channel]++
+		limited = append(limited, v[i])
+	}
+
+	return limited
+}
+
+var twitchLoginPattern = regexp.MustCompile(`^[a-z0-9_]{1,25}$`)
+
+type videoSource int
+
+const (
+	videoSourceYoutube videoSource = iota
+	videoSourceBilibili
+	videoSourceBilibiliList
+	videoSourceTwitch
+)
+
+const (
+	videosWidgetYoutubePrefix            = "youtube:"
+	videosWidgetBilibiliPrefix           = "bilibili:"
+	videosWidgetBilibiliCollectionPrefix = "collection:"
+	videosWidgetBilibiliSeriesPrefix     = "series:"
+	videosWidgetTwitchPrefix             = "twitch:"
+)
+
+// Entries without a prefix are treated as Bilibili user IDs when they're
+// entirely numeric, since YouTube channel IDs never are, and as YouTube
+// channel IDs otherwise
+func parseVideoChannel(channel string) (videoSource, string) {
+	switch {
+	case strings.HasPrefix(channel, videosWidgetBilibiliCollectionPrefix),
+		strings.HasPrefix(channel, videosWidgetBilibiliSeriesPrefix):
+		return videoSourceBilibiliList, channel
+	case strings.HasPrefix(channel, videosWidgetBilibiliPrefix):
+		id := strings.TrimPrefix(channel, videosWidgetBilibiliPrefix)
+		if source, list := parseVideoChannel(id); source == videoSourceBilibiliList {
+			return source, list
+		}
+
+		return videoSourceBilibili, id
+	case strings.HasPrefix(channel, videosWidgetTwitchPrefix):
+		return videoSourceTwitch, strings.ToLower(strings.TrimPrefix(channel, videosWidgetTwitchPrefix))
+	case strings.HasPrefix(channel, videosWidgetYoutubePrefix):
+		return videoSourceYoutube, strings.TrimPrefix(channel, videosWidgetYoutubePrefix)
+	case strings.HasPrefix(channel, videosWidgetPlaylistPrefix):
+		return videoSourceYoutube, channel
+	}
+
+	if _, err := strconv.ParseUint(channel, 10, 64); err == nil {
+		return videoSourceBilibili, channel
+	}
+
+	return videoSourceYoutube, channel
+}
+
+func fetchVideoUploads(client requestDoer, channels []string, videoUrlTemplate string, includeShorts bool, twitch *videosWidgetTwitchConfig, youtubeFeeds *conditionalRequestCache[youtubeFeedResponseXml], backoff *sourceBackoff) (videoList, error) {
+	idsBySource := make(map[videoSource][]string)
+	now := time.Now()
+	var disabled int
+
+	for i := range channels {
+		source, id := parseVideoChannel(channels[i])
+		if backoff.isDisabled(id, now) {
+			disabled++
+			continue
+		}
+
+		idsBySource[source] = append(idsBySource[source], id)
+	}
+
+	if disabled > 0 && disabled == len(channels) {
+		return nil, fmt.Errorf("%w: all channels are temporarily disabled after failing repeatedly", errNoContent)
+	}
+
+	fetchers := map[videoSource]func([]string) (videoList, int, error){
+		videoSourceYoutube: func(ids []string) (videoList, int, error) {
+			return fetchYoutubeChannelUploads(client, youtubeFeeds, backoff, ids, videoUrlTemplate, includeShorts)
+		},
+		videoSourceBilibili: func(uids []string) (videoList, int, error) {
+			return fetchBilibiliSpaceUploads(client, backoff, uids)
+		},
+		videoSourceBilibiliList: func(lists []string) (videoList, int, error) {
+			return fetchBilibiliListUploads(client, backoff, lists)
+		},
+		videoSourceTwitch: func(logins []string) (videoList, int, error) {
+			return fetchTwitchChannelVideos(client, logins, twitch)
+		},
+	}
+
+	type result struct {
+		videos videoList
+		failed int
+		err    error
+	}
+
+	var wg sync.WaitGroup
+	results := make([]result, 0, len(idsBySource))
+	var resultsMu sync.Mutex
+
+	for source, ids := range idsBySource {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			videos, failed, err := fetchers[source](ids)
+
+			resultsMu.Lock()
+			results = append(results, result{videos, failed, err})
+			resultsMu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	var videos videoList
+	var failed int
+
+	for i := range results {
+		if results[i].err != nil {
+			return nil, fmt.Errorf("%w: %v", errNoContent, results[i].err)
+		}
+
+		videos = append(videos, results[i].videos...)
+		failed += results[i].failed
+	}
+
+	if len(videos) == 0 {
+		return nil, errNoContent
+	}
+
+	videos.sortByNewest()
+
+	if failed > 0 || disabled > 0 {
+		return videos, fmt.Errorf("%w: missing videos from %d channels%s", errPartialContent, failed+disabled, disabledSourcesMessage(disabled))
+	}
+
+	return videos, nil
+}
+
+// Returns the number of channels or playlists which couldn't be fetched
+// along with the videos of the rest
+func fetchYoutubeChannelUploads(client requestDoer, feeds *conditionalRequestCache[youtubeFeedResponseXml], backoff *sourceBackoff, channelOrPlaylistIDs []string, videoUrlTemplate string, includeShorts bool) (videoList, int, error) {
 	requests := make([]*http.Request, 0, len(channelOrPlaylistIDs))
-	u := "https://app.bilibili.com/x/v2/space/archive/cursor?vmid="
+
 	for i := range channelOrPlaylistIDs {
-		request, _ := http.NewRequest("GET", u+channelOrPlaylistIDs[i], nil)
-		request.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-		request.Header.Set("Referer", "https://www.bilibili.com/")
+		var feedUrl string
+		if strings.HasPrefix(channelOrPlaylistIDs[i], videosWidgetPlaylistPrefix) {
+			feedUrl = "https://www.youtube.com/feeds/videos.xml?playlist_id=" +
+				strings.TrimPrefix(channelOrPlaylistIDs[i], videosWidgetPlaylistPrefix)
+		} else if !includeShorts && strings.HasPrefix(channelOrPlaylistIDs[i], "UC") {
+			playlistId := strings.Replace(channelOrPlaylistIDs[i], "UC", "UULF", 1)
+			feedUrl = "https://www.youtube.com/feeds/videos.xml?playlist_id=" + playlistId
+		} else {
+			feedUrl = "https://www.youtube.com/feeds/videos.xml?channel_id=" + channelOrPlaylistIDs[i]
+		}
 
+		request, _ := http.NewRequest("GET", feedUrl, nil)
 		requests = append(requests, request)
 	}
 
-	job := newJob(decodeJsonFromRequestTask[bilibiliSpaceResponseJson](defaultHTTPClient), requests).withWorkers(30)
-
+	job := newJob(decodeXmlFromConditionalRequestTask(client, feeds), requests).withWorkers(30)
 	responses, errs, err := workerPoolDo(job)
-
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", errNoContent, err)
+		return nil, 0, err
 	}
 
 	videos := make(videoList, 0, len(channelOrPlaylistIDs)*15)
 	var failed int
+
+	for i := range responses {
+		backoff.record(channelOrPlaylistIDs[i], errs[i])
+
+		if errs[i] != nil {
+			failed++
+			slog.Error("Failed to fetch youtube feed", "channel", channelOrPlaylistIDs[i], "error", errs[i])
+			continue
+		}
+
+		response := responses[i]
+
+		for j := range response.Videos {
+			v := &response.Videos[j]
+			var videoUrl string
+
+			if videoUrlTemplate == "" {
+				videoUrl = v.Link.Href
+			} else {
+				parsedUrl, err := url.Parse(v.Link.Href)
+
+				if err == nil {
+					videoUrl = strings.ReplaceAll(videoUrlTemplate, "{VIDEO-ID}", parsedUrl.Query().Get("v"))
+				} else {
+					videoUrl = "#"
+				}
+			}
+
+			videos = append(videos, video{
+				ID:           v.ID,
+				ThumbnailUrl: v.Group.Thumbnail.Url,
+				Title:        v.Title,
+				Url:          videoUrl,
+				Author:       response.Channel,
+				AuthorUrl:    response.ChannelLink + "/videos",
+				TimePosted:   parseYoutubeFeedTime(v.Published),
+				channel:      channelOrPlaylistIDs[i],
+			})
+		}
+	}
+
+	return videos, failed, nil
+}
+
+func fetchBilibiliSpaceUploads(client requestDoer, backoff *sourceBackoff, uids []string) (videoList, int, error) {
+	requests := make([]*http.Request, 0, len(uids))
+	u := "https://app.bilibili.com/x/v2/space/archive/cursor?vmid="
+	for i := range uids {
+		requests = append(requests, newBilibiliRequest(u+uids[i]))
+	}
+
+	job := newJob(decodeJsonFromRequestTask[bilibiliSpaceResponseJson](client), requests).withWorkers(30)
+
+	responses, errs, err := workerPoolDo(job)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	videos := make(videoList, 0, len(uids)*15)
+	var failed int
 	for i := range responses {
+		backoff.record(uids[i], errs[i])
+
 		if errs[i] != nil {
 			failed++
-			slog.Error("Failed to fetch bilibili feed", "uid", channelOrPlaylistIDs[i], "error", errs[i])
+			slog.Error("Failed to fetch bilibili feed", "uid", uids[i], "error", errs[i])
 			continue
 		}
 		response := responses[i]
@@ -509,36 +590,361 @@ func fetchYoutubeChannelUploads(channelOrPlaylistIDs []string, videoUrlTemplate
 			bilivideo := &response.Data.Item[j]
 			videoUrl := `https://www.bilibili.com/video/` + bilivideo.Bvid
 
-			// 🎯 核心修改：使用真正的缓存机制
-            // cachedImageURL := globalImageCache.GetCachedImageURL(bilivideo.Cover)
-            
-            // // 预加载图片（可选，提升用户体验）
-            // globalImageCache.PreloadImage(bilivideo.Cover)
-            
-            // fmt.Printf("Original cover: %s\n", bilivideo.Cover)
-            // fmt.Printf("Cached cover: %s\n", cachedImageURL)
-
+			// covers are refused when the Referer isn't bilibili's, so
+			// they're downloaded by the image cache instead
 			videos = append(videos, video{
-				ThumbnailUrl: bilivideo.Cover,
-				// ThumbnailUrl: cachedImageURL,
-				Title:        bilivideo.Title,
-				Url:          strings.ReplaceAll(videoUrl, "http://", "https://"),
-				Author:       bilivideo.Author,
-				AuthorUrl:    `https://space.bilibili.com/` + channelOrPlaylistIDs[i],
-				TimePosted:   time.Unix(bilivideo.Ctime, 0),
+				ID:              bilivideo.Bvid,
+				ThumbnailUrl:    globalImageCache.GetCachedImageURL(bilivideo.Cover),
+				ThumbnailSrcset: globalImageCache.GetCachedImageSrcset(bilivideo.Cover),
+				Title:           bilivideo.Title,
+				Url:             strings.ReplaceAll(videoUrl, "http://", "https://"),
+				Author:          bilivideo.Author,
+				AuthorUrl:       `https://space.bilibili.com/` + uids[i],
+				TimePosted:      time.Unix(bilivideo.Ctime, 0),
+				Duration:        time.Duration(bilivideo.Duration) * time.Second,
+				Views:           bilivideo.Play,
+				Danmaku:         bilivideo.Danmaku,
+				channel:         uids[i],
 			})
 		}
 	}
 
-	if len(videos) == 0 {
-		return nil, errNoContent
+	return videos, failed, nil
+}
+
+func newBilibiliRequest(url string) *http.Request {
+	request, _ := http.NewRequest("GET", url, nil)
+	request.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
+	request.Header.Set("Referer", "https://www.bilibili.com/")
+
+	return request
+}
+
+type bilibiliListArchivesResponseJson struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Archives []struct {
+			Title    string `json:"title"`
+			Pic      string `json:"pic"`
+			Pubdate  int64  `json:"pubdate"`
+			Bvid     string `json:"bvid"`
+			Duration int64  `json:"duration"`
+			Stat     struct {
+				View int `json:"view"`
+			} `json:"stat"`
+		} `json:"archives"`
+		// only present for collections
+		Meta struct {
+			Name string `json:"name"`
+		} `json:"meta"`
+	} `json:"data"`
+}
+
+type bilibiliSeriesResponseJson struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Meta struct {
+			Name string `json:"name"`
+		} `json:"meta"`
+	} `json:"data"`
+}
+
+// Both collections (合集) and series (系列) belong to a user, whose UID is
+// needed along with the ID of the list, e.g. "collection:946974:1557"
+func parseBilibiliList(list string) (string, string, error) {
+	kind, rest, _ := strings.Cut(list, ":")
+	if kind+":" != videosWidgetBilibiliCollectionPrefix && kind+":" != videosWidgetBilibiliSeriesPrefix {
+		return "", "", fmt.Errorf("unknown bilibili list %q", list)
 	}
 
-	videos.sortByNewest()
+	uid, id, found := strings.Cut(rest, ":")
+	_, uidErr := strconv.ParseUint(uid, 10, 64)
+	_, idErr := strconv.ParseUint(id, 10, 64)
+
+	if !found || uidErr != nil || idErr != nil {
+		return "", "", fmt.Errorf("invalid bilibili %s %q, expected %s:<UID>:<ID>", kind, list, kind)
+	}
+
+	return uid, id, nil
+}
+
+func fetchBilibiliListUploads(client requestDoer, backoff *sourceBackoff, lists []string) (videoList, int, error) {
+	job := newJob(func(list string) (videoList, error) {
+		return fetchBilibiliList(client, list)
+	}, lists).withWorkers(10)
+
+	responses, errs, err := workerPoolDo(job)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	videos := make(videoList, 0, len(lists)*30)
+	var failed int
+	for i := range responses {
+		backoff.record(lists[i], errs[i])
+
+		if errs[i] != nil {
+			failed++
+			slog.Error("Failed to fetch bilibili list", "list", lists[i], "error", errs[i])
+			continue
+		}
+
+		videos = append(videos, responses[i]...)
+	}
+
+	return videos, failed, nil
+}
+
+func fetchBilibiliList(client requestDoer, list string) (videoList, error) {
+	uid, id, err := parseBilibiliList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	isCollection := strings.HasPrefix(list, videosWidgetBilibiliCollectionPrefix)
+
+	var archivesURL, listURL string
+	if isCollection {
+		archivesURL = "https://api.bilibili.com/x/polymer/web-space/seasons_archives_list?sort_reverse=true&page_num=1&page_size=30&mid=" + uid + "&season_id=" + id
+		listURL = "https://space.bilibili.com/" + uid + "/lists/" + id + "?type=season"
+	} else {
+		archivesURL = "https://api.bilibili.com/x/series/archives?sort=desc&pn=1&ps=30&mid=" + uid + "&series_id=" + id
+		listURL = "https://space.bilibili.com/" + uid + "/lists/" + id + "?type=series"
+	}
+
+	response, err := decodeJsonFromRequest[bilibiliListArchivesResponseJson](client, newBilibiliRequest(archivesURL))
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Code != 0 {
+		return nil, fmt.Errorf("bilibili returned code %d: %s", response.Code, response.Message)
+	}
+
+	name := response.Data.Meta.Name
+	if !isCollection {
+		// the archives of a series don't include its name
+		series, err := decodeJsonFromRequest[bilibiliSeriesResponseJson](
+			client,
+			newBilibiliRequest("https://api.bilibili.com/x/series/series?series_id="+id),
+		)
+		if err == nil && series.Code == 0 {
+			name = series.Data.Meta.Name
+		}
+	}
+
+	if len(response.Data.Archives) == 0 {
+		return nil, errors.New("no videos in list")
+	}
 
-	if failed > 0 {
-		return videos, fmt.Errorf("%w: missing videos from %d channels", errPartialContent, failed)
+	videos := make(videoList, 0, len(response.Data.Archives))
+	for i := range response.Data.Archives {
+		archive := &response.Data.Archives[i]
+
+		videos = append(videos, video{
+			ID:              archive.Bvid,
+			ThumbnailUrl:    globalImageCache.GetCachedImageURL(archive.Pic),
+			ThumbnailSrcset: globalImageCache.GetCachedImageSrcset(archive.Pic),
+			Title:           archive.Title,
+			Url:             "https://www.bilibili.com/video/" + archive.Bvid,
+			Author:          name,
+			AuthorUrl:       listURL,
+			TimePosted:      time.Unix(archive.Pubdate, 0),
+			Duration:        time.Duration(archive.Duration) * time.Second,
+			Views:           archive.Stat.View,
+			channel:         list,
+		})
 	}
 
 	return videos, nil
 }
+
+// App access tokens are valid for around two months, so they're kept around
+// rather than requested on every update
+var twitchHelixTokens = struct {
+	sync.Mutex
+	byClientID map[string]twitchHelixToken
+}{byClientID: make(map[string]twitchHelixToken)}
+
+type twitchHelixToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+type twitchHelixTokenResponseJson struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type twitchHelixUsersResponseJson struct {
+	Data []struct {
+		ID          string `json:"id"`
+		Login       string `json:"login"`
+		DisplayName string `json:"display_name"`
+	} `json:"data"`
+}
+
+type twitchHelixStreamsResponseJson struct {
+	Data []struct {
+		UserLogin    string    `json:"user_login"`
+		UserName     string    `json:"user_name"`
+		Title        string    `json:"title"`
+		StartedAt    time.Time `json:"started_at"`
+		ThumbnailURL string    `json:"thumbnail_url"`
+	} `json:"data"`
+}
+
+type twitchHelixVideosResponseJson struct {
+	Data []struct {
+		ID           string    `json:"id"`
+		UserLogin    string    `json:"user_login"`
+		UserName     string    `json:"user_name"`
+		Title        string    `json:"title"`
+		URL          string    `json:"url"`
+		CreatedAt    time.Time `json:"created_at"`
+		ThumbnailURL string    `json:"thumbnail_url"`
+		// e.g. "3h8m33s"
+		Duration string `json:"duration"`
+	} `json:"data"`
+}
+
+func fetchTwitchHelixToken(client requestDoer, config *videosWidgetTwitchConfig) (string, error) {
+	twitchHelixTokens.Lock()
+	defer twitchHelixTokens.Unlock()
+
+	if token, ok := twitchHelixTokens.byClientID[config.ClientID]; ok && time.Now().Before(token.expiresAt) {
+		return token.value, nil
+	}
+
+	query := url.Values{
+		"client_id":     {config.ClientID},
+		"client_secret": {config.ClientSecret},
+		"grant_type":    {"client_credentials"},
+	}
+
+	request, _ := http.NewRequest("POST", "https://id.twitch.tv/oauth2/token?"+query.Encode(), nil)
+	response, err := decodeJsonFromRequest[twitchHelixTokenResponseJson](client, request)
+	if err != nil {
+		return "", fmt.Errorf("requesting twitch access token: %v", err)
+	}
+
+	twitchHelixTokens.byClientID[config.ClientID] = twitchHelixToken{
+		value:     response.AccessToken,
+		expiresAt: time.Now().Add(time.Duration(response.ExpiresIn)*time.Second - time.Minute),
+	}
+
+	return response.AccessToken, nil
+}
+
+func newTwitchHelixRequest(path string, query url.Values, clientID, token string) *http.Request {
+	request, _ := http.NewRequest("GET", "https://api.twitch.tv/helix"+path+"?"+query.Encode(), nil)
+	request.Header.Set("Client-Id", clientID)
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	return request
+}
+
+func twitchThumbnailURL(template string) string {
+	return strings.NewReplacer(
+		"{width}", "640", "{height}", "360",
+		"%{width}", "640", "%{height}", "360",
+	).Replace(template)
+}
+
+// Live streams are included as videos of their own which get pinned to the
+// top, followed by the most recent past broadcasts of each channel
+func fetchTwitchChannelVideos(client requestDoer, logins []string, config *videosWidgetTwitchConfig) (videoList, int, error) {
+	token, err := fetchTwitchHelixToken(client, config)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// both endpoints accept up to 100 channels at once
+	users, err := decodeJsonFromRequest[twitchHelixUsersResponseJson](
+		client,
+		newTwitchHelixRequest("/users", url.Values{"login": logins}, config.ClientID, token),
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("fetching twitch users: %v", err)
+	}
+
+	failed := len(logins) - len(users.Data)
+	videos := make(videoList, 0, len(logins)*15)
+
+	streams, err := decodeJsonFromRequest[twitchHelixStreamsResponseJson](
+		client,
+		newTwitchHelixRequest("/streams", url.Values{"user_login": logins}, config.ClientID, token),
+	)
+	if err != nil {
+		slog.Error("Failed to fetch twitch streams", "error", err)
+	}
+
+	liveSince := make(map[string]time.Time, len(streams.Data))
+
+	for i := range streams.Data {
+		stream := &streams.Data[i]
+		liveSince[stream.UserLogin] = stream.StartedAt
+
+		videos = append(videos, video{
+			ID:           "twitch-live-" + stream.UserLogin,
+			ThumbnailUrl: twitchThumbnailURL(stream.ThumbnailURL),
+			Title:        stream.Title,
+			Url:          "https://www.twitch.tv/" + stream.UserLogin,
+			Author:       stream.UserName,
+			AuthorUrl:    "https://www.twitch.tv/" + stream.UserLogin,
+			TimePosted:   stream.StartedAt,
+			IsLive:       true,
+			channel:      stream.UserLogin,
+		})
+	}
+
+	requests := make([]*http.Request, len(users.Data))
+	for i := range users.Data {
+		requests[i] = newTwitchHelixRequest("/videos", url.Values{
+			"user_id": {users.Data[i].ID},
+			"type":    {"archive"},
+			"first":   {"15"},
+		}, config.ClientID, token)
+	}
+
+	job := newJob(decodeJsonFromRequestTask[twitchHelixVideosResponseJson](client), requests).withWorkers(10)
+	responses, errs, err := workerPoolDo(job)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range responses {
+		if errs[i] != nil {
+			failed++
+			slog.Error("Failed to fetch twitch videos", "channel", users.Data[i].Login, "error", errs[i])
+			continue
+		}
+
+		for j := range responses[i].Data {
+			vod := &responses[i].Data[j]
+
+			// the broadcast which is still going on is already shown as live
+			if startedAt, ok := liveSince[vod.UserLogin]; ok && !vod.CreatedAt.Before(startedAt.Add(-time.Minute)) {
+				continue
+			}
+
+			duration, _ := time.ParseDuration(vod.Duration)
+
+			videos = append(videos, video{
+				ID:           vod.ID,
+				ThumbnailUrl: twitchThumbnailURL(vod.ThumbnailURL),
+				Title:        vod.Title,
+				Url:          vod.URL,
+				Author:       vod.UserName,
+				AuthorUrl:    "https://www.twitch.tv/" + vod.UserLogin + "/videos",
+				TimePosted:   vod.CreatedAt,
+				Duration:     duration,
+				channel:      users.Data[i].Login,
+			})
+		}
+	}
+
+	return videos, failed, nil
+}
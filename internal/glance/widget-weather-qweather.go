@@ -0,0 +1,259 @@
+package glance
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type qweatherAPI struct {
+	client  requestDoer
+	key     string
+	geoURL  string
+	dataURL string
+}
+
+// Accounts created after 2024 get a host of their own, older ones can keep
+// using the public hosts which have the APIs under different paths
+func (widget *weatherWidget) qweatherAPI() qweatherAPI {
+	if widget.APIHost == "" {
+		return qweatherAPI{
+			client:  widget.httpClient(defaultHTTPClient),
+			key:     widget.APIKey,
+			geoURL:  "https://geoapi.qweather.com/v2",
+			dataURL: "https://devapi.qweather.com/v7",
+		}
+	}
+
+	return qweatherAPI{
+		client:  widget.httpClient(defaultHTTPClient),
+		key:     widget.APIKey,
+		geoURL:  "https://" + widget.APIHost + "/geo/v2",
+		dataURL: "https://" + widget.APIHost + "/v7",
+	}
+}
+
+type qweatherPlacesResponseJson struct {
+	Code     string `json:"code"`
+	Location []struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Lat      string `json:"lat"`
+		Lon      string `json:"lon"`
+		Adm1     string `json:"adm1"`
+		Adm2     string `json:"adm2"`
+		Country  string `json:"country"`
+		Timezone string `json:"tz"`
+	} `json:"location"`
+}
+
+type qweatherNowResponseJson struct {
+	Code string `json:"code"`
+	Now  struct {
+		Temp      string `json:"temp"`
+		FeelsLike string `json:"feelsLike"`
+		Text      string `json:"text"`
+	} `json:"now"`
+}
+
+type qweatherHourlyResponseJson struct {
+	Code   string `json:"code"`
+	Hourly []struct {
+		FxTime string `json:"fxTime"`
+		Temp   string `json:"temp"`
+		Pop    string `json:"pop"`
+	} `json:"hourly"`
+}
+
+type qweatherDailyResponseJson struct {
+	Code  string `json:"code"`
+	Daily []struct {
+		Sunrise string `json:"sunrise"`
+		Sunset  string `json:"sunset"`
+		TempMax string `json:"tempMax"`
+		TempMin string `json:"tempMin"`
+		TextDay string `json:"textDay"`
+	} `json:"daily"`
+}
+
+func (api qweatherAPI) request(requestURL string, query url.Values) *http.Request {
+	query.Set("key", api.key)
+	query.Set("lang", "zh")
+	request, _ := http.NewRequest("GET", requestURL+"?"+query.Encode(), nil)
+
+	return request
+}
+
+// The status of a request is given in the body, errors still get a 200 response
+func checkQWeatherResponseCode(code string) error {
+	if code == "200" {
+		return nil
+	}
+
+	switch code {
+	case "204":
+		return fmt.Errorf("no data for the requested location")
+	case "401":
+		return fmt.Errorf("invalid api key")
+	case "402":
+		return fmt.Errorf("the quota of requests has been used up")
+	case "403":
+		return fmt.Errorf("access denied, check the api-host and the permissions of the key")
+	case "429":
+		return fmt.Errorf("too many requests")
+	}
+
+	return fmt.Errorf("qweather returned code %s", code)
+}
+
+// The location can be a name, such as 北京 or 朝阳, 北京 to choose between places
+// with the same name, or coordinates
+func fetchQWeatherPlace(api qweatherAPI, location string, latitude, longitude *float64) (*weatherPlace, error) {
+	query := url.Values{}
+	query.Set("number", "1")
+
+	if latitude != nil {
+		query.Set("location", fmt.Sprintf("%.2f,%.2f", *longitude, *latitude))
+	} else {
+		name, area, _ := strings.Cut(location, ",")
+		query.Set("location", strings.TrimSpace(name))
+
+		if area = strings.TrimSpace(area); area != "" {
+			query.Set("adm", area)
+		}
+	}
+
+	response, err := decodeJsonFromRequest[qweatherPlacesResponseJson](api.client, api.request(api.geoURL+"/city/lookup", query))
+	if err != nil {
+		return nil, fmt.Errorf("fetching places data: %v", err)
+	}
+
+	if err := checkQWeatherResponseCode(response.Code); err != nil {
+		return nil, fmt.Errorf("fetching places data: %v", err)
+	}
+
+	if len(response.Location) == 0 {
+		return nil, fmt.Errorf("no places found for %s", location)
+	}
+
+	found := response.Location[0]
+
+	loc, err := time.LoadLocation(found.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("loading location: %v", err)
+	}
+
+	place := &weatherPlace{
+		Name:     found.Name,
+		Area:     ternary(found.Adm2 != "" && found.Adm2 != found.Name, found.Adm2, found.Adm1),
+		Country:  found.Country,
+		Timezone: found.Timezone,
+		id:       found.ID,
+		location: loc,
+	}
+
+	place.Latitude, _ = strconv.ParseFloat(found.Lat, 64)
+	place.Longitude, _ = strconv.ParseFloat(found.Lon, 64)
+
+	return place, nil
+}
+
+func parseQWeatherNumber(value string) float64 {
+	number, _ := strconv.ParseFloat(value, 64)
+	return number
+}
+
+func fetchWeatherFromQWeather(api qweatherAPI, place *weatherPlace, units string, forecastDays int) (*weather, error) {
+	query := url.Values{}
+	query.Set("location", place.id)
+	query.Set("unit", ternary(units == "imperial", "i", "m"))
+
+	now, err := decodeJsonFromRequest[qweatherNowResponseJson](api.client, api.request(api.dataURL+"/weather/now", query))
+	if err == nil {
+		err = checkQWeatherResponseCode(now.Code)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: fetching current weather: %v", errNoContent, err)
+	}
+
+	daily, err := decodeJsonFromRequest[qweatherDailyResponseJson](
+		api.client,
+		api.request(api.dataURL+ternary(forecastDays > 3, "/weather/7d", "/weather/3d"), query),
+	)
+	if err == nil {
+		err = checkQWeatherResponseCode(daily.Code)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: fetching daily forecast: %v", errNoContent, err)
+	}
+
+	if len(daily.Daily) == 0 {
+		return nil, fmt.Errorf("%w: no daily forecast was returned", errNoContent)
+	}
+
+	currentTime := time.Now().In(place.location)
+	w := &weather{
+		Temperature:         int(parseQWeatherNumber(now.Now.Temp)),
+		ApparentTemperature: int(parseQWeatherNumber(now.Now.FeelsLike)),
+		Description:         now.Now.Text,
+		CurrentColumn:       currentTime.Hour() / 2,
+		SunriseColumn:       0,
+		SunsetColumn:        11,
+	}
+
+	// empty during polar days and nights
+	if sunrise, err := time.Parse("15:04", daily.Daily[0].Sunrise); err == nil {
+		w.SunriseColumn = sunrise.Hour() / 2
+	}
+
+	if sunset, err := time.Parse("15:04", daily.Daily[0].Sunset); err == nil {
+		w.SunsetColumn = max(0, (sunset.Hour()-1)/2)
+	}
+
+	hourly, err := decodeJsonFromRequest[qweatherHourlyResponseJson](api.client, api.request(api.dataURL+"/weather/24h", query))
+	if err == nil {
+		err = checkQWeatherResponseCode(hourly.Code)
+	}
+
+	var partialErr error
+	if err != nil {
+		partialErr = fmt.Errorf("%w: fetching hourly forecast: %v", errPartialContent, err)
+	} else {
+		// the forecast starts at the current hour, so the hours of today which
+		// have already passed get filled in with the ones of tomorrow
+		temperatures := make([]float64, 24)
+		precipitations := make([]int, 24)
+		filled := 0
+
+		for _, hour := range hourly.Hourly {
+			at, err := time.Parse("2006-01-02T15:04Z07:00", hour.FxTime)
+			if err != nil {
+				continue
+			}
+
+			h := at.In(place.location).Hour()
+			temperatures[h] = parseQWeatherNumber(hour.Temp)
+			precipitations[h] = int(math.Round(parseQWeatherNumber(hour.Pop)))
+			filled++
+		}
+
+		if filled >= 24 {
+			w.Columns = newWeatherColumns(temperatures, precipitations, w.CurrentColumn, w.Temperature)
+		}
+	}
+
+	for i := 0; i < forecastDays && i < len(daily.Daily); i++ {
+		w.Days = append(w.Days, weatherDay{
+			Label:       relativeDayLabel(currentTime, i),
+			Description: daily.Daily[i].TextDay,
+			High:        int(math.Round(parseQWeatherNumber(daily.Daily[i].TempMax))),
+			Low:         int(math.Round(parseQWeatherNumber(daily.Daily[i].TempMin))),
+		})
+	}
+
+	return w, partialErr
+}
@@ -19,26 +19,64 @@ var weatherWidgetTemplate = mustParseTemplate("weather.html", "widget-base.html"
 
 type weatherWidget struct {
 	widgetBase   `yaml:",inline"`
-	Location     string                      `yaml:"location"`
-	ShowAreaName bool                        `yaml:"show-area-name"`
-	HideLocation bool                        `yaml:"hide-location"`
-	HourFormat   string                      `yaml:"hour-format"`
-	Units        string                      `yaml:"units"`
-	Place        *openMeteoPlaceResponseJson `yaml:"-"`
-	Weather      *weather                    `yaml:"-"`
-	TimeLabels   [12]string                  `yaml:"-"`
+	Location     string        `yaml:"location"`
+	ShowAreaName bool          `yaml:"show-area-name"`
+	HideLocation bool          `yaml:"hide-location"`
+	HourFormat   string        `yaml:"hour-format"`
+	Units        string        `yaml:"units"`
+	Place        *weatherPlace `yaml:"-"`
+	Weather      *weather      `yaml:"-"`
+	TimeLabels   [12]string    `yaml:"-"`
+
+	Provider     string   `yaml:"provider"`
+	APIKey       string   `yaml:"api-key"`
+	APIHost      string   `yaml:"api-host"`
+	Latitude     *float64 `yaml:"latitude"`
+	Longitude    *float64 `yaml:"longitude"`
+	ForecastDays int      `yaml:"forecast-days"`
 }
 
 var timeLabels12h = [12]string{"2am", "4am", "6am", "8am", "10am", "12pm", "2pm", "4pm", "6pm", "8pm", "10pm", "12am"}
 var timeLabels24h = [12]string{"02:00", "04:00", "06:00", "08:00", "10:00", "12:00", "14:00", "16:00", "18:00", "20:00", "22:00", "00:00"}
 
+const weatherMaxForecastDays = 7
+
 func (widget *weatherWidget) initialize() error {
-	widget.withTitle("天气").withCacheOnTheHour()
+	widget.withTitle("天气")
 
-	if widget.Location == "" {
+	// updating on the hour matches how often the forecasts change, but some
+	// providers have a daily quota of requests which it's worth being able to stay under
+	if widget.CustomCacheDuration != 0 {
+		widget.withCacheDuration(time.Duration(widget.CustomCacheDuration))
+	} else {
+		widget.withCacheOnTheHour()
+	}
+
+	if (widget.Latitude == nil) != (widget.Longitude == nil) {
+		return errors.New("latitude and longitude must be set together")
+	}
+
+	if widget.Latitude != nil {
+		if math.Abs(*widget.Latitude) > 90 || math.Abs(*widget.Longitude) > 180 {
+			return errors.New("latitude must be between -90 and 90 and longitude between -180 and 180")
+		}
+	} else if widget.Location == "" {
 		return fmt.Errorf("location is required")
 	}
 
+	switch widget.Provider {
+	case "", "open-meteo":
+		widget.Provider = "open-meteo"
+	case "qweather":
+		if widget.APIKey == "" {
+			return errors.New("api-key is required for qweather")
+		}
+
+		widget.APIHost = strings.TrimRight(strings.TrimPrefix(strings.TrimPrefix(widget.APIHost, "https://"), "http://"), "/")
+	default:
+		return errors.New("provider must be either open-meteo or qweather")
+	}
+
 	if widget.HourFormat == "" || widget.HourFormat == "12h" {
 		widget.TimeLabels = timeLabels12h
 	} else if widget.HourFormat == "24h" {
@@ -53,12 +91,16 @@ func (widget *weatherWidget) initialize() error {
 		return errors.New("units must be either metric or imperial")
 	}
 
+	if widget.ForecastDays < 0 || widget.ForecastDays > weatherMaxForecastDays {
+		return fmt.Errorf("forecast-days must be between 0 and %d", weatherMaxForecastDays)
+	}
+
 	return nil
 }
 
 func (widget *weatherWidget) update(ctx context.Context) {
 	if widget.Place == nil {
-		place, err := fetchOpenMeteoPlaceFromName(widget.Location)
+		place, err := widget.fetchPlace()
 		if err != nil {
 			widget.withError(err).scheduleEarlyUpdate()
 			return
@@ -67,7 +109,14 @@ func (widget *weatherWidget) update(ctx context.Context) {
 		widget.Place = place
 	}
 
-	weather, err := fetchWeatherForOpenMeteoPlace(widget.Place, widget.Units)
+	var weather *weather
+	var err error
+
+	if widget.Provider == "qweather" {
+		weather, err = fetchWeatherFromQWeather(widget.qweatherAPI(), widget.Place, widget.Units, widget.ForecastDays)
+	} else {
+		weather, err = fetchWeatherForOpenMeteoPlace(widget.httpClient(defaultHTTPClient), widget.Place, widget.Units, widget.ForecastDays)
+	}
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
@@ -76,6 +125,33 @@ func (widget *weatherWidget) update(ctx context.Context) {
 	widget.Weather = weather
 }
 
+func (widget *weatherWidget) fetchPlace() (*weatherPlace, error) {
+	if widget.Provider == "qweather" {
+		place, err := fetchQWeatherPlace(widget.qweatherAPI(), widget.Location, widget.Latitude, widget.Longitude)
+		if err != nil {
+			return nil, err
+		}
+
+		// a name is only given alongside coordinates to be displayed
+		if widget.Latitude != nil && widget.Location != "" {
+			place.Name, place.Area, place.Country = widget.Location, "", ""
+		}
+
+		return place, nil
+	}
+
+	if widget.Latitude != nil {
+		// the timezone gets filled in from the first forecast
+		return &weatherPlace{
+			Name:      widget.Location,
+			Latitude:  *widget.Latitude,
+			Longitude: *widget.Longitude,
+		}, nil
+	}
+
+	return fetchOpenMeteoPlaceFromName(widget.httpClient(defaultHTTPClient), widget.Location)
+}
+
 func (widget *weatherWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, weatherWidgetTemplate)
 }
@@ -83,19 +159,42 @@ func (widget *weatherWidget) Render() template.HTML {
 type weather struct {
 	Temperature         int
 	ApparentTemperature int
-	WeatherCode         int
+	Description         string
 	CurrentColumn       int
 	SunriseColumn       int
 	SunsetColumn        int
 	Columns             []weatherColumn
+	Days                []weatherDay
+}
+
+type weatherDay struct {
+	Label       string
+	Description string
+	High        int
+	Low         int
 }
 
-func (w *weather) WeatherCodeAsString() string {
-	if weatherCode, ok := weatherCodeTable[w.WeatherCode]; ok {
-		return weatherCode
+type weatherPlace struct {
+	Name      string
+	Area      string
+	Country   string
+	Latitude  float64
+	Longitude float64
+	Timezone  string
+	// The ID of the place for providers which have one
+	id       string
+	location *time.Location
+}
+
+func (p *weatherPlace) DisplayName(showArea bool) string {
+	parts := make([]string, 0, 3)
+	for _, part := range []string{p.Name, ternary(showArea, p.Area, ""), p.Country} {
+		if part != "" && !slices.Contains(parts, part) {
+			parts = append(parts, part)
+		}
 	}
 
-	return ""
+	return strings.Join(parts, ", ")
 }
 
 type openMeteoPlacesResponseJson struct {
@@ -109,13 +208,17 @@ type openMeteoPlaceResponseJson struct {
 	Longitude float64
 	Timezone  string
 	Country   string
-	location  *time.Location
 }
 
 type openMeteoWeatherResponseJson struct {
+	Timezone string `json:"timezone"`
+
 	Daily struct {
-		Sunrise []int64 `json:"sunrise"`
-		Sunset  []int64 `json:"sunset"`
+		Sunrise        []int64   `json:"sunrise"`
+		Sunset         []int64   `json:"sunset"`
+		WeatherCode    []int     `json:"weather_code"`
+		TemperatureMax []float64 `json:"temperature_2m_max"`
+		TemperatureMin []float64 `json:"temperature_2m_min"`
 	} `json:"daily"`
 
 	Hourly struct {
@@ -168,11 +271,11 @@ func parsePlaceName(name string) (string, string) {
 	return parts[0] + ", " + expandCountryAbbreviations(parts[2]), strings.TrimSpace(parts[1])
 }
 
-func fetchOpenMeteoPlaceFromName(location string) (*openMeteoPlaceResponseJson, error) {
+func fetchOpenMeteoPlaceFromName(client requestDoer, location string) (*weatherPlace, error) {
 	location, area := parsePlaceName(location)
 	requestUrl := fmt.Sprintf("https://geocoding-api.open-meteo.com/v1/search?name=%s&count=20&language=en&format=json", url.QueryEscape(location))
 	request, _ := http.NewRequest("GET", requestUrl, nil)
-	responseJson, err := decodeJsonFromRequest[openMeteoPlacesResponseJson](defaultHTTPClient, request)
+	responseJson, err := decodeJsonFromRequest[openMeteoPlacesResponseJson](client, request)
 	if err != nil {
 		return nil, fmt.Errorf("fetching places data: %v", err)
 	}
@@ -205,12 +308,18 @@ func fetchOpenMeteoPlaceFromName(location string) (*openMeteoPlaceResponseJson,
 		return nil, fmt.Errorf("loading location: %v", err)
 	}
 
-	place.location = loc
-
-	return place, nil
+	return &weatherPlace{
+		Name:      place.Name,
+		Area:      place.Area,
+		Country:   place.Country,
+		Latitude:  place.Latitude,
+		Longitude: place.Longitude,
+		Timezone:  place.Timezone,
+		location:  loc,
+	}, nil
 }
 
-func fetchWeatherForOpenMeteoPlace(place *openMeteoPlaceResponseJson, units string) (*weather, error) {
+func fetchWeatherForOpenMeteoPlace(client requestDoer, place *weatherPlace, units string, forecastDays int) (*weather, error) {
 	query := url.Values{}
 	var temperatureUnit string
 
@@ -223,75 +332,119 @@ func fetchWeatherForOpenMeteoPlace(place *openMeteoPlaceResponseJson, units stri
 	query.Add("latitude", fmt.Sprintf("%f", place.Latitude))
 	query.Add("longitude", fmt.Sprintf("%f", place.Longitude))
 	query.Add("timeformat", "unixtime")
-	query.Add("timezone", place.Timezone)
-	query.Add("forecast_days", "1")
+	query.Add("timezone", ternary(place.Timezone != "", place.Timezone, "auto"))
+	query.Add("forecast_days", fmt.Sprint(max(1, forecastDays)))
 	query.Add("current", "temperature_2m,apparent_temperature,weather_code")
 	query.Add("hourly", "temperature_2m,precipitation_probability")
-	query.Add("daily", "sunrise,sunset")
+	query.Add("daily", "sunrise,sunset,weather_code,temperature_2m_max,temperature_2m_min")
 	query.Add("temperature_unit", temperatureUnit)
 
 	requestUrl := "https://api.open-meteo.com/v1/forecast?" + query.Encode()
 	request, _ := http.NewRequest("GET", requestUrl, nil)
-	responseJson, err := decodeJsonFromRequest[openMeteoWeatherResponseJson](defaultHTTPClient, request)
+	responseJson, err := decodeJsonFromRequest[openMeteoWeatherResponseJson](client, request)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", errNoContent, err)
 	}
 
+	if place.location == nil {
+		loc, err := time.LoadLocation(responseJson.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("%w: loading location: %v", errNoContent, err)
+		}
+
+		place.Timezone = responseJson.Timezone
+		place.location = loc
+	}
+
+	daily := &responseJson.Daily
+	if len(daily.Sunrise) == 0 || len(daily.Sunset) == 0 {
+		return nil, fmt.Errorf("%w: no daily forecast was returned", errNoContent)
+	}
+
 	now := time.Now().In(place.location)
-	bars := make([]weatherColumn, 0, 24)
-	currentBar := now.Hour() / 2
-	sunriseBar := (time.Unix(int64(responseJson.Daily.Sunrise[0]), 0).In(place.location).Hour()) / 2
-	sunsetBar := (time.Unix(int64(responseJson.Daily.Sunset[0]), 0).In(place.location).Hour() - 1) / 2
+	w := &weather{
+		Temperature:         int(responseJson.Current.Temperature),
+		ApparentTemperature: int(responseJson.Current.ApparentTemperature),
+		Description:         weatherCodeTable[responseJson.Current.WeatherCode],
+		CurrentColumn:       now.Hour() / 2,
+		SunriseColumn:       time.Unix(daily.Sunrise[0], 0).In(place.location).Hour() / 2,
+		SunsetColumn:        max(0, (time.Unix(daily.Sunset[0], 0).In(place.location).Hour()-1)/2),
+	}
 
-	if sunsetBar < 0 {
-		sunsetBar = 0
+	// the hours of every forecasted day are returned, only the ones of today get shown
+	if len(responseJson.Hourly.Temperature) >= 24 && len(responseJson.Hourly.PrecipitationProbability) >= 24 {
+		w.Columns = newWeatherColumns(
+			responseJson.Hourly.Temperature[:24],
+			responseJson.Hourly.PrecipitationProbability[:24],
+			w.CurrentColumn,
+			w.Temperature,
+		)
 	}
 
-	if len(responseJson.Hourly.Temperature) == 24 {
-		temperatures := make([]int, 12)
-		precipitations := make([]bool, 12)
+	for i := 0; i < forecastDays && i < len(daily.WeatherCode) && i < len(daily.TemperatureMax) && i < len(daily.TemperatureMin); i++ {
+		w.Days = append(w.Days, weatherDay{
+			Label:       relativeDayLabel(now, i),
+			Description: weatherCodeTable[daily.WeatherCode[i]],
+			High:        int(math.Round(daily.TemperatureMax[i])),
+			Low:         int(math.Round(daily.TemperatureMin[i])),
+		})
+	}
 
-		t := responseJson.Hourly.Temperature
-		p := responseJson.Hourly.PrecipitationProbability
+	return w, nil
+}
 
-		for i := 0; i < 24; i += 2 {
-			if i/2 == currentBar {
-				temperatures[i/2] = int(responseJson.Current.Temperature)
-			} else {
-				temperatures[i/2] = int(math.Round((t[i] + t[i+1]) / 2))
-			}
+// Turns the hourly forecast of a day into 12 columns of two hours each, the
+// column of the current hour shows the current temperature instead
+func newWeatherColumns(temperatures []float64, precipitationProbabilities []int, currentColumn, currentTemperature int) []weatherColumn {
+	columnTemperatures := make([]int, 12)
+	precipitations := make([]bool, 12)
 
-			precipitations[i/2] = (p[i]+p[i+1])/2 > 75
+	t := temperatures
+	p := precipitationProbabilities
+
+	for i := 0; i < 24; i += 2 {
+		if i/2 == currentColumn {
+			columnTemperatures[i/2] = currentTemperature
+		} else {
+			columnTemperatures[i/2] = int(math.Round((t[i] + t[i+1]) / 2))
 		}
 
-		minT := slices.Min(temperatures)
-		maxT := slices.Max(temperatures)
+		precipitations[i/2] = (p[i]+p[i+1])/2 > 75
+	}
+
+	minT := slices.Min(columnTemperatures)
+	maxT := slices.Max(columnTemperatures)
 
-		temperaturesRange := float64(maxT - minT)
+	temperaturesRange := float64(maxT - minT)
+	columns := make([]weatherColumn, 0, 12)
 
-		for i := 0; i < 12; i++ {
-			bars = append(bars, weatherColumn{
-				Temperature:      temperatures[i],
-				HasPrecipitation: precipitations[i],
-			})
+	for i := 0; i < 12; i++ {
+		columns = append(columns, weatherColumn{
+			Temperature:      columnTemperatures[i],
+			HasPrecipitation: precipitations[i],
+		})
 
-			if temperaturesRange > 0 {
-				bars[i].Scale = float64(temperatures[i]-minT) / temperaturesRange
-			} else {
-				bars[i].Scale = 1
-			}
+		if temperaturesRange > 0 {
+			columns[i].Scale = float64(columnTemperatures[i]-minT) / temperaturesRange
+		} else {
+			columns[i].Scale = 1
 		}
 	}
 
-	return &weather{
-		Temperature:         int(responseJson.Current.Temperature),
-		ApparentTemperature: int(responseJson.Current.ApparentTemperature),
-		WeatherCode:         responseJson.Current.WeatherCode,
-		CurrentColumn:       currentBar,
-		SunriseColumn:       sunriseBar,
-		SunsetColumn:        sunsetBar,
-		Columns:             bars,
-	}, nil
+	return columns
+}
+
+var relativeDayWeekdayLabels = [7]string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}
+
+func relativeDayLabel(today time.Time, offset int) string {
+	switch offset {
+	case 0:
+		return "今天"
+	case 1:
+		return "明天"
+	}
+
+	return relativeDayWeekdayLabels[today.AddDate(0, 0, offset).Weekday()]
 }
 
 var weatherCodeTable = map[int]string{
@@ -3,12 +3,15 @@ package glance
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
 	"math"
 	"net/http"
+	"strconv"
 	"sync/atomic"
 	"time"
 
@@ -17,6 +20,12 @@ import (
 
 var widgetIDCounter atomic.Uint64
 
+var widgetPlaceholderTemplate = mustParseTemplate("widget-placeholder.html")
+
+// How long loading the placeholder of a widget waits for it to update before
+// giving up and leaving it to be pushed once it's done
+const widgetDefaultLoadTimeout = 15 * time.Second
+
 func newWidget(widgetType string) (widget, error) {
 	if widgetType == "" {
 		return nil, errors.New("widget 'type' property is empty or not specified")
@@ -27,6 +36,8 @@ func newWidget(widgetType string) (widget, error) {
 	switch widgetType {
 	case "calendar":
 		w = &calendarWidget{}
+	case "agenda":
+		w = &agendaWidget{}
 	case "calendar-legacy":
 		w = &oldCalendarWidget{}
 	case "clock":
@@ -45,6 +56,8 @@ func newWidget(widgetType string) (widget, error) {
 		w = &releasesWidget{}
 	case "videos":
 		w = &videosWidget{}
+	case "crypto-portfolio":
+		w = &cryptoPortfolioWidget{}
 	case "markets", "stocks":
 		w = &marketsWidget{}
 	case "reddit":
@@ -57,6 +70,12 @@ func newWidget(widgetType string) (widget, error) {
 		w = &twitchGamesWidget{}
 	case "twitch-channels":
 		w = &twitchChannelsWidget{}
+	case "bilibili-live":
+		w = &bilibiliLiveWidget{}
+	case "bilibili-dynamics":
+		w = &bilibiliDynamicsWidget{}
+	case "social-timeline":
+		w = &socialTimelineWidget{}
 	case "lobsters":
 		w = &lobstersWidget{}
 	case "change-detection":
@@ -81,6 +100,46 @@ func newWidget(widgetType string) (widget, error) {
 		w = &serverStatsWidget{}
 	case "to-do":
 		w = &todoWidget{}
+	case "notes":
+		w = &notesWidget{}
+	case "habits":
+		w = &habitsWidget{}
+	case "radar":
+		w = &radarWidget{}
+	case "energy":
+		w = &energyWidget{}
+	case "speedtest":
+		w = &speedtestWidget{}
+	case "smart":
+		w = &smartWidget{}
+	case "systemd-services":
+		w = &systemdServicesWidget{}
+	case "ssh-command":
+		w = &sshCommandWidget{}
+	case "shell-command":
+		w = &shellCommandWidget{}
+	case "email":
+		w = &emailWidget{}
+	case "home-assistant":
+		w = &homeAssistantWidget{}
+	case "mqtt":
+		w = &mqttWidget{}
+	case "syncthing":
+		w = &syncthingWidget{}
+	case "vaultwarden":
+		w = &vaultwardenWidget{}
+	case "paperless":
+		w = &paperlessWidget{}
+	case "mealie":
+		w = &mealieWidget{}
+	case "firefly":
+		w = &fireflyWidget{}
+	case "upcoming-media":
+		w = &upcomingMediaWidget{}
+	case "torrents":
+		w = &torrentsWidget{}
+	case "3d-printer":
+		w = &printerWidget{}
 	default:
 		return nil, fmt.Errorf("unknown widget type: %s", widgetType)
 	}
@@ -117,12 +176,36 @@ func (w *widgets) UnmarshalYAML(node *yaml.Node) error {
 			return err
 		}
 
+		if widget.base().History.Enabled {
+			if _, ok := widget.(historyCapableWidget); !ok {
+				return fmt.Errorf("line %d: the %s widget does not support history", node.Line, meta.Type)
+			}
+		}
+
+		widget.base().configHash, err = computeWidgetConfigHash(&node)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		widget.base().configLine = node.Line
+
 		*w = append(*w, widget)
 	}
 
 	return nil
 }
 
+// Identifies a widget by its configuration rather than its ID, which changes
+// every time the config gets reloaded. Used for anything that gets persisted.
+func computeWidgetConfigHash(node *yaml.Node) (string, error) {
+	encoded, err := yaml.Marshal(node)
+	if err != nil {
+		return "", fmt.Errorf("encoding widget config: %v", err)
+	}
+
+	hash := sha256.Sum256(encoded)
+	return hex.EncodeToString(hash[:8]), nil
+}
+
 type widget interface {
 	// These need to be exported because they get called in templates
 	Render() template.HTML
@@ -136,6 +219,49 @@ type widget interface {
 	setID(uint64)
 	handleRequest(w http.ResponseWriter, r *http.Request)
 	setHideHeader(bool)
+	base() *widgetBase
+}
+
+func updateWidget(ctx context.Context, w widget) {
+	base := w.base()
+	started := time.Now()
+
+	notifying, _ := w.(notifyingWidget)
+	if len(base.Notify) == 0 {
+		notifying = nil
+	}
+
+	var previousItems []notificationItem
+	if notifying != nil && base.ContentAvailable {
+		previousItems = notifying.notificationItems()
+	}
+
+	w.update(ctx)
+
+	base.lastUpdated = started
+	base.lastUpdateDuration = time.Since(started)
+
+	// kept around even after the widget recovers so that it's possible to
+	// find out why a widget was temporarily showing no content
+	if err := ternary(base.Error != nil, base.Error, base.Notice); err != nil {
+		base.lastError = err
+		base.lastErrorAt = started
+	}
+
+	if base.Error == nil {
+		base.lastSucceeded = started
+	} else if base.MaxStaleness > 0 && started.Sub(base.lastSucceeded) > time.Duration(base.MaxStaleness) {
+		// the content is too old to keep showing in place of the error
+		base.ContentAvailable = false
+	}
+
+	if notifying != nil && base.Error == nil {
+		base.queueNotifications(base.findNewNotificationItems(previousItems, notifying.notificationItems(), started))
+	}
+
+	recordWidgetHistory(w)
+	recordWidgetUpdateMetrics(w, base.lastUpdateDuration)
+	saveWidgetContent(w)
 }
 
 type cacheType int
@@ -147,27 +273,68 @@ const (
 )
 
 type widgetBase struct {
-	ID                  uint64           `yaml:"-"`
-	Providers           *widgetProviders `yaml:"-"`
-	Type                string           `yaml:"type"`
-	Title               string           `yaml:"title"`
-	TitleURL            string           `yaml:"title-url"`
-	HideHeader          bool             `yaml:"hide-header"`
-	CSSClass            string           `yaml:"css-class"`
-	CustomCacheDuration durationField    `yaml:"cache"`
-	ContentAvailable    bool             `yaml:"-"`
-	WIP                 bool             `yaml:"-"`
-	Error               error            `yaml:"-"`
-	Notice              error            `yaml:"-"`
-	templateBuffer      bytes.Buffer     `yaml:"-"`
-	cacheDuration       time.Duration    `yaml:"-"`
-	cacheType           cacheType        `yaml:"-"`
-	nextUpdate          time.Time        `yaml:"-"`
-	updateRetriedTimes  int              `yaml:"-"`
+	ID                  uint64               `yaml:"-"`
+	Providers           *widgetProviders     `yaml:"-"`
+	Type                string               `yaml:"type"`
+	Title               string               `yaml:"title"`
+	TitleURL            string               `yaml:"title-url"`
+	HideHeader          bool                 `yaml:"hide-header"`
+	CSSClass            string               `yaml:"css-class"`
+	CustomCacheDuration durationField        `yaml:"cache"`
+	RefreshSchedule     *cronScheduleField   `yaml:"refresh-schedule"`
+	MaxStaleness        durationField        `yaml:"max-staleness"`
+	LoadTimeout         durationField        `yaml:"load-timeout"`
+	RequestTimeout      durationField        `yaml:"request-timeout"`
+	Retries             *int                 `yaml:"retries"`
+	RetryBackoff        durationField        `yaml:"retry-backoff"`
+	History             widgetHistoryOptions `yaml:"history"`
+	Notify              []string             `yaml:"notify"`
+	TimeFormat          timeFormatField      `yaml:"time-format"`
+	ContentAvailable    bool                 `yaml:"-"`
+	WIP                 bool                 `yaml:"-"`
+	Error               error                `yaml:"-"`
+	Notice              error                `yaml:"-"`
+	templateBuffer      bytes.Buffer         `yaml:"-"`
+	cacheDuration       time.Duration        `yaml:"-"`
+	cacheType           cacheType            `yaml:"-"`
+	nextUpdate          time.Time            `yaml:"-"`
+	updateRetriedTimes  int                  `yaml:"-"`
+	configHash          string               `yaml:"-"`
+	configLine          int                  `yaml:"-"`
+	lastUpdated         time.Time            `yaml:"-"`
+	lastSucceeded       time.Time            `yaml:"-"`
+	revalidating        bool                 `yaml:"-"`
+	updateDone          chan struct{}        `yaml:"-"`
+	lastUpdateDuration  time.Duration        `yaml:"-"`
+	lastError           error                `yaml:"-"`
+	lastErrorAt         time.Time            `yaml:"-"`
+
+	notifications notificationWidgetState
+
+	accessRules `yaml:",inline"`
+}
+
+// Widgets which need to do work regardless of whether anyone is looking at the
+// page, the context gets cancelled once the application is stopped
+type backgroundWidget interface {
+	runInBackground(ctx context.Context)
 }
 
 type widgetProviders struct {
 	assetResolver func(string) string
+	baseURL       string
+	store         *stateStore
+	// nil when there's nowhere to keep the content of widgets
+	contentCache cacheStore
+	// Only set when authentication is enabled
+	usernameFromRequest func(*http.Request) (string, bool)
+	notificationTargets map[string]*notificationTarget
+	// Identify the user, or the device when authentication is disabled. Only
+	// the one for writing creates a device when the request doesn't have one.
+	ownerKeyFromRequest func(*http.Request) (string, bool)
+	ownerKeyForWriting  func(http.ResponseWriter, *http.Request) (string, error)
+	// Pushes the widget's content to the pages which are open
+	widgetChanged func(id uint64)
 }
 
 func (w *widgetBase) requiresUpdate(now *time.Time) bool {
@@ -182,14 +349,44 @@ func (w *widgetBase) requiresUpdate(now *time.Time) bool {
 	return now.After(w.nextUpdate)
 }
 
+// Whether the previous content can be shown while the widget gets updated in
+// the background, rather than holding up the page until the update is done
+func (w *widgetBase) canServeStale(now time.Time) bool {
+	return w.MaxStaleness > 0 &&
+		w.ContentAvailable &&
+		!w.lastSucceeded.IsZero() &&
+		now.Sub(w.lastSucceeded) < time.Duration(w.MaxStaleness)
+}
+
+func (w *widgetBase) IsRevalidating() bool {
+	return w.revalidating
+}
+
 func (w *widgetBase) IsWIP() bool {
 	return w.WIP
 }
 
+// Widgets whose content never expires have nothing to fetch again
+func (w *widgetBase) IsRefreshable() bool {
+	return w.cacheType != cacheTypeInfinite
+}
+
 func (w *widgetBase) update(ctx context.Context) {
 
 }
 
+func (w *widgetBase) base() *widgetBase {
+	return w
+}
+
+func (w *widgetBase) HistoryURL() string {
+	if !w.History.Enabled || w.Providers == nil {
+		return ""
+	}
+
+	return w.Providers.baseURL + "/history/" + strconv.FormatUint(w.ID, 10)
+}
+
 func (w *widgetBase) GetID() uint64 {
 	return w.ID
 }
@@ -202,10 +399,57 @@ func (w *widgetBase) setHideHeader(value bool) {
 	w.HideHeader = value
 }
 
+// Applies the widget's request-timeout, retries and retry-backoff, if it has
+// any, to the requests made through the client
+func (w *widgetBase) httpClient(client *requestClient) *requestClient {
+	return client.withOptions(&requestOptions{
+		Timeout:      w.RequestTimeout,
+		Retries:      w.Retries,
+		RetryBackoff: w.RetryBackoff,
+	})
+}
+
+func (w *widgetBase) loadTimeout() time.Duration {
+	if w.LoadTimeout > 0 {
+		return time.Duration(w.LoadTimeout)
+	}
+
+	return widgetDefaultLoadTimeout
+}
+
+// Rendered in place of widgets which are still updating when the page loads,
+// without touching any of the widget's data since the update is ongoing
+func renderWidgetPlaceholder(w widget, timedOut bool) template.HTML {
+	var html bytes.Buffer
+
+	err := widgetPlaceholderTemplate.Execute(&html, struct {
+		Widget   *widgetBase
+		TimedOut bool
+	}{w.base(), timedOut})
+	if err != nil {
+		slog.Error("Failed to render widget placeholder", "error", err)
+	}
+
+	return template.HTML(html.String())
+}
+
+// For widgets whose content changes outside of their regular updates
+func (w *widgetBase) notifyChanged() {
+	if w.Providers != nil && w.Providers.widgetChanged != nil {
+		w.Providers.widgetChanged(w.ID)
+	}
+}
+
 func (widget *widgetBase) handleRequest(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "not implemented", http.StatusNotImplemented)
 }
 
+// Unlike the ID, this stays the same across config reloads as long as the
+// widget's config doesn't change
+func (w *widgetBase) GetConfigHash() string {
+	return w.configHash
+}
+
 func (w *widgetBase) GetType() string {
 	return w.Type
 }
@@ -242,7 +486,7 @@ func (w *widgetBase) renderTemplate(data any, t *template.Template) template.HTM
 
 func (w *widgetBase) withTitle(title string) *widgetBase {
 	if w.Title == "" {
-		w.Title = title
+		w.Title = translateWidgetTitle(title)
 	}
 
 	return w
@@ -327,6 +571,12 @@ func (w *widgetBase) canContinueUpdateAfterHandlingErr(err error) bool {
 func (w *widgetBase) getNextUpdateTime() time.Time {
 	now := time.Now()
 
+	// the schedule takes the place of the cache duration, widgets which never
+	// get updated after the first time don't have one to replace
+	if w.RefreshSchedule != nil && w.cacheType != cacheTypeInfinite {
+		return w.RefreshSchedule.next(now)
+	}
+
 	if w.cacheType == cacheTypeDuration {
 		return now.Add(w.cacheDuration)
 	}
@@ -63,6 +63,7 @@ type SystemInfo struct {
 	} `json:"memory"`
 
 	Mountpoints []MountpointInfo `json:"mountpoints"`
+	Sensors     []SensorInfo     `json:"sensors"`
 }
 
 type MountpointInfo struct {
@@ -73,10 +74,17 @@ type MountpointInfo struct {
 	UsedPercent uint8  `json:"used_percent"`
 }
 
+type SensorInfo struct {
+	Key          string `json:"key"`
+	Name         string `json:"name"`
+	TemperatureC uint8  `json:"temperature_c"`
+}
+
 type SystemInfoRequest struct {
 	CPUTempSensor            string                       `yaml:"cpu-temp-sensor"`
 	HideMountpointsByDefault bool                         `yaml:"hide-mountpoints-by-default"`
 	Mountpoints              map[string]MointpointRequest `yaml:"mountpoints"`
+	TempSensors              map[string]SensorRequest     `yaml:"temp-sensors"`
 }
 
 type MointpointRequest struct {
@@ -84,6 +92,10 @@ type MointpointRequest struct {
 	Hide *bool  `yaml:"hide"`
 }
 
+type SensorRequest struct {
+	Name string `yaml:"name"`
+}
+
 // Currently caches hostname indefinitely which isn't ideal
 // Potential issue with caching boot time as it may not initially get reported correctly:
 // https://github.com/shirou/gopsutil/issues/842#issuecomment-1908972344
@@ -134,6 +146,7 @@ func Collect(req *SystemInfoRequest) (*SystemInfo, []error) {
 
 	info := &SystemInfo{
 		Mountpoints: []MountpointInfo{},
+		Sensors:     []SensorInfo{},
 	}
 
 	applyCachedHostInfo := func() {
@@ -223,6 +236,30 @@ func Collect(req *SystemInfoRequest) (*SystemInfo, []error) {
 				info.CPU.TemperatureIsAvailable = true
 				info.CPU.TemperatureC = uint8(cpuTempSensor.Temperature)
 			}
+
+			for key, sensorReq := range req.TempSensors {
+				found := false
+
+				for i := range sensorReadings {
+					if sensorReadings[i].SensorKey == key {
+						info.Sensors = append(info.Sensors, SensorInfo{
+							Key:          key,
+							Name:         sensorReq.Name,
+							TemperatureC: uint8(sensorReadings[i].Temperature),
+						})
+						found = true
+						break
+					}
+				}
+
+				if !found {
+					addErr(fmt.Errorf("temperature sensor %s not found", key))
+				}
+			}
+
+			sort.Slice(info.Sensors, func(a, b int) bool {
+				return info.Sensors[a].displayName() < info.Sensors[b].displayName()
+			})
 		} else {
 			addErr(fmt.Errorf("getting sensor readings: %v", err))
 		}
@@ -281,6 +318,14 @@ func Collect(req *SystemInfoRequest) (*SystemInfo, []error) {
 	return info, errs
 }
 
+func (s *SensorInfo) displayName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+
+	return s.Key
+}
+
 func inferCPUTempSensor(sensors []sensors.TemperatureStat) *sensors.TemperatureStat {
 	for i := range sensors {
 		switch sensors[i].SensorKey {